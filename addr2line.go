@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/demangle"
+	"github.com/polarsignals/split-debug/pkg/symbolize"
+)
+
+type addr2lineCmd struct {
+	Path      string   `kong:"required,arg,name='path',help='File path to the object or debug file to symbolize addresses with.',type:'path'"`
+	Addresses []string `kong:"required,arg,name='address',help='Hexadecimal addresses to symbolize.'"`
+
+	Functions bool `kong:"short='f',help='Show function names.'"`
+	Demangle  bool `kong:"short='C',help='Demangle the function names of C++ and Rust symbols.'"`
+}
+
+func (c *addr2lineCmd) Run() error {
+	addrs := make([]uint64, 0, len(c.Addresses))
+	for _, a := range c.Addresses {
+		addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(a), "0x"), 16, 64)
+		if err != nil {
+			return usageError(fmt.Errorf("invalid address %q: %w", a, err))
+		}
+		addrs = append(addrs, addr)
+	}
+
+	frames, err := symbolize.Resolve(c.Path, addrs)
+	if err != nil {
+		return fmt.Errorf("failed to symbolize: %w", err)
+	}
+
+	for _, f := range frames {
+		if c.Functions {
+			name := f.Function
+			if c.Demangle {
+				name = demangle.Filter(name)
+			}
+			fmt.Fprintln(os.Stdout, orUnknown(name))
+		}
+		fmt.Fprintf(os.Stdout, "%s:%d\n", orUnknown(f.File), f.Line)
+	}
+	return nil
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "??"
+	}
+	return s
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/polarsignals/split-debug/pkg/archive"
+	"github.com/polarsignals/split-debug/pkg/distpkg"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/tracing"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// bundle is an input that bundles several files, an artifact archive or a distribution package.
+type bundle struct {
+	// dest is the default output of the debug information of the bundle.
+	dest string
+	walk func(fn func(m *archive.Member) error) error
+	// newDebug returns the writer of the debug information of the members to w.
+	newDebug func(w io.Writer) (debugBundle, error)
+}
+
+// isBundle reports whether the input at path is an artifact archive or a distribution package.
+func isBundle(path string) bool {
+	_, _, isArchive := archive.Detect(path)
+	_, _, isPackage := distpkg.Detect(path)
+	return path != stdio && (isArchive || isPackage)
+}
+
+// openBundle returns the bundle of the input at path. The debug information of artifact archives
+// is written to a debug archive of the same format, the one of packages to a gzip compressed debug
+// archive or, with --debuginfo-package, to a debug information package of the distribution.
+func (c *extractCmd) openBundle(path string) (*bundle, error) {
+	if format, base, ok := distpkg.Detect(path); ok {
+		b := &bundle{
+			dest: base + "-debuginfo." + string(archive.TarGz),
+			walk: func(fn func(m *archive.Member) error) error { return distpkg.Walk(path, format, fn) },
+		}
+		if !c.DebuginfoPackage {
+			b.newDebug = c.newDebugArchive(archive.TarGz)
+			return b, nil
+		}
+		info, err := distpkg.ReadInfo(path, format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read package: %w", err)
+		}
+		b.dest = filepath.Join(filepath.Dir(path), distpkg.DebugName(format, info))
+		b.newDebug = func(w io.Writer) (debugBundle, error) { return newDebugPackage(w, format, info) }
+		return b, nil
+	}
+
+	format, base, _ := archive.Detect(path)
+	return &bundle{
+		dest:     base + "-debuginfo." + string(format),
+		walk:     func(fn func(m *archive.Member) error) error { return archive.Walk(path, format, fn) },
+		newDebug: c.newDebugArchive(format),
+	}, nil
+}
+
+// debugBundle collects the debug files of the members of a bundle.
+type debugBundle interface {
+	// check reports whether the debug file of the object file with the build ID can be added.
+	check(buildID string) error
+	// add adds the debug file of the member and returns its name in the bundle,
+	// the bundle is unusable after an error.
+	add(member, buildID, debugFile string, meta *metadata) (string, error)
+	close() error
+}
+
+// debugArchive stores the debug file of a member as <member>.debug, and its metadata as <member>.debug.json.
+type debugArchive struct {
+	w            *archive.Writer
+	emitMetadata bool
+}
+
+func (c *extractCmd) newDebugArchive(format archive.Format) func(w io.Writer) (debugBundle, error) {
+	return func(w io.Writer) (debugBundle, error) {
+		aw, err := archive.NewWriter(w, format)
+		if err != nil {
+			return nil, err
+		}
+		return &debugArchive{w: aw, emitMetadata: c.EmitMetadata}, nil
+	}
+}
+
+func (a *debugArchive) check(string) error { return nil }
+
+func (a *debugArchive) add(member, _, debugFile string, meta *metadata) (string, error) {
+	name := member + ".debug"
+	if err := a.w.AddFile(name, 0o644, debugFile); err != nil {
+		return "", fmt.Errorf("failed to add debug file of %s: %w", member, err)
+	}
+	if !a.emitMetadata {
+		return name, nil
+	}
+	meta.Path = member
+	meta.DebugFile = name
+	data, err := meta.marshal()
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal metadata of %s: %w", member, err)
+	}
+	if err := a.w.Add(name+".json", 0o644, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return "", fmt.Errorf("failed to add metadata of %s: %w", member, err)
+	}
+	return name, nil
+}
+
+func (a *debugArchive) close() error {
+	return a.w.Close()
+}
+
+// debugPackage installs the debug files by their build IDs into a debug information package,
+// it is written on close, the debug files are kept in a temporary directory until then.
+type debugPackage struct {
+	w      io.Writer
+	format distpkg.Format
+	info   *distpkg.Info
+	dir    string
+	files  []distpkg.File
+	added  map[string]bool
+}
+
+func newDebugPackage(w io.Writer, format distpkg.Format, info *distpkg.Info) (*debugPackage, error) {
+	dir, err := ioutil.TempDir("", "split-debug-package-*")
+	if err != nil {
+		return nil, err
+	}
+	return &debugPackage{w: w, format: format, info: info, dir: dir, added: map[string]bool{}}, nil
+}
+
+func (p *debugPackage) check(buildID string) error {
+	if !distpkg.ValidBuildID(buildID) {
+		return errors.New("no GNU build ID to install the debug file by")
+	}
+	return nil
+}
+
+func (p *debugPackage) add(_, buildID, debugFile string, _ *metadata) (string, error) {
+	name := distpkg.DebugPath(buildID)
+	// Packages often ship the same object file at several paths.
+	if p.added[buildID] {
+		return name, nil
+	}
+	path := filepath.Join(p.dir, buildID+".debug")
+	if err := os.Rename(debugFile, path); err != nil {
+		return "", err
+	}
+	p.added[buildID] = true
+	p.files = append(p.files, distpkg.File{BuildID: buildID, Path: path})
+	return name, nil
+}
+
+func (p *debugPackage) close() error {
+	defer os.RemoveAll(p.dir)
+	return distpkg.WriteDebug(p.w, p.format, p.info, p.files)
+}
+
+// extractBundle extracts the debug information of the ELF members of the bundle at path.
+// Each member is reported as <path>:<member> in the summary.
+func (c *extractCmd) extractBundle(ctx context.Context, logger log.Logger, tracer trace.Tracer, path string, sum *summary) {
+	res := fileResult{Path: path, Status: statusOK}
+	err := c.walkBundle(ctx, log.With(logger, "bundle", path), tracer, path, sum, &res)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to extract debug information from bundle", "bundle", path, "err", err)
+		res.fail(err)
+	}
+	c.auditOutput(logger, res)
+	sum.add(res)
+}
+
+func (c *extractCmd) walkBundle(ctx context.Context, logger log.Logger, tracer trace.Tracer, path string, sum *summary, res *fileResult) (err error) {
+	ctx, span := tracer.Start(ctx, "extract-bundle", trace.WithAttributes(attribute.String("path", path)))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	b, err := c.openBundle(path)
+	if err != nil {
+		return err
+	}
+	dest := c.Output
+	if dest == "" || c.toStdout(path) {
+		dest = b.dest
+	}
+	if !c.toStdout(path) {
+		err := c.checkOverwrite(logger, path, dest)
+		if errors.Is(err, errSkipExisting) {
+			res.Status = statusSkipped
+			res.Output = dest
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	output, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".*"+partialSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		output.Close()
+		if err != nil {
+			os.Remove(output.Name())
+		}
+	}()
+	debug, err := b.newDebug(output)
+	if err != nil {
+		return err
+	}
+
+	var members int
+	err = b.walk(func(m *archive.Member) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mres := fileResult{Path: path + ":" + m.Name, Status: statusOK}
+		br := bufio.NewReader(m.Reader)
+		if magic, _ := br.Peek(len(elf.ELFMAG)); !elfutils.HasELFMagic(magic) {
+			level.Debug(logger).Log("msg", "skipping member that is not an ELF file", "member", m.Name)
+			mres.Status = statusSkipped
+			sum.add(mres)
+			return nil
+		}
+		members++
+		m.Reader = br
+
+		debugFile, meta, err := c.extractMember(ctx, logger, tracer, m, &mres)
+		if err == nil {
+			defer os.Remove(debugFile)
+			err = debug.check(mres.BuildID)
+		}
+		if err != nil {
+			mres.fail(err)
+			sum.add(mres)
+			return nil
+		}
+
+		// Failing to add a member leaves the bundle corrupted, so it fails the whole bundle.
+		name, err := debug.add(m.Name, mres.BuildID, debugFile, meta)
+		if err != nil {
+			return err
+		}
+		mres.Output = name
+		sum.add(mres)
+		return nil
+	})
+	if err != nil {
+		debug.close()
+		return fmt.Errorf("failed to read bundle: %w", err)
+	}
+	if members == 0 {
+		level.Warn(logger).Log("msg", "no ELF files in bundle")
+	}
+	if err := debug.close(); err != nil {
+		return fmt.Errorf("failed to write debug information: %w", err)
+	}
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("failed to write debug information: %w", err)
+	}
+	if err := c.setOwnership(output.Name()); err != nil {
+		return fmt.Errorf("failed to set ownership: %w", err)
+	}
+
+	if c.toStdout(path) {
+		defer os.Remove(output.Name())
+		if err := copyToStdout(ctx, output.Name()); err != nil {
+			return fmt.Errorf("failed to write to stdout: %w", err)
+		}
+		res.Output = stdio
+		return nil
+	}
+	if err := os.Rename(output.Name(), dest); err != nil {
+		return fmt.Errorf("failed to move output into place: %w", err)
+	}
+	res.Output = dest
+	level.Info(logger).Log("msg", "debug information of bundle written", "output", dest, "members", members)
+	return nil
+}
+
+// extractMember extracts the debug information of the ELF member to a temporary file
+// and returns its path, the caller removes it.
+func (c *extractCmd) extractMember(ctx context.Context, logger log.Logger, tracer trace.Tracer, m *archive.Member, res *fileResult) (_ string, _ *metadata, err error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	job := newJob(log.With(logger, "member", m.Name), res.Path)
+	defer func() {
+		res.BuildID = job.BuildID
+		if err != nil {
+			level.Error(job.Logger).Log("msg", "failed to extract debug information", "err", err)
+		}
+	}()
+
+	// ELF processing needs random access, so the member is spilled to disk first.
+	job.Stage = "buffer"
+	spill, err := spillToTempFile(m, int64(c.MaxInputSize), nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to buffer member: %w", err)
+	}
+	defer os.Remove(spill)
+	job.Input = spill
+
+	debugFile, err := ioutil.TempFile("", "split-debug-*.debuginfo")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create staging file: %w", err)
+	}
+	// The writer closes the staging file, closing it again is harmless.
+	defer debugFile.Close()
+
+	meta, err := c.extract(ctx, tracer, job, nil, debugFile)
+	if err != nil {
+		os.Remove(debugFile.Name())
+		return "", nil, err
+	}
+	return debugFile.Name(), meta, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/splitelf"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+type assembleCmd struct {
+	Manifest string `kong:"required,arg,name='manifest',help='Manifest written by extract --split-sections.',type:'existingfile'"`
+	Blobs    string `kong:"required,help='Directory or http(s) URL the blobs are stored below, as sha256/<digest>.'"`
+	Output   string `kong:"required,short='o',help='Output file path of the debug file.',type:'path'"`
+	clientAuthFlags
+}
+
+// Run rebuilds the debug file of a manifest from its section blobs. Compressed sections are
+// written uncompressed.
+func (c *assembleCmd) Run(logger log.Logger) error {
+	data, err := ioutil.ReadFile(c.Manifest)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m splitelf.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	var blobs splitelf.Blobs = splitelf.Dir(c.Blobs)
+	if strings.HasPrefix(c.Blobs, "http://") || strings.HasPrefix(c.Blobs, "https://") {
+		client, err := c.httpClient()
+		if err != nil {
+			return usageError(err)
+		}
+		blobs = splitelf.NewHTTP(c.Blobs, client)
+	}
+
+	out, err := ioutil.TempFile(filepath.Dir(c.Output), "."+filepath.Base(c.Output)+".*"+partialSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(out.Name())
+	if err := splitelf.Assemble(out, &m, blobs); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to assemble debug file: %w", err)
+	}
+	if err := out.Chmod(0o644); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(out.Name(), c.Output); err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "debug file assembled", "output", c.Output, "build_id", m.BuildID, "sections", len(m.Sections))
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/polarsignals/split-debug/pkg/audit"
+	"github.com/polarsignals/split-debug/pkg/digest"
+	"github.com/polarsignals/split-debug/pkg/upload"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// auditFlags configure the audit log of the debug files written and uploaded.
+type auditFlags struct {
+	AuditLog string `kong:"placeholder='PATH',help='Append a JSON line for each debug file written or uploaded to this file, with the time, user and host, the build ID, the digests of the input and the debug file by --hash, where it went and the ID of the upload from the response of the server, e.g. for compliance teams tracking where the debug information goes. The file is never truncated.',type:'path'"`
+
+	auditLog *audit.Log
+	auditMu  sync.Mutex
+	// auditErr is the first failure to write to the audit log.
+	auditErr error
+}
+
+// openAudit opens the configured audit log for the events of the command, closeAudit closes it.
+func (f *auditFlags) openAudit(command string) error {
+	if f.AuditLog == "" {
+		return nil
+	}
+	l, err := audit.Open(f.AuditLog, command)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	f.auditLog = l
+	return nil
+}
+
+func (f *auditFlags) closeAudit() {
+	if f.auditLog != nil {
+		f.auditLog.Close()
+	}
+}
+
+// audit appends the event to the audit log. Failures are logged and fail the run once it is done,
+// see auditFailed, rather than the file: the debug file went where the event says all the same.
+func (f *auditFlags) audit(logger log.Logger, e audit.Event) {
+	if f.auditLog == nil {
+		return
+	}
+	if err := f.auditLog.Write(e); err != nil {
+		level.Error(logger).Log("msg", "failed to record debug file in audit log", "build_id", e.BuildID, "destination", e.Destination, "err", err)
+		f.auditMu.Lock()
+		if f.auditErr == nil {
+			f.auditErr = err
+		}
+		f.auditMu.Unlock()
+	}
+}
+
+// auditFailed returns an error if events could not be written to the audit log.
+func (f *auditFlags) auditFailed() error {
+	f.auditMu.Lock()
+	defer f.auditMu.Unlock()
+	if f.auditErr != nil {
+		return fmt.Errorf("audit log is incomplete: %w", f.auditErr)
+	}
+	return nil
+}
+
+// auditDigest returns the digest of the file at path prefixed with the algorithm, e.g. sha256:…,
+// and its size, or zero values if it cannot be read.
+func auditDigest(a digest.Algorithm, path string) (string, int64) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", 0
+	}
+	sum, err := digest.File(a, path)
+	if err != nil {
+		return "", fi.Size()
+	}
+	return a.Name() + ":" + sum, fi.Size()
+}
+
+// uploadEvent returns the event of the upload of the debug file of e by its outcome. The
+// destination is the URL of the receipt, or of the template if the upload was not attempted.
+func uploadEvent(e audit.Event, template string, receipt *upload.Receipt, err error) audit.Event {
+	e.Action, e.Destination = audit.ActionUploaded, receipt.URL
+	if e.Destination == "" {
+		e.Destination = upload.TargetURL(template, e.BuildID)
+	}
+	switch {
+	case errors.Is(err, upload.ErrAlreadyUploaded):
+		e.Action = audit.ActionUploadSkipped
+	case err != nil:
+		e.Action, e.Error = audit.ActionUploadFailed, err.Error()
+	// Dedup skips the uploads without attempting them.
+	case receipt.URL == "":
+		e.Action = audit.ActionUploadSkipped
+	default:
+		e.ResponseID = receipt.ID
+	}
+	return e
+}
+
+// auditOutput records the output of the file in the audit log, if it was written.
+func (c *extractCmd) auditOutput(logger log.Logger, res fileResult) {
+	if c.auditLog == nil || res.Status != statusOK || res.Output == "" {
+		return
+	}
+	e := audit.Event{Action: audit.ActionWritten, BuildID: res.BuildID, Input: res.Path, Destination: res.Output}
+	if res.Path != stdio {
+		e.InputDigest, _ = auditDigest(c.hash(), res.Path)
+	}
+	if res.Output != stdio {
+		e.OutputDigest, e.OutputSize = auditDigest(c.hash(), res.Output)
+	}
+	c.audit(logger, e)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/polarsignals/split-debug/pkg/auth"
+)
+
+// clientAuthFlags configure the TLS and the token of the HTTP clients of a command.
+type clientAuthFlags struct {
+	TLSCA           string `kong:"name='tls-ca',help='Verify the server certificates with the CA certificates of this PEM file rather than the system ones.',type:'existingfile'"`
+	TLSCert         string `kong:"name='tls-cert',help='Present the client certificate of this PEM file to servers requiring mutual TLS. Reloaded when it changes.',type:'existingfile'"`
+	TLSKey          string `kong:"name='tls-key',help='Key of the client certificate, a PEM file. Reloaded when it changes.',type:'existingfile'"`
+	BearerTokenFile string `kong:"help='Authenticate with the bearer token read from this file. Reloaded when it changes.',type:'existingfile'"`
+}
+
+// httpClient returns the client of the configured TLS and token, or nil if none are configured
+// and the default client does.
+func (f *clientAuthFlags) httpClient() (*http.Client, error) {
+	if f.TLSCA == "" && f.TLSCert == "" && f.TLSKey == "" && f.BearerTokenFile == "" {
+		return nil, nil
+	}
+	var rt http.RoundTripper = http.DefaultTransport
+	if f.TLSCA != "" || f.TLSCert != "" || f.TLSKey != "" {
+		cfg, err := auth.ClientTLS(f.TLSCA, f.TLSCert, f.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = cfg
+		rt = t
+	}
+	if f.BearerTokenFile != "" {
+		token, err := auth.NewTokenFile(f.BearerTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		rt = &auth.BearerTransport{Token: token, Base: rt}
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+// serverTLS returns the TLS configuration of the server flags, or nil to serve without TLS.
+func (f *serveFlags) serverTLS() (*tls.Config, error) {
+	if f.TLSCert == "" && f.TLSKey == "" {
+		if f.TLSClientCA != "" {
+			return nil, errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil
+	}
+	return auth.ServerTLS(f.TLSCert, f.TLSKey, f.TLSClientCA)
+}
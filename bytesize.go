@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// byteSize is a size in bytes that can be given as a human readable flag value,
+// e.g. 512MB or 1GiB. Decimal units are powers of 1000, binary units powers of 1024.
+type byteSize uint64
+
+var byteSizeUnits = map[string]uint64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *byteSize) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return fmt.Errorf("invalid size %q: unknown unit %q", s, s[i:])
+	}
+	*b = byteSize(n * float64(unit))
+	return nil
+}
+
+func (b byteSize) String() string {
+	const unit = 1000
+	if b < unit {
+		return fmt.Sprintf("%dB", uint64(b))
+	}
+	div, exp := uint64(unit), 0
+	for n := uint64(b) / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(b)/float64(div), "kMGTPE"[exp])
+}
+
+// bandwidth is a rate in bytes per second, given like a byteSize with an optional /s suffix,
+// e.g. 10MiB/s.
+type bandwidth byteSize
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *bandwidth) UnmarshalText(text []byte) error {
+	s := strings.TrimSuffix(strings.TrimSpace(string(text)), "/s")
+	return (*byteSize)(b).UnmarshalText([]byte(s))
+}
+
+func (b bandwidth) String() string {
+	return byteSize(b).String() + "/s"
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/polarsignals/split-debug/pkg/catalog"
+	"github.com/polarsignals/split-debug/pkg/digest"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// catalogFlags configure the catalog the processed files are recorded in.
+type catalogFlags struct {
+	Catalog       string `kong:"placeholder='PATH',help='Record the build ID, paths, sizes, digests and status of each processed file in this SQLite database, e.g. state.db.',type:'path'"`
+	SkipCataloged bool   `kong:"help='Skip the files whose build ID the catalog records as extracted by an earlier run. Requires --catalog.'"`
+
+	db *catalog.Catalog
+}
+
+// openCatalog opens the configured catalog, closeCatalog closes it.
+func (f *catalogFlags) openCatalog() error {
+	if f.Catalog == "" {
+		if f.SkipCataloged {
+			return usageError(errors.New("--skip-cataloged requires --catalog"))
+		}
+		return nil
+	}
+	db, err := catalog.Open(f.Catalog)
+	if err != nil {
+		return fmt.Errorf("failed to open catalog: %w", err)
+	}
+	f.db = db
+	return nil
+}
+
+func (f *catalogFlags) closeCatalog() {
+	if f.db != nil {
+		f.db.Close()
+	}
+}
+
+// cataloged returns the input the catalog records the build ID as extracted from, if skipping
+// cataloged files is enabled. Lookup errors are logged, the file is processed then.
+func (f *catalogFlags) cataloged(ctx context.Context, logger log.Logger, buildID string) string {
+	if f.db == nil || !f.SkipCataloged || buildID == "" {
+		return ""
+	}
+	path, err := f.db.Extracted(ctx, buildID)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to look up build ID in catalog", "build_id", buildID, "err", err)
+		return ""
+	}
+	return path
+}
+
+// newCatalogEntry returns the entry of the input and its output with their sizes and digests,
+// the output is left out if it is empty or stdout.
+func newCatalogEntry(buildID, input, output, status, errMsg string) catalog.Entry {
+	e := catalog.Entry{BuildID: buildID, InputPath: input, Status: status, Error: errMsg}
+	if input != stdio {
+		e.InputSize, e.InputSHA256 = fileSizeAndSHA256(input)
+	}
+	if output != "" && output != stdio {
+		e.OutputPath = output
+		e.OutputSize, e.OutputSHA256 = fileSizeAndSHA256(output)
+	}
+	return e
+}
+
+// fileSizeAndSHA256 returns the size and SHA-256 digest of the file at path, or zero values if it
+// cannot be read. The columns of the catalog are SHA-256 whatever --hash is.
+func fileSizeAndSHA256(path string) (int64, string) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, ""
+	}
+	sum, err := digest.File(digest.SHA256, path)
+	if err != nil {
+		return fi.Size(), ""
+	}
+	return fi.Size(), sum
+}
+
+// record records the entry in the catalog, failures are logged rather than failing the file.
+// Files interrupted by a shutdown are recorded as well.
+func (f *catalogFlags) record(logger log.Logger, e catalog.Entry) {
+	if f.db == nil {
+		return
+	}
+	if err := f.db.Record(context.Background(), e); err != nil {
+		level.Warn(logger).Log("msg", "failed to record file in catalog", "file", e.InputPath, "err", err)
+	}
+}
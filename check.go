@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+type checkCmd struct {
+	Path     string   `kong:"required,arg,name='path',help='File path to the stripped object file to check.',type:'path'"`
+	DebugDir []string `kong:"help='Global directories to search for debug files, like debug-file-directory of GDB.',default='/usr/lib/debug',type:'path'"`
+}
+
+// Run follows the .gnu_debuglink of the object file and verifies the CRC32 of the debug file,
+// GDB silently ignores debug files with a mismatching checksum.
+func (c *checkCmd) Run(logger log.Logger) error {
+	logger = log.With(logger, "file", c.Path)
+
+	f, err := elfutils.Open(c.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open given file: %w", err)
+	}
+	defer f.Close()
+
+	name, crc, err := elfutils.DebugLink(f)
+	if errors.Is(err, elfutils.ErrNoDebugLink) {
+		level.Info(logger).Log("msg", "no .gnu_debuglink section, nothing to check")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logger = log.With(logger, "debuglink", name, "crc", fmt.Sprintf("%08x", crc))
+
+	candidates, err := debugLinkCandidates(c.Path, name, c.DebugDir)
+	if err != nil {
+		return err
+	}
+	var mismatches int
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		got, err := elfutils.DebugLinkCRC(path)
+		if err != nil {
+			return fmt.Errorf("failed to compute CRC32 of %s: %w", path, err)
+		}
+		if got != crc {
+			mismatches++
+			level.Warn(logger).Log("msg", "CRC32 mismatch, GDB ignores this debug file", "debug_file", path, "got", fmt.Sprintf("%08x", got))
+			continue
+		}
+		level.Info(logger).Log("msg", "debug file matches the recorded CRC32", "debug_file", path)
+		return nil
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("no debug file named %s matches the recorded CRC32 %08x", name, crc)
+	}
+	return fmt.Errorf("debug file %s not found, searched: %s", name, strings.Join(candidates, ", "))
+}
+
+// debugLinkCandidates returns the paths GDB looks for the linked debug file at, in order:
+// next to the object file, in its .debug directory and under the global debug directories.
+func debugLinkCandidates(path, name string, debugDirs []string) ([]string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(abs)
+
+	candidates := []string{
+		filepath.Join(dir, name),
+		filepath.Join(dir, ".debug", name),
+	}
+	for _, d := range debugDirs {
+		candidates = append(candidates, filepath.Join(d, dir, name))
+	}
+	return candidates, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+// description summarizes the tool in the exported specs.
+const description = "Extract debug information from object files."
+
+type cliSpecCmd struct {
+	Format string `kong:"enum='json,man',default='json',help='Format of the specification, one of: json, man.'"`
+}
+
+// cliSpec is the machine-readable command line interface, wrapper scripts are validated against it.
+type cliSpec struct {
+	Name     string        `json:"name"`
+	Version  string        `json:"version"`
+	Help     string        `json:"help"`
+	Flags    []flagSpec    `json:"flags"`
+	Commands []commandSpec `json:"commands"`
+}
+
+type commandSpec struct {
+	Name      string        `json:"name"`
+	Path      string        `json:"path"`
+	Help      string        `json:"help"`
+	Default   bool          `json:"default,omitempty"`
+	Args      []argSpec     `json:"args,omitempty"`
+	Flags     []flagSpec    `json:"flags,omitempty"`
+	Commands  []commandSpec `json:"commands,omitempty"`
+	ArgsUsage string        `json:"usage"`
+}
+
+type argSpec struct {
+	Name       string `json:"name"`
+	Help       string `json:"help"`
+	Type       string `json:"type"`
+	Required   bool   `json:"required,omitempty"`
+	Repeatable bool   `json:"repeatable,omitempty"`
+}
+
+type flagSpec struct {
+	Name        string   `json:"name"`
+	Short       string   `json:"short,omitempty"`
+	Help        string   `json:"help"`
+	Type        string   `json:"type"`
+	Placeholder string   `json:"placeholder,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Env         string   `json:"env,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Repeatable  bool     `json:"repeatable,omitempty"`
+}
+
+// Run writes the specification of the command line interface, hidden commands and flags are left out.
+func (c *cliSpecCmd) Run(kctx *kong.Context) error {
+	spec := newCLISpec(kctx.Model)
+	if c.Format == "man" {
+		return writeManPage(os.Stdout, spec)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(spec)
+}
+
+func newCLISpec(app *kong.Application) cliSpec {
+	spec := cliSpec{
+		Name:    app.Name,
+		Version: newVersionInfo().Version,
+		Help:    description,
+		Flags:   newFlagSpecs(app.Flags),
+	}
+	for _, child := range app.Children {
+		if !child.Hidden {
+			spec.Commands = append(spec.Commands, newCommandSpec(child))
+		}
+	}
+	return spec
+}
+
+func newCommandSpec(n *kong.Node) commandSpec {
+	cmd := commandSpec{
+		Name:      n.Name,
+		Path:      n.Path(),
+		Help:      n.Help,
+		Default:   n.Parent != nil && n.Parent.DefaultCmd == n,
+		Flags:     newFlagSpecs(n.Flags),
+		ArgsUsage: n.Summary(),
+	}
+	for _, p := range n.Positional {
+		cmd.Args = append(cmd.Args, argSpec{
+			Name:       p.Name,
+			Help:       p.Help,
+			Type:       valueType(p),
+			Required:   p.Required,
+			Repeatable: p.IsCumulative(),
+		})
+	}
+	for _, child := range n.Children {
+		if !child.Hidden {
+			cmd.Commands = append(cmd.Commands, newCommandSpec(child))
+		}
+	}
+	return cmd
+}
+
+func newFlagSpecs(flags []*kong.Flag) []flagSpec {
+	var specs []flagSpec
+	for _, f := range flags {
+		if f.Hidden {
+			continue
+		}
+		spec := flagSpec{
+			Name:       f.Name,
+			Help:       f.Help,
+			Type:       valueType(f.Value),
+			Default:    f.Default,
+			Env:        f.Env,
+			Required:   f.Required,
+			Repeatable: f.IsCumulative(),
+		}
+		if f.Short != 0 {
+			spec.Short = string(f.Short)
+		}
+		if !f.IsBool() {
+			spec.Placeholder = f.FormatPlaceHolder()
+		}
+		if f.Enum != "" {
+			spec.Enum = f.EnumSlice()
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// valueType names the type of the value of a flag or argument.
+func valueType(v *kong.Value) string {
+	t := v.Target.Type()
+	prefix := ""
+	if t.Kind() == reflect.Slice {
+		prefix, t = "[]", t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(time.Duration(0)):
+		return prefix + "duration"
+	case reflect.TypeOf(byteSize(0)):
+		return prefix + "byte-size"
+	}
+	if v.Tag != nil && v.Tag.Type == "path" {
+		return prefix + "path"
+	}
+	return prefix + t.Kind().String()
+}
+
+// writeManPage writes the specification as a man page in the roff format of man(7).
+func writeManPage(w io.Writer, spec cliSpec) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %s 1 \"\" \"%s %s\" \"User Commands\"\n", strings.ToUpper(roff(spec.Name)), roff(spec.Name), roff(spec.Version))
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(&b, "%s \\- %s\n", roff(spec.Name), roff(spec.Help))
+	b.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B %s\n[\\fIflags\\fR] \\fIcommand\\fR [\\fIargs\\fR]\n", roff(spec.Name))
+	b.WriteString(".SH FLAGS\n")
+	writeManFlags(&b, spec.Flags)
+	b.WriteString(".SH COMMANDS\n")
+	var writeCommands func(cmds []commandSpec)
+	writeCommands = func(cmds []commandSpec) {
+		for _, cmd := range cmds {
+			fmt.Fprintf(&b, ".SS \"%s %s\"\n", roff(spec.Name), roff(cmd.ArgsUsage))
+			fmt.Fprintf(&b, "%s\n", roff(cmd.Help))
+			for _, a := range cmd.Args {
+				fmt.Fprintf(&b, ".TP\n\\fI<%s>\\fR\n%s\n", roff(a.Name), roff(a.Help))
+			}
+			writeManFlags(&b, cmd.Flags)
+			writeCommands(cmd.Commands)
+		}
+	}
+	writeCommands(spec.Commands)
+	b.WriteString(".SH EXIT STATUS\n")
+	for _, e := range []struct {
+		code int
+		help string
+	}{
+		{exitOK, "All files were processed successfully."},
+		{exitPartialFailure, "Some of the files failed to be processed."},
+		{exitFailure, "All files failed to be processed."},
+		{exitUsage, "Invalid usage, e.g. unknown flags."},
+		{exitNoDebugInfo, "No file failed, but some had no debug information."},
+	} {
+		fmt.Fprintf(&b, ".TP\n.B %d\n%s\n", e.code, roff(e.help))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeManFlags(b *strings.Builder, flags []flagSpec) {
+	for _, f := range flags {
+		b.WriteString(".TP\n")
+		if f.Short != "" {
+			fmt.Fprintf(b, "\\fB\\-%s\\fR, ", roff(f.Short))
+		}
+		fmt.Fprintf(b, "\\fB\\-\\-%s\\fR", roff(f.Name))
+		if f.Placeholder != "" {
+			fmt.Fprintf(b, "=\\fI%s\\fR", roff(f.Placeholder))
+		}
+		b.WriteString("\n")
+		help := f.Help
+		if f.Default != "" {
+			help += " Default: " + f.Default + "."
+		}
+		if f.Env != "" {
+			help += " Environment: " + f.Env + "."
+		}
+		fmt.Fprintf(b, "%s\n", roff(help))
+	}
+}
+
+// roff escapes text for roff, lines starting with a control character are protected.
+func roff(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/polarsignals/split-debug/pkg/compare"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+)
+
+type compareCmd struct {
+	A string `kong:"required,arg,name='a',help='File path to the first object or debug file.',type:'path'"`
+	B string `kong:"required,arg,name='b',help='File path to the second object or debug file.',type:'path'"`
+
+	DebugOnly bool `kong:"help='Only compare the sections that carry debug information, e.g. to compare a binary with its debug file.'"`
+}
+
+// Run reports the differences between two files and fails if there are any.
+func (c *compareCmd) Run() error {
+	a, err := elfutils.Open(c.A)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", c.A, err)
+	}
+	defer a.Close()
+	b, err := elfutils.Open(c.B)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", c.B, err)
+	}
+	defer b.Close()
+
+	diffs, err := compare.Files(a, b, c.DebugOnly)
+	if err != nil {
+		return fmt.Errorf("failed to compare %s and %s: %w", c.A, c.B, err)
+	}
+	for _, d := range diffs {
+		fmt.Fprintln(os.Stdout, d)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("found %d differences", len(diffs))
+	}
+	fmt.Fprintln(os.Stdout, "files are equivalent")
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"gopkg.in/yaml.v3"
+)
+
+// configLoader is a kong.ConfigurationLoader for YAML configuration files,
+// JSON files work as well since JSON is a subset of YAML. Keys are flag names,
+// the flags of a command can be nested under the name of the command:
+//
+//	log-level: debug
+//	extract:
+//	  symbolize-only: true
+//	  max-debug-size: 512MB
+//
+// Flags given on the command line take precedence over the configuration file.
+func configLoader(r io.Reader) (kong.Resolver, error) {
+	values := map[string]interface{}{}
+	if err := yaml.NewDecoder(r).Decode(&values); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	var resolver kong.ResolverFunc = func(_ *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) {
+		if parent.Command != nil {
+			if cmd, ok := values[parent.Command.Name].(map[string]interface{}); ok {
+				if v, ok := lookupFlag(cmd, flag.Name); ok {
+					return v, nil
+				}
+			}
+		}
+		if v, ok := lookupFlag(values, flag.Name); ok {
+			return v, nil
+		}
+		return nil, nil
+	}
+	return resolver, nil
+}
+
+// lookupFlag returns the configured value of the named flag in the format kong expects,
+// scalars as strings and lists as lists of strings. Underscores can be used in place of hyphens.
+func lookupFlag(values map[string]interface{}, name string) (interface{}, bool) {
+	v, ok := values[name]
+	if !ok {
+		v, ok = values[strings.ReplaceAll(name, "-", "_")]
+	}
+	if !ok || v == nil {
+		return nil, false
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return nil, false
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			list = append(list, fmt.Sprint(e))
+		}
+		return list, true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
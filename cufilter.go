@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/dwarfedit"
+)
+
+// cuFilter selects the DWARF compilation units to keep by their source paths.
+type cuFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newCUFilter compiles the patterns of --include-cu and --exclude-cu,
+// it returns nil if there are none.
+func newCUFilter(include, exclude []string) (*cuFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	f := &cuFilter{}
+	var err error
+	if f.include, err = compilePatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compilePatterns(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// compilePatterns translates glob patterns into regular expressions.
+// Unlike path.Match, * matches any sequence of characters including /,
+// so vendor/* matches all the files below vendor.
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		if p == "" {
+			return nil, errors.New("empty compilation unit pattern")
+		}
+		var expr strings.Builder
+		expr.WriteString("^")
+		for _, r := range p {
+			switch r {
+			case '*':
+				expr.WriteString(".*")
+			case '?':
+				expr.WriteString(".")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		expr.WriteString("$")
+		re, err := regexp.Compile(expr.String())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// keep reports whether the compilation unit is kept. Units without a name are always kept.
+func (f *cuFilter) keep(u dwarfedit.Unit) bool {
+	if u.Name == "" {
+		return true
+	}
+	paths := unitPaths(u)
+	if len(f.include) > 0 && !matchAny(f.include, paths) {
+		return false
+	}
+	return !matchAny(f.exclude, paths)
+}
+
+// unitPaths returns the paths patterns are matched against: the name of the unit,
+// its path joined with the compilation directory and their trailing parts,
+// so relative patterns match anywhere in the path.
+func unitPaths(u dwarfedit.Unit) []string {
+	full := u.Name
+	if !path.IsAbs(full) && u.CompDir != "" {
+		full = path.Join(u.CompDir, full)
+	}
+	paths := []string{u.Name}
+	for p := full; p != ""; {
+		paths = append(paths, p)
+		i := strings.IndexByte(p, '/')
+		if i < 0 {
+			break
+		}
+		p = p[i+1:]
+	}
+	return paths
+}
+
+func matchAny(patterns []*regexp.Regexp, paths []string) bool {
+	for _, re := range patterns {
+		for _, p := range paths {
+			if re.MatchString(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// dryRun prints the estimated size of the debug information file of each input to w instead of
+// extracting it.
+func (c *extractCmd) dryRun(logger log.Logger, w io.Writer) error {
+	opts := pipeline.EstimateOptions{Filters: c.filters(), Compression: c.compression()}
+
+	var failed int
+	for _, path := range c.Paths {
+		report, err := c.estimate(path, opts)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to estimate the size of the debug information", "file", path, "err", err)
+			failed++
+			continue
+		}
+		if opts.Compression == "" {
+			fmt.Fprintf(w, "%s: %s estimated\n", path, byteSize(report.Size))
+		} else {
+			fmt.Fprintf(w, "%s: %s estimated, %s with %s\n", path, byteSize(report.Size), byteSize(report.Compressed), opts.Compression)
+		}
+		for _, s := range report.Sections {
+			fmt.Fprintf(w, "  %-20s %10s\n", s.Name, byteSize(s.Compressed))
+		}
+	}
+
+	if failed == 0 {
+		return nil
+	}
+	code := exitPartialFailure
+	if failed == len(c.Paths) {
+		code = exitFailure
+	}
+	return &exitError{
+		code: code,
+		err:  fmt.Errorf("failed to estimate the size of the debug information of %d of %d files", failed, len(c.Paths)),
+	}
+}
+
+func (c *extractCmd) estimate(path string, opts pipeline.EstimateOptions) (pipeline.SizeReport, error) {
+	f, err := elfutils.OpenWithLimits(path, c.limits())
+	if err != nil {
+		return pipeline.SizeReport{}, err
+	}
+	defer f.Close()
+	if err := elfutils.CheckDebugInfo(f); err != nil && !c.AllowEmpty {
+		return pipeline.SizeReport{}, err
+	}
+	return pipeline.Estimate(f, opts)
+}
+
+// compression returns the compression of the output by --encoding or --pack, empty without.
+func (c *extractCmd) compression() string {
+	switch {
+	case c.Encoding == encodingZstdSeekable, c.Pack == packTarZst:
+		return "zstd"
+	case c.Pack == packTarXz:
+		return "xz"
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/dwarfedit"
+)
+
+// parsePrefixMaps parses the OLD=NEW values of --prefix-map.
+func parsePrefixMaps(values []string) ([]dwarfedit.PrefixMap, error) {
+	maps := make([]dwarfedit.PrefixMap, 0, len(values))
+	for _, v := range values {
+		i := strings.IndexByte(v, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid prefix map %q, expected OLD=NEW", v)
+		}
+		maps = append(maps, dwarfedit.PrefixMap{Old: v[:i], New: v[i+1:]})
+	}
+	return maps, nil
+}
+
+// Modes of --redact-mode.
+const (
+	redactHash  = "hash"
+	redactStrip = "strip"
+)
+
+// newRedaction returns the redaction of the names that match the patterns of --redact-symbols,
+// or nil if there are none. Hashed names are the same in the symbol table and the DWARF, so
+// consumers can still tell them apart and correlate them.
+func newRedaction(patterns []string, mode string) (dwarfedit.Redaction, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	res, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return func(name string) (string, bool) {
+		if !matchAny(res, []string{name}) {
+			return "", false
+		}
+		if mode == redactStrip {
+			return "", true
+		}
+		sum := sha256.Sum256([]byte(name))
+		return "_" + hex.EncodeToString(sum[:8]), true
+	}, nil
+}
+
+// hasDWARFEdits reports whether any of the flags rewrite the DWARF.
+func (c *extractCmd) hasDWARFEdits() bool {
+	return c.cuFilter != nil || len(c.prefixMaps) > 0 || c.StripMacros || c.redaction != nil
+}
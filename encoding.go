@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io"
+
+	"github.com/polarsignals/split-debug/pkg/zstdseek"
+)
+
+// Encodings of the debug information file.
+const (
+	encodingNone = "none"
+	// encodingZstdSeekable compresses the debug file in the zstd seekable format, so symbol
+	// servers read its sections at random without decompressing the whole file.
+	encodingZstdSeekable = "zstd-seekable"
+)
+
+// encodeFile replaces the file at path with its contents in the seekable zstd format.
+func encodeFile(path string) error {
+	return rewriteFile(path, func(dst io.Writer, src io.Reader) error {
+		w, err := zstdseek.NewWriter(dst)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, src); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/encryption"
+)
+
+// encryptionScheme is the scheme of --encrypt, the key of age recipients would need another one.
+const encryptionScheme = "aes256-gcm"
+
+// parseEncryption parses the SCHEME:KEY-FILE value of --encrypt and returns the key.
+func parseEncryption(s string) ([]byte, error) {
+	scheme, keyFile := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		scheme, keyFile = s[:i], s[i+1:]
+	}
+	if scheme != encryptionScheme {
+		return nil, fmt.Errorf("unsupported encryption %q, must be %s:KEY-FILE", scheme, encryptionScheme)
+	}
+	if keyFile == "" {
+		return nil, fmt.Errorf("missing key file, must be %s:KEY-FILE", encryptionScheme)
+	}
+	return readKeyFile(keyFile)
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return encryption.ParseKey(data)
+}
+
+// encryptFile replaces the file at path with its encrypted contents.
+func encryptFile(path string, key []byte) error {
+	return rewriteFile(path, func(dst io.Writer, src io.Reader) error {
+		w, err := encryption.NewWriter(dst, key)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, src); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// rewriteFile writes the transformed contents of the file at path to a staging file next to it,
+// and renames it over the file.
+func rewriteFile(path string, fn func(dst io.Writer, src io.Reader) error) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*"+partialSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+	if err := fn(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Chmod(0o644); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Rename(dst.Name(), path)
+}
+
+type decryptCmd struct {
+	Path    string `kong:"required,arg,name='path',help='File path to the encrypted debug file. Use - to read from stdin.',type:'path'"`
+	KeyFile string `kong:"required,help='File with the hex encoded 256-bit key the debug file was encrypted with.',type:'path'"`
+	Output  string `kong:"short='o',help='Output file path. Defaults to stdout.',type:'path'"`
+}
+
+// Run decrypts a debug file written with --encrypt.
+func (c *decryptCmd) Run() error {
+	key, err := readKeyFile(c.KeyFile)
+	if err != nil {
+		return usageError(err)
+	}
+
+	in := os.Stdin
+	if c.Path != stdio {
+		f, err := os.Open(c.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open given file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	r, err := encryption.NewReader(in, key)
+	if err != nil {
+		return err
+	}
+
+	if c.Output == "" || c.Output == stdio {
+		if _, err := io.Copy(os.Stdout, r); err != nil {
+			return fmt.Errorf("failed to decrypt: %w", err)
+		}
+		return nil
+	}
+	out, err := ioutil.TempFile(filepath.Dir(c.Output), "."+filepath.Base(c.Output)+".*"+partialSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+	if err := out.Chmod(0o644); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), c.Output)
+}
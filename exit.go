@@ -0,0 +1,44 @@
+package main
+
+import "errors"
+
+// Exit codes of the process, scripts and CI pipelines rely on them.
+const (
+	exitOK = iota
+	exitPartialFailure
+	exitFailure
+	exitUsage
+	// exitNoDebugInfo is returned when no file failed, but some had no debug information to extract.
+	exitNoDebugInfo
+)
+
+// exitError is an error that determines the exit code of the process.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func usageError(err error) error {
+	return &exitError{code: exitUsage, err: err}
+}
+
+// exitCode returns the exit code for the given error.
+// Errors that do not carry an exit code are failures.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitFailure
+}
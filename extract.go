@@ -0,0 +1,773 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/distpkg"
+	"github.com/polarsignals/split-debug/pkg/dwarfedit"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter"
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+	"github.com/polarsignals/split-debug/pkg/policy"
+	"github.com/polarsignals/split-debug/pkg/tracing"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// stdio is the path that stands for stdin as input and stdout as output.
+const stdio = "-"
+
+// Placements of the compact unwind table of --unwind-table.
+const (
+	unwindNone    = "none"
+	unwindSection = "section"
+	unwindSidecar = "sidecar"
+)
+
+type extractCmd struct {
+	Paths          []string `kong:"required,arg,name='path',help='File paths to the object files to extract debug information from. Use - to read from stdin. Directories are walked recursively, hard links and copies with the build ID of a processed file are skipped. Archives (.tar, .tar.gz, .tgz, .tar.zst, .tar.xz, .zip) and packages (.deb, .rpm) produce a debug archive of their ELF files.',type:'path'"`
+	Output         string   `kong:"short='o',help='Output file path, only valid with a single input. Use - to write to stdout. Defaults to stdout when reading from stdin, otherwise to a temporary file next to the input.',type:'path'"`
+	OutputTemplate string   `kong:"placeholder='TEMPLATE',help='Template of the output file paths, in place of the temporary file names, e.g. {dir}/{name}-{buildid:.8}.debug. The fields are dir and name, the directory and base name of the input, buildid, arch and hash, the digest of the input. {field:.N} keeps the first N characters of the value. Missing directories are created. Not valid with archive or package inputs.'"`
+	Sparse         bool     `kong:"help='Leave holes in the debug information file for runs of zeros, e.g. the padding of sections with large alignments, so they take no disk space on filesystems with sparse files.'"`
+
+	SymbolizeOnly bool     `kong:"help='Only keep the DWARF sections needed to map addresses to functions, files and lines.'"`
+	Preset        string   `kong:"enum='full,gdb,minimal,rust',default='full',help='Retention of auxiliary DWARF sections, one of: full keeps all of them, gdb drops the name lookup tables (.debug_pubnames, .debug_pubtypes) that modern consumers ignore, minimal also drops the GDB pretty printer scripts (.debug_gdb_scripts), rust drops the name lookup tables but .debug_pubtypes, which rust-gdb and rust-lldb use along with the pretty printer scripts.'"`
+	MaxDebugSize  byteSize `kong:"help='Maximum size of the debug information file, e.g. 512MB. Auxiliary debug sections are dropped to stay within the budget.'"`
+	Pack          string   `kong:"enum='none,tar.zst,tar.xz',default='none',help='Pack the debug information file and its metadata into a compressed archive, one of: none, tar.zst, tar.xz.'"`
+	Encoding      string   `kong:"enum='none,zstd-seekable',default='none',help='Encoding of the debug information file, one of: none, zstd-seekable compresses it in 1MiB frames with a seek table, so symbol servers read sections at random without decompressing the whole file. Any zstd decoder decompresses it.'"`
+	SplitSections string   `kong:"placeholder='DIR',help='Store each section of the debug information file as a blob named by the SHA-256 digest of its contents in DIR, as sha256/<digest>, and write a manifest of the sections as the output instead, e.g. to share identical .debug_str sections between binaries. The assemble command rebuilds the debug file.',type:'path'"`
+	GDBIndex      bool     `kong:"name='gdb-index',help='Add a .gdb_index section, like gdb-add-index does, so GDB starts faster with large debug information.'"`
+	UnwindTable   string   `kong:"enum='none,section,sidecar',default='none',help='Build a compact unwind table from the call frame information of .eh_frame, so profilers walk the stacks of code built without frame pointers without DWARF, one of: none, section adds it as a .unwind_table section, sidecar writes it next to the output as <output>.unwind. The format is documented in pkg/unwind.'"`
+	IncludeCU     []string `kong:"name='include-cu',help='Only keep the DWARF compilation units whose source path matches one of the patterns, e.g. internal/*. * matches any characters including /.'"`
+	ExcludeCU     []string `kong:"name='exclude-cu',help='Drop the DWARF compilation units whose source path matches one of the patterns, e.g. vendor/*, along with their line programs.'"`
+	KeepCTFBTF    bool     `kong:"name='keep-ctf-btf',help='Also keep the CTF (.ctf, .SUNW_ctf) and BTF (.BTF, .BTF.ext) type information, which lightweight debuggers and BPF tooling use instead of DWARF.'"`
+	StripMacros   bool     `kong:"help='Drop the macro information (.debug_macro, .debug_macinfo), often the largest DWARF sections, and clear the references of the compilation units to it.'"`
+	PrefixMap     []string `kong:"sep='none',placeholder='OLD=NEW',help='Replace the OLD prefix of the source paths in the DWARF with NEW, e.g. /build/src=/workspace. Can be repeated, the longest matching prefix is replaced.'"`
+	RedactSymbols []string `kong:"placeholder='PATTERN',help='Redact the names of the symbols and the DWARF names of functions, variables and types that match one of the patterns, e.g. *mycorp*internal*, keeping their addresses. Symbols are matched by their mangled names. * matches any characters.'"`
+	RedactMode    string   `kong:"enum='hash,strip',default='hash',help='Replacement of redacted names, one of: hash replaces them with a hash of the name, strip with an empty name.'"`
+	EmitMetadata  bool     `kong:"help='Write a JSON metadata sidecar with build IDs, architecture, kept sections and their hashes next to each output, as <output>.json.'"`
+	Sign          bool     `kong:"help='Sign the metadata sidecar with cosign and write the Sigstore bundle to <output>.json.sigstore.json. Signing is keyless with the OIDC identity of the environment, e.g. the CI job, unless --sign-key is given. Requires --emit-metadata.'"`
+	SignKey       string   `kong:"help='Sign with this cosign key instead, a file path or a KMS URI, e.g. awskms:///alias/split-debug.'"`
+	Encrypt       string   `kong:"placeholder='aes256-gcm:KEY-FILE',help='Encrypt the debug information file, or its archive, with AES-256-GCM and the hex encoded 256-bit key in KEY-FILE, e.g. generated with openssl rand -hex 32. The metadata sidecar is not encrypted. Decrypt it with the decrypt command.'"`
+
+	DebuginfoPackage bool `kong:"help='Write the debug information of .deb and .rpm inputs as a debug information package of the distribution instead, e.g. app-dbgsym_1.0-1_amd64.deb or app-debuginfo-1.0-1.x86_64.rpm, with the debug files under /usr/lib/debug/.build-id.'"`
+
+	MaxInputSize   byteSize `kong:"help='Maximum size of an input file, e.g. 2GB. Larger files fail to be processed.'"`
+	MaxSections    int      `kong:"help='Maximum number of sections of an input file.'"`
+	MaxSectionSize byteSize `kong:"help='Maximum size of a single section after decompression, e.g. 1GB.'"`
+	MinFreeSpace   byteSize `kong:"help='Space to keep free in the filesystem of the output, e.g. 1GB. Extractions that would leave less, by the estimated size of their output, fail before writing it.'"`
+
+	DryRun      bool          `kong:"help='Print the estimated size of the debug information file of each input and of its sections, after the compression of --encoding or --pack, instead of extracting it. DWARF edits, --max-debug-size, --gdb-index and --unwind-table are not accounted for.'"`
+	SummaryFile string        `kong:"help='Write a JSON summary with the status of each file to the given path.',type:'path'"`
+	Progress    bool          `kong:"help='Render a progress bar of each file to stderr.'"`
+	Timeout     time.Duration `kong:"help='Maximum duration of the extraction of a single file, e.g. 30s. Unlimited by default.'"`
+	KeepPartial bool          `kong:"help='Keep the partially written output of failed extractions for debugging.'"`
+	AllowEmpty  bool          `kong:"help='Write the debug information file of inputs without DWARF or symbol tables, e.g. already stripped binaries, instead of reporting them with exit code 4.'"`
+
+	FollowSymlinks bool `kong:"help='Follow symbolic links when walking directories, links that form cycles are skipped.'"`
+	Fadvise        bool `kong:"help='Advise the kernel to read the inputs sequentially and to drop them from the page cache once processed, so scanning many files, e.g. all of /usr, does not evict the page cache of other workloads. Only on Linux.'"`
+
+	catalogFlags
+	hashFlags
+	overwriteFlags
+	ownershipFlags
+	auditFlags
+	policyFlags
+
+	cuFilter       *cuFilter
+	prefixMaps     []dwarfedit.PrefixMap
+	redaction      dwarfedit.Redaction
+	policy         policy.Rules
+	signer         *signer
+	encryptionKey  []byte
+	outputTemplate *outputTemplate
+	// outputs maps the output paths of the template to the inputs they were written for.
+	outputs map[string]string
+}
+
+func (c *extractCmd) Run(ctx context.Context, logger log.Logger, tracer trace.Tracer, sd shutdown) error {
+	c.Paths = newWalker(logger, c.FollowSymlinks).expand(c.Paths)
+	if len(c.Paths) > 1 && c.Output != "" {
+		return usageError(errors.New("--output can only be used with a single path"))
+	}
+	if err := c.validateOverwrite(); err != nil {
+		return err
+	}
+	if err := c.parseOwnership(); err != nil {
+		return err
+	}
+	if c.OutputTemplate != "" {
+		if c.Output != "" {
+			return usageError(errors.New("--output cannot be used with --output-template"))
+		}
+		t, err := parseOutputTemplate(c.OutputTemplate)
+		if err != nil {
+			return usageError(err)
+		}
+		c.outputTemplate = t
+		c.outputs = make(map[string]string)
+	}
+	for _, path := range c.Paths {
+		if c.EmitMetadata && c.toStdout(path) {
+			return usageError(errors.New("--emit-metadata cannot be used when writing to stdout"))
+		}
+		if _, _, ok := distpkg.Detect(path); ok && c.DebuginfoPackage && c.EmitMetadata {
+			return usageError(errors.New("--emit-metadata cannot be used with --debuginfo-package"))
+		}
+		if isBundle(path) && c.Pack != packNone {
+			return usageError(errors.New("--pack cannot be used with archive or package inputs"))
+		}
+		if isBundle(path) && c.Encoding != encodingNone {
+			return usageError(errors.New("--encoding cannot be used with archive or package inputs"))
+		}
+		if isBundle(path) && c.SplitSections != "" {
+			return usageError(errors.New("--split-sections cannot be used with archive or package inputs"))
+		}
+		if (isBundle(path) || c.toStdout(path)) && c.UnwindTable == unwindSidecar {
+			return usageError(errors.New("--unwind-table=sidecar cannot be used with archive or package inputs, nor when writing to stdout"))
+		}
+		if isBundle(path) && c.OutputTemplate != "" {
+			return usageError(errors.New("--output-template cannot be used with archive or package inputs"))
+		}
+		if isBundle(path) && c.Sign {
+			return usageError(errors.New("--sign cannot be used with archive or package inputs"))
+		}
+		if isBundle(path) && c.Encrypt != "" {
+			return usageError(errors.New("--encrypt cannot be used with archive or package inputs"))
+		}
+		if (isBundle(path) || path == stdio) && c.DryRun {
+			return usageError(errors.New("--dry-run cannot be used with stdin, archive or package inputs"))
+		}
+	}
+	if c.Pack != packNone && c.Encoding != encodingNone {
+		return usageError(errors.New("--encoding cannot be used with --pack, the archive is compressed"))
+	}
+	if c.SplitSections != "" && (c.Pack != packNone || c.Encoding != encodingNone || c.Encrypt != "") {
+		return usageError(errors.New("--split-sections cannot be used with --pack, --encoding or --encrypt"))
+	}
+	if c.Encrypt != "" {
+		key, err := parseEncryption(c.Encrypt)
+		if err != nil {
+			return usageError(err)
+		}
+		c.encryptionKey = key
+	}
+	if c.Sign {
+		if !c.EmitMetadata {
+			return usageError(errors.New("--sign requires --emit-metadata"))
+		}
+		s, err := newSigner(c.SignKey)
+		if err != nil {
+			return usageError(err)
+		}
+		c.signer = s
+	}
+
+	filter, err := newCUFilter(c.IncludeCU, c.ExcludeCU)
+	if err != nil {
+		return usageError(err)
+	}
+	c.cuFilter = filter
+	if c.prefixMaps, err = parsePrefixMaps(c.PrefixMap); err != nil {
+		return usageError(err)
+	}
+	if c.redaction, err = newRedaction(c.RedactSymbols, c.RedactMode); err != nil {
+		return usageError(err)
+	}
+	if c.policy, err = c.policyRules(); err != nil {
+		return err
+	}
+	if c.DryRun {
+		return c.dryRun(logger, os.Stdout)
+	}
+	if err := c.openCatalog(); err != nil {
+		return err
+	}
+	defer c.closeCatalog()
+	if err := c.openAudit("extract"); err != nil {
+		return err
+	}
+	defer c.closeAudit()
+
+	var sum summary
+	// processed maps the build IDs of the batch to the first file they were found in.
+	processed := map[string]string{}
+	for i, path := range c.Paths {
+		// The files left after a shutdown request fail without being opened, the summary lists them.
+		if sd.requested() {
+			sum.add(fileResult{Path: path, Status: statusFailed, Error: errShutdown.Error()})
+			continue
+		}
+		if isBundle(path) {
+			c.extractBundle(ctx, logger, tracer, path, &sum)
+			continue
+		}
+		res := fileResult{Path: path, Status: statusOK}
+		if c.skip(logger, path) {
+			res.Status = statusSkipped
+			sum.add(res)
+			continue
+		}
+		if first := c.duplicate(logger, path, processed); first != "" {
+			res.Status = statusSkipped
+			res.DuplicateOf = first
+			sum.add(res)
+			continue
+		}
+		if first := c.cataloged(ctx, logger, c.catalogBuildID(path)); first != "" {
+			level.Debug(logger).Log("msg", "skipping file with the build ID of a cataloged file", "file", path, "cataloged", first)
+			res.Status = statusSkipped
+			res.Cataloged = first
+			sum.add(res)
+			continue
+		}
+
+		var progress *progressBar
+		if c.Progress {
+			label := path
+			if len(c.Paths) > 1 {
+				label = fmt.Sprintf("[%d/%d] %s", i+1, len(c.Paths), path)
+			}
+			progress = newProgressBar(os.Stderr, label)
+		}
+
+		if err := c.extractFile(ctx, logger, tracer, progress, &res); err != nil {
+			res.fail(err)
+		}
+		c.record(logger, newCatalogEntry(res.BuildID, path, res.Output, string(res.Status), res.Error))
+		c.auditOutput(logger, res)
+		sum.add(res)
+	}
+
+	if c.SummaryFile != "" {
+		if err := sum.writeFile(c.SummaryFile); err != nil {
+			return fmt.Errorf("failed to write summary: %w", err)
+		}
+	}
+	if err := c.auditFailed(); err != nil {
+		return err
+	}
+
+	if sum.Failed == 0 && sum.NoDebugInfo == 0 {
+		return nil
+	}
+	if sum.Failed == 0 {
+		return &exitError{
+			code: exitNoDebugInfo,
+			err:  fmt.Errorf("no debug information in %d of %d files, use --allow-empty to extract them anyway", sum.NoDebugInfo, sum.Total),
+		}
+	}
+	failed := sum.Failed + sum.NoDebugInfo
+	code := exitPartialFailure
+	if failed == sum.Total-sum.Skipped {
+		code = exitFailure
+	}
+	return &exitError{
+		code: code,
+		err:  fmt.Errorf("failed to extract debug information from %d of %d files", failed, sum.Total),
+	}
+}
+
+// skip reports whether the input is skipped, batches of several inputs skip the files that are not
+// ELF files, e.g. scripts or images, rather than failing them. Unreadable inputs fail on extraction.
+func (c *extractCmd) skip(logger log.Logger, path string) bool {
+	if len(c.Paths) < 2 || path == stdio {
+		return false
+	}
+	isELF, err := elfutils.IsELF(path)
+	if err != nil || isELF {
+		return false
+	}
+	level.Debug(logger).Log("msg", "skipping file that is not an ELF file", "file", path)
+	return true
+}
+
+// duplicate returns the file of the batch that was processed with the same build ID as the input,
+// e.g. a copy of a binary in a build tree, or an empty string if there is none.
+func (c *extractCmd) duplicate(logger log.Logger, path string, processed map[string]string) string {
+	if len(c.Paths) < 2 || path == stdio {
+		return ""
+	}
+	id, err := readBuildID(path)
+	if err != nil {
+		return ""
+	}
+	if first, ok := processed[id]; ok {
+		level.Debug(logger).Log("msg", "skipping file with the build ID of a processed file", "file", path, "build_id", id, "duplicate_of", first)
+		return first
+	}
+	processed[id] = path
+	return ""
+}
+
+// catalogBuildID returns the build ID of the input to look up in the catalog, or an empty string
+// if the catalog is not consulted.
+func (c *extractCmd) catalogBuildID(path string) string {
+	if c.db == nil || !c.SkipCataloged || path == stdio {
+		return ""
+	}
+	id, err := readBuildID(path)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// extractFile extracts the debug information of a single file and logs the outcome.
+func (c *extractCmd) extractFile(ctx context.Context, logger log.Logger, tracer trace.Tracer, progress *progressBar, res *fileResult) (err error) {
+	path := res.Path
+	ctx, span := tracer.Start(ctx, "extract", trace.WithAttributes(attribute.String("path", path)))
+	defer func() { tracing.EndSpan(span, err) }()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	job := newJob(logger, path)
+	logger = job.Logger
+	defer func() {
+		res.BuildID = job.BuildID
+		res.Dropped = job.Dropped
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to extract debug information", "err", err)
+		}
+	}()
+
+	// Files left after the drain timeout fail without being opened.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if path == stdio {
+		job.Stage = "buffer"
+		// ELF processing needs random access, so the stream is spilled to disk first.
+		_, span := tracer.Start(ctx, "buffer-stdin")
+		spill, err := spillToTempFile(iohelper.ContextReader(ctx, os.Stdin), int64(c.MaxInputSize), progress)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("failed to buffer stdin: %w", err)
+		}
+		defer os.Remove(spill)
+		level.Debug(logger).Log("msg", "buffered stdin", "spill", spill)
+		job.Input = spill
+	}
+
+	job.Stage = "create"
+	input := job.Input
+	if input == "" {
+		input = path
+	}
+	output, dest, err := c.createOutput(logger, path, input)
+	if errors.Is(err, errSkipExisting) {
+		res.Status = statusSkipped
+		res.Output = dest
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		// The writer closes the output, closing it again is harmless.
+		output.Close()
+		if err == nil {
+			return
+		}
+		if c.KeepPartial {
+			level.Warn(logger).Log("msg", "kept partial output", "partial", output.Name())
+			return
+		}
+		os.Remove(output.Name())
+	}()
+
+	debugFile := output
+	if c.Pack != packNone {
+		// The archive needs the size of the debug information file upfront, so it is staged first.
+		debugFile, err = ioutil.TempFile("", "split-debug-*.debuginfo")
+		if err != nil {
+			output.Close()
+			return fmt.Errorf("failed to create staging file: %w", err)
+		}
+		defer os.Remove(debugFile.Name())
+	}
+
+	meta, err := c.extract(ctx, tracer, job, progress, debugFile)
+	if err != nil {
+		return err
+	}
+
+	if c.Pack != packNone {
+		job.Stage = "pack"
+		if err := c.packOutput(ctx, tracer, path, debugFile.Name(), output, meta); err != nil {
+			return fmt.Errorf("failed to pack debug information: %w", err)
+		}
+	}
+
+	if c.SplitSections != "" {
+		job.Stage = "split"
+		_, span := tracer.Start(ctx, "split-sections")
+		err := splitSections(output.Name(), c.SplitSections, job.BuildID)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("failed to split sections: %w", err)
+		}
+	}
+
+	if c.Encoding == encodingZstdSeekable {
+		job.Stage = "encode"
+		_, span := tracer.Start(ctx, "encode")
+		err := encodeFile(output.Name())
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("failed to encode debug information: %w", err)
+		}
+		if meta != nil {
+			meta.Encoding = c.Encoding
+		}
+	}
+
+	if c.encryptionKey != nil {
+		job.Stage = "encrypt"
+		_, span := tracer.Start(ctx, "encrypt")
+		err := encryptFile(output.Name(), c.encryptionKey)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt debug information: %w", err)
+		}
+	}
+
+	// sidecars are the files written next to the output.
+	var sidecars []string
+	if c.UnwindTable == unwindSidecar && job.UnwindTable != nil {
+		if err := writeFileAtomic(dest+".unwind", job.UnwindTable); err != nil {
+			return fmt.Errorf("failed to write unwind table: %w", err)
+		}
+		sidecars = append(sidecars, dest+".unwind")
+	}
+	if c.EmitMetadata {
+		if c.Pack == packNone {
+			meta.DebugFile = filepath.Base(dest)
+		}
+		// The sidecar is in place before the output it describes.
+		if err := meta.writeFile(dest + ".json"); err != nil {
+			return fmt.Errorf("failed to write metadata: %w", err)
+		}
+		sidecars = append(sidecars, dest+".json")
+	}
+	if c.signer != nil {
+		job.Stage = "sign"
+		_, span := tracer.Start(ctx, "sign")
+		bundle, err := c.signer.sign(ctx, dest+".json")
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("failed to sign metadata: %w", err)
+		}
+		level.Debug(logger).Log("msg", "signed metadata", "bundle", bundle)
+		sidecars = append(sidecars, bundle)
+	}
+
+	if c.toStdout(path) {
+		job.Stage = "copy"
+		defer os.Remove(output.Name())
+		_, span := tracer.Start(ctx, "copy-to-stdout")
+		err := copyToStdout(ctx, output.Name())
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("failed to write to stdout: %w", err)
+		}
+		res.Output = stdio
+		return nil
+	}
+	job.Stage = "rename"
+	for _, name := range append(sidecars, output.Name()) {
+		if err := c.setOwnership(name); err != nil {
+			return fmt.Errorf("failed to set ownership: %w", err)
+		}
+	}
+	if err := os.Rename(output.Name(), dest); err != nil {
+		return fmt.Errorf("failed to move output into place: %w", err)
+	}
+	res.Output = dest
+	job.Stage = "done"
+	level.Info(logger).Log("msg", "debug information extracted", "output", dest)
+	return nil
+}
+
+// newJob returns the job of the input at path, its state is attached to the log lines of its logger.
+func newJob(logger log.Logger, path string) *pipeline.Job {
+	job := &pipeline.Job{Path: path}
+	job.Logger = log.With(logger,
+		"file", path,
+		"build_id", log.Valuer(func() interface{} { return job.BuildID }),
+		"phase", log.Valuer(func() interface{} { return job.Stage }),
+	)
+	return job
+}
+
+// toStdout reports whether the debug information of the given input goes to stdout.
+func (c *extractCmd) toStdout(path string) bool {
+	return c.Output == stdio || (c.Output == "" && c.OutputTemplate == "" && path == stdio)
+}
+
+// partialSuffix marks outputs that are still being written.
+const partialSuffix = ".partial"
+
+// createOutput creates the staging file the debug information, or its archive, is written to
+// and returns it with the destination it is renamed to once complete, so readers never observe
+// partially written files. The staging file is next to the destination, so the rename is atomic.
+// The writer needs to seek, so stdout is staged through a temporary file as well,
+// its destination is empty. The object file is read from input, which differs from path for stdin.
+// Existing destinations are handled by the overwrite policy, skipped inputs return errSkipExisting
+// with their destination.
+func (c *extractCmd) createOutput(logger log.Logger, path, input string) (*os.File, string, error) {
+	ext := ""
+	if c.Pack != packNone {
+		ext = "." + c.Pack
+	}
+	if c.Encoding == encodingZstdSeekable {
+		ext = ".zst"
+	}
+	if c.SplitSections != "" {
+		ext = manifestExt
+	}
+	switch {
+	case c.toStdout(path):
+		f, err := ioutil.TempFile("", "split-debug-*.debuginfo"+ext)
+		return f, "", err
+	case c.Output != "" || c.outputTemplate != nil:
+		dest := c.Output
+		if c.outputTemplate != nil {
+			var err error
+			if dest, err = c.templateOutput(path, input); err != nil {
+				return nil, "", err
+			}
+			// Inputs of the batch with the same name and build ID would overwrite each other.
+			if first, ok := c.outputs[dest]; ok {
+				return nil, "", fmt.Errorf("output %s of the template is the one of %s", dest, first)
+			}
+			if filepath.Clean(dest) == filepath.Clean(path) {
+				return nil, "", fmt.Errorf("output %s of the template is the input", dest)
+			}
+			c.outputs[dest] = path
+			if err := c.mkdirAll(filepath.Dir(dest)); err != nil {
+				return nil, "", err
+			}
+		}
+		if err := c.checkOverwrite(logger, input, dest); err != nil {
+			return nil, dest, err
+		}
+		f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".*"+partialSuffix)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := f.Chmod(0o644); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, "", err
+		}
+		return f, dest, nil
+	default:
+		// The destination takes the unique name of the staging file.
+		f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-debuginfo.*"+ext+partialSuffix)
+		if err != nil {
+			return nil, "", err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f.Name()), "."), partialSuffix)
+		return f, filepath.Join(filepath.Dir(path), name), nil
+	}
+}
+
+// packOutput packs the staged debug information file and its metadata into the output archive.
+func (c *extractCmd) packOutput(ctx context.Context, tracer trace.Tracer, path, debugFile string, output *os.File, meta *metadata) (err error) {
+	_, span := tracer.Start(ctx, "pack", trace.WithAttributes(attribute.String("format", c.Pack)))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	name := "stdin.debug"
+	if path != stdio {
+		name = filepath.Base(path) + ".debug"
+	}
+	meta.DebugFile = name
+	if err := pack(output, c.Pack, name, debugFile, meta); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
+// extract writes the debug information of the object file of the job to output.
+// The metadata is only collected if it is needed.
+func (c *extractCmd) extract(ctx context.Context, tracer trace.Tracer, job *pipeline.Job, progress *progressBar, output *os.File) (*metadata, error) {
+	defer job.Close()
+
+	job.Output = output.Name()
+	out := newProgressFile(output, progress)
+	var d *digests
+	if c.EmitMetadata || c.Pack != packNone {
+		d = newDigests(c.hash())
+	}
+	if err := c.newPipeline(tracer, progress, out, d).Run(ctx, job, out); err != nil {
+		var (
+			budgetErr *pipeline.BudgetError
+			spaceErr  *pipeline.SpaceError
+		)
+		if errors.As(err, &budgetErr) {
+			return nil, fmt.Errorf("symbols only debug information of %s exceeds the size budget of %s", byteSize(budgetErr.Size), byteSize(budgetErr.Budget))
+		}
+		if errors.As(err, &spaceErr) {
+			return nil, fmt.Errorf("not enough space in %s: %s free, %s needed including --min-free-space", spaceErr.Dir, byteSize(spaceErr.Free), byteSize(spaceErr.Needed))
+		}
+		return nil, err
+	}
+
+	if d == nil {
+		return nil, nil
+	}
+	job.Stage = "metadata"
+	_, span := tracer.Start(ctx, "metadata")
+	meta := newMetadata(job.Path, job.File, job.Sections, d)
+	meta.DroppedSections = job.Dropped
+	span.End()
+	return meta, nil
+}
+
+// newPipeline composes the stages of the extraction from the flags. The digests of the metadata
+// are computed while the extraction reads and writes the files, if d is not nil.
+func (c *extractCmd) newPipeline(tracer trace.Tracer, progress *progressBar, out *progressFile, d *digests) *pipeline.Pipeline {
+	transformers := []pipeline.Transformer{pipeline.LinkedSections()}
+	if c.hasDWARFEdits() {
+		edits := pipeline.DWARFEdits{
+			PrefixMaps:           c.prefixMaps,
+			ClearMacroReferences: c.StripMacros,
+			Redact:               c.redaction,
+		}
+		if c.cuFilter != nil {
+			edits.KeepUnit = c.cuFilter.keep
+		}
+		transformers = append(transformers, pipeline.EditDWARF(edits))
+	}
+	if c.MaxDebugSize > 0 {
+		transformers = append(transformers, pipeline.SizeBudget(uint64(c.MaxDebugSize)))
+	}
+	if c.GDBIndex {
+		transformers = append(transformers, pipeline.GDBIndex())
+	}
+	if c.UnwindTable != unwindNone {
+		transformers = append(transformers, pipeline.UnwindTable(c.UnwindTable == unwindSection))
+	}
+	// Last, once the sections to write are known.
+	transformers = append(transformers, pipeline.FreeSpace(uint64(c.MinFreeSpace)))
+
+	var openOpts []pipeline.OpenOption
+	if !c.AllowEmpty {
+		openOpts = append(openOpts, pipeline.RequireDebugInfo())
+	}
+	if c.Fadvise {
+		openOpts = append(openOpts, pipeline.AdviseKernel())
+	}
+	writerOpts := []elfwriter.Option{elfwriter.WithSparseOutput(c.Sparse)}
+	if d != nil {
+		openOpts = append(openOpts, d.openOptions()...)
+		writerOpts = append(writerOpts, d.writerOptions()...)
+	}
+	opts := []pipeline.Option{
+		pipeline.WithReader(pipeline.Open(c.limits(), openOpts...)),
+		pipeline.WithFilters(c.filters()...),
+		pipeline.WithTransformers(transformers...),
+		pipeline.WithWriter(progressWriter(progress, out, writerOpts...)),
+		pipeline.WithTracer(tracer),
+	}
+	if !c.policy.Empty() {
+		opts = append(opts, pipeline.WithSinks(policy.Sink(c.policy)))
+	}
+	return pipeline.New(opts...)
+}
+
+// filters returns the filters selecting the sections to extract.
+func (c *extractCmd) filters() []pipeline.Filter {
+	debug := pipeline.DebugSections()
+	if c.KeepCTFBTF {
+		debug = pipeline.DebugSections(pipeline.IsCTF, pipeline.IsBTF)
+	}
+	filters := []pipeline.Filter{debug, pipeline.Preset(c.Preset)}
+	if c.SymbolizeOnly {
+		filters = append(filters, pipeline.SymbolizationOnly())
+	}
+	if c.StripMacros {
+		filters = append(filters, pipeline.StripMacros())
+	}
+	return filters
+}
+
+func (c *extractCmd) limits() elfutils.Limits {
+	return elfutils.Limits{
+		MaxInputSize:   int64(c.MaxInputSize),
+		MaxSections:    c.MaxSections,
+		MaxSectionSize: uint64(c.MaxSectionSize),
+	}
+}
+
+// progressWriter writes the ELF file and renders the progress of writing it to out
+// against the estimated size of the output.
+func progressWriter(progress *progressBar, out *progressFile, opts ...elfwriter.Option) pipeline.Writer {
+	w := pipeline.ELF(opts...)
+	return pipeline.WriterFunc(w.Name(), func(ctx context.Context, j *pipeline.Job, ws io.WriteSeeker) error {
+		progress.setTotal(pipeline.EstimateSize(&j.File.FileHeader, j.Sections))
+		if err := w.Write(ctx, j, ws); err != nil {
+			return err
+		}
+		progress.finish(out.w.Count())
+		return nil
+	})
+}
+
+// spillToTempFile copies the given stream to a temporary file and returns its path.
+// Streams larger than maxSize fail with elfutils.ErrLimitExceeded, unless maxSize is zero.
+func spillToTempFile(r io.Reader, maxSize int64, progress *progressBar) (string, error) {
+	f, err := ioutil.TempFile("", "split-debug-stdin-*")
+	if err != nil {
+		return "", err
+	}
+	cr := iohelper.NewCountingReader(r, progress.update)
+	var src io.Reader = cr
+	if maxSize > 0 {
+		src = io.LimitReader(cr, maxSize+1)
+	}
+	n, err := io.Copy(f, src)
+	if err == nil && maxSize > 0 && n > maxSize {
+		err = fmt.Errorf("%w: input exceeds %d bytes", elfutils.ErrLimitExceeded, maxSize)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	progress.finish(cr.Count())
+	return f.Name(), nil
+}
+
+func copyToStdout(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(os.Stdout, iohelper.ContextReader(ctx, f))
+	return err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/funcmap"
+)
+
+type funcMapCmd struct {
+	Path   string `kong:"required,arg,name='path',help='File path to the object file to export the function map of.',type:'path'"`
+	Format string `kong:"enum='json,binary',default='json',help='Format of the function map, one of: json, binary is the flat little-endian encoding documented in pkg/funcmap.'"`
+	Output string `kong:"short='o',help='Output file path. Defaults to stdout.',type:'path'"`
+}
+
+// Run exports the function map of the object file: the start, end and name of its functions taken
+// from the symbol tables, the Go symbol table, the PLT stubs and the FDEs of .eh_frame, so
+// profilers resolve addresses to functions without parsing the ELF file at runtime.
+func (c *funcMapCmd) Run() error {
+	f, err := elfutils.Open(c.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open given file: %w", err)
+	}
+	defer f.Close()
+
+	fns, err := funcmap.Build(f)
+	if err != nil {
+		return fmt.Errorf("failed to build function map: %w", err)
+	}
+
+	if c.Output == "" || c.Output == stdio {
+		w := bufio.NewWriter(os.Stdout)
+		if err := c.write(w, fns); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	out, err := ioutil.TempFile(filepath.Dir(c.Output), "."+filepath.Base(c.Output)+".*"+partialSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(out.Name())
+	w := bufio.NewWriter(out)
+	if err := c.write(w, fns); err != nil {
+		out.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Chmod(0o644); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), c.Output)
+}
+
+func (c *funcMapCmd) write(w io.Writer, fns []funcmap.Function) error {
+	if c.Format == "binary" {
+		return funcmap.WriteBinary(w, fns)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(fns)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/polarsignals/split-debug/pkg/health"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type grpcCmd struct {
+	Listen string `kong:"default=':7070',help='Address to serve the gRPC service on.'"`
+	serveFlags
+}
+
+// Run serves the remote extraction until the context is canceled,
+// ongoing extractions are completed before it returns.
+func (c *grpcCmd) Run(ctx context.Context, logger log.Logger, tracer trace.Tracer, sd shutdown) error {
+	tlsConfig, err := c.serverTLS()
+	if err != nil {
+		return usageError(err)
+	}
+	reg := newRegistry()
+	if err := c.serveMetrics(ctx, logger, sd, reg, health.NewHandler()); err != nil {
+		return err
+	}
+	lis, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return usageError(fmt.Errorf("failed to listen: %w", err))
+	}
+	server, store, cleanup, err := c.newServer(logger, tracer, reg)
+	if err != nil {
+		lis.Close()
+		return err
+	}
+	defer cleanup()
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	s := grpc.NewServer(opts...)
+	server.Register(s)
+
+	go func() {
+		<-sd.done
+		level.Info(logger).Log("msg", "shutting down gRPC server")
+		go func() {
+			// The calls in flight are interrupted once the drain timeout elapses.
+			<-ctx.Done()
+			s.Stop()
+		}()
+		s.GracefulStop()
+	}()
+	level.Info(logger).Log("msg", "serving gRPC", "address", lis.Addr(), "store", store, "tls", tlsConfig != nil)
+	if err := s.Serve(lis); err != nil {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return nil
+}
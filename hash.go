@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/polarsignals/split-debug/pkg/digest"
+)
+
+// hashFlags select the hash algorithm the contents are identified by, in the metadata sidecars
+// and to skip uploads.
+type hashFlags struct {
+	Hash string `kong:"enum='sha256,blake3,xxhash',default='sha256',help='Hash algorithm of the digests of the metadata sidecars and of the uploads skipped with --upload-skip-existing, one of: sha256, blake3, xxhash. Digests other than SHA-256 are recorded as digest fields of the sidecars along with the algorithm, and sent in the X-Content-BLAKE3 or X-Content-XXHASH headers.'"`
+}
+
+// hash returns the selected hash algorithm.
+func (f *hashFlags) hash() digest.Algorithm {
+	a, err := digest.Parse(f.Hash)
+	if err != nil {
+		// The flag is an enum of the supported algorithms.
+		panic(err)
+	}
+	return a
+}
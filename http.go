@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/health"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// readHeaderTimeout bounds the time clients take to send the request headers, so slow clients
+// cannot hold connections open. Request bodies, e.g. large uploads, are not bounded.
+const readHeaderTimeout = 10 * time.Second
+
+type httpCmd struct {
+	Listen string `kong:"default=':8080',help='Address to serve the HTTP API on.'"`
+	serveFlags
+}
+
+// Run serves the HTTP API of the remote extraction until the context is canceled,
+// ongoing extractions are completed before it returns.
+func (c *httpCmd) Run(ctx context.Context, logger log.Logger, tracer trace.Tracer, sd shutdown) error {
+	tlsConfig, err := c.serverTLS()
+	if err != nil {
+		return usageError(err)
+	}
+	reg := newRegistry()
+	if err := c.serveMetrics(ctx, logger, sd, reg, health.NewHandler()); err != nil {
+		return err
+	}
+	lis, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return usageError(fmt.Errorf("failed to listen: %w", err))
+	}
+	server, store, cleanup, err := c.newServer(logger, tracer, reg)
+	if err != nil {
+		lis.Close()
+		return err
+	}
+	defer cleanup()
+
+	s := &http.Server{Handler: server.Handler(), TLSConfig: tlsConfig, ReadHeaderTimeout: readHeaderTimeout}
+	shutdown := make(chan error, 1)
+	go func() {
+		<-sd.done
+		level.Info(logger).Log("msg", "shutting down HTTP server")
+		// The requests in flight are interrupted once the drain timeout elapses.
+		err := s.Shutdown(ctx)
+		if err != nil {
+			s.Close()
+			err = fmt.Errorf("requests interrupted after the drain timeout: %w", err)
+		}
+		shutdown <- err
+	}()
+	level.Info(logger).Log("msg", "serving HTTP", "address", lis.Addr(), "store", store, "tls", tlsConfig != nil)
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, tlsConfig)
+	}
+	if err := s.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return <-shutdown
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/polarsignals/split-debug/pkg/buildiddir"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+type indexCmd struct {
+	Dir    string `kong:"required,arg,name='dir',help='Directory of debug files to index, e.g. /usr/lib/debug.',type:'existingdir'"`
+	Prune  bool   `kong:"help='Remove the links of the .build-id directory whose debug file is gone.'"`
+	DryRun bool   `kong:"help='Only log the links that would be created, repaired or removed.'"`
+}
+
+// Run links the debug files below the directory by their build IDs, creating the missing links of
+// the .build-id directory and repairing the ones that are dangling or point to another file.
+// It fails if none of the files has a build ID.
+func (c *indexCmd) Run(logger log.Logger) error {
+	files := newWalker(logger, false).expand([]string{c.Dir})
+	res, err := buildiddir.Index(logger, c.Dir, files, buildiddir.Options{Prune: c.Prune, DryRun: c.DryRun})
+	level.Info(logger).Log(
+		"msg", "indexed debug files",
+		"build_ids", res.BuildIDs,
+		"skipped", res.Skipped,
+		"created", res.Created,
+		"repaired", res.Repaired,
+		"removed", res.Removed,
+		"unchanged", res.Unchanged,
+		"dry_run", c.DryRun,
+	)
+	return err
+}
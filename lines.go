@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/symbolize"
+)
+
+type linesCmd struct {
+	Path     string `kong:"required,arg,name='path',help='File path to the object or debug file to dump the line table of.',type:'path'"`
+	Function string `kong:"short='f',help='Only dump the lines of the function, by its DWARF or symbol name.'"`
+	Range    string `kong:"help='Only dump the lines of the hexadecimal address range start-end, end excluded.'"`
+	JSON     bool   `kong:"name='json',help='Print the lines as JSON.'"`
+}
+
+// Run dumps the DWARF line table of the object file, the address ranges and the file and line
+// they map to, e.g. to check that a debug file written with --symbolize-only still maps addresses
+// to lines before uploading it. It fails when no line covers the function or range.
+func (c *linesCmd) Run() error {
+	if c.Function != "" && c.Range != "" {
+		return usageError(errors.New("--function and --range are mutually exclusive"))
+	}
+	ranges := [][2]uint64{{0, math.MaxUint64}}
+	if c.Range != "" {
+		rng, err := parseRange(c.Range)
+		if err != nil {
+			return usageError(err)
+		}
+		ranges = [][2]uint64{rng}
+	}
+
+	f, err := elfutils.Open(c.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open given file: %w", err)
+	}
+	defer f.Close()
+
+	r, err := symbolize.New(f)
+	if err != nil {
+		return fmt.Errorf("failed to read debug information: %w", err)
+	}
+	if c.Function != "" {
+		ranges = r.FunctionRanges(c.Function)
+		if len(ranges) == 0 {
+			return fmt.Errorf("function %q not found", c.Function)
+		}
+	}
+
+	lines := []symbolize.Line{}
+	for _, rng := range ranges {
+		l, err := r.Lines(rng[0], rng[1])
+		if err != nil {
+			return fmt.Errorf("failed to read line table: %w", err)
+		}
+		lines = append(lines, l...)
+	}
+	if len(lines) == 0 {
+		return errors.New("no line information found")
+	}
+
+	if c.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(lines)
+	}
+	for _, l := range lines {
+		fmt.Fprintf(os.Stdout, "%016x-%016x %s:%d", l.Address, l.End, orUnknown(l.File), l.Line)
+		if l.Column != 0 {
+			fmt.Fprintf(os.Stdout, ":%d", l.Column)
+		}
+		if l.IsStmt {
+			fmt.Fprint(os.Stdout, " stmt")
+		}
+		fmt.Fprintln(os.Stdout)
+	}
+	return nil
+}
+
+// parseRange parses an address range given as start-end, in hexadecimal.
+func parseRange(s string) ([2]uint64, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return [2]uint64{}, fmt.Errorf("invalid address range %q: expected start-end", s)
+	}
+	var rng [2]uint64
+	for i, a := range []string{start, end} {
+		addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(a), "0x"), 16, 64)
+		if err != nil {
+			return [2]uint64{}, fmt.Errorf("invalid address %q: %w", a, err)
+		}
+		rng[i] = addr
+	}
+	if rng[0] >= rng[1] {
+		return [2]uint64{}, fmt.Errorf("invalid address range %q: start is not before end", s)
+	}
+	return rng, nil
+}
@@ -1,80 +1,101 @@
 package main
 
 import (
-	"debug/elf"
-	"fmt"
-	"io/ioutil"
+	"context"
 	"os"
-	"path/filepath"
-	"strings"
+	"time"
 
-	"github.com/polarsignals/split-debug/pkg/elfutils"
-	"github.com/polarsignals/split-debug/pkg/elfwriter"
 	"github.com/polarsignals/split-debug/pkg/logger"
+	"github.com/polarsignals/split-debug/pkg/sourcedate"
+	"github.com/polarsignals/split-debug/pkg/tracing"
 
 	"github.com/alecthomas/kong"
+	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Set at build time through -ldflags.
+var (
+	version = "dev"
+	commit  = ""
 )
 
 type flags struct {
-	LogLevel string `kong:"enum='error,warn,info,debug',help='Log level.',default='info'"`
-	Path     string `kong:"required,arg,name='path',help='File path to the object file extract debug information from.',type:'path'"`
-}
+	Config kong.ConfigFlag `kong:"help='Load flags from a YAML configuration file. Flags given on the command line take precedence.',type:'path'"`
 
-func main() {
-	flags := flags{}
-	_ = kong.Parse(&flags)
-	l := logger.NewLogger(flags.LogLevel, logger.LogFormatLogfmt, "")
-	if err := run(flags.Path); err != nil {
-		level.Error(l).Log("err", err)
-		os.Exit(1)
-	}
-	level.Info(l).Log("msg", "done!")
-}
+	LogLevel  string `kong:"enum='error,warn,info,debug',help='Log level.',default='info'"`
+	LogFormat string `kong:"enum='logfmt,json',help='Log format.',default='logfmt'"`
+	Quiet     bool   `kong:"short='q',help='Only log warnings and errors.'"`
+	Tracing   bool   `kong:"help='Export traces using OTLP over HTTP, configured through the standard OTEL_* environment variables.'"`
 
-var isDwarf = func(s *elf.Section) bool {
-	return strings.HasPrefix(s.Name, ".debug_") ||
-		strings.HasPrefix(s.Name, ".zdebug_") ||
-		strings.HasPrefix(s.Name, "__debug_") // macos
-}
+	DrainTimeout time.Duration `kong:"default='25s',help='Time to finish the work in flight after SIGINT or SIGTERM, e.g. the files being extracted or the requests being served, before it is interrupted. New work is not taken once signaled, a second signal interrupts right away. Keep it below the grace period of the orchestrator, e.g. the 30s of Kubernetes.'"`
 
-var isSymbolTable = func(s *elf.Section) bool {
-	return s.Name == ".symtab" || s.Name == ".strtab" || s.Name == ".dynsymtab"
+	Extract   extractCmd   `kong:"cmd,default='withargs',help='Extract debug information from an object file.'"`
+	Addr2line addr2lineCmd `kong:"cmd,name='addr2line',help='Translate addresses into function names, file names and line numbers.'"`
+	Assemble  assembleCmd  `kong:"cmd,help='Rebuild a debug file from the manifest and section blobs written by extract --split-sections.'"`
+	Check     checkCmd     `kong:"cmd,help='Check that the debug file linked by .gnu_debuglink is found and matches its CRC32.'"`
+	Compare   compareCmd   `kong:"cmd,help='Compare the sections, build IDs and DWARF of two object or debug files.'"`
+	Decrypt   decryptCmd   `kong:"cmd,help='Decrypt a debug file written with --encrypt.'"`
+	FuncMap   funcMapCmd   `kong:"cmd,name='func-map',help='Export the start, end and name of the functions of an object file for profilers, as JSON or a flat binary.'"`
+	GRPC      grpcCmd      `kong:"cmd,name='grpc',help='Serve the extraction of debug information over gRPC.'"`
+	HTTP      httpCmd      `kong:"cmd,name='http',help='Serve the extraction of debug information over an HTTP API.'"`
+	Index     indexCmd     `kong:"cmd,help='Create and repair the .build-id links of a directory of debug files.'"`
+	Lines     linesCmd     `kong:"cmd,help='Dump the DWARF line table of an object file, the address ranges and the file and line they map to.'"`
+	NodeScan  nodeScanCmd  `kong:"cmd,name='node-scan',help='Extract the debug information of the object files mapped by the processes running in the containers of the node.'"`
+	Probes    probesCmd    `kong:"cmd,help='List the SystemTap SDT probes (USDT) of an object file.'"`
+	Sections  sectionsCmd  `kong:"cmd,help='List the section headers of an object file, as readelf -S does.'"`
+	Symbols   symbolsCmd   `kong:"cmd,help='List the symbols of an object file with their addresses and sizes.'"`
+	Version   versionCmd   `kong:"cmd,help='Print the version, and with --json the supported features.'"`
+	Warm      warmCmd      `kong:"cmd,help='Fetch the debug files of a list of build IDs from debuginfod servers into the local cache.'"`
+	CLISpec   cliSpecCmd   `kong:"cmd,name='cli-spec',hidden,help='Print the specification of the command line interface as JSON or as a man page.'"`
 }
 
-var isGoSymbolTable = func(s *elf.Section) bool {
-	return s.Name == ".gosymtab" || s.Name == ".gopclntab"
-}
-
-func run(path string) error {
-	elfFile, err := elfutils.Open(path)
+func main() {
+	flags := flags{}
+	parser := kong.Must(&flags, kong.Configuration(configLoader))
+	ctx, err := parser.Parse(os.Args[1:])
 	if err != nil {
-		return fmt.Errorf("failed to open given field: %w", err)
+		parser.Errorf("%s", err)
+		os.Exit(exitUsage)
+	}
+	// Outputs take their timestamps from it, invalid values are rejected rather than ignored.
+	if _, _, err := sourcedate.Epoch(); err != nil {
+		parser.Errorf("%s", err)
+		os.Exit(exitUsage)
 	}
-	defer elfFile.Close()
 
-	output, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+"-debuginfo.*")
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+	logLevel := flags.LogLevel
+	if flags.Quiet {
+		logLevel = "warn"
 	}
+	l := logger.NewLogger(logLevel, flags.LogFormat, "")
 
-	w, err := elfwriter.New(output, &elfFile.FileHeader)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		level.Warn(l).Log("msg", "tracing failed", "err", err)
+	}))
+	tp, shutdown, err := tracing.NewProvider(context.Background(), flags.Tracing)
 	if err != nil {
-		return fmt.Errorf("failed to initialize writer: %w", err)
+		level.Error(l).Log("msg", "failed to initialize tracing", "err", err)
+		os.Exit(exitFailure)
 	}
 
-	for _, s := range elfFile.Sections {
-		if isDwarf(s) || isSymbolTable(s) || isGoSymbolTable(s) {
-			w.Sections = append(w.Sections, s)
-		}
-	}
+	// Interrupting stops taking new work and drains the ongoing work, e.g. on agent shutdown.
+	runCtx, sd, stop := handleSignals(l, flags.DrainTimeout)
 
-	if err := w.Write(); err != nil {
-		return fmt.Errorf("failed to write: %w", err)
+	ctx.BindTo(runCtx, (*context.Context)(nil))
+	ctx.Bind(sd)
+	ctx.BindTo(l, (*log.Logger)(nil))
+	ctx.BindTo(tp.Tracer("github.com/polarsignals/split-debug"), (*trace.Tracer)(nil))
+	err = ctx.Run()
+	stop()
+	if err := shutdown(context.Background()); err != nil {
+		level.Warn(l).Log("msg", "failed to flush traces", "err", err)
 	}
-
-	if err := w.Close(); err != nil {
-		return fmt.Errorf("failed tom closer writer: %w", err)
+	if err != nil {
+		level.Error(l).Log("err", err)
+		os.Exit(exitCode(err))
 	}
-	return nil
+	level.Info(l).Log("msg", "done!")
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/digest"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+	"github.com/polarsignals/split-debug/pkg/sourcedate"
+)
+
+// metadata describes the debug information extracted from an object file,
+// it is the manifest symbol ingestion services validate uploads with.
+type metadata struct {
+	Path      string `json:"path"`
+	BuildID   string `json:"build_id,omitempty"`
+	GoBuildID string `json:"go_build_id,omitempty"`
+	Arch      string `json:"arch"`
+	OS        string `json:"os"`
+	// SHA256 is the digest of the object file, DebugFileSHA256 the one of the debug file extracted from it.
+	SHA256          string `json:"sha256,omitempty"`
+	DebugFileSHA256 string `json:"debug_file_sha256,omitempty"`
+	// Hash is the hash algorithm of the digests if it is not SHA-256, e.g. blake3. The digests are
+	// then Digest and DebugFileDigest, and the Digest of the sections.
+	Hash            string `json:"hash,omitempty"`
+	Digest          string `json:"digest,omitempty"`
+	DebugFileDigest string `json:"debug_file_digest,omitempty"`
+	// GNUFeatures are the hardening features the GNU property note marks the object file compatible with.
+	GNUFeatures []string `json:"gnu_features,omitempty"`
+	// TypeInfo are the formats of the type information the object file has besides DWARF, ctf or
+	// btf, whether the debug file keeps them or not.
+	TypeInfo []string `json:"type_info,omitempty"`
+	// Language is the language the object file was written in if it needs its own tooling, rust.
+	Language string `json:"language,omitempty"`
+	// Layout is how the object file is laid out in memory, symbolizers compute the load bias of
+	// its mappings from it.
+	Layout *elfutils.Layout `json:"layout,omitempty"`
+
+	DebugFile string            `json:"debug_file"`
+	Sections  []sectionMetadata `json:"sections"`
+	// DroppedSections are the sections of the object file left out of the debug file to fit the
+	// size budget, consumers cannot expect their debug information.
+	DroppedSections []string `json:"dropped_sections,omitempty"`
+	// Encoding is the encoding of the debug file, e.g. zstd-seekable, its digest is of the decoded file.
+	Encoding string `json:"encoding,omitempty"`
+
+	Tool       toolMetadata `json:"tool"`
+	ModifiedAt *time.Time   `json:"modified_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type sectionMetadata struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Size   uint64 `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	Digest string `json:"digest,omitempty"`
+}
+
+type toolMetadata struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+}
+
+// digests hash the object file, its debug file and the sections written to it while the extraction
+// reads and writes them, so the files are not read once more to hash them.
+type digests struct {
+	hash     digest.Algorithm
+	input    hash.Hash
+	output   hash.Hash
+	sections map[*elf.Section]hash.Hash
+}
+
+func newDigests(a digest.Algorithm) *digests {
+	return &digests{
+		hash:     a,
+		input:    a.New(),
+		output:   a.New(),
+		sections: make(map[*elf.Section]hash.Hash),
+	}
+}
+
+// openOptions tee the input to its hash while it is read.
+func (d *digests) openOptions() []pipeline.OpenOption {
+	return []pipeline.OpenOption{pipeline.TeeInput(d.input)}
+}
+
+// writerOptions tee the output and the uncompressed contents of the sections to their hashes while
+// they are written, so the digests of the sections do not depend on compression.
+func (d *digests) writerOptions() []elfwriter.Option {
+	return []elfwriter.Option{
+		elfwriter.WithOutputTee(d.output),
+		elfwriter.WithSectionTee(func(s *elf.Section) io.Writer {
+			h := d.hash.New()
+			d.sections[s] = h
+			return h
+		}),
+	}
+}
+
+// newMetadata collects the metadata of the given sections of the object file at path, with the
+// digests of the extraction.
+func newMetadata(path string, f *elf.File, sections []*elf.Section, d *digests) *metadata {
+	meta := &metadata{
+		Path: path,
+		Arch: strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_")),
+		OS:   strings.ToLower(strings.TrimPrefix(f.OSABI.String(), "ELFOSABI_")),
+		Tool: toolMetadata{
+			Name:    "split-debug",
+			Version: version,
+			Commit:  commit,
+		},
+		CreatedAt: sourcedate.Now().UTC(),
+	}
+	sum, debugSum := hex.EncodeToString(d.input.Sum(nil)), hex.EncodeToString(d.output.Sum(nil))
+	if d.hash == digest.SHA256 {
+		meta.SHA256, meta.DebugFileSHA256 = sum, debugSum
+	} else {
+		meta.Hash = d.hash.Name()
+		meta.Digest, meta.DebugFileDigest = sum, debugSum
+	}
+	if id, err := elfutils.BuildID(f); err == nil {
+		meta.BuildID = id
+	}
+	if id, err := elfutils.GoBuildID(f); err == nil {
+		meta.GoBuildID = id
+	}
+	if features, err := elfutils.GNUFeatures(f); err == nil {
+		meta.GNUFeatures = features
+	}
+	meta.TypeInfo = typeInfo(f)
+	if elfutils.IsRust(f) {
+		meta.Language = "rust"
+	}
+	if len(f.Progs) > 0 {
+		layout := elfutils.LayoutInfo(f)
+		meta.Layout = &layout
+	}
+	if path != stdio {
+		if fi, err := os.Stat(path); err == nil {
+			t := sourcedate.Clamp(fi.ModTime()).UTC()
+			meta.ModifiedAt = &t
+		}
+	}
+
+	for _, s := range sections {
+		sm := sectionMetadata{
+			Name: s.Name,
+			Type: s.Type.String(),
+			Size: s.Size,
+		}
+		if h, ok := d.sections[s]; ok {
+			sum := hex.EncodeToString(h.Sum(nil))
+			if meta.Hash == "" {
+				sm.SHA256 = sum
+			} else {
+				sm.Digest = sum
+			}
+		}
+		meta.Sections = append(meta.Sections, sm)
+	}
+	return meta
+}
+
+// typeInfo returns the formats of the CTF and BTF type information of f.
+func typeInfo(f *elf.File) []string {
+	var ctf, btf bool
+	for _, s := range f.Sections {
+		ctf = ctf || pipeline.IsCTF(s)
+		btf = btf || pipeline.IsBTF(s)
+	}
+	var formats []string
+	if ctf {
+		formats = append(formats, "ctf")
+	}
+	if btf {
+		formats = append(formats, "btf")
+	}
+	return formats
+}
+
+func (m *metadata) marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeFile writes the metadata as JSON to the given path.
+func (m *metadata) writeFile(path string) error {
+	data, err := m.marshal()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a staging file next to path and renames it into place,
+// so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*"+partialSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/polarsignals/split-debug/pkg/health"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsFlags configure the metrics listener of the long-running commands, it serves the health
+// probes as well.
+type metricsFlags struct {
+	MetricsAddr string `kong:"placeholder='ADDR',help='Serve the Prometheus metrics on this address, e.g. :8081, as GET /metrics, along with the liveness and readiness probes as GET /healthz and /readyz with a JSON status. Readiness fails once the shutdown is requested and while the uploads fail.'"`
+}
+
+// newRegistry returns the registry of the metrics of the command, with the metrics of the Go
+// runtime and of the process.
+func newRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// serveMetrics serves the metrics of reg and the probes of h in the background until ctx is
+// canceled, if a metrics address is given. Readiness fails once the shutdown is requested, so no
+// new work is routed to the process while it drains.
+func (f *metricsFlags) serveMetrics(ctx context.Context, logger log.Logger, sd shutdown, reg *prometheus.Registry, h *health.Handler) error {
+	if f.MetricsAddr == "" {
+		return nil
+	}
+	h.AddCheck("shutdown", func() error {
+		if sd.requested() {
+			return errors.New("shutdown requested")
+		}
+		return nil
+	})
+	lis, err := net.Listen("tcp", f.MetricsAddr)
+	if err != nil {
+		return usageError(fmt.Errorf("failed to listen for metrics: %w", err))
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.Handle("/healthz", h)
+	mux.Handle("/readyz", h)
+	s := &http.Server{Handler: mux, ReadHeaderTimeout: readHeaderTimeout}
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+	go func() {
+		if err := s.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+			level.Error(logger).Log("msg", "failed to serve metrics", "err", err)
+		}
+	}()
+	level.Info(logger).Log("msg", "serving metrics", "address", lis.Addr())
+	return nil
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/audit"
+	"github.com/polarsignals/split-debug/pkg/catalog"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/health"
+	"github.com/polarsignals/split-debug/pkg/nodescan"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+	"github.com/polarsignals/split-debug/pkg/policy"
+	"github.com/polarsignals/split-debug/pkg/tlog"
+	"github.com/polarsignals/split-debug/pkg/upload"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type nodeScanCmd struct {
+	Proc          string        `kong:"default='/proc',help='Proc file system to enumerate the processes from, e.g. /host/proc in a DaemonSet.',type:'path'"`
+	HostProcesses bool          `kong:"help='Also scan the processes that do not run in containers.'"`
+	OutputDir     string        `kong:"help='Directory to write the debug files to as <build-id>.debug. Debug files already in it are not extracted again.',type:'path'"`
+	Interval      time.Duration `kong:"help='Scan again after this interval, e.g. 5m, until interrupted. Scans once by default.'"`
+	Fadvise       bool          `kong:"help='Advise the kernel to read the inputs sequentially and to drop them from the page cache once processed, so scanning many files does not evict the page cache of other workloads. Only on Linux.'"`
+	uploadFlags
+	catalogFlags
+	hashFlags
+	ownershipFlags
+	metricsFlags
+	auditFlags
+	policyFlags
+	tlogFlags
+
+	// uploads is the queue of the uploads, if they run in the background.
+	uploads *upload.Queue
+	queued  *queuedUploads
+}
+
+// Run extracts the debug information of the object files mapped by the processes of the node,
+// once per build ID, and writes it to the output directory or uploads it.
+func (c *nodeScanCmd) Run(ctx context.Context, logger log.Logger, tracer trace.Tracer, sd shutdown) error {
+	if c.OutputDir == "" && c.UploadURL == "" {
+		return usageError(errors.New("--output-dir or --upload-url is required"))
+	}
+	u, err := c.uploader(c.hash())
+	if err != nil {
+		return usageError(err)
+	}
+	if err := c.parseOwnership(); err != nil {
+		return err
+	}
+	rules, err := c.policyRules()
+	if err != nil {
+		return err
+	}
+	if err := c.openTlog(c.UploadURL, c.UploadQueueSize > 0); err != nil {
+		return err
+	}
+	if err := c.openCatalog(); err != nil {
+		return err
+	}
+	defer c.closeCatalog()
+	if err := c.openAudit("node-scan"); err != nil {
+		return err
+	}
+	defer c.closeAudit()
+	reg := newRegistry()
+	if u != nil {
+		u = upload.NewInstrumented(u, reg)
+	}
+	if u != nil && c.UploadQueueSize > 0 {
+		c.queued = &queuedUploads{catalogFlags: &c.catalogFlags, auditFlags: &c.auditFlags, uploadURL: c.UploadURL}
+		c.uploads = c.queue(ctx, u, func(buildID string, err error) { c.queued.done(logger, buildID, err) })
+		u = c.uploads
+		upload.RegisterQueue(reg, c.uploads)
+	}
+	h := health.NewHandler()
+	if u != nil {
+		h.AddCheck("uploader", func() error { return upload.Healthy(u) })
+	}
+	if c.uploads != nil {
+		h.AddValue("upload_queue", func() interface{} {
+			waiting, uploading := c.uploads.Depth()
+			return map[string]int{"waiting": waiting, "uploading": uploading, "size": c.uploads.Size()}
+		})
+	}
+	if err := c.serveMetrics(ctx, logger, sd, reg, h); err != nil {
+		return err
+	}
+	if c.OutputDir != "" {
+		if err := c.mkdirAll(c.OutputDir); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	var openOpts []pipeline.OpenOption
+	if c.Fadvise {
+		openOpts = append(openOpts, pipeline.AdviseKernel())
+	}
+	opts := []pipeline.Option{
+		pipeline.WithReader(pipeline.Open(elfutils.Limits{}, openOpts...)),
+		pipeline.WithFilters(pipeline.DebugSections()),
+		pipeline.WithTransformers(pipeline.LinkedSections()),
+		pipeline.WithTracer(tracer),
+		pipeline.WithRegisterer(reg),
+	}
+	// Checked before the debug files are moved into the output directory or uploaded.
+	if !rules.Empty() {
+		opts = append(opts, pipeline.WithSinks(policy.Sink(rules)))
+	}
+	if u != nil {
+		opts = append(opts, pipeline.WithSinks(upload.Sink(u)))
+	}
+	if c.spool != nil {
+		opts = append(opts, pipeline.WithSinks(tlog.Sink(c.spool, c.hash())))
+	}
+	p := pipeline.New(opts...)
+
+	scanOpts := []nodescan.Option{nodescan.WithProc(c.Proc)}
+	if c.HostProcesses {
+		scanOpts = append(scanOpts, nodescan.WithHostProcesses())
+	}
+	scanner := nodescan.NewScanner(scanOpts...)
+
+	// Build IDs are processed once, even across scans.
+	done := map[string]bool{}
+	for {
+		c.flushTlog(ctx, logger)
+		failed, total, err := c.scan(ctx, logger, sd, scanner, p, done)
+		if err != nil {
+			c.waitForUploads(logger)
+			return err
+		}
+		if c.Interval == 0 || sd.requested() {
+			failed += c.waitForUploads(logger)
+			if err := c.auditFailed(); err != nil {
+				return err
+			}
+			if failed > 0 {
+				return &exitError{
+					code: exitPartialFailure,
+					err:  fmt.Errorf("failed to extract debug information from %d of %d files", failed, total),
+				}
+			}
+			return nil
+		}
+		select {
+		case <-sd.done:
+			c.waitForUploads(logger)
+			return c.auditFailed()
+		case <-time.After(c.Interval):
+		}
+	}
+}
+
+// scan extracts the debug information of the object files that are not done yet, until the
+// shutdown is requested. It returns the number of failed and of attempted extractions.
+func (c *nodeScanCmd) scan(ctx context.Context, logger log.Logger, sd shutdown, scanner *nodescan.Scanner, p *pipeline.Pipeline, done map[string]bool) (int, int, error) {
+	targets, err := scanner.Scan()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to scan processes: %w", err)
+	}
+
+	var extracted, failed int
+	for _, t := range targets {
+		if sd.requested() {
+			break
+		}
+		tlogger := log.With(logger, "pid", t.PID, "container", t.ContainerID, "file", t.Path)
+		buildID, err := c.buildIDOf(t.Open)
+		if err != nil {
+			level.Debug(tlogger).Log("msg", "skipping file", "err", err)
+			continue
+		}
+		if done[buildID] || c.extracted(buildID) {
+			done[buildID] = true
+			continue
+		}
+		if first := c.cataloged(ctx, tlogger, buildID); first != "" {
+			level.Debug(tlogger).Log("msg", "skipping file with the build ID of a cataloged file", "cataloged", first)
+			done[buildID] = true
+			continue
+		}
+		if err := c.extract(ctx, tlogger, p, t, buildID); err != nil {
+			level.Error(tlogger).Log("msg", "failed to extract debug information", "build_id", buildID, "err", err)
+			failed++
+			continue
+		}
+		done[buildID] = true
+		extracted++
+	}
+	level.Info(logger).Log("msg", "scanned node", "files", len(targets), "extracted", extracted, "failed", failed)
+	return failed, extracted + failed, nil
+}
+
+// buildIDOf returns the GNU build ID of the object file, the debug files are keyed by it.
+// Files without GNU build ID or debug information are not extracted: Go build IDs contain slashes,
+// so they are not usable in paths and upload URLs, and Go binaries have a GNU build ID by default.
+func (c *nodeScanCmd) buildIDOf(path string) (string, error) {
+	f, err := elfutils.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	id, err := elfutils.BuildID(f)
+	if err != nil || id == "" {
+		return "", errors.New("no GNU build ID")
+	}
+	if err := elfutils.CheckDebugInfo(f); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// debugFile returns the path of the debug file of the build ID in the output directory, if there is one.
+func (c *nodeScanCmd) debugFile(buildID string) string {
+	if c.OutputDir == "" {
+		return ""
+	}
+	return filepath.Join(c.OutputDir, buildID+".debug")
+}
+
+// extracted reports whether the debug file of the build ID is in the output directory from an earlier run.
+func (c *nodeScanCmd) extracted(buildID string) bool {
+	if c.OutputDir == "" {
+		return false
+	}
+	_, err := os.Stat(c.debugFile(buildID))
+	return err == nil
+}
+
+// extract writes the debug information of the target to the output directory, or to a temporary
+// file that is removed once it is uploaded. The outcome is recorded in the catalog.
+func (c *nodeScanCmd) extract(ctx context.Context, logger log.Logger, p *pipeline.Pipeline, t nodescan.Target, buildID string) (err error) {
+	dest, dir := c.debugFile(buildID), c.OutputDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	output, err := ioutil.TempFile(dir, "."+buildID+".*"+partialSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(output.Name())
+	// The writer closes the output, closing it again is harmless.
+	defer output.Close()
+
+	job := &pipeline.Job{Path: t.Path, Input: t.Open, Output: output.Name(), Logger: logger}
+	defer job.Close()
+	var receipt upload.Receipt
+	ctx = upload.WithReceipt(ctx, &receipt)
+	// Recorded before the temporary output is removed, so its size and digest are known.
+	defer func() {
+		if c.db == nil {
+			return
+		}
+		// The output is moved into place, or only uploaded and then removed.
+		status, errMsg, out := catalog.StatusOK, "", dest
+		if out == "" {
+			out = output.Name()
+		}
+		if err != nil {
+			status, errMsg, out = string(statusFailed), err.Error(), ""
+		}
+		e := newCatalogEntry(buildID, t.Open, out, status, errMsg)
+		e.InputPath, e.OutputPath = t.Path, dest
+		switch {
+		case c.UploadURL == "":
+		case err == nil && c.queued != nil:
+			c.queued.record(logger, e)
+			return
+		// Published to the transparency log once uploaded.
+		case err == nil, job.Stage == "tlog":
+			e.UploadStatus = catalog.UploadUploaded
+		case job.Stage == "upload":
+			e.UploadStatus = catalog.UploadFailed
+		}
+		c.record(logger, e)
+	}()
+	// Like the catalog, before the temporary output is removed.
+	defer func() {
+		if c.auditLog == nil || (err != nil && job.Stage != "upload" && job.Stage != "tlog") {
+			return
+		}
+		uploadErr := err
+		if job.Stage == "tlog" {
+			uploadErr = nil
+		}
+		e := audit.Event{BuildID: buildID, Input: t.Path}
+		e.InputDigest, _ = auditDigest(c.hash(), t.Open)
+		if err == nil && dest != "" {
+			e.OutputDigest, e.OutputSize = auditDigest(c.hash(), dest)
+			written := e
+			written.Action, written.Destination = audit.ActionWritten, dest
+			c.audit(logger, written)
+		} else {
+			e.OutputDigest, e.OutputSize = auditDigest(c.hash(), output.Name())
+		}
+		switch {
+		case c.UploadURL == "":
+		case err == nil && c.queued != nil:
+			c.queued.audit(logger, e, &receipt)
+		default:
+			c.audit(logger, uploadEvent(e, c.UploadURL, &receipt, uploadErr))
+		}
+	}()
+	if err := p.Run(ctx, job, output); err != nil {
+		return err
+	}
+	if dest == "" {
+		return nil
+	}
+	if err := c.setOwnership(output.Name()); err != nil {
+		return fmt.Errorf("failed to set ownership: %w", err)
+	}
+	if err := os.Rename(output.Name(), dest); err != nil {
+		return fmt.Errorf("failed to move output into place: %w", err)
+	}
+	level.Info(logger).Log("msg", "debug information extracted", "output", dest)
+	return nil
+}
+
+// waitForUploads waits for the queued uploads and returns the number of them that failed.
+func (c *nodeScanCmd) waitForUploads(logger log.Logger) int {
+	if c.uploads == nil {
+		return 0
+	}
+	level.Info(logger).Log("msg", "waiting for queued uploads")
+	if err := c.uploads.Close(); err != nil {
+		level.Error(logger).Log("msg", "queued uploads failed", "err", err)
+	}
+	c.uploads = nil
+	return c.queued.failed
+}
+
+// queuedUploads records the outcomes of the queued uploads in the catalog and the audit log. An
+// upload may be done before the entry or the event of its extraction is recorded, its outcome is
+// recorded with them then.
+type queuedUploads struct {
+	*catalogFlags
+	*auditFlags
+	uploadURL string
+
+	mu sync.Mutex
+	// pending are the build IDs recorded as queued.
+	pending map[string]bool
+	// results are the outcomes of the uploads done before their entries were recorded.
+	results map[string]error
+	// audits are the events of the queued uploads, auditResults the outcomes of the uploads done
+	// before their events were recorded.
+	audits       map[string]queuedAudit
+	auditResults map[string]error
+	failed       int
+}
+
+// queuedAudit is the event of a queued upload and the receipt the upload fills in.
+type queuedAudit struct {
+	event   audit.Event
+	receipt *upload.Receipt
+}
+
+// record records the entry of an extraction whose debug file is queued for upload.
+func (q *queuedUploads) record(logger log.Logger, e catalog.Entry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err, ok := q.results[e.BuildID]; ok {
+		delete(q.results, e.BuildID)
+		e.UploadStatus, e.Error = uploadStatus(err)
+	} else {
+		if q.pending == nil {
+			q.pending = map[string]bool{}
+		}
+		q.pending[e.BuildID] = true
+		e.UploadStatus = catalog.UploadQueued
+	}
+	q.catalogFlags.record(logger, e)
+}
+
+// audit records the event of an extraction whose debug file is queued for upload in the audit log,
+// once the upload is done.
+func (q *queuedUploads) audit(logger log.Logger, e audit.Event, receipt *upload.Receipt) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err, ok := q.auditResults[e.BuildID]; ok {
+		delete(q.auditResults, e.BuildID)
+		q.auditFlags.audit(logger, uploadEvent(e, q.uploadURL, receipt, err))
+		return
+	}
+	if q.audits == nil {
+		q.audits = map[string]queuedAudit{}
+	}
+	q.audits[e.BuildID] = queuedAudit{event: e, receipt: receipt}
+}
+
+// done logs the outcome of a queued upload and records it in the catalog and the audit log.
+func (q *queuedUploads) done(logger log.Logger, buildID string, err error) {
+	logger = log.With(logger, "build_id", buildID)
+	switch {
+	case err == nil:
+		level.Info(logger).Log("msg", "uploaded debug information")
+	case errors.Is(err, upload.ErrAlreadyUploaded):
+		level.Debug(logger).Log("msg", "debug information already uploaded")
+	default:
+		level.Error(logger).Log("msg", "failed to upload debug information", "err", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err != nil && !errors.Is(err, upload.ErrAlreadyUploaded) {
+		q.failed++
+	}
+	if q.auditLog != nil {
+		if a, ok := q.audits[buildID]; ok {
+			delete(q.audits, buildID)
+			q.auditFlags.audit(logger, uploadEvent(a.event, q.uploadURL, a.receipt, err))
+		} else {
+			if q.auditResults == nil {
+				q.auditResults = map[string]error{}
+			}
+			q.auditResults[buildID] = err
+		}
+	}
+	if q.db == nil {
+		return
+	}
+	if !q.pending[buildID] {
+		if q.results == nil {
+			q.results = map[string]error{}
+		}
+		q.results[buildID] = err
+		return
+	}
+	delete(q.pending, buildID)
+	status, errMsg := uploadStatus(err)
+	if err := q.db.SetUploadStatus(context.Background(), buildID, status, errMsg); err != nil {
+		level.Warn(logger).Log("msg", "failed to record upload in catalog", "err", err)
+	}
+}
+
+// uploadStatus returns the catalog status and error of the outcome of an upload.
+func uploadStatus(err error) (string, string) {
+	if err != nil && !errors.Is(err, upload.ErrAlreadyUploaded) {
+		return catalog.UploadFailed, err.Error()
+	}
+	return catalog.UploadUploaded, ""
+}
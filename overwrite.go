@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// overwriteFlags select what happens to the inputs whose output file exists. They fail by default,
+// so reruns do not silently replace the debug files of earlier ones.
+type overwriteFlags struct {
+	Force        bool `kong:"help='Overwrite existing output files.'"`
+	SkipExisting bool `kong:"help='Skip the inputs whose output file exists, e.g. to resume an interrupted batch.'"`
+	IfNewer      bool `kong:"help='Only extract the inputs whose output file exists again if they were modified after it or have another build ID, for incremental CI runs.'"`
+}
+
+// errSkipExisting is returned for the inputs skipped because of their existing output.
+var errSkipExisting = errors.New("output exists")
+
+func (f *overwriteFlags) validateOverwrite() error {
+	n := 0
+	for _, set := range []bool{f.Force, f.SkipExisting, f.IfNewer} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return usageError(errors.New("only one of --force, --skip-existing and --if-newer can be used"))
+	}
+	return nil
+}
+
+// checkOverwrite returns whether the output dest of the input may be written. It returns
+// errSkipExisting if the input is skipped, an error if it fails because dest exists.
+func (f *overwriteFlags) checkOverwrite(logger log.Logger, input, dest string) error {
+	fi, err := os.Stat(dest)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case f.Force:
+		return nil
+	case f.SkipExisting:
+		level.Info(logger).Log("msg", "skipping input whose output exists", "output", dest)
+		return errSkipExisting
+	case f.IfNewer:
+		if stale, reason := staleOutput(input, dest, fi); stale {
+			level.Debug(logger).Log("msg", "replacing stale output", "output", dest, "reason", reason)
+			return nil
+		}
+		level.Info(logger).Log("msg", "skipping input whose output is up to date", "output", dest)
+		return errSkipExisting
+	}
+	return fmt.Errorf("output %s exists, use --force to overwrite it, --skip-existing or --if-newer to skip the input", dest)
+}
+
+// staleOutput reports whether the existing output of the input is older than it, or is the debug
+// information of another build ID, and why. The build ID of the output is read from its metadata
+// sidecar if it is not an ELF file with a build ID note, it is not compared if it has neither.
+func staleOutput(input, dest string, out os.FileInfo) (bool, string) {
+	in, err := os.Stat(input)
+	if err != nil || in.ModTime().After(out.ModTime()) {
+		return true, "input is newer"
+	}
+	want, err := readBuildID(input)
+	if err != nil {
+		return false, ""
+	}
+	if got, err := outputBuildID(dest); err == nil && got != want {
+		return true, "build ID differs"
+	}
+	return false, ""
+}
+
+// outputBuildID returns the build ID of the output at dest.
+func outputBuildID(dest string) (string, error) {
+	if id, err := readBuildID(dest); err == nil {
+		return id, nil
+	}
+	data, err := ioutil.ReadFile(dest + ".json")
+	if err != nil {
+		return "", err
+	}
+	var meta metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", err
+	}
+	if meta.BuildID != "" {
+		return meta.BuildID, nil
+	}
+	if meta.GoBuildID != "" {
+		return meta.GoBuildID, nil
+	}
+	return "", errors.New("no build ID")
+}
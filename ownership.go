@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ownershipFlags set the owner and mode of the output files and of the directories created for
+// them, e.g. for the non-root consumers of the debug files written by a DaemonSet running as root.
+type ownershipFlags struct {
+	Chown string `kong:"placeholder='UID:GID',help='Change the owner of the output files, their sidecars and the directories created for them, e.g. 65534:65534 or nobody:nogroup. Either one can be omitted, e.g. :1000 only changes the group. Requires root, not supported on Windows.'"`
+	Chmod string `kong:"placeholder='MODE',help='Mode of the output files and their sidecars in octal, e.g. 0640, 0644 by default. The directories created for them get it with the execute bits of the classes that can read them.'"`
+
+	uid, gid int
+	mode     os.FileMode
+}
+
+// defaultFileMode is the mode of the output files unless --chmod is given.
+const defaultFileMode = 0o644
+
+func (f *ownershipFlags) parseOwnership() error {
+	f.uid, f.gid, f.mode = -1, -1, defaultFileMode
+	if f.Chmod != "" {
+		m, err := strconv.ParseUint(f.Chmod, 8, 32)
+		if err != nil || m > 0o777 {
+			return usageError(fmt.Errorf("invalid --chmod %q, must be an octal mode, e.g. 0644", f.Chmod))
+		}
+		f.mode = os.FileMode(m)
+	}
+	if f.Chown == "" {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return usageError(errors.New("--chown is not supported on Windows"))
+	}
+	owner, group, _ := strings.Cut(f.Chown, ":")
+	if owner == "" && group == "" {
+		return usageError(fmt.Errorf("invalid --chown %q, must be UID:GID", f.Chown))
+	}
+	var err error
+	if owner != "" {
+		if f.uid, err = lookupID(owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		}); err != nil {
+			return usageError(fmt.Errorf("invalid --chown user: %w", err))
+		}
+	}
+	if group != "" {
+		if f.gid, err = lookupID(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		}); err != nil {
+			return usageError(fmt.Errorf("invalid --chown group: %w", err))
+		}
+	}
+	return nil
+}
+
+// lookupID returns the numeric ID of s, or of the user or group s names.
+func lookupID(s string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil && id >= 0 {
+		return id, nil
+	}
+	id, err := lookup(s)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// setOwnership sets the mode and owner of the output file at path.
+func (f *ownershipFlags) setOwnership(path string) error {
+	return f.apply(path, f.mode)
+}
+
+// dirMode returns the mode of the created directories: the file mode with the execute bit of each
+// class that can read.
+func (f *ownershipFlags) dirMode() os.FileMode {
+	return f.mode | (f.mode&0o444)>>2
+}
+
+func (f *ownershipFlags) apply(path string, mode os.FileMode) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if f.uid == -1 && f.gid == -1 {
+		return nil
+	}
+	return os.Lchown(path, f.uid, f.gid)
+}
+
+// mkdirAll creates the directory at path and its missing parents, with the mode and owner of the
+// created directories. Existing directories are left as they are.
+func (f *ownershipFlags) mkdirAll(path string) error {
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := f.apply(missing[i], f.dirMode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/polarsignals/split-debug/pkg/archive"
+)
+
+// Archive formats to pack the debug information with its metadata into.
+const (
+	packNone   = "none"
+	packTarZst = string(archive.TarZst)
+	packTarXz  = string(archive.TarXz)
+)
+
+// pack writes the debug file and its metadata as a compressed tarball to w.
+// The debug file is stored as name, the metadata next to it as name.json.
+func pack(w io.Writer, format, name, debugFile string, meta *metadata) error {
+	switch format {
+	case packTarZst, packTarXz:
+	default:
+		return fmt.Errorf("unknown archive format %q", format)
+	}
+	data, err := meta.marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	aw, err := archive.NewWriter(w, archive.Format(format))
+	if err != nil {
+		return err
+	}
+	if err := aw.AddFile(name, 0o644, debugFile); err != nil {
+		aw.Close()
+		return err
+	}
+	if err := aw.Add(name+".json", 0o644, int64(len(data)), bytes.NewReader(data)); err != nil {
+		aw.Close()
+		return err
+	}
+	return aw.Close()
+}
@@ -0,0 +1,240 @@
+// Package archive reads the members of CI artifact bundles, e.g. .tar.gz or .zip files,
+// and writes archives of the same format.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/sourcedate"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format is an archive format.
+type Format string
+
+// Supported archive formats.
+const (
+	Tar    Format = "tar"
+	TarGz  Format = "tar.gz"
+	TarZst Format = "tar.zst"
+	TarXz  Format = "tar.xz"
+	Zip    Format = "zip"
+)
+
+var extensions = []struct {
+	ext    string
+	format Format
+}{
+	{".tar.gz", TarGz},
+	{".tgz", TarGz},
+	{".tar.zst", TarZst},
+	{".tar.xz", TarXz},
+	{".tar", Tar},
+	{".zip", Zip},
+}
+
+// Detect returns the format of the archive at path by its extension.
+// It returns false if the path is not an archive.
+func Detect(path string) (Format, string, bool) {
+	lower := strings.ToLower(path)
+	for _, e := range extensions {
+		if strings.HasSuffix(lower, e.ext) {
+			return e.format, path[:len(path)-len(e.ext)], true
+		}
+	}
+	return "", "", false
+}
+
+// Member is a regular file of an archive.
+type Member struct {
+	Name string
+	Mode os.FileMode
+	Size int64
+	io.Reader
+}
+
+// Walk calls fn for each regular file of the archive at path in the order of the archive.
+// The members are streamed, a member can only be read until fn returns.
+func Walk(path string, format Format, fn func(m *Member) error) error {
+	if format == Zip {
+		return walkZip(path, fn)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return WalkReader(f, format, fn)
+}
+
+// WalkReader calls fn for each regular file of the tarball read from r, like Walk.
+// Zip archives need random access and are not supported.
+func WalkReader(r io.Reader, format Format, fn func(m *Member) error) error {
+	switch format {
+	case Tar:
+	case TarGz:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case TarZst:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	case TarXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return err
+		}
+		r = xr
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(&Member{Name: hdr.Name, Mode: hdr.FileInfo().Mode(), Size: hdr.Size, Reader: tr}); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(path string, fn func(m *Member) error) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(&Member{Name: zf.Name, Mode: zf.Mode(), Size: int64(zf.UncompressedSize64), Reader: rc})
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writer writes an archive.
+type Writer struct {
+	tw *tar.Writer
+	zw *zip.Writer
+	cw io.WriteCloser
+}
+
+// NewWriter returns a writer of an archive of the given format to w.
+func NewWriter(w io.Writer, format Format) (*Writer, error) {
+	if format == Zip {
+		return &Writer{zw: zip.NewWriter(w)}, nil
+	}
+
+	var (
+		cw  io.WriteCloser
+		err error
+	)
+	switch format {
+	case Tar:
+	case TarGz:
+		cw = gzip.NewWriter(w)
+	case TarZst:
+		cw, err = zstd.NewWriter(w)
+	case TarXz:
+		cw, err = xz.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize compression: %w", err)
+	}
+	if cw != nil {
+		w = cw
+	}
+	return &Writer{tw: tar.NewWriter(w), cw: cw}, nil
+}
+
+// Add adds a member of the given size read from r.
+func (w *Writer) Add(name string, mode os.FileMode, size int64, r io.Reader) error {
+	if w.zw != nil {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: sourcedate.Now()}
+		hdr.SetMode(mode)
+		fw, err := w.zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, r)
+		return err
+	}
+
+	if err := w.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    int64(mode.Perm()),
+		Size:    size,
+		ModTime: sourcedate.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+// AddFile adds the file at path as a member with the given mode.
+func (w *Writer) AddFile(name string, mode os.FileMode, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return w.Add(name, mode, fi.Size(), f)
+}
+
+// Close finishes the archive, it does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if w.cw != nil {
+		return w.cw.Close()
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/sourcedate"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	for path, want := range map[string]Format{
+		"artifacts.tar.gz":  TarGz,
+		"artifacts.TGZ":     TarGz,
+		"artifacts.tar.zst": TarZst,
+		"artifacts.tar.xz":  TarXz,
+		"artifacts.tar":     Tar,
+		"artifacts.zip":     Zip,
+	} {
+		format, base, ok := Detect(path)
+		require.True(t, ok, path)
+		require.Equal(t, want, format, path)
+		require.Equal(t, "artifacts", base, path)
+	}
+	_, _, ok := Detect("app")
+	require.False(t, ok)
+}
+
+func TestRoundTrip(t *testing.T) {
+	members := map[string]string{
+		"bin/app":     "\x7fELF app",
+		"README.md":   "readme",
+		"lib/lib.so":  "\x7fELF lib",
+		"empty.txt":   "",
+		"docs/a/b.md": strings.Repeat("b", 1<<16),
+	}
+	names := []string{"bin/app", "README.md", "lib/lib.so", "empty.txt", "docs/a/b.md"}
+
+	for _, format := range []Format{Tar, TarGz, TarZst, TarXz, Zip} {
+		t.Run(string(format), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "artifacts."+string(format))
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, format)
+			require.NoError(t, err)
+			for _, name := range names {
+				data := members[name]
+				require.NoError(t, w.Add(name, 0o755, int64(len(data)), strings.NewReader(data)))
+			}
+			require.NoError(t, w.Close())
+			require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0o644))
+
+			var got []string
+			require.NoError(t, Walk(path, format, func(m *Member) error {
+				data, err := ioutil.ReadAll(m)
+				require.NoError(t, err)
+				require.Equal(t, members[m.Name], string(data), m.Name)
+				require.Equal(t, int64(len(data)), m.Size)
+				require.Equal(t, os.FileMode(0o755), m.Mode.Perm())
+				got = append(got, m.Name)
+				return nil
+			}))
+			require.Equal(t, names, got)
+		})
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Setenv(sourcedate.EnvVar, "1700000000")
+	write := func(format Format) []byte {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format)
+		require.NoError(t, err)
+		require.NoError(t, w.Add("app.debug", 0o644, 5, strings.NewReader("debug")))
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	formats := []Format{Tar, TarGz, TarZst, TarXz, Zip}
+	first := map[Format][]byte{}
+	for _, format := range formats {
+		first[format] = write(format)
+	}
+	// Timestamps of tar headers have a resolution of seconds, the ones of zip of two seconds.
+	time.Sleep(2 * time.Second)
+	for _, format := range formats {
+		require.Equal(t, first[format], write(format), format)
+	}
+
+	hdr, err := tar.NewReader(bytes.NewReader(write(Tar))).Next()
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1700000000, 0), hdr.ModTime)
+}
@@ -0,0 +1,114 @@
+// Package audit appends a record of each debug file written or uploaded by split-debug to a JSON
+// lines file, so compliance teams can track where the debug information, and the symbol names and
+// source paths it holds, went.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Action is what happened to a debug file.
+type Action string
+
+// Actions of the events.
+const (
+	// ActionWritten is a debug file written to a file, or to stdout.
+	ActionWritten Action = "written"
+	// ActionUploaded is a debug file uploaded.
+	ActionUploaded Action = "uploaded"
+	// ActionUploadSkipped is a debug file not uploaded because the server has it already.
+	ActionUploadSkipped Action = "upload_skipped"
+	// ActionUploadFailed is a debug file whose upload failed, parts of it may have been sent.
+	ActionUploadFailed Action = "upload_failed"
+)
+
+// Event is a line of the audit log. Digests are prefixed with their hash algorithm, e.g.
+// sha256:9f86d0….
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+	// User and Host are the user running split-debug and the host it runs on.
+	User string `json:"user"`
+	Host string `json:"host"`
+	// Command is the split-debug command, e.g. extract or node-scan.
+	Command string `json:"command"`
+
+	BuildID     string `json:"build_id,omitempty"`
+	Input       string `json:"input,omitempty"`
+	InputDigest string `json:"input_digest,omitempty"`
+	// Destination is the path the debug file was written to, - for stdout, or the URL it was
+	// uploaded to.
+	Destination  string `json:"destination"`
+	OutputDigest string `json:"output_digest,omitempty"`
+	OutputSize   int64  `json:"output_size,omitempty"`
+	// ResponseID identifies the upload on the server, from the response to it.
+	ResponseID string `json:"response_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Log is an append-only audit log, it is safe for concurrent use.
+type Log struct {
+	command string
+	user    string
+	host    string
+	now     func() time.Time
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Open opens the audit log at path, creating it if it does not exist, to append the events of the
+// command to. The log is never truncated.
+func Open(path, command string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &Log{command: command, user: currentUser(), host: host, now: time.Now, f: f}, nil
+}
+
+// currentUser returns the name of the user running the process, or its ID if it has no name,
+// e.g. in containers without an /etc/passwd entry for it.
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return strconv.Itoa(os.Getuid())
+}
+
+// Write appends the event, with the time, user, host and command set, and syncs it to disk. Each
+// event is written with a single write, so concurrent writers to the same file do not interleave.
+func (l *Log) Write(e Event) error {
+	e.Time = l.now().UTC()
+	e.User, e.Host, e.Command = l.user, l.host, l.command
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readEvents(t *testing.T, path string) []Event {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var events []Event
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(s.Bytes(), &e))
+		events = append(events, e)
+	}
+	require.NoError(t, s.Err())
+	return events
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	l, err := Open(path, "extract")
+	require.NoError(t, err)
+	l.now = func() time.Time { return now }
+	require.NoError(t, l.Write(Event{Action: ActionWritten, BuildID: "abc", Input: "app", Destination: "app.debug", OutputDigest: "sha256:00"}))
+	require.NoError(t, l.Close())
+
+	// Reopening appends.
+	l, err = Open(path, "node-scan")
+	require.NoError(t, err)
+	l.now = func() time.Time { return now }
+	require.NoError(t, l.Write(Event{Action: ActionUploaded, BuildID: "abc", Destination: "https://symbols.example.com/abc", ResponseID: "r1"}))
+	require.NoError(t, l.Close())
+
+	events := readEvents(t, path)
+	require.Len(t, events, 2)
+	require.Equal(t, ActionWritten, events[0].Action)
+	require.Equal(t, "extract", events[0].Command)
+	require.Equal(t, "app.debug", events[0].Destination)
+	require.True(t, now.Equal(events[0].Time))
+	require.NotEmpty(t, events[0].User)
+	require.NotEmpty(t, events[0].Host)
+	require.Equal(t, ActionUploaded, events[1].Action)
+	require.Equal(t, "node-scan", events[1].Command)
+	require.Equal(t, "r1", events[1].ResponseID)
+}
@@ -0,0 +1,251 @@
+// Package auth configures the mutual TLS and the bearer token authentication of the servers and
+// the clients. The certificates, keys and tokens are read from files that are read again once
+// they change, so rotated credentials, e.g. of a mounted Kubernetes secret, are picked up
+// without a restart.
+package auth
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// file is the contents of a file, read again once its modification time or size changed.
+type file struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// read returns the contents of the file and whether they changed since the last read.
+func (f *file) read() ([]byte, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return nil, false, err
+	}
+	if f.data != nil && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return f.data, false, nil
+	}
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, false, err
+	}
+	changed := !bytes.Equal(data, f.data)
+	f.data, f.modTime, f.size = data, fi.ModTime(), fi.Size()
+	return data, changed, nil
+}
+
+// TokenFile is a bearer token read from a file.
+type TokenFile struct {
+	f file
+}
+
+// NewTokenFile returns the token of the file at path, it fails if the file cannot be read or is empty.
+func NewTokenFile(path string) (*TokenFile, error) {
+	t := &TokenFile{f: file{path: path}}
+	if _, err := t.Token(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Token returns the token, the contents of the file without surrounding whitespace.
+func (t *TokenFile) Token() (string, error) {
+	data, _, err := t.f.read()
+	if err != nil {
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+	token := string(bytes.TrimSpace(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", t.f.path)
+	}
+	return token, nil
+}
+
+// keyPair is a certificate and its key, loaded again once either file changed.
+type keyPair struct {
+	cert, key file
+
+	mu   sync.Mutex
+	pair *tls.Certificate
+}
+
+func (k *keyPair) load() (*tls.Certificate, error) {
+	cert, certChanged, err := k.cert.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	key, keyChanged, err := k.key.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.pair != nil && !certChanged && !keyChanged {
+		return k.pair, nil
+	}
+	pair, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		// The certificate and the key are not replaced at once, the old pair is used in between.
+		if k.pair != nil {
+			return k.pair, nil
+		}
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	k.pair = &pair
+	return k.pair, nil
+}
+
+// certPool is a pool of CA certificates, loaded again once the file changed.
+type certPool struct {
+	f file
+
+	mu   sync.Mutex
+	pool *x509.CertPool
+}
+
+func (c *certPool) load() (*x509.CertPool, error) {
+	data, changed, err := c.f.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pool != nil && !changed {
+		return c.pool, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		if c.pool != nil {
+			return c.pool, nil
+		}
+		return nil, fmt.Errorf("no CA certificates in %s", c.f.path)
+	}
+	c.pool = pool
+	return pool, nil
+}
+
+// ServerTLS returns the TLS configuration of a server with the certificate and key files. With
+// a client CA file, clients must present a certificate signed by one of its CAs.
+func ServerTLS(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("a certificate and a key are required")
+	}
+	pair := &keyPair{cert: file{path: certFile}, key: file{path: keyFile}}
+	if _, err := pair.load(); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return pair.load()
+		},
+	}
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+	cas := &certPool{f: file{path: clientCAFile}}
+	if _, err := cas.load(); err != nil {
+		return nil, err
+	}
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool, err := cas.load()
+		if err != nil {
+			return nil, err
+		}
+		c := cfg.Clone()
+		c.GetConfigForClient = nil
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.ClientCAs = pool
+		return c, nil
+	}
+	return cfg, nil
+}
+
+// ClientTLS returns the TLS configuration of a client. With a CA file, the server certificates
+// are verified with its CAs rather than the system ones. With a certificate and key file, the
+// client presents the certificate to servers that ask for one.
+func ClientTLS(caFile, certFile, keyFile string) (*tls.Config, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("a client certificate requires a key and the other way around")
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		pair := &keyPair{cert: file{path: certFile}, key: file{path: keyFile}}
+		if _, err := pair.load(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return pair.load()
+		}
+	}
+	if caFile == "" {
+		return cfg, nil
+	}
+	cas := &certPool{f: file{path: caFile}}
+	if _, err := cas.load(); err != nil {
+		return nil, err
+	}
+	// The CAs may change after the configuration is in use, so the server certificates are
+	// verified by VerifyConnection with the current ones rather than with RootCAs.
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		pool, err := cas.load()
+		if err != nil {
+			return err
+		}
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server presented no certificate")
+		}
+		opts := x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         pool,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err = cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return cfg, nil
+}
+
+// BearerTransport sets the Authorization header of the requests to the token of the file.
+type BearerTransport struct {
+	Token *TokenFile
+	// Base sends the requests, http.DefaultTransport if nil.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *BearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Token.Token()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	// Round trippers must not modify the request.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// issuer is a CA issuing the certificates of the tests.
+type issuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newIssuer(t *testing.T, name string) *issuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &issuer{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate for 127.0.0.1 and its key, PEM encoded.
+func (i *issuer) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, i.cert, &key.PublicKey, i.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// write writes the files and sets their modification time to mtime, so rewrites within the
+// resolution of the file system are noticed.
+func write(t *testing.T, mtime time.Time, files map[string][]byte) {
+	t.Helper()
+	for path, data := range files {
+		require.NoError(t, ioutil.WriteFile(path, data, 0o600))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	ca, otherCA := newIssuer(t, "ca"), newIssuer(t, "other")
+	serverCert, serverKey := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	now := time.Now()
+	write(t, now, map[string][]byte{
+		path("ca.pem"):         ca.pem,
+		path("server.pem"):     serverCert,
+		path("server-key.pem"): serverKey,
+		path("client.pem"):     clientCert,
+		path("client-key.pem"): clientKey,
+		path("token"):          []byte("secret\n"),
+	})
+
+	serverConfig, err := ServerTLS(path("server.pem"), path("server-key.pem"), path("ca.pem"))
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = serverConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	token, err := NewTokenFile(path("token"))
+	require.NoError(t, err)
+	client := func(caFile, certFile, keyFile string) *http.Client {
+		t.Helper()
+		cfg, err := ClientTLS(caFile, certFile, keyFile)
+		require.NoError(t, err)
+		return &http.Client{Transport: &BearerTransport{Token: token, Base: &http.Transport{TLSClientConfig: cfg}}}
+	}
+	get := func(c *http.Client) (int, string, error) {
+		t.Helper()
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body), nil
+	}
+
+	code, body, err := get(client(path("ca.pem"), path("client.pem"), path("client-key.pem")))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "client", body)
+
+	// Clients without a certificate are rejected, so are servers of other CAs.
+	_, _, err = get(client(path("ca.pem"), "", ""))
+	require.Error(t, err)
+	write(t, now, map[string][]byte{path("other.pem"): otherCA.pem})
+	_, _, err = get(client(path("other.pem"), path("client.pem"), path("client-key.pem")))
+	require.Error(t, err)
+
+	// Rotated certificates and tokens are picked up by the next connection.
+	clientCert, clientKey = otherCA.issue(t, "rotated", x509.ExtKeyUsageClientAuth)
+	later := now.Add(time.Minute)
+	write(t, later, map[string][]byte{
+		path("ca.pem"):         append(append([]byte{}, ca.pem...), otherCA.pem...),
+		path("client.pem"):     clientCert,
+		path("client-key.pem"): clientKey,
+		path("token"):          []byte("rotated"),
+	})
+	c := client(path("ca.pem"), path("client.pem"), path("client-key.pem"))
+	code, _, err = get(c)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, code)
+	write(t, later.Add(time.Minute), map[string][]byte{path("token"): []byte("secret")})
+	c.Transport.(*BearerTransport).Base.(*http.Transport).CloseIdleConnections()
+	code, body, err = get(c)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "rotated", body)
+}
+
+func TestTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	_, err := NewTokenFile(path)
+	require.Error(t, err)
+	write(t, time.Now(), map[string][]byte{path: []byte(" \n")})
+	_, err = NewTokenFile(path)
+	require.Error(t, err)
+}
+
+func TestClientTLS_Invalid(t *testing.T) {
+	_, err := ClientTLS("", "client.pem", "")
+	require.Error(t, err)
+	_, err = ServerTLS("", "", "")
+	require.Error(t, err)
+}
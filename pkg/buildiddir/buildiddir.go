@@ -0,0 +1,197 @@
+// Package buildiddir maintains the .build-id directory of a directory of debug files: the links
+// GDB and debuginfod look debug files up by, e.g. .build-id/ab/cdef.debug for the build ID abcdef.
+// Links are relative, so the directory can be moved or mounted elsewhere.
+package buildiddir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// Name is the name of the directory of the build ID links of a debug directory.
+const Name = ".build-id"
+
+// ErrNoBuildIDs is returned when none of the files has a GNU build ID to index it by.
+var ErrNoBuildIDs = errors.New("no debug files with a GNU build ID")
+
+// Options configure Index.
+type Options struct {
+	// Prune removes the links whose debug file is gone.
+	Prune bool
+	// DryRun only logs the links that would be created, repaired or removed.
+	DryRun bool
+}
+
+// Result counts what Index did.
+type Result struct {
+	// BuildIDs is the number of distinct build IDs indexed.
+	BuildIDs int
+	// Skipped is the number of files without a GNU build ID.
+	Skipped int
+
+	Created, Repaired, Removed, Unchanged, Failed int
+}
+
+// indexer maintains the build ID links of a debug directory.
+type indexer struct {
+	logger log.Logger
+	dryRun bool
+	// linked are the links pointing to a debug file, after the run.
+	linked map[string]bool
+
+	res Result
+}
+
+// Index links the given debug files of dir by their build IDs, creating the missing links of the
+// .build-id directory and repairing the ones that are dangling or point to another file. Files
+// below the .build-id directory are ignored. It fails with ErrNoBuildIDs if no file has a build ID,
+// e.g. when the files lack their build ID note.
+func Index(logger log.Logger, dir string, files []string, opts Options) (Result, error) {
+	root := filepath.Join(dir, Name)
+	ix := &indexer{logger: logger, dryRun: opts.DryRun, linked: map[string]bool{}}
+	byID := map[string][]string{}
+	for _, path := range files {
+		if strings.HasPrefix(path, root+string(filepath.Separator)) {
+			continue
+		}
+		id, err := gnuBuildID(path)
+		if err != nil {
+			level.Warn(logger).Log("msg", "skipping file without build ID", "file", path, "err", err)
+			ix.res.Skipped++
+			continue
+		}
+		byID[id] = append(byID[id], path)
+	}
+
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	ix.res.BuildIDs = len(ids)
+
+	for _, id := range ids {
+		paths := byID[id]
+		if len(paths) > 1 {
+			level.Debug(logger).Log("msg", "debug files share a build ID", "build_id", id, "files", strings.Join(paths, ","))
+		}
+		link := filepath.Join(root, id[:2], id[2:]+".debug")
+		if err := ix.link(link, id, paths); err != nil {
+			level.Warn(logger).Log("msg", "failed to link debug file", "build_id", id, "link", link, "err", err)
+			ix.res.Failed++
+		}
+	}
+	if opts.Prune {
+		if err := ix.prune(root); err != nil {
+			return ix.res, fmt.Errorf("failed to prune %s: %w", root, err)
+		}
+	}
+
+	if len(ids) == 0 {
+		return ix.res, fmt.Errorf("%w in %s, %d files skipped", ErrNoBuildIDs, dir, ix.res.Skipped)
+	}
+	if ix.res.Failed > 0 {
+		return ix.res, fmt.Errorf("failed to link %d of %d build IDs", ix.res.Failed, len(ids))
+	}
+	return ix.res, nil
+}
+
+// link points the build ID link to the first of the debug files with that build ID,
+// unless it already resolves to a file with the same build ID.
+func (ix *indexer) link(link, id string, paths []string) error {
+	target, err := filepath.Rel(filepath.Dir(link), paths[0])
+	if err != nil {
+		return err
+	}
+	logger := log.With(ix.logger, "link", link, "target", target)
+
+	fi, err := os.Lstat(link)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		level.Info(logger).Log("msg", "creating link")
+		ix.res.Created++
+		ix.linked[link] = true
+		if ix.dryRun {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+			return err
+		}
+		return os.Symlink(target, link)
+	case err != nil:
+		return err
+	}
+
+	if current, err := gnuBuildID(link); err == nil && current == id {
+		ix.res.Unchanged++
+		ix.linked[link] = true
+		return nil
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return errors.New("not a symlink, refusing to replace it")
+	}
+	level.Info(logger).Log("msg", "repairing link")
+	ix.res.Repaired++
+	ix.linked[link] = true
+	if ix.dryRun {
+		return nil
+	}
+	if err := os.Remove(link); err != nil {
+		return err
+	}
+	return os.Symlink(target, link)
+}
+
+// prune removes the dangling links of the .build-id directory, and the directories they leave empty.
+func (ix *indexer) prune(root string) error {
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 || ix.linked[path] {
+			return err
+		}
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		level.Info(ix.logger).Log("msg", "removing dangling link", "link", path)
+		ix.res.Removed++
+		if ix.dryRun {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		// Fails unless the directory is empty.
+		os.Remove(filepath.Dir(path))
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// gnuBuildID returns the GNU build ID of the ELF file at path, the key of the .build-id directory.
+func gnuBuildID(path string) (string, error) {
+	f, err := elfutils.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	id, err := elfutils.BuildID(f)
+	if err != nil {
+		return "", err
+	}
+	if len(id) < 3 {
+		return "", fmt.Errorf("build ID %q is too short", id)
+	}
+	return id, nil
+}
@@ -0,0 +1,68 @@
+package buildiddir
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// extractC compiles a C program with a GNU build ID and extracts its debug information to dir the
+// way the extract command does by default. It returns the path of the debug file and its build ID.
+func extractC(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	bin := elfwritertest.BuildC(t, "int main(void) { return 0; }\n", "-g", "-Wl,--build-id")
+
+	out := filepath.Join(dir, "prog.debug")
+	w, err := os.Create(out)
+	require.NoError(t, err)
+	defer w.Close()
+	p := pipeline.New(pipeline.WithFilters(pipeline.DebugSections()), pipeline.WithTransformers(pipeline.LinkedSections()))
+	j := &pipeline.Job{Path: bin, Output: out}
+	defer j.Close()
+	require.NoError(t, p.Run(context.Background(), j, w))
+	return out, j.BuildID
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	debug, id := extractC(t, dir)
+	notes := filepath.Join(dir, "README")
+	require.NoError(t, ioutil.WriteFile(notes, []byte("not a debug file\n"), 0o644))
+	files := []string{notes, debug}
+
+	res, err := Index(log.NewNopLogger(), dir, files, Options{})
+	require.NoError(t, err)
+	require.Equal(t, Result{BuildIDs: 1, Skipped: 1, Created: 1}, res)
+
+	link := filepath.Join(dir, Name, id[:2], id[2:]+".debug")
+	target, err := os.Readlink(link)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("..", "..", "prog.debug"), target)
+	f, err := elfutils.Open(link)
+	require.NoError(t, err)
+	defer f.Close()
+	got, err := elfutils.BuildID(f)
+	require.NoError(t, err)
+	require.Equal(t, id, got)
+
+	res, err = Index(log.NewNopLogger(), dir, files, Options{})
+	require.NoError(t, err)
+	require.Equal(t, Result{BuildIDs: 1, Skipped: 1, Unchanged: 1}, res)
+
+	// Once the debug file is gone, its link is pruned, and there is nothing left to index.
+	require.NoError(t, os.Remove(debug))
+	res, err = Index(log.NewNopLogger(), dir, []string{notes}, Options{Prune: true})
+	require.ErrorIs(t, err, ErrNoBuildIDs)
+	require.Equal(t, Result{Skipped: 1, Removed: 1}, res)
+	_, err = os.Lstat(link)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
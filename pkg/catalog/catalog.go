@@ -0,0 +1,180 @@
+// Package catalog records the object files processed by split-debug in a SQLite database, keyed by
+// build ID, so runs can skip the binaries an earlier run extracted and the history can be queried,
+// e.g. with sqlite3 state.db 'SELECT input_path FROM files WHERE status = "failed"'.
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	// The pure Go SQLite driver, so the static builds without cgo open catalogs too.
+	_ "modernc.org/sqlite"
+)
+
+// Statuses of the uploads of entries.
+const (
+	UploadNone     = ""
+	UploadQueued   = "queued"
+	UploadUploaded = "uploaded"
+	UploadFailed   = "failed"
+)
+
+// StatusOK is the status of entries whose debug information was extracted.
+const StatusOK = "ok"
+
+// schemaVersion is stored as the user_version of the database, it is bumped by migrations.
+const schemaVersion = 1
+
+const schema = `
+CREATE TABLE IF NOT EXISTS files (
+	build_id      TEXT NOT NULL,
+	input_path    TEXT NOT NULL,
+	output_path   TEXT NOT NULL DEFAULT '',
+	input_size    INTEGER NOT NULL DEFAULT 0,
+	output_size   INTEGER NOT NULL DEFAULT 0,
+	input_sha256  TEXT NOT NULL DEFAULT '',
+	output_sha256 TEXT NOT NULL DEFAULT '',
+	status        TEXT NOT NULL,
+	upload_status TEXT NOT NULL DEFAULT '',
+	error         TEXT NOT NULL DEFAULT '',
+	processed_at  TEXT NOT NULL,
+	PRIMARY KEY (build_id, input_path)
+);
+CREATE INDEX IF NOT EXISTS files_status ON files (build_id, status);
+`
+
+// Entry is the outcome of processing an object file.
+type Entry struct {
+	BuildID    string
+	InputPath  string
+	OutputPath string
+	InputSize  int64
+	OutputSize int64
+	// InputSHA256 and OutputSHA256 are the hex encoded digests of the object file and its debug file.
+	InputSHA256  string
+	OutputSHA256 string
+	// Status is the status of the extraction, StatusOK or the one of the summary, e.g. failed.
+	Status       string
+	UploadStatus string
+	Error        string
+	ProcessedAt  time.Time
+}
+
+// Catalog is a catalog of processed object files, it is safe for concurrent use.
+type Catalog struct {
+	db *sql.DB
+}
+
+// Open opens the catalog at path, creating it if it does not exist.
+func Open(path string) (*Catalog, error) {
+	// Concurrent runs sharing a catalog wait for each other's writes rather than failing.
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize catalog %s: %w", path, err)
+	}
+	return &Catalog{db: db}, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		return fmt.Errorf("schema version %d is newer than the supported %d", version, schemaVersion)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	_, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
+	return err
+}
+
+// Record records the entry, replacing the one of the same build ID and input path.
+func (c *Catalog) Record(ctx context.Context, e Entry) error {
+	if e.ProcessedAt.IsZero() {
+		e.ProcessedAt = time.Now()
+	}
+	_, err := c.db.ExecContext(ctx, `
+INSERT OR REPLACE INTO files (
+	build_id, input_path, output_path, input_size, output_size, input_sha256, output_sha256,
+	status, upload_status, error, processed_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.BuildID, e.InputPath, e.OutputPath, e.InputSize, e.OutputSize, e.InputSHA256, e.OutputSHA256,
+		e.Status, e.UploadStatus, e.Error, e.ProcessedAt.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record %s: %w", e.InputPath, err)
+	}
+	return nil
+}
+
+// SetUploadStatus sets the upload status of the entries of the build ID whose upload is queued,
+// once it is done.
+func (c *Catalog) SetUploadStatus(ctx context.Context, buildID, status, errMsg string) error {
+	_, err := c.db.ExecContext(ctx,
+		"UPDATE files SET upload_status = ?, error = ? WHERE build_id = ? AND upload_status = ?",
+		status, errMsg, buildID, UploadQueued,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record upload of %s: %w", buildID, err)
+	}
+	return nil
+}
+
+// Extracted returns the input path of an entry of the build ID whose debug information was
+// extracted, or an empty string if there is none.
+func (c *Catalog) Extracted(ctx context.Context, buildID string) (string, error) {
+	var path string
+	err := c.db.QueryRowContext(ctx,
+		"SELECT input_path FROM files WHERE build_id = ? AND status = ? ORDER BY processed_at LIMIT 1",
+		buildID, StatusOK,
+	).Scan(&path)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return path, err
+}
+
+// Entries returns the entries of the build ID, the oldest first.
+func (c *Catalog) Entries(ctx context.Context, buildID string) ([]Entry, error) {
+	rows, err := c.db.QueryContext(ctx, `
+SELECT build_id, input_path, output_path, input_size, output_size, input_sha256, output_sha256,
+	status, upload_status, error, processed_at
+FROM files WHERE build_id = ? ORDER BY processed_at, input_path`, buildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var (
+			e           Entry
+			processedAt string
+		)
+		if err := rows.Scan(
+			&e.BuildID, &e.InputPath, &e.OutputPath, &e.InputSize, &e.OutputSize, &e.InputSHA256, &e.OutputSHA256,
+			&e.Status, &e.UploadStatus, &e.Error, &processedAt,
+		); err != nil {
+			return nil, err
+		}
+		if e.ProcessedAt, err = time.Parse(time.RFC3339, processedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Close closes the database.
+func (c *Catalog) Close() error {
+	return c.db.Close()
+}
@@ -0,0 +1,96 @@
+package catalog
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalog(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	c, err := Open(path)
+	require.NoError(t, err)
+
+	// Concurrent runs wait for each other's writes.
+	var mode string
+	var timeout int
+	require.NoError(t, c.db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	require.NoError(t, c.db.QueryRow("PRAGMA busy_timeout").Scan(&timeout))
+	require.Equal(t, "wal", mode)
+	require.Equal(t, 5000, timeout)
+
+	at := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	failed := Entry{BuildID: "abcd", InputPath: "bin/app", Status: "failed", Error: "no space left", ProcessedAt: at}
+	require.NoError(t, c.Record(ctx, failed))
+	first, err := c.Extracted(ctx, "abcd")
+	require.NoError(t, err)
+	require.Empty(t, first)
+
+	ok := Entry{
+		BuildID:      "abcd",
+		InputPath:    "bin/app",
+		OutputPath:   "bin/app.debug",
+		InputSize:    4096,
+		OutputSize:   1024,
+		InputSHA256:  "01",
+		OutputSHA256: "02",
+		Status:       StatusOK,
+		UploadStatus: UploadUploaded,
+		ProcessedAt:  at.Add(time.Minute),
+	}
+	require.NoError(t, c.Record(ctx, ok))
+	copied := Entry{BuildID: "abcd", InputPath: "copy/app", Status: StatusOK, ProcessedAt: at.Add(time.Hour)}
+	require.NoError(t, c.Record(ctx, copied))
+	require.NoError(t, c.Close())
+
+	// The catalog persists across runs.
+	c, err = Open(path)
+	require.NoError(t, err)
+	defer c.Close()
+	first, err = c.Extracted(ctx, "abcd")
+	require.NoError(t, err)
+	require.Equal(t, "bin/app", first)
+	first, err = c.Extracted(ctx, "ef01")
+	require.NoError(t, err)
+	require.Empty(t, first)
+
+	entries, err := c.Entries(ctx, "abcd")
+	require.NoError(t, err)
+	require.Equal(t, []Entry{ok, copied}, entries)
+}
+
+func TestOpen_NewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	c, err := Open(path)
+	require.NoError(t, err)
+	_, err = c.db.Exec("PRAGMA user_version = 99")
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	_, err = Open(path)
+	require.Error(t, err)
+}
+
+func TestCatalog_SetUploadStatus(t *testing.T) {
+	ctx := context.Background()
+	c, err := Open(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer c.Close()
+
+	at := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	queued := Entry{BuildID: "abcd", InputPath: "bin/app", Status: StatusOK, UploadStatus: UploadQueued, ProcessedAt: at}
+	uploaded := Entry{BuildID: "abcd", InputPath: "bin/copy", Status: StatusOK, UploadStatus: UploadUploaded, ProcessedAt: at.Add(time.Minute)}
+	require.NoError(t, c.Record(ctx, queued))
+	require.NoError(t, c.Record(ctx, uploaded))
+
+	// Only the queued uploads are updated.
+	require.NoError(t, c.SetUploadStatus(ctx, "abcd", UploadFailed, "503 Service Unavailable"))
+	entries, err := c.Entries(ctx, "abcd")
+	require.NoError(t, err)
+	queued.UploadStatus, queued.Error = UploadFailed, "503 Service Unavailable"
+	require.Equal(t, []Entry{queued, uploaded}, entries)
+}
@@ -0,0 +1,149 @@
+// Package compare reports the differences between two object or debug files: their build IDs,
+// the types, sizes and contents of their sections and the number of their DWARF compile units,
+// e.g. to check that a debug file matches the binary it was extracted from.
+package compare
+
+import (
+	"crypto/sha256"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+)
+
+// sectionSummary is what sections are compared by.
+type sectionSummary struct {
+	typ  elf.SectionType
+	size uint64
+	hash string
+}
+
+// Files returns the differences between a and b, one per line. If debugOnly is true, only the
+// sections that carry debug information are compared, e.g. to compare a binary with its debug file.
+func Files(a, b *elf.File, debugOnly bool) ([]string, error) {
+	var diffs []string
+	report := func(format string, args ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+
+	idA, idB := buildID(a), buildID(b)
+	if idA != idB {
+		report("build ID: %s != %s", orUnknown(idA), orUnknown(idB))
+	}
+
+	secA, err := sections(a, debugOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sections of a: %w", err)
+	}
+	secB, err := sections(b, debugOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sections of b: %w", err)
+	}
+	for _, s := range a.Sections {
+		sa, ok := secA[s.Name]
+		if !ok {
+			continue
+		}
+		sb, ok := secB[s.Name]
+		switch {
+		case !ok:
+			report("section %s: only in a", s.Name)
+		case sa.typ != sb.typ:
+			report("section %s: type %s != %s", s.Name, sa.typ, sb.typ)
+		case sa.size != sb.size:
+			report("section %s: size %d != %d", s.Name, sa.size, sb.size)
+		case sa.hash != sb.hash:
+			report("section %s: contents differ", s.Name)
+		}
+	}
+	for _, s := range b.Sections {
+		if _, ok := secB[s.Name]; !ok {
+			continue
+		}
+		if _, ok := secA[s.Name]; !ok {
+			report("section %s: only in b", s.Name)
+		}
+	}
+
+	cuA, errA := compileUnits(a)
+	cuB, errB := compileUnits(b)
+	switch {
+	case errA != nil && errB != nil:
+		// Neither has DWARF.
+	case errA != nil:
+		report("DWARF: only in b (%d compile units)", cuB)
+	case errB != nil:
+		report("DWARF: only in a (%d compile units)", cuA)
+	case cuA != cuB:
+		report("DWARF compile units: %d != %d", cuA, cuB)
+	}
+	return diffs, nil
+}
+
+// sections summarizes the sections to compare by name.
+func sections(f *elf.File, debugOnly bool) (map[string]sectionSummary, error) {
+	sections := map[string]sectionSummary{}
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NULL || s.Name == ".shstrtab" {
+			continue
+		}
+		if debugOnly && !pipeline.IsDWARF(s) && !pipeline.IsSymbolTable(s) && !pipeline.IsGoSymbolTable(s) && s.Name != ".strtab" && s.Name != ".dynstr" {
+			continue
+		}
+		sum := sectionSummary{typ: s.Type, size: s.Size}
+		if s.Type != elf.SHT_NOBITS {
+			// Hash the uncompressed contents, so compression does not matter.
+			h := sha256.New()
+			if _, err := io.Copy(h, s.Open()); err != nil {
+				return nil, fmt.Errorf("failed to read section %s: %w", s.Name, err)
+			}
+			sum.hash = hex.EncodeToString(h.Sum(nil))
+		}
+		sections[s.Name] = sum
+	}
+	return sections, nil
+}
+
+func buildID(f *elf.File) string {
+	if id, err := elfutils.BuildID(f); err == nil {
+		return id
+	}
+	if id, err := elfutils.GoBuildID(f); err == nil {
+		return id
+	}
+	return ""
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "??"
+	}
+	return s
+}
+
+// compileUnits counts the DWARF compile units of the given file.
+func compileUnits(f *elf.File) (int, error) {
+	data, err := f.DWARF()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	r := data.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return 0, err
+		}
+		if e == nil {
+			return n, nil
+		}
+		if e.Tag == dwarf.TagCompileUnit {
+			n++
+		}
+		r.SkipChildren()
+	}
+}
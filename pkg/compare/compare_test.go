@@ -0,0 +1,70 @@
+package compare
+
+import (
+	"context"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+
+	"github.com/stretchr/testify/require"
+)
+
+// extract extracts the debug information of path the way the extract command does by default.
+func extract(t *testing.T, path string) *elf.File {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "prog.debug")
+	w, err := os.Create(out)
+	require.NoError(t, err)
+	defer w.Close()
+	p := pipeline.New(pipeline.WithFilters(pipeline.DebugSections()), pipeline.WithTransformers(pipeline.LinkedSections()))
+	j := &pipeline.Job{Path: path, Output: out}
+	defer j.Close()
+	require.NoError(t, p.Run(context.Background(), j, w))
+
+	f, err := elfutils.Open(out)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func open(t *testing.T, path string) *elf.File {
+	t.Helper()
+	f, err := elfutils.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestFiles_Extracted(t *testing.T) {
+	path := elfwritertest.BuildC(t, "int main(void) { return 0; }\n", "-g", "-Wl,--build-id")
+	bin, debug := open(t, path), extract(t, path)
+
+	diffs, err := Files(bin, debug, true)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+
+	// The debug file lacks the code and data, but it has the build ID of the binary.
+	diffs, err = Files(bin, debug, false)
+	require.NoError(t, err)
+	require.NotEmpty(t, diffs)
+	require.Contains(t, diffs, "section .text: only in a")
+	for _, d := range diffs {
+		require.NotContains(t, d, "build ID", d)
+	}
+}
+
+func TestFiles_OtherBuild(t *testing.T) {
+	path := elfwritertest.BuildC(t, "int main(void) { return 0; }\n", "-g", "-Wl,--build-id")
+	other := elfwritertest.BuildC(t, "int answer(void) { return 42; }\nint main(void) { return answer(); }\n", "-g", "-Wl,--build-id")
+
+	diffs, err := Files(open(t, path), extract(t, other), true)
+	require.NoError(t, err)
+	require.NotEmpty(t, diffs)
+	require.Contains(t, diffs[0], "build ID: ")
+	require.NotContains(t, diffs[0], "??")
+}
@@ -0,0 +1,246 @@
+// Package debugfs exposes stored debug files as an io/fs.FS keyed by build ID, so symbolizers
+// open them with the standard interfaces whatever the storage backend:
+//
+//	fsys := debugfs.New(debugfs.Dir("/var/lib/split-debug"))
+//	f, err := fsys.Open("d29c3d943f55f4be53dc0c46ec833dc2db65ade9")
+//	...
+//	ef, err := elf.NewFile(f.(io.ReaderAt))
+//
+// The files implement io.ReaderAt and io.Seeker, so they are read without being buffered in memory.
+package debugfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Object is a stored debug file.
+type Object interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+	ModTime() time.Time
+}
+
+// ObjectInfo describes a stored debug file.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Bucket stores the debug files as objects, with slash separated keys. The debug file of a build ID
+// is looked up as <build-id>.debug, the layout of the node-scan output directory and of the remote
+// store, and then as .build-id/<xx>/<rest>.debug, the layout of GDB and debuginfod.
+type Bucket interface {
+	// Open opens the object of the key, the error wraps fs.ErrNotExist if there is none.
+	Open(ctx context.Context, key string) (Object, error)
+	// List returns the objects of the bucket, the ones with keys of neither layout are ignored.
+	List(ctx context.Context) ([]ObjectInfo, error)
+}
+
+// FS is the file system of the debug files of a bucket. The root directory holds a file per build ID,
+// named by the build ID.
+type FS struct {
+	bucket Bucket
+	ctx    context.Context
+}
+
+type Option func(f *FS)
+
+// WithContext uses ctx for the requests to the bucket, the default is context.Background.
+func WithContext(ctx context.Context) Option {
+	return func(f *FS) {
+		f.ctx = ctx
+	}
+}
+
+// New returns the file system of the debug files of the bucket.
+func New(b Bucket, opts ...Option) *FS {
+	f := &FS{bucket: b, ctx: context.Background()}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Open opens the debug file of the build ID, or the root directory for ".".
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		entries, err := f.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &dir{entries: entries}, nil
+	}
+	if !validBuildID(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	for _, key := range keys(name) {
+		obj, err := f.bucket.Open(f.ctx, key)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &file{
+			info:    fileInfo{name: name, size: obj.Size(), modTime: obj.ModTime()},
+			obj:     obj,
+			section: io.NewSectionReader(obj, 0, obj.Size()),
+		}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir lists the debug files of the bucket by build ID, sorted. Build IDs stored in both layouts
+// are listed once, with the object Open opens.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		if !fs.ValidPath(name) {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	objects, err := f.bucket.List(f.ctx)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	infos := map[string]fileInfo{}
+	// The lower the rank, the earlier Open looks the key up.
+	rank := map[string]int{}
+	for _, o := range objects {
+		id, r, ok := buildIDOf(o.Key)
+		if !ok {
+			continue
+		}
+		if prev, seen := rank[id]; seen && prev <= r {
+			continue
+		}
+		infos[id], rank[id] = fileInfo{name: id, size: o.Size, modTime: o.ModTime}, r
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// keys returns the keys the debug file of the build ID is looked up by, in order.
+func keys(id string) []string {
+	return []string{id + ".debug", ".build-id/" + id[:2] + "/" + id[2:] + ".debug"}
+}
+
+// buildIDOf returns the build ID of the key and the rank of its layout, the index in keys.
+func buildIDOf(key string) (string, int, bool) {
+	name := strings.TrimSuffix(key, ".debug")
+	if name == key {
+		return "", 0, false
+	}
+	if validBuildID(name) {
+		return name, 0, true
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) == 3 && parts[0] == ".build-id" && len(parts[1]) == 2 && validBuildID(parts[1]+parts[2]) {
+		return parts[1] + parts[2], 1, true
+	}
+	return "", 0, false
+}
+
+// validBuildID reports whether the name is a lower case hex build ID, long enough for the
+// .build-id layout.
+func validBuildID(name string) bool {
+	if len(name) < 3 {
+		return false
+	}
+	for _, c := range name {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// file is an opened debug file.
+type file struct {
+	info    fileInfo
+	obj     Object
+	section *io.SectionReader
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *file) Read(p []byte) (int, error) { return f.section.Read(p) }
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) { return f.section.ReadAt(p, off) }
+
+func (f *file) Seek(offset int64, whence int) (int64, error) { return f.section.Seek(offset, whence) }
+
+func (f *file) Close() error { return f.obj.Close() }
+
+// dir is the opened root directory.
+type dir struct {
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return fileInfo{name: ".", mode: fs.ModeDir | 0o555}, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error { return nil }
+
+// ReadDir follows the semantics of fs.ReadDirFile.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
+
+// fileInfo describes the debug files, read-only regular files, and the root directory.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string { return fi.name }
+
+func (fi fileInfo) Size() int64 { return fi.size }
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.mode == 0 {
+		return 0o444
+	}
+	return fi.mode
+}
+
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+
+func (fi fileInfo) IsDir() bool { return fi.mode.IsDir() }
+
+func (fi fileInfo) Sys() interface{} { return nil }
@@ -0,0 +1,97 @@
+package debugfs
+
+import (
+	"context"
+	"debug/elf"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS_Dir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0o644))
+	}
+	write("abcd.debug", "flat")
+	write("0123.debug", "flat and linked")
+	write(".build-id/ef/01.debug", "linked")
+	write("app.debug", "not keyed by build ID")
+	write("abcd.json", "metadata")
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, ".build-id", "01"), 0o755))
+		require.NoError(t, os.Symlink("../../0123.debug", filepath.Join(dir, ".build-id", "01", "23.debug")))
+		require.NoError(t, os.Symlink("../../gone.debug", filepath.Join(dir, ".build-id", "ef", "02.debug")))
+	}
+
+	fsys := New(Dir(dir))
+	require.NoError(t, fstest.TestFS(fsys, "abcd", "0123", "ef01"))
+
+	entries, err := fs.ReadDir(fsys, ".")
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.Equal(t, []string{"0123", "abcd", "ef01"}, names)
+
+	data, err := fs.ReadFile(fsys, "ef01")
+	require.NoError(t, err)
+	require.Equal(t, "linked", string(data))
+	data, err = fs.ReadFile(fsys, "0123")
+	require.NoError(t, err)
+	require.Equal(t, "flat and linked", string(data))
+
+	for _, name := range []string{"ef02", "app", "abcd.debug", "ABCD", ".build-id"} {
+		_, err := fsys.Open(name)
+		require.True(t, errors.Is(err, fs.ErrNotExist), name)
+	}
+	_, err = fsys.Open("../abcd")
+	require.True(t, errors.Is(err, fs.ErrInvalid))
+}
+
+func TestFS_ELF(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the test binary is an ELF file on linux only")
+	}
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(exe)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "abcd.debug"), data, 0o644))
+
+	f, err := New(Dir(dir)).Open("abcd")
+	require.NoError(t, err)
+	defer f.Close()
+	ra, ok := f.(io.ReaderAt)
+	require.True(t, ok)
+	ef, err := elf.NewFile(ra)
+	require.NoError(t, err)
+	require.NotNil(t, ef.Section(".text"))
+}
+
+type failingBucket struct{ err error }
+
+func (b failingBucket) Open(ctx context.Context, key string) (Object, error) { return nil, b.err }
+
+func (b failingBucket) List(ctx context.Context) ([]ObjectInfo, error) { return nil, b.err }
+
+func TestFS_BucketError(t *testing.T) {
+	errBucket := errors.New("bucket unavailable")
+	fsys := New(failingBucket{errBucket})
+	_, err := fsys.Open("abcd")
+	require.ErrorIs(t, err, errBucket)
+	_, err = fs.ReadDir(fsys, ".")
+	require.ErrorIs(t, err, errBucket)
+}
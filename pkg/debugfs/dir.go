@@ -0,0 +1,95 @@
+package debugfs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Dir is a bucket of the debug files in a local directory, e.g. the output directory of node-scan,
+// the store of the remote server or a debug directory indexed by the index command.
+type Dir string
+
+// dirObject is an opened file of a Dir.
+type dirObject struct {
+	*os.File
+	info os.FileInfo
+}
+
+func (o *dirObject) Size() int64 { return o.info.Size() }
+
+func (o *dirObject) ModTime() time.Time { return o.info.ModTime() }
+
+// Open opens the file of the key, following symlinks, e.g. the links of the .build-id directory.
+func (d Dir) Open(_ context.Context, key string) (Object, error) {
+	if !fs.ValidPath(key) {
+		return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrInvalid}
+	}
+	f, err := os.Open(filepath.Join(string(d), filepath.FromSlash(key)))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrNotExist}
+	}
+	return &dirObject{File: f, info: info}, nil
+}
+
+// List lists the .debug files of the directory and of its .build-id directory.
+func (d Dir) List(context.Context) ([]ObjectInfo, error) {
+	objects, err := d.list(".")
+	if err != nil {
+		return nil, err
+	}
+	subdirs, err := ioutil.ReadDir(filepath.Join(string(d), ".build-id"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return objects, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range subdirs {
+		if !s.IsDir() {
+			continue
+		}
+		sub, err := d.list(path.Join(".build-id", s.Name()))
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, sub...)
+	}
+	return objects, nil
+}
+
+// list lists the regular .debug files of the subdirectory, following symlinks.
+func (d Dir) list(dir string) ([]ObjectInfo, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(string(d), filepath.FromSlash(dir)))
+	if err != nil {
+		return nil, err
+	}
+	var objects []ObjectInfo
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".debug" {
+			continue
+		}
+		key := path.Join(dir, e.Name())
+		info, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(key)))
+		// Dangling links are left out.
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
@@ -0,0 +1,238 @@
+// Package debuginfod fetches debug files from debuginfod servers by build ID, see
+// https://sourceware.org/elfutils/Debuginfod.html.
+package debuginfod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// The environment variables of the elfutils debuginfod clients, e.g. debuginfod-find.
+const (
+	// URLsEnvVar holds the server URLs, separated by whitespace.
+	URLsEnvVar = "DEBUGINFOD_URLS"
+	// CachePathEnvVar holds the cache directory.
+	CachePathEnvVar = "DEBUGINFOD_CACHE_PATH"
+	// TimeoutEnvVar holds the timeout in seconds, see WithTimeout.
+	TimeoutEnvVar = "DEBUGINFOD_TIMEOUT"
+)
+
+// DefaultTimeout is the timeout of the elfutils clients if $DEBUGINFOD_TIMEOUT is not set.
+const DefaultTimeout = 90 * time.Second
+
+// ErrNotFound is returned when none of the servers has the debug file of a build ID.
+var ErrNotFound = errors.New("debug file not found")
+
+// Client fetches debug files from a list of servers, in order.
+type Client struct {
+	servers []string
+	client  *http.Client
+	timeout time.Duration
+}
+
+type Option func(c *Client)
+
+// WithClient sends the requests with the given client, the default is http.DefaultClient.
+func WithClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithTimeout aborts requests that make no progress for d: connecting, waiting for the response
+// or receiving no data of it, as the elfutils clients do. 0 disables it.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// NewClient returns a client of the servers, e.g. https://debuginfod.elfutils.org.
+func NewClient(servers []string, opts ...Option) *Client {
+	c := &Client{client: http.DefaultClient}
+	for _, s := range servers {
+		if s = strings.TrimSuffix(strings.TrimSpace(s), "/"); s != "" {
+			c.servers = append(c.servers, s)
+		}
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Debuginfo opens the debug file of the build ID on the first server that has it and returns the
+// server along with it. It returns ErrNotFound if no server has it, and the last error if a server
+// failed otherwise.
+func (c *Client) Debuginfo(ctx context.Context, buildID string) (io.ReadCloser, string, error) {
+	if !validBuildID(buildID) {
+		return nil, "", fmt.Errorf("invalid build ID %q", buildID)
+	}
+	err := ErrNotFound
+	for _, server := range c.servers {
+		body, serr := c.get(ctx, server+"/buildid/"+buildID+"/debuginfo")
+		if serr == nil {
+			return body, server, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		if !errors.Is(serr, ErrNotFound) {
+			err = fmt.Errorf("%s: %w", server, serr)
+		}
+	}
+	return nil, "", err
+}
+
+func (c *Client) get(ctx context.Context, url string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watchdog{cancel: cancel}
+	if c.timeout > 0 {
+		w.timeout = c.timeout
+		w.timer = time.AfterFunc(c.timeout, w.expire)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		w.stop()
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		w.stop()
+		return nil, w.err(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		w.body = resp.Body
+		w.progress()
+		return w, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		w.stop()
+		return nil, ErrNotFound
+	default:
+		resp.Body.Close()
+		w.stop()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// watchdog cancels a request that made no progress for the timeout, it is the body of the
+// response once there is one.
+type watchdog struct {
+	body    io.ReadCloser
+	cancel  context.CancelFunc
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func (w *watchdog) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	if n > 0 {
+		w.progress()
+	}
+	if err != nil && err != io.EOF {
+		err = w.err(err)
+	}
+	return n, err
+}
+
+func (w *watchdog) Close() error {
+	w.stop()
+	return w.body.Close()
+}
+
+// progress restarts the timeout.
+func (w *watchdog) progress() {
+	if w.timer != nil {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+func (w *watchdog) expire() {
+	w.expired.Store(true)
+	w.cancel()
+}
+
+func (w *watchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.cancel()
+}
+
+// err reports the errors of requests the watchdog canceled as timeouts.
+func (w *watchdog) err(err error) error {
+	if w.expired.Load() {
+		return fmt.Errorf("no progress for %s: %w", w.timeout, err)
+	}
+	return err
+}
+
+// CacheFile returns the path of the debug file of the build ID in the cache directory of the
+// elfutils clients. They cache failed lookups as empty files, so those are not debug files.
+func CacheFile(dir, buildID string) string {
+	return filepath.Join(dir, buildID, "debuginfo")
+}
+
+// ServersFromEnv returns the servers of $DEBUGINFOD_URLS.
+func ServersFromEnv() []string {
+	return strings.Fields(os.Getenv(URLsEnvVar))
+}
+
+// TimeoutFromEnv returns the timeout of $DEBUGINFOD_TIMEOUT, or DefaultTimeout if it is not set.
+func TimeoutFromEnv() (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(TimeoutEnvVar))
+	if v == "" {
+		return DefaultTimeout, nil
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		return 0, fmt.Errorf("invalid $%s %q, want seconds", TimeoutEnvVar, v)
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+// CachePath returns the cache directory of the elfutils clients: $DEBUGINFOD_CACHE_PATH,
+// ~/.debuginfod_client_cache if it exists from older versions, or else debuginfod_client in
+// the user cache directory.
+func CachePath() (string, error) {
+	if dir := os.Getenv(CachePathEnvVar); dir != "" {
+		return dir, nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		legacy := filepath.Join(home, ".debuginfod_client_cache")
+		if fi, err := os.Stat(legacy); err == nil && fi.IsDir() {
+			return legacy, nil
+		}
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "debuginfod_client"), nil
+}
+
+// validBuildID reports whether the build ID is hex, it ends up in URLs.
+func validBuildID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package debuginfod
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Debuginfo(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	empty := httptest.NewServer(http.NotFoundHandler())
+	defer empty.Close()
+	var paths []string
+	full := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path != "/buildid/abcd/debuginfo" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("debug file"))
+	}))
+	defer full.Close()
+
+	ctx := context.Background()
+	c := NewClient([]string{failing.URL, empty.URL + "/", full.URL, " "})
+	rc, server, err := c.Debuginfo(ctx, "abcd")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	require.Equal(t, "debug file", string(data))
+	require.Equal(t, full.URL, server)
+
+	// A server failing is reported over the build ID not being found.
+	_, _, err = c.Debuginfo(ctx, "ef01")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrNotFound)
+	require.Contains(t, err.Error(), "503")
+
+	_, _, err = NewClient([]string{empty.URL, full.URL}).Debuginfo(ctx, "ef01")
+	require.ErrorIs(t, err, ErrNotFound)
+	_, _, err = NewClient(nil).Debuginfo(ctx, "ef01")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, _, err = c.Debuginfo(ctx, "../abcd")
+	require.Error(t, err)
+	require.Equal(t, []string{"/buildid/abcd/debuginfo", "/buildid/ef01/debuginfo", "/buildid/ef01/debuginfo"}, paths)
+}
+
+func TestClient_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	rc, _, err := NewClient([]string{srv.URL}, WithTimeout(50*time.Millisecond)).Debuginfo(context.Background(), "abcd")
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no progress for 50ms")
+	require.Equal(t, "partial", string(data))
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv(URLsEnvVar, " https://a.example.com\thttps://b.example.com/  ")
+	require.Equal(t, []string{"https://a.example.com", "https://b.example.com/"}, ServersFromEnv())
+
+	t.Setenv(TimeoutEnvVar, "")
+	timeout, err := TimeoutFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, DefaultTimeout, timeout)
+	t.Setenv(TimeoutEnvVar, "5")
+	timeout, err = TimeoutFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, timeout)
+	t.Setenv(TimeoutEnvVar, "5s")
+	_, err = TimeoutFromEnv()
+	require.Error(t, err)
+
+	dir := t.TempDir()
+	t.Setenv(CachePathEnvVar, dir)
+	path, err := CachePath()
+	require.NoError(t, err)
+	require.Equal(t, dir, path)
+	require.Equal(t, filepath.Join(dir, "abcd", "debuginfo"), CacheFile(path, "abcd"))
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	home := t.TempDir()
+	t.Setenv(CachePathEnvVar, "")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "xdg"))
+	path, err = CachePath()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, "xdg", "debuginfod_client"), path)
+	require.NoError(t, os.Mkdir(filepath.Join(home, ".debuginfod_client_cache"), 0o755))
+	path, err = CachePath()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, ".debuginfod_client_cache"), path)
+}
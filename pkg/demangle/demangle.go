@@ -0,0 +1,59 @@
+// Package demangle demangles the symbol names of Rust, in its legacy and v0 manglings, and of C++
+// in the Itanium ABI mangling, as rustfilt and c++filt do. The hashes of Rust symbols are left out.
+//
+// It covers the names found in the symbol tables of compiled programs. Names it does not
+// understand, e.g. with template arguments that are C++ expressions, are returned as they are.
+package demangle
+
+import (
+	"errors"
+	"strings"
+)
+
+// errUnsupported is returned by the parsers for names they cannot demangle.
+var errUnsupported = errors.New("unsupported mangled name")
+
+// maxDepth bounds the recursion of the parsers, mangled names are untrusted.
+const maxDepth = 256
+
+// Demangle returns the demangled name, or the name as it is and false if it is not mangled or
+// cannot be demangled.
+func Demangle(name string) (string, bool) {
+	// macOS prefixes the symbols with an underscore.
+	mangled := name
+	if strings.HasPrefix(mangled, "__Z") || strings.HasPrefix(mangled, "__R") {
+		mangled = mangled[1:]
+	}
+	var (
+		s   string
+		err error
+	)
+	switch {
+	case isRustV0(mangled):
+		s, err = rustV0(mangled)
+	case strings.HasPrefix(mangled, "_ZN") && isRustLegacy(mangled):
+		s, err = rustLegacy(mangled)
+	case strings.HasPrefix(mangled, "_Z"):
+		s, err = itanium(mangled)
+	default:
+		return name, false
+	}
+	if err != nil {
+		return name, false
+	}
+	return s, true
+}
+
+// Filter returns the demangled name, or the name itself if it cannot be demangled.
+func Filter(name string) string {
+	s, _ := Demangle(name)
+	return s
+}
+
+// IsRust reports whether the name is a mangled Rust symbol.
+func IsRust(name string) bool {
+	if strings.HasPrefix(name, "__") {
+		name = name[1:]
+	}
+	return isRustV0(name) || (strings.HasPrefix(name, "_ZN") && isRustLegacy(name))
+}
@@ -0,0 +1,163 @@
+package demangle
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemangle(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		// Rust, legacy mangling.
+		{name: "_ZN4test1a2bc17h0123456789abcdefE", want: "test::a::bc", ok: true},
+		{name: "_ZN3std2io5stdio6_print17h4b1a3b5f0a5e6c7dE", want: "std::io::stdio::_print", ok: true},
+		{name: "_ZN8$RF$test17h0123456789abcdefE", want: "&test", ok: true},
+		{name: "_ZN8$BP$test4foob17h0123456789abcdefE", want: "*test::foob", ok: true},
+		{name: "_ZN35Bar$LT$$u5b$u32$u3b$$u20$4$u5d$$GT$17h0123456789abcdefE", want: "Bar<[u32; 4]>", ok: true},
+		{
+			name: "_ZN71_$LT$Test$u20$$u2b$$u20$$u27$static$u20$as$u20$foo..Bar$LT$Test$GT$$GT$3bar17h0123456789abcdefE",
+			want: "<Test + 'static as foo::Bar<Test>>::bar",
+			ok:   true,
+		},
+		{name: "__ZN4main4main17he714a2e23ed7db23E", want: "main::main", ok: true},
+		// Rust, v0 mangling.
+		{name: "_RNvC6_123foo3bar", want: "123foo::bar", ok: true},
+		{name: "_RNvCs15kBYyAo9fc_7mycrate7example", want: "mycrate::example", ok: true},
+		{name: "_RNCNCNgCs6DXkGYLi8lr_2cc5spawn00B5_", want: "cc::spawn::{closure#0}::{closure#0}", ok: true},
+		{
+			name: "_RNqCs4fqI2P2rA04_11utf8_identsu30____7hkackfecea1cbdathfdh9hlq6y",
+			want: "utf8_idents::საჭმელად_გემრიელი_სადილი",
+			ok:   true,
+		},
+		{
+			name: "_RNCINkXs25_NgCsbmNqQUJIY6D_4core5sliceINyB9_4IterhENuNgNoBb_4iter8iterator8Iterator9rpositionNCNgNpB9_6memchr7memrchrs_0E0Bb_",
+			want: "<core::slice::Iter<u8> as core::iter::iterator::Iterator>::rposition::<core::slice::memchr::memrchr::{closure#1}>::{closure#0}",
+			ok:   true,
+		},
+		{
+			name: "_RINbNbCskIICzLVDPPb_5alloc5alloc8box_freeDINbNiB4_5boxed5FnBoxuEp6OutputuEL_ECs1iopQbuBiw2_3std",
+			want: "alloc::alloc::box_free::<dyn alloc::boxed::FnBox<(), Output = ()>>",
+			ok:   true,
+		},
+		{name: "_RMC0INtC8arrayvec8ArrayVechKj7b_E", want: "<arrayvec::ArrayVec<u8, 123>>", ok: true},
+		// C++.
+		{name: "_Z3foov", want: "foo()", ok: true},
+		{name: "_ZN3foo3barEv", want: "foo::bar()", ok: true},
+		{name: "_ZNK3Foo3barEi", want: "Foo::bar(int) const", ok: true},
+		{name: "_Z1fIiEvT_", want: "void f<int>(int)", ok: true},
+		{name: "_ZN3FooC1ERKS_", want: "Foo::Foo(Foo const&)", ok: true},
+		{name: "_ZN3FooD2Ev", want: "Foo::~Foo()", ok: true},
+		{name: "_ZNSt6vectorIiSaIiEE9push_backERKi", want: "std::vector<int, std::allocator<int>>::push_back(int const&)", ok: true},
+		{name: "_Z4callPFviE", want: "call(void (*)(int))", ok: true},
+		{name: "_Z3sumRA4_Ki", want: "sum(int const (&) [4])", ok: true},
+		{name: "_ZStlsISt11char_traitsIcEERSt13basic_ostreamIcT_ES5_PKc", want: "std::basic_ostream<char, std::char_traits<char>>& std::operator<< <std::char_traits<char>>(std::basic_ostream<char, std::char_traits<char>>&, char const*)", ok: true},
+		{name: "_ZN12_GLOBAL__N_14workEv", want: "(anonymous namespace)::work()", ok: true},
+		{name: "_ZZ4mainE5count", want: "main::count", ok: true},
+		{name: "_ZZ4mainENKUlvE_clEv", want: "main::{lambda()#1}::operator()() const", ok: true},
+		{name: "_Z7computei.cold", want: "compute(int) [clone .cold]", ok: true},
+		{name: "_Z7computei.constprop.0.isra.0", want: "compute(int) [clone .constprop.0] [clone .isra.0]", ok: true},
+		{name: "_ZTV3Foo", want: "vtable for Foo", ok: true},
+		{name: "_ZThn8_N3Foo3barEv", want: "non-virtual thunk to Foo::bar()", ok: true},
+		{name: "_ZGVZ4mainE1x", want: "guard variable for main::x", ok: true},
+		{name: "_Z5applyIJicEEvDpT_", want: "void apply<int, char>(int, char)", ok: true},
+		// Not mangled, or not understood.
+		{name: "main", want: "main"},
+		{name: "_Z", want: "_Z"},
+		{name: "_ZN3foo", want: "_ZN3foo"},
+		{name: "_Z1fIXplLi1ELi2EEEvv", want: "_Z1fIXplLi1ELi2EEEvv"},
+		{name: "_RNvC", want: "_RNvC"},
+	}
+	for _, tt := range tests {
+		got, ok := Demangle(tt.name)
+		require.Equal(t, tt.want, got, tt.name)
+		require.Equal(t, tt.ok, ok, tt.name)
+		require.Equal(t, tt.want, Filter(tt.name), tt.name)
+	}
+}
+
+func TestIsRust(t *testing.T) {
+	require.True(t, IsRust("_ZN3std2io5stdio6_print17h4b1a3b5f0a5e6c7dE"))
+	require.True(t, IsRust("_RNvCs15kBYyAo9fc_7mycrate7example"))
+	require.False(t, IsRust("_ZN3foo3barEv"))
+	require.False(t, IsRust("main"))
+}
+
+// TestDemangle_Malformed checks that truncated and recursive names are rejected, not panicking
+// nor recursing without bounds.
+func TestDemangle_Malformed(t *testing.T) {
+	names := []string{
+		"_ZN3std2io5stdio6_print17h4b1a3b5f0a5e6c7dE",
+		"_RINbNbCskIICzLVDPPb_5alloc5alloc8box_freeDINbNiB4_5boxed5FnBoxuEp6OutputuEL_ECs1iopQbuBiw2_3std",
+		"_ZStlsISt11char_traitsIcEERSt13basic_ostreamIcT_ES5_PKc",
+	}
+	for _, name := range names {
+		for i := range name {
+			Demangle(name[:i])
+		}
+	}
+	_, ok := Demangle("_Z1f" + strings.Repeat("P", 10000) + "i")
+	require.False(t, ok)
+	_, ok = Demangle("_RNvB_1a")
+	require.False(t, ok)
+}
+
+// TestDemangle_Cxxfilt compares the demangled symbols of the C++ standard library with the ones
+// of c++filt.
+func TestDemangle_Cxxfilt(t *testing.T) {
+	if testing.Short() {
+		t.Skip("comparing with c++filt is skipped in short mode")
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("c++filt comparison requires a Linux host")
+	}
+	if _, err := exec.LookPath("c++filt"); err != nil {
+		t.Skip("c++filt is not available")
+	}
+	path, err := exec.Command("gcc", "-print-file-name=libstdc++.so.6").Output()
+	if err != nil {
+		t.Skip("gcc is not available")
+	}
+	f, err := elf.Open(strings.TrimSpace(string(path)))
+	if err != nil {
+		t.Skip("libstdc++ is not available")
+	}
+	defer f.Close()
+	syms, err := f.DynamicSymbols()
+	require.NoError(t, err)
+
+	var names []string
+	for _, s := range syms {
+		if strings.HasPrefix(s.Name, "_Z") {
+			names = append(names, s.Name)
+		}
+	}
+	cmd := exec.Command("c++filt")
+	cmd.Stdin = strings.NewReader(strings.Join(names, "\n") + "\n")
+	out, err := cmd.Output()
+	require.NoError(t, err)
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(nil, 1<<20)
+	var demangled int
+	for i := 0; sc.Scan(); i++ {
+		// Older versions of c++filt separate closing angle brackets.
+		want := strings.ReplaceAll(strings.ReplaceAll(sc.Text(), "> >", ">>"), "> >", ">>")
+		if got, ok := Demangle(names[i]); ok {
+			require.Equal(t, want, got, names[i])
+			demangled++
+		}
+	}
+	require.NoError(t, sc.Err())
+	// Transaction clones and the like aside, all of them are demangled.
+	require.Greater(t, demangled, len(names)*9/10)
+}
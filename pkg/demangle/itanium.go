@@ -0,0 +1,1000 @@
+package demangle
+
+import (
+	"strconv"
+	"strings"
+)
+
+// itanium demangles the C++ mangling of the Itanium ABI, see
+// https://itanium-cxx-abi.github.io/cxx-abi/abi.html#mangling. Template arguments that are
+// expressions are not supported.
+func itanium(s string) (_ string, err error) {
+	p := &itaniumParser{s: s, pos: 2, packIndex: -1}
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errUnsupported {
+				panic(r)
+			}
+			err = errUnsupported
+		}
+	}()
+	out := p.encoding(true)
+	// Clones of the function by the compiler, e.g. .cold or .constprop.0.isra.0.
+	for p.pos < len(p.s) {
+		out += " [clone " + p.cloneSuffix() + "]"
+	}
+	return out, nil
+}
+
+// itaniumParser parses a mangled name into its demangled string. Types keep their declarator
+// apart, so pointers to functions and arrays are printed as in C++, e.g. void (*)(int).
+type itaniumParser struct {
+	s     string
+	pos   int
+	depth int
+	// subs are the substitution candidates, S_ refers to the first one.
+	subs []ctype
+	// templateArgs are the template arguments T_ refers to, of the name of the encoding.
+	templateArgs []ctype
+	// packIndex is the element of the argument packs a pack expansion is parsed for, -1 outside
+	// of them, and packLen the number of elements of the first pack it refers to.
+	packIndex, packLen int
+}
+
+// ctype is a demangled type, printed as left and right around the declarator.
+type ctype struct {
+	left, right string
+	// declarator reports whether right is the parameter list of a function or the dimension of an
+	// array, pointers to them go into parentheses before it.
+	declarator bool
+	// pack holds the elements of a template argument pack.
+	pack   []ctype
+	isPack bool
+	// param is the number of the template parameter the type is, plus one. Substitutions of
+	// template parameters refer to the arguments where they are used.
+	param int
+}
+
+func (t ctype) String() string {
+	if t.isPack {
+		return joinTypes(t.pack)
+	}
+	return t.left + t.right
+}
+
+// joinTypes returns the list of the types, leaving out the empty expansions of packs.
+func joinTypes(types []ctype) string {
+	var list []string
+	for _, t := range types {
+		if s := t.String(); s != "" {
+			list = append(list, s)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+func plain(s string) ctype { return ctype{left: s} }
+
+// name is a parsed name and what the encoding of a function needs to know about it.
+type name struct {
+	s string
+	// templateArgs are the arguments of the name if it is a template.
+	templateArgs []ctype
+	// noReturn reports whether the name is a constructor, destructor or conversion operator,
+	// the only templates without the return type in their encoding.
+	noReturn bool
+	// qualifiers are the cv and ref qualifiers of a member function.
+	qualifiers string
+}
+
+func (p *itaniumParser) fail() {
+	panic(errUnsupported)
+}
+
+func (p *itaniumParser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *itaniumParser) peekAt(i int) byte {
+	if p.pos+i >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos+i]
+}
+
+func (p *itaniumParser) next() byte {
+	if p.pos >= len(p.s) {
+		p.fail()
+	}
+	c := p.s[p.pos]
+	p.pos++
+	return c
+}
+
+func (p *itaniumParser) eat(c byte) bool {
+	if p.peek() == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *itaniumParser) expect(c byte) {
+	if !p.eat(c) {
+		p.fail()
+	}
+}
+
+func (p *itaniumParser) enter() {
+	p.depth++
+	if p.depth > maxDepth {
+		p.fail()
+	}
+}
+
+func (p *itaniumParser) leave() { p.depth-- }
+
+func (p *itaniumParser) addSub(t ctype) {
+	if len(t.left)+len(t.right) > maxLength {
+		p.fail()
+	}
+	p.subs = append(p.subs, t)
+}
+
+// atEnd reports whether the encoding ends, at the end of the name, of a local name or of a
+// clone suffix.
+func (p *itaniumParser) atEnd() bool {
+	c := p.peek()
+	return c == 0 || c == 'E' || c == '.'
+}
+
+// encoding parses the encoding of a function or data, returnType reports whether the return type
+// of templates is printed.
+func (p *itaniumParser) encoding(returnType bool) string {
+	if p.peek() == 'T' || p.peek() == 'G' {
+		return p.specialName()
+	}
+	ret, n, params := p.function()
+	if params == nil {
+		return n.s
+	}
+	if !returnType {
+		ret = ""
+	}
+	return ret + n.s + "(" + *params + ")" + n.qualifiers
+}
+
+// function parses the encoding of a function or data into the return type, with a trailing
+// space, the name and the parameters, nil for data.
+func (p *itaniumParser) function() (string, name, *string) {
+	p.enter()
+	defer p.leave()
+	n := p.name()
+	if p.atEnd() {
+		return "", n, nil
+	}
+	saved := p.templateArgs
+	if n.templateArgs != nil {
+		p.templateArgs = n.templateArgs
+	}
+	defer func() { p.templateArgs = saved }()
+
+	var ret string
+	if n.templateArgs != nil && !n.noReturn {
+		ret = p.typ().String() + " "
+	}
+	params := p.params()
+	return ret, n, &params
+}
+
+// params parses the parameter types of a function up to the end of the encoding.
+func (p *itaniumParser) params() string {
+	if p.peek() == 'v' {
+		p.pos++
+		if p.atEnd() {
+			return ""
+		}
+		p.fail()
+	}
+	var params []ctype
+	for !p.atEnd() {
+		params = append(params, p.typ())
+	}
+	if len(params) == 0 {
+		p.fail()
+	}
+	return joinTypes(params)
+}
+
+func (p *itaniumParser) specialName() string {
+	switch c, d := p.next(), p.next(); {
+	case c == 'G' && d == 'V':
+		return "guard variable for " + p.name().s
+	case c == 'G' && d == 'T':
+		if p.eat('n') {
+			return "non-transaction clone for " + p.encoding(true)
+		}
+		p.expect('t')
+		return "transaction clone for " + p.encoding(true)
+	case c == 'G':
+		p.fail()
+	case d == 'V':
+		return "vtable for " + p.typ().String()
+	case d == 'T':
+		return "VTT for " + p.typ().String()
+	case d == 'I':
+		return "typeinfo for " + p.typ().String()
+	case d == 'S':
+		return "typeinfo name for " + p.typ().String()
+	case d == 'H':
+		return "TLS init function for " + p.name().s
+	case d == 'W':
+		return "TLS wrapper function for " + p.name().s
+	case d == 'h':
+		p.callOffset('h')
+		return "non-virtual thunk to " + p.encoding(true)
+	case d == 'v':
+		p.callOffset('v')
+		return "virtual thunk to " + p.encoding(true)
+	case d == 'c':
+		p.callOffset(p.next())
+		p.callOffset(p.next())
+		return "covariant return thunk to " + p.encoding(true)
+	}
+	p.fail()
+	return ""
+}
+
+// callOffset skips the offsets of a thunk, after their h or v.
+func (p *itaniumParser) callOffset(kind byte) {
+	switch kind {
+	case 'h':
+		p.number()
+		p.expect('_')
+	case 'v':
+		p.number()
+		p.expect('_')
+		p.number()
+		p.expect('_')
+	default:
+		p.fail()
+	}
+}
+
+// number parses a decimal number, n is the minus sign.
+func (p *itaniumParser) number() string {
+	neg := p.eat('n')
+	start := p.pos
+	for isDigit(p.peek()) {
+		p.pos++
+	}
+	if p.pos == start {
+		p.fail()
+	}
+	if neg {
+		return "-" + p.s[start:p.pos]
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *itaniumParser) name() name {
+	p.enter()
+	defer p.leave()
+	switch c := p.peek(); {
+	case c == 'N':
+		return p.nestedName()
+	case c == 'Z':
+		return p.localName()
+	case c == 'S' && p.peekAt(1) == 't':
+		p.pos += 2
+		n := p.unqualifiedName("")
+		n.s = "std::" + n.s
+		return p.maybeTemplate(n)
+	case c == 'S':
+		sub := p.substitution()
+		if p.peek() != 'I' {
+			p.fail()
+		}
+		args, s := p.templateArgList()
+		return name{s: sub.String() + s, templateArgs: args}
+	default:
+		return p.maybeTemplate(p.unqualifiedName(""))
+	}
+}
+
+// maybeTemplate adds the template arguments following an unscoped name, the name is then a
+// substitution candidate.
+func (p *itaniumParser) maybeTemplate(n name) name {
+	if p.peek() != 'I' {
+		return n
+	}
+	p.addSub(plain(n.s))
+	args, s := p.templateArgList()
+	n.s = withTemplateArgs(n.s, s)
+	n.templateArgs = args
+	return n
+}
+
+// withTemplateArgs appends the template arguments to the name, separated by a space from an
+// operator ending in <, e.g. operator<< <char>.
+func withTemplateArgs(name, args string) string {
+	if strings.HasSuffix(name, "<") {
+		return name + " " + args
+	}
+	return name + args
+}
+
+func (p *itaniumParser) nestedName() name {
+	p.expect('N')
+	n := name{qualifiers: p.cvQualifiers()}
+	switch {
+	case p.eat('R'):
+		n.qualifiers += " &"
+	case p.eat('O'):
+		n.qualifiers += " &&"
+	}
+
+	var cur, class string
+	for !p.eat('E') {
+		n.templateArgs = nil
+		add := true
+		switch c := p.peek(); {
+		case c == 'S' && p.peekAt(1) == 't':
+			if cur != "" {
+				p.fail()
+			}
+			p.pos += 2
+			cur = "std"
+			add = false
+		case c == 'S':
+			if cur != "" {
+				p.fail()
+			}
+			cur = p.substitution().String()
+			class = baseName(cur)
+			add = false
+		case c == 'T':
+			if cur != "" {
+				p.fail()
+			}
+			cur = p.templateParam().String()
+			class = baseName(cur)
+		case c == 'I':
+			if cur == "" {
+				p.fail()
+			}
+			args, s := p.templateArgList()
+			cur = withTemplateArgs(cur, s)
+			n.templateArgs = args
+		case c == 'D' && (p.peekAt(1) == 't' || p.peekAt(1) == 'T' || p.peekAt(1) == 'C'):
+			// decltype and structured bindings.
+			p.fail()
+		default:
+			u := p.unqualifiedName(class)
+			n.noReturn = u.noReturn
+			// c++filt names the constructors of unnamed types after the enclosing class.
+			if !u.noReturn && !strings.HasPrefix(u.s, "{") {
+				class = baseName(u.s)
+			}
+			if cur != "" {
+				cur += "::"
+			}
+			cur += u.s
+		}
+		if add && p.peek() != 'E' {
+			p.addSub(plain(cur))
+		}
+	}
+	if cur == "" {
+		p.fail()
+	}
+	n.s = cur
+	return n
+}
+
+// localName parses the name of an entity local to a function, e.g. a static variable.
+func (p *itaniumParser) localName() name {
+	p.expect('Z')
+	// c++filt leaves out the return type of the function.
+	enc := p.encoding(false)
+	p.expect('E')
+	if p.eat('s') {
+		p.discriminator()
+		return name{s: enc + "::string literal"}
+	}
+	if p.peek() == 'd' {
+		// Default arguments.
+		p.fail()
+	}
+	n := p.name()
+	p.discriminator()
+	n.s = enc + "::" + n.s
+	return n
+}
+
+func (p *itaniumParser) discriminator() {
+	if !p.eat('_') {
+		return
+	}
+	if p.eat('_') {
+		p.number()
+		p.expect('_')
+		return
+	}
+	if !isDigit(p.next()) {
+		p.fail()
+	}
+}
+
+// unqualifiedName parses an unqualified name, class is the name of the class of constructors
+// and destructors.
+func (p *itaniumParser) unqualifiedName(class string) name {
+	var n name
+	switch c := p.peek(); {
+	case isDigit(c):
+		n.s = p.sourceName()
+	case c == 'L':
+		// Internal linkage.
+		p.pos++
+		n.s = p.sourceName()
+	case c == 'C':
+		p.pos++
+		inheriting := p.eat('I')
+		if d := p.next(); d < '1' || d > '5' || class == "" {
+			p.fail()
+		}
+		if inheriting {
+			// Inheriting constructors name the base class.
+			p.typ()
+		}
+		n.s, n.noReturn = class, true
+	case c == 'D' && p.peekAt(1) >= '0' && p.peekAt(1) <= '5':
+		if class == "" {
+			p.fail()
+		}
+		p.pos += 2
+		n.s, n.noReturn = "~"+class, true
+	case c == 'U':
+		n.s = p.unnamedTypeName()
+	case c >= 'a' && c <= 'z':
+		n = p.operatorName()
+	default:
+		p.fail()
+	}
+	for p.eat('B') {
+		n.s += "[abi:" + p.sourceName() + "]"
+	}
+	return n
+}
+
+func (p *itaniumParser) sourceName() string {
+	start := p.pos
+	n := 0
+	for isDigit(p.peek()) {
+		n = n*10 + int(p.next()-'0')
+		if n > len(p.s) {
+			p.fail()
+		}
+	}
+	if p.pos == start || p.pos+n > len(p.s) || n == 0 {
+		p.fail()
+	}
+	id := p.s[p.pos : p.pos+n]
+	p.pos += n
+	if strings.HasPrefix(id, "_GLOBAL_") && len(id) > 9 && (id[8] == '.' || id[8] == '_' || id[8] == '$') && id[9] == 'N' {
+		return "(anonymous namespace)"
+	}
+	return id
+}
+
+// unnamedTypeName parses the names of unnamed types and lambdas, which are numbered.
+func (p *itaniumParser) unnamedTypeName() string {
+	p.expect('U')
+	switch p.next() {
+	case 't':
+		return "{unnamed type#" + p.seqNumber() + "}"
+	case 'l':
+		var params string
+		if p.peek() == 'v' && p.peekAt(1) == 'E' {
+			p.pos++
+		} else {
+			var ps []string
+			for p.peek() != 'E' {
+				ps = append(ps, p.typ().String())
+			}
+			params = strings.Join(ps, ", ")
+		}
+		p.expect('E')
+		return "{lambda(" + params + ")#" + p.seqNumber() + "}"
+	}
+	p.fail()
+	return ""
+}
+
+// seqNumber parses the number of unnamed types and lambdas, _ is 1.
+func (p *itaniumParser) seqNumber() string {
+	if p.eat('_') {
+		return "1"
+	}
+	n, err := strconv.Atoi(p.number())
+	if err != nil || n < 0 {
+		p.fail()
+	}
+	p.expect('_')
+	return strconv.Itoa(n + 2)
+}
+
+var operators = map[string]string{
+	"nw": " new", "na": " new[]", "dl": " delete", "da": " delete[]",
+	"ps": "+", "ng": "-", "ad": "&", "de": "*", "co": "~",
+	"pl": "+", "mi": "-", "ml": "*", "dv": "/", "rm": "%", "an": "&", "or": "|", "eo": "^",
+	"aS": "=", "pL": "+=", "mI": "-=", "mL": "*=", "dV": "/=", "rM": "%=", "aN": "&=", "oR": "|=", "eO": "^=",
+	"ls": "<<", "rs": ">>", "lS": "<<=", "rS": ">>=",
+	"eq": "==", "ne": "!=", "lt": "<", "gt": ">", "le": "<=", "ge": ">=", "ss": "<=>",
+	"nt": "!", "aa": "&&", "oo": "||", "pp": "++", "mm": "--", "cm": ",",
+	"pm": "->*", "pt": "->", "cl": "()", "ix": "[]", "qu": "?", "aw": " co_await",
+}
+
+func (p *itaniumParser) operatorName() name {
+	if p.pos+2 > len(p.s) {
+		p.fail()
+	}
+	code := p.s[p.pos : p.pos+2]
+	p.pos += 2
+	switch code {
+	case "cv":
+		return name{s: "operator " + p.typ().String(), noReturn: true}
+	case "li":
+		return name{s: `operator"" ` + p.sourceName()}
+	}
+	op, ok := operators[code]
+	if !ok {
+		p.fail()
+	}
+	return name{s: "operator" + op}
+}
+
+// cvQualifiers parses the qualifiers of a type or member function, mangled in the order r V K
+// and printed the other way around.
+func (p *itaniumParser) cvQualifiers() string {
+	var q string
+	if p.eat('r') {
+		q = " restrict"
+	}
+	if p.eat('V') {
+		q = " volatile" + q
+	}
+	if p.eat('K') {
+		q = " const" + q
+	}
+	return q
+}
+
+var builtinTypes = map[byte]string{
+	'v': "void",
+	'w': "wchar_t",
+	'b': "bool",
+	'c': "char",
+	'a': "signed char",
+	'h': "unsigned char",
+	's': "short",
+	't': "unsigned short",
+	'i': "int",
+	'j': "unsigned int",
+	'l': "long",
+	'm': "unsigned long",
+	'x': "long long",
+	'y': "unsigned long long",
+	'n': "__int128",
+	'o': "unsigned __int128",
+	'f': "float",
+	'd': "double",
+	'e': "long double",
+	'g': "__float128",
+	'z': "...",
+}
+
+var builtinDTypes = map[byte]string{
+	'd': "decimal64",
+	'e': "decimal128",
+	'f': "decimal32",
+	'h': "half",
+	'i': "char32_t",
+	's': "char16_t",
+	'u': "char8_t",
+	'a': "auto",
+	'c': "decltype(auto)",
+	'n': "decltype(nullptr)",
+}
+
+func (p *itaniumParser) typ() ctype {
+	p.enter()
+	defer p.leave()
+	c := p.peek()
+	if s, ok := builtinTypes[c]; ok {
+		p.pos++
+		return plain(s)
+	}
+	var t ctype
+	switch {
+	case c == 'D' && builtinDTypes[p.peekAt(1)] != "":
+		p.pos += 2
+		return plain(builtinDTypes[p.s[p.pos-1]])
+	case c == 'D' && p.peekAt(1) == 'p':
+		p.pos += 2
+		t = p.packExpansion()
+	case c == 'u':
+		p.pos++
+		t = plain(p.sourceName())
+	case c == 'r' || c == 'V' || c == 'K':
+		q := p.cvQualifiers()
+		var inner ctype
+		if p.peek() == 'F' {
+			// The qualified function type of a member function is a single substitution candidate.
+			inner = p.functionType()
+		} else {
+			inner = p.typ()
+		}
+		switch {
+		case inner.declarator && strings.HasPrefix(inner.right, "("):
+			t = ctype{left: inner.left, right: inner.right + q, declarator: true}
+		case inner.declarator && strings.HasPrefix(inner.right, "["):
+			t = ctype{left: strings.TrimSuffix(inner.left, " ") + q + " ", right: inner.right, declarator: true}
+		case strings.HasSuffix(inner.left, q):
+			// Qualifiers of a template argument already qualified the same way.
+			t = inner
+		default:
+			t = ctype{left: inner.left + q, right: inner.right, declarator: inner.declarator}
+		}
+	case c == 'P' || c == 'R' || c == 'O':
+		p.pos++
+		op := map[byte]string{'P': "*", 'R': "&", 'O': "&&"}[c]
+		t = pointer(p.typ(), op)
+	case c == 'F':
+		t = p.functionType()
+	case c == 'A':
+		p.pos++
+		var dim string
+		if isDigit(p.peek()) {
+			dim = p.number()
+		} else if p.peek() != '_' {
+			p.fail()
+		}
+		p.expect('_')
+		elem := p.typ()
+		if elem.declarator && strings.HasPrefix(elem.right, "[") {
+			t = ctype{left: elem.left, right: "[" + dim + "]" + elem.right, declarator: true}
+		} else {
+			t = ctype{left: elem.String() + " ", right: "[" + dim + "]", declarator: true}
+		}
+	case c == 'M':
+		p.pos++
+		class := p.typ().String()
+		member := p.typ()
+		if member.declarator {
+			t = ctype{left: member.left + "(" + class + "::*", right: ")" + member.right}
+		} else {
+			t = plain(member.String() + " " + class + "::*")
+		}
+	case c == 'T':
+		t = p.templateParam()
+		if p.peek() == 'I' {
+			p.addSub(t)
+			_, s := p.templateArgList()
+			t = plain(t.String() + s)
+		}
+	case c == 'S' && p.peekAt(1) != 't':
+		sub := p.substitution()
+		if p.peek() != 'I' {
+			return sub
+		}
+		_, s := p.templateArgList()
+		t = plain(sub.String() + s)
+	case c == 'N' || c == 'Z' || c == 'S' || isDigit(c):
+		t = plain(p.name().s)
+	default:
+		p.fail()
+	}
+	p.addSub(t)
+	return t
+}
+
+func (p *itaniumParser) functionType() ctype {
+	p.expect('F')
+	p.eat('Y')
+	ret := p.typ()
+	var params []ctype
+	if p.peek() == 'v' && p.peekAt(1) == 'E' {
+		p.pos++
+	}
+	for p.peek() != 'E' && !((p.peek() == 'R' || p.peek() == 'O') && p.peekAt(1) == 'E') {
+		params = append(params, p.typ())
+	}
+	var ref string
+	switch {
+	case p.eat('R'):
+		ref = " &"
+	case p.eat('O'):
+		ref = " &&"
+	}
+	p.expect('E')
+	list := "(" + joinTypes(params) + ")" + ref
+	if ret.right != "" {
+		// Functions returning pointers to functions or arrays.
+		return ctype{left: ret.left, right: list + ret.right, declarator: true}
+	}
+	return ctype{left: ret.String() + " ", right: list, declarator: true}
+}
+
+// pointer returns the pointer or reference of the given kind to t.
+func pointer(t ctype, op string) ctype {
+	switch {
+	case strings.HasSuffix(t.left, "&") && op != "*":
+		// References to references collapse, to an lvalue one unless both are rvalue ones.
+		if op == "&" && strings.HasSuffix(t.left, "&&") {
+			t.left = strings.TrimSuffix(t.left, "&")
+		}
+		return t
+	case t.declarator && strings.HasPrefix(t.right, "["):
+		return ctype{left: t.left + "(" + op, right: ") " + t.right}
+	case t.declarator:
+		return ctype{left: t.left + "(" + op, right: ")" + t.right}
+	case t.right != "":
+		// Already a pointer to a function or array.
+		return ctype{left: t.left + op, right: t.right}
+	default:
+		return ctype{left: t.left + op}
+	}
+}
+
+// standardSubs are the abbreviations of the standard library, expanded as c++filt does.
+var standardSubs = map[byte]string{
+	'a': "std::allocator",
+	'b': "std::basic_string",
+	's': "std::basic_string<char, std::char_traits<char>, std::allocator<char>>",
+	'i': "std::basic_istream<char, std::char_traits<char>>",
+	'o': "std::basic_ostream<char, std::char_traits<char>>",
+	'd': "std::basic_iostream<char, std::char_traits<char>>",
+}
+
+func (p *itaniumParser) substitution() ctype {
+	p.expect('S')
+	c := p.next()
+	if s, ok := standardSubs[c]; ok {
+		return plain(s)
+	}
+	i := 0
+	if c != '_' {
+		for ; c != '_'; c = p.next() {
+			var d int
+			switch {
+			case isDigit(c):
+				d = int(c - '0')
+			case isUpper(c):
+				d = int(c-'A') + 10
+			default:
+				p.fail()
+			}
+			i = i*36 + d
+			if i > len(p.subs) {
+				p.fail()
+			}
+		}
+		i++
+	}
+	if i >= len(p.subs) {
+		p.fail()
+	}
+	t := p.subs[i]
+	if t.param > 0 && t.param <= len(p.templateArgs) && !p.templateArgs[t.param-1].isPack {
+		t = p.templateArgs[t.param-1]
+	}
+	t.param = 0
+	return t
+}
+
+func (p *itaniumParser) templateParam() ctype {
+	p.expect('T')
+	i := 0
+	if !p.eat('_') {
+		n, err := strconv.Atoi(p.number())
+		if err != nil || n < 0 {
+			p.fail()
+		}
+		p.expect('_')
+		i = n + 1
+	}
+	if i >= len(p.templateArgs) {
+		p.fail()
+	}
+	t := p.templateArgs[i]
+	t.param = i + 1
+	if !t.isPack || p.packIndex < 0 {
+		return t
+	}
+	if p.packLen < 0 {
+		p.packLen = len(t.pack)
+	}
+	if p.packIndex >= len(t.pack) {
+		return ctype{}
+	}
+	return t.pack[p.packIndex]
+}
+
+// packExpansion parses the pattern of a pack expansion once for every element of the packs it
+// refers to, and returns the list of the expansions.
+func (p *itaniumParser) packExpansion() ctype {
+	savedIndex, savedLen := p.packIndex, p.packLen
+	defer func() { p.packIndex, p.packLen = savedIndex, savedLen }()
+
+	start := p.pos
+	p.packIndex, p.packLen = 0, -1
+	first := p.typ()
+	if p.packLen < 0 {
+		// The pattern refers to no pack known here.
+		return ctype{left: first.left + "...", right: first.right}
+	}
+	end, subs := p.pos, len(p.subs)
+	var elems []ctype
+	if p.packLen > 0 {
+		elems = append(elems, first)
+	}
+	size := len(first.String())
+	for i := 1; i < p.packLen; i++ {
+		p.pos, p.packIndex = start, i
+		t := p.typ()
+		p.subs = p.subs[:subs]
+		if size += len(t.String()); size > maxLength {
+			p.fail()
+		}
+		elems = append(elems, t)
+	}
+	p.pos = end
+	return plain(joinTypes(elems))
+}
+
+// templateArgList parses the template arguments and returns them along with their list.
+func (p *itaniumParser) templateArgList() ([]ctype, string) {
+	p.enter()
+	defer p.leave()
+	p.expect('I')
+	var args []ctype
+	for !p.eat('E') {
+		args = append(args, p.templateArg())
+	}
+	return args, "<" + joinTypes(args) + ">"
+}
+
+func (p *itaniumParser) templateArg() ctype {
+	switch p.peek() {
+	case 'L':
+		return plain(p.literal())
+	case 'J':
+		// Argument packs.
+		p.pos++
+		t := ctype{isPack: true}
+		for !p.eat('E') {
+			t.pack = append(t.pack, p.templateArg())
+		}
+		return t
+	case 'X':
+		// Of the expressions only the addresses of functions and variables are supported, c++filt
+		// prints their names.
+		p.pos++
+		if !strings.HasPrefix(p.s[p.pos:], "adL") {
+			p.fail()
+		}
+		p.pos += 3
+		p.eat('_')
+		p.expect('Z')
+		_, n, _ := p.function()
+		p.expect('E')
+		p.expect('E')
+		if n.templateArgs != nil {
+			return plain("&(" + n.s + ")")
+		}
+		return plain("&" + n.s)
+	}
+	return p.typ()
+}
+
+// literal parses an integer or bool literal of a template argument, or the address of an
+// external name.
+func (p *itaniumParser) literal() string {
+	p.expect('L')
+	if p.eat('_') {
+		p.expect('Z')
+		s := p.encoding(true)
+		p.expect('E')
+		return s
+	}
+	if p.peek() == 'Z' {
+		p.pos++
+		s := p.encoding(true)
+		p.expect('E')
+		return s
+	}
+	typeCode := p.peek()
+	t := p.typ()
+	if p.eat('E') {
+		return "(" + t.String() + ")"
+	}
+	v := p.number()
+	p.expect('E')
+	switch typeCode {
+	case 'b':
+		switch v {
+		case "0":
+			return "false"
+		case "1":
+			return "true"
+		}
+	case 'i':
+		return v
+	case 'j':
+		return v + "u"
+	case 'l':
+		return v + "l"
+	case 'm':
+		return v + "ul"
+	case 'x':
+		return v + "ll"
+	case 'y':
+		return v + "ull"
+	}
+	return "(" + t.String() + ")" + v
+}
+
+// cloneSuffix parses a suffix of a clone, e.g. .constprop.0: a dot and a name optionally followed
+// by dot separated numbers.
+func (p *itaniumParser) cloneSuffix() string {
+	start := p.pos
+	p.expect('.')
+	for c := p.peek(); c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'); c = p.peek() {
+		p.pos++
+	}
+	for p.peek() == '.' && isDigit(p.peekAt(1)) {
+		p.pos++
+		for isDigit(p.peek()) {
+			p.pos++
+		}
+	}
+	if p.pos == start+1 {
+		p.fail()
+	}
+	return p.s[start:p.pos]
+}
+
+// baseName returns the last component of the name without its template arguments and ABI tags,
+// the name of the constructors of a class.
+func baseName(s string) string {
+	if strings.HasSuffix(s, ">") {
+		depth := 0
+		for i := len(s) - 1; i >= 0; i-- {
+			switch s[i] {
+			case '>':
+				depth++
+			case '<':
+				depth--
+			}
+			if depth == 0 {
+				s = s[:i]
+				break
+			}
+		}
+	}
+	for strings.HasSuffix(s, "]") {
+		i := strings.LastIndex(s, "[abi:")
+		if i < 0 {
+			break
+		}
+		s = s[:i]
+	}
+	if i := strings.LastIndex(s, "::"); i >= 0 {
+		s = s[i+2:]
+	}
+	return s
+}
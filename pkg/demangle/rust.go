@@ -0,0 +1,744 @@
+package demangle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLength bounds the length of demangled names, back references can expand exponentially.
+const maxLength = 64 << 10
+
+// isRustLegacy reports whether the _ZN name ends with the hash of the legacy Rust mangling, h and
+// 16 hex digits, e.g. _ZN3std2io5stdio6_print17h4b1a3b5f0a5e6c7dE.
+func isRustLegacy(s string) bool {
+	parts, ok := legacyParts(s)
+	return ok && len(parts) > 1 && isLegacyHash(parts[len(parts)-1])
+}
+
+// legacyParts returns the length prefixed components of the _ZN...E name. LLVM suffixes, e.g.
+// .llvm.1234, may follow.
+func legacyParts(s string) ([]string, bool) {
+	s = strings.TrimPrefix(s, "_ZN")
+	var parts []string
+	for len(s) > 0 {
+		if s[0] == 'E' {
+			return parts, len(s) == 1 || s[1] == '.'
+		}
+		i, n := 0, 0
+		for i < len(s) && isDigit(s[i]) {
+			n = n*10 + int(s[i]-'0')
+			i++
+			if n > len(s) {
+				return nil, false
+			}
+		}
+		if i == 0 || i+n > len(s) {
+			return nil, false
+		}
+		parts = append(parts, s[i:i+n])
+		s = s[i+n:]
+	}
+	return nil, false
+}
+
+func isLegacyHash(s string) bool {
+	if len(s) != 17 || s[0] != 'h' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// legacyEscapes are the escapes of the characters of Rust paths not allowed in symbols.
+var legacyEscapes = map[string]string{
+	"SP": "@",
+	"BP": "*",
+	"RF": "&",
+	"LT": "<",
+	"GT": ">",
+	"LP": "(",
+	"RP": ")",
+	"C":  ",",
+}
+
+// rustLegacy demangles the legacy Rust mangling, leaving out the hash.
+func rustLegacy(s string) (string, error) {
+	parts, _ := legacyParts(s)
+	var b strings.Builder
+	for i, p := range parts[:len(parts)-1] {
+		if i > 0 {
+			b.WriteString("::")
+		}
+		if strings.HasPrefix(p, "_$") {
+			p = p[1:]
+		}
+		for len(p) > 0 {
+			switch {
+			case strings.HasPrefix(p, ".."):
+				b.WriteString("::")
+				p = p[2:]
+			case p[0] == '$':
+				end := strings.IndexByte(p[1:], '$')
+				if end < 0 {
+					return "", errUnsupported
+				}
+				esc := p[1 : end+1]
+				p = p[end+2:]
+				if r, ok := legacyEscapes[esc]; ok {
+					b.WriteString(r)
+					continue
+				}
+				if !strings.HasPrefix(esc, "u") {
+					return "", errUnsupported
+				}
+				c, err := strconv.ParseUint(esc[1:], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(c)) {
+					return "", errUnsupported
+				}
+				b.WriteRune(rune(c))
+			default:
+				b.WriteByte(p[0])
+				p = p[1:]
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// isRustV0 reports whether the name has the prefix of the v0 Rust mangling followed by a path or
+// the version of the encoding.
+func isRustV0(s string) bool {
+	return len(s) > 2 && strings.HasPrefix(s, "_R") && (isUpper(s[2]) || isDigit(s[2]))
+}
+
+// rustV0 demangles the v0 Rust mangling of RFC 2603, leaving out the disambiguators of the crates
+// and the instantiating crate.
+func rustV0(s string) (_ string, err error) {
+	p := &v0Parser{s: s[2:]}
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errUnsupported {
+				panic(r)
+			}
+			err = errUnsupported
+		}
+	}()
+	if len(p.s) > 0 && isDigit(p.s[0]) {
+		// Versions of the encoding other than the first are not defined.
+		return "", errUnsupported
+	}
+	p.path(true)
+	return p.out.String(), nil
+}
+
+// v0Parser prints a v0 mangled name as it parses it. Back references are printed by parsing
+// again from the position they refer to.
+type v0Parser struct {
+	s     string
+	pos   int
+	out   strings.Builder
+	depth int
+	// skip suppresses the output while greater than zero, e.g. for the paths of impls.
+	skip int
+	// bound is the number of lifetimes bound by the enclosing binders.
+	bound uint64
+}
+
+func (p *v0Parser) fail() {
+	panic(errUnsupported)
+}
+
+func (p *v0Parser) write(s string) {
+	if p.skip > 0 {
+		return
+	}
+	if p.out.Len()+len(s) > maxLength {
+		p.fail()
+	}
+	p.out.WriteString(s)
+}
+
+func (p *v0Parser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *v0Parser) next() byte {
+	if p.pos >= len(p.s) {
+		p.fail()
+	}
+	c := p.s[p.pos]
+	p.pos++
+	return c
+}
+
+func (p *v0Parser) eat(c byte) bool {
+	if p.peek() == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *v0Parser) enter() {
+	p.depth++
+	if p.depth > maxDepth {
+		p.fail()
+	}
+}
+
+func (p *v0Parser) leave() { p.depth-- }
+
+// base62 parses a base-62-number, "_" is 0 and digits are followed by "_" and one more.
+func (p *v0Parser) base62() uint64 {
+	if p.eat('_') {
+		return 0
+	}
+	var n uint64
+	for {
+		c := p.next()
+		if c == '_' {
+			break
+		}
+		var d uint64
+		switch {
+		case isDigit(c):
+			d = uint64(c - '0')
+		case c >= 'a' && c <= 'z':
+			d = uint64(c-'a') + 10
+		case isUpper(c):
+			d = uint64(c-'A') + 36
+		default:
+			p.fail()
+		}
+		if n > (1<<64-1-d)/62 {
+			p.fail()
+		}
+		n = n*62 + d
+	}
+	if n == 1<<64-1 {
+		p.fail()
+	}
+	return n + 1
+}
+
+// opt62 parses an optional base-62-number introduced by the tag, one more than it or zero.
+func (p *v0Parser) opt62(tag byte) uint64 {
+	if !p.eat(tag) {
+		return 0
+	}
+	n := p.base62()
+	if n == 1<<64-1 {
+		p.fail()
+	}
+	return n + 1
+}
+
+func (p *v0Parser) decimal() int {
+	start := p.pos
+	if p.peek() == '0' {
+		p.pos++
+		return 0
+	}
+	n := 0
+	for isDigit(p.peek()) {
+		n = n*10 + int(p.next()-'0')
+		if n > len(p.s) {
+			p.fail()
+		}
+	}
+	if p.pos == start {
+		p.fail()
+	}
+	return n
+}
+
+// ident parses an identifier and returns its disambiguator and its name.
+func (p *v0Parser) ident() (uint64, string) {
+	dis := p.opt62('s')
+	return dis, p.undisambiguatedIdent()
+}
+
+func (p *v0Parser) undisambiguatedIdent() string {
+	puny := p.eat('u')
+	n := p.decimal()
+	p.eat('_')
+	if p.pos+n > len(p.s) {
+		p.fail()
+	}
+	name := p.s[p.pos : p.pos+n]
+	p.pos += n
+	if puny {
+		decoded, ok := punycode(name)
+		if !ok {
+			p.fail()
+		}
+		return decoded
+	}
+	return name
+}
+
+// backref runs fn at the position the back reference refers to, which precedes it.
+func (p *v0Parser) backref(fn func()) {
+	start := p.pos - 1
+	target := p.base62()
+	if target >= uint64(start) {
+		p.fail()
+	}
+	p.enter()
+	defer p.leave()
+	saved := p.pos
+	p.pos = int(target)
+	fn()
+	p.pos = saved
+}
+
+// path prints a path, the generic arguments of values are introduced by ::<.
+func (p *v0Parser) path(value bool) {
+	p.enter()
+	defer p.leave()
+	switch tag := p.next(); tag {
+	case 'C':
+		_, name := p.ident()
+		p.write(name)
+	case 'N':
+		ns := p.next()
+		if !isUpper(ns) && !(ns >= 'a' && ns <= 'z') {
+			p.fail()
+		}
+		p.path(value)
+		dis, name := p.ident()
+		switch {
+		case isUpper(ns):
+			kind := string(ns)
+			switch ns {
+			case 'C':
+				kind = "closure"
+			case 'S':
+				kind = "shim"
+			}
+			p.write("::{" + kind)
+			if name != "" {
+				p.write(":" + name)
+			}
+			p.write(fmt.Sprintf("#%d}", dis))
+		case name != "":
+			p.write("::" + name)
+		}
+	case 'M', 'X':
+		p.opt62('s')
+		p.skip++
+		p.path(false)
+		p.skip--
+		p.write("<")
+		p.typ()
+		if tag == 'X' {
+			p.write(" as ")
+			p.path(false)
+		}
+		p.write(">")
+	case 'Y':
+		p.write("<")
+		p.typ()
+		p.write(" as ")
+		p.path(false)
+		p.write(">")
+	case 'I':
+		p.path(value)
+		if value {
+			p.write("::")
+		}
+		p.write("<")
+		for i := 0; !p.eat('E'); i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.genericArg()
+		}
+		p.write(">")
+	case 'B':
+		p.backref(func() { p.path(value) })
+	default:
+		p.fail()
+	}
+}
+
+func (p *v0Parser) genericArg() {
+	switch {
+	case p.eat('L'):
+		p.lifetime(p.base62())
+	case p.eat('K'):
+		p.constant()
+	default:
+		p.typ()
+	}
+}
+
+// lifetime prints the lifetime of the De Bruijn index, 'a for the innermost bound one.
+func (p *v0Parser) lifetime(i uint64) {
+	if i == 0 {
+		p.write("'_")
+		return
+	}
+	if i > p.bound {
+		p.fail()
+	}
+	depth := p.bound - i
+	if depth < 26 {
+		p.write("'" + string(rune('a'+depth)))
+		return
+	}
+	p.write(fmt.Sprintf("'_%d", depth))
+}
+
+// binder prints the lifetimes bound by an optional binder and returns their number.
+func (p *v0Parser) binder() uint64 {
+	if !p.eat('G') {
+		return 0
+	}
+	n := p.base62() + 1
+	if n > 1<<16 {
+		p.fail()
+	}
+	p.write("for<")
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.bound++
+		p.lifetime(1)
+	}
+	p.write("> ")
+	return n
+}
+
+var basicTypes = map[byte]string{
+	'a': "i8",
+	'b': "bool",
+	'c': "char",
+	'd': "f64",
+	'e': "str",
+	'f': "f32",
+	'h': "u8",
+	'i': "isize",
+	'j': "usize",
+	'l': "i32",
+	'm': "u32",
+	'n': "i128",
+	'o': "u128",
+	's': "i16",
+	't': "u16",
+	'u': "()",
+	'v': "...",
+	'x': "i64",
+	'y': "u64",
+	'z': "!",
+	'p': "_",
+}
+
+func (p *v0Parser) typ() {
+	p.enter()
+	defer p.leave()
+	tag := p.next()
+	if name, ok := basicTypes[tag]; ok {
+		p.write(name)
+		return
+	}
+	switch tag {
+	case 'R', 'Q':
+		p.write("&")
+		if p.eat('L') {
+			if lt := p.base62(); lt != 0 {
+				p.lifetime(lt)
+				p.write(" ")
+			}
+		}
+		if tag == 'Q' {
+			p.write("mut ")
+		}
+		p.typ()
+	case 'P':
+		p.write("*const ")
+		p.typ()
+	case 'O':
+		p.write("*mut ")
+		p.typ()
+	case 'A':
+		p.write("[")
+		p.typ()
+		p.write("; ")
+		p.constant()
+		p.write("]")
+	case 'S':
+		p.write("[")
+		p.typ()
+		p.write("]")
+	case 'T':
+		p.write("(")
+		n := 0
+		for ; !p.eat('E'); n++ {
+			if n > 0 {
+				p.write(", ")
+			}
+			p.typ()
+		}
+		if n == 1 {
+			p.write(",")
+		}
+		p.write(")")
+	case 'F':
+		bound := p.binder()
+		if p.eat('U') {
+			p.write("unsafe ")
+		}
+		if p.eat('K') {
+			abi := "C"
+			if !p.eat('C') {
+				abi = strings.ReplaceAll(p.undisambiguatedIdent(), "_", "-")
+			}
+			p.write(`extern "` + abi + `" `)
+		}
+		p.write("fn(")
+		for i := 0; !p.eat('E'); i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.typ()
+		}
+		p.write(")")
+		if p.eat('u') {
+			// Functions returning () do not print it.
+		} else {
+			p.write(" -> ")
+			p.typ()
+		}
+		p.bound -= bound
+	case 'D':
+		bound := p.binder()
+		p.write("dyn ")
+		for i := 0; !p.eat('E'); i++ {
+			if i > 0 {
+				p.write(" + ")
+			}
+			p.dynTrait()
+		}
+		p.bound -= bound
+		if !p.eat('L') {
+			p.fail()
+		}
+		if lt := p.base62(); lt != 0 {
+			p.write(" + ")
+			p.lifetime(lt)
+		}
+	case 'B':
+		p.backref(p.typ)
+	default:
+		p.pos--
+		p.path(false)
+	}
+}
+
+// dynTrait prints a trait of a trait object with the bindings of its associated types, e.g.
+// Iterator<Item = u8>.
+func (p *v0Parser) dynTrait() {
+	open := p.pathOpenGenerics()
+	for p.eat('p') {
+		if open {
+			p.write(", ")
+		} else {
+			p.write("<")
+			open = true
+		}
+		p.write(p.undisambiguatedIdent() + " = ")
+		p.typ()
+	}
+	if open {
+		p.write(">")
+	}
+}
+
+// pathOpenGenerics prints a path and reports whether it ended with generic arguments it left
+// open for the bindings of associated types.
+func (p *v0Parser) pathOpenGenerics() bool {
+	p.enter()
+	defer p.leave()
+	switch {
+	case p.eat('B'):
+		var open bool
+		p.backref(func() { open = p.pathOpenGenerics() })
+		return open
+	case p.eat('I'):
+		p.path(false)
+		p.write("<")
+		for i := 0; !p.eat('E'); i++ {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.genericArg()
+		}
+		return true
+	default:
+		p.path(false)
+		return false
+	}
+}
+
+// constant prints a const generic argument, an integer, bool or char.
+func (p *v0Parser) constant() {
+	p.enter()
+	defer p.leave()
+	tag := p.next()
+	switch tag {
+	case 'p':
+		p.write("_")
+		return
+	case 'B':
+		p.backref(p.constant)
+		return
+	}
+	neg := false
+	switch tag {
+	case 'a', 's', 'l', 'x', 'n', 'i':
+		neg = p.eat('n')
+	case 'h', 't', 'm', 'y', 'o', 'j', 'b', 'c':
+	default:
+		p.fail()
+	}
+	start := p.pos
+	for p.peek() != '_' {
+		if !isHexDigit(p.next()) {
+			p.fail()
+		}
+	}
+	digits := p.s[start:p.pos]
+	p.pos++
+	v, err := strconv.ParseUint(digits, 16, 64)
+	if digits == "" {
+		v, err = 0, nil
+	}
+	switch {
+	case err != nil:
+		// Beyond 64 bits, e.g. u128.
+		if neg {
+			p.write("-")
+		}
+		p.write("0x" + digits)
+	case tag == 'b':
+		switch v {
+		case 0:
+			p.write("false")
+		case 1:
+			p.write("true")
+		default:
+			p.fail()
+		}
+	case tag == 'c':
+		if v > utf8.MaxRune || !utf8.ValidRune(rune(v)) {
+			p.fail()
+		}
+		p.write(strconv.QuoteRune(rune(v)))
+	default:
+		if neg {
+			p.write("-")
+		}
+		p.write(strconv.FormatUint(v, 10))
+	}
+}
+
+// punycode decodes the identifiers of the v0 mangling with non-ASCII characters, punycode of
+// RFC 3492 with _ as the delimiter.
+func punycode(s string) (string, bool) {
+	const (
+		base        = 36
+		tmin        = 1
+		tmax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+	)
+	var out []rune
+	if i := strings.LastIndexByte(s, '_'); i >= 0 {
+		for _, c := range s[:i] {
+			if c >= utf8.RuneSelf {
+				return "", false
+			}
+			out = append(out, c)
+		}
+		s = s[i+1:]
+	}
+	adapt := func(delta, n int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / n
+		k := 0
+		for delta > ((base-tmin)*tmax)/2 {
+			delta /= base - tmin
+			k += base
+		}
+		return k + (base-tmin+1)*delta/(delta+skew)
+	}
+	n, bias, i := initialN, initialBias, 0
+	for first := true; len(s) > 0; first = false {
+		oldI, w := i, 1
+		for k := base; ; k += base {
+			if len(s) == 0 {
+				return "", false
+			}
+			c := s[0]
+			s = s[1:]
+			var d int
+			switch {
+			case c >= 'a' && c <= 'z':
+				d = int(c - 'a')
+			case isDigit(c):
+				d = int(c-'0') + 26
+			default:
+				return "", false
+			}
+			if d > (1<<31-i)/w {
+				return "", false
+			}
+			i += d * w
+			t := k - bias
+			if t < tmin {
+				t = tmin
+			} else if t > tmax {
+				t = tmax
+			}
+			if d < t {
+				break
+			}
+			if w > (1<<31)/(base-t) {
+				return "", false
+			}
+			w *= base - t
+		}
+		bias = adapt(i-oldI, len(out)+1, first)
+		n += i / (len(out) + 1)
+		i %= len(out) + 1
+		if n > utf8.MaxRune || len(out) > maxLength {
+			return "", false
+		}
+		out = append(out, 0)
+		copy(out[i+1:], out[i:])
+		out[i] = rune(n)
+		i++
+	}
+	return string(out), true
+}
+
+func isDigit(c byte) bool    { return c >= '0' && c <= '9' }
+func isUpper(c byte) bool    { return c >= 'A' && c <= 'Z' }
+func isHexDigit(c byte) bool { return isDigit(c) || (c >= 'a' && c <= 'f') }
@@ -0,0 +1,80 @@
+// Package digest provides the hash algorithms the contents of object files, debug files and their
+// sections are identified by, e.g. in the metadata sidecars and to skip uploads. SHA-256 is the
+// default, BLAKE3 suits storage keyed by it, xxHash is the fastest but not collision resistant.
+package digest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"lukechampine.com/blake3"
+)
+
+// Algorithm is a hash algorithm.
+type Algorithm interface {
+	// Name is the name of the algorithm, e.g. sha256.
+	Name() string
+	// New returns a new hash of the algorithm.
+	New() hash.Hash
+}
+
+var (
+	// SHA256 is SHA-256.
+	SHA256 Algorithm = &algorithm{"sha256", sha256.New}
+	// BLAKE3 is BLAKE3 with 256-bit digests.
+	BLAKE3 Algorithm = &algorithm{"blake3", func() hash.Hash { return blake3.New(32, nil) }}
+	// XXHash is the 64-bit xxHash, XXH64.
+	XXHash Algorithm = &algorithm{"xxhash", func() hash.Hash { return xxhash.New() }}
+)
+
+// Algorithms are the supported algorithms.
+var Algorithms = []Algorithm{SHA256, BLAKE3, XXHash}
+
+// algorithm is used by pointer, so the algorithms compare by identity.
+type algorithm struct {
+	name string
+	new  func() hash.Hash
+}
+
+func (a *algorithm) Name() string   { return a.name }
+func (a *algorithm) New() hash.Hash { return a.new() }
+
+// Parse returns the algorithm of the given name, SHA256 for an empty one.
+func Parse(name string) (Algorithm, error) {
+	if name == "" {
+		return SHA256, nil
+	}
+	names := make([]string, 0, len(Algorithms))
+	for _, a := range Algorithms {
+		if a.Name() == name {
+			return a, nil
+		}
+		names = append(names, a.Name())
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q, must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// Reader returns the hex encoded digest of the contents of r.
+func Reader(a Algorithm, r io.Reader) (string, error) {
+	h := a.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// File returns the hex encoded digest of the contents of the file at path.
+func File(a Algorithm, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Reader(a, f)
+}
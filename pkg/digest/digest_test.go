@@ -0,0 +1,46 @@
+package digest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	for _, tc := range []struct {
+		a    Algorithm
+		want string
+	}{
+		{SHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{BLAKE3, "ea8f163db38682925e4491c5e58d4bb3506ef8c14eb78a86e908c5624a67200f"},
+		{XXHash, "26c7827d889f6da3"},
+	} {
+		t.Run(tc.a.Name(), func(t *testing.T) {
+			got, err := Reader(tc.a, strings.NewReader("hello"))
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+
+			path := filepath.Join(t.TempDir(), "file")
+			require.NoError(t, ioutil.WriteFile(path, []byte("hello"), 0o644))
+			got, err = File(tc.a, path)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	a, err := Parse("")
+	require.NoError(t, err)
+	require.Equal(t, "sha256", a.Name())
+
+	a, err = Parse("blake3")
+	require.NoError(t, err)
+	require.Equal(t, "blake3", a.Name())
+
+	_, err = Parse("md5")
+	require.EqualError(t, err, `unsupported hash algorithm "md5", must be one of: sha256, blake3, xxhash`)
+}
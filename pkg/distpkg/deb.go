@@ -0,0 +1,338 @@
+package distpkg
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/archive"
+	"github.com/polarsignals/split-debug/pkg/sourcedate"
+)
+
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+)
+
+// arReader reads the members of an ar archive, Debian packages are ar archives.
+type arReader struct {
+	r      io.Reader
+	member io.Reader
+	// pad is the number of bytes after the member, members are aligned to 2 bytes.
+	pad int64
+}
+
+func newARReader(r io.Reader) (*arReader, error) {
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != arMagic {
+		return nil, errors.New("not an ar archive")
+	}
+	return &arReader{r: r}, nil
+}
+
+// next returns the name of the next member and a reader of its content.
+func (a *arReader) next() (string, io.Reader, error) {
+	if a.member != nil {
+		if _, err := io.Copy(ioutil.Discard, a.member); err != nil {
+			return "", nil, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, a.r, a.pad); err != nil {
+			return "", nil, err
+		}
+	}
+	hdr := make([]byte, arHeaderSize)
+	if _, err := io.ReadFull(a.r, hdr); err != nil {
+		return "", nil, err
+	}
+	if string(hdr[58:]) != "`\n" {
+		return "", nil, errors.New("invalid ar header")
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+	if err != nil || size < 0 {
+		return "", nil, errors.New("invalid ar member size")
+	}
+	a.member, a.pad = io.LimitReader(a.r, size), size%2
+	// GNU ar terminates names with a slash.
+	return strings.TrimSuffix(strings.TrimSpace(string(hdr[:16])), "/"), a.member, nil
+}
+
+// writeARMember writes a member of an ar archive with the content read from r.
+func writeARMember(w io.Writer, name string, size int64, r io.Reader) error {
+	hdr := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, sourcedate.Now().Unix(), 0, 0, 0o100644, size)
+	if _, err := io.WriteString(w, hdr); err != nil {
+		return err
+	}
+	if n, err := io.Copy(w, r); err != nil {
+		return err
+	} else if n != size {
+		return fmt.Errorf("ar member %s: wrote %d of %d bytes", name, n, size)
+	}
+	if size%2 == 1 {
+		_, err := w.Write([]byte{'\n'})
+		return err
+	}
+	return nil
+}
+
+// walkDebMember calls fn with the tarball of the Debian package whose name starts with prefix,
+// e.g. control.tar or data.tar, and its format.
+func walkDebMember(path, prefix string, fn func(r io.Reader, format archive.Format) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ar, err := newARReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read package: %w", err)
+	}
+	for {
+		name, r, err := ar.next()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("no %s member in package", prefix)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read package: %w", err)
+		}
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		format, _, ok := archive.Detect(name)
+		if !ok {
+			return fmt.Errorf("unsupported package member %s", name)
+		}
+		return fn(r, format)
+	}
+}
+
+func readDebInfo(path string) (*Info, error) {
+	var info *Info
+	err := walkDebMember(path, "control.tar", func(r io.Reader, format archive.Format) error {
+		return archive.WalkReader(r, format, func(m *archive.Member) error {
+			if memberName(m.Name) != "control" {
+				return nil
+			}
+			var err error
+			info, err = parseControl(m)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, errors.New("no control file in package")
+	}
+	return info, nil
+}
+
+// parseControl parses the fields of a Debian control file that identify the package.
+func parseControl(r io.Reader) (*Info, error) {
+	info := &Info{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), ":")
+		if !ok || strings.HasPrefix(key, " ") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Package":
+			info.Name = value
+		case "Version":
+			info.Version = value
+		case "Architecture":
+			info.Arch = value
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if info.Name == "" || info.Version == "" {
+		return nil, errors.New("control file lacks the package name or version")
+	}
+	return info, nil
+}
+
+func walkDeb(path string, fn func(m *archive.Member) error) error {
+	return walkDebMember(path, "data.tar", func(r io.Reader, format archive.Format) error {
+		return archive.WalkReader(r, format, fn)
+	})
+}
+
+// writeDebugDeb writes a -dbgsym package like the ones of dh_strip.
+func writeDebugDeb(w io.Writer, info *Info, files []File) error {
+	// The size of the data tarball precedes it, so it is staged on disk.
+	data, err := ioutil.TempFile("", "split-debug-data-*.tar.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(data.Name())
+	defer data.Close()
+
+	md5sums, installedSize, err := writeDebData(data, files)
+	if err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+	dataSize, err := data.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	buildIDs := make([]string, 0, len(files))
+	for _, f := range files {
+		buildIDs = append(buildIDs, f.BuildID)
+	}
+	var control bytes.Buffer
+	fmt.Fprintf(&control, "Package: %s-dbgsym\n", info.Name)
+	fmt.Fprintf(&control, "Source: %s\n", info.Name)
+	fmt.Fprintf(&control, "Version: %s\n", info.Version)
+	fmt.Fprintf(&control, "Auto-Built-Package: debug-symbols\n")
+	fmt.Fprintf(&control, "Architecture: %s\n", info.Arch)
+	fmt.Fprintf(&control, "Installed-Size: %d\n", (installedSize+1023)/1024)
+	fmt.Fprintf(&control, "Depends: %s (= %s)\n", info.Name, info.Version)
+	fmt.Fprintf(&control, "Section: debug\n")
+	fmt.Fprintf(&control, "Priority: optional\n")
+	fmt.Fprintf(&control, "Description: debug symbols for %s\n", info.Name)
+	fmt.Fprintf(&control, "Build-Ids: %s\n", strings.Join(buildIDs, " "))
+
+	controlTar, err := tarball([]tarFile{
+		{name: "./control", data: control.Bytes()},
+		{name: "./md5sums", data: md5sums},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write control: %w", err)
+	}
+
+	if _, err := io.WriteString(w, arMagic); err != nil {
+		return err
+	}
+	for _, m := range []struct {
+		name string
+		size int64
+		r    io.Reader
+	}{
+		{"debian-binary", 4, strings.NewReader("2.0\n")},
+		{"control.tar.gz", int64(len(controlTar)), bytes.NewReader(controlTar)},
+		{"data.tar.gz", dataSize, data},
+	} {
+		if err := writeARMember(w, m.name, m.size, m.r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDebData writes the data tarball of the debug files to w,
+// it returns their md5sums file and their total size.
+func writeDebData(w io.Writer, files []File) ([]byte, int64, error) {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	now := sourcedate.Now()
+
+	dirs := map[string]bool{}
+	var names []string
+	for _, f := range files {
+		for dir := path.Dir(DebugPath(f.BuildID)); dir != "/"; dir = path.Dir(dir) {
+			if !dirs[dir] {
+				dirs[dir] = true
+				names = append(names, dir)
+			}
+		}
+	}
+	sort.Strings(names)
+	for _, dir := range names {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "." + dir + "/", Mode: 0o755, ModTime: now}); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var (
+		md5sums bytes.Buffer
+		size    int64
+	)
+	for _, f := range files {
+		name := DebugPath(f.BuildID)
+		sum, n, err := addTarFile(tw, "."+name, f.Path, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		fmt.Fprintf(&md5sums, "%x  %s\n", sum, name[1:])
+		size += n
+	}
+	if err := tw.Close(); err != nil {
+		return nil, 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, 0, err
+	}
+	return md5sums.Bytes(), size, nil
+}
+
+// addTarFile adds the file at path to the tarball and returns its MD5 sum and size.
+func addTarFile(tw *tar.Writer, name, path string, modTime time.Time) ([]byte, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: fi.Size(), ModTime: modTime}); err != nil {
+		return nil, 0, err
+	}
+	h := md5.New()
+	if _, err := io.Copy(io.MultiWriter(tw, h), f); err != nil {
+		return nil, 0, err
+	}
+	return h.Sum(nil), fi.Size(), nil
+}
+
+type tarFile struct {
+	name string
+	data []byte
+}
+
+// tarball returns a gzip compressed tarball of the files.
+func tarball(files []tarFile) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), ModTime: sourcedate.Now()}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
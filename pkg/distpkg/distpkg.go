@@ -0,0 +1,136 @@
+// Package distpkg reads the files of Debian and RPM packages and writes the debug information
+// packages of the distributions, e.g. foo-dbgsym_1.0_amd64.deb or foo-debuginfo-1.0-1.x86_64.rpm.
+package distpkg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/archive"
+)
+
+// Format is a package format.
+type Format string
+
+// Supported package formats.
+const (
+	Deb Format = "deb"
+	RPM Format = "rpm"
+)
+
+// Detect returns the format of the package at path by its extension and the path without it.
+// It returns false if the path is not a package.
+func Detect(path string) (Format, string, bool) {
+	lower := strings.ToLower(path)
+	for _, f := range []Format{Deb, RPM} {
+		if ext := "." + string(f); strings.HasSuffix(lower, ext) {
+			return f, path[:len(path)-len(ext)], true
+		}
+	}
+	return "", "", false
+}
+
+// Info identifies a package.
+type Info struct {
+	Name    string
+	Version string
+	// Release is the release of RPM packages, the revision of Debian packages is part of the version.
+	Release string
+	Arch    string
+	// License and SourceRPM are the license and the source package of RPM packages.
+	License   string
+	SourceRPM string
+}
+
+// ReadInfo reads the name, version and architecture of the package at path.
+func ReadInfo(path string, format Format) (*Info, error) {
+	switch format {
+	case Deb:
+		return readDebInfo(path)
+	case RPM:
+		return readRPMInfo(path)
+	default:
+		return nil, fmt.Errorf("unknown package format %q", format)
+	}
+}
+
+// Walk calls fn for each regular file of the package at path in the order of its payload.
+// The member names are relative to the root file system, e.g. usr/bin/app.
+// The members are streamed, a member can only be read until fn returns.
+func Walk(path string, format Format, fn func(m *archive.Member) error) error {
+	walk := func(m *archive.Member) error {
+		m.Name = memberName(m.Name)
+		return fn(m)
+	}
+	switch format {
+	case Deb:
+		return walkDeb(path, walk)
+	case RPM:
+		return walkRPM(path, walk)
+	default:
+		return fmt.Errorf("unknown package format %q", format)
+	}
+}
+
+// memberName returns the name of the file relative to the root file system, payloads name them e.g. ./usr/bin/app.
+func memberName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// File is a debug file of a debug information package.
+type File struct {
+	// BuildID is the GNU build ID of the object file, the debug file is installed by it.
+	BuildID string
+	// Path is the path of the debug file on disk.
+	Path string
+}
+
+// DebugPath returns the path the debug file of the build ID is installed to,
+// following the .build-id convention of GDB, e.g. /usr/lib/debug/.build-id/ab/cdef.debug.
+func DebugPath(buildID string) string {
+	return "/usr/lib/debug/.build-id/" + buildID[:2] + "/" + buildID[2:] + ".debug"
+}
+
+// ValidBuildID reports whether the build ID can be installed by DebugPath.
+func ValidBuildID(buildID string) bool {
+	if len(buildID) < 4 || len(buildID)%2 != 0 {
+		return false
+	}
+	_, err := hex.DecodeString(buildID)
+	return err == nil
+}
+
+// DebugName returns the file name of the debug information package of the package,
+// following the naming conventions of the distributions.
+func DebugName(format Format, info *Info) string {
+	if format == Deb {
+		version := info.Version
+		// Epochs are not part of the file names of Debian packages.
+		if i := strings.IndexByte(version, ':'); i >= 0 {
+			version = version[i+1:]
+		}
+		return fmt.Sprintf("%s-dbgsym_%s_%s.deb", info.Name, version, info.Arch)
+	}
+	return fmt.Sprintf("%s-debuginfo-%s-%s.%s.rpm", info.Name, info.Version, info.Release, info.Arch)
+}
+
+// WriteDebug writes the debug information package of the package described by info to w,
+// it installs the debug files by their build IDs.
+func WriteDebug(w io.Writer, format Format, info *Info, files []File) error {
+	for _, f := range files {
+		if !ValidBuildID(f.BuildID) {
+			return fmt.Errorf("invalid build ID %q", f.BuildID)
+		}
+	}
+	switch format {
+	case Deb:
+		return writeDebugDeb(w, info, files)
+	case RPM:
+		return writeDebugRPM(w, info, files)
+	default:
+		return fmt.Errorf("unknown package format %q", format)
+	}
+}
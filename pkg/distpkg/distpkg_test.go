@@ -0,0 +1,109 @@
+package distpkg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/archive"
+	"github.com/polarsignals/split-debug/pkg/sourcedate"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	format, base, ok := Detect("dist/app_1.0-1_amd64.deb")
+	require.True(t, ok)
+	require.Equal(t, Deb, format)
+	require.Equal(t, "dist/app_1.0-1_amd64", base)
+
+	format, base, ok = Detect("app-1.0-1.x86_64.RPM")
+	require.True(t, ok)
+	require.Equal(t, RPM, format)
+	require.Equal(t, "app-1.0-1.x86_64", base)
+
+	_, _, ok = Detect("app.tar.gz")
+	require.False(t, ok)
+}
+
+func TestDebugName(t *testing.T) {
+	require.Equal(t, "app-dbgsym_1.0-1_amd64.deb", DebugName(Deb, &Info{Name: "app", Version: "2:1.0-1", Arch: "amd64"}))
+	require.Equal(t, "app-debuginfo-1.0-1.x86_64.rpm", DebugName(RPM, &Info{Name: "app", Version: "1.0", Release: "1", Arch: "x86_64"}))
+}
+
+func TestWriteDebug(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string]string{
+		"0123456789abcdef": "\x7fELF debug",
+		"fedcba9876543210": strings.Repeat("d", 1<<16),
+	}
+	var files []File
+	for id, data := range contents {
+		path := filepath.Join(dir, id)
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0o600))
+		files = append(files, File{BuildID: id, Path: path})
+	}
+
+	for _, tc := range []struct {
+		format Format
+		info   *Info
+		name   string
+	}{
+		{Deb, &Info{Name: "app", Version: "1.0-1", Arch: "amd64"}, "app-dbgsym"},
+		{RPM, &Info{Name: "app", Version: "1.0", Release: "1", Arch: "x86_64", License: "MIT"}, "app-debuginfo"},
+	} {
+		t.Run(string(tc.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, WriteDebug(&buf, tc.format, tc.info, files))
+			path := filepath.Join(t.TempDir(), DebugName(tc.format, tc.info))
+			require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0o644))
+
+			info, err := ReadInfo(path, tc.format)
+			require.NoError(t, err)
+			require.Equal(t, tc.name, info.Name)
+			require.Equal(t, tc.info.Version, info.Version)
+			require.Equal(t, tc.info.Arch, info.Arch)
+
+			got := map[string]string{}
+			require.NoError(t, Walk(path, tc.format, func(m *archive.Member) error {
+				data, err := ioutil.ReadAll(m)
+				require.NoError(t, err)
+				got[m.Name] = string(data)
+				return nil
+			}))
+			want := map[string]string{}
+			for id, data := range contents {
+				want[DebugPath(id)[1:]] = data
+			}
+			require.Equal(t, want, got)
+		})
+	}
+
+	require.Error(t, WriteDebug(ioutil.Discard, Deb, &Info{Name: "app"}, []File{{BuildID: "go-build-id"}}))
+}
+
+func TestWriteDebug_SourceDateEpoch(t *testing.T) {
+	t.Setenv(sourcedate.EnvVar, "1700000000")
+	path := filepath.Join(t.TempDir(), "0123456789abcdef")
+	require.NoError(t, ioutil.WriteFile(path, []byte("\x7fELF debug"), 0o600))
+	files := []File{{BuildID: "0123456789abcdef", Path: path}}
+
+	for _, tc := range []struct {
+		format Format
+		info   *Info
+	}{
+		{Deb, &Info{Name: "app", Version: "1.0-1", Arch: "amd64"}},
+		{RPM, &Info{Name: "app", Version: "1.0", Release: "1", Arch: "x86_64", License: "MIT"}},
+	} {
+		t.Run(string(tc.format), func(t *testing.T) {
+			var first, second bytes.Buffer
+			require.NoError(t, WriteDebug(&first, tc.format, tc.info, files))
+			time.Sleep(time.Second)
+			require.NoError(t, WriteDebug(&second, tc.format, tc.info, files))
+			require.Equal(t, first.Bytes(), second.Bytes())
+		})
+	}
+}
@@ -0,0 +1,587 @@
+package distpkg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/archive"
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+	"github.com/polarsignals/split-debug/pkg/sourcedate"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// The layout of RPM packages is documented at https://rpm-software-management.github.io/rpm/manual/format.html.
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+const rpmLeadSize = 96
+
+// Header tags, see rpmtag.h.
+const (
+	rpmTagSignatures    = 62
+	rpmTagImmutable     = 63
+	rpmTagI18NTable     = 100
+	rpmSigTagSHA256     = 273
+	rpmSigTagSize       = 1000
+	rpmSigTagPayload    = 1007
+	rpmTagName          = 1000
+	rpmTagVersion       = 1001
+	rpmTagRelease       = 1002
+	rpmTagSummary       = 1004
+	rpmTagDescription   = 1005
+	rpmTagBuildTime     = 1006
+	rpmTagSize          = 1009
+	rpmTagLicense       = 1014
+	rpmTagGroup         = 1016
+	rpmTagOS            = 1021
+	rpmTagArch          = 1022
+	rpmTagFileSizes     = 1028
+	rpmTagFileModes     = 1030
+	rpmTagFileRDevs     = 1033
+	rpmTagFileMTimes    = 1034
+	rpmTagFileDigests   = 1035
+	rpmTagFileLinkTos   = 1036
+	rpmTagFileFlags     = 1037
+	rpmTagFileUserName  = 1039
+	rpmTagFileGroupName = 1040
+	rpmTagSourceRPM     = 1044
+	rpmTagFileVerify    = 1045
+	rpmTagProvideName   = 1047
+	rpmTagRequireFlags  = 1048
+	rpmTagRequireName   = 1049
+	rpmTagRequireVer    = 1050
+	rpmTagFileDevices   = 1095
+	rpmTagFileINodes    = 1096
+	rpmTagFileLangs     = 1097
+	rpmTagProvideFlags  = 1112
+	rpmTagProvideVer    = 1113
+	rpmTagDirIndexes    = 1116
+	rpmTagBaseNames     = 1117
+	rpmTagDirNames      = 1118
+	rpmTagPayloadFormat = 1124
+	rpmTagPayloadComp   = 1125
+	rpmTagPayloadFlags  = 1126
+	rpmTagFileDigestAlg = 5011
+	rpmTagPayloadDigest = 5092
+	rpmTagPayloadAlgo   = 5093
+)
+
+// Header entry types.
+const (
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// Dependency flags and digest algorithms.
+const (
+	rpmSenseLess  = 0x02
+	rpmSenseEqual = 0x08
+	rpmSenseLib   = 0x1000000
+	rpmHashSHA256 = 8
+)
+
+// rpmHeader is a parsed header structure, the signature and the main header share it.
+type rpmHeader struct {
+	entries map[int32]rpmIndexEntry
+	data    []byte
+}
+
+type rpmIndexEntry struct {
+	typ, offset, count int32
+}
+
+// readRPMHeader reads a header structure from r and returns it with its size.
+func readRPMHeader(r io.Reader) (*rpmHeader, int, error) {
+	var preamble [16]byte
+	if _, err := io.ReadFull(r, preamble[:]); err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(preamble[:4], rpmHeaderMagic) {
+		return nil, 0, errors.New("invalid header magic")
+	}
+	count := binary.BigEndian.Uint32(preamble[8:])
+	size := binary.BigEndian.Uint32(preamble[12:])
+	// Headers are small, the limits protect against corrupted packages.
+	if count > 1<<16 || size > 256<<20 {
+		return nil, 0, errors.New("header too large")
+	}
+
+	index := make([]byte, 16*count)
+	if _, err := io.ReadFull(r, index); err != nil {
+		return nil, 0, err
+	}
+	h := &rpmHeader{entries: make(map[int32]rpmIndexEntry, count), data: make([]byte, size)}
+	if _, err := io.ReadFull(r, h.data); err != nil {
+		return nil, 0, err
+	}
+	for i := 0; i < int(count); i++ {
+		e := index[16*i:]
+		h.entries[int32(binary.BigEndian.Uint32(e))] = rpmIndexEntry{
+			typ:    int32(binary.BigEndian.Uint32(e[4:])),
+			offset: int32(binary.BigEndian.Uint32(e[8:])),
+			count:  int32(binary.BigEndian.Uint32(e[12:])),
+		}
+	}
+	return h, 16 + len(index) + len(h.data), nil
+}
+
+// string returns the string value of the tag, or the first one of arrays.
+func (h *rpmHeader) string(tag int32) string {
+	e, ok := h.entries[tag]
+	if !ok || e.offset < 0 || int(e.offset) >= len(h.data) {
+		return ""
+	}
+	switch e.typ {
+	case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+	default:
+		return ""
+	}
+	s := h.data[e.offset:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+// openRPM opens the package at path and reads its main header, the file is positioned at its payload.
+func openRPM(path string) (*os.File, *rpmHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	h, err := readRPMHeaders(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to read package: %w", err)
+	}
+	return f, h, nil
+}
+
+func readRPMHeaders(r io.Reader) (*rpmHeader, error) {
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(r, lead); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(lead[:4], rpmLeadMagic) {
+		return nil, errors.New("not an RPM package")
+	}
+	_, n, err := readRPMHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	// The signature is padded to 8 bytes.
+	if _, err := io.CopyN(ioutil.Discard, r, int64((8-n%8)%8)); err != nil {
+		return nil, err
+	}
+	h, _, err := readRPMHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	return h, nil
+}
+
+func readRPMInfo(path string) (*Info, error) {
+	f, h, err := openRPM(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info := &Info{
+		Name:      h.string(rpmTagName),
+		Version:   h.string(rpmTagVersion),
+		Release:   h.string(rpmTagRelease),
+		Arch:      h.string(rpmTagArch),
+		License:   h.string(rpmTagLicense),
+		SourceRPM: h.string(rpmTagSourceRPM),
+	}
+	if info.Name == "" || info.Version == "" {
+		return nil, errors.New("header lacks the package name or version")
+	}
+	return info, nil
+}
+
+func walkRPM(path string, fn func(m *archive.Member) error) error {
+	f, _, err := openRPM(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	payload, closer, err := decompress(f)
+	if err != nil {
+		return fmt.Errorf("failed to read payload: %w", err)
+	}
+	defer closer()
+
+	r := cpio.NewReader(payload)
+	for {
+		hdr, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read payload: %w", err)
+		}
+		if !hdr.Mode.IsRegular() {
+			continue
+		}
+		if err := fn(&archive.Member{Name: hdr.Name, Mode: os.FileMode(hdr.Mode.Perm()), Size: hdr.Size, Reader: r}); err != nil {
+			return err
+		}
+	}
+}
+
+// decompress returns a reader of the decompressed stream, the compression is detected by its magic bytes.
+func decompress(r io.Reader) (io.Reader, func(), error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gr, func() { gr.Close() }, nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0}):
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return xr, func() {}, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), func() {}, nil
+	case bytes.HasPrefix(magic, []byte("07070")):
+		return br, func() {}, nil
+	default:
+		return nil, nil, errors.New("unsupported compression")
+	}
+}
+
+// rpmIndex builds a header structure.
+type rpmIndex struct {
+	region  int32
+	entries map[int32]rpmEntry
+}
+
+type rpmEntry struct {
+	typ   int32
+	count int
+	data  []byte
+}
+
+func newRPMIndex(region int32) *rpmIndex {
+	return &rpmIndex{region: region, entries: map[int32]rpmEntry{}}
+}
+
+func (x *rpmIndex) string(tag int32, s string) {
+	x.entries[tag] = rpmEntry{typ: rpmTypeString, count: 1, data: append([]byte(s), 0)}
+}
+
+func (x *rpmIndex) strings(tag int32, ss []string) {
+	var data []byte
+	for _, s := range ss {
+		data = append(append(data, s...), 0)
+	}
+	x.entries[tag] = rpmEntry{typ: rpmTypeStringArray, count: len(ss), data: data}
+}
+
+func (x *rpmIndex) int32s(tag int32, vs ...int32) {
+	data := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(data[4*i:], uint32(v))
+	}
+	x.entries[tag] = rpmEntry{typ: rpmTypeInt32, count: len(vs), data: data}
+}
+
+func (x *rpmIndex) uint16s(tag int32, vs ...uint16) {
+	data := make([]byte, 2*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint16(data[2*i:], v)
+	}
+	x.entries[tag] = rpmEntry{typ: rpmTypeInt16, count: len(vs), data: data}
+}
+
+// bytes returns the header structure, its first entry is the region tag that marks it immutable.
+func (x *rpmIndex) bytes() []byte {
+	tags := make([]int32, 0, len(x.entries))
+	for tag := range x.entries {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	var data bytes.Buffer
+	offsets := make([]int, len(tags))
+	for i, tag := range tags {
+		e := x.entries[tag]
+		// Integers are aligned to their size.
+		align := map[int32]int{rpmTypeInt16: 2, rpmTypeInt32: 4}[e.typ]
+		if align > 0 && data.Len()%align != 0 {
+			data.Write(make([]byte, align-data.Len()%align))
+		}
+		offsets[i] = data.Len()
+		data.Write(e.data)
+	}
+	count := len(tags) + 1
+	// The region trailer points back at the start of the index.
+	trailer := data.Len()
+	data.Write(rpmIndexBytes(x.region, rpmTypeBin, int32(-16*count), 16))
+
+	var b bytes.Buffer
+	b.Write(rpmHeaderMagic)
+	b.Write(make([]byte, 4))
+	b.Write(rpmUint32s(uint32(count), uint32(data.Len())))
+	b.Write(rpmIndexBytes(x.region, rpmTypeBin, int32(trailer), 16))
+	for i, tag := range tags {
+		e := x.entries[tag]
+		b.Write(rpmIndexBytes(tag, e.typ, int32(offsets[i]), int32(e.count)))
+	}
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func rpmIndexBytes(tag, typ, offset, count int32) []byte {
+	return rpmUint32s(uint32(tag), uint32(typ), uint32(offset), uint32(count))
+}
+
+func rpmUint32s(vs ...uint32) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+// rpmFiles holds the file tags of the main header.
+type rpmFiles struct {
+	dirs       []string
+	dirIndexes []int32
+	baseNames  []string
+	sizes      []int32
+	digests    []string
+	size       int64
+}
+
+// writeRPMPayload writes the gzip compressed cpio payload of the debug files to w,
+// it returns their file tags and the size of the uncompressed payload.
+func writeRPMPayload(w io.Writer, files []File, mtime time.Time) (*rpmFiles, int64, error) {
+	gw := gzip.NewWriter(w)
+	cw := iohelper.NewCountingWriter(gw, nil)
+	pw := cpio.NewWriter(cw)
+
+	fs := &rpmFiles{}
+	dirIndex := map[string]int32{}
+	for i, file := range files {
+		name := DebugPath(file.BuildID)
+		dir, base := path.Split(name)
+		if _, ok := dirIndex[dir]; !ok {
+			dirIndex[dir] = int32(len(fs.dirs))
+			fs.dirs = append(fs.dirs, dir)
+		}
+
+		f, err := os.Open(file.Path)
+		if err != nil {
+			return nil, 0, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		if fi.Size() > math.MaxInt32 {
+			f.Close()
+			return nil, 0, fmt.Errorf("debug file %s exceeds the file size limit of RPM packages", name)
+		}
+		if err := pw.WriteHeader(&cpio.Header{
+			Name:    "." + name,
+			Mode:    cpio.TypeReg | 0o644,
+			Size:    fi.Size(),
+			Links:   1,
+			ModTime: mtime,
+			Inode:   int64(i + 1),
+		}); err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(io.MultiWriter(pw, h), f)
+		f.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		fs.dirIndexes = append(fs.dirIndexes, dirIndex[dir])
+		fs.baseNames = append(fs.baseNames, base)
+		fs.sizes = append(fs.sizes, int32(fi.Size()))
+		fs.digests = append(fs.digests, hex.EncodeToString(h.Sum(nil)))
+		fs.size += fi.Size()
+	}
+	if err := pw.Close(); err != nil {
+		return nil, 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, 0, err
+	}
+	return fs, cw.Count(), nil
+}
+
+// writeDebugRPM writes a -debuginfo package like the ones of find-debuginfo.
+func writeDebugRPM(w io.Writer, info *Info, files []File) error {
+	// The digests of the payload precede it, so it is staged on disk.
+	payload, err := ioutil.TempFile("", "split-debug-payload-*.cpio.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(payload.Name())
+	defer payload.Close()
+
+	now := sourcedate.Now()
+	payloadDigest := sha256.New()
+	fs, payloadSize, err := writeRPMPayload(io.MultiWriter(payload, payloadDigest), files, now)
+	if err != nil {
+		return fmt.Errorf("failed to write payload: %w", err)
+	}
+	compressedSize, err := payload.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := payload.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	name := info.Name + "-debuginfo"
+	evr := info.Version + "-" + info.Release
+	sourceRPM := info.SourceRPM
+	if sourceRPM == "" {
+		sourceRPM = fmt.Sprintf("%s-%s.src.rpm", info.Name, evr)
+	}
+
+	h := newRPMIndex(rpmTagImmutable)
+	h.string(rpmTagI18NTable, "C")
+	h.string(rpmTagName, name)
+	h.string(rpmTagVersion, info.Version)
+	h.string(rpmTagRelease, info.Release)
+	h.string(rpmTagSummary, "Debug information for package "+info.Name)
+	h.string(rpmTagDescription, "This package provides debug information for package "+info.Name+".")
+	h.int32s(rpmTagBuildTime, int32(now.Unix()))
+	h.int32s(rpmTagSize, int32(fs.size))
+	h.string(rpmTagLicense, info.License)
+	h.string(rpmTagGroup, "Development/Debug")
+	h.string(rpmTagOS, "linux")
+	h.string(rpmTagArch, info.Arch)
+	h.string(rpmTagSourceRPM, sourceRPM)
+
+	n := len(files)
+	modes, rdevs := make([]uint16, n), make([]uint16, n)
+	mtimes, flags, verify, devices, inodes, algos := make([]int32, n), make([]int32, n), make([]int32, n), make([]int32, n), make([]int32, n), make([]int32, n)
+	users, groups, links, langs := make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+	provides, provideFlags, provideVersions := []string{name}, []int32{rpmSenseEqual}, []string{evr}
+	for i, f := range files {
+		modes[i] = uint16(cpio.TypeReg | 0o644)
+		mtimes[i] = int32(now.Unix())
+		verify[i] = -1
+		devices[i] = 1
+		inodes[i] = int32(i + 1)
+		algos[i] = rpmHashSHA256
+		users[i], groups[i] = "root", "root"
+		provides = append(provides, "debuginfo(build-id)")
+		provideFlags = append(provideFlags, rpmSenseEqual)
+		provideVersions = append(provideVersions, f.BuildID)
+	}
+	h.strings(rpmTagBaseNames, fs.baseNames)
+	h.int32s(rpmTagDirIndexes, fs.dirIndexes...)
+	h.strings(rpmTagDirNames, fs.dirs)
+	h.int32s(rpmTagFileSizes, fs.sizes...)
+	h.uint16s(rpmTagFileModes, modes...)
+	h.uint16s(rpmTagFileRDevs, rdevs...)
+	h.int32s(rpmTagFileMTimes, mtimes...)
+	h.strings(rpmTagFileDigests, fs.digests)
+	h.strings(rpmTagFileLinkTos, links)
+	h.int32s(rpmTagFileFlags, flags...)
+	h.strings(rpmTagFileUserName, users)
+	h.strings(rpmTagFileGroupName, groups)
+	h.int32s(rpmTagFileVerify, verify...)
+	h.int32s(rpmTagFileDevices, devices...)
+	h.int32s(rpmTagFileINodes, inodes...)
+	h.strings(rpmTagFileLangs, langs)
+	h.int32s(rpmTagFileDigestAlg, rpmHashSHA256)
+	h.strings(rpmTagProvideName, provides)
+	h.int32s(rpmTagProvideFlags, provideFlags...)
+	h.strings(rpmTagProvideVer, provideVersions)
+	h.strings(rpmTagRequireName, []string{"rpmlib(CompressedFileNames)", "rpmlib(FileDigests)", "rpmlib(PayloadFilesHavePrefix)"})
+	h.int32s(rpmTagRequireFlags, rpmSenseLess|rpmSenseEqual|rpmSenseLib, rpmSenseLess|rpmSenseEqual|rpmSenseLib, rpmSenseLess|rpmSenseEqual|rpmSenseLib)
+	h.strings(rpmTagRequireVer, []string{"3.0.4-1", "4.6.0-1", "4.0-1"})
+	h.string(rpmTagPayloadFormat, "cpio")
+	h.string(rpmTagPayloadComp, "gzip")
+	h.string(rpmTagPayloadFlags, "9")
+	h.strings(rpmTagPayloadDigest, []string{hex.EncodeToString(payloadDigest.Sum(nil))})
+	h.int32s(rpmTagPayloadAlgo, rpmHashSHA256)
+	header := h.bytes()
+
+	if int64(len(header))+compressedSize > math.MaxInt32 || payloadSize > math.MaxInt32 {
+		return errors.New("debug information exceeds the size limit of RPM packages")
+	}
+	headerDigest := sha256.Sum256(header)
+	sig := newRPMIndex(rpmTagSignatures)
+	sig.string(rpmSigTagSHA256, hex.EncodeToString(headerDigest[:]))
+	sig.int32s(rpmSigTagSize, int32(int64(len(header))+compressedSize))
+	sig.int32s(rpmSigTagPayload, int32(payloadSize))
+	signature := sig.bytes()
+
+	if _, err := w.Write(rpmLead(name + "-" + evr)); err != nil {
+		return err
+	}
+	if _, err := w.Write(signature); err != nil {
+		return err
+	}
+	if _, err := w.Write(make([]byte, (8-len(signature)%8)%8)); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, payload)
+	return err
+}
+
+// rpmLead returns the lead of a binary package, rpm only checks its magic.
+func rpmLead(name string) []byte {
+	b := make([]byte, rpmLeadSize)
+	copy(b, rpmLeadMagic)
+	b[4] = 3 // Major version.
+	b[9] = 1 // Architecture, unused.
+	// The name is NUL terminated.
+	copy(b[10:75], name)
+	binary.BigEndian.PutUint16(b[76:], 1) // Linux.
+	binary.BigEndian.PutUint16(b[78:], 5) // Header-style signature.
+	return b
+}
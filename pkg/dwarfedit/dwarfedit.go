@@ -0,0 +1,475 @@
+// Package dwarfedit rewrites the DWARF sections of ELF files.
+//
+// debug/dwarf only decodes DWARF, to rewrite it the positions of the attribute
+// values are needed, so this package walks the units of .debug_info itself.
+// Values are patched in place where possible, e.g. offsets into other sections,
+// sections are only rebuilt when contents have to be dropped.
+package dwarfedit
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnsupported is returned for DWARF that cannot be rewritten, e.g. of unknown versions.
+	ErrUnsupported = errors.New("unsupported DWARF")
+
+	errTruncated = errors.New("truncated DWARF")
+	// errSkipUnit stops walking the rest of a unit.
+	errSkipUnit = errors.New("skip unit")
+)
+
+// form is an attribute form, debug/dwarf does not export them.
+type form uint16
+
+// https://dwarfstd.org/doc/DWARF5.pdf - 7.5.6 Form Encodings
+const (
+	formAddr          form = 0x01
+	formBlock2        form = 0x03
+	formBlock4        form = 0x04
+	formData2         form = 0x05
+	formData4         form = 0x06
+	formData8         form = 0x07
+	formString        form = 0x08
+	formBlock         form = 0x09
+	formBlock1        form = 0x0a
+	formData1         form = 0x0b
+	formFlag          form = 0x0c
+	formSdata         form = 0x0d
+	formStrp          form = 0x0e
+	formUdata         form = 0x0f
+	formRefAddr       form = 0x10
+	formRef1          form = 0x11
+	formRef2          form = 0x12
+	formRef4          form = 0x13
+	formRef8          form = 0x14
+	formRefUdata      form = 0x15
+	formIndirect      form = 0x16
+	formSecOffset     form = 0x17
+	formExprloc       form = 0x18
+	formFlagPresent   form = 0x19
+	formStrx          form = 0x1a
+	formAddrx         form = 0x1b
+	formRefSup4       form = 0x1c
+	formStrpSup       form = 0x1d
+	formData16        form = 0x1e
+	formLineStrp      form = 0x1f
+	formRefSig8       form = 0x20
+	formImplicitConst form = 0x21
+	formLoclistx      form = 0x22
+	formRnglistx      form = 0x23
+	formRefSup8       form = 0x24
+	formStrx1         form = 0x25
+	formStrx2         form = 0x26
+	formStrx3         form = 0x27
+	formStrx4         form = 0x28
+	formAddrx1        form = 0x29
+	formAddrx2        form = 0x2a
+	formAddrx3        form = 0x2b
+	formAddrx4        form = 0x2c
+	formGNUAddrIndex  form = 0x1f01
+	formGNUStrIndex   form = 0x1f02
+	formGNURefAlt     form = 0x1f20
+	formGNUStrpAlt    form = 0x1f21
+)
+
+// unit is a unit of .debug_info.
+type unit struct {
+	off    uint64 // offset of the unit header.
+	length uint64 // length of the unit including its header.
+	header uint64 // length of the unit header, the first DIE follows it.
+
+	version   uint16
+	is64      bool
+	addrSize  uint8
+	abbrevOff uint64
+	abbrevPos uint64 // offset of the abbreviation offset in the header.
+}
+
+// offsetSize is the size of offsets into other sections.
+func (u *unit) offsetSize() int {
+	if u.is64 {
+		return 8
+	}
+	return 4
+}
+
+// end is the offset past the unit.
+func (u *unit) end() uint64 {
+	return u.off + u.length
+}
+
+// readUnits parses the unit headers of .debug_info.
+func readUnits(info []byte, bo binary.ByteOrder) ([]unit, error) {
+	var units []unit
+	for off := uint64(0); off < uint64(len(info)); {
+		b := &buf{data: info, off: off, bo: bo}
+		u := unit{off: off}
+		length, is64 := b.initialLength()
+		u.is64 = is64
+		u.length = b.off - off + length
+		u.version = b.u16()
+		switch {
+		case u.version >= 2 && u.version <= 4:
+			u.abbrevPos = b.off
+			u.abbrevOff = b.offset(is64)
+			u.addrSize = b.u8()
+		case u.version == 5:
+			unitType := b.u8()
+			u.addrSize = b.u8()
+			u.abbrevPos = b.off
+			u.abbrevOff = b.offset(is64)
+			switch unitType {
+			case 0x02, 0x06: // DW_UT_type, DW_UT_split_type
+				b.skip(8)
+				b.offset(is64)
+			case 0x04, 0x05: // DW_UT_skeleton, DW_UT_split_compile
+				b.skip(8)
+			}
+		default:
+			return nil, fmt.Errorf("%w: version %d of unit at %#x", ErrUnsupported, u.version, off)
+		}
+		if b.err != nil || u.end() > uint64(len(info)) {
+			return nil, fmt.Errorf("%w: unit at %#x", errTruncated, off)
+		}
+		u.header = b.off - off
+		units = append(units, u)
+		off = u.end()
+	}
+	return units, nil
+}
+
+// unitAt returns the index of the unit that contains off, or -1.
+func unitAt(units []unit, off uint64) int {
+	lo, hi := 0, len(units)
+	for lo < hi {
+		m := (lo + hi) / 2
+		switch {
+		case off < units[m].off:
+			hi = m
+		case off >= units[m].end():
+			lo = m + 1
+		default:
+			return m
+		}
+	}
+	return -1
+}
+
+// attrSpec is an attribute of an abbreviation.
+type attrSpec struct {
+	attr          dwarf.Attr
+	form          form
+	implicitConst int64
+}
+
+// abbrev is an abbreviation of a DIE.
+type abbrev struct {
+	tag      dwarf.Tag
+	children bool
+	attrs    []attrSpec
+}
+
+// readAbbrevs parses the abbreviation table at off.
+func readAbbrevs(data []byte, off uint64, bo binary.ByteOrder) (map[uint64]*abbrev, error) {
+	abbrevs := map[uint64]*abbrev{}
+	b := &buf{data: data, off: off, bo: bo}
+	for {
+		code := b.uleb()
+		if code == 0 || b.err != nil {
+			break
+		}
+		a := &abbrev{tag: dwarf.Tag(b.uleb()), children: b.u8() != 0}
+		for {
+			attr, f := dwarf.Attr(b.uleb()), form(b.uleb())
+			if b.err != nil || (attr == 0 && f == 0) {
+				break
+			}
+			spec := attrSpec{attr: attr, form: f}
+			if f == formImplicitConst {
+				spec.implicitConst = b.sleb()
+			}
+			a.attrs = append(a.attrs, spec)
+		}
+		abbrevs[code] = a
+	}
+	if b.err != nil {
+		return nil, fmt.Errorf("%w: abbreviations at %#x", errTruncated, off)
+	}
+	return abbrevs, nil
+}
+
+// abbrevTables parses the abbreviation tables of .debug_abbrev once, units usually share them.
+type abbrevTables struct {
+	data   []byte
+	bo     binary.ByteOrder
+	tables map[uint64]map[uint64]*abbrev
+}
+
+func newAbbrevTables(data []byte, bo binary.ByteOrder) *abbrevTables {
+	return &abbrevTables{data: data, bo: bo, tables: map[uint64]map[uint64]*abbrev{}}
+}
+
+// at returns the abbreviation table at off.
+func (t *abbrevTables) at(off uint64) (map[uint64]*abbrev, error) {
+	if table, ok := t.tables[off]; ok {
+		return table, nil
+	}
+	table, err := readAbbrevs(t.data, off, t.bo)
+	if err != nil {
+		return nil, err
+	}
+	t.tables[off] = table
+	return table, nil
+}
+
+// value is an attribute value of a DIE in .debug_info.
+type value struct {
+	die   uint64 // offset of the DIE.
+	depth int    // depth of the DIE, the unit DIE is at depth 0.
+	tag   dwarf.Tag
+	attr  dwarf.Attr
+	form  form
+	off   uint64 // offset of the value.
+	size  uint64 // size of the value.
+}
+
+// walk calls fn for the attribute values of all DIEs of the unit, in order.
+// The rest of the unit is skipped if fn returns errSkipUnit.
+func walk(info []byte, bo binary.ByteOrder, tables *abbrevTables, u *unit, fn func(v value) error) error {
+	abbrevs, err := tables.at(u.abbrevOff)
+	if err != nil {
+		return err
+	}
+	b := &buf{data: info[:u.end()], off: u.off + u.header, bo: bo}
+	depth := 0
+	for b.off < u.end() {
+		die := b.off
+		code := b.uleb()
+		if b.err != nil {
+			break
+		}
+		if code == 0 {
+			depth--
+			continue
+		}
+		a, ok := abbrevs[code]
+		if !ok {
+			return fmt.Errorf("%w: unknown abbreviation %d at %#x", ErrUnsupported, code, die)
+		}
+		for _, spec := range a.attrs {
+			f := spec.form
+			for f == formIndirect {
+				f = form(b.uleb())
+			}
+			start := b.off
+			if err := b.skipForm(f, u); err != nil {
+				return fmt.Errorf("%w at %#x", err, die)
+			}
+			if b.err != nil {
+				break
+			}
+			if err := fn(value{
+				die: die, depth: depth, tag: a.tag, attr: spec.attr, form: f,
+				off: start, size: b.off - start,
+			}); err != nil {
+				if err == errSkipUnit {
+					return nil
+				}
+				return err
+			}
+		}
+		if a.children {
+			depth++
+		}
+	}
+	if b.err != nil {
+		return fmt.Errorf("%w: unit at %#x", errTruncated, u.off)
+	}
+	return nil
+}
+
+// buf decodes DWARF data, the first error is kept in err.
+type buf struct {
+	data []byte
+	off  uint64
+	bo   binary.ByteOrder
+	err  error
+}
+
+func (b *buf) bytes(n uint64) []byte {
+	if b.err != nil || n > uint64(len(b.data)) || b.off > uint64(len(b.data))-n {
+		b.err = errTruncated
+		return nil
+	}
+	p := b.data[b.off : b.off+n]
+	b.off += n
+	return p
+}
+
+func (b *buf) skip(n uint64) { b.bytes(n) }
+
+func (b *buf) u8() uint8 {
+	if p := b.bytes(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (b *buf) u16() uint16 {
+	if p := b.bytes(2); p != nil {
+		return b.bo.Uint16(p)
+	}
+	return 0
+}
+
+func (b *buf) u32() uint32 {
+	if p := b.bytes(4); p != nil {
+		return b.bo.Uint32(p)
+	}
+	return 0
+}
+
+func (b *buf) u64() uint64 {
+	if p := b.bytes(8); p != nil {
+		return b.bo.Uint64(p)
+	}
+	return 0
+}
+
+func (b *buf) offset(is64 bool) uint64 {
+	if is64 {
+		return b.u64()
+	}
+	return uint64(b.u32())
+}
+
+// initialLength reads a unit length and reports whether the unit uses the 64-bit format.
+func (b *buf) initialLength() (uint64, bool) {
+	length := uint64(b.u32())
+	if length == 0xffffffff {
+		return b.u64(), true
+	}
+	return length, false
+}
+
+func (b *buf) uleb() uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		c := b.u8()
+		if b.err != nil {
+			return 0
+		}
+		if shift < 64 {
+			v |= uint64(c&0x7f) << shift
+		}
+		if c&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func (b *buf) sleb() int64 {
+	var v int64
+	var shift uint
+	for {
+		c := b.u8()
+		if b.err != nil {
+			return 0
+		}
+		if shift < 64 {
+			v |= int64(c&0x7f) << shift
+		}
+		shift += 7
+		if c&0x80 == 0 {
+			if shift < 64 && c&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v
+		}
+	}
+}
+
+func (b *buf) cstring() {
+	for b.err == nil && b.u8() != 0 {
+	}
+}
+
+// skipForm skips a value of the given form.
+func (b *buf) skipForm(f form, u *unit) error {
+	offsetSize := uint64(u.offsetSize())
+	switch f {
+	case formFlagPresent, formImplicitConst:
+	case formData1, formRef1, formFlag, formStrx1, formAddrx1:
+		b.skip(1)
+	case formData2, formRef2, formStrx2, formAddrx2:
+		b.skip(2)
+	case formStrx3, formAddrx3:
+		b.skip(3)
+	case formData4, formRef4, formRefSup4, formStrx4, formAddrx4:
+		b.skip(4)
+	case formData8, formRef8, formRefSig8, formRefSup8:
+		b.skip(8)
+	case formData16:
+		b.skip(16)
+	case formAddr:
+		b.skip(uint64(u.addrSize))
+	case formRefAddr:
+		if u.version == 2 {
+			b.skip(uint64(u.addrSize))
+		} else {
+			b.skip(offsetSize)
+		}
+	case formStrp, formSecOffset, formStrpSup, formLineStrp, formGNURefAlt, formGNUStrpAlt:
+		b.skip(offsetSize)
+	case formSdata:
+		b.sleb()
+	case formUdata, formRefUdata, formStrx, formAddrx, formLoclistx, formRnglistx, formGNUAddrIndex, formGNUStrIndex:
+		b.uleb()
+	case formString:
+		b.cstring()
+	case formBlock1:
+		b.skip(uint64(b.u8()))
+	case formBlock2:
+		b.skip(uint64(b.u16()))
+	case formBlock4:
+		b.skip(uint64(b.u32()))
+	case formBlock, formExprloc:
+		b.skip(b.uleb())
+	default:
+		return fmt.Errorf("%w: form %#x", ErrUnsupported, uint16(f))
+	}
+	return nil
+}
+
+// readUint reads an unsigned value of the given size.
+func readUint(data []byte, bo binary.ByteOrder, size uint64) uint64 {
+	switch size {
+	case 1:
+		return uint64(data[0])
+	case 2:
+		return uint64(bo.Uint16(data))
+	case 4:
+		return uint64(bo.Uint32(data))
+	case 8:
+		return bo.Uint64(data)
+	}
+	return 0
+}
+
+// putUint writes an unsigned value of the given size.
+func putUint(data []byte, bo binary.ByteOrder, size, v uint64) {
+	switch size {
+	case 1:
+		data[0] = byte(v)
+	case 2:
+		bo.PutUint16(data, uint16(v))
+	case 4:
+		bo.PutUint32(data, uint32(v))
+	case 8:
+		bo.PutUint64(data, v)
+	}
+}
@@ -0,0 +1,129 @@
+package dwarfedit
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+)
+
+// Editor rewrites the DWARF sections of an ELF file, and its symbol table for redactions,
+// each edit applies on top of the previous ones.
+// The file itself is not modified, the rewritten sections are collected in the result.
+type Editor struct {
+	f   *elf.File
+	res Result
+}
+
+// Result holds the sections rewritten by the edits.
+type Result struct {
+	// Sections are the rewritten contents of the DWARF sections by name,
+	// they are uncompressed.
+	Sections map[string][]byte
+	// Dropped are the sections that no longer match the rewritten ones
+	// and have to be dropped, e.g. indexes.
+	Dropped []string
+
+	// Units is the number of dropped units.
+	Units int
+	// Referenced is the number of units that were kept, even though they were rejected,
+	// because kept units refer to them.
+	Referenced int
+	// Paths is the number of remapped paths.
+	Paths int
+	// Unmapped is the number of paths that match a prefix map but cannot be rewritten in place.
+	Unmapped int
+	// MacroRefs is the number of abbreviations whose references to macro information are cleared.
+	MacroRefs int
+	// Redacted is the number of redacted names of symbols and DIEs.
+	Redacted int
+}
+
+// NewEditor returns an editor for the DWARF of f.
+func NewEditor(f *elf.File) (*Editor, error) {
+	if f.Type == elf.ET_REL {
+		// The relocations of the DWARF sections refer to the offsets before rewriting.
+		return nil, fmt.Errorf("%w: relocatable object", ErrUnsupported)
+	}
+	if f.Section(".zdebug_info") != nil {
+		return nil, fmt.Errorf("%w: .zdebug_info", ErrUnsupported)
+	}
+	return &Editor{f: f, res: Result{Sections: map[string][]byte{}}}, nil
+}
+
+// Result returns the sections rewritten by the edits so far.
+func (e *Editor) Result() *Result {
+	return &e.res
+}
+
+// DWARF returns the DWARF data of the file with the rewritten sections.
+func (e *Editor) DWARF() (*dwarf.Data, error) {
+	var sections [8][]byte
+	for i, name := range []string{
+		".debug_abbrev", ".debug_aranges", ".debug_frame", ".debug_info",
+		".debug_line", ".debug_pubnames", ".debug_ranges", ".debug_str",
+	} {
+		data, err := e.Section(name)
+		if err != nil {
+			return nil, err
+		}
+		sections[i] = data
+	}
+	d, err := dwarf.New(sections[0], sections[1], sections[2], sections[3], sections[4], sections[5], sections[6], sections[7])
+	if err != nil {
+		return nil, err
+	}
+	// Sections of DWARF 5.
+	for _, name := range []string{".debug_addr", ".debug_line_str", ".debug_str_offsets", ".debug_rnglists", ".debug_loclists"} {
+		data, err := e.Section(name)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		if err := d.AddSection(name, data); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Section returns the contents of the named section, rewritten or read from the file.
+// It returns nil if there is no such section or it is dropped.
+func (e *Editor) Section(name string) ([]byte, error) {
+	if data, ok := e.res.Sections[name]; ok {
+		return data, nil
+	}
+	for _, dropped := range e.res.Dropped {
+		if dropped == name {
+			return nil, nil
+		}
+	}
+	s := e.f.Section(name)
+	if s == nil || s.Type == elf.SHT_NOBITS {
+		return nil, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// set replaces the contents of the named section.
+func (e *Editor) set(name string, data []byte) {
+	e.res.Sections[name] = data
+}
+
+// drop drops the named section if the file has it.
+func (e *Editor) drop(name string) {
+	if e.f.Section(name) == nil {
+		return
+	}
+	for _, dropped := range e.res.Dropped {
+		if dropped == name {
+			return
+		}
+	}
+	e.res.Dropped = append(e.res.Dropped, name)
+}
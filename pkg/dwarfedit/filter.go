@@ -0,0 +1,281 @@
+package dwarfedit
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+)
+
+// Unit describes a compilation unit to decide whether it is kept.
+type Unit struct {
+	// Name is the DW_AT_name of the unit, usually the path of the primary source file.
+	Name string
+	// CompDir is the DW_AT_comp_dir of the unit, the directory it was compiled in.
+	CompDir string
+}
+
+// indexSections are rebuilt from the units by their producers, they are dropped
+// instead of being rewritten.
+var indexSections = []string{".debug_names", ".gdb_index"}
+
+// setSections are made of sets that refer to units by their offset in .debug_info.
+var setSections = []string{
+	".debug_aranges",
+	".debug_pubnames",
+	".debug_pubtypes",
+	".debug_gnu_pubnames",
+	".debug_gnu_pubtypes",
+}
+
+// FilterUnits drops the compilation units that keep rejects, along with their line programs
+// and their sets in .debug_aranges and the name lookup tables.
+// Units that the kept units refer to are kept as well, e.g. the ones holding shared types.
+// Strings are kept, since they are shared between units.
+//
+// No sections are rewritten if no units are dropped.
+func (e *Editor) FilterUnits(keep func(u Unit) bool) error {
+	info, err := e.Section(".debug_info")
+	if err != nil || info == nil {
+		return err
+	}
+	abbrevData, err := e.Section(".debug_abbrev")
+	if err != nil {
+		return err
+	}
+	bo := e.f.ByteOrder
+	tables := newAbbrevTables(abbrevData, bo)
+	units, err := readUnits(info, bo)
+	if err != nil {
+		return err
+	}
+
+	data, err := e.DWARF()
+	if err != nil {
+		return fmt.Errorf("failed to read DWARF: %w", err)
+	}
+	kept := make([]bool, len(units))
+	for i := range kept {
+		kept[i] = true
+	}
+	// Offsets of the line programs of the compilation units, -1 if they have none.
+	lines := make([]int64, len(units))
+	for i := range lines {
+		lines[i] = -1
+	}
+	r := data.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read DWARF entries: %w", err)
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag == dwarf.TagCompileUnit {
+			name, _ := e.Val(dwarf.AttrName).(string)
+			compDir, _ := e.Val(dwarf.AttrCompDir).(string)
+			if i := unitAt(units, uint64(e.Offset)); i >= 0 {
+				kept[i] = keep(Unit{Name: name, CompDir: compDir})
+				if off, ok := e.Val(dwarf.AttrStmtList).(int64); ok {
+					lines[i] = off
+				}
+			}
+		}
+		if e.Children {
+			r.SkipChildren()
+		}
+	}
+
+	// Walk the kept units for the offsets to patch, keeping the units they refer to.
+	var (
+		refs       = make([][]value, len(units))
+		stmtLists  = make([]*value, len(units))
+		queue      []int
+		walked     = make([]bool, len(units))
+		referenced int
+		lineOffset = func(v value) uint64 { return readUint(info[v.off:], bo, v.size) }
+	)
+	for i := range units {
+		if kept[i] {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if walked[i] {
+			continue
+		}
+		walked[i] = true
+		err := walk(info, bo, tables, &units[i], func(v value) error {
+			switch {
+			case v.form == formRefAddr:
+				refs[i] = append(refs[i], v)
+				if j := unitAt(units, readUint(info[v.off:], bo, v.size)); j >= 0 && !kept[j] {
+					kept[j] = true
+					referenced++
+					queue = append(queue, j)
+				}
+			case v.attr == dwarf.AttrStmtList && v.depth == 0 && isOffsetForm(v.form):
+				v := v
+				stmtLists[i] = &v
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Offsets of the kept units in the rewritten .debug_info.
+	newOff := make([]uint64, len(units))
+	var size uint64
+	var dropped int
+	for i, u := range units {
+		if !kept[i] {
+			dropped++
+			continue
+		}
+		newOff[i] = size
+		size += u.length
+	}
+	e.res.Referenced += referenced
+	if dropped == 0 {
+		return nil
+	}
+	e.res.Units += dropped
+	remap := func(off uint64) (uint64, bool) {
+		i := unitAt(units, off)
+		if i < 0 || !kept[i] {
+			return 0, false
+		}
+		return newOff[i] + off - units[i].off, true
+	}
+
+	newInfo := make([]byte, 0, size)
+	for i, u := range units {
+		if !kept[i] {
+			continue
+		}
+		newInfo = append(newInfo, info[u.off:u.end()]...)
+		for _, v := range refs[i] {
+			p := newInfo[newOff[i]+v.off-u.off:]
+			if off, ok := remap(readUint(p, bo, v.size)); ok {
+				putUint(p, bo, v.size, off)
+			}
+		}
+	}
+	e.set(".debug_info", newInfo)
+
+	// Drop the line programs only the dropped units refer to.
+	line, err := e.Section(".debug_line")
+	if err != nil {
+		return err
+	}
+	if line != nil {
+		// Line programs are only dropped if no kept unit refers to them.
+		used := map[uint64]bool{}
+		for i, off := range lines {
+			if off >= 0 && !kept[i] {
+				used[uint64(off)] = false
+			}
+		}
+		for i, v := range stmtLists {
+			if v != nil && kept[i] {
+				used[lineOffset(*v)] = true
+			}
+		}
+		newLine, lineRemap, err := filterLinePrograms(line, bo, func(off uint64) bool {
+			inUse, ok := used[off]
+			return inUse || !ok
+		})
+		if err != nil {
+			return err
+		}
+		for i, v := range stmtLists {
+			if v == nil || !kept[i] {
+				continue
+			}
+			off, ok := lineRemap[lineOffset(*v)]
+			if !ok {
+				return fmt.Errorf("%w: line program at %#x of unit at %#x", errTruncated, lineOffset(*v), units[i].off)
+			}
+			putUint(newInfo[newOff[i]+v.off-units[i].off:], bo, v.size, off)
+		}
+		e.set(".debug_line", newLine)
+	}
+
+	for _, name := range setSections {
+		data, err := e.Section(name)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			continue
+		}
+		sets, err := filterSets(data, bo, remap)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite %s: %w", name, err)
+		}
+		e.set(name, sets)
+	}
+	for _, name := range indexSections {
+		e.drop(name)
+	}
+	return nil
+}
+
+// filterLinePrograms drops the line programs of .debug_line that keep rejects by their offset.
+// It returns the new offsets of the kept ones.
+func filterLinePrograms(line []byte, bo binary.ByteOrder, keep func(off uint64) bool) ([]byte, map[uint64]uint64, error) {
+	out := make([]byte, 0, len(line))
+	offsets := map[uint64]uint64{}
+	for off := uint64(0); off < uint64(len(line)); {
+		b := &buf{data: line, off: off, bo: bo}
+		length, _ := b.initialLength()
+		end := b.off + length
+		if b.err != nil || end > uint64(len(line)) || end < b.off {
+			return nil, nil, fmt.Errorf("%w: line program at %#x", errTruncated, off)
+		}
+		if keep(off) {
+			offsets[off] = uint64(len(out))
+			out = append(out, line[off:end]...)
+		}
+		off = end
+	}
+	return out, offsets, nil
+}
+
+// filterSets rewrites the sets of .debug_aranges and the name lookup tables,
+// their headers start with the unit length, the version and the offset of the unit in .debug_info.
+// Sets of units that remap does not map are dropped.
+func filterSets(data []byte, bo binary.ByteOrder, remap func(off uint64) (uint64, bool)) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	for off := uint64(0); off < uint64(len(data)); {
+		b := &buf{data: data, off: off, bo: bo}
+		length, is64 := b.initialLength()
+		end := b.off + length
+		b.u16()
+		infoPos := b.off
+		infoOff := b.offset(is64)
+		if b.err != nil || end > uint64(len(data)) || end < b.off {
+			return nil, fmt.Errorf("%w: set at %#x", errTruncated, off)
+		}
+		if newOff, ok := remap(infoOff); ok {
+			start := uint64(len(out))
+			out = append(out, data[off:end]...)
+			size := uint64(4)
+			if is64 {
+				size = 8
+			}
+			putUint(out[start+infoPos-off:], bo, size, newOff)
+		}
+		off = end
+	}
+	return out, nil
+}
+
+// isOffsetForm reports whether values of the form can be offsets into other sections.
+func isOffsetForm(f form) bool {
+	return f == formSecOffset || f == formData4 || f == formData8
+}
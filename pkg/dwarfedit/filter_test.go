@@ -0,0 +1,144 @@
+package dwarfedit
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+)
+
+// multiUnitC is a C program of two compilation units, main.c and lib/lib.c.
+var multiUnitC = map[string]string{
+	"main.c":    "int helper(int);\nint main(void) { return helper(1); }\n",
+	"lib/lib.c": "struct box { int v; };\nint helper(int v) { struct box b = {v}; return b.v + 1; }\n",
+}
+
+// verify checks that the rewritten DWARF can be read entirely: the entries,
+// the types they refer to and the line programs of the units. It returns the names of the units.
+func verify(t *testing.T, d *dwarf.Data) []string {
+	t.Helper()
+	var names []string
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		require.NoError(t, err)
+		if e == nil {
+			break
+		}
+		if off, ok := e.Val(dwarf.AttrType).(dwarf.Offset); ok {
+			_, err := d.Type(off)
+			require.NoError(t, err, "type of entry at %#x", e.Offset)
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+		name, _ := e.Val(dwarf.AttrName).(string)
+		names = append(names, name)
+		lr, err := d.LineReader(e)
+		require.NoError(t, err)
+		if lr == nil {
+			continue
+		}
+		var le dwarf.LineEntry
+		for {
+			if err := lr.Next(&le); err != nil {
+				break
+			}
+		}
+	}
+	return names
+}
+
+func TestFilterUnits_C(t *testing.T) {
+	path := elfwritertest.BuildCFiles(t, multiUnitC, "-g", "-O0")
+	f, err := elfutils.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.Close()
+	})
+
+	e, err := NewEditor(f)
+	require.NoError(t, err)
+	require.NoError(t, e.FilterUnits(func(u Unit) bool {
+		return !strings.HasPrefix(u.Name, "lib/")
+	}))
+	res := e.Result()
+	require.Equal(t, 1, res.Units)
+	require.Zero(t, res.Referenced)
+	require.Less(t, len(res.Sections[".debug_info"]), int(f.Section(".debug_info").Size))
+	require.Less(t, len(res.Sections[".debug_line"]), int(f.Section(".debug_line").Size))
+
+	d, err := e.DWARF()
+	require.NoError(t, err)
+	names := verify(t, d)
+	require.Contains(t, names, "main.c")
+	require.NotContains(t, names, "lib/lib.c")
+
+	// The address ranges only cover the kept unit.
+	cu, err := d.Reader().SeekPC(mainAddr(t, f))
+	require.NoError(t, err)
+	require.Equal(t, "main.c", cu.Val(dwarf.AttrName))
+}
+
+func TestFilterUnits_GoReferencedUnits(t *testing.T) {
+	f, err := elfutils.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.Close()
+	})
+
+	// Go units refer to the types of the packages they import.
+	e, err := NewEditor(f)
+	require.NoError(t, err)
+	require.NoError(t, e.FilterUnits(func(u Unit) bool {
+		return u.Name == "main"
+	}))
+	res := e.Result()
+	require.NotZero(t, res.Units)
+	require.NotZero(t, res.Referenced)
+
+	d, err := e.DWARF()
+	require.NoError(t, err)
+	names := verify(t, d)
+	require.Contains(t, names, "main")
+	require.Contains(t, names, "runtime")
+	require.Len(t, names, 1+res.Referenced)
+}
+
+func TestFilterUnits_KeepAll(t *testing.T) {
+	f, err := elfutils.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.Close()
+	})
+
+	e, err := NewEditor(f)
+	require.NoError(t, err)
+	require.NoError(t, e.FilterUnits(func(Unit) bool { return true }))
+	require.Zero(t, e.Result().Units)
+	require.Empty(t, e.Result().Sections)
+}
+
+func TestNewEditor_Relocatable(t *testing.T) {
+	f := &elf.File{FileHeader: elf.FileHeader{Type: elf.ET_REL}}
+	_, err := NewEditor(f)
+	require.ErrorIs(t, err, ErrUnsupported)
+}
+
+func mainAddr(t *testing.T, f *elf.File) uint64 {
+	t.Helper()
+	syms, err := f.Symbols()
+	require.NoError(t, err)
+	for _, s := range syms {
+		if s.Name == "main" {
+			return s.Value
+		}
+	}
+	t.Fatal("main not found")
+	return 0
+}
@@ -0,0 +1,127 @@
+package dwarfedit
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+)
+
+// dwAttrGNUMacros is DW_AT_GNU_macros, the GNU extension DWARF 5 standardized as DW_AT_macros.
+const dwAttrGNUMacros dwarf.Attr = 0x2119
+
+// dwAttrHiUser is DW_AT_hi_user, cleared attributes are renamed to it.
+// Consumers skip the attributes they do not know.
+const dwAttrHiUser dwarf.Attr = 0x3fff
+
+// isMacroAttr reports whether the attribute refers to the macro information of a unit.
+func isMacroAttr(a dwarf.Attr) bool {
+	return a == dwarf.AttrMacroInfo || a == dwarf.AttrMacros || a == dwAttrGNUMacros
+}
+
+// ClearMacroReferences clears the references of the units to their macro information,
+// e.g. DW_AT_macros, so the macro sections can be dropped.
+// The attributes are renamed to DW_AT_hi_user in the abbreviations, their values are kept,
+// so the DIEs do not move, only the abbreviation offsets of the unit headers are patched.
+func (e *Editor) ClearMacroReferences() error {
+	bo := e.f.ByteOrder
+	abbrevData, err := e.Section(".debug_abbrev")
+	if err != nil || abbrevData == nil {
+		return err
+	}
+	newAbbrev, offsets, n, err := renameAttrs(abbrevData, isMacroAttr, dwAttrHiUser)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite abbreviations: %w", err)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	for _, name := range []string{".debug_info", ".debug_types"} {
+		data, err := e.Section(name)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			continue
+		}
+		units, err := readUnits(data, bo)
+		if err != nil {
+			return err
+		}
+		for _, u := range units {
+			off, ok := offsets[u.abbrevOff]
+			if !ok {
+				return fmt.Errorf("%w: abbreviations at %#x of unit at %#x are not a table", ErrUnsupported, u.abbrevOff, u.off)
+			}
+			putUint(data[u.abbrevPos:], bo, uint64(u.offsetSize()), off)
+		}
+		e.set(name, data)
+	}
+	e.set(".debug_abbrev", newAbbrev)
+	e.res.MacroRefs += n
+	return nil
+}
+
+// renameAttrs renames the attributes of the abbreviations that match to the given one.
+// It returns the new contents, the new offsets of the abbreviation tables and the number of renamed attributes.
+func renameAttrs(data []byte, match func(dwarf.Attr) bool, to dwarf.Attr) ([]byte, map[uint64]uint64, int, error) {
+	out := make([]byte, 0, len(data))
+	offsets := map[uint64]uint64{}
+	var n int
+	b := &buf{data: data, bo: binary.LittleEndian}
+	for b.off < uint64(len(data)) {
+		offsets[b.off] = uint64(len(out))
+		for {
+			start := b.off
+			code := b.uleb()
+			if code == 0 {
+				out = append(out, data[start:b.off]...)
+				break
+			}
+			b.uleb() // tag
+			b.u8()   // children
+			out = append(out, data[start:b.off]...)
+			for b.err == nil {
+				start := b.off
+				attr := dwarf.Attr(b.uleb())
+				formStart := b.off
+				f := form(b.uleb())
+				if f == formImplicitConst {
+					b.sleb()
+				}
+				if attr == 0 && f == 0 {
+					out = append(out, data[start:b.off]...)
+					break
+				}
+				if match(attr) {
+					out = appendULEB(out, uint64(to))
+					out = append(out, data[formStart:b.off]...)
+					n++
+					continue
+				}
+				out = append(out, data[start:b.off]...)
+			}
+			if b.err != nil {
+				return nil, nil, 0, fmt.Errorf("%w: abbreviation at %#x", errTruncated, start)
+			}
+		}
+		if b.err != nil {
+			return nil, nil, 0, errTruncated
+		}
+	}
+	return out, offsets, n, nil
+}
+
+func appendULEB(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package dwarfedit
+
+import (
+	"debug/dwarf"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+)
+
+func TestClearMacroReferences(t *testing.T) {
+	for _, version := range []string{"-gdwarf-4", "-gdwarf-5"} {
+		t.Run(version, func(t *testing.T) {
+			path := elfwritertest.BuildCFiles(t, multiUnitC, "-g", "-O0", version, "-g3")
+			f, err := elfutils.Open(path)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				f.Close()
+			})
+
+			e, err := NewEditor(f)
+			require.NoError(t, err)
+			require.NoError(t, e.ClearMacroReferences())
+			require.NotZero(t, e.Result().MacroRefs)
+			// The DIEs stay in place.
+			require.Len(t, e.Result().Sections[".debug_info"], int(f.Section(".debug_info").Size))
+
+			d, err := e.DWARF()
+			require.NoError(t, err)
+			verify(t, d)
+			r := d.Reader()
+			for {
+				entry, err := r.Next()
+				require.NoError(t, err)
+				if entry == nil {
+					break
+				}
+				for _, field := range entry.Field {
+					require.False(t, isMacroAttr(field.Attr), "entry at %#x refers to macros", entry.Offset)
+				}
+				if entry.Tag == dwarf.TagCompileUnit {
+					require.NotNil(t, entry.Val(dwAttrHiUser))
+				}
+			}
+		})
+	}
+}
+
+func TestClearMacroReferences_None(t *testing.T) {
+	path := elfwritertest.BuildCFiles(t, multiUnitC, "-g", "-O0")
+	f, err := elfutils.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.Close()
+	})
+
+	e, err := NewEditor(f)
+	require.NoError(t, err)
+	require.NoError(t, e.ClearMacroReferences())
+	require.Zero(t, e.Result().MacroRefs)
+	require.Empty(t, e.Result().Sections)
+}
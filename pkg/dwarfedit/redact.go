@@ -0,0 +1,261 @@
+package dwarfedit
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"sort"
+)
+
+const (
+	// dwAttrLinkageName is DW_AT_linkage_name, debug/dwarf does not name it.
+	dwAttrLinkageName dwarf.Attr = 0x6e
+	// dwAttrMIPSLinkageName is DW_AT_MIPS_linkage_name, the name GCC used before DWARF 4.
+	dwAttrMIPSLinkageName dwarf.Attr = 0x2007
+)
+
+// Redaction returns the replacement of a name, or false if the name is kept.
+type Redaction func(name string) (string, bool)
+
+func isNameAttr(a dwarf.Attr) bool {
+	return a == dwarf.AttrName || a == dwAttrLinkageName || a == dwAttrMIPSLinkageName
+}
+
+// RedactNames replaces the names of the symbols of .symtab and the names and linkage names of the
+// DIEs that redact matches, the addresses are kept. The names of the compilation units are paths,
+// use RemapPaths for them.
+//
+// Replacements are appended to the string sections and the original strings are cleared, unless
+// kept names share their bytes. Strings referenced from other sections than .debug_info are not
+// known, e.g. the macro definitions of .debug_macro, so strings that only they share are cleared.
+// Inline names of .debug_info cannot change their length, they are overwritten with the start of
+// their replacement, padded with underscores. The name indexes are dropped.
+func (e *Editor) RedactNames(redact Redaction) error {
+	if err := e.redactSymbols(redact); err != nil {
+		return err
+	}
+	return e.redactDIENames(redact)
+}
+
+func (e *Editor) redactSymbols(redact Redaction) error {
+	symtab := e.f.Section(".symtab")
+	if symtab == nil || int(symtab.Link) >= len(e.f.Sections) {
+		return nil
+	}
+	syms, err := e.Section(".symtab")
+	if err != nil || syms == nil {
+		return err
+	}
+	strs, err := e.stringTable(e.f.Sections[symtab.Link].Name)
+	if err != nil || strs.data == nil {
+		return err
+	}
+
+	size := 16 // Elf32_Sym
+	if e.f.Class == elf.ELFCLASS64 {
+		size = 24
+	}
+	bo := e.f.ByteOrder
+	refs := newStringRefs()
+	changed := false
+	// The first symbol is the undefined one, st_name is the first field of both classes.
+	for off := size; off+size <= len(syms); off += size {
+		nameOff := uint64(bo.Uint32(syms[off:]))
+		name, ok := strs.at(nameOff)
+		if !ok || name == "" {
+			continue
+		}
+		replacement, ok := redact(name)
+		if !ok {
+			refs.keep(nameOff)
+			continue
+		}
+		bo.PutUint32(syms[off:], uint32(strs.add(replacement)))
+		refs.redact(nameOff)
+		e.res.Redacted++
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	refs.clear(strs.data)
+	e.set(".symtab", syms)
+	e.set(strs.name, strs.data)
+	return nil
+}
+
+func (e *Editor) redactDIENames(redact Redaction) error {
+	info, err := e.Section(".debug_info")
+	if err != nil || info == nil {
+		return err
+	}
+	abbrevData, err := e.Section(".debug_abbrev")
+	if err != nil {
+		return err
+	}
+	bo := e.f.ByteOrder
+	units, err := readUnits(info, bo)
+	if err != nil {
+		return err
+	}
+	strs, err := e.stringTable(".debug_str")
+	if err != nil {
+		return err
+	}
+	strOffsets, err := e.Section(".debug_str_offsets")
+	if err != nil {
+		return err
+	}
+
+	tables := newAbbrevTables(abbrevData, bo)
+	refs := newStringRefs()
+	var infoChanged, strOffsetsChanged bool
+	for i := range units {
+		u := &units[i]
+		strOffsetsBase := int64(-1)
+		var values []value
+		err := walk(info, bo, tables, u, func(v value) error {
+			if v.attr == dwarf.AttrStrOffsetsBase {
+				strOffsetsBase = int64(readUint(info[v.off:], bo, v.size))
+			}
+			values = append(values, v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, v := range values {
+			val := info[v.off : v.off+v.size]
+			// ref is the string offset held by the value, or the entry of .debug_str_offsets.
+			var ref []byte
+			switch v.form {
+			case formString:
+				if v.depth == 0 || !isNameAttr(v.attr) {
+					continue
+				}
+				if replacement, ok := redact(string(val[:len(val)-1])); ok {
+					overwrite(val[:len(val)-1], replacement)
+					e.res.Redacted++
+					infoChanged = true
+				}
+				continue
+			case formStrp:
+				ref = val
+			case formStrx, formStrx1, formStrx2, formStrx3, formStrx4:
+				if strOffsetsBase < 0 || strOffsets == nil {
+					continue
+				}
+				size := uint64(u.offsetSize())
+				entry := uint64(strOffsetsBase) + readIndex(val, bo, v.form)*size
+				if entry+size > uint64(len(strOffsets)) {
+					return fmt.Errorf("%w: string offset %#x", errTruncated, entry)
+				}
+				ref = strOffsets[entry : entry+size]
+			default:
+				continue
+			}
+
+			off := readUint(ref, bo, uint64(len(ref)))
+			name, ok := strs.at(off)
+			if !ok {
+				continue
+			}
+			if v.depth == 0 || !isNameAttr(v.attr) {
+				refs.keep(off)
+				continue
+			}
+			replacement, ok := redact(name)
+			if !ok {
+				refs.keep(off)
+				continue
+			}
+			putUint(ref, bo, uint64(len(ref)), strs.add(replacement))
+			refs.redact(off)
+			e.res.Redacted++
+			if v.form == formStrp {
+				infoChanged = true
+			} else {
+				strOffsetsChanged = true
+			}
+		}
+	}
+
+	if infoChanged {
+		e.set(".debug_info", info)
+	}
+	if strOffsetsChanged {
+		e.set(".debug_str_offsets", strOffsets)
+	}
+	if strs.changed {
+		refs.clear(strs.data)
+		e.set(strs.name, strs.data)
+	}
+	if infoChanged || strOffsetsChanged {
+		// The indexes and lookup tables hold the names as well.
+		for _, name := range indexSections {
+			e.drop(name)
+		}
+		for _, name := range setSections {
+			if name != ".debug_aranges" {
+				e.drop(name)
+			}
+		}
+	}
+	return nil
+}
+
+// overwrite replaces the inline string val with the start of s, padded with underscores.
+func overwrite(val []byte, s string) {
+	n := copy(val, s)
+	for i := n; i < len(val); i++ {
+		val[i] = '_'
+	}
+}
+
+// stringRefs tracks the references into a string section, to clear the redacted strings.
+type stringRefs struct {
+	kept     map[uint64]bool
+	redacted map[uint64]bool
+}
+
+func newStringRefs() *stringRefs {
+	return &stringRefs{kept: map[uint64]bool{}, redacted: map[uint64]bool{}}
+}
+
+func (r *stringRefs) keep(off uint64)   { r.kept[off] = true }
+func (r *stringRefs) redact(off uint64) { r.redacted[off] = true }
+
+// clear zeroes the bytes of the redacted strings that no kept string shares. Linkers merge strings
+// that are suffixes of others, so a kept string can start within a redacted one, or contain it.
+func (r *stringRefs) clear(data []byte) {
+	kept := make([]uint64, 0, len(r.kept))
+	for off := range r.kept {
+		kept = append(kept, off)
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i] < kept[j] })
+
+	for off := range r.redacted {
+		if r.kept[off] || off >= uint64(len(data)) {
+			continue
+		}
+		end := uint64(bytes.IndexByte(data[off:], 0))
+		if end == ^uint64(0) {
+			continue
+		}
+		end += off
+		i := sort.Search(len(kept), func(i int) bool { return kept[i] > off })
+		if i > 0 && bytes.IndexByte(data[kept[i-1]:off], 0) < 0 {
+			// A kept string ends with the redacted one.
+			continue
+		}
+		if i < len(kept) && kept[i] < end {
+			// A kept string is the tail of the redacted one.
+			end = kept[i]
+		}
+		for j := off; j < end; j++ {
+			data[j] = 0
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package dwarfedit
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+)
+
+func TestRedactNames_C(t *testing.T) {
+	path := elfwritertest.BuildCFiles(t, multiUnitC, "-g", "-O0")
+	f, err := elfutils.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.Close()
+	})
+
+	e, err := NewEditor(f)
+	require.NoError(t, err)
+	require.NoError(t, e.RedactNames(func(name string) (string, bool) {
+		if name == "helper" || name == "box" {
+			return "redacted_" + name[:1], true
+		}
+		return "", false
+	}))
+	res := e.Result()
+	require.NotZero(t, res.Redacted)
+	for _, name := range []string{".strtab", ".debug_str"} {
+		if data, ok := res.Sections[name]; ok {
+			require.False(t, bytes.Contains(data, []byte("helper\x00")), name)
+		}
+	}
+	require.NotContains(t, string(res.Sections[".strtab"]), "helper")
+
+	d, err := e.DWARF()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"main.c", "lib/lib.c"}, verify(t, d))
+
+	var names []string
+	r := d.Reader()
+	for {
+		entry, err := r.Next()
+		require.NoError(t, err)
+		if entry == nil {
+			break
+		}
+		if entry.Tag == dwarf.TagCompileUnit {
+			continue
+		}
+		if name, ok := entry.Val(dwarf.AttrName).(string); ok {
+			names = append(names, name)
+		}
+	}
+	require.Contains(t, names, "main")
+	require.Contains(t, names, "redacted_h")
+	// Short names are stored inline, they keep their length.
+	require.Contains(t, names, "red")
+	for _, name := range names {
+		require.False(t, strings.Contains(name, "helper") || name == "box", name)
+	}
+}
+
+func TestStringRefsClear(t *testing.T) {
+	// "per" is the tail of "helper", the linker merged them, and "other" is kept.
+	data := []byte("\x00helper\x00other\x00secret\x00")
+	refs := newStringRefs()
+	refs.redact(1)  // helper
+	refs.keep(4)    // per
+	refs.keep(8)    // other
+	refs.redact(14) // secret
+	refs.clear(data)
+	require.Equal(t, "\x00\x00\x00\x00per\x00other\x00\x00\x00\x00\x00\x00\x00\x00", string(data))
+}
@@ -0,0 +1,470 @@
+package dwarfedit
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// PrefixMap replaces the Old prefix of paths with New, like -fdebug-prefix-map of compilers.
+type PrefixMap struct {
+	Old string
+	New string
+}
+
+// remapPath applies the prefix map with the longest matching prefix to p.
+// Prefixes only match whole path elements, /build/src does not match /build/src2.
+func remapPath(maps []PrefixMap, p string) (string, bool) {
+	best := -1
+	for i, m := range maps {
+		if hasPathPrefix(p, m.Old) && (best < 0 || len(m.Old) > len(maps[best].Old)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return p, false
+	}
+	return maps[best].New + p[len(maps[best].Old):], true
+}
+
+func hasPathPrefix(p, prefix string) bool {
+	if prefix == "" || !strings.HasPrefix(p, prefix) {
+		return false
+	}
+	return len(p) == len(prefix) || strings.HasSuffix(prefix, "/") || p[len(prefix)] == '/'
+}
+
+// RemapPaths rewrites the paths of the DWARF: the compilation directories and names of the
+// compilation units and the directory and file name tables of the line programs.
+// Remapped paths referenced through offsets are appended to the string sections,
+// the line programs are rebuilt.
+//
+// Inline strings of .debug_info cannot be rewritten without moving all of the DIEs after them,
+// they are counted as unmapped instead.
+func (e *Editor) RemapPaths(maps []PrefixMap) error {
+	bo := e.f.ByteOrder
+	strs, err := e.stringTable(".debug_str")
+	if err != nil {
+		return err
+	}
+	lineStrs, err := e.stringTable(".debug_line_str")
+	if err != nil {
+		return err
+	}
+
+	// Line programs first, they move if their inline paths change.
+	var lineOffsets map[uint64]uint64
+	line, err := e.Section(".debug_line")
+	if err != nil {
+		return err
+	}
+	if line != nil {
+		newLine, offsets, n, err := remapLinePrograms(line, bo, maps, strs, lineStrs)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			e.res.Paths += n
+			e.set(".debug_line", newLine)
+			for old, off := range offsets {
+				if old != off {
+					lineOffsets = offsets
+					break
+				}
+			}
+		}
+	}
+
+	info, err := e.Section(".debug_info")
+	if err != nil || info == nil {
+		return err
+	}
+	abbrevData, err := e.Section(".debug_abbrev")
+	if err != nil {
+		return err
+	}
+	units, err := readUnits(info, bo)
+	if err != nil {
+		return err
+	}
+	strOffsets, err := e.Section(".debug_str_offsets")
+	if err != nil {
+		return err
+	}
+	macro, err := e.Section(".debug_macro")
+	if err != nil {
+		return err
+	}
+
+	tables := newAbbrevTables(abbrevData, bo)
+	var infoChanged, strOffsetsChanged, macroChanged bool
+	// Units can share macro units, their headers are only patched once.
+	patchedMacros := map[uint64]bool{}
+	for i := range units {
+		u := &units[i]
+		var (
+			paths          []value
+			strOffsetsBase = int64(-1)
+		)
+		// Only the attributes of the unit DIE are rewritten.
+		err := walk(info, bo, tables, u, func(v value) error {
+			if v.depth > 0 || v.die != u.off+u.header {
+				return errSkipUnit
+			}
+			switch v.attr {
+			case dwarf.AttrName, dwarf.AttrCompDir:
+				paths = append(paths, v)
+			case dwarf.AttrStrOffsetsBase:
+				strOffsetsBase = int64(readUint(info[v.off:], bo, v.size))
+			case dwarf.AttrStmtList:
+				if lineOffsets != nil && isOffsetForm(v.form) {
+					if off, ok := lineOffsets[readUint(info[v.off:], bo, v.size)]; ok {
+						putUint(info[v.off:], bo, v.size, off)
+						infoChanged = true
+					}
+				}
+			case dwarf.AttrMacros, dwAttrGNUMacros:
+				if off := readUint(info[v.off:], bo, v.size); lineOffsets != nil && macro != nil && isOffsetForm(v.form) && !patchedMacros[off] {
+					patchedMacros[off] = true
+					if patchMacroLineOffset(macro, bo, off, lineOffsets) {
+						macroChanged = true
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, v := range paths {
+			val := info[v.off : v.off+v.size]
+			switch v.form {
+			case formString:
+				if _, ok := remapPath(maps, string(val[:len(val)-1])); ok {
+					e.res.Unmapped++
+				}
+			case formStrp, formLineStrp:
+				t := strs
+				if v.form == formLineStrp {
+					t = lineStrs
+				}
+				if t.remap(maps, val, bo) {
+					e.res.Paths++
+					infoChanged = true
+				}
+			case formStrx, formStrx1, formStrx2, formStrx3, formStrx4:
+				if strOffsetsBase < 0 || strOffsets == nil {
+					continue
+				}
+				size := uint64(u.offsetSize())
+				entry := uint64(strOffsetsBase) + readIndex(val, bo, v.form)*size
+				if entry+size > uint64(len(strOffsets)) {
+					return fmt.Errorf("%w: string offset %#x", errTruncated, entry)
+				}
+				if strs.remap(maps, strOffsets[entry:entry+size], bo) {
+					e.res.Paths++
+					strOffsetsChanged = true
+				}
+			}
+		}
+	}
+
+	if infoChanged {
+		e.set(".debug_info", info)
+	}
+	if strOffsetsChanged {
+		e.set(".debug_str_offsets", strOffsets)
+	}
+	if macroChanged {
+		e.set(".debug_macro", macro)
+	}
+	for _, t := range []*stringTable{strs, lineStrs} {
+		if t.changed {
+			e.set(t.name, t.data)
+		}
+	}
+	if lineOffsets != nil {
+		// Unlike the unit offsets of the indexes, their paths are not rewritten.
+		for _, name := range indexSections {
+			e.drop(name)
+		}
+	}
+	return nil
+}
+
+// remapLinePrograms rewrites the paths of the directory and file name tables of the line programs.
+// It returns the new contents, the new offsets of the programs and the number of remapped paths.
+func remapLinePrograms(line []byte, bo binary.ByteOrder, maps []PrefixMap, strs, lineStrs *stringTable) ([]byte, map[uint64]uint64, int, error) {
+	out := make([]byte, 0, len(line))
+	offsets := map[uint64]uint64{}
+	var paths int
+	for off := uint64(0); off < uint64(len(line)); {
+		b := &buf{data: line, off: off, bo: bo}
+		length, _ := b.initialLength()
+		end := b.off + length
+		if b.err != nil || end > uint64(len(line)) || end < b.off {
+			return nil, nil, 0, fmt.Errorf("%w: line program at %#x", errTruncated, off)
+		}
+		offsets[off] = uint64(len(out))
+		prog, n, err := remapLineProgram(line[off:end], bo, maps, strs, lineStrs)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("line program at %#x: %w", off, err)
+		}
+		out = append(out, prog...)
+		paths += n
+		off = end
+	}
+	return out, offsets, paths, nil
+}
+
+// remapLineProgram rewrites the paths of a single line program, the header is rebuilt
+// with the new tables. It returns the program and the number of remapped paths.
+func remapLineProgram(prog []byte, bo binary.ByteOrder, maps []PrefixMap, strs, lineStrs *stringTable) ([]byte, int, error) {
+	b := &buf{data: prog, bo: bo}
+	_, is64 := b.initialLength()
+	lengthSize := b.off
+	version := b.u16()
+	if version < 2 || version > 5 {
+		// Programs of unknown versions are kept as they are.
+		return prog, 0, nil
+	}
+	u := &unit{version: version, is64: is64}
+	if version == 5 {
+		u.addrSize = b.u8()
+		b.u8() // segment_selector_size
+	}
+	headerLengthPos := b.off
+	headerLength := b.offset(is64)
+	programStart := b.off + headerLength
+	b.u8() // minimum_instruction_length
+	if version >= 4 {
+		b.u8() // maximum_operations_per_instruction
+	}
+	b.skip(4) // default_is_stmt, line_base, line_range, opcode_base
+	b.skip(uint64(prog[b.off-1]) - 1)
+	tablesStart := b.off
+	if b.err != nil || programStart > uint64(len(prog)) {
+		return nil, 0, errTruncated
+	}
+
+	var (
+		tables bytes.Buffer
+		paths  int
+	)
+	// remapInline writes the path ending at b.off, including its NUL.
+	remapInline := func(start uint64) {
+		p := string(prog[start : b.off-1])
+		if mapped, ok := remapPath(maps, p); ok {
+			tables.WriteString(mapped)
+			tables.WriteByte(0)
+			paths++
+			return
+		}
+		tables.Write(prog[start:b.off])
+	}
+	if version < 5 {
+		// include_directories, terminated by an empty path.
+		for {
+			start := b.off
+			b.cstring()
+			if b.err != nil || b.off-start == 1 {
+				tables.WriteByte(0)
+				break
+			}
+			remapInline(start)
+		}
+		// file_names, terminated by an empty path, followed by the directory index,
+		// the modification time and the length of the file.
+		for {
+			start := b.off
+			b.cstring()
+			if b.err != nil || b.off-start == 1 {
+				tables.WriteByte(0)
+				break
+			}
+			remapInline(start)
+			start = b.off
+			b.uleb()
+			b.uleb()
+			b.uleb()
+			tables.Write(prog[start:b.off])
+		}
+	} else {
+		// The directory and then the file name table, both described by entry formats.
+		for table := 0; table < 2; table++ {
+			start := b.off
+			type entryFormat struct {
+				contentType uint64
+				form        form
+			}
+			formats := make([]entryFormat, b.u8())
+			for i := range formats {
+				formats[i] = entryFormat{contentType: b.uleb(), form: form(b.uleb())}
+			}
+			count := b.uleb()
+			tables.Write(prog[start:b.off])
+			for i := uint64(0); i < count && b.err == nil; i++ {
+				for _, ef := range formats {
+					start := b.off
+					if err := b.skipForm(ef.form, u); err != nil {
+						return nil, 0, err
+					}
+					if b.err != nil {
+						break
+					}
+					const lnctPath = 0x1 // DW_LNCT_path
+					if ef.contentType != lnctPath {
+						tables.Write(prog[start:b.off])
+						continue
+					}
+					switch ef.form {
+					case formString:
+						remapInline(start)
+					case formStrp, formLineStrp:
+						t := strs
+						if ef.form == formLineStrp {
+							t = lineStrs
+						}
+						val := append([]byte(nil), prog[start:b.off]...)
+						if t.remap(maps, val, bo) {
+							paths++
+						}
+						tables.Write(val)
+					default:
+						tables.Write(prog[start:b.off])
+					}
+				}
+			}
+		}
+	}
+	if b.err != nil || b.off > programStart {
+		return nil, 0, errTruncated
+	}
+	if paths == 0 {
+		return prog, 0, nil
+	}
+
+	offsetSize := uint64(u.offsetSize())
+	fixed := prog[headerLengthPos+offsetSize : tablesStart]
+	rest := prog[b.off:programStart]
+	newHeaderLength := uint64(len(fixed)) + uint64(tables.Len()) + uint64(len(rest))
+
+	out := make([]byte, 0, len(prog)+tables.Len())
+	out = append(out, prog[:headerLengthPos]...)
+	out = append(out, make([]byte, offsetSize)...)
+	putUint(out[headerLengthPos:], bo, offsetSize, newHeaderLength)
+	out = append(out, fixed...)
+	out = append(out, tables.Bytes()...)
+	out = append(out, rest...)
+	out = append(out, prog[programStart:]...)
+	// The unit length excludes itself.
+	if is64 {
+		bo.PutUint64(out[4:], uint64(len(out))-lengthSize)
+	} else {
+		bo.PutUint32(out, uint32(uint64(len(out))-lengthSize))
+	}
+	return out, paths, nil
+}
+
+// patchMacroLineOffset patches the offset of the line program in the header of the macro unit at off,
+// it reports whether the header has one.
+func patchMacroLineOffset(macro []byte, bo binary.ByteOrder, off uint64, lineOffsets map[uint64]uint64) bool {
+	b := &buf{data: macro, off: off, bo: bo}
+	b.u16() // version
+	flags := b.u8()
+	const (
+		offsetSizeFlag = 0x1
+		lineOffsetFlag = 0x2
+	)
+	if b.err != nil || flags&lineOffsetFlag == 0 {
+		return false
+	}
+	size := uint64(4)
+	if flags&offsetSizeFlag != 0 {
+		size = 8
+	}
+	pos := b.off
+	lineOff := readUint(b.bytes(size), bo, size)
+	newOff, ok := lineOffsets[lineOff]
+	if b.err != nil || !ok {
+		return false
+	}
+	putUint(macro[pos:], bo, size, newOff)
+	return true
+}
+
+// readIndex reads the index of a DW_FORM_strx form.
+func readIndex(val []byte, bo binary.ByteOrder, f form) uint64 {
+	switch f {
+	case formStrx:
+		b := &buf{data: val, bo: bo}
+		return b.uleb()
+	case formStrx3:
+		if bo == binary.BigEndian {
+			return uint64(val[0])<<16 | uint64(val[1])<<8 | uint64(val[2])
+		}
+		return uint64(val[0]) | uint64(val[1])<<8 | uint64(val[2])<<16
+	default:
+		return readUint(val, bo, uint64(len(val)))
+	}
+}
+
+// stringTable is a string section that remapped strings are appended to.
+type stringTable struct {
+	name    string
+	data    []byte
+	added   map[string]uint64
+	changed bool
+}
+
+func (e *Editor) stringTable(name string) (*stringTable, error) {
+	data, err := e.Section(name)
+	if err != nil {
+		return nil, err
+	}
+	return &stringTable{name: name, data: data, added: map[string]uint64{}}, nil
+}
+
+// remap remaps the string at the offset held by val, an offset of the size of val.
+// The offset is replaced by the one of the remapped string, it reports whether it was.
+func (t *stringTable) remap(maps []PrefixMap, val []byte, bo binary.ByteOrder) bool {
+	size := uint64(len(val))
+	p, ok := t.at(readUint(val, bo, size))
+	if !ok {
+		return false
+	}
+	mapped, ok := remapPath(maps, p)
+	if !ok {
+		return false
+	}
+	putUint(val, bo, size, t.add(mapped))
+	return true
+}
+
+// at returns the string at off.
+func (t *stringTable) at(off uint64) (string, bool) {
+	if off >= uint64(len(t.data)) {
+		return "", false
+	}
+	end := bytes.IndexByte(t.data[off:], 0)
+	if end < 0 {
+		return "", false
+	}
+	return string(t.data[off : off+uint64(end)]), true
+}
+
+// add appends s, unless it was added before, and returns its offset.
+func (t *stringTable) add(s string) uint64 {
+	if off, ok := t.added[s]; ok {
+		return off
+	}
+	off := uint64(len(t.data))
+	t.data = append(t.data, s...)
+	t.data = append(t.data, 0)
+	t.added[s] = off
+	t.changed = true
+	return off
+}
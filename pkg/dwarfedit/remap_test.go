@@ -0,0 +1,139 @@
+package dwarfedit
+
+import (
+	"debug/dwarf"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+)
+
+func TestRemapPath(t *testing.T) {
+	maps := []PrefixMap{
+		{Old: "/build", New: "/b"},
+		{Old: "/build/src", New: "/workspace"},
+		{Old: "/tmp/", New: "/t/"},
+	}
+	tests := []struct {
+		path   string
+		want   string
+		mapped bool
+	}{
+		{path: "/build/src/main.c", want: "/workspace/main.c", mapped: true},
+		{path: "/build/src", want: "/workspace", mapped: true},
+		{path: "/build/lib/lib.c", want: "/b/lib/lib.c", mapped: true},
+		{path: "/build/src2/main.c", want: "/b/src2/main.c", mapped: true},
+		{path: "/tmp/x.c", want: "/t/x.c", mapped: true},
+		{path: "/builder/main.c", want: "/builder/main.c"},
+		{path: "main.c", want: "main.c"},
+	}
+	for _, tt := range tests {
+		got, mapped := remapPath(maps, tt.path)
+		require.Equal(t, tt.want, got, tt.path)
+		require.Equal(t, tt.mapped, mapped, tt.path)
+	}
+}
+
+// lineFiles returns the file names of the line programs of the compilation units.
+func lineFiles(t *testing.T, d *dwarf.Data) []string {
+	t.Helper()
+	var files []string
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		require.NoError(t, err)
+		if e == nil {
+			return files
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		lr, err := d.LineReader(e)
+		require.NoError(t, err)
+		if lr != nil {
+			for _, f := range lr.Files() {
+				if f != nil {
+					files = append(files, f.Name)
+				}
+			}
+		}
+		r.SkipChildren()
+	}
+}
+
+func TestRemapPaths_C(t *testing.T) {
+	for _, version := range []string{"-gdwarf-4", "-gdwarf-5"} {
+		t.Run(version, func(t *testing.T) {
+			// Macros refer to the offsets of the line programs.
+			path := elfwritertest.BuildCFiles(t, multiUnitC, "-g", "-O0", version, "-g3")
+			dir := filepath.Dir(path)
+			f, err := elfutils.Open(path)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				f.Close()
+			})
+
+			e, err := NewEditor(f)
+			require.NoError(t, err)
+			require.NoError(t, e.RemapPaths([]PrefixMap{
+				{Old: dir, New: "/workspace"},
+				// Moves the line programs, the paths of the system headers are inline in DWARF 4.
+				{Old: "/usr/include", New: "/sysroot/usr/include"},
+			}))
+			require.NotZero(t, e.Result().Paths)
+			require.Zero(t, e.Result().Unmapped)
+
+			d, err := e.DWARF()
+			require.NoError(t, err)
+			verify(t, d)
+
+			r := d.Reader()
+			for {
+				cu, err := r.Next()
+				require.NoError(t, err)
+				if cu == nil {
+					break
+				}
+				require.Equal(t, "/workspace", cu.Val(dwarf.AttrCompDir))
+				r.SkipChildren()
+			}
+			files := lineFiles(t, d)
+			require.Contains(t, files, "/workspace/main.c")
+			for _, file := range files {
+				require.False(t, strings.HasPrefix(file, dir), file)
+				require.False(t, strings.HasPrefix(file, "/usr/include/"), file)
+			}
+		})
+	}
+}
+
+func TestRemapPaths_Go(t *testing.T) {
+	f, err := elfutils.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.Close()
+	})
+
+	// Go stores the paths inline in the line programs.
+	e, err := NewEditor(f)
+	require.NoError(t, err)
+	require.NoError(t, e.FilterUnits(func(u Unit) bool {
+		return !strings.HasPrefix(u.Name, "go.opentelemetry.io/")
+	}))
+	require.NoError(t, e.RemapPaths([]PrefixMap{{Old: "github.com/polarsignals/split-debug", New: "/src"}}))
+	require.NotZero(t, e.Result().Paths)
+
+	d, err := e.DWARF()
+	require.NoError(t, err)
+	verify(t, d)
+	files := lineFiles(t, d)
+	require.Contains(t, files, "/src/main.go")
+	for _, file := range files {
+		require.False(t, strings.HasPrefix(file, "github.com/polarsignals/split-debug/"), file)
+	}
+}
@@ -0,0 +1,223 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrNoBuildID is returned when an ELF file does not have a build ID note.
+	ErrNoBuildID = errors.New("build ID not found")
+
+	errMalformedNote = errors.New("malformed note")
+)
+
+const (
+	// GNUBuildIDSection is the name of the section of the GNU build ID note.
+	GNUBuildIDSection = ".note.gnu.build-id"
+	// GoBuildIDSection is the name of the section of the Go build ID note.
+	GoBuildIDSection = ".note.go.buildid"
+
+	ntGNUBuildID = 3 // NT_GNU_BUILD_ID
+	ntGoBuildID  = 4
+
+	// maxNoteSegmentSize bounds the reads of PT_NOTE segments, build ID notes are tiny.
+	maxNoteSegmentSize = 1 << 16
+	// maxProgramHeadersSize bounds the reads of the program headers of malformed files.
+	maxProgramHeadersSize = 1 << 22
+)
+
+// BuildID returns the hex encoded GNU build ID of the given ELF file.
+func BuildID(f *elf.File) (string, error) {
+	id, err := noteDesc(f, GNUBuildIDSection, "GNU", ntGNUBuildID)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// GoBuildID returns the Go build ID of the given ELF file.
+func GoBuildID(f *elf.File) (string, error) {
+	id, err := noteDesc(f, GoBuildIDSection, "Go", ntGoBuildID)
+	if err != nil {
+		return "", err
+	}
+	return string(id), nil
+}
+
+// BuildIDFromReaderAt returns the hex encoded GNU build ID of the ELF file read from r. Unlike
+// BuildID, it only reads the ELF header, the program headers and the PT_NOTE segments, a few
+// kilobytes, so the build ID of a remote file is looked up without downloading it, e.g. with
+// iohelper.HTTPReaderAt, which reads them with a single request. The build ID note is found in
+// the PT_NOTE segments of executables and shared libraries, relocatable objects and debug files
+// have no program headers.
+func BuildIDFromReaderAt(r io.ReaderAt) (string, error) {
+	var ident [elf.EI_NIDENT]byte
+	if _, err := r.ReadAt(ident[:], 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", ErrNotELF
+		}
+		return "", err
+	}
+	if !bytes.HasPrefix(ident[:], []byte(elf.ELFMAG)) {
+		return "", ErrNotELF
+	}
+	var byteOrder binary.ByteOrder
+	switch elf.Data(ident[elf.EI_DATA]) {
+	case elf.ELFDATA2LSB:
+		byteOrder = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		byteOrder = binary.BigEndian
+	default:
+		return "", fmt.Errorf("%w: unknown data encoding %d", ErrNotELF, ident[elf.EI_DATA])
+	}
+
+	var (
+		phoff, shoff                   int64
+		phentsize, phnum, minPhentsize int
+	)
+	switch elf.Class(ident[elf.EI_CLASS]) {
+	case elf.ELFCLASS32:
+		var hdr elf.Header32
+		if err := binary.Read(io.NewSectionReader(r, 0, int64(binary.Size(hdr))), byteOrder, &hdr); err != nil {
+			return "", fmt.Errorf("failed to read ELF header: %w", err)
+		}
+		phoff, phentsize, phnum = int64(hdr.Phoff), int(hdr.Phentsize), int(hdr.Phnum)
+		shoff = int64(hdr.Shoff)
+		minPhentsize = binary.Size(elf.Prog32{})
+	case elf.ELFCLASS64:
+		var hdr elf.Header64
+		if err := binary.Read(io.NewSectionReader(r, 0, int64(binary.Size(hdr))), byteOrder, &hdr); err != nil {
+			return "", fmt.Errorf("failed to read ELF header: %w", err)
+		}
+		phoff, phentsize, phnum = int64(hdr.Phoff), int(hdr.Phentsize), int(hdr.Phnum)
+		shoff = int64(hdr.Shoff)
+		minPhentsize = binary.Size(elf.Prog64{})
+	default:
+		return "", ErrUnsupportedClass
+	}
+	// With PN_XNUM program headers, their number is the sh_info of the first section header.
+	if phnum == 0xffff && shoff > 0 {
+		var err error
+		if phnum, err = extendedPhnum(r, byteOrder, elf.Class(ident[elf.EI_CLASS]), shoff); err != nil {
+			return "", err
+		}
+	}
+	if phnum == 0 || phoff <= 0 {
+		return "", ErrNoBuildID
+	}
+	if phentsize < minPhentsize || phnum*phentsize > maxProgramHeadersSize {
+		return "", fmt.Errorf("invalid program headers, %d of %d bytes", phnum, phentsize)
+	}
+
+	phdrs := make([]byte, phnum*phentsize)
+	if _, err := r.ReadAt(phdrs, phoff); err != nil {
+		return "", fmt.Errorf("failed to read program headers: %w", err)
+	}
+	for i := 0; i < phnum; i++ {
+		ph := io.NewSectionReader(bytes.NewReader(phdrs), int64(i*phentsize), int64(phentsize))
+		var typ, off, size uint64
+		if elf.Class(ident[elf.EI_CLASS]) == elf.ELFCLASS32 {
+			var p elf.Prog32
+			if err := binary.Read(ph, byteOrder, &p); err != nil {
+				return "", err
+			}
+			typ, off, size = uint64(p.Type), uint64(p.Off), uint64(p.Filesz)
+		} else {
+			var p elf.Prog64
+			if err := binary.Read(ph, byteOrder, &p); err != nil {
+				return "", err
+			}
+			typ, off, size = uint64(p.Type), p.Off, p.Filesz
+		}
+		if elf.ProgType(typ) != elf.PT_NOTE || size == 0 || size > maxNoteSegmentSize {
+			continue
+		}
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, int64(off)); err != nil {
+			return "", fmt.Errorf("failed to read note segment: %w", err)
+		}
+		desc, err := findNote(byteOrder, data, "GNU", ntGNUBuildID)
+		if errors.Is(err, ErrNoBuildID) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w in note segment %d", err, i)
+		}
+		return hex.EncodeToString(desc), nil
+	}
+	return "", ErrNoBuildID
+}
+
+// extendedPhnum returns the number of program headers stored in the sh_info of the first section header.
+func extendedPhnum(r io.ReaderAt, byteOrder binary.ByteOrder, class elf.Class, shoff int64) (int, error) {
+	if class == elf.ELFCLASS32 {
+		var sh elf.Section32
+		if err := binary.Read(io.NewSectionReader(r, shoff, int64(binary.Size(sh))), byteOrder, &sh); err != nil {
+			return 0, fmt.Errorf("failed to read section header: %w", err)
+		}
+		return int(sh.Info), nil
+	}
+	var sh elf.Section64
+	if err := binary.Read(io.NewSectionReader(r, shoff, int64(binary.Size(sh))), byteOrder, &sh); err != nil {
+		return 0, fmt.Errorf("failed to read section header: %w", err)
+	}
+	return int(sh.Info), nil
+}
+
+// noteDesc returns the descriptor of the first note with the given name and type
+// in the named section.
+func noteDesc(f *elf.File, section, name string, typ uint32) ([]byte, error) {
+	s := f.Section(section)
+	if s == nil {
+		return nil, ErrNoBuildID
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", section, err)
+	}
+	desc, err := findNote(f.ByteOrder, data, name, typ)
+	if errors.Is(err, errMalformedNote) {
+		return nil, fmt.Errorf("%w in %s", err, section)
+	}
+	return desc, err
+}
+
+// findNote returns the descriptor of the first note with the given name and type in data.
+func findNote(byteOrder binary.ByteOrder, data []byte, name string, typ uint32) ([]byte, error) {
+	// http://www.sco.com/developers/gabi/2003-12-17/ch5.pheader.html#note_section
+	for len(data) >= 12 {
+		namesz := byteOrder.Uint32(data[0:4])
+		descsz := byteOrder.Uint32(data[4:8])
+		ntype := byteOrder.Uint32(data[8:12])
+		data = data[12:]
+
+		nameEnd := align4(uint64(namesz))
+		descEnd := nameEnd + align4(uint64(descsz))
+		if uint64(len(data)) < nameEnd+uint64(descsz) {
+			return nil, errMalformedNote
+		}
+
+		// Names are NUL terminated and may be padded, e.g. "Go\x00\x00".
+		noteName := strings.TrimRight(string(data[:namesz]), "\x00")
+		if noteName == name && ntype == typ {
+			return data[nameEnd : nameEnd+uint64(descsz)], nil
+		}
+
+		if uint64(len(data)) < descEnd {
+			break
+		}
+		data = data[descEnd:]
+	}
+	return nil, ErrNoBuildID
+}
+
+func align4(n uint64) uint64 {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,87 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// readCounter counts the bytes read from the underlying io.ReaderAt.
+type readCounter struct {
+	r *bytes.Reader
+	n int
+}
+
+func (c *readCounter) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n += n
+	return n, err
+}
+
+func TestBuildIDFromReaderAt(t *testing.T) {
+	data, err := ioutil.ReadFile(elfwritertest.BuildC(t, "int main(void) { return 0; }\n", "-g", "-Wl,--build-id=sha1"))
+	require.NoError(t, err)
+	f, err := elf.NewFile(bytes.NewReader(data))
+	require.NoError(t, err)
+	want, err := BuildID(f)
+	require.NoError(t, err)
+
+	r := &readCounter{r: bytes.NewReader(data)}
+	id, err := BuildIDFromReaderAt(r)
+	require.NoError(t, err)
+	require.Equal(t, want, id)
+	// The headers and the note segments only, not the DWARF.
+	require.Less(t, r.n, 4096)
+}
+
+func TestBuildIDFromReaderAt_HTTP(t *testing.T) {
+	data, err := ioutil.ReadFile(elfwritertest.BuildC(t, "int main(void) { return 0; }\n", "-g", "-Wl,--build-id=sha1"))
+	require.NoError(t, err)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		http.ServeContent(w, r, "prog", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	r := iohelper.NewHTTPReaderAt(srv.URL, srv.Client())
+	id, err := BuildIDFromReaderAt(r)
+	require.NoError(t, err)
+	want, err := BuildIDFromReaderAt(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, want, id)
+	// The headers and notes are in the first block.
+	require.Equal(t, int32(1), requests.Load())
+
+	// The whole file is opened remotely, its sections are read on demand.
+	size, err := r.Size()
+	require.NoError(t, err)
+	f, err := elf.NewFile(io.NewSectionReader(r, 0, size))
+	require.NoError(t, err)
+	require.NoError(t, CheckDebugInfo(f))
+}
+
+func TestBuildIDFromReaderAt_NoBuildID(t *testing.T) {
+	data, err := ioutil.ReadFile(elfwritertest.BuildC(t, "int main(void) { return 0; }\n", "-g", "-Wl,--build-id=none"))
+	require.NoError(t, err)
+	_, err = BuildIDFromReaderAt(bytes.NewReader(data))
+	require.ErrorIs(t, err, ErrNoBuildID)
+}
+
+func TestBuildIDFromReaderAt_NotELF(t *testing.T) {
+	for _, data := range []string{"", "#!/bin/sh\n", "\x7fELF"} {
+		_, err := BuildIDFromReaderAt(bytes.NewReader([]byte(data)))
+		require.ErrorIs(t, err, ErrNotELF, "%q", data)
+	}
+}
@@ -0,0 +1,56 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+const debugLinkSection = ".gnu_debuglink"
+
+// ErrNoDebugLink is returned when an ELF file does not have a .gnu_debuglink section.
+var ErrNoDebugLink = errors.New("debug link not found")
+
+// DebugLink returns the file name and the CRC32 checksum of the separate debug file
+// recorded in the .gnu_debuglink section of the given ELF file.
+func DebugLink(f *elf.File) (string, uint32, error) {
+	s := f.Section(debugLinkSection)
+	if s == nil {
+		return "", 0, ErrNoDebugLink
+	}
+	data, err := s.Data()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read %s: %w", debugLinkSection, err)
+	}
+
+	// The NUL terminated file name is padded to 4 bytes and followed by the checksum.
+	end := bytes.IndexByte(data, 0)
+	if end <= 0 {
+		return "", 0, fmt.Errorf("malformed %s", debugLinkSection)
+	}
+	off := align4(uint64(end) + 1)
+	if uint64(len(data)) < off+4 {
+		return "", 0, fmt.Errorf("malformed %s", debugLinkSection)
+	}
+	return string(data[:end]), f.ByteOrder.Uint32(data[off:]), nil
+}
+
+// DebugLinkCRC computes the checksum of the file at the given path the way
+// it is recorded in .gnu_debuglink sections.
+func DebugLinkCRC(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
@@ -0,0 +1,89 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFile returns a minimal 64-bit ELF file with a single section of the given contents.
+func newTestFile(t *testing.T, name string, data []byte) *elf.File {
+	t.Helper()
+	ef, err := elf.NewFile(bytes.NewReader(newTestImage(t, name, data)))
+	require.NoError(t, err)
+	return ef
+}
+
+// newTestImage returns the image of a minimal 64-bit ELF file with a single section of the given contents.
+func newTestImage(t testing.TB, name string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Ehsize:    64,
+		Shentsize: 64,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, hdr))
+	buf.Write(data)
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+
+	f := &elf.File{FileHeader: elf.FileHeader{Class: elf.ELFCLASS64, ByteOrder: binary.LittleEndian}}
+	tail, shoff, shnum, err := sectionTable(f, []sectionSpec{{
+		name:  name,
+		typ:   elf.SHT_PROGBITS,
+		off:   64,
+		size:  uint64(len(data)),
+		align: 4,
+	}}, uint64(buf.Len()))
+	require.NoError(t, err)
+	buf.Write(tail)
+
+	image := buf.Bytes()
+	patchHeader(elf.ELFCLASS64, binary.LittleEndian, image, shoff, shnum)
+	return image
+}
+
+func TestDebugLink(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		// "app.debug" is 9 bytes, NUL terminated and padded to 12.
+		data := append([]byte("app.debug\x00\x00\x00"), 0x78, 0x56, 0x34, 0x12)
+		name, crc, err := DebugLink(newTestFile(t, debugLinkSection, data))
+		require.NoError(t, err)
+		require.Equal(t, "app.debug", name)
+		require.Equal(t, uint32(0x12345678), crc)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, _, err := DebugLink(newTestFile(t, debugLinkSection, []byte("app.debug\x00")))
+		require.Error(t, err)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, _, err := DebugLink(newTestFile(t, ".text", []byte{0xc3}))
+		require.ErrorIs(t, err, ErrNoDebugLink)
+	})
+}
+
+func TestDebugLinkCRC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.debug")
+	require.NoError(t, ioutil.WriteFile(path, []byte("123456789"), 0o600))
+
+	crc, err := DebugLinkCRC(path)
+	require.NoError(t, err)
+	// The check value of CRC-32/ISO-HDLC, which GDB uses.
+	require.Equal(t, uint32(0xcbf43926), crc)
+}
@@ -0,0 +1,424 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DT_GNU_HASH is missing from debug/elf in older Go versions.
+const dtGNUHash = elf.DynTag(0x6ffffef5)
+
+const (
+	verneedSize  = 16 // Elf_Verneed
+	vernauxSize  = 16 // Elf_Vernaux
+	verdefSize   = 20 // Elf_Verdef
+	verdauxSize  = 8  // Elf_Verdaux
+	versymSize   = 2  // Elf_Versym
+	verdefAuxOff = 12 // offset of vd_aux in Elf_Verdef
+)
+
+// dynamicSections reconstructs .dynsym, .dynstr and the symbol hash tables
+// from the dynamic segment.
+func dynamicSections(f *elf.File, dynamic *elf.Prog) ([]sectionSpec, error) {
+	data, err := readSegment(dynamic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dynamic segment: %w", err)
+	}
+
+	tags := map[elf.DynTag]uint64{}
+	entsize := int(dynEntrySize(f.Class))
+	for ; len(data) >= entsize; data = data[entsize:] {
+		var tag elf.DynTag
+		var val uint64
+		if f.Class == elf.ELFCLASS32 {
+			tag = elf.DynTag(int32(f.ByteOrder.Uint32(data[0:4])))
+			val = uint64(f.ByteOrder.Uint32(data[4:8]))
+		} else {
+			tag = elf.DynTag(int64(f.ByteOrder.Uint64(data[0:8])))
+			val = f.ByteOrder.Uint64(data[8:16])
+		}
+		if tag == elf.DT_NULL {
+			break
+		}
+		if _, ok := tags[tag]; !ok {
+			tags[tag] = val
+		}
+	}
+
+	strtab, hasStrtab := tags[elf.DT_STRTAB]
+	strsz, hasStrsz := tags[elf.DT_STRSZ]
+	symtab, hasSymtab := tags[elf.DT_SYMTAB]
+	if !hasStrtab || !hasStrsz || !hasSymtab {
+		return nil, nil
+	}
+	syment, ok := tags[elf.DT_SYMENT]
+	if !ok {
+		syment = symEntrySize(f.Class)
+	}
+
+	var specs []sectionSpec
+	add := func(spec sectionSpec) error {
+		off, err := vaddrToOffset(f, spec.addr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", spec.name, err)
+		}
+		spec.off = off
+		specs = append(specs, spec)
+		return nil
+	}
+
+	// The number of dynamic symbols is only recorded by the hash tables.
+	var nsyms uint64
+	if addr, ok := tags[dtGNUHash]; ok {
+		n, size, err := gnuHashSize(f, addr)
+		if err != nil {
+			return nil, err
+		}
+		nsyms = n
+		if err := add(sectionSpec{
+			name: ".gnu.hash", typ: elf.SHT_GNU_HASH, flags: elf.SHF_ALLOC,
+			addr: addr, size: size, link: ".dynsym", align: wordSize(f.Class),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if addr, ok := tags[elf.DT_HASH]; ok {
+		nbucket, nchain, err := readWords(f, addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .hash: %w", err)
+		}
+		nsyms = uint64(nchain)
+		if err := add(sectionSpec{
+			name: ".hash", typ: elf.SHT_HASH, flags: elf.SHF_ALLOC,
+			addr: addr, size: uint64(2+nbucket+nchain) * 4, link: ".dynsym", entsize: 4, align: 4,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if nsyms == 0 && strtab > symtab {
+		// The string table conventionally follows the symbol table.
+		nsyms = (strtab - symtab) / syment
+	}
+
+	if nsyms > 0 {
+		if err := add(sectionSpec{
+			name: ".dynsym", typ: elf.SHT_DYNSYM, flags: elf.SHF_ALLOC,
+			addr: symtab, size: nsyms * syment, link: ".dynstr", info: 1, entsize: syment, align: wordSize(f.Class),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := add(sectionSpec{
+		name: ".dynstr", typ: elf.SHT_STRTAB, flags: elf.SHF_ALLOC,
+		addr: strtab, size: strsz, align: 1,
+	}); err != nil {
+		return nil, err
+	}
+
+	// Symbol versions.
+	if addr, ok := tags[elf.DT_VERSYM]; ok && nsyms > 0 {
+		if err := add(sectionSpec{
+			name: ".gnu.version", typ: elf.SHT_GNU_VERSYM, flags: elf.SHF_ALLOC,
+			addr: addr, size: nsyms * versymSize, link: ".dynsym", entsize: versymSize, align: versymSize,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if addr, ok := tags[elf.DT_VERNEED]; ok {
+		num := tags[elf.DT_VERNEEDNUM]
+		size, err := versionTableSize(f, addr, num, verneedSize, 8, 12, vernauxSize, 12)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .gnu.version_r: %w", err)
+		}
+		if err := add(sectionSpec{
+			name: ".gnu.version_r", typ: elf.SHT_GNU_VERNEED, flags: elf.SHF_ALLOC,
+			addr: addr, size: size, link: ".dynstr", info: uint32(num), align: wordSize(f.Class),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if addr, ok := tags[elf.DT_VERDEF]; ok {
+		num := tags[elf.DT_VERDEFNUM]
+		size, err := versionTableSize(f, addr, num, verdefSize, verdefAuxOff, 16, verdauxSize, 4)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .gnu.version_d: %w", err)
+		}
+		if err := add(sectionSpec{
+			name: ".gnu.version_d", typ: elf.SHT_GNU_VERDEF, flags: elf.SHF_ALLOC,
+			addr: addr, size: size, link: ".dynstr", info: uint32(num), align: wordSize(f.Class),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return specs, nil
+}
+
+// versionTableSize returns the size of the version needed or definition table of num entries at addr.
+// Entries link to their auxiliary entries and to the next entry through relative offsets,
+// auxOff and nextOff are the positions of these links in entries, auxNextOff in auxiliary entries.
+func versionTableSize(f *elf.File, addr, num uint64, entSize, auxOff, nextOff, auxSize, auxNextOff uint64) (uint64, error) {
+	r, err := readerAtVaddr(f, addr)
+	if err != nil {
+		return 0, err
+	}
+	u32 := func(off uint64) (uint64, error) {
+		var b [4]byte
+		if _, err := r.ReadAt(b[:], int64(off)); err != nil {
+			return 0, err
+		}
+		return uint64(f.ByteOrder.Uint32(b[:])), nil
+	}
+
+	var end, entry uint64
+	for i := uint64(0); i < num; i++ {
+		if e := entry + entSize; e > end {
+			end = e
+		}
+		aux, err := u32(entry + auxOff)
+		if err != nil {
+			return 0, err
+		}
+		for aux := entry + aux; ; {
+			if e := aux + auxSize; e > end {
+				end = e
+			}
+			next, err := u32(aux + auxNextOff)
+			if err != nil {
+				return 0, err
+			}
+			if next == 0 {
+				break
+			}
+			aux += next
+		}
+		next, err := u32(entry + nextOff)
+		if err != nil {
+			return 0, err
+		}
+		if next == 0 {
+			break
+		}
+		entry += next
+	}
+	return end, nil
+}
+
+// gnuHashSize returns the number of dynamic symbols and the size of the GNU hash table at addr.
+func gnuHashSize(f *elf.File, addr uint64) (uint64, uint64, error) {
+	r, err := readerAtVaddr(f, addr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read .gnu.hash: %w", err)
+	}
+	read := func(off uint64) (uint32, error) {
+		var b [4]byte
+		if _, err := r.ReadAt(b[:], int64(off)); err != nil {
+			return 0, fmt.Errorf("failed to read .gnu.hash: %w", err)
+		}
+		return f.ByteOrder.Uint32(b[:]), nil
+	}
+
+	// https://flapenguin.me/elf-dt-gnu-hash
+	var hdr [4]uint32 // nbuckets, symoffset, bloom_size, bloom_shift
+	for i := range hdr {
+		if hdr[i], err = read(uint64(i) * 4); err != nil {
+			return 0, 0, err
+		}
+	}
+	nbuckets, symoffset, bloomSize := uint64(hdr[0]), uint64(hdr[1]), uint64(hdr[2])
+	buckets := 16 + bloomSize*wordSize(f.Class)
+	chains := buckets + nbuckets*4
+
+	// The last symbol is in the chain started by the highest bucket.
+	var last uint64
+	for i := uint64(0); i < nbuckets; i++ {
+		b, err := read(buckets + i*4)
+		if err != nil {
+			return 0, 0, err
+		}
+		if uint64(b) > last {
+			last = uint64(b)
+		}
+	}
+	if last < symoffset {
+		return symoffset, chains, nil
+	}
+	for {
+		c, err := read(chains + (last-symoffset)*4)
+		if err != nil {
+			return 0, 0, err
+		}
+		if c&1 != 0 {
+			break
+		}
+		last++
+	}
+	return last + 1, chains + (last+1-symoffset)*4, nil
+}
+
+// ehFrameSection reconstructs .eh_frame from the .eh_frame_hdr in the given segment.
+func ehFrameSection(f *elf.File, hdr *elf.Prog) (*sectionSpec, error) {
+	// https://refspecs.linuxfoundation.org/LSB_1.3.0/gLSB/gLSB/ehframehdr.html
+	data, err := readSegment(hdr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .eh_frame_hdr: %w", err)
+	}
+	if len(data) < 4 || data[0] != 1 {
+		return nil, nil
+	}
+	addr, err := decodeEHPointer(f, data[1], data[4:], hdr.Vaddr, hdr.Vaddr+4)
+	if err != nil {
+		return nil, err
+	}
+
+	off, err := vaddrToOffset(f, addr)
+	if err != nil {
+		return nil, err
+	}
+	r, err := readerAtVaddr(f, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk the CIE and FDE records up to the terminator.
+	var size uint64
+	for {
+		var b [4]byte
+		if _, err := r.ReadAt(b[:], int64(size)); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		length := uint64(f.ByteOrder.Uint32(b[:]))
+		size += 4
+		if length == 0 {
+			break
+		}
+		if length == 0xffffffff {
+			var b [8]byte
+			if _, err := r.ReadAt(b[:], int64(size)); err != nil {
+				return nil, err
+			}
+			length = f.ByteOrder.Uint64(b[:])
+			size += 8
+		}
+		size += length
+	}
+
+	return &sectionSpec{
+		name:  ".eh_frame",
+		typ:   elf.SHT_PROGBITS,
+		flags: elf.SHF_ALLOC,
+		addr:  addr,
+		off:   off,
+		size:  size,
+		align: wordSize(f.Class),
+	}, nil
+}
+
+// DWARF exception header pointer encodings.
+const (
+	dwEHPEAbsptr  = 0x00
+	dwEHPEUdata4  = 0x03
+	dwEHPEUdata8  = 0x04
+	dwEHPESdata4  = 0x0b
+	dwEHPESdata8  = 0x0c
+	dwEHPEPcrel   = 0x10
+	dwEHPEDatarel = 0x30
+	dwEHPEOmit    = 0xff
+)
+
+// decodeEHPointer decodes the pointer at the start of data,
+// pc is its address and base the start of .eh_frame_hdr.
+func decodeEHPointer(f *elf.File, enc byte, data []byte, base, pc uint64) (uint64, error) {
+	if enc == dwEHPEOmit {
+		return 0, errors.New("eh_frame_ptr is omitted")
+	}
+
+	var v uint64
+	format := enc & 0x0f
+	if format == dwEHPEAbsptr {
+		format = dwEHPEUdata4
+		if f.Class == elf.ELFCLASS64 {
+			format = dwEHPEUdata8
+		}
+	}
+	switch format {
+	case dwEHPEUdata4, dwEHPESdata4:
+		if len(data) < 4 {
+			return 0, errors.New("truncated eh_frame_ptr")
+		}
+		v = uint64(f.ByteOrder.Uint32(data))
+		if format == dwEHPESdata4 {
+			v = uint64(int64(int32(v)))
+		}
+	case dwEHPEUdata8, dwEHPESdata8:
+		if len(data) < 8 {
+			return 0, errors.New("truncated eh_frame_ptr")
+		}
+		v = f.ByteOrder.Uint64(data)
+	default:
+		return 0, fmt.Errorf("unsupported eh_frame_ptr encoding %#x", enc)
+	}
+
+	switch enc & 0x70 {
+	case 0:
+	case dwEHPEPcrel:
+		v += pc
+	case dwEHPEDatarel:
+		v += base
+	default:
+		return 0, fmt.Errorf("unsupported eh_frame_ptr encoding %#x", enc)
+	}
+	return v, nil
+}
+
+// vaddrToOffset translates a virtual address to a file offset through the loadable segments.
+func vaddrToOffset(f *elf.File, addr uint64) (uint64, error) {
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && p.Vaddr <= addr && addr < p.Vaddr+p.Filesz {
+			return p.Off + addr - p.Vaddr, nil
+		}
+	}
+	return 0, fmt.Errorf("address %#x is not in any loadable segment", addr)
+}
+
+// readerAtVaddr returns a reader of the rest of the loadable segment, starting at the given address.
+func readerAtVaddr(f *elf.File, addr uint64) (io.ReaderAt, error) {
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && p.Vaddr <= addr && addr < p.Vaddr+p.Filesz {
+			start := int64(addr - p.Vaddr)
+			return io.NewSectionReader(p, start, int64(p.Filesz)-start), nil
+		}
+	}
+	return nil, fmt.Errorf("address %#x is not in any loadable segment", addr)
+}
+
+// readWords reads two consecutive 32-bit words at the given address.
+func readWords(f *elf.File, addr uint64) (uint32, uint32, error) {
+	r, err := readerAtVaddr(f, addr)
+	if err != nil {
+		return 0, 0, err
+	}
+	var b [8]byte
+	if _, err := r.ReadAt(b[:], 0); err != nil {
+		return 0, 0, err
+	}
+	return f.ByteOrder.Uint32(b[0:4]), f.ByteOrder.Uint32(b[4:8]), nil
+}
+
+func wordSize(class elf.Class) uint64 {
+	if class == elf.ELFCLASS32 {
+		return 4
+	}
+	return 8
+}
+
+func symEntrySize(class elf.Class) uint64 {
+	if class == elf.ELFCLASS32 {
+		return elf.Sym32Size
+	}
+	return elf.Sym64Size
+}
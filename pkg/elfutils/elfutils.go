@@ -1,12 +1,38 @@
 package elfutils
 
 import (
+	"bytes"
 	"debug/elf"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 )
 
+// HasELFMagic reports whether b starts with the ELF magic number.
+func HasELFMagic(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(elf.ELFMAG))
+}
+
+// IsELF reports whether the file at path starts with the ELF magic number,
+// scripts, images and text files are told apart from object files without parsing them.
+func IsELF(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var header [len(elf.ELFMAG)]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return HasELFMagic(header[:]), nil
+}
+
 func Open(filePath string) (*elf.File, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -21,7 +47,7 @@ func Open(filePath string) (*elf.File, error) {
 	}
 
 	// Match against supported file types.
-	if elfMagic := string(header[:]); elfMagic == elf.ELFMAG {
+	if HasELFMagic(header[:]) {
 		f, err := elf.Open(filePath)
 		if err != nil {
 			return nil, fmt.Errorf("error reading ELF file %s: %w", filePath, err)
@@ -29,5 +55,5 @@ func Open(filePath string) (*elf.File, error) {
 		return f, nil
 	}
 
-	return nil, fmt.Errorf("unrecognized object file format: %s", filePath)
+	return nil, fmt.Errorf("%w: %s", ErrNotELF, filePath)
 }
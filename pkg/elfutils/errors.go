@@ -0,0 +1,48 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNotELF is returned when a file is not an ELF file.
+	ErrNotELF = errors.New("not an ELF file")
+	// ErrUnsupportedClass is returned for ELF files that are neither 32-bit nor 64-bit.
+	ErrUnsupportedClass = errors.New("unsupported ELF class")
+	// ErrNoDebugInfo is returned when an ELF file has neither DWARF nor symbol tables.
+	ErrNoDebugInfo = errors.New("no debug information found")
+	// ErrAlreadyStripped is returned when the debug information of an ELF file
+	// has been split off into a separate file, e.g. by objcopy --only-keep-debug.
+	ErrAlreadyStripped = errors.New("debug information already stripped")
+)
+
+// CheckDebugInfo returns nil if f has DWARF, a symbol table or a Go symbol table.
+// Otherwise it returns ErrAlreadyStripped if the debug information has been split off,
+// the file links to a debug file or only has placeholders of the debug sections,
+// and ErrNoDebugInfo if not.
+func CheckDebugInfo(f *elf.File) error {
+	var placeholders bool
+	for _, s := range f.Sections {
+		if !isDebugInfo(s) {
+			continue
+		}
+		if s.Type == elf.SHT_NOBITS {
+			placeholders = true
+			continue
+		}
+		return nil
+	}
+	if placeholders || f.Section(debugLinkSection) != nil {
+		return ErrAlreadyStripped
+	}
+	return ErrNoDebugInfo
+}
+
+func isDebugInfo(s *elf.Section) bool {
+	return strings.HasPrefix(s.Name, ".debug_") ||
+		strings.HasPrefix(s.Name, ".zdebug_") ||
+		s.Name == ".symtab" ||
+		s.Name == ".gopclntab"
+}
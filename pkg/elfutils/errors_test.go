@@ -0,0 +1,42 @@
+package elfutils
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDebugInfo(t *testing.T) {
+	require.NoError(t, CheckDebugInfo(newTestFile(t, ".debug_info", []byte{0})))
+	require.NoError(t, CheckDebugInfo(newTestFile(t, ".symtab", make([]byte, 24))))
+	require.ErrorIs(t, CheckDebugInfo(newTestFile(t, ".text", []byte{0xc3})), ErrNoDebugInfo)
+	require.ErrorIs(t, CheckDebugInfo(newTestFile(t, debugLinkSection, []byte("app.debug\x00\x00\x00\x00\x00\x00\x00"))), ErrAlreadyStripped)
+}
+
+func TestOpenNotELF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script")
+	require.NoError(t, ioutil.WriteFile(path, []byte("#!/bin/sh\n"), 0o600))
+	_, err := Open(path)
+	require.ErrorIs(t, err, ErrNotELF)
+}
+
+func TestIsELF(t *testing.T) {
+	dir := t.TempDir()
+	for name, want := range map[string]bool{
+		"app":    true,
+		"script": false,
+		"empty":  false,
+		"tiny":   false,
+	} {
+		data := map[string]string{"app": "\x7fELF\x02\x01", "script": "#!/bin/sh\n", "tiny": "\x7f"}[name]
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0o600))
+		ok, err := IsELF(path)
+		require.NoError(t, err)
+		require.Equal(t, want, ok, name)
+	}
+	_, err := IsELF(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// addFuzzSeeds adds valid, truncated and sheared images to the corpus.
+func addFuzzSeeds(f *testing.F) {
+	f.Add(newTestImage(f, ".gnu_debuglink", append([]byte("app.debug\x00\x00\x00"), 0x78, 0x56, 0x34, 0x12)))
+	f.Add(newTestImage(f, GNUBuildIDSection, []byte{
+		4, 0, 0, 0, 4, 0, 0, 0, ntGNUBuildID, 0, 0, 0, 'G', 'N', 'U', 0, 0xde, 0xad, 0xbe, 0xef,
+	}))
+	for _, path := range []string{"/bin/true", "/usr/bin/true"} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// Keep the headers and the start of the contents, so section headers are lost.
+		if len(data) > 4096 {
+			data = data[:4096]
+		}
+		f.Add(data)
+		break
+	}
+}
+
+// exercise reads everything the tool reads from an opened file.
+func exercise(f *elf.File) {
+	for _, s := range f.Sections {
+		_, _ = s.Data()
+	}
+	_, _ = BuildID(f)
+	_, _ = GoBuildID(f)
+	_, _, _ = DebugLink(f)
+	_, _ = f.Symbols()
+	_, _ = f.DynamicSymbols()
+	_, _ = f.DWARF()
+}
+
+func FuzzOpen(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(t.TempDir(), "input")
+		if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		ef, err := Open(path)
+		if err != nil {
+			return
+		}
+		defer ef.Close()
+		exercise(ef)
+	})
+}
+
+func FuzzOpenReaderAt(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ef, err := OpenReaderAt(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		exercise(ef)
+	})
+}
@@ -0,0 +1,101 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+// DF_1_PIE is missing from debug/elf in older Go versions.
+const df1PIE = 0x08000000
+
+// Layout is how an object file is laid out in memory, what symbolizers need to compute the load
+// bias of its mappings: the address it is loaded at minus the address it was linked at.
+type Layout struct {
+	// Type is the ELF type, ET_EXEC or ET_DYN for the files that are loaded.
+	Type string `json:"type"`
+	// PIE reports whether the file is a position-independent executable. Shared libraries are
+	// ET_DYN too, but not executables.
+	PIE bool `json:"pie"`
+	// BaseAddress is the lowest address of the PT_LOAD segments. It is zero for the ET_DYN files
+	// loaded at a random address by default.
+	BaseAddress uint64 `json:"base_address"`
+	// Text is the executable PT_LOAD segment, the one profilers find the mapping of.
+	Text *Segment `json:"text,omitempty"`
+}
+
+// Segment is a PT_LOAD segment.
+type Segment struct {
+	Vaddr  uint64 `json:"vaddr"`
+	Offset uint64 `json:"offset"`
+	Filesz uint64 `json:"filesz"`
+	Memsz  uint64 `json:"memsz"`
+	Align  uint64 `json:"align"`
+}
+
+// LayoutInfo returns the memory layout of the given ELF file. The load bias of a mapping of the
+// text segment at start with file offset off is start - off + Text.Offset - Text.Vaddr.
+//
+// ET_DYN files are PIEs if their DT_FLAGS_1 has DF_1_PIE set, or they ask for an interpreter, as
+// the ones of linkers predating DF_1_PIE do. Debug files keep the program headers, not the
+// contents of the dynamic segment, so only the interpreter is checked for them.
+func LayoutInfo(f *elf.File) Layout {
+	l := Layout{Type: f.Type.String()}
+	var interp bool
+	first := true
+	for _, p := range f.Progs {
+		switch p.Type {
+		case elf.PT_INTERP:
+			interp = true
+		case elf.PT_LOAD:
+			if first || p.Vaddr < l.BaseAddress {
+				l.BaseAddress = p.Vaddr
+				first = false
+			}
+			if l.Text == nil && p.Flags&elf.PF_X != 0 {
+				l.Text = &Segment{
+					Vaddr:  p.Vaddr,
+					Offset: p.Off,
+					Filesz: p.Filesz,
+					Memsz:  p.Memsz,
+					Align:  p.Align,
+				}
+			}
+		}
+	}
+	if f.Type == elf.ET_DYN {
+		flags, err := dynFlags1(f)
+		l.PIE = interp || (err == nil && flags&df1PIE != 0)
+	}
+	return l
+}
+
+// dynFlags1 returns the DT_FLAGS_1 entry of the dynamic section, zero if it has none.
+func dynFlags1(f *elf.File) (uint64, error) {
+	s := f.Section(".dynamic")
+	if s == nil || s.Type == elf.SHT_NOBITS {
+		return 0, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read .dynamic: %w", err)
+	}
+	entsize := int(dynEntrySize(f.Class))
+	for ; len(data) >= entsize; data = data[entsize:] {
+		var tag elf.DynTag
+		var val uint64
+		if f.Class == elf.ELFCLASS32 {
+			tag = elf.DynTag(int32(f.ByteOrder.Uint32(data[0:4])))
+			val = uint64(f.ByteOrder.Uint32(data[4:8]))
+		} else {
+			tag = elf.DynTag(int64(f.ByteOrder.Uint64(data[0:8])))
+			val = f.ByteOrder.Uint64(data[8:16])
+		}
+		switch tag {
+		case elf.DT_NULL:
+			return 0, nil
+		case elf.DT_FLAGS_1:
+			return val, nil
+		}
+	}
+	return 0, nil
+}
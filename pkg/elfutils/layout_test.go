@@ -0,0 +1,59 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayoutInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		flags []string
+		typ   elf.Type
+		pie   bool
+	}{
+		{"pie", []string{"-fPIE", "-pie"}, elf.ET_DYN, true},
+		{"no-pie", []string{"-fno-PIE", "-no-pie"}, elf.ET_EXEC, false},
+		{"shared", []string{"-fPIC", "-shared"}, elf.ET_DYN, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := elf.Open(elfwritertest.BuildC(t, "int f(void) { return 1; }\nint main(void) { return f(); }\n", tc.flags...))
+			require.NoError(t, err)
+			defer f.Close()
+
+			l := LayoutInfo(f)
+			require.Equal(t, tc.typ.String(), l.Type)
+			require.Equal(t, tc.pie, l.PIE)
+			if tc.typ == elf.ET_DYN {
+				require.Zero(t, l.BaseAddress)
+			} else {
+				require.NotZero(t, l.BaseAddress)
+			}
+			require.NotNil(t, l.Text)
+			require.LessOrEqual(t, l.BaseAddress, l.Text.Vaddr)
+			// The text segment is mapped at an offset congruent to its address.
+			require.Equal(t, l.Text.Vaddr%l.Text.Align, l.Text.Offset%l.Text.Align)
+			text := f.Section(".text")
+			require.NotNil(t, text)
+			require.GreaterOrEqual(t, text.Addr, l.Text.Vaddr)
+			require.LessOrEqual(t, text.Addr+text.Size, l.Text.Vaddr+l.Text.Memsz)
+		})
+	}
+}
+
+func TestLayoutInfo_Go(t *testing.T) {
+	f, err := elf.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer f.Close()
+
+	// Go links static non-PIE binaries by default.
+	l := LayoutInfo(f)
+	require.Equal(t, elf.ET_EXEC.String(), l.Type)
+	require.False(t, l.PIE)
+	require.NotNil(t, l.Text)
+	require.Equal(t, l.BaseAddress, l.Text.Vaddr)
+}
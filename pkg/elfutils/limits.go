@@ -0,0 +1,176 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrLimitExceeded is returned when an ELF file exceeds the limits it is opened with.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Limits bound the resources spent on a possibly hostile or corrupt ELF file.
+// Zero values mean no limit.
+type Limits struct {
+	// MaxInputSize is the maximum size of the file in bytes.
+	MaxInputSize int64
+	// MaxSections is the maximum number of sections.
+	MaxSections int
+	// MaxSectionSize is the maximum size of a single section in bytes, after decompression.
+	MaxSectionSize uint64
+}
+
+// OpenWithLimits opens the ELF file at filePath like Open, but fails with ErrLimitExceeded
+// if the file exceeds the given limits. The size and the section count are checked
+// before the file is parsed, so they do not cause allocations.
+func OpenWithLimits(filePath string, limits Limits) (*elf.File, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	err = limits.checkHeader(f, stat.Size())
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	ef, err := Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.checkSections(ef); err != nil {
+		ef.Close()
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return ef, nil
+}
+
+// NewFileWithLimits reads the ELF file f like OpenWithLimits. Closing the returned file does not
+// close f, e.g. for callers that advise the kernel about the reads through f.
+func NewFileWithLimits(f *os.File, limits Limits) (*elf.File, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", f.Name(), err)
+	}
+	return NewReaderWithLimits(f, stat.Size(), f.Name(), limits)
+}
+
+// NewReaderWithLimits reads the ELF file of the size bytes of r like NewFileWithLimits, e.g. through
+// a reader that hashes the file while it is read. The name of the file is used in the errors.
+func NewReaderWithLimits(r io.ReaderAt, size int64, name string, limits Limits) (*elf.File, error) {
+	if err := limits.checkHeader(r, size); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	var header [4]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("error reading magic number from %s: %w", name, err)
+	}
+	if !HasELFMagic(header[:]) {
+		return nil, fmt.Errorf("%w: %s", ErrNotELF, name)
+	}
+	ef, err := elf.NewFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ELF file %s: %w", name, err)
+	}
+	if err := limits.checkSections(ef); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return ef, nil
+}
+
+// checkHeader checks the size and the section count of the image in r.
+func (l Limits) checkHeader(r io.ReaderAt, size int64) error {
+	if l.MaxInputSize > 0 && size > l.MaxInputSize {
+		return fmt.Errorf("%w: input size %d exceeds %d bytes", ErrLimitExceeded, size, l.MaxInputSize)
+	}
+	if l.MaxSections <= 0 {
+		return nil
+	}
+	shnum, err := sectionCount(r)
+	if err != nil {
+		// Leave reporting malformed files to the parser.
+		return nil //nolint:nilerr
+	}
+	if shnum > uint64(l.MaxSections) {
+		return fmt.Errorf("%w: %d sections exceed %d", ErrLimitExceeded, shnum, l.MaxSections)
+	}
+	return nil
+}
+
+// checkSections checks the sizes of the sections of a parsed file.
+func (l Limits) checkSections(f *elf.File) error {
+	if l.MaxSections > 0 && len(f.Sections) > l.MaxSections {
+		return fmt.Errorf("%w: %d sections exceed %d", ErrLimitExceeded, len(f.Sections), l.MaxSections)
+	}
+	if l.MaxSectionSize == 0 {
+		return nil
+	}
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		// Size is the decompressed size of compressed sections.
+		if s.Size > l.MaxSectionSize || s.FileSize > l.MaxSectionSize {
+			return fmt.Errorf("%w: section %s of %d bytes exceeds %d bytes", ErrLimitExceeded, s.Name, s.Size, l.MaxSectionSize)
+		}
+	}
+	return nil
+}
+
+// sectionCount reads the number of sections from the file header,
+// or from the first section header if the count does not fit in the file header.
+func sectionCount(r io.ReaderAt) (uint64, error) {
+	var ident [elf.EI_NIDENT]byte
+	if _, err := r.ReadAt(ident[:], 0); err != nil {
+		return 0, err
+	}
+	var bo binary.ByteOrder = binary.LittleEndian
+	if elf.Data(ident[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		bo = binary.BigEndian
+	}
+
+	var shoff, shnum uint64
+	var sizeOff int64 // offset of sh_size in a section header.
+	switch elf.Class(ident[elf.EI_CLASS]) {
+	case elf.ELFCLASS32:
+		var hdr elf.Header32
+		if err := binary.Read(io.NewSectionReader(r, 0, 52), bo, &hdr); err != nil {
+			return 0, err
+		}
+		shoff, shnum, sizeOff = uint64(hdr.Shoff), uint64(hdr.Shnum), 0x14
+	case elf.ELFCLASS64:
+		var hdr elf.Header64
+		if err := binary.Read(io.NewSectionReader(r, 0, 64), bo, &hdr); err != nil {
+			return 0, err
+		}
+		shoff, shnum, sizeOff = hdr.Shoff, uint64(hdr.Shnum), 0x20
+	default:
+		return 0, fmt.Errorf("%w: %d", ErrUnsupportedClass, ident[elf.EI_CLASS])
+	}
+	if shnum != 0 || shoff == 0 {
+		return shnum, nil
+	}
+
+	// Extended section numbering: sh_size of the first section header holds the count.
+	if elf.Class(ident[elf.EI_CLASS]) == elf.ELFCLASS32 {
+		var b [4]byte
+		if _, err := r.ReadAt(b[:], int64(shoff)+sizeOff); err != nil {
+			return 0, err
+		}
+		return uint64(bo.Uint32(b[:])), nil
+	}
+	var b [8]byte
+	if _, err := r.ReadAt(b[:], int64(shoff)+sizeOff); err != nil {
+		return 0, err
+	}
+	return bo.Uint64(b[:]), nil
+}
@@ -0,0 +1,49 @@
+package elfutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenWithLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input")
+	require.NoError(t, ioutil.WriteFile(path, newTestImage(t, ".text", make([]byte, 128)), 0o600))
+
+	tests := []struct {
+		name     string
+		limits   Limits
+		exceeded bool
+	}{
+		{name: "unlimited"},
+		{name: "within limits", limits: Limits{MaxInputSize: 1 << 20, MaxSections: 3, MaxSectionSize: 128}},
+		{name: "input size", limits: Limits{MaxInputSize: 64}, exceeded: true},
+		{name: "sections", limits: Limits{MaxSections: 2}, exceeded: true},
+		{name: "section size", limits: Limits{MaxSectionSize: 127}, exceeded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := OpenWithLimits(path, tt.limits)
+			if tt.exceeded {
+				require.ErrorIs(t, err, ErrLimitExceeded)
+			} else {
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+			}
+
+			input, err := os.Open(path)
+			require.NoError(t, err)
+			defer input.Close()
+			f, err = NewFileWithLimits(input, tt.limits)
+			if tt.exceeded {
+				require.ErrorIs(t, err, ErrLimitExceeded)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, f.Section(".text"))
+		})
+	}
+}
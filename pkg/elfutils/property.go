@@ -0,0 +1,95 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// GNUPropertySection is the section of the GNU property note, loaders read it through the
+	// PT_GNU_PROPERTY segment, so it has to survive stripping.
+	GNUPropertySection = ".note.gnu.property"
+
+	ntGNUPropertyType0 = 5 // NT_GNU_PROPERTY_TYPE_0
+
+	gnuPropertyAArch64Feature1And = 0xc0000000 // GNU_PROPERTY_AARCH64_FEATURE_1_AND
+	gnuPropertyX86Feature1And     = 0xc0000002 // GNU_PROPERTY_X86_FEATURE_1_AND
+)
+
+// Features of the GNU property note, the bits of the FEATURE_1_AND properties.
+var (
+	aarch64Features = []string{"bti", "pac", "gcs"}
+	x86Features     = []string{"ibt", "shstk"}
+)
+
+// GNUFeatures returns the hardening features the GNU property note of the given ELF file marks it
+// compatible with: bti, pac and gcs on arm64, ibt and shstk (CET) on x86. Loaders only enforce
+// them if all loaded objects are marked. It returns no features if the file has no property note.
+func GNUFeatures(f *elf.File) ([]string, error) {
+	s := f.Section(GNUPropertySection)
+	if s == nil {
+		return nil, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", GNUPropertySection, err)
+	}
+	desc, err := findNote(f.ByteOrder, data, "GNU", ntGNUPropertyType0)
+	if errors.Is(err, ErrNoBuildID) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s", err, GNUPropertySection)
+	}
+	features, err := parseGNUProperties(f.ByteOrder, f.Class, desc)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s", err, GNUPropertySection)
+	}
+	return features, nil
+}
+
+// parseGNUProperties returns the features of the FEATURE_1_AND properties of the descriptor of a
+// NT_GNU_PROPERTY_TYPE_0 note. Properties are padded to 8 bytes in 64-bit files, to 4 otherwise.
+func parseGNUProperties(byteOrder binary.ByteOrder, class elf.Class, desc []byte) ([]string, error) {
+	align := uint64(4)
+	if class == elf.ELFCLASS64 {
+		align = 8
+	}
+	var features []string
+	for len(desc) > 0 {
+		if len(desc) < 8 {
+			return nil, errMalformedNote
+		}
+		typ := byteOrder.Uint32(desc[0:4])
+		size := uint64(byteOrder.Uint32(desc[4:8]))
+		desc = desc[8:]
+		if uint64(len(desc)) < size {
+			return nil, errMalformedNote
+		}
+
+		var names []string
+		switch typ {
+		case gnuPropertyAArch64Feature1And:
+			names = aarch64Features
+		case gnuPropertyX86Feature1And:
+			names = x86Features
+		}
+		if names != nil && size >= 4 {
+			bits := byteOrder.Uint32(desc)
+			for i, name := range names {
+				if bits&(1<<i) != 0 {
+					features = append(features, name)
+				}
+			}
+		}
+
+		end := (size + align - 1) &^ (align - 1)
+		if uint64(len(desc)) < end {
+			break
+		}
+		desc = desc[end:]
+	}
+	return features, nil
+}
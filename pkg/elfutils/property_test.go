@@ -0,0 +1,68 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"runtime"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gnuPropertyNote returns a NT_GNU_PROPERTY_TYPE_0 note of a 64-bit file with the given properties.
+func gnuPropertyNote(props ...[2]uint32) []byte {
+	var desc bytes.Buffer
+	for _, p := range props {
+		binary.Write(&desc, binary.LittleEndian, []uint32{p[0], 4, p[1], 0})
+	}
+	var note bytes.Buffer
+	binary.Write(&note, binary.LittleEndian, []uint32{4, uint32(desc.Len()), ntGNUPropertyType0})
+	note.WriteString("GNU\x00")
+	note.Write(desc.Bytes())
+	return note.Bytes()
+}
+
+func TestGNUFeatures(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		note []byte
+		want []string
+	}{
+		{"bti-pac", gnuPropertyNote([2]uint32{gnuPropertyAArch64Feature1And, 0b011}), []string{"bti", "pac"}},
+		{"bti", gnuPropertyNote([2]uint32{gnuPropertyAArch64Feature1And, 0b001}), []string{"bti"}},
+		// The ISA level precedes the features in binaries of GNU ld.
+		{"cet", gnuPropertyNote([2]uint32{0xc0008002, 1}, [2]uint32{gnuPropertyX86Feature1And, 0b11}), []string{"ibt", "shstk"}},
+		{"none", gnuPropertyNote([2]uint32{0xc0008002, 1}), nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			features, err := GNUFeatures(newTestFile(t, GNUPropertySection, tc.note))
+			require.NoError(t, err)
+			require.Equal(t, tc.want, features)
+		})
+	}
+
+	features, err := GNUFeatures(newTestFile(t, ".note.other", gnuPropertyNote([2]uint32{gnuPropertyAArch64Feature1And, 1})))
+	require.NoError(t, err)
+	require.Nil(t, features)
+
+	truncated := gnuPropertyNote([2]uint32{gnuPropertyAArch64Feature1And, 1})
+	binary.LittleEndian.PutUint32(truncated[20:], 64) // pr_datasz
+	_, err = GNUFeatures(newTestFile(t, GNUPropertySection, truncated))
+	require.ErrorIs(t, err, errMalformedNote)
+}
+
+func TestGNUFeatures_CET(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("CET fixture requires an x86-64 host")
+	}
+	// The linker only marks the output if all inputs are marked, unless forced.
+	f, err := elf.Open(elfwritertest.BuildC(t, "int main(void) { return 0; }\n", "-fcf-protection=full", "-Wl,-z,ibt,-z,shstk"))
+	require.NoError(t, err)
+	defer f.Close()
+	features, err := GNUFeatures(f)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ibt", "shstk"}, features)
+}
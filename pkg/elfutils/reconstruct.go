@@ -0,0 +1,366 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// OpenReaderAt opens the ELF image read from r, e.g. an in-memory image such as
+// the vDSO read from /proc/<pid>/mem. The image is expected in its file layout.
+//
+// Images without a section header table get their sections reconstructed from
+// the program headers where possible, so they can be processed like regular files.
+func OpenReaderAt(r io.ReaderAt) (*elf.File, error) {
+	var header [4]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("error reading magic number: %w", err)
+	}
+	if string(header[:]) != elf.ELFMAG {
+		return nil, ErrNotELF
+	}
+
+	f, err := elf.NewFile(r)
+	if err != nil {
+		// Truncated images lose the section header table at their end first, retry without it.
+		var rerr error
+		if f, rerr = newFileWithoutSectionHeaders(r); rerr != nil {
+			return nil, fmt.Errorf("error reading ELF image: %w", err)
+		}
+	}
+	if len(f.Sections) > 0 {
+		return f, nil
+	}
+	return reconstructSections(r, f)
+}
+
+// newFileWithoutSectionHeaders opens the image as if it had no section header table.
+func newFileWithoutSectionHeaders(r io.ReaderAt) (*elf.File, error) {
+	var ident [elf.EI_NIDENT]byte
+	if _, err := r.ReadAt(ident[:], 0); err != nil {
+		return nil, err
+	}
+	class := elf.Class(ident[elf.EI_CLASS])
+	ehsize, _ := headerSizes(class)
+	header := make([]byte, ehsize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	var bo binary.ByteOrder = binary.LittleEndian
+	if elf.Data(ident[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		bo = binary.BigEndian
+	}
+	patchHeader(class, bo, header, 0, 0)
+	return elf.NewFile(&overlayReaderAt{r: r, overlays: []overlay{{off: 0, data: header}}})
+}
+
+// sectionSpec describes a section reconstructed from a segment.
+type sectionSpec struct {
+	name    string
+	typ     elf.SectionType
+	flags   elf.SectionFlag
+	addr    uint64
+	off     uint64
+	size    uint64
+	link    string // name of the linked section.
+	info    uint32
+	entsize uint64
+	align   uint64
+}
+
+// reconstructSections rebuilds the sections that can be found through the program headers
+// and returns the image with a synthesized section header table.
+func reconstructSections(r io.ReaderAt, f *elf.File) (*elf.File, error) {
+	var specs []sectionSpec
+	for _, p := range f.Progs {
+		spec := sectionSpec{
+			addr:  p.Vaddr,
+			off:   p.Off,
+			size:  p.Filesz,
+			align: p.Align,
+		}
+		switch p.Type {
+		case elf.PT_INTERP:
+			spec.name, spec.typ, spec.flags = ".interp", elf.SHT_PROGBITS, elf.SHF_ALLOC
+			spec.align = 1
+		case elf.PT_DYNAMIC:
+			spec.name, spec.typ, spec.flags = ".dynamic", elf.SHT_DYNAMIC, elf.SHF_ALLOC|elf.SHF_WRITE
+			spec.entsize = dynEntrySize(f.Class)
+			dyn, err := dynamicSections(f, p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to reconstruct dynamic sections: %w", err)
+			}
+			if len(dyn) > 0 {
+				spec.link = ".dynstr"
+			}
+			specs = append(specs, dyn...)
+		case elf.PT_GNU_EH_FRAME:
+			spec.name, spec.typ, spec.flags = ".eh_frame_hdr", elf.SHT_PROGBITS, elf.SHF_ALLOC
+			ehFrame, err := ehFrameSection(f, p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to reconstruct .eh_frame: %w", err)
+			}
+			if ehFrame != nil {
+				specs = append(specs, *ehFrame)
+			}
+		case elf.PT_NOTE:
+			spec.name, spec.typ, spec.flags = ".note", elf.SHT_NOTE, elf.SHF_ALLOC
+			data, err := readSegment(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read note segment: %w", err)
+			}
+			// Name the note after its contents, so the build ID can be found.
+			if _, err := findNote(f.ByteOrder, data, "GNU", ntGNUBuildID); err == nil {
+				spec.name = GNUBuildIDSection
+			} else if _, err := findNote(f.ByteOrder, data, "Go", ntGoBuildID); err == nil {
+				spec.name = GoBuildIDSection
+			}
+		default:
+			continue
+		}
+		if spec.size == 0 {
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return f, nil
+	}
+
+	// Place the section header table past everything the program headers describe.
+	var end uint64
+	for _, p := range f.Progs {
+		if e := p.Off + p.Filesz; e > end {
+			end = e
+		}
+	}
+	ehsize, phentsize := headerSizes(f.Class)
+	phoff, err := readPhoff(r, f)
+	if err != nil {
+		return nil, err
+	}
+	if e := phoff + uint64(len(f.Progs))*phentsize; e > end {
+		end = e
+	}
+	if ehsize > end {
+		end = ehsize
+	}
+	end = (end + 7) &^ 7
+
+	tail, shoff, shnum, err := sectionTable(f, specs, end)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, ehsize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("error reading file header: %w", err)
+	}
+	patchHeader(f.Class, f.ByteOrder, header, shoff, shnum)
+
+	nf, err := elf.NewFile(&overlayReaderAt{
+		r: r,
+		overlays: []overlay{
+			{off: 0, data: header},
+			{off: int64(end), data: tail},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading reconstructed ELF image: %w", err)
+	}
+	return nf, nil
+}
+
+// sectionTable encodes the section header string table followed by the section header table,
+// to be placed at off. It returns the encoded tables, the offset of the section header table
+// and the number of sections, the section header string table is the last one.
+func sectionTable(f *elf.File, specs []sectionSpec, off uint64) ([]byte, uint64, int, error) {
+	shstrtab := []byte{0}
+	names := make([]uint32, len(specs))
+	for i, s := range specs {
+		names[i] = uint32(len(shstrtab))
+		shstrtab = append(append(shstrtab, s.name...), 0)
+	}
+	shstrtabName := uint32(len(shstrtab))
+	index := func(name string) uint32 {
+		if name == "" {
+			return 0
+		}
+		for i, s := range specs {
+			if s.name == name {
+				return uint32(i + 1) // after the null section.
+			}
+		}
+		return 0
+	}
+	shstrtab = append(append(shstrtab, ".shstrtab"...), 0)
+
+	specs = append(specs, sectionSpec{
+		typ:   elf.SHT_STRTAB,
+		off:   off,
+		size:  uint64(len(shstrtab)),
+		align: 1,
+	})
+	names = append(names, shstrtabName)
+
+	buf := bytes.NewBuffer(shstrtab)
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+	shoff := off + uint64(buf.Len())
+
+	// The first entry is the reserved null section.
+	var err error
+	switch f.Class {
+	case elf.ELFCLASS32:
+		err = binary.Write(buf, f.ByteOrder, elf.Section32{})
+	default:
+		err = binary.Write(buf, f.ByteOrder, elf.Section64{})
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	for i, s := range specs {
+		switch f.Class {
+		case elf.ELFCLASS32:
+			err = binary.Write(buf, f.ByteOrder, elf.Section32{
+				Name:      names[i],
+				Type:      uint32(s.typ),
+				Flags:     uint32(s.flags),
+				Addr:      uint32(s.addr),
+				Off:       uint32(s.off),
+				Size:      uint32(s.size),
+				Link:      index(s.link),
+				Info:      s.info,
+				Addralign: uint32(s.align),
+				Entsize:   uint32(s.entsize),
+			})
+		default:
+			err = binary.Write(buf, f.ByteOrder, elf.Section64{
+				Name:      names[i],
+				Type:      uint32(s.typ),
+				Flags:     uint64(s.flags),
+				Addr:      s.addr,
+				Off:       s.off,
+				Size:      s.size,
+				Link:      index(s.link),
+				Info:      s.info,
+				Addralign: s.align,
+				Entsize:   s.entsize,
+			})
+		}
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	return buf.Bytes(), shoff, len(specs) + 1, nil
+}
+
+// patchHeader points the file header to a section header table of shnum entries at off,
+// with the section header string table as the last entry.
+func patchHeader(class elf.Class, bo binary.ByteOrder, header []byte, off uint64, shnum int) {
+	shstrndx := shnum - 1
+	if shnum == 0 {
+		shstrndx = 0
+	}
+	switch class {
+	case elf.ELFCLASS32:
+		bo.PutUint32(header[0x20:], uint32(off))
+		bo.PutUint16(header[0x2e:], 40) // e_shentsize
+		bo.PutUint16(header[0x30:], uint16(shnum))
+		bo.PutUint16(header[0x32:], uint16(shstrndx))
+	default:
+		bo.PutUint64(header[0x28:], off)
+		bo.PutUint16(header[0x3a:], 64) // e_shentsize
+		bo.PutUint16(header[0x3c:], uint16(shnum))
+		bo.PutUint16(header[0x3e:], uint16(shstrndx))
+	}
+}
+
+func headerSizes(class elf.Class) (ehsize, phentsize uint64) {
+	if class == elf.ELFCLASS32 {
+		return 52, 32
+	}
+	return 64, 56
+}
+
+func dynEntrySize(class elf.Class) uint64 {
+	if class == elf.ELFCLASS32 {
+		return 8
+	}
+	return 16
+}
+
+// readPhoff reads e_phoff, which debug/elf does not expose.
+func readPhoff(r io.ReaderAt, f *elf.File) (uint64, error) {
+	switch f.Class {
+	case elf.ELFCLASS32:
+		var b [4]byte
+		if _, err := r.ReadAt(b[:], 0x1c); err != nil {
+			return 0, fmt.Errorf("error reading program header offset: %w", err)
+		}
+		return uint64(f.ByteOrder.Uint32(b[:])), nil
+	default:
+		var b [8]byte
+		if _, err := r.ReadAt(b[:], 0x20); err != nil {
+			return 0, fmt.Errorf("error reading program header offset: %w", err)
+		}
+		return f.ByteOrder.Uint64(b[:]), nil
+	}
+}
+
+// readSegment reads the contents of the segment. The buffer grows with the data read,
+// so a corrupt size does not allocate more than the image holds.
+func readSegment(p *elf.Prog) ([]byte, error) {
+	data, err := ioutil.ReadAll(p.Open())
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != p.Filesz {
+		return nil, fmt.Errorf("segment truncated: read %d of %d bytes", len(data), p.Filesz)
+	}
+	return data, nil
+}
+
+// overlay replaces the contents of the underlying reader starting at off.
+type overlay struct {
+	off  int64
+	data []byte
+}
+
+// overlayReaderAt reads from r with the overlays applied, overlays may extend past the end of r.
+type overlayReaderAt struct {
+	r        io.ReaderAt
+	overlays []overlay
+}
+
+func (o *overlayReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := o.r.ReadAt(p, off)
+	end := off + int64(len(p))
+	for _, ov := range o.overlays {
+		ovEnd := ov.off + int64(len(ov.data))
+		if ovEnd <= off || ov.off >= end {
+			continue
+		}
+		from, to := ov.off, ovEnd
+		if from < off {
+			from = off
+		}
+		if to > end {
+			to = end
+		}
+		copy(p[from-off:to-off], ov.data[from-ov.off:to-ov.off])
+		// Data past the end of r is served by the overlay.
+		if int(to-off) > n {
+			n = int(to - off)
+		}
+	}
+	if n == len(p) {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,96 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenReaderAt(t *testing.T) {
+	data, err := ioutil.ReadFile("../../dist/split-debug")
+	require.NoError(t, err)
+
+	f, err := OpenReaderAt(bytes.NewReader(data))
+	require.NoError(t, err)
+	expected, err := GoBuildID(f)
+	require.NoError(t, err)
+	require.NotEmpty(t, f.Section(".text"))
+
+	t.Run("without section headers", func(t *testing.T) {
+		sheared := make([]byte, len(data))
+		copy(sheared, data)
+		// Clear e_shoff, e_shnum and e_shstrndx.
+		require.Equal(t, elf.ELFCLASS64, f.Class)
+		copy(sheared[0x28:0x30], make([]byte, 8))
+		copy(sheared[0x3c:0x40], make([]byte, 4))
+
+		f, err := OpenReaderAt(bytes.NewReader(sheared))
+		require.NoError(t, err)
+
+		s := f.Section(GoBuildIDSection)
+		require.NotNil(t, s)
+		require.Equal(t, elf.SHT_NOTE, s.Type)
+		id, err := GoBuildID(f)
+		require.NoError(t, err)
+		require.Equal(t, expected, id)
+	})
+
+	t.Run("not an ELF image", func(t *testing.T) {
+		_, err := OpenReaderAt(bytes.NewReader([]byte("\x00asm\x01\x00\x00\x00")))
+		require.Error(t, err)
+	})
+}
+
+func TestOpenReaderAtDynamic(t *testing.T) {
+	var data []byte
+	for _, path := range []string{"/bin/true", "/usr/bin/true"} {
+		if b, err := ioutil.ReadFile(path); err == nil {
+			data = b
+			break
+		}
+	}
+	if data == nil {
+		t.Skip("no dynamically linked executable available")
+	}
+	orig, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Skip("executable is not an ELF file")
+	}
+	if orig.Section(".dynsym") == nil || orig.Class != elf.ELFCLASS64 {
+		t.Skip("executable is not dynamically linked")
+	}
+
+	// Cut the section header table off, like a truncated download would.
+	var shoff uint64
+	for _, s := range orig.Sections {
+		if e := s.Offset + s.FileSize; s.Type != elf.SHT_NOBITS && e > shoff {
+			shoff = e
+		}
+	}
+	truncated := data[:shoff]
+
+	f, err := OpenReaderAt(bytes.NewReader(truncated))
+	require.NoError(t, err)
+
+	for _, name := range []string{".dynsym", ".dynstr", ".gnu.hash", ".hash", ".eh_frame", ".eh_frame_hdr", ".dynamic"} {
+		want := orig.Section(name)
+		got := f.Section(name)
+		if want == nil {
+			require.Nil(t, got, name)
+			continue
+		}
+		require.NotNil(t, got, name)
+		require.Equal(t, want.Offset, got.Offset, name)
+		require.Equal(t, want.Addr, got.Addr, name)
+		require.Equal(t, want.Size, got.Size, name)
+	}
+
+	syms, err := f.DynamicSymbols()
+	require.NoError(t, err)
+	wantSyms, err := orig.DynamicSymbols()
+	require.NoError(t, err)
+	require.Equal(t, wantSyms, syms)
+}
@@ -0,0 +1,30 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+
+	"github.com/polarsignals/split-debug/pkg/demangle"
+)
+
+// IsRust reports whether the given ELF file was built by rustc: its .comment section names the
+// compiler, or its symbols use the Rust manglings, as the comment is dropped by some linkers.
+func IsRust(f *elf.File) bool {
+	if s := f.Section(".comment"); s != nil && s.Type != elf.SHT_NOBITS {
+		if data, err := s.Data(); err == nil && bytes.Contains(data, []byte("rustc version")) {
+			return true
+		}
+	}
+	for _, load := range []func() ([]elf.Symbol, error){f.Symbols, f.DynamicSymbols} {
+		syms, err := load()
+		if err != nil {
+			continue
+		}
+		for _, sym := range syms {
+			if demangle.IsRust(sym.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
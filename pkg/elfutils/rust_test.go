@@ -0,0 +1,43 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// openC opens the C program of the source, which stands in for the output of rustc where the test
+// needs its symbols or comment only.
+func openC(t *testing.T, src string) *elf.File {
+	t.Helper()
+	f, err := elf.Open(elfwritertest.BuildC(t, src))
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestIsRust(t *testing.T) {
+	f := openC(t, `
+void example(void) __asm__("_RNvCs15kBYyAo9fc_7mycrate7example");
+void example(void) {}
+int main(void) { example(); return 0; }
+`)
+	require.True(t, IsRust(f))
+
+	f = openC(t, `
+__asm__(".pushsection .comment\n.asciz \"rustc version 1.70.0 (90c541806 2023-05-31)\"\n.popsection\n");
+int main(void) { return 0; }
+`)
+	require.True(t, IsRust(f))
+
+	f = openC(t, "int main(void) { return 0; }\n")
+	require.False(t, IsRust(f))
+
+	f, err := elf.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer f.Close()
+	require.False(t, IsRust(f))
+}
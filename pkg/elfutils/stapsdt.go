@@ -0,0 +1,101 @@
+package elfutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SDTNoteSection is the section of the notes of the SystemTap SDT probes, also known as USDT.
+	SDTNoteSection = ".note.stapsdt"
+	// SDTBaseSection is the section the addresses of the probes are relative to, so tools can
+	// adjust them once the object file was prelinked.
+	SDTBaseSection = ".stapsdt.base"
+
+	ntSTAPSDT = 3 // NT_STAPSDT
+)
+
+// Probe is a SystemTap SDT probe, the static tracepoints profilers and bpftrace attach to.
+type Probe struct {
+	Provider string `json:"provider"`
+	Name     string `json:"name"`
+	// Address is the address of the probe.
+	Address uint64 `json:"address"`
+	// Semaphore is the address of the counter enabling the probe, zero if it has none.
+	Semaphore uint64 `json:"semaphore,omitempty"`
+	// Arguments are the assembler operands of the arguments, e.g. -4@%edi 8@%rsi.
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// Probes returns the SDT probes of the given ELF file, in the order of their notes. Their
+// addresses are adjusted by the displacement of .stapsdt.base, as prelinking moves it. It returns
+// no probes if the file has no SDT notes.
+func Probes(f *elf.File) ([]Probe, error) {
+	s := f.Section(SDTNoteSection)
+	if s == nil || s.Type != elf.SHT_NOTE {
+		return nil, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", SDTNoteSection, err)
+	}
+	base := f.Section(SDTBaseSection)
+
+	addrSize := 4
+	if f.Class == elf.ELFCLASS64 {
+		addrSize = 8
+	}
+	addr := func(b []byte) uint64 {
+		if addrSize == 8 {
+			return f.ByteOrder.Uint64(b)
+		}
+		return uint64(f.ByteOrder.Uint32(b))
+	}
+
+	var probes []Probe
+	for len(data) >= 12 {
+		namesz := f.ByteOrder.Uint32(data[0:4])
+		descsz := f.ByteOrder.Uint32(data[4:8])
+		ntype := f.ByteOrder.Uint32(data[8:12])
+		data = data[12:]
+
+		nameEnd := align4(uint64(namesz))
+		descEnd := nameEnd + align4(uint64(descsz))
+		if uint64(len(data)) < nameEnd+uint64(descsz) {
+			return nil, fmt.Errorf("%w in %s", errMalformedNote, SDTNoteSection)
+		}
+		name := strings.TrimRight(string(data[:namesz]), "\x00")
+		desc := data[nameEnd : nameEnd+uint64(descsz)]
+		if uint64(len(data)) < descEnd {
+			data = nil
+		} else {
+			data = data[descEnd:]
+		}
+		if name != "stapsdt" || ntype != ntSTAPSDT {
+			continue
+		}
+
+		// The descriptor holds the address of the probe, the one of .stapsdt.base at link time
+		// and the one of the semaphore, followed by the provider, name and arguments.
+		if len(desc) < 3*addrSize {
+			return nil, fmt.Errorf("%w in %s", errMalformedNote, SDTNoteSection)
+		}
+		p := Probe{Address: addr(desc), Semaphore: addr(desc[2*addrSize:])}
+		if base != nil {
+			delta := base.Addr - addr(desc[addrSize:])
+			p.Address += delta
+			if p.Semaphore != 0 {
+				p.Semaphore += delta
+			}
+		}
+		strs := bytes.SplitN(desc[3*addrSize:], []byte{0}, 4)
+		if len(strs) < 3 {
+			return nil, fmt.Errorf("%w in %s", errMalformedNote, SDTNoteSection)
+		}
+		p.Provider, p.Name, p.Arguments = string(strs[0]), string(strs[1]), string(strs[2])
+		probes = append(probes, p)
+	}
+	return probes, nil
+}
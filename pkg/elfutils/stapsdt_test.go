@@ -0,0 +1,77 @@
+package elfutils
+
+import (
+	"debug/elf"
+	"runtime"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sdtProgram emits the probe the way the STAP_PROBE macros of sys/sdt.h do, which is not installed
+// everywhere.
+const sdtProgram = `
+unsigned short app_start_semaphore __attribute__((section(".probes")));
+
+int main(void) {
+	__asm__ __volatile__(
+		".globl probe_site\n"
+		"probe_site: nop\n"
+		".pushsection .note.stapsdt,\"\",\"note\"\n"
+		".balign 4\n"
+		".4byte 992f-991f, 994f-993f, 3\n"
+		"991: .asciz \"stapsdt\"\n"
+		"992: .balign 4\n"
+		"993: .8byte probe_site\n"
+		".8byte _.stapsdt.base\n"
+		".8byte app_start_semaphore\n"
+		".asciz \"app\"\n"
+		".asciz \"start\"\n"
+		".asciz \"-4@%edi\"\n"
+		"994: .balign 4\n"
+		".popsection\n"
+		".pushsection .stapsdt.base,\"aG\",\"progbits\",.stapsdt.base,comdat\n"
+		".weak _.stapsdt.base\n"
+		".hidden _.stapsdt.base\n"
+		"_.stapsdt.base: .space 1\n"
+		".size _.stapsdt.base, 1\n"
+		".popsection\n");
+	return 0;
+}
+`
+
+func TestProbes(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("SDT fixture requires an x86-64 host")
+	}
+	f, err := elf.Open(elfwritertest.BuildC(t, sdtProgram))
+	require.NoError(t, err)
+	defer f.Close()
+	symbols, err := f.Symbols()
+	require.NoError(t, err)
+	addrs := map[string]uint64{}
+	for _, s := range symbols {
+		addrs[s.Name] = s.Value
+	}
+
+	probes, err := Probes(f)
+	require.NoError(t, err)
+	require.Equal(t, []Probe{{
+		Provider:  "app",
+		Name:      "start",
+		Address:   addrs["probe_site"],
+		Semaphore: addrs["app_start_semaphore"],
+		Arguments: "-4@%edi",
+	}}, probes)
+}
+
+func TestProbes_None(t *testing.T) {
+	f, err := elf.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer f.Close()
+	probes, err := Probes(f)
+	require.NoError(t, err)
+	require.Empty(t, probes)
+}
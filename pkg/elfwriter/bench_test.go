@@ -0,0 +1,204 @@
+package elfwriter
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+)
+
+// The benchmarks write the sections of synthetic fixtures, generated once per benchmark:
+//
+//	go test -run '^$' -bench . -benchmem ./pkg/elfwriter
+//
+// Their allocations track the copying and the header serialization, which should not allocate
+// per byte or per section.
+
+// openSynthetic writes the synthetic fixture of the sections and opens it.
+func openSynthetic(b *testing.B, sections ...elfwritertest.Section) *elf.File {
+	b.Helper()
+	f, err := elf.Open(elfwritertest.Synthetic(b, sections...))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { f.Close() })
+	return f
+}
+
+// sectionsSize returns the size of the contents of the sections, before compression.
+func sectionsSize(sections []*elf.Section) int64 {
+	var n int64
+	for _, s := range sections {
+		if s.Type != elf.SHT_NULL {
+			n += int64(s.Size)
+		}
+	}
+	return n
+}
+
+// benchmarkWrite writes the sections of in to out for each iteration, with the writer
+// returned by newWriter.
+func benchmarkWrite(b *testing.B, in *elf.File, newWriter func(out *os.File) (*Writer, error)) {
+	b.Helper()
+	out, err := ioutil.TempFile(b.TempDir(), "out")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer out.Close()
+
+	b.SetBytes(sectionsSize(in.Sections))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := out.Truncate(0); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		w, err := newWriter(out)
+		if err != nil {
+			b.Fatal(err)
+		}
+		w.Sections = in.Sections
+		if err := w.Write(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExtractLarge(b *testing.B) {
+	in := openSynthetic(b,
+		elfwritertest.Section{Name: ".debug_info", Size: 64 << 20},
+		elfwritertest.Section{Name: ".debug_line", Size: 16 << 20},
+		elfwritertest.Section{Name: ".debug_str", Size: 16 << 20},
+	)
+	benchmarkWrite(b, in, func(out *os.File) (*Writer, error) {
+		return New(out, &in.FileHeader, WithSourceSections(in.Sections))
+	})
+}
+
+func BenchmarkExtractLarge_Streaming(b *testing.B) {
+	in := openSynthetic(b,
+		elfwritertest.Section{Name: ".debug_info", Size: 64 << 20},
+		elfwritertest.Section{Name: ".debug_line", Size: 16 << 20},
+		elfwritertest.Section{Name: ".debug_str", Size: 16 << 20},
+	)
+	// Both passes of the streaming writer read the sections.
+	benchmarkWrite(b, in, func(out *os.File) (*Writer, error) {
+		return NewStreaming(out, &in.FileHeader, WithSourceSections(in.Sections))
+	})
+}
+
+func BenchmarkExtractLarge_CopyFileRange(b *testing.B) {
+	path := elfwritertest.Synthetic(b,
+		elfwritertest.Section{Name: ".debug_info", Size: 64 << 20},
+		elfwritertest.Section{Name: ".debug_line", Size: 16 << 20},
+		elfwritertest.Section{Name: ".debug_str", Size: 16 << 20},
+	)
+	in, err := elf.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer in.Close()
+	src, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer src.Close()
+	// The output is in another temporary directory, on the same filesystem.
+	benchmarkWrite(b, in, func(out *os.File) (*Writer, error) {
+		return New(out, &in.FileHeader, WithSourceSections(in.Sections), WithSourceFile(src, in))
+	})
+}
+
+func BenchmarkCompressZlib(b *testing.B) {
+	in := openSynthetic(b,
+		elfwritertest.Section{Name: ".debug_info", Size: 16 << 20, Compressed: true},
+		elfwritertest.Section{Name: ".debug_str", Size: 4 << 20, Compressed: true},
+	)
+	benchmarkWrite(b, in, func(out *os.File) (*Writer, error) {
+		return New(out, &in.FileHeader, WithSourceSections(in.Sections))
+	})
+}
+
+func BenchmarkManySections(b *testing.B) {
+	for _, n := range []int{100, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			sections := make([]elfwritertest.Section, n)
+			for i := range sections {
+				sections[i] = elfwritertest.Section{Name: fmt.Sprintf(".text.func%d", i), Size: 64}
+			}
+			in := openSynthetic(b, sections...)
+			benchmarkWrite(b, in, func(out *os.File) (*Writer, error) {
+				return New(out, &in.FileHeader, WithSourceSections(in.Sections))
+			})
+		})
+	}
+}
+
+// TestSynthetic checks that the sections of the synthetic fixtures are written as they are read.
+func TestSynthetic(t *testing.T) {
+	in, err := elf.Open(elfwritertest.Synthetic(t,
+		elfwritertest.Section{Name: ".debug_info", Size: 300 << 10},
+		elfwritertest.Section{Name: ".debug_str", Size: 100 << 10, Compressed: true},
+	))
+	require.NoError(t, err)
+	defer in.Close()
+
+	out := writeSections(t, in, in.Sections)
+	for _, name := range []string{".debug_info", ".debug_str"} {
+		want, err := in.Section(name).Data()
+		require.NoError(t, err)
+		got, err := out.Section(name).Data()
+		require.NoError(t, err)
+		require.Equal(t, want, got, name)
+	}
+}
+
+// TestWrite_Allocs checks that writing a section does not allocate, so the allocations do not
+// grow with the number of sections beyond the growth of the maps and slices of the layout.
+func TestWrite_Allocs(t *testing.T) {
+	allocs := func(n int) float64 {
+		sections := make([]elfwritertest.Section, n)
+		for i := range sections {
+			sections[i] = elfwritertest.Section{Name: fmt.Sprintf(".text.func%d", i), Size: 64}
+		}
+		in, err := elf.Open(elfwritertest.Synthetic(t, sections...))
+		require.NoError(t, err)
+		defer in.Close()
+		out, err := ioutil.TempFile(t.TempDir(), "out")
+		require.NoError(t, err)
+		defer out.Close()
+
+		return testing.AllocsPerRun(5, func() {
+			_, err := out.Seek(0, io.SeekStart)
+			require.NoError(t, err)
+			w, err := New(out, &in.FileHeader, WithSourceSections(in.Sections))
+			require.NoError(t, err)
+			w.Sections = in.Sections
+			require.NoError(t, w.Write())
+		})
+	}
+	few, many := allocs(100), allocs(2000)
+	require.Less(t, (many-few)/1900, 0.5, "allocations per section")
+}
+
+func BenchmarkManySections_Reset(b *testing.B) {
+	sections := make([]elfwritertest.Section, 10000)
+	for i := range sections {
+		sections[i] = elfwritertest.Section{Name: fmt.Sprintf(".text.func%d", i), Size: 64}
+	}
+	in := openSynthetic(b, sections...)
+	// A single writer, as agents processing many files keep.
+	w := &Writer{}
+	benchmarkWrite(b, in, func(out *os.File) (*Writer, error) {
+		return w, w.Reset(out, &in.FileHeader, WithSourceSections(in.Sections))
+	})
+}
@@ -0,0 +1,52 @@
+package elfwriter
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyRangeChunk is the size copied per copy_file_range call, so cancellation is noticed.
+const copyRangeChunk = 32 << 20
+
+// copyFileRange copies n bytes at off of src to the current offset of dst in the kernel with
+// copy_file_range. It reports false if the kernel cannot copy between the files, e.g. on
+// different filesystems or old kernels, before anything is copied.
+func copyFileRange(ctx context.Context, dst, src *os.File, off, n int64) (bool, error) {
+	first := true
+	for n > 0 {
+		if err := ctx.Err(); err != nil {
+			return true, err
+		}
+		chunk := n
+		if chunk > copyRangeChunk {
+			chunk = copyRangeChunk
+		}
+		m, err := unix.CopyFileRange(int(src.Fd()), &off, int(dst.Fd()), nil, int(chunk), 0)
+		if err != nil {
+			if first && unsupportedCopyRange(err) {
+				return false, nil
+			}
+			return true, &os.SyscallError{Syscall: "copy_file_range", Err: err}
+		}
+		if m == 0 {
+			// The input is shorter than its section headers claim, as with the generic copy
+			// the section ends there.
+			return true, nil
+		}
+		first = false
+		n -= int64(m)
+	}
+	return true, nil
+}
+
+func unsupportedCopyRange(err error) bool {
+	return errors.Is(err, unix.ENOSYS) ||
+		errors.Is(err, unix.EXDEV) ||
+		errors.Is(err, unix.EINVAL) ||
+		errors.Is(err, unix.EOPNOTSUPP) ||
+		errors.Is(err, unix.EPERM) ||
+		errors.Is(err, unix.EBADF)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package elfwriter
+
+import (
+	"context"
+	"os"
+)
+
+// copyFileRange reports false, the contents are copied by the generic path.
+func copyFileRange(context.Context, *os.File, *os.File, int64, int64) (bool, error) {
+	return false, nil
+}
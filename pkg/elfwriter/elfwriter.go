@@ -7,44 +7,55 @@
 // This package does not provide completeness guarantees, only features needed to write core files are
 // implemented, notably missing:
 // - Consistency and soundness of relocations
-// - Consistency and preservation of linked sections (when target removed (sh_link)) - partially supported
+// - Consistency and preservation of linked sections (when target removed (sh_link)) - requires WithSourceSections
 // - Consistency and existence of overlapping segments when a section removed (offset, range check)
 package elfwriter
 
 import (
 	"compress/zlib"
+	"context"
 	"debug/elf"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"runtime/debug"
+	"strings"
 
-	"golang.org/x/sys/unix"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/iohelper"
 )
 
-const sectionHeaderStrTable = ".shstrtab"
+const (
+	sectionHeaderStrTable = ".shstrtab"
+
+	// maxAlign is the largest section alignment honored, larger ones only pad the output.
+	maxAlign = 1 << 24
+)
 
 // http://www.sco.com/developers/gabi/2003-12-17/ch4.sheader.html#special_sections
 // - Figure 4-12
 // The list is incomplete list.
 var specialSectionLinks = map[string]string{
 	// Source - Target
-	".symtab": ".strtab",
-}
-
-// WriteCloserSeeker is the union of io.Writer, io.Closer and io.Seeker.
-type WriteCloserSeeker interface {
-	io.Writer
-	io.Seeker
-	io.Closer
+	".symtab":   ".strtab",
+	".dynsym":   ".dynstr",
+	".hash":     ".dynsym",
+	".gnu.hash": ".dynsym",
+	".dynamic":  ".dynstr",
 }
 
 // Writer writes ELF files.
 type Writer struct {
-	w    WriteCloserSeeker
+	w    io.WriteSeeker
 	fhdr *elf.FileHeader
 
+	// stream is the destination of streaming writers, see NewStreaming.
+	stream io.Writer
+
+	// ctx cancels an ongoing Write, see WriteContext.
+	ctx context.Context
+
 	Progs    []*elf.Prog
 	Sections []*elf.Section
 
@@ -63,8 +74,34 @@ type Writer struct {
 
 	shStrIdx map[string]int
 
+	// buf holds headers and string tables until the next write, seek or the end of Write,
+	// so they are serialized without allocations and written in one go.
+	buf []byte
+	// copyBuf is the buffer section contents are copied through.
+	copyBuf []byte
+	// sr reads the contents of uncompressed sections, see open.
+	sr io.SectionReader
+	// layout is the scratch state of writeSections.
+	layout sectionLayout
+	// zw compresses the SHF_COMPRESSED sections, it is reset for each of them.
+	// copyBuf and zw come from pools and go back to them on Close.
+	zw *zlib.Writer
+
 	// Options
 	debugCompressionEnabled bool
+	sourceSections          []*elf.Section
+	// srcFile is the file the input is read from and srcOffsets are the offsets of the contents
+	// of its sections, by their readers, see WithSourceFile.
+	srcFile    *os.File
+	srcOffsets map[io.ReaderAt]uint64
+	// sectionTee and outputTee are written the contents of the sections and of the output, see
+	// WithSectionTee and WithOutputTee.
+	sectionTee func(sec *elf.Section) io.Writer
+	outputTee  io.Writer
+	// sparse leaves holes for runs of zeros past sparseFrom, the size of the output file before
+	// writing, or -1 if it cannot, see WithSparseOutput.
+	sparse     bool
+	sparseFrom int64
 }
 
 type Note struct {
@@ -73,33 +110,11 @@ type Note struct {
 	Data []byte
 }
 
-// New creates a new Writer.
-func New(w WriteCloserSeeker, fhdr *elf.FileHeader, opts ...Option) (*Writer, error) {
-	if fhdr.ByteOrder == nil {
-		return nil, errors.New("byte order has to be specified")
-	}
-
-	switch fhdr.Class {
-	case elf.ELFCLASS32:
-	case elf.ELFCLASS64:
-		// Ok
-	default:
-		return nil, errors.New("unknown ELF class")
-	}
-
-	// TODO(kakkoyun): Check why this was unsupported for delve.
-	// if fhdr.Data != elf.ELFDATA2LSB {
-	// 	return errors.New("unsupported")
-	// }
-
-	wrt := &Writer{
-		w:                       w,
-		fhdr:                    fhdr,
-		shStrIdx:                make(map[string]int),
-		debugCompressionEnabled: false,
-	}
-	for _, opt := range opts {
-		opt(wrt)
+// New creates a new Writer. If w is an io.Closer, it is closed by Close.
+func New(w io.WriteSeeker, fhdr *elf.FileHeader, opts ...Option) (*Writer, error) {
+	wrt := &Writer{}
+	if err := wrt.Reset(w, fhdr, opts...); err != nil {
+		return nil, err
 	}
 	return wrt, nil
 }
@@ -130,11 +145,36 @@ func (w *Writer) Write() error {
 	// +-------------------------------+
 	// | ".strtab"   section           |
 	// +-------------------------------+
+	return w.WriteContext(context.Background())
+}
 
+// WriteContext is like Write, but stops copying section contents once ctx is done
+// and returns its error.
+func (w *Writer) WriteContext(ctx context.Context) error {
+	w.ctx = ctx
+	if w.stream != nil {
+		return w.writeStream()
+	}
+	if w.outputTee != nil {
+		return w.writeTee()
+	}
+	return w.writeFile()
+}
+
+// writeFile writes the file in a single pass, patching the file header once offsets are known.
+func (w *Writer) writeFile() error {
 	// 1. File Header (written in .New())
 	// 2. Program Header Table
 	// 3. Sections
 	// 4. Section Header Table
+	w.sparseFrom = -1
+	if f := w.file(); w.sparse && f != nil {
+		// Skipped regions read as zeros only past the end of the file, before that they would
+		// keep the previous contents.
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			w.sparseFrom = fi.Size()
+		}
+	}
 	w.writeFileHeader()
 	if w.err != nil {
 		return fmt.Errorf("failed to write file header: %w", w.err)
@@ -148,6 +188,7 @@ func (w *Writer) Write() error {
 	if len(w.Sections) > 0 {
 		w.writeSections()
 	}
+	w.flush()
 	if w.err != nil {
 		return fmt.Errorf("failed to write sections: %w", w.err)
 	}
@@ -167,6 +208,12 @@ func (w *Writer) WriteNotes(notes []Note) *elf.ProgHeader {
 	if len(notes) == 0 {
 		return nil
 	}
+	if w.stream != nil {
+		if w.err == nil {
+			w.err = errors.New("notes cannot be written by streaming writers")
+		}
+		return nil
+	}
 	h := &elf.ProgHeader{
 		Type:  elf.PT_NOTE,
 		Align: 4,
@@ -240,7 +287,7 @@ func (w *Writer) writeFileHeader() {
 		w.phentsize = 56
 		w.shentsize = 64
 	default:
-		w.err = errors.New("unknown ELF class")
+		w.err = fmt.Errorf("%w: %s", elfutils.ErrUnsupportedClass, fhdr.Class)
 		return
 	}
 
@@ -331,7 +378,7 @@ func (w *Writer) writeFileHeader() {
 	}
 
 	// Sanity check, size of file header should be the same as ehsize
-	if sz, _ := w.w.Seek(0, io.SeekCurrent); sz != int64(w.ehsize) {
+	if sz := w.here(); sz != int64(w.ehsize) {
 		w.err = errors.New("internal error, ELF header size")
 	}
 }
@@ -344,10 +391,10 @@ func (w *Writer) writeSegments() {
 
 	// Patch file header.
 	w.seek(w.seekProgHeader, io.SeekStart)
-	w.u64(uint64(phoff))
+	w.off(uint64(phoff)) // e_phoff
 	w.seek(w.seekProgNum, io.SeekStart)
-	w.u64(phnum) // e_phnum
-	w.seek(0, io.SeekEnd)
+	w.u16(uint16(phnum)) // e_phnum
+	w.seek(phoff, io.SeekStart)
 
 	writePH32 := func(prog *elf.Prog) {
 		// ELF32 Program header.
@@ -362,12 +409,12 @@ func (w *Writer) writeSegments() {
 		// 	Align  uint32 /* Alignment in memory and file. */
 		// }
 		w.u32(uint32(prog.Type))
-		w.u32(uint32(prog.Flags))
 		w.u32(uint32(prog.Off))
 		w.u32(uint32(prog.Vaddr))
 		w.u32(uint32(prog.Paddr))
 		w.u32(uint32(prog.Filesz))
 		w.u32(uint32(prog.Memsz))
+		w.u32(uint32(prog.Flags))
 		w.u32(uint32(prog.Align))
 	}
 
@@ -383,7 +430,7 @@ func (w *Writer) writeSegments() {
 		// 	Memsz  uint64 /* Size of contents in memory. */
 		// 	Align  uint64 /* Alignment in memory and file. */
 		// }
-		w.u32(uint32(prog.Type)) // TODO(kakkoyun): Why first element is null?
+		w.u32(uint32(prog.Type))
 		w.u32(uint32(prog.Flags))
 		w.u64(prog.Off)
 		w.u64(prog.Vaddr)
@@ -438,15 +485,26 @@ func (w *Writer) writeSections() {
 	// |           | Section header 2  |------------+ sh_offset
 	// +---------> +-------------------+
 
-	// Shallow copy the section for further editing.
+	l := &w.layout
+	l.reset(len(w.Sections))
+
+	// Shallow copy the section for further editing, the copies share a single allocation.
 	copySection := func(s *elf.Section) *elf.Section {
-		clone := new(elf.Section)
-		*clone = *s
-		return clone
+		l.clones = append(l.clones, *s)
+		return &l.clones[len(l.clones)-1]
+	}
+
+	groups, err := w.sectionGroups()
+	if err != nil {
+		w.err = err
+		return
 	}
 
 	// sections that will end up in the output.
-	stw := make([]*elf.Section, 0, len(w.Sections)+2)
+	stw := l.sections
+	// sources are the sections of w.Sections the sections of stw are copies of, nil for the
+	// sections the writer adds.
+	sources := l.sources
 
 	// Build section header string table.
 	shstrtab := new(elf.Section)
@@ -454,64 +512,106 @@ func (w *Writer) writeSections() {
 	shstrtab.Type = elf.SHT_STRTAB
 	shstrtab.Addralign = 1
 
-	sectionNameIdx := make(map[string]int)
+	sectionNameIdx := l.nameIdx
+	// output index of the given sections.
+	sectionIdx := l.idx
+	// contents of the kept section groups, by their copies.
+	groupData := make(map[*elf.Section][]byte)
+	var keptGroups [][2]*elf.Section
 	i := 0
 	for _, sec := range w.Sections {
+		if groups.dropped(sec) {
+			continue
+		}
 		if i == 0 {
 			if sec.Type == elf.SHT_NULL {
 				stw = append(stw, copySection(sec))
+				sources = append(sources, sec)
 				i++
 				continue
 			}
 			s := new(elf.Section)
 			s.Type = elf.SHT_NULL
 			stw = append(stw, s)
+			sources = append(sources, nil)
 			i++
 		}
 		if sec.Type == elf.SHT_STRTAB && sec.Name == sectionHeaderStrTable {
 			// Add new shstrtab, preserve order.
 			stw = append(stw, shstrtab)
+			sources = append(sources, nil)
 			w.shstrndx = i
 			sectionNameIdx[sec.Name] = i
+			sectionIdx[sec] = i
 			i++
 			continue
 		}
-		stw = append(stw, copySection(sec))
+		clone := copySection(sec)
+		if groups.orphaned(sec) {
+			clone.Flags &^= elf.SHF_GROUP
+		}
+		if sec.Type == elf.SHT_GROUP && groups != nil {
+			keptGroups = append(keptGroups, [2]*elf.Section{sec, clone})
+		}
+		stw = append(stw, clone)
+		sources = append(sources, sec)
 		sectionNameIdx[sec.Name] = i
+		sectionIdx[sec] = i
 		i++
 	}
 	if w.shstrndx == 0 {
 		stw = append(stw, shstrtab)
+		sources = append(sources, nil)
 		w.shstrndx = len(stw) - 1
 	}
+	for _, g := range keptGroups {
+		groupData[g[1]] = groups.data(w.fhdr.ByteOrder, g[0], sectionIdx)
+	}
 
+	l.sections, l.sources = stw, sources
 	shnum := len(stw)
 	w.shnum = shnum
 
-	names := make([]string, shnum)
-	for i, sec := range stw {
-		if sec.Name != "" {
-			names[i] = sec.Name
-		}
+	names := l.names[:0]
+	for _, sec := range stw {
+		names = append(names, sec.Name)
 	}
+	l.names = names
 
 	// Start writing actual data for sections.
 	for i, sec := range stw {
+		if sec.Addralign > 1 && sec.Type != elf.SHT_NOBITS {
+			if sec.Addralign&(sec.Addralign-1) != 0 || sec.Addralign > maxAlign {
+				w.err = fmt.Errorf("section %s has unsupported alignment %d", sec.Name, sec.Addralign)
+				return
+			}
+			w.align(int64(sec.Addralign))
+		}
 		sec.Offset = uint64(w.here())
 		// The section header string section is reserved for section header string table.
 		if i == w.shstrndx {
 			w.writeStrtab(names)
 		} else {
-			if sec.Type == elf.SHT_NULL {
+			// SHT_NOBITS sections occupy no space in the file, keep their size as is.
+			if sec.Type == elf.SHT_NULL || sec.Type == elf.SHT_NOBITS {
 				continue
 			}
 			// TODO(kakkoyun): Implement in next iterations.
 			// if w.debugCompressionEnabled {}
-			r := sec.Open()
-			if sec.Flags&elf.SHF_COMPRESSED != 0 {
-				w.writeCompressedFrom(r, w.compressionHeader(sec))
+			tee := w.tee(sources[i])
+			if data, ok := groupData[sec]; ok {
+				w.write(data)
+				if tee != nil {
+					if _, err := tee.Write(data); err != nil && w.err == nil {
+						w.err = err
+					}
+				}
+			} else if sec.Flags&elf.SHF_COMPRESSED != 0 {
+				w.writeCompressedFrom(sec, tee)
+			} else if !w.skipContents(sec) && (tee != nil || !w.copyRange(sec)) {
+				// Teed contents have to be read, they are not copied in the kernel.
+				w.writeFrom(w.open(sec, tee))
 			}
-			w.writeFrom(r)
 		}
 		sec.FileSize = uint64(w.here()) - sec.Offset
 		// Unless the section is not compressed, the Size and FileSize is the same.
@@ -523,26 +623,46 @@ func (w *Writer) writeSections() {
 	w.shoff = int(shoff)
 	// First, patch file header.
 	w.seek(w.seekSectionHeader, io.SeekStart)
-	w.u64(uint64(shoff))
+	w.off(uint64(shoff)) // e_shoff
 	w.seek(w.seekSectionNum, io.SeekStart)
-	w.u64(uint64(shnum)) // e_shnum
+	w.u16(uint16(shnum)) // e_shnum
 	w.seek(w.seekSectionStringIdx, io.SeekStart)
-	w.u64(uint64(w.shstrndx))
+	w.u16(uint16(w.shstrndx)) // e_shstrndx
 	w.seek(w.seekSectionEntrySize, io.SeekStart)
 	w.u16(w.shentsize) // e_shentsize
-	w.seek(0, io.SeekEnd)
+	w.seek(shoff, io.SeekStart)
 
-	writeLink := func(sec *elf.Section) {
-		if sec.Link > 0 {
-			target, ok := specialSectionLinks[sec.Name]
-			if ok {
-				w.u32(uint32(sectionNameIdx[target]))
-			} else {
-				w.u32(uint32(0))
+	// remap translates a section index of the input to the output,
+	// sections that did not make it to the output are SHN_UNDEF.
+	remap := func(sec *elf.Section, idx uint32) uint32 {
+		if idx == 0 {
+			return 0
+		}
+		if w.sourceSections != nil {
+			if int(idx) < len(w.sourceSections) {
+				if i, ok := sectionIdx[w.sourceSections[idx]]; ok {
+					return uint32(i)
+				}
 			}
-		} else {
-			w.u32(uint32(0))
+			return 0
+		}
+		// Without the input sections, only well-known links can be restored.
+		if target, ok := specialSectionLinks[sec.Name]; ok {
+			return uint32(sectionNameIdx[target])
 		}
+		return 0
+	}
+	writeLink := func(sec *elf.Section) {
+		w.u32(remap(sec, sec.Link))
+	}
+	// sh_info holds a section index only for relocations and when SHF_INFO_LINK is set.
+	// Symbol tables are copied as a whole, so symbol indices, e.g. in r_info, stay valid.
+	writeInfo := func(sec *elf.Section) {
+		if (sec.Type == elf.SHT_REL || sec.Type == elf.SHT_RELA || sec.Flags&elf.SHF_INFO_LINK != 0) && w.sourceSections != nil {
+			w.u32(remap(sec, sec.Info))
+			return
+		}
+		w.u32(sec.Info)
 	}
 	writeSH32 := func(shstrndx int, sec *elf.Section) {
 		// ELF32 Section header.
@@ -565,7 +685,7 @@ func (w *Writer) writeSections() {
 		w.u32(uint32(sec.Offset))
 		w.u32(uint32(sec.Size))
 		writeLink(sec)
-		w.u32(sec.Info)
+		writeInfo(sec)
 		w.u32(uint32(sec.Addralign))
 		w.u32(uint32(sec.Entsize))
 	}
@@ -591,7 +711,7 @@ func (w *Writer) writeSections() {
 		w.u64(sec.Offset)
 		w.u64(sec.Size)
 		writeLink(sec)
-		w.u32(sec.Info)
+		writeInfo(sec)
 		w.u64(sec.Addralign)
 		w.u64(sec.Entsize)
 	}
@@ -615,17 +735,23 @@ func (w *Writer) writeSections() {
 	}
 }
 
-// Close closes the WriteCloseSeeker.
+// Close closes the underlying writer, if it is an io.Closer.
+// The writer may be reused with Reset.
 func (w *Writer) Close() error {
-	var err error
-	if w.w != nil {
-		err = w.w.Close()
+	w.release()
+	var dst interface{} = w.w
+	if w.stream != nil {
+		dst = w.stream
+	}
+	if c, ok := dst.(io.Closer); ok {
+		return c.Close()
 	}
-	return err
+	return nil
 }
 
 // here returns the current seek offset from the start of the file.
 func (w *Writer) here() int64 {
+	w.flush()
 	r, err := w.w.Seek(0, io.SeekCurrent)
 	if err != nil && w.err == nil {
 		w.err = err
@@ -635,6 +761,7 @@ func (w *Writer) here() int64 {
 
 // seek moves the cursor to the point calculated using offset and starting point.
 func (w *Writer) seek(offset int64, whence int) {
+	w.flush()
 	_, err := w.w.Seek(offset, whence)
 	if err != nil && w.err == nil {
 		w.err = err
@@ -646,159 +773,301 @@ func (w *Writer) seek(offset int64, whence int) {
 func (w *Writer) align(align int64) {
 	off := w.here()
 	alignOff := (off + (align - 1)) &^ (align - 1)
-	if alignOff-off > 0 {
-		w.write(make([]byte, alignOff-off))
+	if w.skip(alignOff - off) {
+		return
+	}
+	for ; off < alignOff; off++ {
+		w.buf = append(w.buf, 0)
 	}
 }
 
+// sparseBlock is the smallest run of zeros left as a hole in sparse output files.
+const sparseBlock = 4 << 10
+
+// skip seeks over n bytes of zeros instead of writing them, leaving a hole in sparse output files,
+// see WithSparseOutput. It reports false if they have to be written.
+func (w *Writer) skip(n int64) bool {
+	if w.sparseFrom < 0 || n < sparseBlock || w.here() < w.sparseFrom {
+		return false
+	}
+	w.seek(n, io.SeekCurrent)
+	return true
+}
+
+// file returns the file the writer writes to, if the output is one. Outputs that wrap a file,
+// e.g. to count the bytes written, expose it with a File() *os.File method. The bytes written
+// to it directly bypass the wrapper.
+func (w *Writer) file() *os.File {
+	switch out := w.w.(type) {
+	case *os.File:
+		return out
+	case interface{ File() *os.File }:
+		return out.File()
+	}
+	return nil
+}
+
 func (w *Writer) write(buf []byte) {
+	w.flush()
 	_, err := w.w.Write(buf)
 	if err != nil && w.err == nil {
 		w.err = err
 	}
 }
 
-func (w *Writer) u16(n uint16) {
-	err := binary.Write(w.w, w.fhdr.ByteOrder, n)
+// flushSize is the size of buffered headers written without waiting for the next write or seek,
+// e.g. in large section header tables.
+const flushSize = 64 << 10
+
+// flush writes the buffered headers.
+func (w *Writer) flush() {
+	if len(w.buf) == 0 {
+		return
+	}
+	_, err := w.w.Write(w.buf)
 	if err != nil && w.err == nil {
 		w.err = err
 	}
+	w.buf = w.buf[:0]
 }
 
-func (w *Writer) u32(n uint32) {
-	err := binary.Write(w.w, w.fhdr.ByteOrder, n)
-	if err != nil && w.err == nil {
-		w.err = err
+// grow extends the buffered headers by n bytes and returns them.
+func (w *Writer) grow(n int) []byte {
+	if len(w.buf)+n > flushSize {
+		w.flush()
 	}
+	w.buf = append(w.buf, make([]byte, n)...)
+	return w.buf[len(w.buf)-n:]
+}
+
+func (w *Writer) u16(n uint16) {
+	w.fhdr.ByteOrder.PutUint16(w.grow(2), n)
+}
+
+func (w *Writer) u32(n uint32) {
+	w.fhdr.ByteOrder.PutUint32(w.grow(4), n)
 }
 
 func (w *Writer) u64(n uint64) {
-	err := binary.Write(w.w, w.fhdr.ByteOrder, n)
-	if err != nil && w.err == nil {
-		w.err = err
+	w.fhdr.ByteOrder.PutUint64(w.grow(8), n)
+}
+
+// off writes a file offset, its size depends on the ELF class.
+func (w *Writer) off(n uint64) {
+	if w.fhdr.Class == elf.ELFCLASS32 {
+		w.u32(uint32(n))
+		return
 	}
+	w.u64(n)
 }
 
 // writeStrtab writes given strings in string table format.
 func (w *Writer) writeStrtab(strs []string) {
 	// http://www.sco.com/developers/gabi/2003-12-17/ch4.strtab.html
-	w.write([]byte{0})
+	w.grow(1)[0] = 0
 	i := 1
 	for _, s := range strs {
 		if s == "" {
 			continue
 		}
-		data, err := unix.ByteSliceFromString(s)
-		if err != nil && w.err == nil {
-			w.err = err
+		if strings.IndexByte(s, 0) != -1 {
+			if w.err == nil {
+				w.err = fmt.Errorf("string %q contains a NUL byte", s)
+			}
 			break
 		}
 		w.shStrIdx[s] = i
-		w.write(data)
-		i += len(data)
+		copy(w.grow(len(s)+1), s) // NUL terminated, grow zeroes the buffer.
+		i += len(s) + 1
 	}
 }
 
-func (w *Writer) writeFrom(r io.Reader) {
-	if r == nil {
-		w.err = errors.New("reader is nil")
-		return
+// copyRange copies the contents of a section of the source file in the kernel, if the output
+// is a file too, see WithSourceFile. It reports false if the section has to be copied by writeFrom.
+func (w *Writer) copyRange(sec *elf.Section) bool {
+	if w.outputTee != nil {
+		// The contents have to be written to the tee as well.
+		return false
 	}
+	off, ok := w.srcOffsets[sec.ReaderAt]
+	if !ok {
+		return false
+	}
+	dst := w.file()
+	if dst == nil {
+		return false
+	}
+	w.flush()
+	copied, err := copyFileRange(w.ctx, dst, w.srcFile, int64(off), int64(sec.FileSize))
+	if !copied {
+		// Not supported for these files, do not try again for the other sections.
+		w.srcOffsets = nil
+		return false
+	}
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return true
+}
 
-	pr, pw := io.Pipe()
-
-	// write in writer end of pipe.
-	var wErr error
-	go func() {
-		defer pw.Close()
-		defer func() {
-			if r := recover(); r != nil {
-				debug.PrintStack()
-				wErr = fmt.Errorf("panic occurred: %w", r.(error))
-			}
-		}()
-		_, wErr = io.Copy(pw, r)
-	}()
-
-	// read from reader end of pipe.
-	defer pr.Close()
-	_, rErr := io.Copy(w.w, pr)
-	if wErr != nil && w.err == nil {
-		w.err = wErr
+// open returns the contents of the section as sec.Open does, reusing the reader of the writer
+// for the sections that are not compressed. The contents read are written to tee, if not nil.
+func (w *Writer) open(sec *elf.Section, tee io.Writer) io.Reader {
+	if sec.ReaderAt == nil || strings.HasPrefix(sec.Name, ".zdebug") {
+		if tee != nil {
+			return io.TeeReader(sec.Open(), tee)
+		}
+		return sec.Open()
 	}
-	if rErr != nil && w.err == nil {
-		w.err = rErr
+	r := sec.ReaderAt
+	if tee != nil {
+		r = iohelper.TeeReaderAt(r, tee)
 	}
+	w.sr = *io.NewSectionReader(r, 0, 1<<63-1)
+	return &w.sr
 }
 
-type compressionInfo struct {
-	compressionType   elf.CompressionType
-	compressionOffset int64
+// tee returns the writer the contents of the section are teed to, see WithSectionTee. Nothing is
+// teed while the file is only laid out.
+func (w *Writer) tee(sec *elf.Section) io.Writer {
+	if w.sectionTee == nil || sec == nil {
+		return nil
+	}
+	if _, ok := w.w.(*layoutRecorder); ok {
+		return nil
+	}
+	return w.sectionTee(sec)
 }
 
-func (w *Writer) compressionHeader(s *elf.Section) *compressionInfo {
-	// Read the compression header.
-	var c *compressionInfo
-	switch w.fhdr.Class {
-	case elf.ELFCLASS32:
-		ch := new(elf.Chdr32)
-		if err := binary.Read(s.Open(), w.fhdr.ByteOrder, ch); err != nil {
-			w.err = err
-			return nil
-		}
-		c.compressionType = elf.CompressionType(ch.Type)
-		s.Size = uint64(ch.Size)
-		s.Addralign = uint64(ch.Addralign)
-		c.compressionOffset = int64(binary.Size(ch))
-	case elf.ELFCLASS64:
-		ch := new(elf.Chdr64)
-		if err := binary.Read(s.Open(), w.fhdr.ByteOrder, ch); err != nil {
-			w.err = err
-			return nil
-		}
-		c.compressionType = elf.CompressionType(ch.Type)
-		s.Size = ch.Size
-		s.Addralign = ch.Addralign
-		c.compressionOffset = int64(binary.Size(ch))
+// skipContents seeks over the contents of a section that is not compressed instead of reading
+// them while the file is only laid out, if their size is known. It reports false if they have to
+// be read.
+func (w *Writer) skipContents(sec *elf.Section) bool {
+	if _, ok := w.w.(*layoutRecorder); !ok {
+		return false
 	}
-	return c
+	if sec.ReaderAt == nil || strings.HasPrefix(sec.Name, ".zdebug") {
+		return false
+	}
+	// The readers of debug/elf and the ones of the rewritten sections, e.g. a bytes.Reader.
+	sized, ok := sec.ReaderAt.(interface{ Size() int64 })
+	if !ok {
+		return false
+	}
+	w.seek(sized.Size(), io.SeekCurrent)
+	return true
 }
 
-func (w *Writer) writeCompressedFrom(r io.Reader, c *compressionInfo) {
+// writeFrom copies the contents of r until it is exhausted or the context of Write is done.
+func (w *Writer) writeFrom(r io.Reader) {
 	if r == nil {
 		w.err = errors.New("reader is nil")
 		return
 	}
-	if c == nil {
-		return
+	w.flush()
+	buf := w.copyBuffer()
+
+	defer func() {
+		if r := recover(); r != nil {
+			debug.PrintStack()
+			if w.err == nil {
+				w.err = fmt.Errorf("panic occurred: %v", r)
+			}
+		}
+	}()
+	// Copied by hand rather than with io.Copy, which would allocate a buffer for each section
+	// when the destination is a file.
+	for {
+		if err := w.ctx.Err(); err != nil {
+			if w.err == nil {
+				w.err = err
+			}
+			return
+		}
+		n, rErr := r.Read(buf)
+		if n > 0 && !(w.sparseFrom >= 0 && isZero(buf[:n]) && w.skip(int64(n))) {
+			if _, err := w.w.Write(buf[:n]); err != nil {
+				if w.err == nil {
+					w.err = err
+				}
+				return
+			}
+		}
+		if rErr == io.EOF {
+			return
+		}
+		if rErr != nil {
+			if w.err == nil {
+				w.err = rErr
+			}
+			return
+		}
 	}
+}
 
-	if c.compressionType != elf.COMPRESS_ZLIB {
-		w.err = errors.New("unsupported compression type")
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
 	}
+	return true
+}
 
-	pr, pw := io.Pipe()
+// copyBuffer returns the buffer section contents are copied through.
+func (w *Writer) copyBuffer() []byte {
+	if w.copyBuf == nil {
+		w.copyBuf = *copyBufPool.Get().(*[]byte)
+	}
+	return w.copyBuf
+}
 
-	// write in writer end of pipe.
-	var wErr error
-	go func() {
-		defer pw.Close()
-		defer func() {
-			if r := recover(); r != nil {
-				debug.PrintStack()
-				wErr = fmt.Errorf("panic occurred: %w", r.(error))
-			}
-		}()
-		_, wErr = io.Copy(pw, r)
-	}()
+// writeCompressedFrom writes the given compressed section.
+// The raw compressed payload is not accessible through debug/elf,
+// so the section is decompressed and compressed again using zlib.
+// The decompressed contents are written to tee, if not nil.
+func (w *Writer) writeCompressedFrom(sec *elf.Section, tee io.Writer) {
+	switch w.fhdr.Class {
+	case elf.ELFCLASS32:
+		// type Chdr32 struct {
+		// 	Type      uint32
+		// 	Size      uint32
+		// 	Addralign uint32
+		// }
+		w.u32(uint32(elf.COMPRESS_ZLIB))
+		w.u32(uint32(sec.Size))
+		w.u32(uint32(sec.Addralign))
+	case elf.ELFCLASS64:
+		// type Chdr64 struct {
+		// 	Type      uint32
+		// 	_         uint32 /* Reserved. */
+		// 	Size      uint64
+		// 	Addralign uint64
+		// }
+		w.u32(uint32(elf.COMPRESS_ZLIB))
+		w.u32(0)
+		w.u64(sec.Size)
+		w.u64(sec.Addralign)
+	}
 
-	// read from reader end of pipe.
-	defer pr.Close()
-	_, rErr := io.Copy(zlib.NewWriter(w.w), pr)
-	if wErr != nil && w.err == nil {
-		w.err = wErr
+	w.flush()
+	if w.zw == nil {
+		if zw, ok := zlibPool.Get().(*zlib.Writer); ok {
+			w.zw = zw
+		} else {
+			w.zw = zlib.NewWriter(nil)
+		}
+	}
+	w.zw.Reset(w.w)
+	var src io.Reader = sec.Open()
+	if tee != nil {
+		src = io.TeeReader(src, tee)
 	}
-	if rErr != nil && w.err == nil {
-		w.err = rErr
+	_, err := io.CopyBuffer(w.zw, iohelper.ContextReader(w.ctx, src), w.copyBuffer())
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	if err := w.zw.Close(); err != nil && w.err == nil {
+		w.err = err
 	}
 }
@@ -1,15 +1,23 @@
 package elfwriter
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"debug/elf"
+	"encoding/binary"
+	"hash"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
 )
 
 var isDwarf = func(s *elf.Section) bool {
@@ -19,7 +27,7 @@ var isDwarf = func(s *elf.Section) bool {
 }
 
 var isSymbolTable = func(s *elf.Section) bool {
-	return s.Name == ".symtab" || s.Name == ".dynsymtab"
+	return s.Name == ".symtab" || s.Name == ".dynsym"
 }
 
 var isGoSymbolTable = func(s *elf.Section) bool {
@@ -126,6 +134,9 @@ func TestWriter_Write(t *testing.T) {
 			require.NoError(t, err)
 
 			require.Equal(t, len(tt.fields.Progs), len(outElf.Progs))
+			for i, p := range outElf.Progs {
+				require.Equal(t, tt.fields.Progs[i].ProgHeader, p.ProgHeader)
+			}
 			require.Equal(t, tt.expectedNumberOfSections, len(outElf.Sections))
 
 			if tt.hasDWARF {
@@ -157,3 +168,584 @@ func TestWriter_Write(t *testing.T) {
 		})
 	}
 }
+
+func TestWriter_Write32(t *testing.T) {
+	// A synthetic 32-bit header, p_flags follows p_memsz in the ELF32 program headers.
+	hdr := &elf.FileHeader{
+		Class:     elf.ELFCLASS32,
+		Data:      elf.ELFDATA2LSB,
+		Version:   elf.EV_CURRENT,
+		OSABI:     elf.ELFOSABI_NONE,
+		ByteOrder: binary.LittleEndian,
+		Type:      elf.ET_EXEC,
+		Machine:   elf.EM_386,
+	}
+	progs := []*elf.Prog{
+		{ProgHeader: elf.ProgHeader{Type: elf.PT_LOAD, Flags: elf.PF_R | elf.PF_X, Off: 0x1000, Vaddr: 0x8049000, Paddr: 0x8049000, Filesz: 0x234, Memsz: 0x234, Align: 0x1000}},
+		{ProgHeader: elf.ProgHeader{Type: elf.PT_LOAD, Flags: elf.PF_R | elf.PF_W, Off: 0x2000, Vaddr: 0x804b000, Paddr: 0x804b000, Filesz: 0x10, Memsz: 0x20, Align: 0x1000}},
+		{ProgHeader: elf.ProgHeader{Type: elf.PT_GNU_STACK, Flags: elf.PF_R | elf.PF_W, Align: 0x10}},
+	}
+
+	output, err := ioutil.TempFile("", "test-output.*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.Remove(output.Name())
+	})
+	w, err := New(output, hdr)
+	require.NoError(t, err)
+	w.Progs = append(w.Progs, progs...)
+	require.NoError(t, w.Write())
+	require.NoError(t, w.Close())
+
+	outElf, err := elfutils.Open(output.Name())
+	require.NoError(t, err)
+	defer outElf.Close()
+	require.Equal(t, elf.ELFCLASS32, outElf.Class)
+	require.Equal(t, len(progs), len(outElf.Progs))
+	for i, p := range outElf.Progs {
+		require.Equal(t, progs[i].ProgHeader, p.ProgHeader)
+	}
+}
+
+func TestWriter_Tee(t *testing.T) {
+	for name, path := range map[string]string{
+		"go binary": "../../dist/split-debug",
+		"compressed sections": elfwritertest.Synthetic(t,
+			elfwritertest.Section{Name: ".debug_info", Size: 1 << 20, Compressed: true},
+			elfwritertest.Section{Name: ".debug_line", Size: 64 << 10},
+			elfwritertest.Section{Name: ".debug_str", Size: 256 << 10, Compressed: true},
+		),
+	} {
+		path := path
+		t.Run(name, func(t *testing.T) {
+			inElf, err := elfutils.Open(path)
+			require.NoError(t, err)
+			defer inElf.Close()
+
+			write := func(opts ...Option) string {
+				output, err := os.Create(filepath.Join(t.TempDir(), "output"))
+				require.NoError(t, err)
+				w, err := New(output, &inElf.FileHeader, opts...)
+				require.NoError(t, err)
+				w.Sections = inElf.Sections
+				require.NoError(t, w.Write())
+				require.NoError(t, w.Close())
+				return output.Name()
+			}
+			expected, err := ioutil.ReadFile(write())
+			require.NoError(t, err)
+
+			out := sha256.New()
+			sections := map[*elf.Section]hash.Hash{}
+			got := write(
+				WithOutputTee(out),
+				WithSectionTee(func(s *elf.Section) io.Writer {
+					h := sha256.New()
+					sections[s] = h
+					return h
+				}),
+			)
+			data, err := ioutil.ReadFile(got)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(expected, data), "output differs from the output without tees")
+			sum := sha256.Sum256(data)
+			require.Equal(t, sum[:], out.Sum(nil))
+
+			for _, s := range inElf.Sections {
+				if s.Type == elf.SHT_NULL || s.Type == elf.SHT_NOBITS || s.Name == sectionHeaderStrTable {
+					require.NotContains(t, sections, s, s.Name)
+					continue
+				}
+				require.Contains(t, sections, s, s.Name)
+				contents, err := ioutil.ReadAll(s.Open())
+				require.NoError(t, err)
+				sum := sha256.Sum256(contents)
+				require.Equal(t, sum[:], sections[s].Sum(nil), s.Name)
+			}
+		})
+	}
+}
+
+// memWriterAt is an in-memory io.WriterAt.
+type memWriterAt struct {
+	buf []byte
+}
+
+func (m *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.buf) {
+		m.buf = append(m.buf, make([]byte, end-len(m.buf))...)
+	}
+	return copy(m.buf[off:], p), nil
+}
+
+func TestWriter_Destinations(t *testing.T) {
+	inElf, err := elfutils.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+
+	var secDebug []*elf.Section
+	for _, s := range inElf.Sections {
+		if isDwarf(s) || isSymbolTable(s) || isGoSymbolTable(s) {
+			secDebug = append(secDebug, s)
+		}
+	}
+
+	write := func(t *testing.T, w *Writer) {
+		w.Progs = append(w.Progs, inElf.Progs...)
+		w.Sections = append(w.Sections, secDebug...)
+		require.NoError(t, w.Write())
+		require.NoError(t, w.Close())
+	}
+
+	output, err := ioutil.TempFile("", "test-output.*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.Remove(output.Name())
+	})
+	w, err := New(output, &inElf.FileHeader)
+	require.NoError(t, err)
+	write(t, w)
+	expected, err := ioutil.ReadFile(output.Name())
+	require.NoError(t, err)
+
+	t.Run("writer at", func(t *testing.T) {
+		out := &memWriterAt{}
+		w, err := NewWriterAt(out, &inElf.FileHeader)
+		require.NoError(t, err)
+		write(t, w)
+		require.True(t, bytes.Equal(expected, out.buf), "output differs from file output")
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		var out bytes.Buffer
+		w, err := NewStreaming(&out, &inElf.FileHeader)
+		require.NoError(t, err)
+		write(t, w)
+		require.True(t, bytes.Equal(expected, out.Bytes()), "output differs from file output")
+
+		outElf, err := elf.NewFile(bytes.NewReader(out.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, len(secDebug)+2, len(outElf.Sections)) // shstrtab, SHT_NULL
+		_, err = outElf.DWARF()
+		require.NoError(t, err)
+	})
+}
+
+func TestWriter_SectionLinks(t *testing.T) {
+	inElf, err := elfutils.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+
+	// Drop every other section that is not linked to, so indices shift.
+	linked := map[uint32]bool{}
+	for _, s := range inElf.Sections {
+		linked[s.Link] = true
+	}
+	var sections []*elf.Section
+	for i, s := range inElf.Sections {
+		if i%2 == 0 || linked[uint32(i)] || s.Link != 0 {
+			sections = append(sections, s)
+		}
+	}
+
+	output, err := ioutil.TempFile("", "test-output.*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.Remove(output.Name())
+	})
+
+	w, err := New(output, &inElf.FileHeader, WithSourceSections(inElf.Sections))
+	require.NoError(t, err)
+	w.Sections = sections
+	require.NoError(t, w.Write())
+	require.NoError(t, w.Close())
+
+	outElf, err := elfutils.Open(output.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		outElf.Close()
+	})
+
+	var checked int
+	for _, s := range sections {
+		if s.Link == 0 {
+			continue
+		}
+		out := outElf.Section(s.Name)
+		require.NotNil(t, out, s.Name)
+		require.Equal(t, inElf.Sections[s.Link].Name, outElf.Sections[out.Link].Name, s.Name)
+		checked++
+	}
+	require.NotZero(t, checked)
+}
+
+func TestWriter_WriteContext(t *testing.T) {
+	inElf, err := elfutils.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w, err := NewWriterAt(&memWriterAt{}, &inElf.FileHeader)
+	require.NoError(t, err)
+	w.Sections = inElf.Sections
+	require.ErrorIs(t, w.WriteContext(ctx), context.Canceled)
+}
+
+func TestWriter_Reset(t *testing.T) {
+	inElf, err := elfutils.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+	synthetic, err := elf.Open(elfwritertest.Synthetic(t,
+		elfwritertest.Section{Name: ".debug_info", Size: 100 << 10},
+		elfwritertest.Section{Name: ".debug_str", Size: 10 << 10, Compressed: true},
+	))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		synthetic.Close()
+	})
+
+	var secDebug []*elf.Section
+	for _, s := range inElf.Sections {
+		if isDwarf(s) || isSymbolTable(s) {
+			secDebug = append(secDebug, s)
+		}
+	}
+	files := []struct {
+		in       *elf.File
+		sections []*elf.Section
+	}{
+		{inElf, secDebug},
+		{synthetic, synthetic.Sections},
+		{inElf, inElf.Sections},
+	}
+
+	var (
+		reused    *Writer
+		streaming *Writer
+	)
+	for i, f := range files {
+		var expected, gotStreaming bytes.Buffer
+		w, err := NewStreaming(&expected, &f.in.FileHeader, WithSourceSections(f.in.Sections))
+		require.NoError(t, err)
+		w.Sections = f.sections
+		require.NoError(t, w.Write())
+
+		if reused == nil {
+			reused, err = New(nil, &f.in.FileHeader)
+			require.NoError(t, err)
+			streaming, err = NewStreaming(nil, &f.in.FileHeader)
+			require.NoError(t, err)
+		}
+		output, err := ioutil.TempFile(t.TempDir(), "test-output.*")
+		require.NoError(t, err)
+		require.NoError(t, reused.Reset(output, &f.in.FileHeader, WithSourceSections(f.in.Sections)))
+		reused.Sections = f.sections
+		require.NoError(t, reused.Write())
+		require.NoError(t, reused.Close())
+		got, err := ioutil.ReadFile(output.Name())
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(expected.Bytes(), got), "file %d differs after Reset", i)
+
+		require.NoError(t, streaming.ResetStreaming(&gotStreaming, &f.in.FileHeader, WithSourceSections(f.in.Sections)))
+		streaming.Sections = f.sections
+		require.NoError(t, streaming.Write())
+		require.True(t, bytes.Equal(expected.Bytes(), gotStreaming.Bytes()), "file %d differs after ResetStreaming", i)
+	}
+
+	require.Error(t, reused.Reset(nil, &elf.FileHeader{}))
+}
+
+func TestWriter_SourceFile(t *testing.T) {
+	// On the same filesystem as the output, so copy_file_range copies across them.
+	data, err := ioutil.ReadFile("../../dist/split-debug")
+	require.NoError(t, err)
+	input := filepath.Join(t.TempDir(), "split-debug")
+	require.NoError(t, ioutil.WriteFile(input, data, 0o644))
+
+	inElf, err := elfutils.Open(input)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+	src, err := os.Open(input)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		src.Close()
+	})
+
+	var secDebug []*elf.Section
+	for _, s := range inElf.Sections {
+		if isDwarf(s) || isSymbolTable(s) {
+			secDebug = append(secDebug, s)
+		}
+	}
+	write := func(opts ...Option) []byte {
+		output, err := ioutil.TempFile(filepath.Dir(input), "test-output.*")
+		require.NoError(t, err)
+		w, err := New(output, &inElf.FileHeader, opts...)
+		require.NoError(t, err)
+		w.Sections = secDebug
+		require.NoError(t, w.Write())
+		require.NoError(t, w.Close())
+		out, err := ioutil.ReadFile(output.Name())
+		require.NoError(t, err)
+		return out
+	}
+
+	expected := write(WithSourceSections(inElf.Sections))
+	got := write(WithSourceSections(inElf.Sections), WithSourceFile(src, inElf))
+	require.True(t, bytes.Equal(expected, got), "output differs from the generic copy")
+}
+
+func TestNewSection(t *testing.T) {
+	inElf, err := elfutils.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+
+	sec, err := NewSection(elf.SectionHeader{Name: ".extra", Type: elf.SHT_PROGBITS, Addralign: 4}, []byte("extra contents"))
+	require.NoError(t, err)
+
+	out := &memWriterAt{}
+	w, err := NewWriterAt(out, &inElf.FileHeader)
+	require.NoError(t, err)
+	w.Sections = []*elf.Section{inElf.Section(".symtab"), inElf.Section(".strtab"), sec}
+	require.NoError(t, w.Write())
+	require.NoError(t, w.Close())
+
+	outElf, err := elf.NewFile(bytes.NewReader(out.buf))
+	require.NoError(t, err)
+	extra := outElf.Section(".extra")
+	require.NotNil(t, extra)
+	require.Equal(t, uint64(4), extra.Addralign)
+	data, err := extra.Data()
+	require.NoError(t, err)
+	require.Equal(t, "extra contents", string(data))
+
+	_, err = NewSection(elf.SectionHeader{Name: ".zextra", Flags: elf.SHF_COMPRESSED}, nil)
+	require.Error(t, err)
+}
+
+func TestWriter_CShared(t *testing.T) {
+	inElf, err := elfutils.Open(elfwritertest.BuildCShared(t))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+
+	var sections []*elf.Section
+	for _, s := range inElf.Sections {
+		switch s.Type {
+		case elf.SHT_DYNSYM, elf.SHT_GNU_HASH, elf.SHT_GNU_VERSYM, elf.SHT_GNU_VERNEED:
+			sections = append(sections, s)
+			continue
+		}
+		if s.Name == ".dynstr" || isDwarf(s) || isSymbolTable(s) || isGoSymbolTable(s) || s.Name == ".strtab" {
+			sections = append(sections, s)
+		}
+	}
+
+	output, err := ioutil.TempFile("", "test-output.*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.Remove(output.Name())
+	})
+
+	w, err := New(output, &inElf.FileHeader, WithSourceSections(inElf.Sections))
+	require.NoError(t, err)
+	w.Sections = sections
+	require.NoError(t, w.Write())
+	require.NoError(t, w.Close())
+
+	outElf, err := elfutils.Open(output.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		outElf.Close()
+	})
+
+	// Dynamic symbols including their versions survive.
+	expected, err := inElf.DynamicSymbols()
+	require.NoError(t, err)
+	syms, err := outElf.DynamicSymbols()
+	require.NoError(t, err)
+	require.Equal(t, expected, syms)
+
+	var versioned bool
+	for _, s := range syms {
+		versioned = versioned || s.Version != ""
+	}
+	require.True(t, versioned, "expected versioned dynamic symbols")
+
+	for _, name := range []string{".gopclntab", ".gnu.version", ".gnu.version_r"} {
+		in, out := inElf.Section(name), outElf.Section(name)
+		require.NotNil(t, out, name)
+		inData, err := in.Data()
+		require.NoError(t, err)
+		outData, err := out.Data()
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(inData, outData), "%s differs", name)
+	}
+
+	data, err := outElf.DWARF()
+	require.NoError(t, err)
+	require.NotNil(t, data)
+}
+
+func TestWriter_Golden(t *testing.T) {
+	for _, fixture := range elfwritertest.Fixtures(t) {
+		fixture := fixture
+		t.Run(fixture.Name, func(t *testing.T) {
+			t.Parallel()
+			inElf, err := elfutils.Open(fixture.Path)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				inElf.Close()
+			})
+			elfwritertest.Verify(t, fixture.Path)
+
+			var sections []*elf.Section
+			for _, s := range inElf.Sections {
+				if isDwarf(s) || isSymbolTable(s) || isGoSymbolTable(s) || s.Name == ".strtab" {
+					sections = append(sections, s)
+				}
+			}
+
+			output := filepath.Join(t.TempDir(), "output.debug")
+			f, err := os.Create(output)
+			require.NoError(t, err)
+			w, err := New(f, &inElf.FileHeader, WithSourceSections(inElf.Sections))
+			require.NoError(t, err)
+			w.Sections = sections
+			require.NoError(t, w.Write())
+			require.NoError(t, w.Close())
+
+			elfwritertest.Verify(t, output)
+
+			// The layout of C fixtures depends on the host compiler, only Go fixtures are cross-compiled.
+			if !strings.HasPrefix(fixture.Name, "go-") {
+				return
+			}
+			outElf, err := elfutils.Open(output)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				outElf.Close()
+			})
+			elfwritertest.Golden(t, filepath.Join("testdata", "golden", fixture.Name+".golden"), elfwritertest.Summary(outElf))
+		})
+	}
+}
+
+// writeSections writes the given sections of in and opens the result.
+func writeSections(t *testing.T, in *elf.File, sections []*elf.Section) *elf.File {
+	t.Helper()
+	output, err := ioutil.TempFile(t.TempDir(), "test-output.*")
+	require.NoError(t, err)
+	w, err := New(output, &in.FileHeader, WithSourceSections(in.Sections))
+	require.NoError(t, err)
+	w.Sections = sections
+	require.NoError(t, w.Write())
+	require.NoError(t, w.Close())
+
+	out, err := elfutils.Open(output.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		out.Close()
+	})
+	return out
+}
+
+// sectionGroupMembers returns the names of the members of the section groups of f.
+func sectionGroupMembers(t *testing.T, f *elf.File) [][]string {
+	t.Helper()
+	var groups [][]string
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_GROUP {
+			continue
+		}
+		data, err := s.Data()
+		require.NoError(t, err)
+		require.Equal(t, uint32(1), f.ByteOrder.Uint32(data), "GRP_COMDAT")
+		var members []string
+		for off := 4; off < len(data); off += 4 {
+			m := f.Sections[f.ByteOrder.Uint32(data[off:])]
+			require.NotZero(t, m.Flags&elf.SHF_GROUP, m.Name)
+			members = append(members, m.Name)
+		}
+		require.Equal(t, ".symtab", f.Sections[s.Link].Name)
+		groups = append(groups, members)
+	}
+	return groups
+}
+
+func TestWriter_SectionGroups(t *testing.T) {
+	// A relocatable object with a COMDAT group per macro unit, each of a .debug_macro section and
+	// its relocations.
+	src := "#include <stddef.h>\n#define ANSWER 42\nint answer(void) { return ANSWER + (int)sizeof(size_t); }\n"
+	inElf, err := elfutils.Open(elfwritertest.BuildC(t, src, "-g3", "-c"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+	groups := sectionGroupMembers(t, inElf)
+	require.GreaterOrEqual(t, len(groups), 2)
+	require.Equal(t, []string{".debug_macro", ".rela.debug_macro"}, groups[0])
+
+	// groupOf is the group number of the members, starting at 1.
+	groupOf := map[uint32]int{}
+	n := 0
+	for _, s := range inElf.Sections {
+		if s.Type != elf.SHT_GROUP {
+			continue
+		}
+		data, err := s.Data()
+		require.NoError(t, err)
+		n++
+		for off := 4; off < len(data); off += 4 {
+			groupOf[inElf.ByteOrder.Uint32(data[off:])] = n
+		}
+	}
+
+	// Drop the code, so indices shift, the relocations of the first group and all members of the last.
+	var sections []*elf.Section
+	for i, s := range inElf.Sections {
+		g := groupOf[uint32(i)]
+		switch {
+		case s.Name == ".text" || s.Name == ".rela.text":
+			continue
+		case g == len(groups), g == 1 && s.Type == elf.SHT_RELA:
+			continue
+		}
+		sections = append(sections, s)
+	}
+
+	outElf := writeSections(t, inElf, sections)
+	want := [][]string{{".debug_macro"}}
+	for range groups[1 : len(groups)-1] {
+		want = append(want, []string{".debug_macro", ".rela.debug_macro"})
+	}
+	require.Equal(t, want, sectionGroupMembers(t, outElf))
+
+	// Members of groups that are left out are no longer flagged as such.
+	sections = sections[:0]
+	for _, s := range inElf.Sections {
+		if s.Type != elf.SHT_GROUP {
+			sections = append(sections, s)
+		}
+	}
+	outElf = writeSections(t, inElf, sections)
+	require.Empty(t, sectionGroupMembers(t, outElf))
+	for _, s := range outElf.Sections {
+		require.Zero(t, s.Flags&elf.SHF_GROUP, s.Name)
+	}
+}
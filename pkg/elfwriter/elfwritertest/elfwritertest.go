@@ -0,0 +1,302 @@
+// Package elfwritertest provides fixtures and checks for testing the output of ELF writers.
+//
+// Fixtures are compiled from small C and Go programs when the tests run,
+// Go fixtures are cross-compiled for every architecture in GoArchs.
+// Tests that need a toolchain which is not available are skipped.
+package elfwritertest
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//go:embed testdata/hello.go testdata/hello.c testdata/cshared.go
+var sources embed.FS
+
+// HelloC is the source of the C fixture of Fixtures.
+//
+//go:embed testdata/hello.c
+var HelloC string
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// GoArchs are the architectures Go fixtures are built for.
+var GoArchs = []string{"amd64", "arm64", "386", "mips"}
+
+// Fixture is an ELF file compiled for a test.
+type Fixture struct {
+	// Name identifies the fixture, e.g. in golden file names.
+	Name string
+	// Path is the path of the compiled file.
+	Path string
+}
+
+// Fixtures builds all available fixtures, the C fixture is only built when gcc is present.
+func Fixtures(t testing.TB) []Fixture {
+	t.Helper()
+	var fixtures []Fixture
+	for _, arch := range GoArchs {
+		fixtures = append(fixtures, Fixture{Name: "go-" + arch, Path: BuildGo(t, arch)})
+	}
+	if _, err := exec.LookPath("gcc"); err == nil && runtime.GOOS == "linux" {
+		fixtures = append(fixtures, Fixture{Name: "c-" + runtime.GOARCH, Path: BuildC(t, HelloC, "-g", "-O0")})
+	}
+	return fixtures
+}
+
+// BuildGo builds the Go fixture for linux/goarch.
+func BuildGo(t testing.TB, goarch string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building fixtures is skipped in short mode")
+	}
+	src := writeSource(t, "hello.go")
+	out := filepath.Join(t.TempDir(), "hello-"+goarch)
+	cmd := exec.Command("go", "build", "-trimpath", "-ldflags=-buildid=", "-o", out, src)
+	cmd.Dir = filepath.Dir(src)
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+goarch, "CGO_ENABLED=0", "GO111MODULE=off")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build Go fixture for %s: %v\n%s", goarch, err, b)
+	}
+	return out
+}
+
+// BuildCShared builds the Go fixture with -buildmode=c-shared for the host, a shared library that
+// exports a function to C. It requires a C toolchain on Linux, the test is skipped if the build
+// fails.
+func BuildCShared(t testing.TB) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building fixtures is skipped in short mode")
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("c-shared fixture requires a Linux host to produce ELF files")
+	}
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("c-shared fixture requires gcc")
+	}
+	src := writeSource(t, "cshared.go")
+	out := filepath.Join(t.TempDir(), "libcshared.so")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", out, src)
+	cmd.Dir = filepath.Dir(src)
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=1", "GO111MODULE=off")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("failed to build c-shared fixture: %v\n%s", err, b)
+	}
+	return out
+}
+
+// BuildC builds the C program of the source, main.c, with gcc and the given flags for the host,
+// e.g. -g for debug information or -c for a relocatable object, and returns its path. It requires
+// gcc on Linux.
+func BuildC(t testing.TB, src string, flags ...string) string {
+	t.Helper()
+	return BuildCFiles(t, map[string]string{"main.c": src}, flags...)
+}
+
+// BuildCFiles is like BuildC for a program of many source files, by their paths relative to the
+// directory it is built in, e.g. to test source paths.
+func BuildCFiles(t testing.TB, files map[string]string, flags ...string) string {
+	t.Helper()
+	return Build(t, "gcc", files, flags...)
+}
+
+// Build builds the program of the source files with the compiler, e.g. g++ for C++, and the given
+// flags for the host, and returns its path. Only the C and C++ sources are compiled, the other
+// files are written for the flags to refer to, e.g. linker scripts. It requires the compiler on
+// Linux.
+func Build(t testing.TB, compiler string, files map[string]string, flags ...string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building fixtures is skipped in short mode")
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("C fixture requires a Linux host to produce ELF files")
+	}
+	if _, err := exec.LookPath(compiler); err != nil {
+		t.Skipf("C fixture requires %s", compiler)
+	}
+	dir := t.TempDir()
+	names := make([]string, 0, len(files))
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		switch filepath.Ext(name) {
+		case ".c", ".cc", ".cpp":
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	args := append(append([]string{"-o", filepath.Join(dir, "prog")}, flags...), names...)
+	cmd := exec.Command(compiler, args...)
+	cmd.Dir = dir
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build fixture with %s: %v\n%s", compiler, err, b)
+	}
+	return filepath.Join(dir, "prog")
+}
+
+func writeSource(t testing.TB, name string) string {
+	t.Helper()
+	data, err := sources.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Verify checks that the ELF file at path is loadable by debug/elf and its DWARF by debug/dwarf,
+// and that readelf and gdb can read it when they are present.
+func Verify(t testing.TB, path string) {
+	t.Helper()
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NOBITS || s.Type == elf.SHT_NULL {
+			continue
+		}
+		if _, err := s.Data(); err != nil {
+			t.Errorf("failed to read section %s: %v", s.Name, err)
+		}
+	}
+	if _, err := f.Symbols(); err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		t.Errorf("failed to read symbols: %v", err)
+	}
+	if err := VerifyDWARF(f); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := exec.LookPath("readelf"); err == nil {
+		var stderr bytes.Buffer
+		cmd := exec.Command("readelf", "--wide", "--file-header", "--sections", "--symbols", "--debug-dump=info", path)
+		cmd.Stdout = ioutil.Discard
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil || strings.Contains(stderr.String(), "Error") {
+			t.Errorf("readelf failed to read %s: %v\n%s", path, err, stderr.String())
+		}
+	}
+	if _, err := exec.LookPath("gdb"); err == nil && isHost(f) {
+		out, err := exec.Command("gdb", "-nx", "-batch", "-ex", "info functions main", path).CombinedOutput()
+		if err != nil || bytes.Contains(out, []byte("No symbol table")) {
+			t.Errorf("gdb failed to read %s: %v\n%s", path, err, out)
+		}
+	}
+}
+
+// VerifyDWARF checks that the DWARF data of f can be read entirely and has compile units.
+func VerifyDWARF(f *elf.File) error {
+	data, err := f.DWARF()
+	if err != nil {
+		return fmt.Errorf("failed to load DWARF: %w", err)
+	}
+	var units int
+	r := data.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read DWARF entries: %w", err)
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+		units++
+		lr, err := data.LineReader(e)
+		if err != nil {
+			return fmt.Errorf("failed to read line table: %w", err)
+		}
+		if lr == nil {
+			continue
+		}
+		var le dwarf.LineEntry
+		for {
+			if err := lr.Next(&le); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return fmt.Errorf("failed to read line table: %w", err)
+			}
+		}
+	}
+	if units == 0 {
+		return errors.New("no DWARF compile units")
+	}
+	return nil
+}
+
+func isHost(f *elf.File) bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	switch runtime.GOARCH {
+	case "amd64":
+		return f.Machine == elf.EM_X86_64
+	case "arm64":
+		return f.Machine == elf.EM_AARCH64
+	}
+	return false
+}
+
+// Summary describes the layout of f independent of offsets and sizes,
+// which change with the toolchain the fixtures are built with.
+func Summary(f *elf.File) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "class=%s data=%s machine=%s type=%s\n", f.Class, f.Data, f.Machine, f.Type)
+	for i, s := range f.Sections {
+		link := ""
+		if s.Link != 0 && int(s.Link) < len(f.Sections) {
+			link = " link=" + f.Sections[s.Link].Name
+		}
+		fmt.Fprintf(&b, "[%2d] %s %s flags=%s%s\n", i, s.Name, s.Type, s.Flags, link)
+	}
+	return b.String()
+}
+
+// Golden compares got with the golden file at path, with -update the golden file is written instead.
+func Golden(t testing.TB, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0o644); err != nil { //nolint:gosec
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run with -update to create it: %v", err)
+	}
+	if string(want) != got {
+		t.Errorf("%s differs from the golden file, run with -update to update it:\n--- want\n%s\n--- got\n%s", path, want, got)
+	}
+}
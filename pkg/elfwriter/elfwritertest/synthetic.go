@@ -0,0 +1,179 @@
+package elfwritertest
+
+import (
+	"bufio"
+	"compress/zlib"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Section is a section of a synthetic ELF file.
+type Section struct {
+	Name string
+	// Size is the size of the contents, before compression.
+	Size int64
+	// Compressed compresses the contents with zlib, as SHF_COMPRESSED.
+	Compressed bool
+}
+
+// Synthetic writes a 64-bit little endian relocatable ELF file with the sections to a temporary
+// file and returns its path. The sections are filled with deterministic data that compresses
+// about as well as DWARF, they are generated as they are written, so fixtures of several GB do
+// not need the memory. The file has no DWARF that debug/dwarf could parse, it is meant for
+// benchmarking the copying and the layout of sections.
+func Synthetic(t testing.TB, sections ...Section) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "synthetic.o")
+	if err := writeSynthetic(path, sections); err != nil {
+		t.Fatalf("failed to write synthetic ELF file: %v", err)
+	}
+	return path
+}
+
+func writeSynthetic(path string, sections []Section) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bw := bufio.NewWriterSize(f, 1<<20)
+	cw := &countingWriter{w: bw}
+
+	const (
+		ehsize    = 64
+		shentsize = 64
+	)
+	// The file header is written last, once the offset of the section headers is known.
+	if _, err := cw.Write(make([]byte, ehsize)); err != nil {
+		return err
+	}
+
+	shstrtab := []byte{0}
+	headers := []elf.Section64{{}}
+	for _, s := range sections {
+		hdr := elf.Section64{
+			Name:      uint32(len(shstrtab)),
+			Type:      uint32(elf.SHT_PROGBITS),
+			Off:       uint64(cw.n),
+			Addralign: 1,
+		}
+		shstrtab = append(append(shstrtab, s.Name...), 0)
+		if s.Compressed {
+			hdr.Flags = uint64(elf.SHF_COMPRESSED)
+			hdr.Addralign = 8
+			if err := writeCompressed(cw, s.Size); err != nil {
+				return err
+			}
+		} else if err := fill(cw, s.Size); err != nil {
+			return err
+		}
+		hdr.Size = uint64(cw.n) - hdr.Off
+		headers = append(headers, hdr)
+	}
+
+	strtab := elf.Section64{Name: uint32(len(shstrtab)), Type: uint32(elf.SHT_STRTAB), Off: uint64(cw.n), Addralign: 1}
+	shstrtab = append(shstrtab, ".shstrtab\x00"...)
+	strtab.Size = uint64(len(shstrtab))
+	headers = append(headers, strtab)
+	if _, err := cw.Write(shstrtab); err != nil {
+		return err
+	}
+	if pad := (8 - cw.n%8) % 8; pad > 0 {
+		if _, err := cw.Write(make([]byte, pad)); err != nil {
+			return err
+		}
+	}
+	shoff := cw.n
+	for _, hdr := range headers {
+		if err := binary.Write(cw, binary.LittleEndian, hdr); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	fhdr := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(shoff),
+		Ehsize:    ehsize,
+		Shentsize: shentsize,
+		Shnum:     uint16(len(headers)),
+		Shstrndx:  uint16(len(headers) - 1),
+	}
+	copy(fhdr.Ident[:], elf.ELFMAG)
+	fhdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	fhdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	fhdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(f, binary.LittleEndian, fhdr); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeCompressed writes the compression header and the zlib stream of size bytes of data.
+func writeCompressed(w io.Writer, size int64) error {
+	chdr := elf.Chdr64{Type: uint32(elf.COMPRESS_ZLIB), Size: uint64(size), Addralign: 1}
+	if err := binary.Write(w, binary.LittleEndian, chdr); err != nil {
+		return err
+	}
+	zw := zlib.NewWriter(w)
+	if err := fill(zw, size); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// fill writes size bytes of data mixing runs of repeated bytes and random ones, which
+// compresses to about a third, as DWARF does.
+func fill(w io.Writer, size int64) error {
+	rnd := rand.New(rand.NewSource(size))
+	buf := make([]byte, 64<<10)
+	for size > 0 {
+		for i := 0; i < len(buf); {
+			n := 1 + rnd.Intn(16)
+			if i+n > len(buf) {
+				n = len(buf) - i
+			}
+			if rnd.Intn(2) == 0 {
+				b := byte(rnd.Intn(8))
+				for j := 0; j < n; j++ {
+					buf[i+j] = b
+				}
+			} else {
+				rnd.Read(buf[i : i+n])
+			}
+			i += n
+		}
+		n := int64(len(buf))
+		if n > size {
+			n = size
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return err
+		}
+		size -= n
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
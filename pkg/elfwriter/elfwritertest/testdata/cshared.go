@@ -0,0 +1,9 @@
+// Command cshared is built with -buildmode=c-shared as a test fixture.
+package main
+
+import "C"
+
+//export Add
+func Add(a, b C.int) C.int { return a + b }
+
+func main() {}
@@ -0,0 +1,16 @@
+#include <stdio.h>
+
+struct greeter {
+	const char *name;
+};
+
+static int greet(const struct greeter *g)
+{
+	return printf("hello, %s\n", g->name);
+}
+
+int main(void)
+{
+	struct greeter g = { "world" };
+	return greet(&g) < 0;
+}
@@ -0,0 +1,20 @@
+// Command hello is built as a test fixture.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type greeter struct {
+	name string
+}
+
+//go:noinline
+func (g greeter) greet() string {
+	return "hello, " + g.name
+}
+
+func main() {
+	fmt.Fprintln(os.Stdout, greeter{name: "world"}.greet())
+}
@@ -0,0 +1,40 @@
+package elfwriter
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"testing"
+)
+
+func FuzzWriter(f *testing.F) {
+	for _, path := range []string{"/bin/true", "/usr/bin/true"} {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			f.Add(data)
+			break
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		inElf, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		out := &memWriterAt{}
+		w, err := NewWriterAt(out, &inElf.FileHeader, WithSourceSections(inElf.Sections))
+		if err != nil {
+			return
+		}
+		w.Progs = inElf.Progs
+		w.Sections = inElf.Sections
+		if err := w.Write(); err != nil {
+			return
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := elf.NewFile(bytes.NewReader(out.buf)); err != nil {
+			t.Fatalf("failed to read written file: %v", err)
+		}
+	})
+}
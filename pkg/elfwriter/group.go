@@ -0,0 +1,101 @@
+package elfwriter
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+)
+
+// sectionGroups are the section groups (SHT_GROUP) of relocatable objects among the written
+// sections, e.g. the COMDAT groups of C++ inline functions. Groups list their members by section
+// index, so they are rewritten with the indices of the output and without the members that are
+// left out. Groups without members left, or without their symbol table, are dropped.
+type sectionGroups struct {
+	// flags is the first word of the kept groups, e.g. GRP_COMDAT.
+	flags map[*elf.Section]uint32
+	// members are the written members of the kept groups.
+	members map[*elf.Section][]*elf.Section
+	// grouped are the members of the kept groups.
+	grouped map[*elf.Section]bool
+}
+
+// sectionGroups reads the section groups of w.Sections. Without the input sections, the member
+// indices cannot be translated and it returns nil, the groups are written as they are.
+func (w *Writer) sectionGroups() (*sectionGroups, error) {
+	if w.sourceSections == nil {
+		return nil, nil
+	}
+	written := make(map[*elf.Section]bool, len(w.Sections))
+	for _, s := range w.Sections {
+		written[s] = true
+	}
+	source := func(idx uint32) *elf.Section {
+		if idx == 0 || int(idx) >= len(w.sourceSections) {
+			return nil
+		}
+		return w.sourceSections[idx]
+	}
+
+	g := &sectionGroups{
+		flags:   map[*elf.Section]uint32{},
+		members: map[*elf.Section][]*elf.Section{},
+		grouped: map[*elf.Section]bool{},
+	}
+	bo := w.fhdr.ByteOrder
+	for _, s := range w.Sections {
+		if s.Type != elf.SHT_GROUP {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read section group %s: %w", s.Name, err)
+		}
+		if len(data) < 4 || len(data)%4 != 0 {
+			return nil, fmt.Errorf("malformed section group %s of %d bytes", s.Name, len(data))
+		}
+		// The signature of the group is a symbol of the linked symbol table.
+		if symtab := source(s.Link); symtab == nil || !written[symtab] {
+			continue
+		}
+		var members []*elf.Section
+		for off := 4; off < len(data); off += 4 {
+			if m := source(bo.Uint32(data[off:])); m != nil && written[m] {
+				members = append(members, m)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+		g.flags[s] = bo.Uint32(data)
+		g.members[s] = members
+		for _, m := range members {
+			g.grouped[m] = true
+		}
+	}
+	return g, nil
+}
+
+// dropped reports whether the section is a group that is left out.
+func (g *sectionGroups) dropped(s *elf.Section) bool {
+	if g == nil || s.Type != elf.SHT_GROUP {
+		return false
+	}
+	_, ok := g.members[s]
+	return !ok
+}
+
+// orphaned reports whether the section is flagged as a member of a group that is left out.
+func (g *sectionGroups) orphaned(s *elf.Section) bool {
+	return g != nil && s.Flags&elf.SHF_GROUP != 0 && !g.grouped[s]
+}
+
+// data returns the contents of the kept group s with the member indices of the output.
+func (g *sectionGroups) data(bo binary.ByteOrder, s *elf.Section, sectionIdx map[*elf.Section]int) []byte {
+	members := g.members[s]
+	data := make([]byte, 4*(1+len(members)))
+	bo.PutUint32(data, g.flags[s])
+	for i, m := range members {
+		bo.PutUint32(data[4*(i+1):], uint32(sectionIdx[m]))
+	}
+	return data
+}
@@ -1,5 +1,12 @@
 package elfwriter
 
+import (
+	"debug/elf"
+	"io"
+	"os"
+	"strings"
+)
+
 type Option func(w *Writer)
 
 func WithDebugCompressionEnabled(b bool) Option {
@@ -7,3 +14,58 @@ func WithDebugCompressionEnabled(b bool) Option {
 		w.debugCompressionEnabled = b
 	}
 }
+
+// WithSourceSections sets the sections of the input file, in their original order.
+// They are used to translate the section indices in sh_link and sh_info
+// of the written sections, which change when sections are left out.
+func WithSourceSections(sections []*elf.Section) Option {
+	return func(w *Writer) {
+		w.sourceSections = sections
+	}
+}
+
+// WithSourceFile sets the file the input in was opened from. The sections of in that are written
+// as they are, are copied in the kernel with copy_file_range on Linux, if the output is a file too.
+// Their contents are read from f at their offsets, f has to stay open while writing.
+func WithSourceFile(f *os.File, in *elf.File) Option {
+	return func(w *Writer) {
+		w.srcFile = f
+		w.srcOffsets = make(map[io.ReaderAt]uint64, len(in.Sections))
+		for _, s := range in.Sections {
+			if s.ReaderAt == nil || s.Type == elf.SHT_NOBITS || strings.HasPrefix(s.Name, ".zdebug") {
+				continue
+			}
+			w.srcOffsets[s.ReaderAt] = s.Offset
+		}
+	}
+}
+
+// WithSparseOutput leaves holes in the output file for runs of zeros, e.g. the padding of sections
+// with large alignments and zeroed section contents, instead of writing them, so they take no disk
+// space on filesystems with sparse files. It has no effect unless the output is a file.
+func WithSparseOutput(b bool) Option {
+	return func(w *Writer) {
+		w.sparse = b
+	}
+}
+
+// WithSectionTee writes the contents of each written section to the writer fn returns for it, if
+// it returns one, e.g. to hash the sections while they are written. fn is called with the sections
+// of Writer.Sections, the contents are the decompressed ones sec.Open returns. Teed sections are
+// read through the writer rather than copied in the kernel, see WithSourceFile.
+func WithSectionTee(fn func(sec *elf.Section) io.Writer) Option {
+	return func(w *Writer) {
+		w.sectionTee = fn
+	}
+}
+
+// WithOutputTee writes the output to out as well, front to back, e.g. to hash the output while it
+// is written. The file header is patched once the sections are written, so the file is laid out
+// first, as NewStreaming does. Only the contents of the compressed sections are read to lay it out,
+// the size of the others is known. Sections are read through the writer rather than copied in the
+// kernel.
+func WithOutputTee(out io.Writer) Option {
+	return func(w *Writer) {
+		w.outputTee = out
+	}
+}
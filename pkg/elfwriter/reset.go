@@ -0,0 +1,137 @@
+package elfwriter
+
+import (
+	"context"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+)
+
+var (
+	// copyBufPool holds the buffers section contents are copied through.
+	copyBufPool = sync.Pool{New: func() interface{} {
+		buf := make([]byte, 32<<10)
+		return &buf
+	}}
+	// zlibPool holds the writers compressing SHF_COMPRESSED sections, about 256KB each.
+	zlibPool sync.Pool
+)
+
+// Reset discards the state of the writer and makes it write a new file to out, as New does.
+// The options of the previous file are discarded too. The buffers of the writer are kept, so
+// a writer reused across many files does not allocate them again. A zero Writer, e.g. from a
+// sync.Pool, has to be Reset before it is used.
+func (w *Writer) Reset(out io.WriteSeeker, fhdr *elf.FileHeader, opts ...Option) error {
+	if fhdr.ByteOrder == nil {
+		return errors.New("byte order has to be specified")
+	}
+
+	switch fhdr.Class {
+	case elf.ELFCLASS32:
+	case elf.ELFCLASS64:
+		// Ok
+	default:
+		return fmt.Errorf("%w: %s", elfutils.ErrUnsupportedClass, fhdr.Class)
+	}
+
+	// TODO(kakkoyun): Check why this was unsupported for delve.
+	// if fhdr.Data != elf.ELFDATA2LSB {
+	// 	return errors.New("unsupported")
+	// }
+
+	shStrIdx := w.shStrIdx
+	if shStrIdx == nil {
+		shStrIdx = make(map[string]int)
+	}
+	for k := range shStrIdx {
+		delete(shStrIdx, k)
+	}
+	*w = Writer{
+		w:                       out,
+		fhdr:                    fhdr,
+		ctx:                     context.Background(),
+		shStrIdx:                shStrIdx,
+		debugCompressionEnabled: false,
+
+		buf:     w.buf[:0],
+		copyBuf: w.copyBuf,
+		zw:      w.zw,
+		layout:  w.layout,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return nil
+}
+
+// ResetStreaming is like Reset, for writers created by NewStreaming.
+func (w *Writer) ResetStreaming(out io.Writer, fhdr *elf.FileHeader, opts ...Option) error {
+	if err := w.Reset(nil, fhdr, opts...); err != nil {
+		return err
+	}
+	w.stream = out
+	return nil
+}
+
+// release puts the pooled buffers of the writer back.
+func (w *Writer) release() {
+	if w.copyBuf != nil {
+		buf := w.copyBuf
+		copyBufPool.Put(&buf)
+		w.copyBuf = nil
+	}
+	if w.zw != nil {
+		zlibPool.Put(w.zw)
+		w.zw = nil
+	}
+}
+
+// sectionLayout is the scratch state of writeSections, it is kept across files.
+type sectionLayout struct {
+	// sections that end up in the output.
+	sections []*elf.Section
+	// sources are the sections of Writer.Sections the sections are copies of, by output index.
+	sources []*elf.Section
+	// clones are the shallow copies of the written sections.
+	clones []elf.Section
+	// names of the sections, by their output index.
+	names []string
+	// nameIdx and idx are the output indices of the sections, by their name and by the input sections.
+	nameIdx map[string]int
+	idx     map[*elf.Section]int
+}
+
+// reset clears the layout for n input sections.
+func (l *sectionLayout) reset(n int) {
+	// The clones are referenced by pointers, they must not move while they are appended.
+	if cap(l.clones) < n {
+		l.clones = make([]elf.Section, 0, n)
+	}
+	for i := range l.clones {
+		l.clones[i] = elf.Section{}
+	}
+	l.clones = l.clones[:0]
+	for i := range l.sections {
+		l.sections[i] = nil
+	}
+	l.sections = l.sections[:0]
+	for i := range l.sources {
+		l.sources[i] = nil
+	}
+	l.sources = l.sources[:0]
+	l.names = l.names[:0]
+	if l.nameIdx == nil {
+		l.nameIdx = make(map[string]int, n)
+		l.idx = make(map[*elf.Section]int, n)
+	}
+	for k := range l.nameIdx {
+		delete(l.nameIdx, k)
+	}
+	for k := range l.idx {
+		delete(l.idx, k)
+	}
+}
@@ -0,0 +1,70 @@
+package elfwriter
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+)
+
+// NewSection creates a section with the given header and contents to be written
+// along with the sections of an input file, e.g. an index built from them.
+// The offset and the sizes of the header are set from data.
+//
+// debug/elf can only read section contents from files, so the section is backed
+// by a minimal in-memory ELF file holding data.
+func NewSection(hdr elf.SectionHeader, data []byte) (*elf.Section, error) {
+	if hdr.Flags&elf.SHF_COMPRESSED != 0 {
+		return nil, errors.New("compressed sections are not supported")
+	}
+
+	const (
+		ehsize    = 64
+		shentsize = 64
+	)
+	shstrtab := []byte("\x00.data\x00.shstrtab\x00")
+	dataOff := uint64(ehsize)
+	strOff := dataOff + uint64(len(data))
+	shoff := (strOff + uint64(len(shstrtab)) + 7) &^ 7
+
+	var buf bytes.Buffer
+	fhdr := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shoff,
+		Ehsize:    ehsize,
+		Shentsize: shentsize,
+		Shnum:     3,
+		Shstrndx:  2,
+	}
+	copy(fhdr.Ident[:], elf.ELFMAG)
+	fhdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	fhdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	fhdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	if err := binary.Write(&buf, binary.LittleEndian, fhdr); err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+	buf.Write(shstrtab)
+	buf.Write(make([]byte, shoff-uint64(buf.Len())))
+	for _, sh := range []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_PROGBITS), Off: dataOff, Size: uint64(len(data)), Addralign: 1},
+		{Name: 7, Type: uint32(elf.SHT_STRTAB), Off: strOff, Size: uint64(len(shstrtab)), Addralign: 1},
+	} {
+		if err := binary.Write(&buf, binary.LittleEndian, sh); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	sec := f.Sections[1]
+	sec.SectionHeader = hdr
+	sec.Offset = dataOff
+	sec.Size = uint64(len(data))
+	sec.FileSize = uint64(len(data))
+	return sec, nil
+}
@@ -0,0 +1,56 @@
+package elfwriter
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriter_CompressedAndNOBITS checks that compressed sections are written compressed with their
+// contents intact, and that SHT_NOBITS sections keep their size without taking space in the file.
+func TestWriter_CompressedAndNOBITS(t *testing.T) {
+	prog := elfwritertest.BuildC(t, "static char buf[1 << 20];\nint main(void) { return buf[3]; }\n", "-g", "-gz=zlib")
+	dir := filepath.Dir(prog)
+
+	in, err := elf.Open(prog)
+	require.NoError(t, err)
+	defer in.Close()
+	bss, info := in.Section(".bss"), in.Section(".debug_info")
+	require.NotNil(t, bss)
+	require.NotNil(t, info)
+	require.NotZero(t, info.Flags&elf.SHF_COMPRESSED)
+
+	output, err := os.Create(filepath.Join(dir, "prog.debug"))
+	require.NoError(t, err)
+	w, err := New(output, &in.FileHeader)
+	require.NoError(t, err)
+	w.Sections = append(w.Sections, bss, info)
+	require.NoError(t, w.Write())
+	require.NoError(t, output.Close())
+
+	fi, err := os.Stat(output.Name())
+	require.NoError(t, err)
+	require.Less(t, fi.Size(), int64(bss.Size), "NOBITS section written to the file")
+
+	got, err := elf.Open(output.Name())
+	require.NoError(t, err)
+	defer got.Close()
+	gotBSS := got.Section(".bss")
+	require.NotNil(t, gotBSS)
+	require.Equal(t, elf.SHT_NOBITS, gotBSS.Type)
+	require.Equal(t, bss.Size, gotBSS.Size)
+
+	gotInfo := got.Section(".debug_info")
+	require.NotNil(t, gotInfo)
+	require.NotZero(t, gotInfo.Flags&elf.SHF_COMPRESSED)
+	want, err := info.Data()
+	require.NoError(t, err)
+	data, err := gotInfo.Data()
+	require.NoError(t, err)
+	require.Equal(t, want, data)
+}
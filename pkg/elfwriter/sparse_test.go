@@ -0,0 +1,56 @@
+//go:build linux
+
+package elfwriter
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_SparseOutput(t *testing.T) {
+	var sections []*elf.Section
+	for _, s := range []struct {
+		name  string
+		align uint64
+		data  []byte
+	}{
+		{".a", 1, []byte("a")},
+		{".aligned", 4 << 20, []byte("aligned")}, // Padded with about 4MiB of zeros.
+		{".zeros", 1, make([]byte, 4<<20)},
+		{".b", 1, []byte("b")},
+	} {
+		sec, err := NewSection(elf.SectionHeader{Name: s.name, Type: elf.SHT_PROGBITS, Addralign: s.align}, s.data)
+		require.NoError(t, err)
+		sections = append(sections, sec)
+	}
+	fhdr := &elf.FileHeader{Class: elf.ELFCLASS64, Data: elf.ELFDATA2LSB, Version: elf.EV_CURRENT, ByteOrder: binary.LittleEndian, Type: elf.ET_REL, Machine: elf.EM_X86_64}
+
+	write := func(sparse bool) ([]byte, int64) {
+		output, err := ioutil.TempFile(t.TempDir(), "test-output.*")
+		require.NoError(t, err)
+		w, err := New(output, fhdr, WithSparseOutput(sparse))
+		require.NoError(t, err)
+		w.Sections = sections
+		require.NoError(t, w.Write())
+		require.NoError(t, w.Close())
+
+		fi, err := os.Stat(output.Name())
+		require.NoError(t, err)
+		data, err := ioutil.ReadFile(output.Name())
+		require.NoError(t, err)
+		return data, fi.Sys().(*syscall.Stat_t).Blocks * 512
+	}
+
+	expected, dense := write(false)
+	got, sparse := write(true)
+	require.True(t, bytes.Equal(expected, got), "sparse output differs")
+	require.Greater(t, dense, int64(8<<20))
+	require.Less(t, sparse, int64(1<<20))
+}
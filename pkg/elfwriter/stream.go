@@ -0,0 +1,272 @@
+package elfwriter
+
+import (
+	"debug/elf"
+	"errors"
+	"io"
+	"math"
+	"os"
+
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+)
+
+// NewWriterAt creates a new Writer that writes to w, e.g. a memory buffer or a multipart upload.
+// If w is an io.Closer, it is closed by Close.
+func NewWriterAt(w io.WriterAt, fhdr *elf.FileHeader, opts ...Option) (*Writer, error) {
+	return New(&writerAtSeeker{
+		SectionWriter: iohelper.NewSectionWriter(w, 0, math.MaxInt64),
+		w:             w,
+	}, fhdr, opts...)
+}
+
+// writerAtSeeker keeps the underlying io.WriterAt around to be closed.
+type writerAtSeeker struct {
+	*iohelper.SectionWriter
+	w io.WriterAt
+}
+
+func (w *writerAtSeeker) Close() error {
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewStreaming creates a new Writer for destinations that cannot seek, e.g. pipes.
+// If w is an io.Closer, it is closed by Close.
+//
+// The file header has to be patched once the layout of the sections is known,
+// so the file is written in two passes: the first one only lays out the file
+// and records the patches, the second one writes the file sequentially with
+// the patches applied. Section contents are read once per pass.
+// Notes are not supported.
+func NewStreaming(w io.Writer, fhdr *elf.FileHeader, opts ...Option) (*Writer, error) {
+	wrt, err := New(nil, fhdr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	wrt.stream = w
+	return wrt, nil
+}
+
+// writeStream writes the file to the stream in two passes.
+func (w *Writer) writeStream() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	layout := &layoutRecorder{}
+	w.w = layout
+	if err := w.writeFile(); err != nil {
+		return err
+	}
+
+	w.reset()
+	out := w.stream
+	if w.outputTee != nil {
+		out = io.MultiWriter(out, w.outputTee)
+	}
+	w.w = &patchWriter{w: out, patches: layout.patches}
+	return w.writeFile()
+}
+
+// writeTee writes the file to the output and front to back to the output tee, in two passes as
+// writeStream does. The first one only lays out the file, the second one writes it to the output
+// as writeFile does and to the tee with the patches applied, see WithOutputTee.
+func (w *Writer) writeTee() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	out := w.w
+	layout := &layoutRecorder{}
+	w.w = layout
+	if err := w.writeFile(); err != nil {
+		return err
+	}
+
+	w.reset()
+	w.w = &teeWriteSeeker{WriteSeeker: out, tee: &patchWriter{w: w.outputTee, patches: layout.patches}}
+	return w.writeFile()
+}
+
+// reset clears the state of a previous pass.
+func (w *Writer) reset() {
+	w.err = nil
+	w.shnum, w.shoff, w.shstrndx = 0, 0, 0
+	for k := range w.shStrIdx {
+		delete(w.shStrIdx, k)
+	}
+}
+
+// patch is a write to an already written region of the file.
+type patch struct {
+	off  int64
+	data []byte
+}
+
+// layoutRecorder discards the contents and records the writes to already written regions.
+type layoutRecorder struct {
+	pos, size int64
+	patches   []patch
+}
+
+func (l *layoutRecorder) Write(p []byte) (int, error) {
+	if l.pos < l.size {
+		n := int64(len(p))
+		if rest := l.size - l.pos; n > rest {
+			n = rest
+		}
+		data := make([]byte, n)
+		copy(data, p)
+		l.patches = append(l.patches, patch{off: l.pos, data: data})
+	}
+	l.pos += int64(len(p))
+	if l.pos > l.size {
+		l.size = l.pos
+	}
+	return len(p), nil
+}
+
+func (l *layoutRecorder) Seek(offset int64, whence int) (int64, error) {
+	pos, err := seekPos(offset, whence, l.pos, l.size)
+	if err != nil {
+		return 0, err
+	}
+	l.pos = pos
+	return pos, nil
+}
+
+// patchWriter writes sequentially to the underlying writer and applies the recorded patches.
+// Writes to already written regions are dropped, they are covered by the patches.
+type patchWriter struct {
+	w       io.Writer
+	pos     int64
+	written int64
+	patches []patch
+}
+
+func (pw *patchWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if n == 0 {
+		return 0, nil
+	}
+	start := pw.pos
+	pw.pos += int64(n)
+
+	if start < pw.written {
+		skip := pw.written - start
+		if skip >= int64(n) {
+			return n, nil
+		}
+		p, start = p[skip:], pw.written
+	}
+	if start > pw.written {
+		// Fill the gap left by seeking forward.
+		if _, err := pw.w.Write(make([]byte, start-pw.written)); err != nil {
+			return 0, err
+		}
+		pw.written = start
+	}
+
+	buf, copied := p, false
+	for _, pt := range pw.patches {
+		end := pt.off + int64(len(pt.data))
+		if end <= start || pt.off >= start+int64(len(p)) {
+			continue
+		}
+		if !copied {
+			// Do not modify the buffer of the caller.
+			buf, copied = append([]byte(nil), p...), true
+		}
+		from, to := max64(pt.off, start), min64(end, start+int64(len(p)))
+		copy(buf[from-start:to-start], pt.data[from-pt.off:to-pt.off])
+	}
+
+	m, err := pw.w.Write(buf)
+	pw.written += int64(m)
+	if err != nil {
+		return n - len(p) + m, err
+	}
+	return n, nil
+}
+
+func (pw *patchWriter) Seek(offset int64, whence int) (int64, error) {
+	pos, err := seekPos(offset, whence, pw.pos, pw.written)
+	if err != nil {
+		return 0, err
+	}
+	pw.pos = pos
+	return pos, nil
+}
+
+func seekPos(offset int64, whence int, pos, size int64) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += pos
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("seek: invalid offset")
+	}
+	return offset, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// teeWriteSeeker writes to the output and to a patchWriter of the tee, which drops the writes to
+// already written regions, they are covered by the patches.
+type teeWriteSeeker struct {
+	io.WriteSeeker
+	tee *patchWriter
+}
+
+func (t *teeWriteSeeker) Write(p []byte) (int, error) {
+	n, err := t.WriteSeeker.Write(p)
+	if _, err := t.tee.Write(p[:n]); err != nil {
+		return n, err
+	}
+	return n, err
+}
+
+func (t *teeWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := t.WriteSeeker.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	return t.tee.Seek(pos, io.SeekStart)
+}
+
+// File returns the file of the output, for writing sparse files, see Writer.file.
+func (t *teeWriteSeeker) File() *os.File {
+	switch out := t.WriteSeeker.(type) {
+	case *os.File:
+		return out
+	case interface{ File() *os.File }:
+		return out.File()
+	}
+	return nil
+}
+
+func (t *teeWriteSeeker) Close() error {
+	if c, ok := t.WriteSeeker.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// Package encryption encrypts debug files at rest with AES-256-GCM.
+//
+// Files are encrypted in chunks, so files of any size are streamed in constant memory.
+// A file starts with the magic and a random salt, the key of the file is the HMAC-SHA256 of
+// the salt with the given key, so nonces never repeat across files encrypted with the same key.
+// The nonce of a chunk is its index and a flag marking the last chunk, so reordered, dropped
+// or truncated chunks fail to decrypt.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeySize is the size of the keys, 256 bits.
+const KeySize = 32
+
+const (
+	magic     = "split-debug.aes256-gcm.v1\n"
+	saltSize  = 32
+	chunkSize = 64 << 10
+)
+
+// ErrNotEncrypted is returned by NewReader for data that does not start with the magic of encrypted files.
+var ErrNotEncrypted = errors.New("not an encrypted file")
+
+// ErrDecrypt is returned for data that was not encrypted with the key, or was modified.
+var ErrDecrypt = errors.New("failed to decrypt: wrong key or corrupted data")
+
+// ParseKey parses a hex encoded 256-bit key, e.g. the output of openssl rand -hex 32.
+func ParseKey(data []byte) ([]byte, error) {
+	key, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key: %d bytes, must be %d", len(key), KeySize)
+	}
+	return key, nil
+}
+
+func newAEAD(key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(aead cipher.AEAD, index uint64, last bool) []byte {
+	n := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(n[len(n)-9:], index)
+	if last {
+		n[len(n)-1] = 1
+	}
+	return n
+}
+
+// Writer encrypts what is written to it, Close writes the last chunk.
+type Writer struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+}
+
+// NewWriter returns a writer that encrypts to w with the key.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, magic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, aead: aead, buf: make([]byte, 0, chunkSize+aead.Overhead())}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, the last chunk is sealed by Close.
+		if len(w.buf) == chunkSize {
+			if err := w.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close encrypts the last chunk, it does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.seal(true)
+}
+
+func (w *Writer) seal(last bool) error {
+	out := w.aead.Seal(w.buf[:0], nonce(w.aead, w.index, last), w.buf, nil)
+	if _, err := w.w.Write(out); err != nil {
+		return err
+	}
+	w.index++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Reader decrypts the data of a Writer.
+type Reader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	chunk []byte
+	buf   []byte
+	plain []byte
+	index uint64
+	done  bool
+}
+
+// NewReader returns a reader that decrypts r with the key.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	header := make([]byte, len(magic)+saltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrNotEncrypted
+		}
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrNotEncrypted
+	}
+	aead, err := newAEAD(key, header[len(magic):])
+	if err != nil {
+		return nil, err
+	}
+	// One byte more than a sealed chunk tells whether another chunk follows.
+	return &Reader{
+		r:     r,
+		aead:  aead,
+		chunk: make([]byte, chunkSize+aead.Overhead()+1),
+		buf:   make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *Reader) open() error {
+	sealed := chunkSize + r.aead.Overhead()
+	// The byte read ahead of the previous chunk starts this one.
+	pending := 0
+	if r.index > 0 {
+		pending = 1
+	}
+	n, err := io.ReadFull(r.r, r.chunk[pending:])
+	n += pending
+	last := false
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		last = true
+	case err != nil:
+		return err
+	}
+	size := n
+	if !last {
+		size = sealed
+	}
+	if size < r.aead.Overhead() {
+		return ErrDecrypt
+	}
+
+	plain, err := r.aead.Open(r.buf[:0], nonce(r.aead, r.index, last), r.chunk[:size], nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+	r.plain = plain
+	r.index++
+	r.done = last
+	if !last {
+		r.chunk[0] = r.chunk[sealed]
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package encryption
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	key, err := ParseKey([]byte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f\n"))
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		data := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(data)
+
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, key)
+		require.NoError(t, err)
+		// Odd write sizes cross the chunk boundaries.
+		for p := data; len(p) > 0; {
+			n := 1000
+			if n > len(p) {
+				n = len(p)
+			}
+			_, err := w.Write(p[:n])
+			require.NoError(t, err)
+			p = p[n:]
+		}
+		require.NoError(t, w.Close())
+		encrypted := buf.Bytes()
+
+		r, err := NewReader(bytes.NewReader(encrypted), key)
+		require.NoError(t, err)
+		got, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, data, got, "size %d", size)
+
+		if size > chunkSize {
+			// Dropping the last chunk makes the previous one the last, which was not sealed as such.
+			r, err := NewReader(bytes.NewReader(encrypted[:len(magic)+saltSize+chunkSize+16]), key)
+			require.NoError(t, err)
+			_, err = ioutil.ReadAll(r)
+			require.ErrorIs(t, err, ErrDecrypt)
+		}
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, key)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("debug file"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), bytes.Repeat([]byte{2}, KeySize))
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = NewReader(bytes.NewReader([]byte("\x7fELF")), key)
+	require.ErrorIs(t, err, ErrNotEncrypted)
+
+	_, err = ParseKey([]byte("abcd"))
+	require.EqualError(t, err, "invalid key: 2 bytes, must be 32")
+}
@@ -0,0 +1,110 @@
+package funcmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// The flat binary encoding of a function map is little-endian:
+//
+//	magic     [4]byte  "FMAP"
+//	version   uint32   1
+//	count     uint32   number of functions
+//	strsize   uint32   size of the string table
+//	functions [count]struct {
+//		start  uint64
+//		end    uint64
+//		name   uint32  offset of the name in the string table
+//		length uint16  length of the name
+//		source uint16  see Source
+//	}
+//	strings   [strsize]byte
+//
+// The functions are sorted by address and do not overlap, so they can be searched in place.
+const (
+	magic         = "FMAP"
+	binaryVersion = 1
+	headerSize    = 16
+	entrySize     = 24
+	maxNameLength = 1<<16 - 1
+)
+
+// WriteBinary writes the function map in the flat binary encoding. Names longer than 64KiB are
+// truncated.
+func WriteBinary(w io.Writer, fns []Function) error {
+	var strtab bytes.Buffer
+	offsets := make(map[string]uint32)
+	entries := make([]byte, entrySize*len(fns))
+	for i, fn := range fns {
+		name := fn.Name
+		if len(name) > maxNameLength {
+			name = name[:maxNameLength]
+		}
+		off, ok := offsets[name]
+		if !ok {
+			off = uint32(strtab.Len())
+			offsets[name] = off
+			strtab.WriteString(name)
+		}
+		e := entries[i*entrySize:]
+		binary.LittleEndian.PutUint64(e[0:], fn.Start)
+		binary.LittleEndian.PutUint64(e[8:], fn.End)
+		binary.LittleEndian.PutUint32(e[16:], off)
+		binary.LittleEndian.PutUint16(e[20:], uint16(len(name)))
+		binary.LittleEndian.PutUint16(e[22:], uint16(fn.Source))
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.LittleEndian.PutUint32(header[4:], binaryVersion)
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(fns)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(strtab.Len()))
+	for _, b := range [][]byte{header, entries, strtab.Bytes()} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBinary reads a function map in the flat binary encoding.
+func ReadBinary(r io.Reader) ([]Function, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerSize || string(data[:4]) != magic {
+		return nil, errors.New("not a function map")
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != binaryVersion {
+		return nil, fmt.Errorf("unsupported function map version %d", v)
+	}
+	count := uint64(binary.LittleEndian.Uint32(data[8:]))
+	strsize := uint64(binary.LittleEndian.Uint32(data[12:]))
+	if headerSize+count*entrySize+strsize != uint64(len(data)) {
+		return nil, errors.New("truncated function map")
+	}
+	entries := data[headerSize : headerSize+count*entrySize]
+	strtab := data[headerSize+count*entrySize:]
+
+	fns := make([]Function, count)
+	for i := range fns {
+		e := entries[i*entrySize:]
+		off := uint64(binary.LittleEndian.Uint32(e[16:]))
+		length := uint64(binary.LittleEndian.Uint16(e[20:]))
+		if off+length > strsize {
+			return nil, fmt.Errorf("invalid name of function %d", i)
+		}
+		fns[i] = Function{
+			Start:  binary.LittleEndian.Uint64(e[0:]),
+			End:    binary.LittleEndian.Uint64(e[8:]),
+			Name:   string(strtab[off : off+length]),
+			Source: Source(binary.LittleEndian.Uint16(e[22:])),
+		}
+	}
+	return fns, nil
+}
@@ -0,0 +1,183 @@
+// Package funcmap builds the function map of an object file: the address range and name of each
+// of its functions, sorted by address and without overlaps, so profilers resolve addresses to
+// functions with a binary search instead of parsing the ELF file at runtime.
+//
+// Functions are taken from, in order of preference, the ELF symbol tables, the Go symbol table
+// (.gopclntab), the PLT stubs and the FDEs of .eh_frame, which still cover the functions of
+// stripped binaries, although without a name. The addresses are the ones of the object file, the
+// load bias of position-independent executables and shared libraries is not applied.
+package funcmap
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/polarsignals/split-debug/pkg/symbolize"
+	"github.com/polarsignals/split-debug/pkg/unwind"
+)
+
+// Source is where a function was found.
+type Source uint16
+
+// Sources of the functions, in order of preference.
+const (
+	SourceSymtab Source = iota + 1
+	SourceDynsym
+	SourcePclntab
+	SourcePLT
+	SourceEHFrame
+)
+
+var sourceNames = map[Source]string{
+	SourceSymtab:  "symtab",
+	SourceDynsym:  "dynsym",
+	SourcePclntab: "pclntab",
+	SourcePLT:     "plt",
+	SourceEHFrame: "eh_frame",
+}
+
+func (s Source) String() string {
+	if name, ok := sourceNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Source(%d)", uint16(s))
+}
+
+// MarshalText encodes the source by its name.
+func (s Source) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes the source from its name.
+func (s *Source) UnmarshalText(text []byte) error {
+	for src, name := range sourceNames {
+		if name == string(text) {
+			*s = src
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown function source %q", text)
+}
+
+// Function is the address range [Start, End) of a function.
+type Function struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+	// Name is the symbol name, e.g. puts@plt for PLT stubs and [.plt] for the parts of the PLT
+	// sections that are not stubs. Functions only known from their FDE have no name.
+	Name   string `json:"name"`
+	Source Source `json:"source"`
+}
+
+// Build returns the function map of the given ELF file, sorted by address. It fails if the file
+// has none of the sources of functions.
+func Build(f *elf.File) ([]Function, error) {
+	var m []Function
+	add := func(fns []Function) {
+		m = merge(m, fns)
+	}
+
+	syms, err := f.Symbols()
+	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		return nil, fmt.Errorf("failed to read symbols: %w", err)
+	}
+	add(symbolFunctions(syms, SourceSymtab))
+	dynsyms, err := f.DynamicSymbols()
+	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		return nil, fmt.Errorf("failed to read dynamic symbols: %w", err)
+	}
+	add(symbolFunctions(dynsyms, SourceDynsym))
+
+	if tab, err := symbolize.GoSymbolTable(f); err == nil {
+		fns := make([]Function, 0, len(tab.Funcs))
+		for _, fn := range tab.Funcs {
+			if fn.End > fn.Entry {
+				fns = append(fns, Function{Start: fn.Entry, End: fn.End, Name: fn.Name, Source: SourcePclntab})
+			}
+		}
+		add(fns)
+	}
+
+	plt, err := pltFunctions(f, dynsyms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PLT: %w", err)
+	}
+	add(plt)
+
+	fdes, err := unwind.FDEs(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .eh_frame: %w", err)
+	}
+	fns := make([]Function, 0, len(fdes))
+	for _, fde := range fdes {
+		fns = append(fns, Function{Start: fde.Start, End: fde.End, Source: SourceEHFrame})
+	}
+	add(fns)
+
+	if len(m) == 0 {
+		return nil, errors.New("no functions found")
+	}
+	return m, nil
+}
+
+// symbolFunctions returns the functions of the symbols that have a size. Global symbols are
+// preferred over the weak and local aliases of the same address.
+func symbolFunctions(syms []elf.Symbol, src Source) []Function {
+	sorted := make([]elf.Symbol, 0, len(syms))
+	for _, s := range syms {
+		typ := elf.ST_TYPE(s.Info)
+		if (typ == elf.STT_FUNC || typ == elf.STT_GNU_IFUNC) && s.Section != elf.SHN_UNDEF && s.Size > 0 && s.Name != "" {
+			sorted = append(sorted, s)
+		}
+	}
+	rank := func(s elf.Symbol) int {
+		switch elf.ST_BIND(s.Info) {
+		case elf.STB_GLOBAL:
+			return 0
+		case elf.STB_WEAK:
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Value != sorted[j].Value {
+			return sorted[i].Value < sorted[j].Value
+		}
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+
+	fns := make([]Function, 0, len(sorted))
+	for _, s := range sorted {
+		fns = append(fns, Function{Start: s.Value, End: s.Value + s.Size, Name: s.Name, Source: src})
+	}
+	return fns
+}
+
+// merge adds the functions that do not overlap the ones of m, which is sorted by address, and
+// returns the result sorted by address. Of the functions that overlap each other, the first one
+// is added.
+func merge(m, fns []Function) []Function {
+	sort.SliceStable(fns, func(i, j int) bool { return fns[i].Start < fns[j].Start })
+	var added []Function
+	for _, fn := range fns {
+		if fn.End <= fn.Start {
+			continue
+		}
+		if n := len(added); n > 0 && fn.Start < added[n-1].End {
+			continue
+		}
+		i := sort.Search(len(m), func(i int) bool { return m[i].End > fn.Start })
+		if i < len(m) && m[i].Start < fn.End {
+			continue
+		}
+		added = append(added, fn)
+	}
+	if len(added) == 0 {
+		return m
+	}
+	m = append(m, added...)
+	sort.SliceStable(m, func(i, j int) bool { return m[i].Start < m[j].Start })
+	return m
+}
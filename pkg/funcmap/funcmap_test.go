@@ -0,0 +1,166 @@
+package funcmap
+
+import (
+	"bytes"
+	"debug/elf"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBinary = "../../dist/split-debug"
+
+const testProgram = `
+#include <stdio.h>
+int work(int x) { puts("work"); return x * 3; }
+int main(int argc, char **argv) { printf("%d\n", work(argc)); return 0; }
+`
+
+// open opens the ELF file at path until the test ends.
+func open(t *testing.T, path string) *elf.File {
+	t.Helper()
+	f, err := elf.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func find(fns []Function, name string) *Function {
+	for i := range fns {
+		if fns[i].Name == name {
+			return &fns[i]
+		}
+	}
+	return nil
+}
+
+func requireSorted(t *testing.T, fns []Function) {
+	t.Helper()
+	for i, fn := range fns {
+		require.Less(t, fn.Start, fn.End, fn.Name)
+		if i > 0 {
+			require.LessOrEqual(t, fns[i-1].End, fn.Start, fn.Name)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	f := open(t, elfwritertest.BuildC(t, testProgram, "-O1"))
+	fns, err := Build(f)
+	require.NoError(t, err)
+	requireSorted(t, fns)
+
+	syms, err := f.Symbols()
+	require.NoError(t, err)
+	for _, name := range []string{"main", "work"} {
+		fn := find(fns, name)
+		require.NotNil(t, fn, name)
+		require.Equal(t, SourceSymtab, fn.Source)
+		for _, s := range syms {
+			if s.Name == name {
+				require.Equal(t, s.Value, fn.Start)
+				require.Equal(t, s.Value+s.Size, fn.End)
+			}
+		}
+	}
+
+	// The stubs of the functions of the C library.
+	if f.Machine == elf.EM_X86_64 || f.Machine == elf.EM_AARCH64 {
+		fn := find(fns, "puts@plt")
+		require.NotNil(t, fn)
+		require.Equal(t, SourcePLT, fn.Source)
+		require.Equal(t, uint64(pltEntrySize), fn.End-fn.Start)
+	}
+}
+
+func TestBuild_Stripped(t *testing.T) {
+	full, err := Build(open(t, elfwritertest.BuildC(t, testProgram, "-O1")))
+	require.NoError(t, err)
+	fns, err := Build(open(t, elfwritertest.BuildC(t, testProgram, "-O1", "-s")))
+	require.NoError(t, err)
+	requireSorted(t, fns)
+
+	// The FDEs cover the functions of the symbol table, although without their names.
+	main := find(full, "main")
+	require.NotNil(t, main)
+	var found bool
+	for _, fn := range fns {
+		if fn.Start == main.Start {
+			require.Equal(t, SourceEHFrame, fn.Source)
+			require.Empty(t, fn.Name)
+			require.Equal(t, main.End, fn.End)
+			found = true
+		}
+	}
+	require.True(t, found)
+}
+
+func TestBuild_Go(t *testing.T) {
+	f, err := elf.Open(testBinary)
+	require.NoError(t, err)
+	defer f.Close()
+
+	fns, err := Build(f)
+	require.NoError(t, err)
+	requireSorted(t, fns)
+	fn := find(fns, "main.main")
+	require.NotNil(t, fn)
+	require.Equal(t, SourceSymtab, fn.Source)
+}
+
+func TestMerge(t *testing.T) {
+	m := merge(nil, []Function{
+		{Start: 0x20, End: 0x30, Name: "b", Source: SourceSymtab},
+		{Start: 0x10, End: 0x20, Name: "a", Source: SourceSymtab},
+		{Start: 0x10, End: 0x18, Name: "a_alias", Source: SourceSymtab},
+	})
+	m = merge(m, []Function{
+		{Start: 0x00, End: 0x10, Source: SourceEHFrame},
+		{Start: 0x18, End: 0x28, Source: SourceEHFrame},
+		{Start: 0x30, End: 0x30, Source: SourceEHFrame},
+		{Start: 0x30, End: 0x40, Source: SourceEHFrame},
+	})
+	require.Equal(t, []Function{
+		{Start: 0x00, End: 0x10, Source: SourceEHFrame},
+		{Start: 0x10, End: 0x20, Name: "a", Source: SourceSymtab},
+		{Start: 0x20, End: 0x30, Name: "b", Source: SourceSymtab},
+		{Start: 0x30, End: 0x40, Source: SourceEHFrame},
+	}, m)
+}
+
+func TestBinary(t *testing.T) {
+	fns := []Function{
+		{Start: 0x1000, End: 0x1010, Name: "[.plt]", Source: SourcePLT},
+		{Start: 0x1010, End: 0x1020, Name: "puts@plt", Source: SourcePLT},
+		{Start: 0x1100, End: 0x1180, Name: "main", Source: SourceSymtab},
+		{Start: 0x1180, End: 0x1190, Source: SourceEHFrame},
+		{Start: 0x1190, End: 0x11a0, Name: "main", Source: SourceDynsym},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, WriteBinary(&buf, fns))
+	// The header, the entries and the names, which are not repeated.
+	require.Equal(t, headerSize+len(fns)*entrySize+len("[.plt]puts@pltmain"), buf.Len())
+
+	got, err := ReadBinary(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, fns, got)
+
+	_, err = ReadBinary(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	require.Error(t, err)
+	_, err = ReadBinary(bytes.NewReader([]byte("not a function map")))
+	require.Error(t, err)
+}
+
+func TestSource(t *testing.T) {
+	for src := range sourceNames {
+		text, err := src.MarshalText()
+		require.NoError(t, err)
+		var got Source
+		require.NoError(t, got.UnmarshalText(text))
+		require.Equal(t, src, got)
+	}
+	var s Source
+	require.Error(t, s.UnmarshalText([]byte("nope")))
+}
@@ -0,0 +1,118 @@
+package funcmap
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+// pltSections are the sections of PLT stubs: .plt.sec holds the stubs of binaries built with
+// -fcf-protection, .plt.got the ones of functions bound at load time, and .iplt the ones of the
+// IFUNCs of static binaries.
+var pltSections = []string{".plt", ".plt.sec", ".plt.got", ".iplt"}
+
+// pltEntrySize is the size of the stubs of .plt and .plt.sec on the supported machines.
+const pltEntrySize = 16
+
+// pltFunctions returns the stubs of the PLT sections, named after the function they jump to with
+// an @plt suffix as objdump does. The stubs of .plt and .plt.sec are named on x86, x86-64 and
+// AArch64 only, the rest of the sections is covered by a function named after the section.
+func pltFunctions(f *elf.File, dynsyms []elf.Symbol) ([]Function, error) {
+	header, slot := pltLayout(f.Machine)
+	var names []string
+	if header > 0 {
+		var err error
+		if names, err = jumpSlots(f, slot, dynsyms); err != nil {
+			return nil, err
+		}
+	}
+
+	var fns []Function
+	for _, name := range pltSections {
+		s := f.Section(name)
+		if s == nil || s.Type == elf.SHT_NOBITS || s.Size == 0 {
+			continue
+		}
+		start, end := s.Addr, s.Addr+s.Size
+		if len(names) > 0 && (name == ".plt" || name == ".plt.sec") {
+			if name == ".plt" {
+				// The header of .plt calls the dynamic linker to bind the functions lazily.
+				fns = append(fns, Function{Start: start, End: start + header, Name: "[" + name + "]", Source: SourcePLT})
+				start += header
+			}
+			for _, sym := range names {
+				if start+pltEntrySize > end {
+					break
+				}
+				fns = append(fns, Function{Start: start, End: start + pltEntrySize, Name: sym + "@plt", Source: SourcePLT})
+				start += pltEntrySize
+			}
+		}
+		if start < end {
+			fns = append(fns, Function{Start: start, End: end, Name: "[" + name + "]", Source: SourcePLT})
+		}
+	}
+	return fns, nil
+}
+
+// pltLayout returns the size of the header of .plt and the type of the relocations of the jump
+// slots for the machine, or a zero header size if the layout of its PLT is not known.
+func pltLayout(m elf.Machine) (uint64, uint32) {
+	switch m {
+	case elf.EM_X86_64:
+		return 16, uint32(elf.R_X86_64_JMP_SLOT)
+	case elf.EM_386:
+		return 16, uint32(elf.R_386_JMP_SLOT)
+	case elf.EM_AARCH64:
+		return 32, uint32(elf.R_AARCH64_JUMP_SLOT)
+	}
+	return 0, 0
+}
+
+// jumpSlots returns the names of the symbols of the jump slot relocations of .rela.plt or
+// .rel.plt, in the order of their stubs.
+func jumpSlots(f *elf.File, slot uint32, dynsyms []elf.Symbol) ([]string, error) {
+	s := f.Section(".rela.plt")
+	if s == nil {
+		s = f.Section(".rel.plt")
+	}
+	if s == nil || s.Type == elf.SHT_NOBITS {
+		return nil, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.Name, err)
+	}
+
+	var size int
+	switch {
+	case f.Class == elf.ELFCLASS64 && s.Type == elf.SHT_RELA:
+		size = 24
+	case f.Class == elf.ELFCLASS64:
+		size = 16
+	case s.Type == elf.SHT_RELA:
+		size = 12
+	default:
+		size = 8
+	}
+
+	var names []string
+	for ; len(data) >= size; data = data[size:] {
+		var sym, typ uint32
+		if f.Class == elf.ELFCLASS64 {
+			info := f.ByteOrder.Uint64(data[8:16])
+			sym, typ = elf.R_SYM64(info), elf.R_TYPE64(info)
+		} else {
+			info := f.ByteOrder.Uint32(data[4:8])
+			sym, typ = elf.R_SYM32(info), elf.R_TYPE32(info)
+		}
+		if typ != slot {
+			continue
+		}
+		// The dynamic symbols do not include the null symbol at index 0.
+		if sym == 0 || int(sym) > len(dynsyms) {
+			return nil, fmt.Errorf("invalid symbol index %d in %s", sym, s.Name)
+		}
+		names = append(names, dynsyms[sym-1].Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,443 @@
+// Package gdbindex builds .gdb_index sections, the symbol index GDB reads
+// instead of scanning all of the DWARF at startup, like gdb-add-index does.
+//
+// The format is documented at https://sourceware.org/gdb/onlinedocs/gdb/Index-Section-Format.html,
+// the index is always little-endian. Type units are not indexed.
+package gdbindex
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// SectionName is the name of the section the index is stored in.
+const SectionName = ".gdb_index"
+
+// version of the index format that is written.
+const version = 7
+
+// ErrNoDebugInfo is returned when the file has no .debug_info section to index.
+var ErrNoDebugInfo = errors.New("no .debug_info section")
+
+// Symbol kinds of the CU vector entries.
+const (
+	kindType     = 1
+	kindVariable = 2
+	kindFunction = 3
+	kindOther    = 4
+)
+
+// unit is a compilation unit in .debug_info.
+type unit struct {
+	off, length uint64
+}
+
+// symbol is a CU vector entry: the CU index with the symbol kind and whether it is static.
+type symbol uint32
+
+func newSymbol(cu int, kind uint32, static bool) symbol {
+	s := uint32(cu)&0xffffff | kind<<28
+	if static {
+		s |= 1 << 31
+	}
+	return symbol(s)
+}
+
+// index collects the contents of the index.
+type index struct {
+	units   []unit
+	ranges  []addrRange
+	symbols map[string][]symbol
+}
+
+type addrRange struct {
+	low, high uint64
+	cu        uint32
+}
+
+// Build returns the contents of the .gdb_index section for the DWARF of f.
+func Build(f *elf.File) ([]byte, error) {
+	info := f.Section(".debug_info")
+	if info == nil {
+		return nil, ErrNoDebugInfo
+	}
+	data, err := f.DWARF()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DWARF: %w", err)
+	}
+	return BuildDWARF(data, info.Open(), f.ByteOrder)
+}
+
+// BuildDWARF returns the contents of the .gdb_index section for the DWARF data,
+// info holds the contents of its .debug_info section. It is used for DWARF that
+// is not read from a file, e.g. after it has been rewritten.
+func BuildDWARF(data *dwarf.Data, info io.ReadSeeker, bo binary.ByteOrder) ([]byte, error) {
+	units, err := readUnits(info, bo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read units: %w", err)
+	}
+
+	idx := &index{symbols: map[string][]symbol{}}
+	if err := idx.add(data, units); err != nil {
+		return nil, err
+	}
+	return idx.encode(), nil
+}
+
+// readUnits reads the offsets and lengths of the units from their headers.
+func readUnits(r io.ReadSeeker, bo binary.ByteOrder) ([]unit, error) {
+	var units []unit
+	var off uint64
+	for {
+		var b [4]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return units, nil
+			}
+			return nil, err
+		}
+		// The unit length excludes itself.
+		length, header := uint64(bo.Uint32(b[:])), uint64(4)
+		if length == 0xffffffff {
+			var b [8]byte
+			if _, err := io.ReadFull(r, b[:]); err != nil {
+				return nil, err
+			}
+			length, header = bo.Uint64(b[:]), 12
+		}
+		units = append(units, unit{off: off, length: header + length})
+		off += header + length
+		if _, err := r.Seek(int64(off), io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// add indexes the address ranges and the symbols of the compilation units.
+func (idx *index) add(data *dwarf.Data, units []unit) error {
+	cu := -1
+	// scopes are the names the children of the enclosing DIEs are qualified with,
+	// e.g. C++ namespaces. Compilation units have empty names.
+	var scopes []string
+	static := false
+	// declared are the functions and variables by offset, the concrete DIEs of out-of-line C++
+	// members and of optimized code take their names from them, after all units are read.
+	declared := map[dwarf.Offset]declaration{}
+	var concrete []concreteEntry
+	r := data.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read DWARF entries: %w", err)
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			// End of the children of the innermost scope.
+			if len(scopes) > 0 {
+				scopes = scopes[:len(scopes)-1]
+			}
+			continue
+		}
+
+		switch e.Tag {
+		case dwarf.TagCompileUnit, dwarf.TagPartialUnit:
+			i := unitOf(units, e.Offset)
+			if i < 0 {
+				return fmt.Errorf("compilation unit at %#x is not in .debug_info", e.Offset)
+			}
+			// Only compilation units are listed, type units in .debug_info are left out.
+			idx.units = append(idx.units, units[i])
+			cu = len(idx.units) - 1
+			scopes = scopes[:0]
+			lang, _ := e.Val(dwarf.AttrLanguage).(int64)
+			// Types of C++ are global, C and most other languages have static types.
+			static = !isCPlusPlus(lang)
+			ranges, err := data.Ranges(e)
+			if err != nil {
+				return fmt.Errorf("failed to read ranges of compilation unit at %#x: %w", e.Offset, err)
+			}
+			for _, rng := range ranges {
+				if rng[0] < rng[1] {
+					idx.ranges = append(idx.ranges, addrRange{low: rng[0], high: rng[1], cu: uint32(cu)})
+				}
+			}
+			if e.Children {
+				scopes = append(scopes, "")
+			}
+			continue
+		case dwarf.TagTypeUnit:
+			// Type units are not indexed.
+			cu = -1
+			if e.Children {
+				r.SkipChildren()
+			}
+			continue
+		}
+		if cu < 0 {
+			if e.Children {
+				r.SkipChildren()
+			}
+			continue
+		}
+
+		name, _ := e.Val(dwarf.AttrName).(string)
+		qualified := qualify(scopes, name)
+		external, _ := e.Val(dwarf.AttrExternal).(bool)
+		if e.Tag == dwarf.TagSubprogram || e.Tag == dwarf.TagVariable {
+			ref := origin(e)
+			declared[e.Offset] = declaration{name: qualified, external: external, ref: ref}
+			if name == "" && ref != 0 {
+				concrete = append(concrete, concreteEntry{entry: e, cu: cu, static: static})
+			}
+		}
+		idx.addSymbol(e, qualified, external, cu, static)
+
+		if !e.Children {
+			continue
+		}
+		switch e.Tag {
+		case dwarf.TagNamespace, dwarf.TagStructType, dwarf.TagClassType, dwarf.TagUnionType, dwarf.TagEnumerationType:
+			scopes = append(scopes, qualified)
+		default:
+			// Local symbols of functions and blocks are not indexed.
+			r.SkipChildren()
+		}
+	}
+	for _, c := range concrete {
+		name, external := resolve(declared, c.entry.Offset)
+		idx.addSymbol(c.entry, name, external, c.cu, c.static)
+	}
+	return nil
+}
+
+// maxRefs bounds the chains of DW_AT_specification and DW_AT_abstract_origin references followed,
+// e.g. the concrete DIE of an inlined member refers to its abstract DIE, which refers to the
+// declaration in the class.
+const maxRefs = 8
+
+// declaration is the qualified name of a function or variable DIE and the DIE it refers to.
+type declaration struct {
+	name     string
+	external bool
+	ref      dwarf.Offset
+}
+
+// concreteEntry is a DIE without a name of its own, indexed once the DIE it refers to is read.
+type concreteEntry struct {
+	entry  *dwarf.Entry
+	cu     int
+	static bool
+}
+
+// origin returns the offset of the DIE the entry completes, or 0: the declaration of a C++ member
+// defined out of line, or the abstract instance of an inlined or optimized function.
+func origin(e *dwarf.Entry) dwarf.Offset {
+	if off, ok := e.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+		return off
+	}
+	off, _ := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+	return off
+}
+
+// resolve returns the qualified name of the DIE at off, following its references, and whether any
+// DIE of the chain is external: the declarations carry DW_AT_external, not the definitions.
+func resolve(declared map[dwarf.Offset]declaration, off dwarf.Offset) (string, bool) {
+	var external bool
+	for i := 0; i < maxRefs; i++ {
+		d, ok := declared[off]
+		if !ok {
+			return "", false
+		}
+		external = external || d.external
+		if d.name != "" || d.ref == 0 {
+			return d.name, external
+		}
+		off = d.ref
+	}
+	return "", false
+}
+
+// addSymbol adds the entry to the symbol table if it is a global symbol.
+func (idx *index) addSymbol(e *dwarf.Entry, name string, external bool, cu int, staticTypes bool) {
+	if name == "" {
+		return
+	}
+	if declaration, _ := e.Val(dwarf.AttrDeclaration).(bool); declaration {
+		return
+	}
+
+	var sym symbol
+	switch e.Tag {
+	case dwarf.TagSubprogram:
+		if e.Val(dwarf.AttrLowpc) == nil && e.Val(dwarf.AttrRanges) == nil {
+			return
+		}
+		sym = newSymbol(cu, kindFunction, !external)
+	case dwarf.TagVariable:
+		if e.Val(dwarf.AttrLocation) == nil && e.Val(dwarf.AttrConstValue) == nil {
+			return
+		}
+		sym = newSymbol(cu, kindVariable, !external)
+	case dwarf.TagEnumerator:
+		sym = newSymbol(cu, kindVariable, staticTypes)
+	case dwarf.TagBaseType, dwarf.TagTypedef, dwarf.TagStructType, dwarf.TagClassType,
+		dwarf.TagUnionType, dwarf.TagEnumerationType, dwarf.TagSubrangeType:
+		sym = newSymbol(cu, kindType, staticTypes)
+	case dwarf.TagNamespace:
+		sym = newSymbol(cu, kindType, false)
+	case dwarf.TagConstant:
+		sym = newSymbol(cu, kindOther, !external)
+	default:
+		return
+	}
+
+	for _, s := range idx.symbols[name] {
+		if s == sym {
+			return
+		}
+	}
+	idx.symbols[name] = append(idx.symbols[name], sym)
+}
+
+// qualify prefixes name with the names of the enclosing scopes, e.g. "ns::name".
+func qualify(scopes []string, name string) string {
+	if name == "" {
+		return ""
+	}
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if scopes[i] != "" {
+			return scopes[i] + "::" + name
+		}
+	}
+	return name
+}
+
+// unitOf returns the index of the unit that contains the given offset, or -1.
+func unitOf(units []unit, off dwarf.Offset) int {
+	i := sort.Search(len(units), func(i int) bool {
+		return units[i].off > uint64(off)
+	}) - 1
+	if i < 0 || uint64(off) >= units[i].off+units[i].length {
+		return -1
+	}
+	return i
+}
+
+func isCPlusPlus(lang int64) bool {
+	switch lang {
+	case 0x04, 0x19, 0x1a, 0x21: // DW_LANG_C_plus_plus, _03, _11, _14
+		return true
+	}
+	return false
+}
+
+// encode lays out the index: the header, the CU list, the (empty) TU list,
+// the address area, the symbol table and the constant pool.
+func (idx *index) encode() []byte {
+	names := make([]string, 0, len(idx.symbols))
+	for name := range idx.symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// The constant pool holds the CU vectors followed by the names.
+	var pool bytes.Buffer
+	vectors := make(map[string]uint32, len(names))
+	for _, name := range names {
+		vectors[name] = uint32(pool.Len())
+		syms := idx.symbols[name]
+		writeU32(&pool, uint32(len(syms)))
+		for _, s := range syms {
+			writeU32(&pool, uint32(s))
+		}
+	}
+	nameOffsets := make(map[string]uint32, len(names))
+	for _, name := range names {
+		nameOffsets[name] = uint32(pool.Len())
+		pool.WriteString(name)
+		pool.WriteByte(0)
+	}
+
+	// The symbol table is an open addressing hash table with a power of two size.
+	size := uint32(1)
+	for size*3 < uint32(len(names))*4 {
+		size <<= 1
+	}
+	if size < 2 {
+		size = 2
+	}
+	slots := make([][2]uint32, size)
+	used := make([]bool, size)
+	for _, name := range names {
+		h := hash(name)
+		i := h & (size - 1)
+		step := ((h * 17) & (size - 1)) | 1
+		for used[i] {
+			i = (i + step) & (size - 1)
+		}
+		used[i] = true
+		slots[i] = [2]uint32{nameOffsets[name], vectors[name]}
+	}
+
+	const headerSize = 6 * 4
+	cuListOff := uint32(headerSize)
+	tuListOff := cuListOff + uint32(len(idx.units))*16
+	addrOff := tuListOff
+	symtabOff := addrOff + uint32(len(idx.ranges))*20
+	poolOff := symtabOff + size*8
+
+	var buf bytes.Buffer
+	buf.Grow(int(poolOff) + pool.Len())
+	for _, v := range []uint32{version, cuListOff, tuListOff, addrOff, symtabOff, poolOff} {
+		writeU32(&buf, v)
+	}
+	for _, u := range idx.units {
+		writeU64(&buf, u.off)
+		writeU64(&buf, u.length)
+	}
+	for _, r := range idx.ranges {
+		writeU64(&buf, r.low)
+		writeU64(&buf, r.high)
+		writeU32(&buf, r.cu)
+	}
+	for _, s := range slots {
+		writeU32(&buf, s[0])
+		writeU32(&buf, s[1])
+	}
+	buf.Write(pool.Bytes())
+	return buf.Bytes()
+}
+
+// hash is the symbol hash of GDB, mapped_index_string_hash of index versions 5 and later.
+func hash(s string) uint32 {
+	var r uint32
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		// tolower of the C locale.
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		r = r*67 + uint32(c) - 113
+	}
+	return r
+}
+
+func writeU32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeU64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
@@ -0,0 +1,124 @@
+package gdbindex
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+)
+
+// lookup finds the CU vector of name in the index like GDB does.
+func lookup(t *testing.T, index []byte, name string) []symbol {
+	t.Helper()
+	u32 := func(off uint32) uint32 {
+		return binary.LittleEndian.Uint32(index[off:])
+	}
+	require.Equal(t, uint32(version), u32(0))
+	symtabOff, poolOff := u32(16), u32(20)
+	size := (poolOff - symtabOff) / 8
+	require.NotZero(t, size)
+	require.Zero(t, size&(size-1), "symbol table size is not a power of two")
+
+	h := hash(name)
+	i := h & (size - 1)
+	step := ((h * 17) & (size - 1)) | 1
+	for {
+		slot := symtabOff + i*8
+		nameOff, vecOff := u32(slot), u32(slot+4)
+		if nameOff == 0 && vecOff == 0 {
+			return nil
+		}
+		str := index[poolOff+nameOff:]
+		if string(str[:bytes.IndexByte(str, 0)]) == name {
+			n := u32(poolOff + vecOff)
+			syms := make([]symbol, n)
+			for j := range syms {
+				syms[j] = symbol(u32(poolOff + vecOff + 4 + uint32(j)*4))
+			}
+			return syms
+		}
+		i = (i + step) & (size - 1)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   func(t *testing.T) string
+		symbol string
+		static bool
+	}{
+		{
+			name:   "go",
+			path:   func(t *testing.T) string { return "../../dist/split-debug" },
+			symbol: "main.main",
+		},
+		{
+			name:   "c",
+			path:   func(t *testing.T) string { return elfwritertest.BuildC(t, elfwritertest.HelloC, "-g", "-O0") },
+			symbol: "greet",
+			static: true,
+		},
+		{
+			// The definition refers to the declaration in the class with DW_AT_specification.
+			name: "c++ out of line member",
+			path: func(t *testing.T) string {
+				return elfwritertest.Build(t, "g++", map[string]string{"main.cc": "namespace ns {\nstruct Foo {\n  int bar(int);\n};\nint Foo::bar(int x) { return x + 1; }\n}\nint main() { ns::Foo f; return f.bar(1); }\n"}, "-g")
+			},
+			symbol: "ns::Foo::bar",
+		},
+		{
+			// The out-of-line copy of the inlined function refers to its abstract instance with
+			// DW_AT_abstract_origin.
+			name: "c optimized",
+			path: func(t *testing.T) string {
+				return elfwritertest.BuildC(t, "int add(int a, int b) { return a + b; }\nint main(int argc, char **argv) { return add(argc, 2); }\n", "-g", "-O1")
+			},
+			symbol: "add",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := elfutils.Open(tt.path(t))
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				f.Close()
+			})
+
+			index, err := Build(f)
+			require.NoError(t, err)
+
+			syms := lookup(t, index, tt.symbol)
+			require.Len(t, syms, 1)
+			require.Equal(t, uint32(kindFunction), uint32(syms[0])>>28&0x7)
+			require.Equal(t, tt.static, syms[0]&(1<<31) != 0)
+			require.Nil(t, lookup(t, index, "does.not.exist"))
+
+			// The CU of the symbol covers an address range.
+			cu := uint32(syms[0]) & 0xffffff
+			addrOff, symtabOff := binary.LittleEndian.Uint32(index[12:]), binary.LittleEndian.Uint32(index[16:])
+			var covered bool
+			for off := addrOff; off < symtabOff; off += 20 {
+				covered = covered || binary.LittleEndian.Uint32(index[off+16:]) == cu
+			}
+			require.True(t, covered)
+		})
+	}
+}
+
+func TestBuildNoDebugInfo(t *testing.T) {
+	f := &elf.File{}
+	_, err := Build(f)
+	require.ErrorIs(t, err, ErrNoDebugInfo)
+}
+
+func TestHash(t *testing.T) {
+	// Lookups are case insensitive.
+	require.Equal(t, hash("main"), hash("MAIN"))
+	require.NotEqual(t, hash("main"), hash("mian"))
+}
@@ -0,0 +1,119 @@
+// Package health serves the liveness and readiness probes of the long-running commands, e.g. to
+// the probes of Kubernetes.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Statuses of the responses.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check returns an error while the component it checks is not ready, e.g. the uploads fail.
+type Check func() error
+
+// Status is the JSON response of the probes.
+type Status struct {
+	Status string `json:"status"`
+	// Checks are the outcomes of the checks by name, ok or their error.
+	Checks map[string]string `json:"checks,omitempty"`
+	// Values are the values reported along with the checks, e.g. the depth of a queue.
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// Handler serves the probes:
+//
+//	GET /healthz  succeeds as long as the process serves it.
+//	GET /readyz   fails with 503 Service Unavailable while one of the checks fails.
+//
+// Both respond with a JSON Status, the one of /readyz has the outcomes of the checks and the values.
+type Handler struct {
+	mu     sync.Mutex
+	checks map[string]Check
+	values map[string]func() interface{}
+}
+
+// NewHandler returns a handler without checks, it is ready until checks are added.
+func NewHandler() *Handler {
+	return &Handler{
+		checks: make(map[string]Check),
+		values: make(map[string]func() interface{}),
+	}
+}
+
+// AddCheck adds a readiness check, replacing the one of the same name.
+func (h *Handler) AddCheck(name string, c Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = c
+}
+
+// AddValue adds a value the readiness probe reports, fn returns its current value.
+func (h *Handler) AddValue(name string, fn func() interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.values[name] = fn
+}
+
+// Ready runs the checks and returns the status of the readiness probe.
+func (h *Handler) Ready() Status {
+	h.mu.Lock()
+	checks := make(map[string]Check, len(h.checks))
+	for name, c := range h.checks {
+		checks[name] = c
+	}
+	values := make(map[string]func() interface{}, len(h.values))
+	for name, fn := range h.values {
+		values[name] = fn
+	}
+	h.mu.Unlock()
+
+	s := Status{Status: StatusOK}
+	for name, c := range checks {
+		if s.Checks == nil {
+			s.Checks = make(map[string]string, len(checks))
+		}
+		s.Checks[name] = StatusOK
+		if err := c(); err != nil {
+			s.Status = StatusUnavailable
+			s.Checks[name] = err.Error()
+		}
+	}
+	for name, fn := range values {
+		if s.Values == nil {
+			s.Values = make(map[string]interface{}, len(values))
+		}
+		s.Values[name] = fn()
+	}
+	return s
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case "/healthz":
+		writeStatus(w, Status{Status: StatusOK})
+	case "/readyz":
+		writeStatus(w, h.Ready())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeStatus(w http.ResponseWriter, s Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if s.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(s)
+}
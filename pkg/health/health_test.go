@@ -0,0 +1,56 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, h http.Handler, path string) (int, Status) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var s Status
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&s))
+	return rec.Code, s
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler()
+	code, s := get(t, h, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, Status{Status: StatusOK}, s)
+
+	var err error
+	h.AddCheck("uploader", func() error { return err })
+	h.AddValue("queue_depth", func() interface{} { return 3 })
+	code, s = get(t, h, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, Status{
+		Status: StatusOK,
+		Checks: map[string]string{"uploader": StatusOK},
+		Values: map[string]interface{}{"queue_depth": float64(3)},
+	}, s)
+
+	err = errors.New("uploads are paused")
+	code, s = get(t, h, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, StatusUnavailable, s.Status)
+	require.Equal(t, map[string]string{"uploader": "uploads are paused"}, s.Checks)
+
+	// Failing checks do not fail the liveness probe.
+	code, s = get(t, h, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, Status{Status: StatusOK}, s)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/readyz", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
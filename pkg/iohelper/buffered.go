@@ -0,0 +1,88 @@
+package iohelper
+
+import "io"
+
+// DefaultFlushSize is the flush size used when a non-positive size is given to Buffered.
+const DefaultFlushSize = 1 << 20 // 1MiB
+
+// BufferedWriterAt buffers contiguous writes to an underlying io.WriterAt and
+// writes them in chunks of the configured flush size. Small writes straight to
+// files on network file systems are slow, batching them avoids the round trips.
+//
+// Writes that do not continue the buffered range flush the buffer first,
+// so WriteAt semantics are preserved. Flush has to be called once done.
+type BufferedWriterAt struct {
+	w   io.WriterAt
+	buf []byte
+	off int64 // offset of buf[0] in w.
+}
+
+// Buffered returns a BufferedWriterAt that flushes to w once size bytes are buffered.
+func Buffered(w io.WriterAt, size int) *BufferedWriterAt {
+	if size <= 0 {
+		size = DefaultFlushSize
+	}
+	return &BufferedWriterAt{
+		w:   w,
+		buf: make([]byte, 0, size),
+	}
+}
+
+// WriteAt writes p at offset off.
+func (b *BufferedWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if len(b.buf) > 0 && off != b.off+int64(len(b.buf)) {
+		if err := b.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	if len(b.buf) == 0 {
+		b.off = off
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// Skip the buffer for writes that would fill it anyway.
+		if len(b.buf) == 0 && len(p) >= cap(b.buf) {
+			n, err := b.w.WriteAt(p, off+int64(written))
+			return written + n, err
+		}
+
+		n := copy(b.buf[len(b.buf):cap(b.buf)], p)
+		b.buf = b.buf[:len(b.buf)+n]
+		written += n
+		p = p[n:]
+
+		if len(b.buf) == cap(b.buf) {
+			if err := b.Flush(); err != nil {
+				return written, err
+			}
+			b.off = off + int64(written)
+		}
+	}
+	return written, nil
+}
+
+// Flush writes the buffered data to the underlying io.WriterAt.
+func (b *BufferedWriterAt) Flush() error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	n, err := b.w.WriteAt(b.buf, b.off)
+	if err == nil && n < len(b.buf) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		// Keep what could not be written for a retry.
+		b.buf = b.buf[:copy(b.buf, b.buf[n:])]
+		b.off += int64(n)
+		return err
+	}
+	b.off += int64(n)
+	b.buf = b.buf[:0]
+	return nil
+}
+
+// Buffered returns the number of bytes waiting to be flushed.
+func (b *BufferedWriterAt) Buffered() int {
+	return len(b.buf)
+}
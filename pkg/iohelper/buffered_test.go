@@ -0,0 +1,40 @@
+package iohelper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferedWriterAt(t *testing.T) {
+	w := &memWriterAt{}
+	b := Buffered(w, 4)
+
+	// Contiguous small writes are batched.
+	for i, s := range []string{"a", "b", "c"} {
+		_, err := b.WriteAt([]byte(s), int64(i))
+		require.NoError(t, err)
+	}
+	require.Equal(t, 0, w.writes)
+	require.Equal(t, 3, b.Buffered())
+
+	// Filling the buffer flushes it.
+	n, err := b.WriteAt([]byte("de"), 3)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, 1, w.writes)
+	require.Equal(t, "abcd", string(w.buf))
+	require.Equal(t, 1, b.Buffered())
+
+	// A non-contiguous write flushes what is pending first.
+	_, err = b.WriteAt([]byte("z"), 8)
+	require.NoError(t, err)
+	require.Equal(t, "abcde", string(w.buf))
+
+	// Writes at least as large as the buffer bypass it.
+	_, err = b.WriteAt([]byte("0123"), 10)
+	require.NoError(t, err)
+	require.NoError(t, b.Flush())
+	require.Equal(t, "abcde\x00\x00\x00z\x000123", string(w.buf))
+	require.Equal(t, 0, b.Buffered())
+}
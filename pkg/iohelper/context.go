@@ -0,0 +1,24 @@
+package iohelper
+
+import (
+	"context"
+	"io"
+)
+
+// ContextReader returns an io.Reader that fails with the error of ctx once it is done,
+// so long copies can be cancelled between reads.
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,24 @@
+package iohelper
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := ContextReader(ctx, bytes.NewReader([]byte("hello")))
+
+	buf := make([]byte, 2)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	cancel()
+	_, err = ioutil.ReadAll(r)
+	require.ErrorIs(t, err, context.Canceled)
+}
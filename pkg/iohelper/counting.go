@@ -0,0 +1,61 @@
+package iohelper
+
+import (
+	"io"
+
+	"go.uber.org/atomic"
+)
+
+// CountingWriter counts the bytes written to the underlying io.Writer.
+type CountingWriter struct {
+	w  io.Writer
+	n  atomic.Int64
+	fn func(total int64)
+}
+
+// NewCountingWriter returns a CountingWriter that writes to w.
+// If fn is not nil, it is called with the total number of bytes written after every write.
+func NewCountingWriter(w io.Writer, fn func(total int64)) *CountingWriter {
+	return &CountingWriter{w: w, fn: fn}
+}
+
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	total := c.n.Add(int64(n))
+	if c.fn != nil {
+		c.fn(total)
+	}
+	return n, err
+}
+
+// Count returns the number of bytes written so far. It is safe to call concurrently with Write.
+func (c *CountingWriter) Count() int64 {
+	return c.n.Load()
+}
+
+// CountingReader counts the bytes read from the underlying io.Reader.
+type CountingReader struct {
+	r  io.Reader
+	n  atomic.Int64
+	fn func(total int64)
+}
+
+// NewCountingReader returns a CountingReader that reads from r.
+// If fn is not nil, it is called with the total number of bytes read after every read.
+func NewCountingReader(r io.Reader, fn func(total int64)) *CountingReader {
+	return &CountingReader{r: r, fn: fn}
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	total := c.n.Add(int64(n))
+	if c.fn != nil && n > 0 {
+		c.fn(total)
+	}
+	return n, err
+}
+
+// Count returns the number of bytes read so far. It is safe to call concurrently with Read.
+func (c *CountingReader) Count() int64 {
+	return c.n.Load()
+}
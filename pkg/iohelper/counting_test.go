@@ -0,0 +1,33 @@
+package iohelper
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountingWriter(t *testing.T) {
+	var totals []int64
+	w := NewCountingWriter(ioutil.Discard, func(total int64) { totals = append(totals, total) })
+
+	for _, s := range []string{"abc", "", "defgh"} {
+		_, err := io.WriteString(w, s)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int64(8), w.Count())
+	require.Equal(t, []int64{3, 3, 8}, totals)
+}
+
+func TestCountingReader(t *testing.T) {
+	var last int64
+	r := NewCountingReader(strings.NewReader(strings.Repeat("x", 1000)), func(total int64) { last = total })
+
+	n, err := io.Copy(ioutil.Discard, r)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), n)
+	require.Equal(t, int64(1000), r.Count())
+	require.Equal(t, int64(1000), last)
+}
@@ -0,0 +1,27 @@
+package iohelper
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// AdviseSequential advises the kernel that f is read sequentially, so it reads ahead further.
+// The advice applies to reads through f only, not to other descriptors of the file.
+func AdviseSequential(f *os.File) error {
+	return advise(f, unix.FADV_SEQUENTIAL)
+}
+
+// AdviseDontNeed advises the kernel that the cached pages of the file of f are not needed
+// anymore, so they are dropped from the page cache rather than evicting the pages of others.
+// Pages still to be written back, and pages mapped by processes, are kept.
+func AdviseDontNeed(f *os.File) error {
+	return advise(f, unix.FADV_DONTNEED)
+}
+
+func advise(f *os.File, advice int) error {
+	if err := unix.Fadvise(int(f.Fd()), 0, 0, advice); err != nil {
+		return &os.SyscallError{Syscall: "fadvise64", Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package iohelper
+
+import "os"
+
+// AdviseSequential does nothing, the kernel is only advised on Linux.
+func AdviseSequential(*os.File) error {
+	return nil
+}
+
+// AdviseDontNeed does nothing, the kernel is only advised on Linux.
+func AdviseDontNeed(*os.File) error {
+	return nil
+}
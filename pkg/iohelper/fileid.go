@@ -0,0 +1,20 @@
+//go:build !windows
+
+package iohelper
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileID identifies a file by device and inode, hard links and symlinks to a file share it.
+type FileID struct{ Dev, Ino uint64 }
+
+// FileIDOf returns the ID of the file described by fi, it returns false if the platform has none.
+func FileIDOf(fi os.FileInfo) (FileID, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileID{}, false
+	}
+	return FileID{uint64(st.Dev), st.Ino}, true
+}
@@ -0,0 +1,11 @@
+package iohelper
+
+import "os"
+
+// FileID identifies a file, files are not identified by device and inode on Windows.
+type FileID struct{}
+
+// FileIDOf returns false, files are not identified by device and inode on Windows.
+func FileIDOf(os.FileInfo) (FileID, bool) {
+	return FileID{}, false
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package iohelper
+
+import "errors"
+
+// FreeSpace fails, the free space is not known on this platform.
+func FreeSpace(string) (uint64, error) {
+	return 0, errors.New("free space is not known on this platform")
+}
@@ -0,0 +1,22 @@
+package iohelper
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeSpace(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd", "windows":
+	default:
+		t.Skip("free space is not known on", runtime.GOOS)
+	}
+	free, err := FreeSpace(t.TempDir())
+	require.NoError(t, err)
+	require.NotZero(t, free)
+
+	_, err = FreeSpace("/does/not/exist")
+	require.Error(t, err)
+}
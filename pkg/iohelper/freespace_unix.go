@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+
+package iohelper
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// FreeSpace returns the space available to unprivileged users in the filesystem of path, in bytes.
+func FreeSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,20 @@
+package iohelper
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// FreeSpace returns the space available to the user in the filesystem of path, in bytes.
+func FreeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, nil, nil); err != nil {
+		return 0, &os.PathError{Op: "GetDiskFreeSpaceEx", Path: path, Err: err}
+	}
+	return free, nil
+}
@@ -0,0 +1,312 @@
+package iohelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultHTTPBlockSize is the size of the blocks HTTPReaderAt requests and caches by default,
+// large enough for the ELF header, the program headers and the notes of most binaries.
+const DefaultHTTPBlockSize = 64 << 10 // 64KiB
+
+// defaultHTTPCacheBlocks is the number of blocks cached by default, 16MiB of the default size.
+const defaultHTTPCacheBlocks = 256
+
+var (
+	// ErrRangeNotSupported is returned by HTTPReaderAt when the server answers range requests with
+	// the whole file.
+	ErrRangeNotSupported = errors.New("server does not support range requests")
+	// ErrModified is returned by HTTPReaderAt when the ETag of the remote file changed between
+	// requests, the cached parts belong to another version then.
+	ErrModified = errors.New("remote file modified")
+)
+
+// HTTPReaderAt reads a remote file with HTTP range requests, so only the read parts of the file
+// are downloaded, e.g. the headers and the debug sections of a binary in an artifact store or an
+// OCI blob. It reads whole blocks and caches the recently read ones, so the many small reads of
+// debug/elf cost few requests. The ETag of the first response is sent as If-Match with the later
+// requests, so reads fail with ErrModified rather than mixing two versions of the file.
+// It is safe for concurrent use, the reads are serialized.
+//
+// Open a remote ELF file with elf.NewFile(io.NewSectionReader(r, 0, size)), the size from Size.
+type HTTPReaderAt struct {
+	url       string
+	client    *http.Client
+	ctx       context.Context
+	header    http.Header
+	blockSize int64
+	maxBlocks int
+
+	mu   sync.Mutex
+	etag string
+	// size is the size of the file, or -1 until a response tells it.
+	size   int64
+	blocks map[int64][]byte
+	// recent are the indices of the cached blocks, the least recently read first.
+	recent []int64
+}
+
+type HTTPOption func(h *HTTPReaderAt)
+
+// WithHTTPContext sends the requests with ctx, the default is context.Background.
+func WithHTTPContext(ctx context.Context) HTTPOption {
+	return func(h *HTTPReaderAt) {
+		h.ctx = ctx
+	}
+}
+
+// WithHTTPHeader sends the header with each request, e.g. the authorization.
+func WithHTTPHeader(header http.Header) HTTPOption {
+	return func(h *HTTPReaderAt) {
+		h.header = header
+	}
+}
+
+// WithHTTPCache reads blocks of blockSize bytes and caches up to n of them.
+func WithHTTPCache(blockSize int64, n int) HTTPOption {
+	return func(h *HTTPReaderAt) {
+		h.blockSize, h.maxBlocks = blockSize, n
+	}
+}
+
+// NewHTTPReaderAt returns an HTTPReaderAt of the file at url that sends its requests with the
+// client. The default client is http.DefaultClient.
+func NewHTTPReaderAt(url string, client *http.Client, opts ...HTTPOption) *HTTPReaderAt {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	h := &HTTPReaderAt{
+		url:       url,
+		client:    client,
+		ctx:       context.Background(),
+		blockSize: DefaultHTTPBlockSize,
+		maxBlocks: defaultHTTPCacheBlocks,
+		size:      -1,
+		blocks:    map[int64][]byte{},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.blockSize <= 0 {
+		h.blockSize = DefaultHTTPBlockSize
+	}
+	if h.maxBlocks <= 0 {
+		h.maxBlocks = 1
+	}
+	return h
+}
+
+// ReadAt reads len(p) bytes at offset off, requesting the blocks that are not cached in a
+// single range request. Reads past the end of the file return the bytes up to it and io.EOF.
+func (h *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.size >= 0 && off >= h.size {
+		return 0, io.EOF
+	}
+	first, last := off/h.blockSize, (off+int64(len(p))-1)/h.blockSize
+	if h.size >= 0 && last > (h.size-1)/h.blockSize {
+		last = (h.size - 1) / h.blockSize
+	}
+	blocks := make([][]byte, 0, last-first+1)
+	missing := int64(-1)
+	for b := first; b <= last; b++ {
+		data, ok := h.blocks[b]
+		if !ok && missing < 0 {
+			missing = b
+		}
+		blocks = append(blocks, data)
+	}
+	if missing >= 0 {
+		fetched, err := h.fetch(missing, last)
+		if err != nil {
+			return 0, err
+		}
+		blocks = append(blocks[:missing-first], fetched...)
+	}
+
+	var n int
+	for i, data := range blocks {
+		pos := off + int64(n) - (first+int64(i))*h.blockSize
+		if pos >= int64(len(data)) {
+			break
+		}
+		n += copy(p[n:], data[pos:])
+		h.touch(first + int64(i))
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Size returns the size of the file, from a HEAD request unless an earlier response told it.
+func (h *HTTPReaderAt) Size() (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.size >= 0 {
+		return h.size, nil
+	}
+
+	resp, err := h.do(http.MethodHead, "")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPreconditionFailed:
+		return 0, ErrModified
+	default:
+		return 0, fmt.Errorf("failed to stat %s: %s", h.url, resp.Status)
+	}
+	if err := h.validate(resp); err != nil {
+		return 0, err
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("failed to stat %s: unknown size", h.url)
+	}
+	h.size = resp.ContentLength
+	return h.size, nil
+}
+
+// fetch requests the blocks first to last, caches them and returns them. Blocks past the end of
+// the file are left out, the last one returned may be short.
+func (h *HTTPReaderAt) fetch(first, last int64) ([][]byte, error) {
+	start, end := first*h.blockSize, (last+1)*h.blockSize
+	resp, err := h.do(http.MethodGet, fmt.Sprintf("bytes=%d-%d", start, end-1))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok {
+			h.size = size
+		}
+		return nil, nil
+	case http.StatusPreconditionFailed:
+		return nil, ErrModified
+	case http.StatusOK:
+		return nil, ErrRangeNotSupported
+	default:
+		return nil, fmt.Errorf("failed to read %s: %s", h.url, resp.Status)
+	}
+	if err := h.validate(resp); err != nil {
+		return nil, err
+	}
+	if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok {
+		h.size = size
+	}
+
+	data := make([]byte, end-start)
+	n, err := io.ReadFull(resp.Body, data)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("failed to read %s: %w", h.url, err)
+	}
+	data = data[:n]
+
+	var blocks [][]byte
+	for b := first; b <= last && len(data) > 0; b++ {
+		block := data
+		if int64(len(block)) > h.blockSize {
+			block = block[:h.blockSize]
+		}
+		data = data[len(block):]
+		h.blocks[b] = block
+		h.touch(b)
+		blocks = append(blocks, block)
+	}
+	for len(h.recent) > h.maxBlocks {
+		delete(h.blocks, h.recent[0])
+		h.recent = h.recent[1:]
+	}
+	return blocks, nil
+}
+
+// touch marks the cached block as the most recently read one.
+func (h *HTTPReaderAt) touch(b int64) {
+	if _, ok := h.blocks[b]; !ok {
+		return
+	}
+	for i, r := range h.recent {
+		if r == b {
+			h.recent = append(h.recent[:i], h.recent[i+1:]...)
+			break
+		}
+	}
+	h.recent = append(h.recent, b)
+}
+
+// validate records the ETag of the first response and checks that the later ones have the same,
+// in case the server ignores If-Match, e.g. for weak ETags.
+func (h *HTTPReaderAt) validate(resp *http.Response) error {
+	etag := resp.Header.Get("ETag")
+	if h.etag == "" {
+		h.etag = etag
+		return nil
+	}
+	if etag != "" && etag != h.etag {
+		return ErrModified
+	}
+	return nil
+}
+
+func (h *HTTPReaderAt) do(method, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(h.ctx, method, h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.header {
+		req.Header[k] = v
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	// Weak ETags never match If-Match, they are only compared by validate.
+	if h.etag != "" && !strings.HasPrefix(h.etag, "W/") {
+		req.Header.Set("If-Match", h.etag)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// Drained, so the connection is reused by the next request.
+	resp.Body = drainingCloser{resp.Body}
+	return resp, nil
+}
+
+// contentRangeSize returns the complete length of a Content-Range header, e.g. 1000 of
+// "bytes 0-99/1000" or "bytes */1000".
+func contentRangeSize(header string) (int64, bool) {
+	i := strings.LastIndexByte(header, '/')
+	if i < 0 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(header[i+1:], 10, 64)
+	return size, err == nil
+}
+
+// drainingCloser reads the rest of the body before closing it.
+type drainingCloser struct{ io.ReadCloser }
+
+func (d drainingCloser) Close() error {
+	io.Copy(ioutil.Discard, io.LimitReader(d.ReadCloser, 1<<16))
+	return d.ReadCloser.Close()
+}
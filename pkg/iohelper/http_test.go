@@ -0,0 +1,111 @@
+package iohelper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// rangeServer serves content with range requests and the ETag, counting the requests.
+func rangeServer(t *testing.T, content *[]byte, etag *string) (*httptest.Server, *atomic.Int32) {
+	requests := atomic.NewInt32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		w.Header().Set("ETag", *etag)
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(*content))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func TestHTTPReaderAt(t *testing.T) {
+	content, etag := []byte(strings.Repeat("0123456789", 100)), `"v1"`
+	srv, requests := rangeServer(t, &content, &etag)
+	r := NewHTTPReaderAt(srv.URL, srv.Client(),
+		WithHTTPHeader(http.Header{"Authorization": []string{"Bearer secret"}}),
+		WithHTTPCache(64, 4),
+	)
+
+	p := make([]byte, 16)
+	n, err := r.ReadAt(p, 42)
+	require.NoError(t, err)
+	require.Equal(t, content[42:58], p[:n])
+	require.Equal(t, int32(1), requests.Load())
+
+	// Cached blocks are not requested again, the size is known from the Content-Range.
+	n, err = r.ReadAt(p, 0)
+	require.NoError(t, err)
+	require.Equal(t, content[:16], p[:n])
+	size, err := r.Size()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), size)
+	require.Equal(t, int32(1), requests.Load())
+
+	// Reads spanning blocks cost a single request.
+	p = make([]byte, 200)
+	n, err = r.ReadAt(p, 100)
+	require.NoError(t, err)
+	require.Equal(t, content[100:300], p[:n])
+	require.Equal(t, int32(2), requests.Load())
+
+	// Reads past the end return the rest and io.EOF.
+	n, err = r.ReadAt(p, 990)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, content[990:], p[:n])
+	n, err = r.ReadAt(p, 1000)
+	require.Equal(t, io.EOF, err)
+	require.Zero(t, n)
+	require.Equal(t, int32(3), requests.Load())
+
+	// The first block was evicted, its next read fails once the file changed.
+	content, etag = bytes.Repeat([]byte("x"), 1000), `"v2"`
+	_, err = r.ReadAt(p[:16], 0)
+	require.ErrorIs(t, err, ErrModified)
+}
+
+func TestHTTPReaderAt_Size(t *testing.T) {
+	content, etag := []byte("0123456789"), `W/"v1"`
+	srv, _ := rangeServer(t, &content, &etag)
+	r := NewHTTPReaderAt(srv.URL, nil,
+		WithHTTPContext(context.Background()),
+		WithHTTPHeader(http.Header{"Authorization": []string{"Bearer secret"}}),
+	)
+	size, err := r.Size()
+	require.NoError(t, err)
+	require.Equal(t, int64(10), size)
+
+	// Weak ETags are compared by the reader.
+	etag = `W/"v2"`
+	_, err = r.ReadAt(make([]byte, 4), 0)
+	require.ErrorIs(t, err, ErrModified)
+}
+
+func TestHTTPReaderAt_RangeNotSupported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("the whole file"))
+	}))
+	defer srv.Close()
+
+	_, err := NewHTTPReaderAt(srv.URL, nil).ReadAt(make([]byte, 4), 2)
+	require.ErrorIs(t, err, ErrRangeNotSupported)
+}
+
+func TestHTTPReaderAt_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	r := NewHTTPReaderAt(srv.URL, nil)
+	_, err := r.ReadAt(make([]byte, 4), 0)
+	require.Error(t, err)
+	_, err = r.Size()
+	require.Error(t, err)
+}
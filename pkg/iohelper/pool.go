@@ -0,0 +1,48 @@
+package iohelper
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReaderAtPool hands out independent readers over a single file descriptor,
+// so sections of a file can be copied by multiple goroutines in parallel.
+//
+// Reads are positional (pread(2)) and never move the offset of the file descriptor,
+// which makes them safe for concurrent use. Each reader returned by Section keeps its own offset.
+type ReaderAtPool struct {
+	f    *os.File
+	size int64
+}
+
+// NewReaderAtPool returns a ReaderAtPool for the given file.
+// The caller stays responsible for closing the file once all readers are done.
+func NewReaderAtPool(f *os.File) (*ReaderAtPool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return &ReaderAtPool{f: f, size: fi.Size()}, nil
+}
+
+// ReadAt reads len(p) bytes at offset off of the file. It is safe for concurrent use.
+func (p *ReaderAtPool) ReadAt(b []byte, off int64) (int, error) {
+	return p.f.ReadAt(b, off)
+}
+
+// Size returns the size of the file when the pool was created.
+func (p *ReaderAtPool) Size() int64 {
+	return p.size
+}
+
+// Section returns a reader of n bytes starting at offset off, with an offset of its own.
+// A reader must not be shared between goroutines, but any number of them can be used in parallel.
+func (p *ReaderAtPool) Section(off, n int64) *io.SectionReader {
+	return io.NewSectionReader(p, off, n)
+}
+
+// Reader returns a reader of the whole file, with an offset of its own.
+func (p *ReaderAtPool) Reader() *io.SectionReader {
+	return p.Section(0, p.size)
+}
@@ -0,0 +1,54 @@
+package iohelper
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderAtPool(t *testing.T) {
+	const (
+		sections    = 16
+		sectionSize = 64 << 10
+	)
+	content := make([]byte, sections*sectionSize)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	path := filepath.Join(t.TempDir(), "input")
+	require.NoError(t, ioutil.WriteFile(path, content, 0o600))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+
+	pool, err := NewReaderAtPool(f)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), pool.Size())
+
+	var wg sync.WaitGroup
+	got := make([][]byte, sections)
+	errs := make([]error, sections)
+	for i := 0; i < sections; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i], errs[i] = ioutil.ReadAll(pool.Section(int64(i*sectionSize), sectionSize))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < sections; i++ {
+		require.NoError(t, errs[i])
+		require.True(t, bytes.Equal(content[i*sectionSize:(i+1)*sectionSize], got[i]), "section %d differs", i)
+	}
+
+	all, err := ioutil.ReadAll(pool.Reader())
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(content, all))
+}
@@ -0,0 +1,123 @@
+package iohelper
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket of bytes, shared by the readers and writers it limits, e.g. the
+// concurrent uploads of a host. The bucket holds up to a second worth of bytes, so short bursts are
+// not delayed. It is safe for concurrent use.
+type RateLimiter struct {
+	mu    sync.Mutex
+	rate  float64 // bytes per second
+	burst float64
+
+	tokens float64
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter returns a RateLimiter of bytesPerSecond. A non-positive rate disables limiting.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	l := &RateLimiter{
+		rate:  float64(bytesPerSecond),
+		burst: float64(bytesPerSecond),
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	l.tokens = l.burst
+	l.last = l.now()
+	return l
+}
+
+// chunk returns the prefix of p that is at most the burst size.
+func (l *RateLimiter) chunk(p []byte) []byte {
+	if float64(len(p)) > l.burst {
+		return p[:int(l.burst)]
+	}
+	return p
+}
+
+// wait takes n tokens and blocks until they would have been available. Concurrent callers reserve
+// their tokens in turn, so they share the rate.
+func (l *RateLimiter) wait(n float64) {
+	l.mu.Lock()
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= n
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if d > 0 {
+		l.sleep(d)
+	}
+}
+
+// RateLimitedWriter limits the throughput of the underlying io.Writer with a token bucket.
+type RateLimitedWriter struct {
+	w io.Writer
+	*RateLimiter
+}
+
+// NewRateLimitedWriter returns a RateLimitedWriter that writes at most bytesPerSecond to w.
+// A non-positive rate disables limiting.
+func NewRateLimitedWriter(w io.Writer, bytesPerSecond int64) *RateLimitedWriter {
+	return &RateLimitedWriter{w: w, RateLimiter: NewRateLimiter(bytesPerSecond)}
+}
+
+func (rw *RateLimitedWriter) Write(p []byte) (int, error) {
+	if rw.rate <= 0 {
+		return rw.w.Write(p)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		chunk := rw.chunk(p)
+		rw.wait(float64(len(chunk)))
+
+		n, err := rw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// RateLimitedReader limits the throughput of the underlying io.Reader with the token bucket of a
+// RateLimiter, e.g. the body of an upload request.
+type RateLimitedReader struct {
+	r io.Reader
+	*RateLimiter
+}
+
+// NewRateLimitedReader returns a RateLimitedReader that reads from r as fast as l allows.
+func NewRateLimitedReader(r io.Reader, l *RateLimiter) *RateLimitedReader {
+	return &RateLimitedReader{r: r, RateLimiter: l}
+}
+
+func (rr *RateLimitedReader) Read(p []byte) (int, error) {
+	if rr.rate <= 0 {
+		return rr.r.Read(p)
+	}
+	n, err := rr.r.Read(rr.chunk(p))
+	if n > 0 {
+		rr.wait(float64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,67 @@
+package iohelper
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitedWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewRateLimitedWriter(&buf, 100)
+
+	now := time.Unix(0, 0)
+	var slept time.Duration
+	w.now = func() time.Time { return now }
+	w.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+	w.last = now
+
+	// The first second worth of bytes goes through as a burst.
+	n, err := w.Write(make([]byte, 100))
+	require.NoError(t, err)
+	require.Equal(t, 100, n)
+	require.Equal(t, time.Duration(0), slept)
+
+	// Everything beyond that is paced.
+	n, err = w.Write(make([]byte, 250))
+	require.NoError(t, err)
+	require.Equal(t, 250, n)
+	require.Equal(t, 2500*time.Millisecond, slept)
+	require.Equal(t, 350, buf.Len())
+}
+
+func TestRateLimitedWriterUnlimited(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewRateLimitedWriter(&buf, 0)
+	w.sleep = func(time.Duration) { t.Fatal("unexpected sleep") }
+
+	n, err := w.Write(make([]byte, 1<<20))
+	require.NoError(t, err)
+	require.Equal(t, 1<<20, n)
+}
+
+func TestRateLimitedReader(t *testing.T) {
+	l := NewRateLimiter(100)
+	now := time.Unix(0, 0)
+	var slept time.Duration
+	l.now = func() time.Time { return now }
+	l.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+	l.last = now
+
+	// Readers sharing the limiter share its rate: 300 bytes are read in 2s after the burst.
+	for i := 0; i < 2; i++ {
+		data, err := ioutil.ReadAll(NewRateLimitedReader(bytes.NewReader(make([]byte, 150)), l))
+		require.NoError(t, err)
+		require.Len(t, data, 150)
+	}
+	require.Equal(t, 2*time.Second, slept)
+}
@@ -0,0 +1,86 @@
+// Package iohelper provides io primitives to copy the contents of large files
+// without having their entire contents in memory at any one time.
+package iohelper
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	errWhence = errors.New("seek: invalid whence")
+	errOffset = errors.New("seek: invalid offset")
+)
+
+// SectionWriter implements Write, WriteAt and Seek on a section of an underlying io.WriterAt.
+// It is the writing counterpart of io.SectionReader.
+type SectionWriter struct {
+	w     io.WriterAt
+	base  int64
+	off   int64
+	limit int64
+}
+
+// NewSectionWriter returns a SectionWriter that writes to w
+// starting at offset off and stops with io.ErrShortWrite after n bytes.
+func NewSectionWriter(w io.WriterAt, off, n int64) *SectionWriter {
+	return &SectionWriter{w: w, base: off, off: off, limit: off + n}
+}
+
+// Write writes p at the current offset of the section.
+func (s *SectionWriter) Write(p []byte) (int, error) {
+	if s.off >= s.limit {
+		return 0, io.ErrShortWrite
+	}
+	var err error
+	if max := s.limit - s.off; int64(len(p)) > max {
+		p = p[0:max]
+		err = io.ErrShortWrite
+	}
+	n, werr := s.w.WriteAt(p, s.off)
+	s.off += int64(n)
+	if werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// WriteAt writes p at offset off relative to the start of the section.
+func (s *SectionWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= s.limit-s.base {
+		return 0, io.ErrShortWrite
+	}
+	off += s.base
+	if max := s.limit - off; int64(len(p)) > max {
+		n, err := s.w.WriteAt(p[0:max], off)
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		return n, err
+	}
+	return s.w.WriteAt(p, off)
+}
+
+// Seek sets the offset for the next Write, relative to the start of the section.
+func (s *SectionWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		offset += s.base
+	case io.SeekCurrent:
+		offset += s.off
+	case io.SeekEnd:
+		offset += s.limit
+	default:
+		return 0, errWhence
+	}
+	if offset < s.base {
+		return 0, errOffset
+	}
+	s.off = offset
+	return offset - s.base, nil
+}
+
+// Size returns the size of the section in bytes.
+func (s *SectionWriter) Size() int64 {
+	return s.limit - s.base
+}
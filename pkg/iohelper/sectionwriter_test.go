@@ -0,0 +1,53 @@
+package iohelper
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSectionWriter(t *testing.T) {
+	w := &memWriterAt{buf: make([]byte, 10)}
+	sw := NewSectionWriter(w, 2, 5)
+	require.Equal(t, int64(5), sw.Size())
+
+	n, err := sw.Write([]byte("abc"))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	n, err = sw.Write([]byte("defg"))
+	require.ErrorIs(t, err, io.ErrShortWrite)
+	require.Equal(t, 2, n)
+	require.Equal(t, "\x00\x00abcde\x00\x00\x00", string(w.buf))
+
+	off, err := sw.Seek(1, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), off)
+	_, err = sw.Write([]byte("X"))
+	require.NoError(t, err)
+
+	_, err = sw.WriteAt([]byte("Y"), 4)
+	require.NoError(t, err)
+	require.Equal(t, "\x00\x00aXcdY\x00\x00\x00", string(w.buf))
+
+	_, err = sw.WriteAt([]byte("Z"), 5)
+	require.ErrorIs(t, err, io.ErrShortWrite)
+
+	_, err = sw.Seek(-1, io.SeekStart)
+	require.Error(t, err)
+}
+
+// memWriterAt is an in-memory io.WriterAt that records the writes it receives.
+type memWriterAt struct {
+	buf    []byte
+	writes int
+}
+
+func (m *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	m.writes++
+	if end := int(off) + len(p); end > len(m.buf) {
+		m.buf = append(m.buf, make([]byte, end-len(m.buf))...)
+	}
+	return copy(m.buf[off:], p), nil
+}
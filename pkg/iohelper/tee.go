@@ -0,0 +1,100 @@
+package iohelper
+
+import "io"
+
+// TeeReaderAt returns an io.ReaderAt that writes to w what it reads from r.
+// All reads from r performed through it are matched with corresponding writes to w,
+// it is meant to compute checksums of contents while they are being copied,
+// so the contents have to be read sequentially and only once for w to see them in order.
+// Any error encountered while writing is reported as a read error.
+func TeeReaderAt(r io.ReaderAt, w io.Writer) io.ReaderAt {
+	return &teeReaderAt{r: r, w: w}
+}
+
+type teeReaderAt struct {
+	r io.ReaderAt
+	w io.Writer
+}
+
+func (t *teeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := t.r.ReadAt(p, off)
+	if n > 0 {
+		if n, err := t.w.Write(p[:n]); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// SequentialTee is an io.ReaderAt that writes the contents of the underlying io.ReaderAt to an
+// io.Writer front to back, each byte once, while they are read at random, e.g. to hash a whole
+// file while only some of its parts are read for other purposes. Reads ahead of what was written
+// so far first write the part they skip, reads of what was written already are not written again,
+// and Finish writes the rest. Reading the parts in order thus reads the file only once.
+//
+// Reads are only written once Start is called, so the reads of the headers of a file do not have
+// to write all of it. It is not safe for concurrent use.
+type SequentialTee struct {
+	r       io.ReaderAt
+	w       io.Writer
+	size    int64
+	off     int64
+	started bool
+	err     error
+	buf     []byte
+}
+
+// NewSequentialTee returns a SequentialTee of the size bytes of r.
+func NewSequentialTee(r io.ReaderAt, size int64, w io.Writer) *SequentialTee {
+	return &SequentialTee{r: r, w: w, size: size}
+}
+
+// Start writes the reads from now on.
+func (t *SequentialTee) Start() {
+	t.started = true
+}
+
+func (t *SequentialTee) ReadAt(p []byte, off int64) (int, error) {
+	n, err := t.r.ReadAt(p, off)
+	if !t.started || t.err != nil || n == 0 {
+		return n, err
+	}
+	end := off + int64(n)
+	if end <= t.off {
+		return n, err
+	}
+	if off > t.off {
+		if t.err = t.fill(off); t.err != nil {
+			return n, t.err
+		}
+	}
+	if _, t.err = t.w.Write(p[t.off-off : n]); t.err != nil {
+		return n, t.err
+	}
+	t.off = end
+	return n, err
+}
+
+// Finish writes the contents that were not read yet and returns the first error of writing them.
+func (t *SequentialTee) Finish() error {
+	if t.err == nil {
+		t.err = t.fill(t.size)
+	}
+	return t.err
+}
+
+// fill writes the contents up to off.
+func (t *SequentialTee) fill(off int64) error {
+	if off <= t.off {
+		return nil
+	}
+	if t.buf == nil {
+		t.buf = make([]byte, 32<<10)
+	}
+	_, err := io.CopyBuffer(t.w, io.NewSectionReader(t.r, t.off, off-t.off), t.buf)
+	if err != nil {
+		return err
+	}
+	t.off = off
+	return nil
+}
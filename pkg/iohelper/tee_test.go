@@ -0,0 +1,47 @@
+package iohelper
+
+import (
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeeReaderAt(t *testing.T) {
+	const content = "hello, debuginfo"
+
+	h := sha256.New()
+	r := TeeReaderAt(strings.NewReader(content), h)
+
+	var out strings.Builder
+	n, err := io.Copy(&out, io.NewSectionReader(r, 0, int64(len(content))))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), n)
+	require.Equal(t, content, out.String())
+
+	want := sha256.Sum256([]byte(content))
+	require.Equal(t, want[:], h.Sum(nil))
+}
+
+func TestSequentialTee(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	h := sha256.New()
+	r := NewSequentialTee(strings.NewReader(content), int64(len(content)), h)
+	buf := make([]byte, 4)
+	// Reads before Start, e.g. of the headers at the end of the file, are not written.
+	_, err := r.ReadAt(buf, 30)
+	require.NoError(t, err)
+	r.Start()
+	for _, off := range []int64{4, 2, 12, 14, 4} {
+		_, err := r.ReadAt(buf, off)
+		require.NoError(t, err)
+		require.Equal(t, content[off:off+4], string(buf))
+	}
+	require.NoError(t, r.Finish())
+
+	want := sha256.Sum256([]byte(content))
+	require.Equal(t, want[:], h.Sum(nil))
+}
@@ -0,0 +1,27 @@
+// Package metrics holds what the Prometheus metrics of the packages share, e.g. their namespace.
+package metrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace prefixes the names of the metrics of split-debug.
+const Namespace = "split_debug"
+
+// Register registers c with reg and returns it. If an equal collector is registered already,
+// e.g. by a second pipeline of the same process, that one is returned instead, so both count
+// into the same series.
+func Register[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
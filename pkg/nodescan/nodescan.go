@@ -0,0 +1,171 @@
+// Package nodescan enumerates the object files of the processes running on a node through /proc,
+// e.g. to extract the debug information of the containers of a Kubernetes node from a DaemonSet.
+package nodescan
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+)
+
+// Target is an object file mapped by a process.
+type Target struct {
+	// PID is the process that maps the file.
+	PID int
+	// ContainerID is the ID of the container of the process, empty for processes of the host.
+	ContainerID string
+	// Path is the path of the file in the mount namespace of the process.
+	Path string
+	// Open is the path to open the file with from the namespace of the scanner.
+	Open string
+}
+
+// Scanner enumerates the object files of the processes.
+type Scanner struct {
+	proc string
+	all  bool
+}
+
+type Option func(s *Scanner)
+
+// WithProc reads the processes from the given proc file system, the default is /proc.
+// DaemonSets mount the proc file system of the host somewhere else, e.g. /host/proc.
+func WithProc(dir string) Option {
+	return func(s *Scanner) {
+		s.proc = dir
+	}
+}
+
+// WithHostProcesses includes the processes that do not run in containers.
+func WithHostProcesses() Option {
+	return func(s *Scanner) {
+		s.all = true
+	}
+}
+
+// NewScanner returns a scanner of the processes running in containers.
+func NewScanner(opts ...Option) *Scanner {
+	s := &Scanner{proc: "/proc"}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Scan returns the executables and the executable mappings, e.g. shared libraries, of the processes.
+// Files are returned once, for the first process that maps them, in the order of the PIDs.
+// Processes that exit or cannot be inspected while scanning are skipped.
+func (s *Scanner) Scan() ([]Target, error) {
+	entries, err := ioutil.ReadDir(s.proc)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+
+	// Files are shared across containers of the same image.
+	seen := map[iohelper.FileID]bool{}
+	var targets []Target
+	for _, pid := range pids {
+		dir := filepath.Join(s.proc, strconv.Itoa(pid))
+		containerID, err := containerOf(filepath.Join(dir, "cgroup"))
+		if err != nil || (containerID == "" && !s.all) {
+			continue
+		}
+		paths, err := mappedFiles(filepath.Join(dir, "maps"))
+		if err != nil {
+			continue
+		}
+		for _, path := range paths {
+			open := filepath.Join(dir, "root", path)
+			if path == "" {
+				// The executable is opened through its link, it works even if its path is gone.
+				open = filepath.Join(dir, "exe")
+			}
+			fi, err := os.Stat(open)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			if id, ok := iohelper.FileIDOf(fi); ok {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+			if path == "" {
+				if path, err = os.Readlink(open); err != nil {
+					continue
+				}
+			}
+			targets = append(targets, Target{PID: pid, ContainerID: containerID, Path: path, Open: open})
+		}
+	}
+	return targets, nil
+}
+
+// mappedFiles returns the paths of the files the process maps executable.
+// The executable comes first as an empty path.
+func mappedFiles(maps string) ([]string, error) {
+	f, err := os.Open(maps)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	paths := []string{""}
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// address perms offset dev inode path
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 || !strings.Contains(fields[1], "x") {
+			continue
+		}
+		path := strings.Join(fields[5:], " ")
+		if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, " (deleted)") || seen[path] {
+			continue
+		}
+		seen[path] = true
+		paths = append(paths, path)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", maps, err)
+	}
+	return paths, nil
+}
+
+// containerIDPattern matches the container IDs in the cgroup paths of the common runtimes,
+// e.g. /kubepods/burstable/pod<uid>/<id> or /system.slice/containerd-<id>.scope.
+var containerIDPattern = regexp.MustCompile(`(?:^|[/-])([0-9a-f]{64})(?:\.scope)?$`)
+
+// containerOf returns the ID of the container of the process, or an empty string for processes of the host.
+func containerOf(cgroup string) (string, error) {
+	data, err := ioutil.ReadFile(cgroup)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// hierarchy-ID:controllers:path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if m := containerIDPattern.FindStringSubmatch(parts[2]); m != nil {
+			return m[1], nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,63 @@
+package nodescan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const containerID = "3f4e2a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f"
+
+// fakeProc creates a proc file system with the processes of the given cgroups,
+// all of them run the same executable and map lib.so.
+func fakeProc(t *testing.T, cgroups map[string]string) (string, string) {
+	t.Helper()
+	proc, root := t.TempDir(), t.TempDir()
+	exe := filepath.Join(root, "app")
+	require.NoError(t, ioutil.WriteFile(exe, []byte("\x7fELF"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "lib"), 0o755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "lib", "lib.so"), []byte("\x7fELF"), 0o644))
+
+	maps := strings.Join([]string{
+		"00400000-00452000 r-xp 00000000 08:02 173521 /app",
+		"7f0000000000-7f0000001000 r-xp 00000000 08:02 173522 /lib/lib.so",
+		"7f0000002000-7f0000003000 rw-p 00000000 08:02 173522 /lib/lib.so",
+		"7f0000004000-7f0000005000 r-xp 00000000 08:02 173523 /lib/gone.so (deleted)",
+		"7ffd00000000-7ffd00021000 rw-p 00000000 00:00 0 [stack]",
+	}, "\n")
+	for pid, cgroup := range cgroups {
+		dir := filepath.Join(proc, pid)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0o644))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "maps"), []byte(maps), 0o644))
+		require.NoError(t, os.Symlink(exe, filepath.Join(dir, "exe")))
+		require.NoError(t, os.Symlink(root, filepath.Join(dir, "root")))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(proc, "self"), 0o755))
+	return proc, exe
+}
+
+func TestScan(t *testing.T) {
+	proc, exe := fakeProc(t, map[string]string{
+		"1":   "0::/init.scope\n",
+		"100": "0::/kubepods/burstable/pod1234/" + containerID + "\n",
+		"200": "12:pids:/system.slice/containerd-" + containerID + ".scope\n",
+	})
+
+	targets, err := NewScanner(WithProc(proc)).Scan()
+	require.NoError(t, err)
+	require.Equal(t, []Target{
+		{PID: 100, ContainerID: containerID, Path: exe, Open: filepath.Join(proc, "100", "exe")},
+		{PID: 100, ContainerID: containerID, Path: "/lib/lib.so", Open: filepath.Join(proc, "100", "root", "lib", "lib.so")},
+	}, targets)
+
+	targets, err = NewScanner(WithProc(proc), WithHostProcesses()).Scan()
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+	require.Equal(t, 1, targets[0].PID)
+	require.Empty(t, targets[0].ContainerID)
+}
@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"context"
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+// EstimateOptions configure Estimate.
+type EstimateOptions struct {
+	// Filters select the sections as the filters of a pipeline do, DebugSections without filters.
+	Filters []Filter
+	// Compression is the compression of the debug file, e.g. by an encoding or a compressed
+	// archive, one of: none or empty, zstd or xz.
+	Compression string
+}
+
+// SizeReport is the estimated size of a debug file.
+type SizeReport struct {
+	Sections []SectionSize
+	// Size is the size of the debug file, including the headers.
+	Size uint64
+	// Compressed is the size of the debug file after the compression of the options.
+	Compressed uint64
+}
+
+// SectionSize is the estimated size of a section of a debug file.
+type SectionSize struct {
+	Name string
+	// Size is the size of the section in the debug file, compressed sections stay compressed.
+	Size uint64
+	// Uncompressed is the size of the contents of the section.
+	Uncompressed uint64
+	// Compressed is the size of the section after the compression of the options.
+	Compressed uint64
+}
+
+// compressionRatios are typical ratios of zstd at its default level by section.
+var compressionRatios = map[string]float64{
+	".debug_abbrev":   0.15,
+	".debug_aranges":  0.3,
+	".debug_frame":    0.3,
+	".debug_info":     0.25,
+	".debug_line":     0.3,
+	".debug_loc":      0.3,
+	".debug_loclists": 0.3,
+	".debug_ranges":   0.25,
+	".debug_rnglists": 0.3,
+	".debug_str":      0.2,
+	".symtab":         0.35,
+	".strtab":         0.25,
+}
+
+const (
+	// defaultCompressionRatio is the ratio of zstd for other sections.
+	defaultCompressionRatio = 0.4
+	// xzRatio is the typical ratio of xz relative to zstd.
+	xzRatio = 0.85
+)
+
+// Estimate estimates the size of the debug file of f section by section without writing it, e.g.
+// for dry runs or to check quotas before uploading. The sections are selected by the filters of the
+// options along with the sections they link to. They are not rewritten: DWARF edits, size budgets
+// and added indices are not accounted for. The compressed sizes follow typical ratios of the kinds
+// of sections, actual ratios vary with their contents.
+func Estimate(f *elf.File, opts EstimateOptions) (SizeReport, error) {
+	// The ratio relative to zstd, zero without compression.
+	var ratio float64
+	switch opts.Compression {
+	case "", "none":
+	case "zstd":
+		ratio = 1
+	case "xz":
+		ratio = xzRatio
+	default:
+		return SizeReport{}, fmt.Errorf("unsupported compression %q", opts.Compression)
+	}
+	filters := opts.Filters
+	if len(filters) == 0 {
+		filters = []Filter{DebugSections()}
+	}
+	p := New(WithFilters(filters...))
+
+	j := &Job{File: f, Stage: "estimate"}
+	for _, s := range f.Sections {
+		if p.keep(j, s) {
+			j.Sections = append(j.Sections, s)
+		}
+	}
+	if err := LinkedSections().Transform(context.Background(), j); err != nil {
+		return SizeReport{}, err
+	}
+
+	report := SizeReport{Size: EstimateSize(&f.FileHeader, j.Sections)}
+	report.Compressed = report.Size
+	for _, s := range j.Sections {
+		ss := SectionSize{Name: s.Name, Uncompressed: s.Size}
+		if s.Type != elf.SHT_NOBITS {
+			ss.Size = s.FileSize
+		}
+		ss.Compressed = ss.Size
+		// Compressed sections hardly compress any further.
+		if ratio > 0 && s.Flags&elf.SHF_COMPRESSED == 0 && !strings.HasPrefix(s.Name, ".zdebug") {
+			r, ok := compressionRatios[s.Name]
+			if !ok {
+				r = defaultCompressionRatio
+			}
+			ss.Compressed = uint64(float64(ss.Size) * r * ratio)
+		}
+		report.Compressed -= ss.Size - ss.Compressed
+		report.Sections = append(report.Sections, ss)
+	}
+	return report, nil
+}
@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"debug/elf"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+)
+
+// IsDWARF reports whether the section holds DWARF debug information.
+func IsDWARF(s *elf.Section) bool {
+	return strings.HasPrefix(s.Name, ".debug_") ||
+		strings.HasPrefix(s.Name, ".zdebug_") ||
+		strings.HasPrefix(s.Name, "__debug_") // macos
+}
+
+// IsSymbolTable reports whether the section is a symbol table,
+// their string and hash tables are kept through LinkedSections.
+func IsSymbolTable(s *elf.Section) bool {
+	return s.Name == ".symtab" || s.Name == ".dynsym"
+}
+
+// IsGoSymbolTable reports whether the section is a Go symbol or line table.
+func IsGoSymbolTable(s *elf.Section) bool {
+	return s.Name == ".gosymtab" || s.Name == ".gopclntab"
+}
+
+// IsGNUProperty reports whether the section is the GNU property note, which marks the object
+// compatible with hardening features, e.g. BTI and PAC on arm64 or CET on x86. Hardened loaders
+// reject or downgrade objects without it, so stripping must keep it, and debug files keep it for
+// the consumers that check the features of a binary from its debug file.
+func IsGNUProperty(s *elf.Section) bool {
+	return s.Name == elfutils.GNUPropertySection && s.Type == elf.SHT_NOTE
+}
+
+// IsBuildIDNote reports whether the section is the GNU or Go build ID note, debuggers and
+// debuginfod clients match the debug files to their binaries by it.
+func IsBuildIDNote(s *elf.Section) bool {
+	return s.Type == elf.SHT_NOTE && (s.Name == elfutils.GNUBuildIDSection || s.Name == elfutils.GoBuildIDSection)
+}
+
+// IsSDTProbes reports whether the section holds the SystemTap SDT probes (USDT) profilers and
+// bpftrace attach to: their notes, the base their addresses are relative to and their semaphores.
+func IsSDTProbes(s *elf.Section) bool {
+	return (s.Name == elfutils.SDTNoteSection && s.Type == elf.SHT_NOTE) ||
+		s.Name == elfutils.SDTBaseSection ||
+		s.Name == ".probes"
+}
+
+// IsCTF reports whether the section holds Compact C Type Format type information, e.g. of the
+// kernels and userland of FreeBSD and illumos, which calls it .SUNW_ctf.
+func IsCTF(s *elf.Section) bool {
+	return s.Name == ".ctf" || s.Name == ".SUNW_ctf"
+}
+
+// IsBTF reports whether the section holds BPF Type Format type information, e.g. of the Linux
+// kernel and of BPF programs, or the BTF of their functions and lines (.BTF.ext).
+func IsBTF(s *elf.Section) bool {
+	return s.Name == ".BTF" || s.Name == ".BTF.ext"
+}
+
+// isSymbolizationDWARF reports whether the section is needed for address to file:line symbolization.
+var isSymbolizationDWARF = hasName(
+	".debug_line",
+	".debug_line_str",
+	".debug_info",
+	".debug_abbrev",
+	".debug_str",
+	".debug_str_offsets",
+	".debug_addr",
+	".debug_aranges",
+)
+
+// isNameLookupTable reports whether the section is a DWARF name lookup table,
+// modern consumers build their own indexes instead.
+var isNameLookupTable = hasName(
+	".debug_pubnames",
+	".debug_pubtypes",
+	".debug_gnu_pubnames",
+	".debug_gnu_pubtypes",
+	".zdebug_pubnames",
+	".zdebug_pubtypes",
+)
+
+// isTypeLookupTable reports whether the section is the name lookup table of the types, rust-gdb
+// looks up the types of the pretty printers in it.
+var isTypeLookupTable = hasName(".debug_pubtypes", ".debug_gnu_pubtypes", ".zdebug_pubtypes")
+
+// isMacroInfo reports whether the section holds the macro information of the compilation units.
+var isMacroInfo = hasName(".debug_macro", ".debug_macinfo", ".zdebug_macro", ".zdebug_macinfo")
+
+// isGDBScripts reports whether the section holds the scripts GDB loads, e.g. pretty printers.
+var isGDBScripts = hasName(".debug_gdb_scripts", ".zdebug_gdb_scripts")
+
+func hasName(names ...string) func(s *elf.Section) bool {
+	return func(s *elf.Section) bool {
+		for _, name := range names {
+			if s.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// DebugSections keeps the debug information: the DWARF sections, the symbol tables, the build ID
+// and GNU property notes and the SDT probes, and the sections any of the also predicates reports,
+// e.g. IsCTF and IsBTF.
+func DebugSections(also ...func(s *elf.Section) bool) Filter {
+	return FilterFunc("debug", func(_ *Job, s *elf.Section) bool {
+		if IsDWARF(s) || IsSymbolTable(s) || IsGoSymbolTable(s) || IsBuildIDNote(s) || IsGNUProperty(s) || IsSDTProbes(s) {
+			return true
+		}
+		for _, keep := range also {
+			if keep(s) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// SymbolizationOnly drops the DWARF sections that are not needed to map addresses
+// to functions, files and lines. Other sections are kept.
+func SymbolizationOnly() Filter {
+	return FilterFunc("symbolize-only", func(_ *Job, s *elf.Section) bool {
+		return !IsDWARF(s) || isSymbolizationDWARF(s)
+	})
+}
+
+// Retention presets of auxiliary DWARF sections.
+const (
+	// PresetFull keeps all of them.
+	PresetFull = "full"
+	// PresetGDB drops the name lookup tables that modern consumers ignore.
+	PresetGDB = "gdb"
+	// PresetMinimal also drops the GDB pretty printer scripts.
+	PresetMinimal = "minimal"
+	// PresetRust drops the name lookup tables but the one of the types, rust-gdb and rust-lldb
+	// use it and the pretty printer scripts.
+	PresetRust = "rust"
+)
+
+// Preset drops the auxiliary DWARF sections the given retention preset does not keep.
+func Preset(name string) Filter {
+	return FilterFunc("preset", func(_ *Job, s *elf.Section) bool {
+		switch name {
+		case PresetGDB:
+			return !isNameLookupTable(s)
+		case PresetMinimal:
+			return !isNameLookupTable(s) && !isGDBScripts(s)
+		case PresetRust:
+			return !isNameLookupTable(s) || isTypeLookupTable(s)
+		default:
+			return true
+		}
+	})
+}
+
+// StripMacros drops the macro information, EditDWARF clears the references to it.
+func StripMacros() Filter {
+	return FilterFunc("strip-macros", func(_ *Job, s *elf.Section) bool {
+		return !isMacroInfo(s)
+	})
+}
@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"os"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pipelineMetrics count the jobs of a pipeline, see WithRegisterer.
+type pipelineMetrics struct {
+	extractions *prometheus.CounterVec
+	bytes       prometheus.Counter
+	duration    prometheus.Histogram
+}
+
+// WithRegisterer registers the metrics of the pipeline with reg: the jobs by result, the bytes
+// written and the duration of the jobs. Pipelines of the same registry share them.
+func WithRegisterer(reg prometheus.Registerer) Option {
+	return func(p *Pipeline) {
+		p.metrics = &pipelineMetrics{
+			extractions: metrics.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+				Namespace: metrics.Namespace,
+				Name:      "extractions_total",
+				Help:      "Extractions of debug information by result: success or failure.",
+			}, []string{"result"})),
+			bytes: metrics.Register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+				Namespace: metrics.Namespace,
+				Name:      "extracted_bytes_total",
+				Help:      "Bytes of the debug files written by the extractions to an output file.",
+			})),
+			duration: metrics.Register(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+				Namespace: metrics.Namespace,
+				Name:      "extraction_duration_seconds",
+				Help:      "Duration of the extractions of debug information, the sinks included.",
+				Buckets:   prometheus.ExponentialBuckets(0.01, 4, 9),
+			})),
+		}
+	}
+}
+
+// observe records the outcome of a job that started at start. The bytes written are those of the
+// output file of the job, the writer may have closed w already.
+func (m *pipelineMetrics) observe(start time.Time, j *Job, err error) {
+	if m == nil {
+		return
+	}
+	m.duration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.extractions.WithLabelValues("failure").Inc()
+		return
+	}
+	m.extractions.WithLabelValues("success").Inc()
+	if j.Output == "" {
+		return
+	}
+	if fi, err := os.Stat(j.Output); err == nil {
+		m.bytes.Add(float64(fi.Size()))
+	}
+}
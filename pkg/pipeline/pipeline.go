@@ -0,0 +1,335 @@
+// Package pipeline extracts debug information in stages: a reader opens the input,
+// filters select its sections, transformers rewrite the selection, a writer serializes it
+// and sinks consume the written output, e.g. to upload it.
+//
+// The stages of split-debug are provided by this package, embedders compose them
+// with their own through the options of New.
+package pipeline
+
+import (
+	"context"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/dwarfedit"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+	"github.com/polarsignals/split-debug/pkg/tracing"
+
+	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Job is a single input going through a pipeline, the stages share their state through it.
+type Job struct {
+	// Path is the path of the input as given, e.g. - for stdin.
+	Path string
+	// Input is the path of the file the input is read from, e.g. stdin spilled to disk.
+	// It defaults to Path.
+	Input string
+	// Output is the path of the file the output is written to, sinks read it back from there.
+	Output string
+	// Logger logs the progress of the stages.
+	Logger log.Logger
+
+	// File is the input, opened by the reader.
+	File *elf.File
+	// BuildID is the GNU or Go build ID of the input, if it has one.
+	BuildID string
+	// Sections are the sections to write, in the order of the input.
+	Sections []*elf.Section
+	// Editor holds the rewritten DWARF sections, if a stage edited them.
+	Editor *dwarfedit.Editor
+	// UnwindTable is the encoded compact unwind table of the input, if a stage built it.
+	UnwindTable []byte
+	// Dropped are the names of the sections dropped to fit the size budget, see SizeBudget.
+	Dropped []string
+	// Stage is the name of the running stage, or the last one that ran.
+	Stage string
+
+	// input is the file File reads from, if the reader opened it, see AdviseKernel.
+	input *os.File
+	// inputTee writes the input read by the writer to the writer of TeeInput.
+	inputTee *iohelper.SequentialTee
+}
+
+// Close closes the input.
+func (j *Job) Close() error {
+	if j.input != nil {
+		// Done with the input, its pages need not stay in the page cache.
+		iohelper.AdviseDontNeed(j.input)
+		err := j.input.Close()
+		j.input = nil
+		return err
+	}
+	if j.File == nil {
+		return nil
+	}
+	return j.File.Close()
+}
+
+func (j *Job) logger() log.Logger {
+	if j.Logger == nil {
+		return log.NewNopLogger()
+	}
+	return j.Logger
+}
+
+// Reader opens the input of the job and sets its file.
+type Reader interface {
+	Name() string
+	Read(ctx context.Context, j *Job) error
+}
+
+// Filter selects the sections of the input to keep, a section is kept if all filters keep it.
+type Filter interface {
+	Name() string
+	Keep(j *Job, s *elf.Section) bool
+}
+
+// Transformer rewrites the selected sections of the job, e.g. to add, replace or drop some.
+type Transformer interface {
+	Name() string
+	Transform(ctx context.Context, j *Job) error
+}
+
+// Writer serializes the selected sections to w.
+type Writer interface {
+	Name() string
+	Write(ctx context.Context, j *Job, w io.WriteSeeker) error
+}
+
+// Sink consumes the written output, e.g. uploads it.
+type Sink interface {
+	Name() string
+	Consume(ctx context.Context, j *Job, r io.ReaderAt, size int64) error
+}
+
+// Pipeline runs the stages for each job.
+type Pipeline struct {
+	reader       Reader
+	filters      []Filter
+	transformers []Transformer
+	writer       Writer
+	sinks        []Sink
+	tracer       trace.Tracer
+	metrics      *pipelineMetrics
+}
+
+type Option func(p *Pipeline)
+
+// WithReader replaces the reader, the default opens inputs without limits.
+func WithReader(r Reader) Option {
+	return func(p *Pipeline) {
+		p.reader = r
+	}
+}
+
+// WithFilters adds filters. Without filters all sections are kept.
+func WithFilters(filters ...Filter) Option {
+	return func(p *Pipeline) {
+		p.filters = append(p.filters, filters...)
+	}
+}
+
+// WithTransformers adds transformers, they run in the order they are added.
+func WithTransformers(transformers ...Transformer) Option {
+	return func(p *Pipeline) {
+		p.transformers = append(p.transformers, transformers...)
+	}
+}
+
+// WithWriter replaces the writer, the default writes an ELF file.
+func WithWriter(w Writer) Option {
+	return func(p *Pipeline) {
+		p.writer = w
+	}
+}
+
+// WithSinks adds sinks, they run in the order they are added.
+func WithSinks(sinks ...Sink) Option {
+	return func(p *Pipeline) {
+		p.sinks = append(p.sinks, sinks...)
+	}
+}
+
+// WithTracer traces the stages with the given tracer.
+func WithTracer(t trace.Tracer) Option {
+	return func(p *Pipeline) {
+		p.tracer = t
+	}
+}
+
+// New creates a pipeline of the given stages.
+func New(opts ...Option) *Pipeline {
+	p := &Pipeline{
+		reader: Open(elfutils.Limits{}),
+		writer: ELF(),
+		tracer: trace.NewNoopTracerProvider().Tracer(""),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Run runs the stages for the job and writes the output to w. The input is left open
+// for the caller to inspect the job, it is closed by closing the job.
+func (p *Pipeline) Run(ctx context.Context, j *Job, w io.WriteSeeker) (err error) {
+	defer func(start time.Time) { p.metrics.observe(start, j, err) }(time.Now())
+	if j.Input == "" {
+		j.Input = j.Path
+	}
+	if err := p.stage(ctx, j, p.reader.Name(), func(ctx context.Context) error {
+		return p.reader.Read(ctx, j)
+	}); err != nil {
+		return err
+	}
+
+	j.Stage = "select"
+	j.Sections = nil
+	for _, s := range j.File.Sections {
+		if p.keep(j, s) {
+			j.Sections = append(j.Sections, s)
+		}
+	}
+
+	for _, t := range p.transformers {
+		t := t
+		if err := p.stage(ctx, j, t.Name(), func(ctx context.Context) error {
+			return t.Transform(ctx, j)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := p.stage(ctx, j, p.writer.Name(), func(ctx context.Context) error {
+		if j.inputTee == nil {
+			return p.writer.Write(ctx, j, w)
+		}
+		j.inputTee.Start()
+		if err := p.writer.Write(ctx, j, w); err != nil {
+			return err
+		}
+		if err := j.inputTee.Finish(); err != nil {
+			return fmt.Errorf("failed to tee input: %w", err)
+		}
+		return nil
+	}, attribute.Int("sections", len(j.Sections))); err != nil {
+		return err
+	}
+
+	for _, s := range p.sinks {
+		s := s
+		if err := p.stage(ctx, j, s.Name(), func(ctx context.Context) error {
+			return consume(ctx, j, s)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) keep(j *Job, s *elf.Section) bool {
+	for _, f := range p.filters {
+		if !f.Keep(j, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// stage runs a single stage in its own span.
+func (p *Pipeline) stage(ctx context.Context, j *Job, name string, fn func(ctx context.Context) error, attrs ...attribute.KeyValue) (err error) {
+	j.Stage = name
+	ctx, span := p.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	// Jobs stop between stages once they are canceled.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(ctx)
+}
+
+// consume passes the written output to the sink.
+func consume(ctx context.Context, j *Job, s Sink) error {
+	if j.Output == "" {
+		return errors.New("sinks require the path of the output")
+	}
+	f, err := os.Open(j.Output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := s.Consume(ctx, j, f, fi.Size()); err != nil {
+		return fmt.Errorf("%s: %w", s.Name(), err)
+	}
+	return nil
+}
+
+// FilterFunc returns a filter of the given name that keeps the sections fn keeps.
+func FilterFunc(name string, fn func(j *Job, s *elf.Section) bool) Filter {
+	return filterFunc{name: name, fn: fn}
+}
+
+type filterFunc struct {
+	name string
+	fn   func(j *Job, s *elf.Section) bool
+}
+
+func (f filterFunc) Name() string                     { return f.name }
+func (f filterFunc) Keep(j *Job, s *elf.Section) bool { return f.fn(j, s) }
+
+// TransformerFunc returns a transformer of the given name that runs fn.
+func TransformerFunc(name string, fn func(ctx context.Context, j *Job) error) Transformer {
+	return transformerFunc{name: name, fn: fn}
+}
+
+type transformerFunc struct {
+	name string
+	fn   func(ctx context.Context, j *Job) error
+}
+
+func (t transformerFunc) Name() string                                { return t.name }
+func (t transformerFunc) Transform(ctx context.Context, j *Job) error { return t.fn(ctx, j) }
+
+// WriterFunc returns a writer of the given name that runs fn.
+func WriterFunc(name string, fn func(ctx context.Context, j *Job, w io.WriteSeeker) error) Writer {
+	return writerFunc{name: name, fn: fn}
+}
+
+type writerFunc struct {
+	name string
+	fn   func(ctx context.Context, j *Job, w io.WriteSeeker) error
+}
+
+func (w writerFunc) Name() string { return w.name }
+func (w writerFunc) Write(ctx context.Context, j *Job, out io.WriteSeeker) error {
+	return w.fn(ctx, j, out)
+}
+
+// SinkFunc returns a sink of the given name that runs fn.
+func SinkFunc(name string, fn func(ctx context.Context, j *Job, r io.ReaderAt, size int64) error) Sink {
+	return sinkFunc{name: name, fn: fn}
+}
+
+type sinkFunc struct {
+	name string
+	fn   func(ctx context.Context, j *Job, r io.ReaderAt, size int64) error
+}
+
+func (s sinkFunc) Name() string { return s.name }
+func (s sinkFunc) Consume(ctx context.Context, j *Job, r io.ReaderAt, size int64) error {
+	return s.fn(ctx, j, r, size)
+}
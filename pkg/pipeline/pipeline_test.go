@@ -0,0 +1,478 @@
+package pipeline
+
+import (
+	"context"
+	"debug/elf"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+	"github.com/polarsignals/split-debug/pkg/unwind"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline(t *testing.T) {
+	out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+	require.NoError(t, err)
+
+	var stages []string
+	var consumed int64
+	p := New(
+		WithFilters(
+			DebugSections(),
+			FilterFunc("no-symtab", func(_ *Job, s *elf.Section) bool {
+				return s.Name != ".symtab"
+			}),
+		),
+		WithTransformers(
+			LinkedSections(),
+			TransformerFunc("record", func(_ context.Context, j *Job) error {
+				stages = append(stages, j.Stage)
+				return nil
+			}),
+		),
+		WithSinks(SinkFunc("count", func(_ context.Context, j *Job, r io.ReaderAt, size int64) error {
+			stages = append(stages, j.Stage)
+			f, err := elf.NewFile(r)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			require.NotNil(t, f.Section(".debug_info"))
+			require.Nil(t, f.Section(".symtab"))
+			consumed = size
+			return nil
+		})),
+	)
+
+	j := &Job{Path: "../../dist/split-debug", Output: out.Name()}
+	defer j.Close()
+	require.NoError(t, p.Run(context.Background(), j, out))
+	require.Equal(t, []string{"record", "count"}, stages)
+	require.NotEmpty(t, j.BuildID)
+
+	fi, err := os.Stat(out.Name())
+	require.NoError(t, err)
+	require.Equal(t, fi.Size(), consumed)
+	for _, s := range j.Sections {
+		require.True(t, IsDWARF(s) || IsGoSymbolTable(s) || IsBuildIDNote(s), s.Name)
+	}
+}
+
+func TestPipeline_StageError(t *testing.T) {
+	errStage := errors.New("stage failed")
+	p := New(WithTransformers(TransformerFunc("fail", func(context.Context, *Job) error {
+		return errStage
+	})))
+
+	j := &Job{Path: "../../dist/split-debug"}
+	defer j.Close()
+	out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+	require.NoError(t, err)
+	defer out.Close()
+	require.ErrorIs(t, p.Run(context.Background(), j, out), errStage)
+	require.Equal(t, "fail", j.Stage)
+}
+
+func TestPipeline_Metrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := New(WithFilters(DebugSections()), WithRegisterer(reg))
+	out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+	require.NoError(t, err)
+	defer out.Close()
+
+	j := &Job{Path: "../../dist/split-debug", Output: out.Name()}
+	defer j.Close()
+	require.NoError(t, p.Run(context.Background(), j, out))
+	require.Error(t, p.Run(context.Background(), &Job{Path: "missing"}, out))
+
+	require.Equal(t, 1.0, testutil.ToFloat64(p.metrics.extractions.WithLabelValues("success")))
+	require.Equal(t, 1.0, testutil.ToFloat64(p.metrics.extractions.WithLabelValues("failure")))
+	fi, err := os.Stat(out.Name())
+	require.NoError(t, err)
+	require.Equal(t, float64(fi.Size()), testutil.ToFloat64(p.metrics.bytes))
+}
+
+func TestOpen_RequireDebugInfo(t *testing.T) {
+	// The text section alone carries no debug information.
+	stripped, err := ioutil.TempFile(t.TempDir(), "stripped")
+	require.NoError(t, err)
+	p := New(WithFilters(FilterFunc("text", func(_ *Job, s *elf.Section) bool {
+		return s.Name == ".text"
+	})))
+	j := &Job{Path: "../../dist/split-debug"}
+	require.NoError(t, p.Run(context.Background(), j, stripped))
+	j.Close()
+
+	out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+	require.NoError(t, err)
+	defer out.Close()
+	j = &Job{Path: stripped.Name()}
+	defer j.Close()
+	p = New(WithReader(Open(elfutils.Limits{}, RequireDebugInfo())))
+	require.ErrorIs(t, p.Run(context.Background(), j, out), elfutils.ErrNoDebugInfo)
+	require.Equal(t, "open", j.Stage)
+}
+
+func TestOpen_AdviseKernel(t *testing.T) {
+	write := func(opts ...OpenOption) []byte {
+		out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+		require.NoError(t, err)
+		j := &Job{Path: "../../dist/split-debug"}
+		p := New(WithReader(Open(elfutils.Limits{}, opts...)), WithFilters(DebugSections()))
+		require.NoError(t, p.Run(context.Background(), j, out))
+		require.NoError(t, j.Close())
+		data, err := ioutil.ReadFile(out.Name())
+		require.NoError(t, err)
+		return data
+	}
+	require.Equal(t, write(), write(AdviseKernel()))
+}
+
+func TestSizeBudget(t *testing.T) {
+	p := New(WithFilters(DebugSections()), WithTransformers(LinkedSections(), SizeBudget(1)))
+
+	j := &Job{Path: "../../dist/split-debug"}
+	defer j.Close()
+	out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+	require.NoError(t, err)
+	defer out.Close()
+
+	var budgetErr *BudgetError
+	require.ErrorAs(t, p.Run(context.Background(), j, out), &budgetErr)
+	require.Equal(t, uint64(1), budgetErr.Budget)
+	require.Equal(t, "budget", j.Stage)
+}
+
+func TestSizeBudgetDropped(t *testing.T) {
+	run := func(transformers ...Transformer) *Job {
+		out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+		require.NoError(t, err)
+		defer out.Close()
+		j := &Job{Path: "../../dist/split-debug"}
+		t.Cleanup(func() { j.Close() })
+		p := New(WithFilters(DebugSections()), WithTransformers(append([]Transformer{LinkedSections()}, transformers...)...))
+		require.NoError(t, p.Run(context.Background(), j, out))
+		return j
+	}
+
+	// The budget only fits the sections besides DWARF.
+	all := run()
+	var kept []*elf.Section
+	var dwarf []string
+	for _, s := range all.Sections {
+		if IsDWARF(s) {
+			dwarf = append(dwarf, s.Name)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	require.NotEmpty(t, dwarf)
+	require.Empty(t, all.Dropped)
+
+	j := run(SizeBudget(EstimateSize(&all.File.FileHeader, kept)))
+	require.ElementsMatch(t, dwarf, j.Dropped)
+	require.Len(t, j.Sections, len(kept))
+}
+
+func TestFreeSpace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("free space is checked on Linux")
+	}
+	run := func(min uint64) error {
+		out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+		require.NoError(t, err)
+		defer out.Close()
+		j := &Job{Path: "../../dist/split-debug", Output: out.Name()}
+		defer j.Close()
+		return New(WithFilters(DebugSections()), WithTransformers(FreeSpace(min))).Run(context.Background(), j, out)
+	}
+	require.NoError(t, run(0))
+
+	var spaceErr *SpaceError
+	require.ErrorAs(t, run(1<<62), &spaceErr)
+	require.Greater(t, spaceErr.Needed, uint64(1<<62))
+	require.Less(t, spaceErr.Free, spaceErr.Needed)
+}
+
+func TestEstimate(t *testing.T) {
+	f, err := elfutils.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer f.Close()
+
+	out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+	require.NoError(t, err)
+	j := &Job{Path: "../../dist/split-debug"}
+	defer j.Close()
+	require.NoError(t, New(WithFilters(DebugSections()), WithTransformers(LinkedSections())).Run(context.Background(), j, out))
+	fi, err := os.Stat(out.Name())
+	require.NoError(t, err)
+
+	report, err := Estimate(f, EstimateOptions{})
+	require.NoError(t, err)
+	require.Len(t, report.Sections, len(j.Sections))
+	// Compressed sections are recompressed, usually tighter than by the linker.
+	require.InEpsilon(t, fi.Size(), report.Size, 0.1)
+	require.Equal(t, report.Size, report.Compressed)
+
+	zstd, err := Estimate(f, EstimateOptions{Compression: "zstd"})
+	require.NoError(t, err)
+	xz, err := Estimate(f, EstimateOptions{Compression: "xz"})
+	require.NoError(t, err)
+	require.Equal(t, report.Size, zstd.Size)
+	require.Less(t, zstd.Compressed, zstd.Size)
+	require.Less(t, xz.Compressed, zstd.Compressed)
+
+	symbols, err := Estimate(f, EstimateOptions{Filters: []Filter{FilterFunc("symtab", func(_ *Job, s *elf.Section) bool {
+		return s.Name == ".symtab"
+	})}})
+	require.NoError(t, err)
+	var names []string
+	for _, s := range symbols.Sections {
+		names = append(names, s.Name)
+	}
+	require.Equal(t, []string{".symtab", ".strtab"}, names) // With its linked string table.
+
+	_, err = Estimate(f, EstimateOptions{Compression: "brotli"})
+	require.Error(t, err)
+}
+
+func TestEditDWARF_Redact(t *testing.T) {
+	p := New(
+		WithFilters(DebugSections()),
+		WithTransformers(LinkedSections(), EditDWARF(DWARFEdits{
+			Redact: func(name string) (string, bool) {
+				return "redacted", name == "main.main"
+			},
+		})),
+	)
+
+	j := &Job{Path: "../../dist/split-debug"}
+	defer j.Close()
+	out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+	require.NoError(t, err)
+	require.NoError(t, p.Run(context.Background(), j, out))
+
+	// The rewritten string table is still linked to the symbol table.
+	f, err := elf.Open(out.Name())
+	require.NoError(t, err)
+	defer f.Close()
+	syms, err := f.Symbols()
+	require.NoError(t, err)
+	var names []string
+	for _, s := range syms {
+		names = append(names, s.Name)
+	}
+	require.Contains(t, names, "redacted")
+	require.Contains(t, names, "main.init")
+	require.NotContains(t, names, "main.main")
+}
+
+func TestIsGNUProperty(t *testing.T) {
+	section := func(name string, typ elf.SectionType) *elf.Section {
+		return &elf.Section{SectionHeader: elf.SectionHeader{Name: name, Type: typ}}
+	}
+	require.True(t, IsGNUProperty(section(".note.gnu.property", elf.SHT_NOTE)))
+	require.False(t, IsGNUProperty(section(".note.gnu.build-id", elf.SHT_NOTE)))
+	require.False(t, IsGNUProperty(section(".note.gnu.property", elf.SHT_NOBITS)))
+}
+
+func TestDebugSections_TypeInfo(t *testing.T) {
+	section := func(name string) *elf.Section {
+		return &elf.Section{SectionHeader: elf.SectionHeader{Name: name, Type: elf.SHT_PROGBITS}}
+	}
+	for _, name := range []string{".ctf", ".SUNW_ctf", ".BTF", ".BTF.ext"} {
+		require.False(t, DebugSections().Keep(nil, section(name)), name)
+		require.True(t, DebugSections(IsCTF, IsBTF).Keep(nil, section(name)), name)
+	}
+	require.False(t, DebugSections(IsCTF).Keep(nil, section(".BTF")))
+	require.True(t, DebugSections(IsCTF, IsBTF).Keep(nil, section(".debug_info")))
+	require.False(t, DebugSections(IsCTF, IsBTF).Keep(nil, section(".text")))
+}
+
+func TestDebugSections_BuildID(t *testing.T) {
+	path := buildVersionedLib(t)
+	f, err := elfutils.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	want, err := elfutils.BuildID(f)
+	require.NoError(t, err)
+
+	out := filepath.Join(t.TempDir(), "lib.debug")
+	w, err := os.Create(out)
+	require.NoError(t, err)
+	defer w.Close()
+	p := New(WithFilters(DebugSections()), WithTransformers(LinkedSections()))
+	j := &Job{Path: path, Output: out}
+	defer j.Close()
+	require.NoError(t, p.Run(context.Background(), j, w))
+
+	// GDB skips separate debug files without a build ID note.
+	debug, err := elfutils.Open(out)
+	require.NoError(t, err)
+	defer debug.Close()
+	got, err := elfutils.BuildID(debug)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	require.Equal(t, elf.SHT_NOTE, debug.Section(elfutils.GNUBuildIDSection).Type)
+}
+
+func TestDebugSections_GNUProperty(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("CET fixture requires an x86-64 host")
+	}
+	// The linker only marks the output if all inputs are marked, unless forced.
+	path := elfwritertest.BuildC(t, "int main(void) { return 0; }\n", "-g", "-fcf-protection=full", "-Wl,-z,ibt,-z,shstk")
+
+	out := filepath.Join(t.TempDir(), "prog.debug")
+	w, err := os.Create(out)
+	require.NoError(t, err)
+	defer w.Close()
+	p := New(WithFilters(DebugSections()), WithTransformers(LinkedSections()))
+	j := &Job{Path: path, Output: out}
+	defer j.Close()
+	require.NoError(t, p.Run(context.Background(), j, w))
+
+	debug, err := elfutils.Open(out)
+	require.NoError(t, err)
+	defer debug.Close()
+	require.Equal(t, elf.SHT_NOTE, debug.Section(elfutils.GNUPropertySection).Type)
+	features, err := elfutils.GNUFeatures(debug)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ibt", "shstk"}, features)
+}
+
+func TestPreset(t *testing.T) {
+	section := func(name string) *elf.Section {
+		return &elf.Section{SectionHeader: elf.SectionHeader{Name: name, Type: elf.SHT_PROGBITS}}
+	}
+	for _, tt := range []struct {
+		preset string
+		kept   []string
+	}{
+		{preset: PresetFull, kept: []string{".debug_pubnames", ".debug_pubtypes", ".debug_gdb_scripts"}},
+		{preset: PresetGDB, kept: []string{".debug_gdb_scripts"}},
+		{preset: PresetMinimal},
+		{preset: PresetRust, kept: []string{".debug_pubtypes", ".debug_gdb_scripts"}},
+	} {
+		var kept []string
+		for _, name := range []string{".debug_info", ".debug_pubnames", ".debug_pubtypes", ".debug_gdb_scripts"} {
+			if Preset(tt.preset).Keep(nil, section(name)) && name != ".debug_info" {
+				kept = append(kept, name)
+			}
+		}
+		require.Equal(t, tt.kept, kept, tt.preset)
+		require.True(t, Preset(tt.preset).Keep(nil, section(".debug_info")), tt.preset)
+	}
+}
+
+// buildVersionedLib returns a shared library with version definitions and requirements.
+func buildVersionedLib(t *testing.T) string {
+	t.Helper()
+	return elfwritertest.BuildCFiles(t, map[string]string{
+		"lib.c":   "#include <stdio.h>\nint hello(void) { return puts(\"hello\"); }\n",
+		"lib.map": "LIB_1.0 { global: hello; local: *; };\n",
+	}, "-g", "-shared", "-fPIC", "-Wl,--build-id", "-Wl,--version-script=lib.map")
+}
+
+func TestLinkedSections_SymbolVersions(t *testing.T) {
+	path := buildVersionedLib(t)
+	f, err := elfutils.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	names := func(sections []*elf.Section) []string {
+		var names []string
+		for _, s := range sections {
+			names = append(names, s.Name)
+		}
+		return names
+	}
+	triplet := []string{".dynsym", ".dynstr", ".gnu.version", ".gnu.version_d", ".gnu.version_r"}
+
+	// Selecting any part of the triplet keeps all of it with the symbol table.
+	for _, name := range []string{".dynsym", ".gnu.version", ".gnu.version_d", ".gnu.version_r"} {
+		kept := names(withLinkedSections(f, []*elf.Section{f.Section(name)}))
+		require.Subset(t, kept, triplet, name)
+	}
+	// The string table alone does not pull in the versions of a symbol table that is not kept.
+	require.Equal(t, []string{".dynstr"}, names(withLinkedSections(f, []*elf.Section{f.Section(".dynstr")})))
+
+	out := filepath.Join(t.TempDir(), "lib.debug")
+	w, err := os.Create(out)
+	require.NoError(t, err)
+	defer w.Close()
+	p := New(WithFilters(DebugSections()), WithTransformers(LinkedSections()))
+	j := &Job{Path: path, Output: out}
+	defer j.Close()
+	require.NoError(t, p.Run(context.Background(), j, w))
+
+	debug, err := elfutils.Open(out)
+	require.NoError(t, err)
+	defer debug.Close()
+	want, err := f.DynamicSymbols()
+	require.NoError(t, err)
+	got, err := debug.DynamicSymbols()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	var versioned bool
+	for _, s := range got {
+		versioned = versioned || s.Version == "LIB_1.0"
+	}
+	require.True(t, versioned, "expected symbols of version LIB_1.0")
+
+	for name, link := range map[string]string{
+		".gnu.version":   ".dynsym",
+		".gnu.version_d": ".dynstr",
+		".gnu.version_r": ".dynstr",
+		".dynsym":        ".dynstr",
+	} {
+		s := debug.Section(name)
+		require.NotNil(t, s, name)
+		require.Equal(t, link, debug.Sections[s.Link].Name, name)
+	}
+}
+
+func TestUnwindTable(t *testing.T) {
+	path := buildVersionedLib(t)
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("unwind tables are built for x86-64 and AArch64")
+	}
+
+	for _, section := range []bool{false, true} {
+		out, err := ioutil.TempFile(t.TempDir(), "debuginfo")
+		require.NoError(t, err)
+		p := New(WithFilters(DebugSections()), WithTransformers(UnwindTable(section)))
+		j := &Job{Path: path, Output: out.Name()}
+		require.NoError(t, p.Run(context.Background(), j, out))
+		require.NoError(t, j.Close())
+
+		var table unwind.Table
+		require.NoError(t, table.UnmarshalBinary(j.UnwindTable))
+		require.NotEmpty(t, table.Rows)
+
+		debug, err := elfutils.Open(out.Name())
+		require.NoError(t, err)
+		s := debug.Section(unwind.SectionName)
+		if !section {
+			require.Nil(t, s)
+			debug.Close()
+			continue
+		}
+		require.NotNil(t, s)
+		data, err := s.Data()
+		require.NoError(t, err)
+		require.Equal(t, j.UnwindTable, data)
+		debug.Close()
+	}
+}
@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"context"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+
+	"github.com/go-kit/log/level"
+)
+
+// Open returns the reader that opens the input as an ELF file within the given limits
+// and sets the build ID of the job.
+func Open(limits elfutils.Limits, opts ...OpenOption) Reader {
+	r := &openReader{limits: limits}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// OpenOption configures the reader returned by Open.
+type OpenOption func(r *openReader)
+
+// RequireDebugInfo makes the reader fail for inputs without DWARF or symbol tables, with
+// elfutils.ErrNoDebugInfo or elfutils.ErrAlreadyStripped, instead of logging a warning.
+func RequireDebugInfo() OpenOption {
+	return func(r *openReader) {
+		r.requireDebugInfo = true
+	}
+}
+
+// AdviseKernel makes the reader advise the kernel that the input is read sequentially, and that
+// its pages are not needed in the page cache anymore once the job is closed. Scanning many files
+// then does not evict the page cache of other workloads, at the cost of dropping the pages of the
+// inputs they had cached too. It only has an effect on Linux.
+func AdviseKernel() OpenOption {
+	return func(r *openReader) {
+		r.advise = true
+	}
+}
+
+// TeeInput makes the reader write the contents of the input to w front to back, e.g. to hash it,
+// while the writer of the pipeline reads them, so the input is not read once more for it. The parts
+// of the input that are not written out are read once the writer is done, see
+// iohelper.SequentialTee. The pipeline fails if writing to w fails.
+func TeeInput(w io.Writer) OpenOption {
+	return func(r *openReader) {
+		r.tee = w
+	}
+}
+
+type openReader struct {
+	limits           elfutils.Limits
+	requireDebugInfo bool
+	advise           bool
+	tee              io.Writer
+}
+
+func (r *openReader) Name() string { return "open" }
+
+func (r *openReader) Read(_ context.Context, j *Job) error {
+	f, err := r.open(j)
+	if err != nil {
+		return fmt.Errorf("failed to open given field: %w", err)
+	}
+	j.File = f
+
+	if id, err := elfutils.BuildID(f); err == nil {
+		j.BuildID = id
+	} else if id, err := elfutils.GoBuildID(f); err == nil {
+		j.BuildID = id
+	}
+	logger := j.logger()
+	level.Debug(logger).Log("msg", "opened object file")
+	if err := elfutils.CheckDebugInfo(f); err != nil {
+		if r.requireDebugInfo {
+			return err
+		}
+		level.Warn(logger).Log("msg", "no debug information to extract", "err", err)
+	}
+	return nil
+}
+
+// open opens the input, through a file of its own to advise the kernel about or to tee if it does.
+func (r *openReader) open(j *Job) (*elf.File, error) {
+	if !r.advise && r.tee == nil {
+		return elfutils.OpenWithLimits(j.Input, r.limits)
+	}
+	input, err := os.Open(j.Input)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", j.Input, err)
+	}
+	if r.advise {
+		iohelper.AdviseSequential(input)
+	}
+	if r.tee == nil {
+		f, err := elfutils.NewFileWithLimits(input, r.limits)
+		if err != nil {
+			input.Close()
+			return nil, err
+		}
+		j.input = input
+		return f, nil
+	}
+
+	pool, err := iohelper.NewReaderAtPool(input)
+	if err != nil {
+		input.Close()
+		return nil, fmt.Errorf("error opening %s: %w", j.Input, err)
+	}
+	// Started by the pipeline once the writer runs, the reads of the headers are not written. The
+	// tee fills the gaps with reads of its own, they do not move the offset of the sections.
+	tee := iohelper.NewSequentialTee(pool, pool.Size(), r.tee)
+	f, err := elfutils.NewReaderWithLimits(tee, pool.Size(), input.Name(), r.limits)
+	if err != nil {
+		input.Close()
+		return nil, err
+	}
+	j.input, j.inputTee = input, tee
+	return f, nil
+}
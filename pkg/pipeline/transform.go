@@ -0,0 +1,424 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/dwarfedit"
+	"github.com/polarsignals/split-debug/pkg/elfwriter"
+	"github.com/polarsignals/split-debug/pkg/gdbindex"
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+	"github.com/polarsignals/split-debug/pkg/unwind"
+
+	"github.com/go-kit/log/level"
+)
+
+// LinkedSections adds the sections the selected ones depend on through sh_link,
+// e.g. the string table of a symbol table, and the companions of the kept symbol tables:
+// their hash tables and symbol version tables. The versions of the dynamic symbols, their
+// definitions and requirements are kept together with .dynsym, whichever of them is selected.
+// For relocatable objects, the relocations of the kept sections are added as well,
+// e.g. .rela.debug_info, since their debug information is not relocated yet.
+// The sections stay in the order of the file.
+func LinkedSections() Transformer {
+	return TransformerFunc("link", func(_ context.Context, j *Job) error {
+		j.Sections = withLinkedSections(j.File, j.Sections)
+		return nil
+	})
+}
+
+func withLinkedSections(f *elf.File, sections []*elf.Section) []*elf.Section {
+	keep := make(map[*elf.Section]bool, len(sections))
+	for _, s := range sections {
+		keep[s] = true
+	}
+	section := func(idx uint32) *elf.Section {
+		if idx == 0 || int(idx) >= len(f.Sections) {
+			return nil
+		}
+		return f.Sections[idx]
+	}
+
+	// Companions can depend on sections that are only kept because of other links,
+	// e.g. .gnu.version links to .dynsym, so iterate until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, s := range f.Sections {
+			if keep[s] {
+				for _, d := range []*elf.Section{section(s.Link), versionedSymbols(f, s)} {
+					if d != nil && !keep[d] {
+						keep[d], changed = true, true
+					}
+				}
+				continue
+			}
+			var target *elf.Section
+			switch s.Type {
+			case elf.SHT_HASH, elf.SHT_GNU_HASH, elf.SHT_GNU_VERSYM:
+				target = section(s.Link)
+			case elf.SHT_GNU_VERNEED, elf.SHT_GNU_VERDEF:
+				target = versionedSymbols(f, s)
+			case elf.SHT_REL, elf.SHT_RELA:
+				if f.Type == elf.ET_REL {
+					target = section(s.Info)
+				}
+			}
+			if target != nil && keep[target] {
+				keep[s], changed = true, true
+			}
+		}
+	}
+
+	ordered := make([]*elf.Section, 0, len(keep))
+	for _, s := range f.Sections {
+		if keep[s] {
+			ordered = append(ordered, s)
+		}
+	}
+	return ordered
+}
+
+// versionedSymbols returns the dynamic symbol table of the version definitions or requirements s.
+// They link to its string table rather than to it, but the indexes of .gnu.version refer to them,
+// so the symbol table, its versions and its version definitions and requirements are kept together.
+func versionedSymbols(f *elf.File, s *elf.Section) *elf.Section {
+	if s.Type != elf.SHT_GNU_VERNEED && s.Type != elf.SHT_GNU_VERDEF {
+		return nil
+	}
+	for _, sym := range f.Sections {
+		if sym.Type == elf.SHT_DYNSYM && sym.Link == s.Link {
+			return sym
+		}
+	}
+	return nil
+}
+
+// DWARFEdits are the rewrites of the DWARF applied by EditDWARF.
+type DWARFEdits struct {
+	// KeepUnit selects the compilation units to keep, all of them if nil.
+	KeepUnit func(u dwarfedit.Unit) bool
+	// PrefixMaps remap the prefixes of the source paths.
+	PrefixMaps []dwarfedit.PrefixMap
+	// ClearMacroReferences clears the references of the units to their macro information,
+	// use it with the StripMacros filter.
+	ClearMacroReferences bool
+	// Redact replaces the names of the symbols and DIEs it matches, none if nil.
+	Redact dwarfedit.Redaction
+}
+
+// EditDWARF rewrites the DWARF of the input, the rewritten sections replace the selected ones
+// and the editor is set on the job.
+func EditDWARF(edits DWARFEdits) Transformer {
+	return TransformerFunc("edit", func(_ context.Context, j *Job) error {
+		return editDWARF(j, edits)
+	})
+}
+
+func editDWARF(j *Job, edits DWARFEdits) error {
+	logger := j.logger()
+	editor, err := dwarfedit.NewEditor(j.File)
+	if err != nil {
+		if errors.Is(err, dwarfedit.ErrUnsupported) && edits.KeepUnit == nil && len(edits.PrefixMaps) == 0 && edits.Redact == nil {
+			// Stripping macros only drops their sections then.
+			level.Warn(logger).Log("msg", "cannot clear the references to the stripped macro information", "err", err)
+			return nil
+		}
+		return err
+	}
+	if edits.KeepUnit != nil {
+		if err := editor.FilterUnits(edits.KeepUnit); err != nil {
+			return fmt.Errorf("failed to filter compilation units: %w", err)
+		}
+		res := editor.Result()
+		level.Info(logger).Log(
+			"msg", "dropped compilation units",
+			"units", res.Units,
+			"kept_referenced", res.Referenced,
+		)
+	}
+	if len(edits.PrefixMaps) > 0 {
+		if err := editor.RemapPaths(edits.PrefixMaps); err != nil {
+			return fmt.Errorf("failed to remap paths: %w", err)
+		}
+		res := editor.Result()
+		level.Info(logger).Log("msg", "remapped source paths", "paths", res.Paths)
+		if res.Unmapped > 0 {
+			level.Warn(logger).Log("msg", "paths stored inline in .debug_info cannot be remapped", "paths", res.Unmapped)
+		}
+	}
+	if edits.ClearMacroReferences {
+		if err := editor.ClearMacroReferences(); err != nil {
+			return fmt.Errorf("failed to clear macro references: %w", err)
+		}
+		level.Debug(logger).Log("msg", "cleared macro references", "abbreviations", editor.Result().MacroRefs)
+	}
+
+	if edits.Redact != nil {
+		if err := editor.RedactNames(edits.Redact); err != nil {
+			return fmt.Errorf("failed to redact names: %w", err)
+		}
+		level.Info(logger).Log("msg", "redacted names", "names", editor.Result().Redacted)
+		for _, s := range j.Sections {
+			if IsGoSymbolTable(s) {
+				level.Warn(logger).Log("msg", "the names of the Go symbol tables cannot be redacted", "section", s.Name)
+			}
+		}
+	}
+
+	res := editor.Result()
+	if len(res.Dropped) > 0 {
+		level.Info(logger).Log("msg", "dropped sections that no longer match the DWARF", "dropped", strings.Join(res.Dropped, ","))
+	}
+	dropped := make(map[string]bool, len(res.Dropped))
+	for _, name := range res.Dropped {
+		dropped[name] = true
+	}
+	edited := make([]*elf.Section, 0, len(j.Sections))
+	for _, s := range j.Sections {
+		if dropped[s.Name] {
+			continue
+		}
+		if data, ok := res.Sections[s.Name]; ok {
+			hdr := s.SectionHeader
+			// The rewritten sections are written uncompressed.
+			hdr.Flags &^= elf.SHF_COMPRESSED
+			rewritten, err := elfwriter.NewSection(hdr, data)
+			if err != nil {
+				return err
+			}
+			s = rewritten
+		}
+		edited = append(edited, s)
+	}
+	j.Sections = edited
+	j.Editor = editor
+	return nil
+}
+
+// SpaceError is returned by FreeSpace if the filesystem of the output is short of space.
+type SpaceError struct {
+	Dir    string
+	Free   uint64
+	Needed uint64
+}
+
+func (e *SpaceError) Error() string {
+	return fmt.Sprintf("not enough space in %s: %d bytes free, %d bytes needed", e.Dir, e.Free, e.Needed)
+}
+
+// FreeSpace fails with a SpaceError, before anything is written, if the filesystem of the output
+// has less free space than the estimated size of the output plus min bytes, rather than failing
+// once it is full. It is skipped for jobs without the path of the output, and on platforms where
+// the free space is not known.
+func FreeSpace(min uint64) Transformer {
+	return TransformerFunc("preflight", func(_ context.Context, j *Job) error {
+		if j.Output == "" {
+			return nil
+		}
+		dir := filepath.Dir(j.Output)
+		free, err := iohelper.FreeSpace(dir)
+		if err != nil {
+			level.Debug(j.logger()).Log("msg", "skipped the check of the free space", "err", err)
+			return nil
+		}
+		if needed := EstimateSize(&j.File.FileHeader, j.Sections) + min; free < needed {
+			return &SpaceError{Dir: dir, Free: free, Needed: needed}
+		}
+		return nil
+	})
+}
+
+// BudgetError is returned by SizeBudget if even the symbols exceed the budget.
+type BudgetError struct {
+	Size   uint64
+	Budget uint64
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("symbols only debug information of %d bytes exceeds the size budget of %d bytes", e.Size, e.Budget)
+}
+
+// degradation is a step taken to bring the debug information within the size budget.
+type degradation struct {
+	name string
+	drop func(s *elf.Section) bool
+}
+
+// degradations are applied in order until the debug information fits the size budget.
+// The last step falls back to symbols only.
+var degradations = []degradation{
+	{
+		name: "macro information",
+		drop: isMacroInfo,
+	},
+	{
+		name: "location and range lists",
+		drop: hasName(".debug_loclists", ".debug_rnglists", ".debug_loc", ".debug_ranges"),
+	},
+	{
+		name: "DWARF",
+		drop: IsDWARF,
+	},
+}
+
+// SizeBudget drops sections following the degradation steps until the estimated size
+// of the output is within the given budget in bytes. The dropped sections are recorded
+// in the Dropped of the job.
+func SizeBudget(budget uint64) Transformer {
+	return TransformerFunc("budget", func(_ context.Context, j *Job) error {
+		sections, dropped, err := fitToBudget(&j.File.FileHeader, j.Sections, budget)
+		if err != nil {
+			return err
+		}
+		if len(dropped) > 0 {
+			level.Warn(j.logger()).Log(
+				"msg", "debug information exceeds the size budget, dropped sections",
+				"budget", budget,
+				"dropped", strings.Join(dropped, ","),
+			)
+		}
+		j.Sections = sections
+		j.Dropped = append(j.Dropped, dropped...)
+		return nil
+	})
+}
+
+// fitToBudget returns the remaining sections and the names of the dropped ones.
+func fitToBudget(fhdr *elf.FileHeader, sections []*elf.Section, budget uint64) ([]*elf.Section, []string, error) {
+	var dropped []string
+	for _, d := range degradations {
+		if EstimateSize(fhdr, sections) <= budget {
+			return sections, dropped, nil
+		}
+
+		kept := make([]*elf.Section, 0, len(sections))
+		for _, s := range sections {
+			if d.drop(s) {
+				dropped = append(dropped, s.Name)
+				continue
+			}
+			kept = append(kept, s)
+		}
+		sections = kept
+	}
+
+	if size := EstimateSize(fhdr, sections); size > budget {
+		return nil, dropped, &BudgetError{Size: size, Budget: budget}
+	}
+	return sections, dropped, nil
+}
+
+// EstimateSize returns the approximate size of an ELF file with the given sections.
+func EstimateSize(fhdr *elf.FileHeader, sections []*elf.Section) uint64 {
+	var ehsize, shentsize uint64 = 64, 64
+	if fhdr.Class == elf.ELFCLASS32 {
+		ehsize, shentsize = 52, 40
+	}
+
+	// SHT_NULL and .shstrtab are added by the writer.
+	size := ehsize + shentsize*uint64(len(sections)+2)
+	shstrtab := uint64(len(".shstrtab") + 2)
+	for _, s := range sections {
+		shstrtab += uint64(len(s.Name) + 1)
+		if s.Type != elf.SHT_NOBITS {
+			size += s.FileSize
+		}
+	}
+	return size + shstrtab
+}
+
+// GDBIndex adds a .gdb_index section for the selected debug information,
+// built from the rewritten DWARF if the job has an editor. Nothing is added if .debug_info is not kept.
+func GDBIndex() Transformer {
+	return TransformerFunc("index", func(_ context.Context, j *Job) error {
+		index, err := gdbIndexSection(j)
+		if err != nil {
+			return fmt.Errorf("failed to build %s: %w", gdbindex.SectionName, err)
+		}
+		if index != nil {
+			j.Sections = append(j.Sections, index)
+		}
+		return nil
+	})
+}
+
+func gdbIndexSection(j *Job) (*elf.Section, error) {
+	var kept bool
+	for _, s := range j.Sections {
+		kept = kept || s.Name == ".debug_info"
+	}
+	if !kept {
+		return nil, nil
+	}
+	var data []byte
+	var err error
+	if j.Editor != nil {
+		var d *dwarf.Data
+		if d, err = j.Editor.DWARF(); err != nil {
+			return nil, err
+		}
+		var info []byte
+		if info, err = j.Editor.Section(".debug_info"); err != nil {
+			return nil, err
+		}
+		data, err = gdbindex.BuildDWARF(d, bytes.NewReader(info), j.File.ByteOrder)
+	} else {
+		data, err = gdbindex.Build(j.File)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return elfwriter.NewSection(elf.SectionHeader{
+		Name:      gdbindex.SectionName,
+		Type:      elf.SHT_PROGBITS,
+		Addralign: 1,
+	}, data)
+}
+
+// UnwindTable builds the compact unwind table of the input from the call frame information of
+// its .eh_frame and sets it on the job, with section it is also added as a section. Inputs of
+// unsupported machines and without FDEs, e.g. Go binaries, get none.
+func UnwindTable(section bool) Transformer {
+	return TransformerFunc("unwind", func(_ context.Context, j *Job) error {
+		logger := j.logger()
+		t, err := unwind.Build(j.File)
+		if errors.Is(err, unwind.ErrUnsupportedMachine) {
+			level.Warn(logger).Log("msg", "skipped the unwind table", "err", err)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to build unwind table: %w", err)
+		}
+		if len(t.Rows) == 0 {
+			level.Debug(logger).Log("msg", "no call frame information to build the unwind table from")
+			return nil
+		}
+		if t.Skipped > 0 {
+			level.Warn(logger).Log("msg", "functions the unwind table cannot describe are left out of it", "functions", t.Skipped)
+		}
+		data, err := t.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		j.UnwindTable = data
+		if !section {
+			return nil
+		}
+		s, err := elfwriter.NewSection(elf.SectionHeader{
+			Name:      unwind.SectionName,
+			Type:      elf.SHT_PROGBITS,
+			Addralign: 8,
+		}, data)
+		if err != nil {
+			return err
+		}
+		j.Sections = append(j.Sections, s)
+		return nil
+	})
+}
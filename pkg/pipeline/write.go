@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"context"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter"
+)
+
+// writers are reused across jobs, so their buffers are not allocated again for each file,
+// e.g. when scanning the binaries of a node.
+var writers = sync.Pool{New: func() interface{} { return new(elfwriter.Writer) }}
+
+// ELF returns the writer that writes the selected sections as an ELF file
+// with the header of the input. Compressed sections are recompressed, so this includes compression.
+// The writer closes w if it is an io.Closer. The options are passed on to the ELF writer.
+func ELF(opts ...elfwriter.Option) Writer {
+	return WriterFunc("write", func(ctx context.Context, j *Job, w io.WriteSeeker) error {
+		opts := append([]elfwriter.Option{elfwriter.WithSourceSections(sourceSections(j))}, opts...)
+		// The sections written as they are are copied in the kernel when possible. The file
+		// the input was opened from is not exposed by debug/elf, it is opened again.
+		if src, err := os.Open(j.Input); err == nil {
+			defer src.Close()
+			opts = append(opts, elfwriter.WithSourceFile(src, j.File))
+		}
+
+		ew := writers.Get().(*elfwriter.Writer)
+		defer writers.Put(ew)
+		if err := ew.Reset(w, &j.File.FileHeader, opts...); err != nil {
+			return fmt.Errorf("failed to initialize writer: %w", err)
+		}
+		ew.Sections = j.Sections
+
+		if err := ew.WriteContext(ctx); err != nil {
+			return fmt.Errorf("failed to write: %w", err)
+		}
+		if err := ew.Close(); err != nil {
+			return fmt.Errorf("failed to close writer: %w", err)
+		}
+		return nil
+	})
+}
+
+// sourceSections returns the sections of the input with the rewritten sections of the job in place
+// of the ones they replace, so the links to them and of them are kept.
+func sourceSections(j *Job) []*elf.Section {
+	selected := make(map[*elf.Section]bool, len(j.Sections))
+	byName := make(map[string]*elf.Section, len(j.Sections))
+	for _, s := range j.Sections {
+		selected[s] = true
+		byName[s.Name] = s
+	}
+	sections := make([]*elf.Section, len(j.File.Sections))
+	for i, s := range j.File.Sections {
+		sections[i] = s
+		if r, ok := byName[s.Name]; ok && !selected[s] {
+			sections[i] = r
+		}
+	}
+	return sections
+}
@@ -0,0 +1,196 @@
+// Package policy checks the debug information before it leaves the host, e.g. is uploaded, against
+// rules denying symbol names and source paths, such as the names of customers or paths below
+// /secret/, so debug files leaking them fail instead.
+package policy
+
+import (
+	"context"
+	"debug/dwarf"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+)
+
+const (
+	// dwAttrLinkageName is DW_AT_linkage_name, debug/dwarf does not name it.
+	dwAttrLinkageName dwarf.Attr = 0x6e
+	// dwAttrMIPSLinkageName is DW_AT_MIPS_linkage_name, the name GCC used before DWARF 4.
+	dwAttrMIPSLinkageName dwarf.Attr = 0x2007
+)
+
+// maxViolations is the number of violations a ViolationError lists, the others are counted.
+const maxViolations = 20
+
+// Kinds of the values violating the rules.
+const (
+	KindSymbol     = "symbol"
+	KindSourcePath = "source path"
+)
+
+// Rules are the symbol names and source paths the debug information must not contain.
+type Rules struct {
+	// Symbols are matched against the names of the symbols of the symbol tables and the names and
+	// linkage names of the DWARF entries, e.g. of functions, variables and types.
+	Symbols []*regexp.Regexp
+	// SourcePaths are matched against the paths of the DWARF compilation units and of the files of
+	// their line programs.
+	SourcePaths []*regexp.Regexp
+	// Denylist are strings the symbol names and source paths must not contain, e.g. the names of
+	// customers.
+	Denylist []string
+}
+
+// Empty reports whether the rules deny nothing.
+func (r Rules) Empty() bool {
+	return len(r.Symbols) == 0 && len(r.SourcePaths) == 0 && len(r.Denylist) == 0
+}
+
+// Violation is a symbol name or source path denied by a rule.
+type Violation struct {
+	// Kind is KindSymbol or KindSourcePath.
+	Kind  string
+	Value string
+	// Rule is the pattern or the string of the denylist it matched.
+	Rule string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s %q matches %q", v.Kind, v.Value, v.Rule)
+}
+
+// ViolationError is returned for debug information violating the rules.
+type ViolationError struct {
+	// Violations are the first violations found, each value once.
+	Violations []Violation
+	// Total is the number of values violating the rules.
+	Total int
+}
+
+func (e *ViolationError) Error() string {
+	msg := "policy violation: " + e.Violations[0].String()
+	if e.Total > 1 {
+		msg += fmt.Sprintf(" and %d more", e.Total-1)
+	}
+	return msg
+}
+
+// Check returns a *ViolationError if the symbol names or source paths of f violate the rules.
+func (r Rules) Check(f *elf.File) error {
+	c := &checker{rules: r, seen: map[string]bool{}}
+	for _, symbols := range []func() ([]elf.Symbol, error){f.Symbols, f.DynamicSymbols} {
+		syms, err := symbols()
+		if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+			return fmt.Errorf("failed to read symbols: %w", err)
+		}
+		for _, s := range syms {
+			c.check(KindSymbol, s.Name)
+		}
+	}
+	if d, err := f.DWARF(); err == nil {
+		if err := c.checkDWARF(d); err != nil {
+			return fmt.Errorf("failed to read DWARF: %w", err)
+		}
+	}
+	if c.err.Total == 0 {
+		return nil
+	}
+	return &c.err
+}
+
+// Sink returns the pipeline sink that fails the jobs whose written output violates the rules. It
+// goes before the sinks the output must not reach then, e.g. the upload.
+func Sink(r Rules) pipeline.Sink {
+	return pipeline.SinkFunc("policy", func(_ context.Context, _ *pipeline.Job, ra io.ReaderAt, size int64) error {
+		f, err := elf.NewFile(io.NewSectionReader(ra, 0, size))
+		if err != nil {
+			return fmt.Errorf("failed to read output: %w", err)
+		}
+		defer f.Close()
+		return r.Check(f)
+	})
+}
+
+type checker struct {
+	rules Rules
+	// seen are the checked values by kind, values are checked once.
+	seen map[string]bool
+	err  ViolationError
+}
+
+func (c *checker) checkDWARF(d *dwarf.Data) error {
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return nil
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			for _, f := range e.Field {
+				if name, ok := f.Val.(string); ok && (f.Attr == dwarf.AttrName || f.Attr == dwAttrLinkageName || f.Attr == dwAttrMIPSLinkageName) {
+					c.check(KindSymbol, name)
+				}
+			}
+			continue
+		}
+		name, _ := e.Val(dwarf.AttrName).(string)
+		if dir, _ := e.Val(dwarf.AttrCompDir).(string); dir != "" && name != "" && !path.IsAbs(name) {
+			name = path.Join(dir, name)
+		}
+		c.check(KindSourcePath, name)
+		lr, err := d.LineReader(e)
+		if err != nil {
+			return err
+		}
+		if lr == nil {
+			continue
+		}
+		for _, file := range lr.Files() {
+			if file != nil {
+				c.check(KindSourcePath, file.Name)
+			}
+		}
+	}
+}
+
+// check records a violation if the value of the kind matches a rule.
+func (c *checker) check(kind, value string) {
+	if value == "" || c.seen[kind+"\x00"+value] {
+		return
+	}
+	c.seen[kind+"\x00"+value] = true
+	patterns := c.rules.Symbols
+	if kind == KindSourcePath {
+		patterns = c.rules.SourcePaths
+	}
+	rule, ok := "", false
+	for _, re := range patterns {
+		if re.MatchString(value) {
+			rule, ok = re.String(), true
+			break
+		}
+	}
+	for _, s := range c.rules.Denylist {
+		if ok {
+			break
+		}
+		if strings.Contains(value, s) {
+			rule, ok = s, true
+		}
+	}
+	if !ok {
+		return
+	}
+	c.err.Total++
+	if len(c.err.Violations) < maxViolations {
+		c.err.Violations = append(c.err.Violations, Violation{Kind: kind, Value: value, Rule: rule})
+	}
+}
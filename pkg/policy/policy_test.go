@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"debug/elf"
+	"regexp"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	prog := elfwritertest.BuildCFiles(t, map[string]string{
+		"main.c":           "int acme_billing(int);\nint main(void) { return acme_billing(1); }\n",
+		"secret/billing.c": "struct acme_invoice { int total; };\nint acme_billing(int v) { struct acme_invoice i = {v}; return i.total; }\n",
+	}, "-g", "-O0")
+	f, err := elf.Open(prog)
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, Rules{}.Check(f))
+	require.NoError(t, Rules{Symbols: []*regexp.Regexp{regexp.MustCompile(`^globex_`)}, Denylist: []string{"initech"}}.Check(f))
+
+	err = Rules{SourcePaths: []*regexp.Regexp{regexp.MustCompile(`/secret/`)}}.Check(f)
+	var verr *ViolationError
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, 1, verr.Total)
+	require.Equal(t, KindSourcePath, verr.Violations[0].Kind)
+	require.Regexp(t, `^policy violation: source path ".*/secret/billing.c" matches "/secret/"$`, err.Error())
+
+	// The function and the type are named in the DWARF, the function in .symtab as well.
+	err = Rules{Denylist: []string{"acme"}}.Check(f)
+	require.ErrorAs(t, err, &verr)
+	var symbols []string
+	for _, v := range verr.Violations {
+		require.Equal(t, KindSymbol, v.Kind)
+		require.Equal(t, "acme", v.Rule)
+		symbols = append(symbols, v.Value)
+	}
+	require.ElementsMatch(t, []string{"acme_billing", "acme_invoice"}, symbols)
+	require.Contains(t, err.Error(), " and 1 more")
+}
@@ -0,0 +1,104 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Client calls the remote extraction service.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a client of the service served on cc.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// Extract streams the object file read from r to the service and writes its debug information to w.
+// It returns the build ID of the object file, if it has one.
+func (c *Client) Extract(ctx context.Context, r io.Reader, w io.Writer) (string, error) {
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], "/"+ServiceName+"/Extract")
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := stream.SendMsg(wrapperspb.Bytes(buf[:n])); err != nil {
+				if errors.Is(err, io.EOF) {
+					// The service failed, the reason is returned by receiving.
+					break
+				}
+				return "", err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return "", err
+	}
+
+	header, err := stream.Header()
+	if err != nil {
+		return "", err
+	}
+	if err := receive(stream, w); err != nil {
+		return "", err
+	}
+	var buildID string
+	if v := header.Get(BuildIDHeader); len(v) > 0 {
+		buildID = v[0]
+	}
+	return buildID, nil
+}
+
+// Exists reports whether the service stores the debug file of the build ID.
+func (c *Client) Exists(ctx context.Context, buildID string) (bool, error) {
+	out := new(wrapperspb.BoolValue)
+	if err := c.cc.Invoke(ctx, "/"+ServiceName+"/Exists", wrapperspb.String(buildID), out); err != nil {
+		return false, err
+	}
+	return out.Value, nil
+}
+
+// Download writes the stored debug file of the build ID to w.
+func (c *Client) Download(ctx context.Context, buildID string, w io.Writer) error {
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[1], "/"+ServiceName+"/Download")
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(wrapperspb.String(buildID)); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	return receive(stream, w)
+}
+
+func receive(stream grpc.ClientStream, w io.Writer) error {
+	for {
+		chunk := new(wrapperspb.BytesValue)
+		if err := stream.RecvMsg(chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if _, err := w.Write(chunk.Value); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BuildIDHTTPHeader is the header the HTTP API sends the build ID of the input in.
+const BuildIDHTTPHeader = "X-Build-ID"
+
+// multipartOverhead is the allowance for the parts of a multipart form besides the file.
+const multipartOverhead = 1 << 20
+
+// Receipt is the response to an upload with ?receipt=true.
+type Receipt struct {
+	BuildID string `json:"build_id,omitempty"`
+	Size    int64  `json:"size"`
+	// Stored reports whether the debug file is stored, only those of inputs with a GNU build ID are.
+	Stored bool `json:"stored"`
+}
+
+// Handler returns the HTTP API of the server, for build systems that cannot speak gRPC:
+//
+//	POST /v1/extract       uploads the object file as the file field of a multipart form, or as the body,
+//	                       and responds with its debug file, or with a JSON Receipt with ?receipt=true.
+//	GET  /v1/debuginfo/ID  downloads the stored debug file of the build ID, HEAD checks that it exists.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/extract", s.handleExtract)
+	mux.HandleFunc("/v1/debuginfo/", s.handleDebugInfo)
+	return s.requireToken(mux)
+}
+
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, err := s.token()
+		if err != nil {
+			level.Error(s.logger).Log("msg", "failed to get token", "err", err)
+			http.Error(w, "failed to authenticate", http.StatusServiceUnavailable)
+			return
+		}
+		if !validToken(r.Header.Get("Authorization"), token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.maxInputSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxInputSize+multipartOverhead)
+	}
+
+	src, err := uploadedFile(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	input, err := s.receive(src)
+	if err != nil {
+		level.Error(s.logger).Log("msg", "failed to receive input", "err", err)
+		writeError(w, err)
+		return
+	}
+	defer os.Remove(input)
+
+	e, err := s.run(r.Context(), input)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer e.close()
+
+	if r.URL.Query().Get("receipt") == "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Receipt{BuildID: e.buildID, Size: e.size, Stored: e.stored})
+		return
+	}
+	f, err := os.Open(e.path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+
+	name := "debuginfo"
+	if e.buildID != "" {
+		name = e.buildID + ".debug"
+		w.Header().Set(BuildIDHTTPHeader, e.buildID)
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("Content-Length", fmt.Sprint(e.size))
+	io.Copy(w, f)
+}
+
+// uploadedFile returns the file field of a multipart form, or the body otherwise.
+func uploadedFile(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("missing file field")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+func (s *Server) handleDebugInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/debuginfo/")
+	if err := validBuildID(id); err != nil {
+		writeError(w, err)
+		return
+	}
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "debug file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, id+".debug", fi.ModTime(), f)
+}
+
+// writeError responds with the HTTP status of the gRPC code the error maps to.
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(statusOf(err))
+	http.Error(w, st.Message(), httpStatus(st.Code()))
+}
+
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusRequestEntityTooLarge
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.Canceled:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,184 @@
+package remote
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHTTPServer(t *testing.T, opts ...Option) *httptest.Server {
+	t.Helper()
+	p := pipeline.New(
+		pipeline.WithFilters(pipeline.DebugSections()),
+		pipeline.WithTransformers(pipeline.LinkedSections()),
+	)
+	srv := httptest.NewServer(NewServer(log.NewNopLogger(), p, t.TempDir(), opts...).Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// multipartUpload returns a multipart form with the file at path as its file field.
+func multipartUpload(t *testing.T, path string) (io.Reader, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "split-debug")
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	_, err = fw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	return &body, mw.FormDataContentType()
+}
+
+func TestHandler(t *testing.T) {
+	srv := newTestHTTPServer(t, WithToken("secret"))
+
+	do := func(method, url, contentType string, body io.Reader) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+url, body)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	body, contentType := multipartUpload(t, "../../dist/split-debug")
+	resp := do(http.MethodPost, "/v1/extract", contentType, body)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	buildID := resp.Header.Get(BuildIDHTTPHeader)
+	require.NotEmpty(t, buildID)
+	debugFile, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	f, err := elf.NewFile(bytes.NewReader(debugFile))
+	require.NoError(t, err)
+	require.NotNil(t, f.Section(".debug_info"))
+
+	in, err := os.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer in.Close()
+	resp = do(http.MethodPost, "/v1/extract?receipt=true", "application/octet-stream", in)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var receipt Receipt
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&receipt))
+	require.Equal(t, Receipt{BuildID: buildID, Size: int64(len(debugFile)), Stored: true}, receipt)
+
+	resp = do(http.MethodGet, "/v1/debuginfo/"+buildID, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	downloaded, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, debugFile, downloaded)
+
+	resp = do(http.MethodHead, "/v1/debuginfo/"+strings.Repeat("0", 40), "", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = do(http.MethodGet, "/v1/debuginfo/not-hex", "", nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = do(http.MethodPost, "/v1/extract", "application/octet-stream", strings.NewReader("not an ELF file"))
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = do(http.MethodGet, "/v1/extract", "", nil)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/v1/debuginfo/" + buildID)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// buildGoWithoutGNUBuildID builds a Go program that only has a Go build ID, which contains slashes.
+func buildGoWithoutGNUBuildID(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building fixtures is skipped in short mode")
+	}
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	out := filepath.Join(dir, "prog")
+	cmd := exec.Command("go", "build", "-ldflags=-B none", "-o", out, "main.go")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS=linux", "CGO_ENABLED=0", "GO111MODULE=off")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build Go fixture: %v\n%s", err, b)
+	}
+	return out
+}
+
+func TestHandler_GoBuildID(t *testing.T) {
+	dir := t.TempDir()
+	p := pipeline.New(
+		pipeline.WithFilters(pipeline.DebugSections()),
+		pipeline.WithTransformers(pipeline.LinkedSections()),
+	)
+	srv := httptest.NewServer(NewServer(log.NewNopLogger(), p, dir).Handler())
+	t.Cleanup(srv.Close)
+
+	in, err := os.Open(buildGoWithoutGNUBuildID(t))
+	require.NoError(t, err)
+	defer in.Close()
+	resp, err := http.Post(srv.URL+"/v1/extract?receipt=true", "application/octet-stream", in)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The debug file is extracted but not stored, the Go build ID is not a valid key.
+	var receipt Receipt
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&receipt))
+	require.Contains(t, receipt.BuildID, "/")
+	require.NotZero(t, receipt.Size)
+	require.False(t, receipt.Stored)
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestHandler_MaxInputSize(t *testing.T) {
+	srv := newTestHTTPServer(t, WithMaxInputSize(1024))
+
+	body, contentType := multipartUpload(t, "../../dist/split-debug")
+	resp, err := http.Post(srv.URL+"/v1/extract", contentType, body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestHandler_TokenSource(t *testing.T) {
+	token := "old"
+	srv := newTestHTTPServer(t, WithTokenSource(func() (string, error) { return token, nil }))
+
+	status := func(auth string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodHead, srv.URL+"/v1/debuginfo/abcd", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", auth)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusNotFound, status("Bearer old"))
+
+	// Rotated tokens are required from the next request on.
+	token = "new"
+	require.Equal(t, http.StatusUnauthorized, status("Bearer old"))
+	require.Equal(t, http.StatusNotFound, status("Bearer new"))
+}
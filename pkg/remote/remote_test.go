@@ -0,0 +1,122 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, opts ...Option) *Client {
+	t.Helper()
+	p := pipeline.New(
+		pipeline.WithFilters(pipeline.DebugSections()),
+		pipeline.WithTransformers(pipeline.LinkedSections()),
+	)
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer()
+	NewServer(log.NewNopLogger(), p, t.TempDir(), opts...).Register(g)
+	go g.Serve(lis)
+	t.Cleanup(g.Stop)
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+	return NewClient(cc)
+}
+
+func TestExtract(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	in, err := os.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer in.Close()
+
+	var out bytes.Buffer
+	buildID, err := c.Extract(ctx, in, &out)
+	require.NoError(t, err)
+	require.NotEmpty(t, buildID)
+
+	f, err := elf.NewFile(bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	require.NotNil(t, f.Section(".debug_info"))
+	require.Nil(t, f.Section(".text"))
+
+	exists, err := c.Exists(ctx, buildID)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	var downloaded bytes.Buffer
+	require.NoError(t, c.Download(ctx, buildID, &downloaded))
+	require.Equal(t, out.Bytes(), downloaded.Bytes())
+
+	exists, err = c.Exists(ctx, strings.Repeat("0", 40))
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	err = c.Download(ctx, strings.Repeat("0", 40), &downloaded)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = c.Exists(ctx, "../../etc/passwd")
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestExtract_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := newTestClient(t).Extract(ctx, strings.NewReader("not an ELF file"), &bytes.Buffer{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	in, err := os.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer in.Close()
+	_, err = newTestClient(t, WithMaxInputSize(1024)).Extract(ctx, in, &bytes.Buffer{})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestExtract_SameBuildID(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	data, err := ioutil.ReadFile("../../dist/split-debug")
+	require.NoError(t, err)
+	var first bytes.Buffer
+	buildID, err := c.Extract(ctx, bytes.NewReader(data), &first)
+	require.NoError(t, err)
+
+	// Extracting the same input again keeps the stored debug file.
+	_, err = c.Extract(ctx, bytes.NewReader(data), &bytes.Buffer{})
+	require.NoError(t, err)
+
+	// Another input with the same build ID, its symbol table differs.
+	f, err := elf.NewFile(bytes.NewReader(data))
+	require.NoError(t, err)
+	symtab := f.Section(".symtab")
+	require.NotNil(t, symtab)
+	other := append([]byte(nil), data...)
+	other[symtab.Offset+symtab.Entsize+8] ^= 0xff
+	_, err = c.Extract(ctx, bytes.NewReader(other), &bytes.Buffer{})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	var downloaded bytes.Buffer
+	require.NoError(t, c.Download(ctx, buildID, &downloaded))
+	require.Equal(t, first.Bytes(), downloaded.Bytes())
+}
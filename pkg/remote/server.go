@@ -0,0 +1,475 @@
+// Package remote serves the extraction of debug information over gRPC and HTTP,
+// so clients offload the extraction of huge binaries to a shared service.
+//
+// The service streams the object file in and the debug file out in chunks of
+// google.protobuf.BytesValue, so it needs no generated code:
+//
+//	service SplitDebug {
+//	  rpc Extract(stream google.protobuf.BytesValue) returns (stream google.protobuf.BytesValue);
+//	  rpc Exists(google.protobuf.StringValue) returns (google.protobuf.BoolValue);
+//	  rpc Download(google.protobuf.StringValue) returns (stream google.protobuf.BytesValue);
+//	}
+//
+// Extract sends the build ID of the input in the build-id header. Debug files of inputs
+// with a build ID are stored, Exists and Download query them by build ID. The first debug
+// file stored for a build ID is kept, extractions of another one fail with AlreadyExists.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "splitdebug.v1.SplitDebug"
+
+// BuildIDHeader is the header Extract sends the build ID of the input in.
+const BuildIDHeader = "build-id"
+
+// chunkSize is the size of the streamed chunks, well below the default message size limit of 4MiB.
+const chunkSize = 1 << 20
+
+// Server extracts the debug information of the streamed object files with a pipeline.
+type Server struct {
+	logger       log.Logger
+	pipeline     *pipeline.Pipeline
+	dir          string
+	maxInputSize int64
+	// token returns the bearer token clients must authenticate with, nil if they need not.
+	token func() (string, error)
+}
+
+type Option func(s *Server)
+
+// WithMaxInputSize rejects inputs larger than n bytes, before they are fully received.
+func WithMaxInputSize(n int64) Option {
+	return func(s *Server) {
+		s.maxInputSize = n
+	}
+}
+
+// WithToken requires clients to authenticate with the bearer token.
+func WithToken(token string) Option {
+	return func(s *Server) {
+		if token != "" {
+			s.token = func() (string, error) { return token, nil }
+		}
+	}
+}
+
+// WithTokenSource requires clients to authenticate with the bearer token returned by token for
+// each request, e.g. the token of a file that is rotated.
+func WithTokenSource(token func() (string, error)) Option {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// NewServer returns a server that runs p for each extraction and keeps the inputs,
+// the outputs and the stored debug files in dir.
+func NewServer(logger log.Logger, p *pipeline.Pipeline, dir string, opts ...Option) *Server {
+	s := &Server{logger: logger, pipeline: p, dir: dir}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register registers the service on g.
+func (s *Server) Register(g *grpc.Server) {
+	g.RegisterService(&serviceDesc, s)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Exists", Handler: existsHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Extract",
+			Handler:       func(srv interface{}, stream grpc.ServerStream) error { return srv.(*Server).extract(stream) },
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Download",
+			Handler:       downloadHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+func existsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*Server).exists(ctx, req.(*wrapperspb.StringValue))
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Exists"}, handler)
+}
+
+func downloadHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(wrapperspb.StringValue)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(*Server).download(in, stream)
+}
+
+// extract receives the object file, extracts its debug information and streams it back.
+func (s *Server) extract(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	if err := s.authorize(ctx); err != nil {
+		return err
+	}
+	input, err := s.receive(&streamReader{stream: stream})
+	if err != nil {
+		level.Error(s.logger).Log("msg", "failed to receive input", "err", err)
+		return statusOf(err)
+	}
+	defer os.Remove(input)
+
+	e, err := s.run(ctx, input)
+	if err != nil {
+		return statusOf(err)
+	}
+	defer e.close()
+	if err := stream.SetHeader(metadata.Pairs(BuildIDHeader, e.buildID)); err != nil {
+		return err
+	}
+	return sendFile(stream, e.path)
+}
+
+// extraction is the debug file extracted from an input.
+type extraction struct {
+	buildID string
+	path    string
+	size    int64
+	// stored reports whether the debug file is stored by build ID, otherwise it is removed on close.
+	stored bool
+}
+
+func (e *extraction) close() {
+	if !e.stored {
+		os.Remove(e.path)
+	}
+}
+
+// run extracts the debug information of the object file at input.
+// The debug files of inputs with a GNU build ID are stored.
+func (s *Server) run(ctx context.Context, input string) (_ *extraction, err error) {
+	job := &pipeline.Job{Path: "stream", Input: input}
+	logger := log.With(s.logger,
+		"build_id", log.Valuer(func() interface{} { return job.BuildID }),
+		"phase", log.Valuer(func() interface{} { return job.Stage }),
+	)
+	job.Logger = logger
+	defer func() {
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to extract debug information", "err", err)
+		}
+	}()
+
+	output, err := ioutil.TempFile(s.dir, "output-*.debuginfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	// The writer closes the output, closing it again is harmless.
+	defer output.Close()
+	defer job.Close()
+
+	e := &extraction{path: output.Name()}
+	job.Output = output.Name()
+	if err := s.pipeline.Run(ctx, job, output); err != nil {
+		e.close()
+		return nil, err
+	}
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		e.close()
+		return nil, err
+	}
+	e.buildID, e.size = job.BuildID, fi.Size()
+
+	if s.storable(input, job.BuildID) {
+		job.Stage = "store"
+		err := s.store(e.path, job.BuildID)
+		e.close()
+		if err != nil {
+			return nil, err
+		}
+		e.path, e.stored = s.path(job.BuildID), true
+	}
+	level.Info(logger).Log("msg", "debug information extracted")
+	return e, nil
+}
+
+// store links the debug file at path into the store by the build ID. Stored debug files are never
+// replaced, so no upload overwrites the debug file of another input with the same build ID: the
+// stored one is kept if it has the same contents, and the upload fails otherwise. The link is
+// created once the debug file is complete, concurrent downloads never see a partial one.
+func (s *Server) store(path, buildID string) error {
+	dest := s.path(buildID)
+	err := os.Link(path, dest)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("failed to store debug file: %w", err)
+	}
+	same, err := sameContents(path, dest)
+	if err != nil {
+		return fmt.Errorf("failed to compare with the stored debug file: %w", err)
+	}
+	if !same {
+		return status.Errorf(codes.AlreadyExists, "another debug file is stored for build ID %s", buildID)
+	}
+	return nil
+}
+
+// sameContents reports whether the files at a and b have the same contents.
+func sameContents(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA, bufB := make([]byte, 32<<10), make([]byte, 32<<10)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// storable reports whether the debug file of the input is stored by the build ID: only GNU build
+// IDs are. Go build IDs contain slashes and could pass for the GNU build ID of another file.
+func (s *Server) storable(input, buildID string) bool {
+	if buildID == "" || validBuildID(buildID) != nil {
+		return false
+	}
+	f, err := elfutils.Open(input)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	id, err := elfutils.BuildID(f)
+	return err == nil && id == buildID
+}
+
+// receive spills the object file read from r to disk, ELF processing needs random access.
+// Inputs larger than the maximum input size fail with elfutils.ErrLimitExceeded.
+func (s *Server) receive(r io.Reader) (string, error) {
+	f, err := ioutil.TempFile(s.dir, "input-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create input file: %w", err)
+	}
+	if s.maxInputSize > 0 {
+		r = io.LimitReader(r, s.maxInputSize+1)
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && s.maxInputSize > 0 && n > s.maxInputSize {
+		err = fmt.Errorf("%w: input exceeds %d bytes", elfutils.ErrLimitExceeded, s.maxInputSize)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// streamReader reads the chunks of a client stream.
+type streamReader struct {
+	stream grpc.ServerStream
+	buf    []byte
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk := new(wrapperspb.BytesValue)
+		if err := r.stream.RecvMsg(chunk); err != nil {
+			return 0, err
+		}
+		r.buf = chunk.Value
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// exists reports whether the debug file of the build ID is stored.
+func (s *Server) exists(ctx context.Context, in *wrapperspb.StringValue) (*wrapperspb.BoolValue, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if err := validBuildID(in.Value); err != nil {
+		return nil, err
+	}
+	_, err := os.Stat(s.path(in.Value))
+	if errors.Is(err, os.ErrNotExist) {
+		return wrapperspb.Bool(false), nil
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to stat debug file: %v", err)
+	}
+	return wrapperspb.Bool(true), nil
+}
+
+// download streams the stored debug file of the build ID.
+func (s *Server) download(in *wrapperspb.StringValue, stream grpc.ServerStream) error {
+	if err := s.authorize(stream.Context()); err != nil {
+		return err
+	}
+	if err := validBuildID(in.Value); err != nil {
+		return err
+	}
+	return sendFile(stream, s.path(in.Value))
+}
+
+// authorize checks the bearer token of the authorization header, if the server requires one.
+func (s *Server) authorize(ctx context.Context) error {
+	if s.token == nil {
+		return nil
+	}
+	token, err := s.token()
+	if err != nil {
+		level.Error(s.logger).Log("msg", "failed to get token", "err", err)
+		return status.Error(codes.Unavailable, "failed to authenticate")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if validToken(v, token) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing token")
+}
+
+// validToken reports whether the authorization header carries the bearer token.
+func validToken(header, token string) bool {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header[len(prefix):]), []byte(token)) == 1
+}
+
+// path returns the path of the stored debug file of the build ID.
+func (s *Server) path(buildID string) string {
+	return filepath.Join(s.dir, buildID+".debug")
+}
+
+// validBuildID rejects build IDs that are not hex, they end up in paths.
+func validBuildID(id string) error {
+	if id == "" {
+		return status.Error(codes.InvalidArgument, "empty build ID")
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return status.Errorf(codes.InvalidArgument, "invalid build ID %q", id)
+		}
+	}
+	return nil
+}
+
+func sendFile(stream grpc.ServerStream, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return status.Error(codes.NotFound, "debug file not found")
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to open debug file: %v", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := stream.SendMsg(wrapperspb.Bytes(buf[:n])); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read debug file: %v", err)
+		}
+	}
+}
+
+// statusOf maps the errors of the pipeline to gRPC status codes.
+func statusOf(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	code := codeOf(err)
+	if code == codes.Internal {
+		return status.Errorf(code, "failed to extract debug information: %v", err)
+	}
+	return status.Error(code, err.Error())
+}
+
+// codeOf classifies the errors of the pipeline.
+func codeOf(err error) codes.Code {
+	switch {
+	case errors.Is(err, elfutils.ErrNotELF), errors.Is(err, elfutils.ErrUnsupportedClass):
+		return codes.InvalidArgument
+	case errors.Is(err, elfutils.ErrLimitExceeded):
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
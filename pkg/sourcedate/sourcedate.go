@@ -0,0 +1,45 @@
+// Package sourcedate implements SOURCE_DATE_EPOCH of reproducible builds, see
+// https://reproducible-builds.org/specs/source-date-epoch/. Timestamps written to outputs are
+// taken from it, so two runs on the same inputs produce the same bytes.
+package sourcedate
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvVar is the environment variable holding the timestamp, in seconds since the Unix epoch.
+const EnvVar = "SOURCE_DATE_EPOCH"
+
+// Epoch returns the time SOURCE_DATE_EPOCH is set to, or false if it is not set.
+func Epoch() (time.Time, bool, error) {
+	s, ok := os.LookupEnv(EnvVar)
+	if !ok || s == "" {
+		return time.Time{}, false, nil
+	}
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || sec < 0 {
+		return time.Time{}, false, fmt.Errorf("invalid %s %q, must be a non-negative number of seconds", EnvVar, s)
+	}
+	return time.Unix(sec, 0).UTC(), true, nil
+}
+
+// Now returns the time of SOURCE_DATE_EPOCH, or the current time if it is not set or invalid.
+// Commands validate it up front with Epoch.
+func Now() time.Time {
+	if t, ok, err := Epoch(); ok && err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// Clamp returns the time of SOURCE_DATE_EPOCH if t is later than it, otherwise t.
+// Modification times of inputs are clamped, they are not newer than the outputs then.
+func Clamp(t time.Time) time.Time {
+	if epoch, ok, err := Epoch(); ok && err == nil && t.After(epoch) {
+		return epoch
+	}
+	return t
+}
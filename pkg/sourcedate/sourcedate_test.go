@@ -0,0 +1,32 @@
+package sourcedate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpoch(t *testing.T) {
+	t.Setenv(EnvVar, "")
+	_, ok, err := Epoch()
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.WithinDuration(t, time.Now(), Now(), time.Minute)
+
+	t.Setenv(EnvVar, "1700000000")
+	epoch, ok, err := Epoch()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, time.Unix(1700000000, 0).UTC(), epoch)
+	require.Equal(t, epoch, Now())
+	require.Equal(t, epoch, Clamp(time.Now()))
+	require.Equal(t, time.Unix(1600000000, 0), Clamp(time.Unix(1600000000, 0)))
+
+	for _, s := range []string{"-1", "1.5", "yesterday"} {
+		t.Setenv(EnvVar, s)
+		_, _, err := Epoch()
+		require.Error(t, err, s)
+		require.WithinDuration(t, time.Now(), Now(), time.Minute)
+	}
+}
@@ -0,0 +1,112 @@
+package splitelf
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter"
+)
+
+// ErrDigestMismatch is returned by Assemble for blobs whose contents do not match their digest.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// Assemble writes the debug file of the manifest to w, with the contents of the sections read
+// from the blobs. The contents are verified against their digests. The sections are held in
+// memory until the file is written.
+func Assemble(w io.WriteSeeker, m *Manifest, blobs Blobs) error {
+	if m.Version != ManifestVersion {
+		return fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	fhdr := &elf.FileHeader{
+		Class:      elf.Class(m.Class),
+		Data:       elf.Data(m.Data),
+		Version:    elf.EV_CURRENT,
+		OSABI:      elf.OSABI(m.OSABI),
+		ABIVersion: m.ABIVersion,
+		Type:       elf.Type(m.Type),
+		Machine:    elf.Machine(m.Machine),
+		Entry:      m.Entry,
+	}
+	switch fhdr.Data {
+	case elf.ELFDATA2LSB:
+		fhdr.ByteOrder = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		fhdr.ByteOrder = binary.BigEndian
+	default:
+		return fmt.Errorf("unsupported data encoding %s", fhdr.Data)
+	}
+
+	// The sections by their index, for the links.
+	sections := make([]*elf.Section, 1, len(m.Sections)+1)
+	for _, ms := range m.Sections {
+		s, err := newSection(ms, blobs)
+		if err != nil {
+			return fmt.Errorf("failed to assemble section %s: %w", ms.Name, err)
+		}
+		sections = append(sections, s)
+	}
+
+	ew, err := elfwriter.New(w, fhdr, elfwriter.WithSourceSections(sections))
+	if err != nil {
+		return err
+	}
+	ew.Sections = sections[1:]
+	return ew.Write()
+}
+
+// newSection returns the section of the manifest with the contents of its blob.
+func newSection(ms Section, blobs Blobs) (*elf.Section, error) {
+	hdr := elf.SectionHeader{
+		Name:      ms.Name,
+		Type:      elf.SectionType(ms.Type),
+		Flags:     elf.SectionFlag(ms.Flags) &^ elf.SHF_COMPRESSED, // Written uncompressed.
+		Addr:      ms.Addr,
+		Link:      ms.Link,
+		Info:      ms.Info,
+		Addralign: ms.Addralign,
+		Entsize:   ms.Entsize,
+	}
+	var data []byte
+	if ms.Blob != "" {
+		var err error
+		if data, err = readBlob(blobs, ms.Blob); err != nil {
+			return nil, err
+		}
+		if uint64(len(data)) != ms.Size {
+			return nil, fmt.Errorf("blob %s has %d bytes, the manifest records %d", ms.Blob, len(data), ms.Size)
+		}
+	}
+	s, err := elfwriter.NewSection(hdr, data)
+	if err != nil {
+		return nil, err
+	}
+	if s.Type == elf.SHT_NOBITS {
+		s.Size = ms.Size
+	}
+	return s, nil
+}
+
+// readBlob reads the blob of the digest and verifies its contents.
+func readBlob(blobs Blobs, digest string) ([]byte, error) {
+	if !strings.HasPrefix(digest, digestPrefix) {
+		return nil, fmt.Errorf("unsupported digest %q", digest)
+	}
+	rc, err := blobs.Open(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", digest, err)
+	}
+	if got := Digest(data); got != digest {
+		return nil, fmt.Errorf("%w: blob %s has digest %s", ErrDigestMismatch, digest, got)
+	}
+	return data, nil
+}
@@ -0,0 +1,73 @@
+package splitelf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir stores the blobs in a local directory as sha256/<hex digest>, the layout of OCI image
+// layouts, so it is synced to object storage as it is.
+type Dir string
+
+// Put stores the contents of r, unless a blob with the same digest is stored already.
+func (d Dir) Put(r io.Reader) (string, error) {
+	dir := filepath.Join(string(d), "sha256")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(dir, ".blob-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	path := filepath.Join(dir, sum)
+	if _, err := os.Stat(path); err == nil {
+		return digestPrefix + sum, nil
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", err
+	}
+	return digestPrefix + sum, nil
+}
+
+// Open opens the blob of the digest.
+func (d Dir) Open(digest string) (io.ReadCloser, error) {
+	sum := strings.TrimPrefix(digest, digestPrefix)
+	if sum == digest || !validHex(sum) {
+		return nil, fmt.Errorf("invalid digest %q", digest)
+	}
+	return os.Open(filepath.Join(string(d), "sha256", sum))
+}
+
+// validHex reports whether s is a lower case hex sha256 digest, digests end up in paths.
+func validHex(s string) bool {
+	if len(s) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package splitelf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// HTTP reads the blobs from a web server or a bucket served over HTTP, in the layout of Dir:
+// the blob sha256:abcd... is fetched from <url>/sha256/abcd.... It is read-only.
+type HTTP struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTP returns the blobs served below the URL, fetched with the client. The default client
+// is http.DefaultClient.
+func NewHTTP(url string, client *http.Client) *HTTP {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTP{url: strings.TrimSuffix(url, "/"), client: client}
+}
+
+// Put fails, the blobs are uploaded with the tools of the storage, e.g. by syncing a Dir.
+func (h *HTTP) Put(io.Reader) (string, error) {
+	return "", errors.New("HTTP blobs are read-only")
+}
+
+// Open fetches the blob of the digest.
+func (h *HTTP) Open(digest string) (io.ReadCloser, error) {
+	sum := strings.TrimPrefix(digest, digestPrefix)
+	if sum == digest || !validHex(sum) {
+		return nil, fmt.Errorf("invalid digest %q", digest)
+	}
+	resp, err := h.client.Get(h.url + "/sha256/" + sum)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("blob %s: %w", digest, fs.ErrNotExist)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch blob %s: %s", digest, resp.Status)
+	}
+}
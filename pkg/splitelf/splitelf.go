@@ -0,0 +1,112 @@
+// Package splitelf splits ELF debug files into a blob per section, stored by the digest of its
+// contents, and a manifest of the file and section headers. Identical sections of different
+// binaries, e.g. the .debug_str or .debug_line of a shared library linked into many of them, are
+// stored once. Assemble rebuilds a loadable debug file from the manifest and its blobs.
+package splitelf
+
+import (
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// ManifestVersion is the version of the manifest format.
+const ManifestVersion = 1
+
+// digestPrefix is the prefix of the blob digests, the algorithm.
+const digestPrefix = "sha256:"
+
+// Manifest describes a debug file split into section blobs. The header fields hold the values
+// of the ELF file header, the sections the ones of the section headers, in their order.
+type Manifest struct {
+	Version    int    `json:"version"`
+	BuildID    string `json:"build_id,omitempty"`
+	Class      uint8  `json:"class"`
+	Data       uint8  `json:"data"`
+	OSABI      uint8  `json:"osabi"`
+	ABIVersion uint8  `json:"abi_version"`
+	Type       uint16 `json:"type"`
+	Machine    uint16 `json:"machine"`
+	Entry      uint64 `json:"entry"`
+
+	Sections []Section `json:"sections"`
+}
+
+// Section describes a section of the split debug file. Link and Info are section indices as in
+// the section headers, the first section has index 1. Size is the size of the decompressed
+// contents, compressed sections are stored decompressed and assembled uncompressed.
+type Section struct {
+	Name      string `json:"name"`
+	Type      uint32 `json:"type"`
+	Flags     uint64 `json:"flags"`
+	Addr      uint64 `json:"addr"`
+	Size      uint64 `json:"size"`
+	Link      uint32 `json:"link"`
+	Info      uint32 `json:"info"`
+	Addralign uint64 `json:"addralign"`
+	Entsize   uint64 `json:"entsize"`
+	// Blob is the digest of the contents, e.g. sha256:9f86d0...; empty for sections without
+	// contents in the file and the section header string table, which is rebuilt.
+	Blob string `json:"blob,omitempty"`
+}
+
+// Blobs stores blobs by the digest of their contents.
+type Blobs interface {
+	// Put stores the contents of r and returns their digest. Contents already stored are not stored again.
+	Put(r io.Reader) (string, error)
+	// Open opens the blob of the digest, the error wraps fs.ErrNotExist if there is none.
+	Open(digest string) (io.ReadCloser, error)
+}
+
+// Split stores the contents of the sections of the debug file in the blobs and returns its manifest.
+func Split(f *elf.File, blobs Blobs) (*Manifest, error) {
+	m := &Manifest{
+		Version:    ManifestVersion,
+		Class:      uint8(f.Class),
+		Data:       uint8(f.Data),
+		OSABI:      uint8(f.OSABI),
+		ABIVersion: f.ABIVersion,
+		Type:       uint16(f.Type),
+		Machine:    uint16(f.Machine),
+		Entry:      f.Entry,
+	}
+	for i, s := range f.Sections {
+		if i == 0 && s.Type == elf.SHT_NULL {
+			continue
+		}
+		sec := Section{
+			Name:      s.Name,
+			Type:      uint32(s.Type),
+			Flags:     uint64(s.Flags),
+			Addr:      s.Addr,
+			Size:      s.Size,
+			Link:      s.Link,
+			Info:      s.Info,
+			Addralign: s.Addralign,
+			Entsize:   s.Entsize,
+		}
+		if s.Type != elf.SHT_NOBITS && !isShstrtab(f, i) {
+			digest, err := blobs.Put(s.Open())
+			if err != nil {
+				return nil, fmt.Errorf("failed to store section %s: %w", s.Name, err)
+			}
+			sec.Blob = digest
+		}
+		m.Sections = append(m.Sections, sec)
+	}
+	return m, nil
+}
+
+// isShstrtab reports whether the i-th section is the section header string table.
+func isShstrtab(f *elf.File, i int) bool {
+	s := f.Sections[i]
+	return s.Type == elf.SHT_STRTAB && s.Name == ".shstrtab"
+}
+
+// Digest returns the digest blobs are stored by, e.g. sha256:9f86d0....
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return digestPrefix + hex.EncodeToString(sum[:])
+}
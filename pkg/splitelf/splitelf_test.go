@@ -0,0 +1,126 @@
+package splitelf
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	f, err := elf.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer f.Close()
+
+	blobs := Dir(t.TempDir())
+	m, err := Split(f, blobs)
+	require.NoError(t, err)
+	require.Equal(t, uint16(f.Machine), m.Machine)
+	require.Len(t, m.Sections, len(f.Sections)-1)
+	for i, s := range f.Sections[1:] {
+		ms := m.Sections[i]
+		require.Equal(t, s.Name, ms.Name)
+		require.Equal(t, s.Link, ms.Link, s.Name)
+		if s.Type == elf.SHT_NOBITS || s.Name == ".shstrtab" {
+			require.Empty(t, ms.Blob, s.Name)
+			continue
+		}
+		// Compressed sections are stored decompressed.
+		want, err := s.Data()
+		require.NoError(t, err)
+		rc, err := blobs.Open(ms.Blob)
+		require.NoError(t, err)
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(want, got), s.Name)
+		require.Equal(t, Digest(got), ms.Blob)
+		require.Equal(t, uint64(len(got)), ms.Size)
+	}
+
+	// Splitting the same file again stores no new blobs.
+	stored, err := ioutil.ReadDir(filepath.Join(string(blobs), "sha256"))
+	require.NoError(t, err)
+	again, err := Split(f, blobs)
+	require.NoError(t, err)
+	require.Equal(t, m, again)
+	restored, err := ioutil.ReadDir(filepath.Join(string(blobs), "sha256"))
+	require.NoError(t, err)
+	require.Equal(t, len(stored), len(restored))
+
+	_, err = blobs.Open("sha256:../../etc/passwd")
+	require.Error(t, err)
+}
+
+func TestAssemble(t *testing.T) {
+	f, err := elf.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer f.Close()
+
+	dir := Dir(t.TempDir())
+	m, err := Split(f, dir)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.FileServer(http.Dir(string(dir))))
+	defer srv.Close()
+
+	for name, blobs := range map[string]Blobs{"dir": dir, "http": NewHTTP(srv.URL+"/", srv.Client())} {
+		t.Run(name, func(t *testing.T) {
+			out, err := os.Create(filepath.Join(t.TempDir(), "app.debug"))
+			require.NoError(t, err)
+			defer out.Close()
+			require.NoError(t, Assemble(out, m, blobs))
+
+			assembled, err := elf.NewFile(out)
+			require.NoError(t, err)
+			require.Equal(t, f.Machine, assembled.Machine)
+			require.Equal(t, f.Type, assembled.Type)
+			require.Len(t, assembled.Sections, len(f.Sections))
+			for i, s := range f.Sections[1:] {
+				a := assembled.Sections[i+1]
+				require.Equal(t, s.Name, a.Name)
+				require.Equal(t, s.Type, a.Type)
+				// Compressed sections are written uncompressed.
+				require.Equal(t, s.Flags&^elf.SHF_COMPRESSED, a.Flags, s.Name)
+				require.Equal(t, s.Link, a.Link, s.Name)
+				require.Equal(t, s.Size, a.Size, s.Name)
+				if s.Type == elf.SHT_NOBITS {
+					continue
+				}
+				want, err := s.Data()
+				require.NoError(t, err)
+				got, err := a.Data()
+				require.NoError(t, err)
+				require.True(t, bytes.Equal(want, got), s.Name)
+			}
+		})
+	}
+}
+
+func TestAssemble_DigestMismatch(t *testing.T) {
+	f, err := elf.Open("../../dist/split-debug")
+	require.NoError(t, err)
+	defer f.Close()
+
+	blobs := Dir(t.TempDir())
+	m, err := Split(f, blobs)
+	require.NoError(t, err)
+	var text Section
+	for _, s := range m.Sections {
+		if s.Name == ".text" {
+			text = s
+		}
+	}
+	path := filepath.Join(string(blobs), "sha256", text.Blob[len(digestPrefix):])
+	require.NoError(t, ioutil.WriteFile(path, []byte("tampered"), 0o644))
+
+	out, err := os.Create(filepath.Join(t.TempDir(), "app.debug"))
+	require.NoError(t, err)
+	defer out.Close()
+	require.ErrorIs(t, Assemble(out, m, blobs), ErrDigestMismatch)
+}
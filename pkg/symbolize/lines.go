@@ -0,0 +1,132 @@
+package symbolize
+
+import (
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Line is a row of a DWARF line table: the addresses from Address up to End map to the line.
+type Line struct {
+	Address uint64 `json:"address"`
+	End     uint64 `json:"end"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	// IsStmt reports whether the row is a recommended breakpoint location, the start of a statement.
+	IsStmt bool `json:"is_stmt"`
+}
+
+// FunctionRanges returns the address ranges of the functions with the given name: the DWARF
+// subprograms, or else the ELF symbols of that name.
+func (r *Resolver) FunctionRanges(name string) [][2]uint64 {
+	var ranges [][2]uint64
+	for _, fn := range r.functions {
+		if fn.name == name {
+			ranges = append(ranges, [2]uint64{fn.low, fn.high})
+		}
+	}
+	if len(ranges) > 0 {
+		return ranges
+	}
+	for _, sym := range r.symbols {
+		if sym.Name == name && sym.Size > 0 {
+			ranges = append(ranges, [2]uint64{sym.Value, sym.Value + sym.Size})
+		}
+	}
+	return ranges
+}
+
+// Lines returns the rows of the DWARF line tables covering the addresses in [low, high), sorted
+// by address. It fails if the file has no DWARF.
+func (r *Resolver) Lines(low, high uint64) ([]Line, error) {
+	if r.dwarf == nil {
+		return nil, errors.New("no DWARF debug information")
+	}
+
+	var lines []Line
+	reader := r.dwarf.Reader()
+	for {
+		cu, err := reader.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read compilation units: %w", err)
+		}
+		if cu == nil {
+			break
+		}
+		if cu.Tag != dwarf.TagCompileUnit {
+			reader.SkipChildren()
+			continue
+		}
+		reader.SkipChildren()
+		if !covers(r.dwarf, cu, low, high) {
+			continue
+		}
+
+		lr := r.lineReader(cu)
+		if lr == nil {
+			continue
+		}
+		rows, err := readLines(lr, low, high)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read line table at offset %#x: %w", cu.Offset, err)
+		}
+		lines = append(lines, rows...)
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Address < lines[j].Address })
+	return lines, nil
+}
+
+// covers reports whether the compilation unit may have code in [low, high). Units whose ranges
+// are unknown are read either way.
+func covers(d *dwarf.Data, cu *dwarf.Entry, low, high uint64) bool {
+	ranges, err := d.Ranges(cu)
+	if err != nil || len(ranges) == 0 {
+		return true
+	}
+	for _, rng := range ranges {
+		if rng[0] < high && low < rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// readLines returns the rows of the line table overlapping [low, high). A row ends where the next
+// one of its sequence starts.
+func readLines(lr *dwarf.LineReader, low, high uint64) ([]Line, error) {
+	lr.Reset()
+	var (
+		lines []Line
+		prev  dwarf.LineEntry
+		open  bool
+	)
+	for {
+		var entry dwarf.LineEntry
+		err := lr.Next(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if open && entry.Address > prev.Address && prev.Address < high && low < entry.Address {
+			line := Line{
+				Address: prev.Address,
+				End:     entry.Address,
+				Line:    prev.Line,
+				Column:  prev.Column,
+				IsStmt:  prev.IsStmt,
+			}
+			if prev.File != nil {
+				line.File = prev.File.Name
+			}
+			lines = append(lines, line)
+		}
+		prev, open = entry, !entry.EndSequence
+	}
+	return lines, nil
+}
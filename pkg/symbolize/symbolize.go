@@ -0,0 +1,283 @@
+// Package symbolize resolves addresses to functions, files and lines
+// using the debug information of an object file.
+//
+// DWARF is consulted first, then the Go symbol table (.gopclntab)
+// and lastly the ELF symbol table, so that debug files produced with
+// only a subset of the debug sections can still be used.
+package symbolize
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+)
+
+// Frame is the symbolized location of an address.
+// Function and File are empty and Line is 0 when unknown.
+type Frame struct {
+	Address  uint64
+	Function string
+	File     string
+	Line     int
+}
+
+// Resolve symbolizes the given addresses using the debug information in debugFile.
+func Resolve(debugFile string, addrs []uint64) ([]Frame, error) {
+	f, err := elfutils.Open(debugFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := New(f)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]Frame, 0, len(addrs))
+	for _, addr := range addrs {
+		frames = append(frames, r.Resolve(addr))
+	}
+	return frames, nil
+}
+
+// Resolver symbolizes addresses of a single object file.
+type Resolver struct {
+	dwarf     *dwarf.Data
+	functions []function
+	lines     map[dwarf.Offset]*dwarf.LineReader
+
+	gosym *gosym.Table
+
+	symbols []elf.Symbol
+}
+
+// function is the address range of a DWARF subprogram.
+type function struct {
+	low, high uint64
+	name      string
+	cu        *dwarf.Entry
+}
+
+// New creates a Resolver using the debug information available in f.
+// It fails if f has neither DWARF, a Go symbol table nor an ELF symbol table.
+func New(f *elf.File) (*Resolver, error) {
+	r := &Resolver{
+		lines: make(map[dwarf.Offset]*dwarf.LineReader),
+	}
+
+	if d, err := f.DWARF(); err == nil {
+		r.dwarf = d
+		if err := r.loadFunctions(); err != nil {
+			return nil, fmt.Errorf("failed to read DWARF functions: %w", err)
+		}
+	}
+
+	if tab, err := GoSymbolTable(f); err == nil {
+		r.gosym = tab
+	}
+
+	if syms, err := f.Symbols(); err == nil {
+		for _, s := range syms {
+			if elf.ST_TYPE(s.Info) == elf.STT_FUNC && s.Value != 0 {
+				r.symbols = append(r.symbols, s)
+			}
+		}
+		sort.Slice(r.symbols, func(i, j int) bool {
+			return r.symbols[i].Value < r.symbols[j].Value
+		})
+	}
+
+	if r.dwarf == nil && r.gosym == nil && len(r.symbols) == 0 {
+		return nil, elfutils.ErrNoDebugInfo
+	}
+	return r, nil
+}
+
+// Resolve symbolizes the given address.
+func (r *Resolver) Resolve(addr uint64) Frame {
+	frame := Frame{Address: addr}
+
+	if fn := r.findFunction(addr); fn != nil {
+		frame.Function = fn.name
+		if lr := r.lineReader(fn.cu); lr != nil {
+			var entry dwarf.LineEntry
+			if err := lr.SeekPC(addr, &entry); err == nil {
+				frame.File = entry.File.Name
+				frame.Line = entry.Line
+			}
+		}
+		if frame.File != "" {
+			return frame
+		}
+	}
+
+	if r.gosym != nil {
+		if file, line, fn := r.gosym.PCToLine(addr); fn != nil {
+			frame.Function = fn.Name
+			if line > 0 {
+				frame.File = file
+				frame.Line = line
+			}
+			return frame
+		}
+	}
+
+	if frame.Function == "" {
+		if sym := r.findSymbol(addr); sym != nil {
+			frame.Function = sym.Name
+		}
+	}
+	return frame
+}
+
+// maxRefs bounds the chains of DW_AT_specification and DW_AT_abstract_origin references followed,
+// e.g. the concrete DIE of an inlined member refers to its abstract DIE, which refers to the
+// declaration in the class.
+const maxRefs = 8
+
+// loadFunctions collects the address ranges of all subprograms in the DWARF data.
+func (r *Resolver) loadFunctions() error {
+	var cu *dwarf.Entry
+	reader := r.dwarf.Reader()
+	refs := r.dwarf.Reader()
+	for {
+		e, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			break
+		}
+
+		switch e.Tag {
+		case dwarf.TagCompileUnit:
+			cu = e
+		case dwarf.TagSubprogram:
+			name := subprogramName(refs, e)
+			if name == "" {
+				continue
+			}
+			ranges, err := r.dwarf.Ranges(e)
+			if err != nil {
+				continue
+			}
+			for _, rng := range ranges {
+				r.functions = append(r.functions, function{low: rng[0], high: rng[1], name: name, cu: cu})
+			}
+		}
+	}
+
+	sort.Slice(r.functions, func(i, j int) bool {
+		return r.functions[i].low < r.functions[j].low
+	})
+	return nil
+}
+
+// subprogramName returns the name of the subprogram, read from the DIE it refers to if it has none
+// of its own: the declaration of a C++ member defined out of line, or the abstract instance of an
+// inlined or optimized function.
+func subprogramName(refs *dwarf.Reader, e *dwarf.Entry) string {
+	for i := 0; i < maxRefs; i++ {
+		if name, ok := e.Val(dwarf.AttrName).(string); ok {
+			return name
+		}
+		off, ok := e.Val(dwarf.AttrSpecification).(dwarf.Offset)
+		if !ok {
+			if off, ok = e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); !ok {
+				return ""
+			}
+		}
+		refs.Seek(off)
+		next, err := refs.Next()
+		if err != nil || next == nil {
+			return ""
+		}
+		e = next
+	}
+	return ""
+}
+
+func (r *Resolver) findFunction(addr uint64) *function {
+	i := sort.Search(len(r.functions), func(i int) bool {
+		return r.functions[i].low > addr
+	})
+	if i == 0 {
+		return nil
+	}
+	if fn := &r.functions[i-1]; addr < fn.high {
+		return fn
+	}
+	return nil
+}
+
+func (r *Resolver) lineReader(cu *dwarf.Entry) *dwarf.LineReader {
+	if cu == nil {
+		return nil
+	}
+	if lr, ok := r.lines[cu.Offset]; ok {
+		return lr
+	}
+	lr, err := r.dwarf.LineReader(cu)
+	if err != nil {
+		lr = nil
+	}
+	r.lines[cu.Offset] = lr
+	return lr
+}
+
+func (r *Resolver) findSymbol(addr uint64) *elf.Symbol {
+	i := sort.Search(len(r.symbols), func(i int) bool {
+		return r.symbols[i].Value > addr
+	})
+	if i == 0 {
+		return nil
+	}
+	if sym := &r.symbols[i-1]; sym.Size == 0 || addr < sym.Value+sym.Size {
+		return sym
+	}
+	return nil
+}
+
+// GoSymbolTable creates a Go symbol table from the .gopclntab section.
+func GoSymbolTable(f *elf.File) (*gosym.Table, error) {
+	pclntab := f.Section(".gopclntab")
+	if pclntab == nil {
+		return nil, errors.New("no .gopclntab section")
+	}
+	pclntabData, err := pclntab.Data()
+	if err != nil {
+		return nil, err
+	}
+
+	var symtabData []byte
+	if s := f.Section(".gosymtab"); s != nil {
+		symtabData, err = s.Data()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return gosym.NewTable(symtabData, gosym.NewLineTable(pclntabData, textStart(f)))
+}
+
+// textStart returns the start address of the Go text segment.
+// Debug files do not keep .text, so the runtime.text symbol is preferred.
+func textStart(f *elf.File) uint64 {
+	if syms, err := f.Symbols(); err == nil {
+		for _, s := range syms {
+			if s.Name == "runtime.text" {
+				return s.Value
+			}
+		}
+	}
+	if s := f.Section(".text"); s != nil {
+		return s.Addr
+	}
+	return 0
+}
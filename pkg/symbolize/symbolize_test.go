@@ -0,0 +1,204 @@
+package symbolize
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/elfwriter"
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+)
+
+const testBinary = "../../dist/split-debug"
+
+func TestResolve(t *testing.T) {
+	inElf, err := elfutils.Open(testBinary)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+
+	syms, err := inElf.Symbols()
+	require.NoError(t, err)
+	var mainAddr uint64
+	for _, s := range syms {
+		if s.Name == "main.main" {
+			mainAddr = s.Value
+		}
+	}
+	require.NotZero(t, mainAddr)
+
+	tests := []struct {
+		name     string
+		keep     func(s *elf.Section) bool
+		hasLines bool
+	}{
+		{
+			name: "dwarf",
+			keep: func(s *elf.Section) bool {
+				return strings.HasPrefix(s.Name, ".debug_")
+			},
+			hasLines: true,
+		},
+		{
+			name: "go symbol table",
+			keep: func(s *elf.Section) bool {
+				return s.Name == ".gopclntab" || s.Name == ".symtab" || s.Name == ".strtab"
+			},
+			hasLines: true,
+		},
+		{
+			name: "symbol table",
+			keep: func(s *elf.Section) bool {
+				return s.Name == ".symtab" || s.Name == ".strtab"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := ioutil.TempFile("", "test-output.*")
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				os.Remove(output.Name())
+			})
+
+			w, err := elfwriter.New(output, &inElf.FileHeader)
+			require.NoError(t, err)
+			for _, s := range inElf.Sections {
+				if tt.keep(s) {
+					w.Sections = append(w.Sections, s)
+				}
+			}
+			require.NoError(t, w.Write())
+			require.NoError(t, w.Close())
+
+			frames, err := Resolve(output.Name(), []uint64{mainAddr})
+			require.NoError(t, err)
+			require.Len(t, frames, 1)
+			require.Equal(t, mainAddr, frames[0].Address)
+			require.Equal(t, "main.main", frames[0].Function)
+			if tt.hasLines {
+				require.True(t, strings.HasSuffix(frames[0].File, "main.go"), frames[0].File)
+				require.Positive(t, frames[0].Line)
+			} else {
+				require.Empty(t, frames[0].File)
+				require.Zero(t, frames[0].Line)
+			}
+		})
+	}
+}
+
+// memberProgram defines a C++ member out of line: the DIE of the definition has no name of its own
+// but refers to the declaration in the struct.
+var memberProgram = map[string]string{
+	"main.cc": "struct S { int f(int); };\nint S::f(int x) { return x + 1; }\nint main() { S s; return s.f(1); }\n",
+}
+
+// symbolValue returns the address and size of the named symbol of f.
+func symbolValue(t *testing.T, f *elf.File, name string) (uint64, uint64) {
+	t.Helper()
+	syms, err := f.Symbols()
+	require.NoError(t, err)
+	for _, s := range syms {
+		if s.Name == name {
+			return s.Value, s.Size
+		}
+	}
+	t.Fatalf("symbol %s not found", name)
+	return 0, 0
+}
+
+func TestResolveOutOfLineMember(t *testing.T) {
+	f, err := elfutils.Open(elfwritertest.Build(t, "g++", memberProgram, "-g", "-O0"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.Close()
+	})
+	addr, _ := symbolValue(t, f, "_ZN1S1fEi")
+
+	r, err := New(f)
+	require.NoError(t, err)
+	frame := r.Resolve(addr)
+	require.Equal(t, "f", frame.Function)
+	require.True(t, strings.HasSuffix(frame.File, "main.cc"), frame.File)
+	require.Equal(t, 2, frame.Line)
+}
+
+func TestResolveNoDebugInformation(t *testing.T) {
+	inElf, err := elfutils.Open(testBinary)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+
+	output, err := ioutil.TempFile("", "test-output.*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.Remove(output.Name())
+	})
+
+	w, err := elfwriter.New(output, &inElf.FileHeader)
+	require.NoError(t, err)
+	require.NoError(t, w.Write())
+	require.NoError(t, w.Close())
+
+	_, err = Resolve(output.Name(), []uint64{0})
+	require.Error(t, err)
+}
+
+func TestLines(t *testing.T) {
+	inElf, err := elfutils.Open(testBinary)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inElf.Close()
+	})
+
+	r, err := New(inElf)
+	require.NoError(t, err)
+	ranges := r.FunctionRanges("main.main")
+	require.Len(t, ranges, 1)
+	require.Empty(t, r.FunctionRanges("main.doesNotExist"))
+
+	lines, err := r.Lines(ranges[0][0], ranges[0][1])
+	require.NoError(t, err)
+	require.NotEmpty(t, lines)
+	for i, l := range lines {
+		require.Less(t, l.Address, l.End)
+		require.Less(t, l.Address, ranges[0][1])
+		require.Greater(t, l.End, ranges[0][0])
+		require.NotEmpty(t, l.File)
+		if i > 0 {
+			require.LessOrEqual(t, lines[i-1].Address, l.Address)
+		}
+	}
+	require.Equal(t, ranges[0][0], lines[0].Address)
+
+	// The entry of the function maps to the line addr2line resolves it to; the lines of inlined
+	// functions map to other files.
+	frame := r.Resolve(ranges[0][0])
+	require.Equal(t, frame.File, lines[0].File)
+	require.Equal(t, frame.Line, lines[0].Line)
+}
+
+func TestFunctionRangesOutOfLineMember(t *testing.T) {
+	f, err := elfutils.Open(elfwritertest.Build(t, "g++", memberProgram, "-g", "-O0"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		f.Close()
+	})
+	addr, size := symbolValue(t, f, "_ZN1S1fEi")
+
+	r, err := New(f)
+	require.NoError(t, err)
+	require.Equal(t, [][2]uint64{{addr, addr + size}}, r.FunctionRanges("f"))
+
+	lines, err := r.Lines(addr, addr+size)
+	require.NoError(t, err)
+	require.NotEmpty(t, lines)
+	require.Equal(t, 2, lines[0].Line)
+}
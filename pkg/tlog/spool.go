@@ -0,0 +1,131 @@
+package tlog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrQueued is wrapped by the errors of the statements a Spool queued instead of publishing them.
+var ErrQueued = errors.New("queued for publishing")
+
+// Spool publishes statements with a publisher and queues the ones it fails to publish for a
+// Temporary reason, e.g. while the log cannot be reached, in a directory. Flush publishes them.
+// The queue survives restarts.
+type Spool struct {
+	p   Publisher
+	dir string
+
+	mu sync.Mutex
+}
+
+// NewSpool returns a spool of the publisher queuing statements in dir, which is created if needed.
+func NewSpool(p Publisher, dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Spool{p: p, dir: dir}, nil
+}
+
+// Publish implements Publisher. It returns an error wrapping ErrQueued, and the error of the
+// publisher, if the statement was queued.
+func (s *Spool) Publish(ctx context.Context, st Statement) (Entry, error) {
+	e, err := s.p.Publish(ctx, st)
+	if err == nil || !Temporary(err) {
+		return e, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if qerr := s.queue(st); qerr != nil {
+		return Entry{}, fmt.Errorf("failed to queue statement: %v, after failing to publish it: %w", qerr, err)
+	}
+	return Entry{}, fmt.Errorf("%w: %v", ErrQueued, err)
+}
+
+// queue writes the statement to the queue, named by its digest so it is queued once.
+func (s *Spool) queue(st Statement) error {
+	sum := sha256.Sum256(st.Marshal())
+	path := filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+	tmp, err := ioutil.TempFile(s.dir, ".statement-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(st.Marshal()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Len returns the number of queued statements.
+func (s *Spool) Len() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names, err := s.queued()
+	return len(names), err
+}
+
+func (s *Spool) queued() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range infos {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".json") {
+			names = append(names, fi.Name())
+		}
+	}
+	return names, nil
+}
+
+// Flush publishes the queued statements and returns how many it published. It stops at the
+// first statement that fails for a Temporary reason, the others stay queued. Statements the log
+// rejects are dropped from the queue, the first of the errors is returned.
+func (s *Spool) Flush(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names, err := s.queued()
+	if err != nil {
+		return 0, err
+	}
+	var published int
+	var rejected error
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return published, err
+		}
+		var st Statement
+		if err := json.Unmarshal(data, &st); err != nil {
+			return published, fmt.Errorf("invalid queued statement %s: %w", path, err)
+		}
+		_, err = s.p.Publish(ctx, st)
+		if err != nil && Temporary(err) {
+			return published, err
+		}
+		if err != nil && rejected == nil {
+			rejected = fmt.Errorf("statement of %s rejected: %w", st.BuildID, err)
+		}
+		if err == nil {
+			published++
+		}
+		if err := os.Remove(path); err != nil {
+			return published, err
+		}
+	}
+	return published, rejected
+}
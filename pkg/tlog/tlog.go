@@ -0,0 +1,251 @@
+// Package tlog publishes the build IDs and digests of uploaded debug files to a Rekor transparency
+// log, so third parties can verify that the debug files a symbol server serves are the ones that
+// were uploaded to it.
+//
+// Each debug file is published as a hashedrekord entry of its Statement: the SHA-256 digest of the
+// statement, signed with the key of the publisher. The statement of a debug file is rebuilt from
+// its build ID and digest, and its entries are searched by the digest of the statement, e.g.
+//
+//	rekor-cli search --sha "$(printf '{"build_id":"%s","digest":"%s"}' "$ID" "$DIGEST" | sha256sum | cut -d' ' -f1)"
+package tlog
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/digest"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+
+	"github.com/go-kit/log/level"
+)
+
+// Statement is the claim published for a debug file: its build ID and digest. The digest is
+// prefixed with its hash algorithm, e.g. sha256:9f86d0….
+type Statement struct {
+	BuildID string `json:"build_id"`
+	Digest  string `json:"digest"`
+}
+
+// Marshal returns the canonical encoding of the statement, the one its digest is published of.
+func (s Statement) Marshal() []byte {
+	// Encoding a struct of strings does not fail, the fields are in their declaration order.
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// Entry is the entry of a published statement in the log.
+type Entry struct {
+	UUID           string
+	LogIndex       int64
+	IntegratedTime time.Time
+}
+
+// Publisher publishes statements to a transparency log.
+type Publisher interface {
+	Publish(ctx context.Context, s Statement) (Entry, error)
+}
+
+// StatusError is the response of a log that rejected an entry.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("transparency log responded with %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Temporary reports whether publishing err may succeed later: the log could not be reached, or
+// failed with a 5xx status or rate limited.
+func Temporary(err error) bool {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return !errors.Is(err, context.Canceled)
+	}
+	return se.StatusCode >= 500 || se.StatusCode == http.StatusTooManyRequests
+}
+
+// Rekor publishes statements to a Rekor server.
+type Rekor struct {
+	url       string
+	signer    crypto.Signer
+	publicKey []byte
+	client    *http.Client
+}
+
+// RekorOption configures a Rekor publisher.
+type RekorOption func(r *Rekor)
+
+// WithClient sends the entries with the given client, the default has a timeout of 30s so runs
+// do not hang while the log cannot be reached.
+func WithClient(c *http.Client) RekorOption {
+	return func(r *Rekor) {
+		r.client = c
+	}
+}
+
+// NewRekor returns a publisher to the Rekor server at url, e.g. https://rekor.sigstore.dev, that
+// signs the entries with signer, an ECDSA or RSA key.
+func NewRekor(url string, signer crypto.Signer, opts ...RekorOption) (*Rekor, error) {
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("unsupported key: %w", err)
+	}
+	r := &Rekor{
+		url:       strings.TrimSuffix(url, "/"),
+		signer:    signer,
+		publicKey: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// ParsePrivateKey parses an unencrypted PEM private key, PKCS #8, SEC 1 EC or PKCS #1 RSA.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM private key")
+	}
+	if strings.Contains(block.Type, "ENCRYPTED") {
+		return nil, errors.New("encrypted private keys are not supported")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", key)
+	}
+	return signer, nil
+}
+
+// hashedRekord is the hashedrekord entry of version 0.0.1 of the Rekor API.
+type hashedRekord struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+	} `json:"spec"`
+}
+
+// Publish implements Publisher. A statement already in the log is not an error, its entry is
+// returned without its index then.
+func (r *Rekor) Publish(ctx context.Context, s Statement) (Entry, error) {
+	sum := sha256.Sum256(s.Marshal())
+	sig, err := r.signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to sign statement: %w", err)
+	}
+	var e hashedRekord
+	e.APIVersion, e.Kind = "0.0.1", "hashedrekord"
+	e.Spec.Signature.Content = sig
+	e.Spec.Signature.PublicKey.Content = r.publicKey
+	e.Spec.Data.Hash.Algorithm, e.Spec.Data.Hash.Value = "sha256", hex.EncodeToString(sum[:])
+	body, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url+"/api/v1/log/entries", bytes.NewReader(body))
+	if err != nil {
+		return Entry{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		// The Location of the existing entry ends with its UUID.
+		loc := resp.Header.Get("Location")
+		return Entry{UUID: loc[strings.LastIndex(loc, "/")+1:]}, nil
+	case resp.StatusCode != http.StatusCreated:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return Entry{}, &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	var entries map[string]struct {
+		LogIndex       int64 `json:"logIndex"`
+		IntegratedTime int64 `json:"integratedTime"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return Entry{}, fmt.Errorf("invalid response of transparency log: %w", err)
+	}
+	for uuid, le := range entries {
+		return Entry{UUID: uuid, LogIndex: le.LogIndex, IntegratedTime: time.Unix(le.IntegratedTime, 0)}, nil
+	}
+	return Entry{}, errors.New("invalid response of transparency log: no entry")
+}
+
+// ErrNoBuildID is returned by Sink for outputs without a build ID, statements are made of it.
+var ErrNoBuildID = errors.New("no build ID to publish the digest of the debug file with")
+
+// Sink returns the pipeline sink that publishes the statement of the written debug file, with its
+// digest of the hash algorithm. It goes after the upload sink, so only the debug files uploaded are
+// published. Statements queued by a Spool do not fail the job.
+func Sink(p Publisher, hash digest.Algorithm) pipeline.Sink {
+	return pipeline.SinkFunc("tlog", func(ctx context.Context, j *pipeline.Job, r io.ReaderAt, size int64) error {
+		if j.BuildID == "" {
+			return ErrNoBuildID
+		}
+		sum, err := digest.Reader(hash, io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return err
+		}
+		e, err := p.Publish(ctx, Statement{BuildID: j.BuildID, Digest: hash.Name() + ":" + sum})
+		if errors.Is(err, ErrQueued) {
+			if j.Logger != nil {
+				level.Warn(j.Logger).Log("msg", "queued digest for the transparency log", "err", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if j.Logger != nil {
+			level.Info(j.Logger).Log("msg", "published digest to the transparency log", "uuid", e.UUID, "log_index", e.LogIndex)
+		}
+		return nil
+	})
+}
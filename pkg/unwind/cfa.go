@@ -0,0 +1,314 @@
+package unwind
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// DWARF call frame instructions, see section 6.4.2 of the DWARF 5 specification. The ones of the
+// high two bits carry their first operand in the low six bits.
+const (
+	dwCFAAdvanceLoc = 0x40
+	dwCFAOffset     = 0x80
+	dwCFARestore    = 0xc0
+
+	dwCFANop                       = 0x00
+	dwCFASetLoc                    = 0x01
+	dwCFAAdvanceLoc1               = 0x02
+	dwCFAAdvanceLoc2               = 0x03
+	dwCFAAdvanceLoc4               = 0x04
+	dwCFAOffsetExtended            = 0x05
+	dwCFARestoreExtended           = 0x06
+	dwCFAUndefined                 = 0x07
+	dwCFASameValue                 = 0x08
+	dwCFARegister                  = 0x09
+	dwCFARememberState             = 0x0a
+	dwCFARestoreState              = 0x0b
+	dwCFADefCFA                    = 0x0c
+	dwCFADefCFARegister            = 0x0d
+	dwCFADefCFAOffset              = 0x0e
+	dwCFADefCFAExpression          = 0x0f
+	dwCFAExpression                = 0x10
+	dwCFAOffsetExtendedSf          = 0x11
+	dwCFADefCFASf                  = 0x12
+	dwCFADefCFAOffsetSf            = 0x13
+	dwCFAValOffset                 = 0x14
+	dwCFAValOffsetSf               = 0x15
+	dwCFAValExpression             = 0x16
+	dwCFAGNUWindowSave             = 0x2d // DW_CFA_AARCH64_negate_ra_state on AArch64.
+	dwCFAGNUArgsSize               = 0x2e
+	dwCFAGNUNegativeOffsetExtended = 0x2f
+)
+
+// ruleKind is how the value of a register of the caller is recovered.
+type ruleKind uint8
+
+const (
+	// ruleSameValue is the default, the register is not changed by the function.
+	ruleSameValue ruleKind = iota
+	ruleUndefined
+	// ruleOffset is a register saved at the CFA plus offset.
+	ruleOffset
+	// ruleValOffset is a register whose value is the CFA plus offset.
+	ruleValOffset
+	// ruleRegister is a register saved in another register.
+	ruleRegister
+	ruleExpression
+	ruleValExpression
+)
+
+// rule is how the value of a register of the caller is recovered.
+type rule struct {
+	kind   ruleKind
+	offset int64
+	reg    uint64
+	expr   []byte
+}
+
+// cfaRule is how the canonical frame address is computed: the value of reg plus offset, or of
+// the expression if it is not nil.
+type cfaRule struct {
+	reg    uint64
+	offset int64
+	expr   []byte
+}
+
+// frameState is a row of the table of call frame information.
+type frameState struct {
+	cfa  cfaRule
+	regs map[uint64]rule
+}
+
+func (s frameState) clone() frameState {
+	regs := make(map[uint64]rule, len(s.regs))
+	for r, v := range s.regs {
+		regs[r] = v
+	}
+	return frameState{cfa: s.cfa, regs: regs}
+}
+
+// stateRow is the state of a row of the table from pc on.
+type stateRow struct {
+	pc    uint64
+	state frameState
+}
+
+// errUnsupportedInstruction is returned for call frame instructions that cannot be interpreted.
+var errUnsupportedInstruction = errors.New("unsupported call frame instruction")
+
+// rows executes the call frame instructions of the CIE and of the FDE and returns the rows of the
+// table, sorted by address.
+func (fde *FDE) rows() ([]stateRow, error) {
+	in := &interpreter{fde: fde, loc: fde.Start, state: frameState{regs: make(map[uint64]rule)}}
+	if err := in.run(fde.cie.instructions); err != nil {
+		return nil, err
+	}
+	in.initial = in.state.clone()
+	if err := in.run(fde.instructions); err != nil {
+		return nil, err
+	}
+	if in.loc < fde.End {
+		in.emit()
+	}
+	return in.rows, nil
+}
+
+// interpreter executes call frame instructions.
+type interpreter struct {
+	fde *FDE
+	loc uint64
+	// initial is the state once the instructions of the CIE ran, DW_CFA_restore reverts to it.
+	initial frameState
+	state   frameState
+	stack   []frameState
+	rows    []stateRow
+}
+
+// emit adds the current state as the row of the current location.
+func (in *interpreter) emit() {
+	row := stateRow{pc: in.loc, state: in.state.clone()}
+	if n := len(in.rows); n > 0 && in.rows[n-1].pc == in.loc {
+		in.rows[n-1] = row
+		return
+	}
+	in.rows = append(in.rows, row)
+}
+
+// advance emits the row of the current location and moves past it by delta code units.
+func (in *interpreter) advance(delta uint64) {
+	in.emit()
+	in.loc += delta * in.fde.cie.codeAlign
+}
+
+func (in *interpreter) run(b []byte) error {
+	r := &cfiReader{b: b, bo: in.fde.cie.file.ByteOrder}
+	c := in.fde.cie
+	for len(r.b) > 0 && r.err == nil && in.loc < in.fde.End {
+		op := r.byte()
+		switch op & 0xc0 {
+		case dwCFAAdvanceLoc:
+			in.advance(uint64(op & 0x3f))
+			continue
+		case dwCFAOffset:
+			in.state.regs[uint64(op&0x3f)] = rule{kind: ruleOffset, offset: int64(r.uleb()) * c.dataAlign}
+			continue
+		case dwCFARestore:
+			in.restore(uint64(op & 0x3f))
+			continue
+		}
+
+		switch op {
+		case dwCFANop:
+		case dwCFASetLoc:
+			if c.encoding&0x70 != 0 {
+				// The pointer is relative to its own address, which is not known here.
+				return errUnsupportedInstruction
+			}
+			loc, n, err := decodePointer(in.fde.cie.file, r.b, c.encoding, 0)
+			if err != nil {
+				return err
+			}
+			r.b = r.b[n:]
+			if loc < in.loc {
+				return fmt.Errorf("DW_CFA_set_loc moves back to %#x", loc)
+			}
+			in.emit()
+			in.loc = loc
+		case dwCFAAdvanceLoc1:
+			in.advance(uint64(r.byte()))
+		case dwCFAAdvanceLoc2:
+			in.advance(uint64(r.u16()))
+		case dwCFAAdvanceLoc4:
+			in.advance(uint64(r.u32()))
+		case dwCFAOffsetExtended:
+			reg := r.uleb()
+			in.state.regs[reg] = rule{kind: ruleOffset, offset: int64(r.uleb()) * c.dataAlign}
+		case dwCFAOffsetExtendedSf:
+			reg := r.uleb()
+			in.state.regs[reg] = rule{kind: ruleOffset, offset: r.sleb() * c.dataAlign}
+		case dwCFAGNUNegativeOffsetExtended:
+			reg := r.uleb()
+			in.state.regs[reg] = rule{kind: ruleOffset, offset: -int64(r.uleb()) * c.dataAlign}
+		case dwCFAValOffset:
+			reg := r.uleb()
+			in.state.regs[reg] = rule{kind: ruleValOffset, offset: int64(r.uleb()) * c.dataAlign}
+		case dwCFAValOffsetSf:
+			reg := r.uleb()
+			in.state.regs[reg] = rule{kind: ruleValOffset, offset: r.sleb() * c.dataAlign}
+		case dwCFARestoreExtended:
+			in.restore(r.uleb())
+		case dwCFAUndefined:
+			in.state.regs[r.uleb()] = rule{kind: ruleUndefined}
+		case dwCFASameValue:
+			delete(in.state.regs, r.uleb())
+		case dwCFARegister:
+			reg := r.uleb()
+			in.state.regs[reg] = rule{kind: ruleRegister, reg: r.uleb()}
+		case dwCFAExpression:
+			reg := r.uleb()
+			in.state.regs[reg] = rule{kind: ruleExpression, expr: r.block()}
+		case dwCFAValExpression:
+			reg := r.uleb()
+			in.state.regs[reg] = rule{kind: ruleValExpression, expr: r.block()}
+		case dwCFARememberState:
+			in.stack = append(in.stack, in.state.clone())
+		case dwCFARestoreState:
+			n := len(in.stack)
+			if n == 0 {
+				return errors.New("DW_CFA_restore_state without remembered state")
+			}
+			in.state, in.stack = in.stack[n-1], in.stack[:n-1]
+		case dwCFADefCFA:
+			in.state.cfa = cfaRule{reg: r.uleb(), offset: int64(r.uleb())}
+		case dwCFADefCFASf:
+			in.state.cfa = cfaRule{reg: r.uleb(), offset: r.sleb() * c.dataAlign}
+		case dwCFADefCFARegister:
+			in.state.cfa = cfaRule{reg: r.uleb(), offset: in.state.cfa.offset}
+		case dwCFADefCFAOffset:
+			in.state.cfa = cfaRule{reg: in.state.cfa.reg, offset: int64(r.uleb())}
+		case dwCFADefCFAOffsetSf:
+			in.state.cfa = cfaRule{reg: in.state.cfa.reg, offset: r.sleb() * c.dataAlign}
+		case dwCFADefCFAExpression:
+			in.state.cfa = cfaRule{expr: r.block()}
+		case dwCFAGNUArgsSize:
+			r.uleb()
+		case dwCFAGNUWindowSave:
+			// The return address of AArch64 is signed, it is stripped of its signature by the
+			// unwinders, not recovered differently.
+		default:
+			return fmt.Errorf("%w %#x", errUnsupportedInstruction, op)
+		}
+	}
+	return r.err
+}
+
+// restore reverts the rule of the register to the one once the instructions of the CIE ran.
+func (in *interpreter) restore(reg uint64) {
+	if v, ok := in.initial.regs[reg]; ok {
+		in.state.regs[reg] = v
+		return
+	}
+	delete(in.state.regs, reg)
+}
+
+// cfiReader reads the operands of call frame instructions, err is set once they are truncated.
+type cfiReader struct {
+	b   []byte
+	bo  binary.ByteOrder
+	err error
+}
+
+var errTruncatedInstruction = errors.New("truncated call frame instruction")
+
+// take returns the next n bytes, or zeros once the operands are truncated.
+func (r *cfiReader) take(n int) []byte {
+	if r.err != nil || n > len(r.b) {
+		r.err = errTruncatedInstruction
+		r.b = nil
+		return make([]byte, n)
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *cfiReader) byte() byte {
+	return r.take(1)[0]
+}
+
+func (r *cfiReader) u16() uint16 {
+	return r.bo.Uint16(r.take(2))
+}
+
+func (r *cfiReader) u32() uint32 {
+	return r.bo.Uint32(r.take(4))
+}
+
+func (r *cfiReader) uleb() uint64 {
+	v, n := uleb128(r.b)
+	if n == 0 {
+		r.err = errTruncatedInstruction
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *cfiReader) sleb() int64 {
+	v, n := sleb128(r.b)
+	if n == 0 {
+		r.err = errTruncatedInstruction
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// block reads a DWARF expression, prefixed by its size.
+func (r *cfiReader) block() []byte {
+	n := r.uleb()
+	if r.err != nil || n > uint64(len(r.b)) {
+		r.err = errTruncatedInstruction
+		return nil
+	}
+	return r.take(int(n))
+}
@@ -0,0 +1,354 @@
+package unwind
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+)
+
+// DWARF exception header pointer encodings, see
+// https://refspecs.linuxfoundation.org/LSB_5.0.0/LSB-Core-generic/LSB-Core-generic/dwarfext.html.
+const (
+	dwEHPEAbsptr  = 0x00
+	dwEHPEUleb128 = 0x01
+	dwEHPEUdata2  = 0x02
+	dwEHPEUdata4  = 0x03
+	dwEHPEUdata8  = 0x04
+	dwEHPESleb128 = 0x09
+	dwEHPESdata2  = 0x0a
+	dwEHPESdata4  = 0x0b
+	dwEHPESdata8  = 0x0c
+	dwEHPEPcrel   = 0x10
+	dwEHPEOmit    = 0xff
+)
+
+// errUnsupportedEncoding is returned for pointers relative to bases other than their own address,
+// which the FDEs of executables and shared libraries do not use.
+var errUnsupportedEncoding = errors.New("unsupported pointer encoding")
+
+// FDE is a frame description entry of .eh_frame: the address range [Start, End) of a function
+// and the call frame instructions to unwind it.
+type FDE struct {
+	Start uint64
+	End   uint64
+
+	cie          *cie
+	instructions []byte
+}
+
+// cie is a common information entry, the part of the FDEs they share.
+type cie struct {
+	file      *elf.File
+	codeAlign uint64
+	dataAlign int64
+	// returnAddress is the register of the return address.
+	returnAddress uint64
+	// encoding is the encoding of the pointers of the FDEs.
+	encoding byte
+	// augmented reports whether the FDEs have augmentation data, to be skipped.
+	augmented    bool
+	instructions []byte
+}
+
+// FDEs returns the FDEs of .eh_frame, in the order of the section. FDEs with pointers of
+// unsupported encodings and the ones of discarded functions, zeroed by the linker, are skipped.
+// Relocatable objects have none, their FDEs are only meaningful once relocated, nor have debug
+// files, where .eh_frame has no contents.
+func FDEs(f *elf.File) ([]FDE, error) {
+	if f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN {
+		return nil, nil
+	}
+	s := f.Section(".eh_frame")
+	if s == nil || s.Type == elf.SHT_NOBITS {
+		return nil, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ehFrame{f: f, data: data, addr: s.Addr, cies: make(map[uint64]*cie)}
+	var fdes []FDE
+	for off := uint64(0); off < uint64(len(data)); {
+		start, end, err := p.record(off)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			// The zero terminator.
+			break
+		}
+		if id := f.ByteOrder.Uint32(data[start:]); id != 0 {
+			fde, err := p.fde(start, end, id)
+			if errors.Is(err, errUnsupportedEncoding) {
+				off = end
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid FDE at offset %#x: %w", off, err)
+			}
+			if fde.Start != 0 && fde.End > fde.Start {
+				fdes = append(fdes, fde)
+			}
+		}
+		off = end
+	}
+	return fdes, nil
+}
+
+// ehFrame reads the records of a .eh_frame section at addr.
+type ehFrame struct {
+	f    *elf.File
+	data []byte
+	addr uint64
+	// cies are the CIEs read, by offset.
+	cies map[uint64]*cie
+}
+
+// record returns the offsets of the contents of the record at off, past its length, and of its
+// end. They are equal for the terminator.
+func (p *ehFrame) record(off uint64) (uint64, uint64, error) {
+	size := uint64(len(p.data))
+	if off+4 > size {
+		return 0, 0, fmt.Errorf("truncated record at offset %#x", off)
+	}
+	length := uint64(p.f.ByteOrder.Uint32(p.data[off:]))
+	start := off + 4
+	if length == 0xffffffff {
+		if start+8 > size {
+			return 0, 0, fmt.Errorf("truncated record at offset %#x", off)
+		}
+		length = p.f.ByteOrder.Uint64(p.data[start:])
+		start += 8
+	}
+	if length == 0 {
+		return start, start, nil
+	}
+	if length < 4 || length > size-start {
+		return 0, 0, fmt.Errorf("invalid record length %d at offset %#x", length, off)
+	}
+	return start, start + length, nil
+}
+
+// fde reads the FDE in [start, end), whose CIE pointer is id.
+func (p *ehFrame) fde(start, end uint64, id uint32) (FDE, error) {
+	if uint64(id) > start {
+		return FDE{}, fmt.Errorf("invalid CIE pointer %#x", id)
+	}
+	c, err := p.cie(start - uint64(id))
+	if err != nil {
+		return FDE{}, err
+	}
+	if c.encoding == dwEHPEOmit {
+		return FDE{}, errUnsupportedEncoding
+	}
+
+	pos := start + 4
+	begin, n, err := decodePointer(p.f, p.data[pos:end], c.encoding, p.addr+pos)
+	if err != nil {
+		return FDE{}, err
+	}
+	pos += uint64(n)
+	// The range is an unsigned length of the same size.
+	length, n, err := decodePointer(p.f, p.data[pos:end], c.encoding&0x0f, 0)
+	if err != nil {
+		return FDE{}, err
+	}
+	pos += uint64(n)
+	if c.augmented {
+		size, n := uleb128(p.data[pos:end])
+		if n == 0 || size > end-pos-uint64(n) {
+			return FDE{}, errors.New("truncated augmentation data")
+		}
+		pos += uint64(n) + size
+	}
+	return FDE{Start: begin, End: begin + length, cie: c, instructions: p.data[pos:end]}, nil
+}
+
+// cie returns the CIE at off.
+func (p *ehFrame) cie(off uint64) (*cie, error) {
+	if c, ok := p.cies[off]; ok {
+		return c, nil
+	}
+	start, end, err := p.record(off)
+	if err != nil {
+		return nil, err
+	}
+	if start == end || p.f.ByteOrder.Uint32(p.data[start:]) != 0 {
+		return nil, fmt.Errorf("no CIE at offset %#x", off)
+	}
+	c, err := p.parseCIE(p.data[start+4 : end])
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIE at offset %#x: %w", off, err)
+	}
+	p.cies[off] = c
+	return c, nil
+}
+
+// parseCIE parses the CIE b, past its ID. The pointers of its FDEs default to absolute ones.
+func (p *ehFrame) parseCIE(b []byte) (*cie, error) {
+	errTruncated := errors.New("truncated CIE")
+	if len(b) < 1 {
+		return nil, errTruncated
+	}
+	version := b[0]
+	i := bytes.IndexByte(b[1:], 0)
+	if i < 0 {
+		return nil, errors.New("unterminated augmentation string")
+	}
+	aug := string(b[1 : 1+i])
+	b = b[2+i:]
+	if aug != "" && aug[0] != 'z' {
+		// The layout of the CIEs of other augmentations, e.g. the eh of old versions of GCC,
+		// is not known.
+		return &cie{file: p.f, encoding: dwEHPEOmit}, nil
+	}
+
+	c := &cie{file: p.f, encoding: dwEHPEAbsptr, augmented: aug != ""}
+	var n int
+	if c.codeAlign, n = uleb128(b); n == 0 {
+		return nil, errTruncated
+	}
+	b = b[n:]
+	if c.dataAlign, n = sleb128(b); n == 0 {
+		return nil, errTruncated
+	}
+	b = b[n:]
+	if version == 1 {
+		if len(b) == 0 {
+			return nil, errTruncated
+		}
+		c.returnAddress, b = uint64(b[0]), b[1:]
+	} else {
+		if c.returnAddress, n = uleb128(b); n == 0 {
+			return nil, errTruncated
+		}
+		b = b[n:]
+	}
+
+	if c.augmented {
+		size, n := uleb128(b)
+		if n == 0 || size > uint64(len(b)-n) {
+			return nil, errTruncated
+		}
+		data := b[n : n+int(size)]
+		c.instructions = b[n+int(size):]
+		for _, a := range aug[1:] {
+			if len(data) == 0 && (a == 'R' || a == 'P' || a == 'L') {
+				return nil, errors.New("truncated augmentation data")
+			}
+			switch a {
+			case 'R':
+				c.encoding, data = data[0], data[1:]
+			case 'P':
+				_, n, err := decodePointer(p.f, data[1:], data[0]&0x0f, 0)
+				if err != nil {
+					return nil, err
+				}
+				data = data[1+n:]
+			case 'L':
+				data = data[1:]
+			case 'S', 'B', 'G':
+			default:
+				// The size of unknown augmentations is unknown, the rest of them is skipped.
+				return c, nil
+			}
+		}
+		return c, nil
+	}
+	c.instructions = b
+	return c, nil
+}
+
+// decodePointer decodes the pointer at the start of b with the given encoding, pc is its address.
+// It returns the pointer and its size.
+func decodePointer(f *elf.File, b []byte, enc byte, pc uint64) (uint64, int, error) {
+	format := enc & 0x0f
+	if format == dwEHPEAbsptr {
+		format = dwEHPEUdata4
+		if f.Class == elf.ELFCLASS64 {
+			format = dwEHPEUdata8
+		}
+	}
+
+	var (
+		v uint64
+		n int
+	)
+	bo := f.ByteOrder
+	switch format {
+	case dwEHPEUleb128:
+		v, n = uleb128(b)
+	case dwEHPESleb128:
+		var s int64
+		s, n = sleb128(b)
+		v = uint64(s)
+	case dwEHPEUdata2, dwEHPESdata2:
+		if n = 2; len(b) >= n {
+			v = uint64(bo.Uint16(b))
+			if format == dwEHPESdata2 {
+				v = uint64(int64(int16(v)))
+			}
+		}
+	case dwEHPEUdata4, dwEHPESdata4:
+		if n = 4; len(b) >= n {
+			v = uint64(bo.Uint32(b))
+			if format == dwEHPESdata4 {
+				v = uint64(int64(int32(v)))
+			}
+		}
+	case dwEHPEUdata8, dwEHPESdata8:
+		if n = 8; len(b) >= n {
+			v = bo.Uint64(b)
+		}
+	default:
+		return 0, 0, fmt.Errorf("invalid pointer encoding %#x", enc)
+	}
+	if n == 0 || n > len(b) {
+		return 0, 0, errors.New("truncated pointer")
+	}
+
+	switch enc & 0x70 {
+	case 0:
+	case dwEHPEPcrel:
+		v += pc
+	default:
+		return 0, 0, errUnsupportedEncoding
+	}
+	if enc&0x80 != 0 {
+		return 0, 0, errUnsupportedEncoding
+	}
+	return v, n, nil
+}
+
+// uleb128 decodes an unsigned LEB128 number, it returns a zero size if b is truncated.
+func uleb128(b []byte) (uint64, int) {
+	var v uint64
+	for i, c := range b {
+		if i < 10 {
+			v |= uint64(c&0x7f) << (7 * i)
+		}
+		if c&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// sleb128 decodes a signed LEB128 number, it returns a zero size if b is truncated.
+func sleb128(b []byte) (int64, int) {
+	var v int64
+	for i, c := range b {
+		if i < 10 {
+			v |= int64(c&0x7f) << (7 * i)
+		}
+		if c&0x80 == 0 {
+			if shift := 7 * (i + 1); shift < 64 && c&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,323 @@
+// Package unwind builds compact unwind tables from the call frame information of .eh_frame, like
+// the unwind information Parca Agent loads into its eBPF unwinder, so stacks of code built without
+// frame pointers can be walked without DWARF.
+//
+// A table has a row for each address where the way to unwind changes: how the canonical frame
+// address (CFA), the stack pointer of the caller, is computed from the stack or frame pointer,
+// and where the frame pointer of the caller, and on AArch64 its return address, is saved. Only
+// x86-64 and AArch64 are supported.
+package unwind
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// SectionName is the name of the section the compact unwind table is stored in.
+const SectionName = ".unwind_table"
+
+// ErrUnsupportedMachine is returned for the machines the table cannot describe the registers of.
+var ErrUnsupportedMachine = errors.New("unsupported machine")
+
+// CFAType is how the CFA of a row is computed.
+type CFAType uint8
+
+const (
+	// CFATypeFP is the frame pointer plus the offset of the row.
+	CFATypeFP CFAType = 1
+	// CFATypeSP is the stack pointer plus the offset of the row.
+	CFATypeSP CFAType = 2
+	// CFATypeExpression is a DWARF expression, the offset of the row tells which one of the
+	// expressions of the x86-64 PLT stubs: 1 for the ones of .plt, 2 for the ones of the PLT of
+	// binaries built with -fcf-protection.
+	CFATypeExpression CFAType = 3
+	// CFATypeEndOfFDE marks the end of a function, the addresses up to the next row have no
+	// unwind information.
+	CFATypeEndOfFDE CFAType = 4
+)
+
+// FPType is where the frame pointer of the caller is recovered from.
+type FPType uint8
+
+const (
+	// FPTypeUnchanged is the frame pointer, not changed by the function.
+	FPTypeUnchanged FPType = 0
+	// FPTypeOffset is saved at the CFA plus the frame pointer offset of the row.
+	FPTypeOffset FPType = 1
+	// FPTypeRegister is saved in another register.
+	FPTypeRegister FPType = 2
+	// FPTypeExpression is given by a DWARF expression.
+	FPTypeExpression FPType = 3
+	// FPTypeUndefinedReturnAddress marks the outermost frames, e.g. _start, whose return address
+	// is undefined: the stack ends there.
+	FPTypeUndefinedReturnAddress FPType = 4
+)
+
+// Row is a row of the compact unwind table, it applies from PC up to the next row.
+type Row struct {
+	PC uint64
+	// LROffset is the offset from the CFA the link register is saved at on AArch64, zero if it
+	// is not saved.
+	LROffset  int16
+	CFAType   CFAType
+	FPType    FPType
+	CFAOffset int16
+	FPOffset  int16
+}
+
+// Table is the compact unwind table of an object file, its rows are sorted by address.
+type Table struct {
+	Machine elf.Machine
+	Rows    []Row
+	// Skipped is the number of FDEs that are not in the table, as the rows cannot express how to
+	// unwind them, e.g. the CFA is computed from another register.
+	Skipped int
+}
+
+// registers are the DWARF register numbers of a machine.
+type registers struct {
+	fp, sp, lr uint64
+}
+
+var machineRegisters = map[elf.Machine]registers{
+	elf.EM_X86_64:  {fp: 6, sp: 7},
+	elf.EM_AARCH64: {fp: 29, sp: 31, lr: 30},
+}
+
+// The CFA expressions of the x86-64 PLT stubs: rsp + 8 + ((rip & 15) >= 11 ? 8 : 0), with 10 in
+// place of 11 for the PLT of binaries built with -fcf-protection.
+var (
+	pltExpression    = []byte{0x77, 0x08, 0x80, 0x00, 0x3f, 0x1a, 0x3b, 0x2a, 0x33, 0x24, 0x22}
+	pltSecExpression = []byte{0x77, 0x08, 0x80, 0x00, 0x3f, 0x1a, 0x3a, 0x2a, 0x33, 0x24, 0x22}
+)
+
+// Build returns the compact unwind table of the FDEs of .eh_frame of the given file. The table of
+// files without FDEs, e.g. Go binaries and debug files, has no rows.
+func Build(f *elf.File) (*Table, error) {
+	if _, ok := machineRegisters[f.Machine]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMachine, f.Machine)
+	}
+	fdes, err := FDEs(f)
+	if err != nil {
+		return nil, err
+	}
+	return newTable(f.Machine, fdes), nil
+}
+
+// newTable returns the table of the FDEs of a supported machine.
+func newTable(m elf.Machine, fdes []FDE) *Table {
+	regs := machineRegisters[m]
+	t := &Table{Machine: m}
+	var rows []Row
+	for i := range fdes {
+		fde := &fdes[i]
+		states, err := fde.rows()
+		if err != nil {
+			t.Skipped++
+			continue
+		}
+		fdeRows := make([]Row, 0, len(states)+1)
+		for _, s := range states {
+			row, ok := compact(s, regs, fde.cie.returnAddress, m)
+			if !ok {
+				fdeRows = nil
+				break
+			}
+			fdeRows = append(fdeRows, row)
+		}
+		if fdeRows == nil {
+			t.Skipped++
+			continue
+		}
+		rows = append(append(rows, fdeRows...), Row{PC: fde.End, CFAType: CFATypeEndOfFDE})
+	}
+	t.Rows = dedup(rows)
+	return t
+}
+
+// compact returns the row of the state, if the row can express it.
+func compact(s stateRow, regs registers, ra uint64, m elf.Machine) (Row, bool) {
+	row := Row{PC: s.pc}
+	cfa := s.state.cfa
+	switch {
+	case cfa.expr != nil:
+		row.CFAType = CFATypeExpression
+		switch {
+		case m == elf.EM_X86_64 && bytes.Equal(cfa.expr, pltExpression):
+			row.CFAOffset = 1
+		case m == elf.EM_X86_64 && bytes.Equal(cfa.expr, pltSecExpression):
+			row.CFAOffset = 2
+		default:
+			return Row{}, false
+		}
+	case cfa.reg == regs.fp:
+		row.CFAType = CFATypeFP
+	case cfa.reg == regs.sp:
+		row.CFAType = CFATypeSP
+	default:
+		return Row{}, false
+	}
+	if cfa.expr == nil {
+		off, ok := int16Offset(cfa.offset)
+		if !ok {
+			return Row{}, false
+		}
+		row.CFAOffset = off
+	}
+
+	if r, ok := s.state.regs[ra]; ok && r.kind == ruleUndefined {
+		row.FPType = FPTypeUndefinedReturnAddress
+		return row, true
+	}
+
+	switch r := s.state.regs[regs.fp]; r.kind {
+	case ruleSameValue, ruleUndefined:
+		row.FPType = FPTypeUnchanged
+	case ruleOffset:
+		off, ok := int16Offset(r.offset)
+		if !ok {
+			return Row{}, false
+		}
+		row.FPType, row.FPOffset = FPTypeOffset, off
+	case ruleRegister:
+		row.FPType = FPTypeRegister
+	case ruleExpression:
+		row.FPType = FPTypeExpression
+	default:
+		return Row{}, false
+	}
+
+	if m == elf.EM_AARCH64 {
+		switch r := s.state.regs[regs.lr]; r.kind {
+		case ruleSameValue:
+		case ruleOffset:
+			off, ok := int16Offset(r.offset)
+			if !ok {
+				return Row{}, false
+			}
+			row.LROffset = off
+		default:
+			return Row{}, false
+		}
+	}
+	return row, true
+}
+
+func int16Offset(v int64) (int16, bool) {
+	if v < math.MinInt16 || v > math.MaxInt16 {
+		return 0, false
+	}
+	return int16(v), true
+}
+
+// dedup sorts the rows by address and drops the rows that do not change the unwind information,
+// and the end markers of the functions followed by another one.
+func dedup(rows []Row) []Row {
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].PC != rows[j].PC {
+			return rows[i].PC < rows[j].PC
+		}
+		return rows[i].CFAType != CFATypeEndOfFDE && rows[j].CFAType == CFATypeEndOfFDE
+	})
+	// Of the rows of the same address, e.g. the end of a function and the start of the next one,
+	// the first one is kept.
+	kept := rows[:0]
+	for _, r := range rows {
+		if n := len(kept); n == 0 || kept[n-1].PC != r.PC {
+			kept = append(kept, r)
+		}
+	}
+	rows, kept = kept, kept[:0]
+	for _, r := range rows {
+		if n := len(kept); n > 0 {
+			prev := kept[n-1]
+			prev.PC = r.PC
+			if prev == r {
+				continue
+			}
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// The binary encoding of a table is little-endian:
+//
+//	magic   [4]byte  "UNWT"
+//	version uint32   1
+//	machine uint16   e_machine
+//	_       uint16
+//	count   uint32   number of rows
+//	rows    [count]struct {
+//		pc         uint64
+//		lr_offset  int16
+//		cfa_type   uint8
+//		fp_type    uint8
+//		cfa_offset int16
+//		fp_offset  int16
+//	}
+const (
+	magic         = "UNWT"
+	binaryVersion = 1
+	headerSize    = 16
+	rowSize       = 16
+)
+
+// MarshalBinary encodes the table in the binary encoding, stored in the SectionName section.
+func (t *Table) MarshalBinary() ([]byte, error) {
+	if uint64(len(t.Rows)) > math.MaxUint32 {
+		return nil, errors.New("too many rows")
+	}
+	b := make([]byte, headerSize+rowSize*len(t.Rows))
+	le := binary.LittleEndian
+	copy(b, magic)
+	le.PutUint32(b[4:], binaryVersion)
+	le.PutUint16(b[8:], uint16(t.Machine))
+	le.PutUint32(b[12:], uint32(len(t.Rows)))
+	for i, r := range t.Rows {
+		e := b[headerSize+i*rowSize:]
+		le.PutUint64(e[0:], r.PC)
+		le.PutUint16(e[8:], uint16(r.LROffset))
+		e[10] = byte(r.CFAType)
+		e[11] = byte(r.FPType)
+		le.PutUint16(e[12:], uint16(r.CFAOffset))
+		le.PutUint16(e[14:], uint16(r.FPOffset))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a table in the binary encoding. The number of skipped FDEs is not
+// encoded.
+func (t *Table) UnmarshalBinary(b []byte) error {
+	if len(b) < headerSize || string(b[:4]) != magic {
+		return errors.New("not an unwind table")
+	}
+	le := binary.LittleEndian
+	if v := le.Uint32(b[4:]); v != binaryVersion {
+		return fmt.Errorf("unsupported unwind table version %d", v)
+	}
+	count := uint64(le.Uint32(b[12:]))
+	if headerSize+count*rowSize != uint64(len(b)) {
+		return errors.New("truncated unwind table")
+	}
+	t.Machine = elf.Machine(le.Uint16(b[8:]))
+	t.Rows = make([]Row, count)
+	for i := range t.Rows {
+		e := b[headerSize+i*rowSize:]
+		t.Rows[i] = Row{
+			PC:        le.Uint64(e[0:]),
+			LROffset:  int16(le.Uint16(e[8:])),
+			CFAType:   CFAType(e[10]),
+			FPType:    FPType(e[11]),
+			CFAOffset: int16(le.Uint16(e[12:])),
+			FPOffset:  int16(le.Uint16(e[14:])),
+		}
+	}
+	t.Skipped = 0
+	return nil
+}
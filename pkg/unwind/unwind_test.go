@@ -0,0 +1,183 @@
+package unwind
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"runtime"
+	"testing"
+
+	"github.com/polarsignals/split-debug/pkg/elfwriter/elfwritertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBinary = "../../dist/split-debug"
+
+// testCIE is the CIE GCC emits on x86-64: the CFA is rsp+8 and the return address is saved at
+// CFA-8.
+func testCIE() *cie {
+	return &cie{
+		file: &elf.File{FileHeader: elf.FileHeader{
+			Class:     elf.ELFCLASS64,
+			ByteOrder: binary.LittleEndian,
+			Machine:   elf.EM_X86_64,
+		}},
+		codeAlign:     1,
+		dataAlign:     -8,
+		returnAddress: 16,
+		instructions: []byte{
+			dwCFADefCFA, 7, 8,
+			dwCFAOffset | 16, 1,
+		},
+	}
+}
+
+func TestNewTable(t *testing.T) {
+	fdes := []FDE{
+		{
+			// push %rbp; mov %rsp,%rbp; ...; leave; ret; ...
+			Start: 0x1000,
+			End:   0x1020,
+			cie:   testCIE(),
+			instructions: []byte{
+				dwCFAAdvanceLoc | 1,
+				dwCFADefCFAOffset, 16,
+				dwCFAOffset | 6, 2,
+				dwCFAAdvanceLoc | 3,
+				dwCFADefCFARegister, 6,
+				dwCFAAdvanceLoc | 0x10,
+				dwCFARememberState,
+				dwCFADefCFA, 7, 8,
+				dwCFAAdvanceLoc | 1,
+				dwCFARestoreState,
+			},
+		},
+		{
+			// A leaf function right after the first one, its first row matches the last one of
+			// the first function.
+			Start: 0x1020,
+			End:   0x1030,
+			cie:   testCIE(),
+		},
+		{
+			// _start, where the stack ends.
+			Start: 0x2000,
+			End:   0x2010,
+			cie:   testCIE(),
+			instructions: []byte{
+				dwCFAUndefined, 16,
+			},
+		},
+		{
+			// The CFA is computed from another register, e.g. in the code of a signal trampoline.
+			Start: 0x3000,
+			End:   0x3010,
+			cie:   testCIE(),
+			instructions: []byte{
+				dwCFADefCFA, 3, 8,
+			},
+		},
+		{
+			// A truncated instruction.
+			Start:        0x4000,
+			End:          0x4010,
+			cie:          testCIE(),
+			instructions: []byte{dwCFADefCFA, 7},
+		},
+	}
+
+	table := newTable(elf.EM_X86_64, fdes)
+	require.Equal(t, 2, table.Skipped)
+	require.Equal(t, []Row{
+		{PC: 0x1000, CFAType: CFATypeSP, CFAOffset: 8},
+		{PC: 0x1001, CFAType: CFATypeSP, CFAOffset: 16, FPType: FPTypeOffset, FPOffset: -16},
+		{PC: 0x1004, CFAType: CFATypeFP, CFAOffset: 16, FPType: FPTypeOffset, FPOffset: -16},
+		{PC: 0x1014, CFAType: CFATypeSP, CFAOffset: 8, FPType: FPTypeOffset, FPOffset: -16},
+		{PC: 0x1015, CFAType: CFATypeFP, CFAOffset: 16, FPType: FPTypeOffset, FPOffset: -16},
+		{PC: 0x1020, CFAType: CFATypeSP, CFAOffset: 8},
+		{PC: 0x1030, CFAType: CFATypeEndOfFDE},
+		{PC: 0x2000, CFAType: CFATypeSP, CFAOffset: 8, FPType: FPTypeUndefinedReturnAddress},
+		{PC: 0x2010, CFAType: CFATypeEndOfFDE},
+	}, table.Rows)
+}
+
+func TestTableBinary(t *testing.T) {
+	table := &Table{
+		Machine: elf.EM_AARCH64,
+		Rows: []Row{
+			{PC: 0x1000, CFAType: CFATypeSP},
+			{PC: 0x1004, CFAType: CFATypeSP, CFAOffset: 16, FPType: FPTypeOffset, FPOffset: -16, LROffset: -8},
+			{PC: 0x1010, CFAType: CFATypeEndOfFDE},
+		},
+	}
+	data, err := table.MarshalBinary()
+	require.NoError(t, err)
+	require.Len(t, data, headerSize+len(table.Rows)*rowSize)
+
+	var got Table
+	require.NoError(t, got.UnmarshalBinary(data))
+	require.Equal(t, *table, got)
+
+	require.Error(t, got.UnmarshalBinary(data[:len(data)-1]))
+	require.Error(t, got.UnmarshalBinary([]byte("not an unwind table")))
+}
+
+func TestBuild(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("C fixture requires an x86-64 host")
+	}
+	f, err := elf.Open(elfwritertest.BuildC(t, `
+#include <stdio.h>
+int work(int x) { puts("work"); return x * 3; }
+int main(int argc, char **argv) { printf("%d\n", work(argc)); return 0; }
+`, "-O1"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	fdes, err := FDEs(f)
+	require.NoError(t, err)
+	require.NotEmpty(t, fdes)
+	table, err := Build(f)
+	require.NoError(t, err)
+	require.Zero(t, table.Skipped)
+
+	syms, err := f.Symbols()
+	require.NoError(t, err)
+	starts := make(map[uint64]bool)
+	for _, s := range syms {
+		if s.Name == "main" || s.Name == "work" {
+			starts[s.Value] = true
+		}
+	}
+	require.Len(t, starts, 2)
+
+	for i, r := range table.Rows {
+		if i > 0 {
+			require.Less(t, table.Rows[i-1].PC, r.PC)
+		}
+		// On entry the CFA is the stack pointer past the return address.
+		if starts[r.PC] {
+			require.Equal(t, Row{PC: r.PC, CFAType: CFATypeSP, CFAOffset: 8}, r)
+			delete(starts, r.PC)
+		}
+	}
+	// work directly follows main or the other way around, the row of the second one can be the
+	// same as the last one of the first.
+	require.LessOrEqual(t, len(starts), 1)
+	require.Equal(t, CFATypeEndOfFDE, table.Rows[len(table.Rows)-1].CFAType)
+}
+
+func TestBuild_Go(t *testing.T) {
+	f, err := elf.Open(testBinary)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// Go binaries have no .eh_frame, they are walked with the frame pointers.
+	table, err := Build(f)
+	if f.Machine != elf.EM_X86_64 && f.Machine != elf.EM_AARCH64 {
+		require.ErrorIs(t, err, ErrUnsupportedMachine)
+		return
+	}
+	require.NoError(t, err)
+	require.Empty(t, table.Rows)
+}
@@ -0,0 +1,160 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// WithChunks uploads the debug files larger than size in PUT requests of at most size bytes,
+// each with the range of the file it carries in the Content-Range header, e.g. bytes 0-1023/4096.
+// The server acknowledges a chunk with a 2xx or a 308 status, and may set the Range header, e.g.
+// bytes=0-1023, to the bytes it has kept so far. The uploaded offset is kept in a state file per
+// build ID in stateDir, so uploads that fail or are interrupted resume from it on the next attempt
+// with the same contents.
+func WithChunks(size int64, stateDir string) Option {
+	return func(u *HTTP) {
+		u.chunkSize = size
+		u.stateDir = stateDir
+	}
+}
+
+// uploadState is the progress of a chunked upload, it is only valid for the same target and
+// contents: a debug file extracted again with the same build ID and size may still differ, e.g.
+// with other compression settings, and resuming would splice the two files.
+type uploadState struct {
+	BuildID string `json:"build_id"`
+	URL     string `json:"url"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Offset  int64  `json:"offset"`
+}
+
+func (u *HTTP) uploadChunks(ctx context.Context, buildID, target string, r io.ReaderAt, size int64) error {
+	sum, err := sha256Of(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to hash debug file of %s: %w", buildID, err)
+	}
+	statePath := filepath.Join(u.stateDir, url.PathEscape(buildID)+".json")
+	st, err := readState(statePath)
+	if err != nil || st.BuildID != buildID || st.URL != target || st.Size != size || st.SHA256 != sum {
+		st = uploadState{BuildID: buildID, URL: target, Size: size, SHA256: sum}
+	}
+
+	for st.Offset < size {
+		n := size - st.Offset
+		if n > u.chunkSize {
+			n = u.chunkSize
+		}
+		next, err := u.putChunk(ctx, buildID, target, r, st.Offset, n, size)
+		if err != nil {
+			return err
+		}
+		if next == st.Offset {
+			return fmt.Errorf("upload of %s failed: server did not keep the chunk at offset %d", buildID, st.Offset)
+		}
+		st.Offset = next
+		if st.Offset < size {
+			if err := writeState(statePath, st); err != nil {
+				return fmt.Errorf("failed to write upload state: %w", err)
+			}
+		}
+	}
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload state: %w", err)
+	}
+	return nil
+}
+
+// putChunk uploads n bytes of the file at off and returns the offset to continue from.
+func (u *HTTP) putChunk(ctx context.Context, buildID, target string, r io.ReaderAt, off, n, size int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, u.body(r, off, n))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = n
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", off, off+n-1, size))
+	u.setHeaders(req, buildID)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusPermanentRedirect {
+		return 0, fmt.Errorf("upload of %s failed at offset %d with %w", buildID, off, newStatusError(resp))
+	}
+
+	receiptFrom(ctx).accepted(resp)
+	kept := resp.Header.Get("Range")
+	if kept == "" {
+		return off + n, nil
+	}
+	end, err := parseRangeEnd(kept)
+	if err != nil || end >= size {
+		return 0, fmt.Errorf("upload of %s failed: invalid Range header %q", buildID, kept)
+	}
+	return end + 1, nil
+}
+
+// parseRangeEnd returns the last byte of a range starting at 0, e.g. bytes=0-1023.
+func parseRangeEnd(s string) (int64, error) {
+	s = strings.TrimPrefix(s, "bytes=")
+	if !strings.HasPrefix(s, "0-") {
+		return 0, fmt.Errorf("range %q does not start at 0", s)
+	}
+	return strconv.ParseInt(s[len("0-"):], 10, 64)
+}
+
+// sha256Of returns the hex encoded SHA-256 digest of the first size bytes of r.
+func sha256Of(r io.ReaderAt, size int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readState(path string) (uploadState, error) {
+	var st uploadState
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(data, &st)
+	return st, err
+}
+
+// writeState replaces the state file atomically, an interrupted write leaves the previous state.
+func writeState(path string, st uploadState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,105 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPChunks(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []byte
+		ranges   []string
+		failAt   = int64(8)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		cr := r.Header.Get("Content-Range")
+		ranges = append(ranges, cr)
+		var start, end, size int64
+		_, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size)
+		require.NoError(t, err)
+		if start == failAt {
+			failAt = -1
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(received)), start)
+		received = append(received, b...)
+		if end+1 < size {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", end))
+			w.WriteHeader(http.StatusPermanentRedirect)
+		}
+	}))
+	defer srv.Close()
+
+	stateDir := t.TempDir()
+	u, err := NewHTTP(srv.URL+"/debuginfo/{build_id}", WithChunks(4, stateDir))
+	require.NoError(t, err)
+	data := "chunked debug file"
+
+	err = u.Upload(context.Background(), "abcd", strings.NewReader(data), int64(len(data)))
+	require.EqualError(t, err, "upload of abcd failed at offset 8 with 503 Service Unavailable: unavailable")
+	st, err := readState(filepath.Join(stateDir, "abcd.json"))
+	require.NoError(t, err)
+	require.Equal(t, int64(8), st.Offset)
+
+	require.NoError(t, u.Upload(context.Background(), "abcd", strings.NewReader(data), int64(len(data))))
+	require.Equal(t, data, string(received))
+	require.Equal(t, []string{
+		"bytes 0-3/18", "bytes 4-7/18", "bytes 8-11/18",
+		"bytes 8-11/18", "bytes 12-15/18", "bytes 16-17/18",
+	}, ranges)
+	_, err = os.Stat(filepath.Join(stateDir, "abcd.json"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestHTTPChunks_ContentsChanged(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		starts []int64
+		failAt = int64(8)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var start, end, size int64
+		_, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size)
+		require.NoError(t, err)
+		starts = append(starts, start)
+		if start == failAt {
+			failAt = -1
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if end+1 < size {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", end))
+			w.WriteHeader(http.StatusPermanentRedirect)
+		}
+	}))
+	defer srv.Close()
+
+	stateDir := t.TempDir()
+	u, err := NewHTTP(srv.URL+"/debuginfo/{build_id}", WithChunks(4, stateDir))
+	require.NoError(t, err)
+	data := "chunked debug file"
+	require.Error(t, u.Upload(context.Background(), "abcd", strings.NewReader(data), int64(len(data))))
+
+	// A debug file with the same build ID and size but other contents starts over.
+	other := strings.ToUpper(data)
+	require.NoError(t, u.Upload(context.Background(), "abcd", strings.NewReader(other), int64(len(other))))
+	require.Equal(t, []int64{0, 4, 8, 0, 4, 8, 12, 16}, starts)
+}
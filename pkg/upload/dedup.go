@@ -0,0 +1,176 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/digest"
+)
+
+// SHA256Header is the header the HTTP uploader sends the SHA-256 digest of the debug file in,
+// as lower case hex, and reads it from in the responses of Exists.
+const SHA256Header = "X-Content-SHA256"
+
+// DigestHeader returns the header the HTTP uploader sends the digest of the debug file of the hash
+// algorithm in, e.g. X-Content-BLAKE3, and reads it from in the responses of Exists. It is
+// SHA256Header for SHA-256.
+func DigestHeader(a digest.Algorithm) string {
+	return "X-Content-" + strings.ToUpper(a.Name())
+}
+
+// ErrAlreadyUploaded is returned by Dedup for debug files the server has already.
+var ErrAlreadyUploaded = errors.New("debug file already uploaded")
+
+// Checker checks whether the server has the debug file of a build ID already.
+type Checker interface {
+	Exists(ctx context.Context, buildID, digest string) (bool, error)
+}
+
+// Exists checks whether the server has the debug file of the build ID with a HEAD request of its
+// URL. It does unless the server answers with 404, or with a different digest in the
+// X-Content-SHA256 header, or the header of the hash algorithm of Dedup.
+func (u *HTTP) Exists(ctx context.Context, buildID, digest string) (bool, error) {
+	header := digestFrom(ctx).header()
+	target := TargetURL(u.url, buildID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+	if err != nil {
+		return false, err
+	}
+	u.setHeaders(req, buildID)
+	req.Header.Del("Content-Type")
+	if digest != "" {
+		req.Header.Set(header, digest)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode/100 != 2:
+		return false, fmt.Errorf("check of %s failed with %w", buildID, newStatusError(resp))
+	}
+	if got := resp.Header.Get(header); got != "" && digest != "" && !strings.EqualFold(got, digest) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Dedup skips the uploads of debug files the server has already. The build IDs and digests of
+// the uploaded files are kept in a directory, so files that did not change are skipped without
+// asking the server. Other files are checked with the Checker, if there is one, before they are
+// uploaded; failed checks fall back to uploading.
+type Dedup struct {
+	u    Uploader
+	c    Checker
+	dir  string
+	hash digest.Algorithm
+}
+
+// DedupOption configures Dedup.
+type DedupOption func(d *Dedup)
+
+// WithHash makes Dedup identify the debug files by the digests of the hash algorithm, SHA-256 by
+// default. The HTTP uploader sends them in the DigestHeader of the algorithm.
+func WithHash(a digest.Algorithm) DedupOption {
+	return func(d *Dedup) {
+		d.hash = a
+	}
+}
+
+// NewDedup returns an uploader that skips the uploads of u the server has already, keeping the
+// uploaded ones in dir. The checker may be nil.
+func NewDedup(u Uploader, c Checker, dir string, opts ...DedupOption) *Dedup {
+	d := &Dedup{u: u, c: c, dir: dir, hash: digest.SHA256}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Upload implements Uploader. It returns ErrAlreadyUploaded for the skipped debug files.
+func (d *Dedup) Upload(ctx context.Context, buildID string, r io.ReaderAt, size int64) error {
+	sum, err := digest.Reader(d.hash, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	ctx = withDigest(ctx, d.hash, sum)
+
+	path := filepath.Join(d.dir, url.PathEscape(buildID))
+	if known, err := ioutil.ReadFile(path); err == nil && strings.TrimSpace(string(known)) == sum {
+		return ErrAlreadyUploaded
+	}
+	if d.c != nil {
+		if ok, err := d.c.Exists(ctx, buildID, sum); err == nil && ok {
+			d.remember(path, sum)
+			return ErrAlreadyUploaded
+		}
+	}
+	if err := d.u.Upload(ctx, buildID, r, size); err != nil {
+		return err
+	}
+	d.remember(path, sum)
+	return nil
+}
+
+// Healthy reports whether the uploader of the debug files that are not skipped is healthy.
+func (d *Dedup) Healthy() error {
+	return Healthy(d.u)
+}
+
+// remember records the upload, failing to is harmless: the file is checked again next time.
+func (d *Dedup) remember(path, digest string) {
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(d.dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(digest + "\n"); err != nil {
+		f.Close()
+		return
+	}
+	if err := f.Close(); err != nil {
+		return
+	}
+	os.Rename(f.Name(), path)
+}
+
+type digestKey struct{}
+
+// contentDigest is the digest of a debug file and the hash algorithm it was computed with.
+type contentDigest struct {
+	hash digest.Algorithm
+	sum  string
+}
+
+// header returns the header the digest is sent in.
+func (d contentDigest) header() string {
+	if d.hash == nil {
+		return SHA256Header
+	}
+	return DigestHeader(d.hash)
+}
+
+// withDigest passes the digest Dedup computed on to the HTTP uploader, which sends it along.
+func withDigest(ctx context.Context, hash digest.Algorithm, sum string) context.Context {
+	return context.WithValue(ctx, digestKey{}, contentDigest{hash: hash, sum: sum})
+}
+
+func digestFrom(ctx context.Context) contentDigest {
+	d, _ := ctx.Value(digestKey{}).(contentDigest)
+	return d
+}
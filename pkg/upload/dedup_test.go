@@ -0,0 +1,114 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/polarsignals/split-debug/pkg/digest"
+)
+
+func TestDedup(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		stored   = map[string]string{} // build ID to digest
+		requests []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		buildID := strings.TrimPrefix(r.URL.Path, "/debuginfo/")
+		requests = append(requests, r.Method+" "+buildID)
+		switch r.Method {
+		case http.MethodHead:
+			digest, ok := stored[buildID]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set(SHA256Header, digest)
+		case http.MethodPut:
+			data, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			sum := sha256.Sum256(data)
+			require.Equal(t, hex.EncodeToString(sum[:]), r.Header.Get(SHA256Header))
+			stored[buildID] = r.Header.Get(SHA256Header)
+		}
+	}))
+	defer srv.Close()
+
+	h, err := NewHTTP(srv.URL + "/debuginfo/{build_id}")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	ctx := context.Background()
+	upload := func(d *Dedup, buildID, data string) error {
+		return d.Upload(ctx, buildID, strings.NewReader(data), int64(len(data)))
+	}
+
+	d := NewDedup(h, h, dir)
+	require.NoError(t, upload(d, "abcd", "debug file"))
+	// Known uploads are skipped without asking the server.
+	require.ErrorIs(t, upload(d, "abcd", "debug file"), ErrAlreadyUploaded)
+	require.Equal(t, []string{"HEAD abcd", "PUT abcd"}, requests)
+
+	// Changed debug files are uploaded again.
+	require.NoError(t, upload(d, "abcd", "rebuilt debug file"))
+	require.Equal(t, []string{"HEAD abcd", "PUT abcd", "HEAD abcd", "PUT abcd"}, requests)
+
+	// Files the server has are skipped after checking it, e.g. uploaded by another machine.
+	requests = nil
+	require.ErrorIs(t, upload(NewDedup(h, h, t.TempDir()), "abcd", "rebuilt debug file"), ErrAlreadyUploaded)
+	require.Equal(t, []string{"HEAD abcd"}, requests)
+
+	// Without a checker, only the known uploads are skipped.
+	requests = nil
+	d = NewDedup(h, nil, dir)
+	require.ErrorIs(t, upload(d, "abcd", "rebuilt debug file"), ErrAlreadyUploaded)
+	require.NoError(t, upload(d, "ef01", "debug file"))
+	require.Equal(t, []string{"PUT ef01"}, requests)
+}
+
+func TestHTTPExists_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	h, err := NewHTTP(srv.URL + "/debuginfo/{build_id}")
+	require.NoError(t, err)
+	_, err = h.Exists(context.Background(), "abcd", "")
+	require.Error(t, err)
+}
+
+func TestDedup_Hash(t *testing.T) {
+	var headers []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	h, err := NewHTTP(srv.URL + "/debuginfo/{build_id}")
+	require.NoError(t, err)
+	d := NewDedup(h, h, t.TempDir(), WithHash(digest.BLAKE3))
+	data := "debug file"
+	require.NoError(t, d.Upload(context.Background(), "abcd", strings.NewReader(data), int64(len(data))))
+
+	want, err := digest.Reader(digest.BLAKE3, strings.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, headers, 2)
+	for _, hdr := range headers {
+		require.Equal(t, want, hdr.Get("X-Content-BLAKE3"))
+		require.Empty(t, hdr.Get(SHA256Header))
+	}
+}
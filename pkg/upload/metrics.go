@@ -0,0 +1,96 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of the uploads counted by Instrumented.
+const (
+	ResultSuccess = "success"
+	ResultSkipped = "skipped"
+	ResultFailure = "failure"
+)
+
+// Instrumented counts the uploads of an uploader, their bytes and their duration in Prometheus
+// metrics. Wrapped around the uploader of a Queue, it counts the uploads once they are done rather
+// than once they are queued.
+type Instrumented struct {
+	u        Uploader
+	uploads  *prometheus.CounterVec
+	bytes    prometheus.Counter
+	duration prometheus.Histogram
+}
+
+// NewInstrumented returns an uploader that uploads with u and registers its metrics with reg.
+func NewInstrumented(u Uploader, reg prometheus.Registerer) *Instrumented {
+	return &Instrumented{
+		u: u,
+		uploads: metrics.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "uploads_total",
+			Help:      "Uploads of debug files by result: success, skipped as the server has them already, or failure.",
+		}, []string{"result"})),
+		bytes: metrics.Register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Name:      "uploaded_bytes_total",
+			Help:      "Bytes of the debug files uploaded successfully.",
+		})),
+		duration: metrics.Register(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Name:      "upload_duration_seconds",
+			Help:      "Duration of the uploads of debug files, retries included.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 4, 8),
+		})),
+	}
+}
+
+// Upload implements Uploader.
+func (i *Instrumented) Upload(ctx context.Context, buildID string, r io.ReaderAt, size int64) error {
+	start := time.Now()
+	err := i.u.Upload(ctx, buildID, r, size)
+	i.duration.Observe(time.Since(start).Seconds())
+	switch {
+	case err == nil:
+		i.uploads.WithLabelValues(ResultSuccess).Inc()
+		i.bytes.Add(float64(size))
+	case errors.Is(err, ErrAlreadyUploaded):
+		i.uploads.WithLabelValues(ResultSkipped).Inc()
+	default:
+		i.uploads.WithLabelValues(ResultFailure).Inc()
+	}
+	return err
+}
+
+// Healthy reports whether the instrumented uploader is healthy.
+func (i *Instrumented) Healthy() error {
+	return Healthy(i.u)
+}
+
+// RegisterQueue registers the depth and the size of the queue with reg, as gauges.
+func RegisterQueue(reg prometheus.Registerer, q *Queue) {
+	gauge := func(name, help string, fn func() float64) {
+		metrics.Register(reg, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Name:      name,
+			Help:      help,
+		}, fn))
+	}
+	gauge("upload_queue_waiting", "Debug files waiting in the queue for their upload.", func() float64 {
+		waiting, _ := q.Depth()
+		return float64(waiting)
+	})
+	gauge("upload_queue_uploading", "Queued debug files being uploaded.", func() float64 {
+		_, uploading := q.Depth()
+		return float64(uploading)
+	})
+	gauge("upload_queue_size", "Debug files the upload queue holds once full.", func() float64 {
+		return float64(q.Size())
+	})
+}
@@ -0,0 +1,53 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type uploaderFunc func(ctx context.Context, buildID string, r io.ReaderAt, size int64) error
+
+func (f uploaderFunc) Upload(ctx context.Context, buildID string, r io.ReaderAt, size int64) error {
+	return f(ctx, buildID, r, size)
+}
+
+func TestInstrumented(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	u := NewInstrumented(uploaderFunc(func(ctx context.Context, buildID string, r io.ReaderAt, size int64) error {
+		switch buildID {
+		case "skipped":
+			return ErrAlreadyUploaded
+		case "fail":
+			return errors.New("rejected")
+		}
+		return nil
+	}), reg)
+
+	ctx := context.Background()
+	require.NoError(t, u.Upload(ctx, "abcd", strings.NewReader("debug file"), 10))
+	require.ErrorIs(t, u.Upload(ctx, "skipped", strings.NewReader("debug file"), 10), ErrAlreadyUploaded)
+	require.Error(t, u.Upload(ctx, "fail", strings.NewReader("debug file"), 10))
+
+	require.Equal(t, 1.0, testutil.ToFloat64(u.uploads.WithLabelValues(ResultSuccess)))
+	require.Equal(t, 1.0, testutil.ToFloat64(u.uploads.WithLabelValues(ResultSkipped)))
+	require.Equal(t, 1.0, testutil.ToFloat64(u.uploads.WithLabelValues(ResultFailure)))
+	require.Equal(t, 10.0, testutil.ToFloat64(u.bytes))
+
+	// A second uploader of the same registry counts into the same series.
+	NewInstrumented(u.u, reg).Upload(ctx, "abcd", strings.NewReader("debug file"), 10)
+	require.Equal(t, 2.0, testutil.ToFloat64(u.uploads.WithLabelValues(ResultSuccess)))
+
+	q := NewQueue(ctx, u, 3)
+	RegisterQueue(reg, q)
+	require.NoError(t, q.Close())
+	n, err := testutil.GatherAndCount(reg, "split_debug_upload_queue_size")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
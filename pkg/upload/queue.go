@@ -0,0 +1,225 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// DefaultQueueMemory is the size of the queued debug files a Queue keeps in memory by default.
+const DefaultQueueMemory = 64 << 20 // 64MiB
+
+// queued is a debug file waiting for its upload, in memory or spilled to a file.
+type queued struct {
+	buildID string
+	data    []byte
+	spilled *os.File
+	size    int64
+	// receipt is the receipt of the context the upload was queued with.
+	receipt *Receipt
+}
+
+// Queue uploads the debug files in the background, so the extraction goes on while uploads are
+// slower. Upload copies the debug file and returns once it is queued. It blocks while the queue
+// is full, holding the extraction back rather than queuing without bound. Queued debug files are
+// kept in memory up to a budget, the others spill to temporary files.
+type Queue struct {
+	u        Uploader
+	ctx      context.Context
+	items    chan queued
+	workers  int
+	memLimit int64
+	spillDir string
+	done     func(buildID string, err error)
+
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	mem      int64
+	total    int
+	failed   int
+	inFlight int
+}
+
+type QueueOption func(q *Queue)
+
+// WithWorkers uploads n debug files at a time, the default is 1.
+func WithWorkers(n int) QueueOption {
+	return func(q *Queue) {
+		q.workers = n
+	}
+}
+
+// WithQueueMemory keeps up to n bytes of queued debug files in memory, the default is
+// DefaultQueueMemory. The others spill to temporary files.
+func WithQueueMemory(n int64) QueueOption {
+	return func(q *Queue) {
+		q.memLimit = n
+	}
+}
+
+// WithSpillDir spills the queued debug files to temporary files in dir, the default is os.TempDir.
+func WithSpillDir(dir string) QueueOption {
+	return func(q *Queue) {
+		q.spillDir = dir
+	}
+}
+
+// WithDone calls fn with the outcome of each queued upload, from the goroutines of the workers.
+// Skipped uploads pass ErrAlreadyUploaded, they do not count as failed.
+func WithDone(fn func(buildID string, err error)) QueueOption {
+	return func(q *Queue) {
+		q.done = fn
+	}
+}
+
+// NewQueue returns a queue of up to size debug files that uploads them with u until ctx is
+// canceled. It must be closed to wait for the queued uploads.
+func NewQueue(ctx context.Context, u Uploader, size int, opts ...QueueOption) *Queue {
+	q := &Queue{
+		u:        u,
+		ctx:      ctx,
+		workers:  1,
+		memLimit: DefaultQueueMemory,
+		done:     func(string, error) {},
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	if size < 0 {
+		size = 0
+	}
+	if q.workers < 1 {
+		q.workers = 1
+	}
+	q.items = make(chan queued, size)
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Upload implements Uploader, it queues a copy of the debug file.
+func (q *Queue) Upload(ctx context.Context, buildID string, r io.ReaderAt, size int64) error {
+	item, err := q.copy(buildID, r, size)
+	if err != nil {
+		return fmt.Errorf("failed to queue upload: %w", err)
+	}
+	item.receipt = receiptFrom(ctx)
+	select {
+	case q.items <- item:
+		return nil
+	case <-ctx.Done():
+		q.release(item)
+		return ctx.Err()
+	}
+}
+
+// copy copies the debug file into memory, or into a temporary file if the memory budget is used up.
+func (q *Queue) copy(buildID string, r io.ReaderAt, size int64) (queued, error) {
+	item := queued{buildID: buildID, size: size}
+	q.mu.Lock()
+	inMemory := q.mem+size <= q.memLimit
+	if inMemory {
+		q.mem += size
+	}
+	q.mu.Unlock()
+
+	if inMemory {
+		item.data = make([]byte, size)
+		if n, err := r.ReadAt(item.data, 0); n < len(item.data) {
+			q.release(item)
+			return queued{}, err
+		}
+		return item, nil
+	}
+
+	f, err := ioutil.TempFile(q.spillDir, "split-debug-upload-*")
+	if err != nil {
+		return queued{}, err
+	}
+	// Removed right away where the platform allows it, the open file stays readable.
+	os.Remove(f.Name())
+	item.spilled = f
+	if _, err := io.Copy(f, io.NewSectionReader(r, 0, size)); err != nil {
+		q.release(item)
+		return queued{}, err
+	}
+	return item, nil
+}
+
+// release frees the memory or the temporary file of the item.
+func (q *Queue) release(item queued) {
+	if item.spilled != nil {
+		item.spilled.Close()
+		os.Remove(item.spilled.Name())
+		return
+	}
+	q.mu.Lock()
+	q.mem -= item.size
+	q.mu.Unlock()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for item := range q.items {
+		var r io.ReaderAt = bytes.NewReader(item.data)
+		if item.spilled != nil {
+			r = item.spilled
+		}
+		q.mu.Lock()
+		q.inFlight++
+		q.mu.Unlock()
+		ctx := q.ctx
+		if item.receipt != nil {
+			ctx = WithReceipt(ctx, item.receipt)
+		}
+		err := ctx.Err()
+		if err == nil {
+			err = q.u.Upload(ctx, item.buildID, r, item.size)
+		}
+		q.release(item)
+
+		q.mu.Lock()
+		q.inFlight--
+		q.total++
+		if err != nil && !errors.Is(err, ErrAlreadyUploaded) {
+			q.failed++
+		}
+		q.mu.Unlock()
+		q.done(item.buildID, err)
+	}
+}
+
+// Depth returns the number of debug files waiting for their upload and of the ones being uploaded.
+func (q *Queue) Depth() (waiting, uploading int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items), q.inFlight
+}
+
+// Size returns the number of debug files the queue holds once full.
+func (q *Queue) Size() int {
+	return cap(q.items)
+}
+
+// Healthy reports whether the uploader of the queue is healthy.
+func (q *Queue) Healthy() error {
+	return Healthy(q.u)
+}
+
+// Close waits for the queued uploads and returns an error if any of them failed. Upload must not
+// be called once it is closed.
+func (q *Queue) Close() error {
+	close(q.items)
+	q.wg.Wait()
+	if q.failed > 0 {
+		return fmt.Errorf("%d of %d queued uploads failed", q.failed, q.total)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingUploader records the uploaded debug files once release is closed.
+type blockingUploader struct {
+	release chan struct{}
+	mu      sync.Mutex
+	files   map[string]string
+}
+
+func (b *blockingUploader) Upload(ctx context.Context, buildID string, r io.ReaderAt, size int64) error {
+	<-b.release
+	data, err := ioutil.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	if buildID == "fail" {
+		return errors.New("rejected")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files[buildID] = string(data)
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	u := &blockingUploader{release: make(chan struct{}), files: map[string]string{}}
+	var mu sync.Mutex
+	outcomes := map[string]error{}
+	spillDir := t.TempDir()
+	q := NewQueue(context.Background(), u, 2,
+		WithQueueMemory(16),
+		WithSpillDir(spillDir),
+		WithDone(func(buildID string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			outcomes[buildID] = err
+		}),
+	)
+
+	// The worker takes the first debug file and blocks, two more fill the queue.
+	ctx := context.Background()
+	want := map[string]string{}
+	for i := 0; i < 3; i++ {
+		id, data := fmt.Sprintf("id%d", i), strings.Repeat(fmt.Sprint(i), 10)
+		want[id] = data
+		require.NoError(t, q.Upload(ctx, id, strings.NewReader(data), int64(len(data))))
+	}
+
+	require.Equal(t, 2, q.Size())
+	require.Eventually(t, func() bool {
+		waiting, uploading := q.Depth()
+		return waiting == 2 && uploading == 1
+	}, time.Second, time.Millisecond)
+
+	// A full queue holds the caller back until it is canceled.
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err := q.Upload(timeout, "late", strings.NewReader("late"), 4)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(u.release)
+	require.NoError(t, q.Upload(ctx, "fail", strings.NewReader("x"), 1))
+	require.EqualError(t, q.Close(), "1 of 4 queued uploads failed")
+	// The debug files beyond the memory budget were spilled, they are uploaded all the same.
+	require.Equal(t, want, u.files)
+	spilled, err := ioutil.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, spilled)
+	require.Len(t, outcomes, 4)
+	require.Error(t, outcomes["fail"])
+}
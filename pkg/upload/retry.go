@@ -0,0 +1,169 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Retrying without attempting the upload while its circuit breaker
+// is open, after too many consecutive uploads failed.
+var ErrCircuitOpen = errors.New("uploads are paused after consecutive failures")
+
+// Retrying retries the failed uploads of an uploader with exponential backoff.
+// Its circuit breaker fails uploads right away for a cooldown period once enough consecutive
+// uploads failed, so batches do not wait on a symbol server that is down.
+type Retrying struct {
+	u          Uploader
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	timeout    time.Duration
+
+	breakAfter int
+	cooldown   time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+type RetryOption func(r *Retrying)
+
+// WithRetries retries a failed upload up to n times, the default is 3.
+func WithRetries(n int) RetryOption {
+	return func(r *Retrying) {
+		r.retries = n
+	}
+}
+
+// WithBackoff waits min before the first retry and doubles the wait for each further one up to max.
+func WithBackoff(min, max time.Duration) RetryOption {
+	return func(r *Retrying) {
+		r.minBackoff = min
+		r.maxBackoff = max
+	}
+}
+
+// WithTimeout limits the duration of each attempt, it is unlimited by default.
+func WithTimeout(d time.Duration) RetryOption {
+	return func(r *Retrying) {
+		r.timeout = d
+	}
+}
+
+// WithCircuitBreaker fails the uploads for the cooldown after n consecutive uploads failed,
+// n of 0 disables it. The first upload after the cooldown decides whether the circuit closes.
+func WithCircuitBreaker(n int, cooldown time.Duration) RetryOption {
+	return func(r *Retrying) {
+		r.breakAfter = n
+		r.cooldown = cooldown
+	}
+}
+
+// NewRetrying returns an uploader that retries the uploads of u.
+func NewRetrying(u Uploader, opts ...RetryOption) *Retrying {
+	r := &Retrying{
+		u:          u,
+		retries:    3,
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Upload implements Uploader.
+func (r *Retrying) Upload(ctx context.Context, buildID string, ra io.ReaderAt, size int64) error {
+	if err := r.allow(); err != nil {
+		return err
+	}
+	err := r.upload(ctx, buildID, ra, size)
+	if ctx.Err() == nil {
+		r.record(err)
+	}
+	return err
+}
+
+func (r *Retrying) upload(ctx context.Context, buildID string, ra io.ReaderAt, size int64) error {
+	backoff := r.minBackoff
+	for attempt := 0; ; attempt++ {
+		err := r.attempt(ctx, buildID, ra, size)
+		if err == nil || attempt >= r.retries || !retryable(err) || ctx.Err() != nil {
+			if err != nil && attempt > 0 {
+				return fmt.Errorf("%w (after %d retries)", err, attempt)
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(jitter(backoff)):
+		}
+		if backoff *= 2; backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
+
+func (r *Retrying) attempt(ctx context.Context, buildID string, ra io.ReaderAt, size int64) error {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	return r.u.Upload(ctx, buildID, ra, size)
+}
+
+// Healthy returns ErrCircuitOpen while the circuit breaker is open.
+func (r *Retrying) Healthy() error {
+	return r.allow()
+}
+
+func (r *Retrying) allow() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if wait := time.Until(r.openUntil); wait > 0 {
+		return fmt.Errorf("%w, retrying in %s", ErrCircuitOpen, wait.Round(time.Second))
+	}
+	return nil
+}
+
+func (r *Retrying) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.failures = 0
+		return
+	}
+	r.failures++
+	if r.breakAfter > 0 && r.failures >= r.breakAfter {
+		r.openUntil = time.Now().Add(r.cooldown)
+	}
+}
+
+// retryable reports whether the upload may succeed when attempted again. Rejections of the
+// server are final, except for rate limiting and server errors.
+func retryable(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= 500
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+// jitter returns a random duration between half of d and d, so clients do not retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
@@ -0,0 +1,71 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUploader struct {
+	errs  []error
+	calls int
+}
+
+func (f *fakeUploader) Upload(ctx context.Context, buildID string, r io.ReaderAt, size int64) error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func TestRetrying(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	forbidden := &StatusError{StatusCode: http.StatusForbidden, Status: "403 Forbidden"}
+	data := strings.NewReader("debug file")
+
+	f := &fakeUploader{errs: []error{unavailable, errors.New("connection reset")}}
+	r := NewRetrying(f, WithBackoff(time.Millisecond, time.Millisecond))
+	require.NoError(t, r.Upload(context.Background(), "abcd", data, data.Size()))
+	require.Equal(t, 3, f.calls)
+
+	f = &fakeUploader{errs: []error{forbidden}}
+	r = NewRetrying(f, WithBackoff(time.Millisecond, time.Millisecond))
+	require.ErrorIs(t, r.Upload(context.Background(), "abcd", data, data.Size()), forbidden)
+	require.Equal(t, 1, f.calls)
+
+	f = &fakeUploader{errs: []error{unavailable, unavailable, unavailable}}
+	r = NewRetrying(f, WithRetries(1), WithBackoff(time.Millisecond, time.Millisecond))
+	require.EqualError(t, r.Upload(context.Background(), "abcd", data, data.Size()), "503 Service Unavailable (after 1 retries)")
+	require.Equal(t, 2, f.calls)
+}
+
+func TestRetryingCircuitBreaker(t *testing.T) {
+	unavailable := &StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	data := strings.NewReader("debug file")
+
+	f := &fakeUploader{errs: []error{unavailable, unavailable}}
+	r := NewRetrying(f, WithRetries(0), WithCircuitBreaker(2, 50*time.Millisecond))
+	require.Error(t, r.Upload(context.Background(), "a", data, data.Size()))
+	require.Error(t, r.Upload(context.Background(), "b", data, data.Size()))
+	require.ErrorIs(t, r.Upload(context.Background(), "c", data, data.Size()), ErrCircuitOpen)
+	require.Equal(t, 2, f.calls)
+	require.ErrorIs(t, Healthy(r), ErrCircuitOpen)
+	q := NewQueue(context.Background(), NewDedup(r, nil, t.TempDir()), 1)
+	require.ErrorIs(t, Healthy(q), ErrCircuitOpen)
+	require.NoError(t, q.Close())
+
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, Healthy(r))
+	require.NoError(t, r.Upload(context.Background(), "c", data, data.Size()))
+	require.Equal(t, 3, f.calls)
+	require.NoError(t, Healthy(f))
+}
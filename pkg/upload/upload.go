@@ -0,0 +1,235 @@
+// Package upload pushes extracted debug files to symbol servers by build ID.
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+
+	"github.com/go-kit/log/level"
+)
+
+// BuildIDPlaceholder is replaced with the build ID in the URL templates of the HTTP uploader.
+const BuildIDPlaceholder = "{build_id}"
+
+// TargetURL returns the URL of the template the debug file of the build ID is uploaded to.
+func TargetURL(template, buildID string) string {
+	return strings.ReplaceAll(template, BuildIDPlaceholder, url.PathEscape(buildID))
+}
+
+// ResponseIDHeaders are the headers of the responses to uploads the ID of a Receipt is taken
+// from, the first one that is set.
+var ResponseIDHeaders = []string{"X-Upload-Id", "X-Request-Id", "ETag"}
+
+// Receipt records where the HTTP uploader uploaded a debug file to, for the uploads of a context
+// with it, see WithReceipt.
+type Receipt struct {
+	// URL is the URL the debug file was uploaded to, it is set once the upload is attempted.
+	URL string
+	// ID identifies the upload on the server, it is the first of the ResponseIDHeaders of the
+	// response to it, or to its last chunk. Empty if the upload failed or the server sent none.
+	ID string
+}
+
+type receiptKey struct{}
+
+// WithReceipt returns a context whose uploads fill in r. The uploads of a Queue fill it in once
+// they are done, before the function of WithDone is called.
+func WithReceipt(ctx context.Context, r *Receipt) context.Context {
+	return context.WithValue(ctx, receiptKey{}, r)
+}
+
+// receiptFrom returns the receipt of the context, nil if it has none.
+func receiptFrom(ctx context.Context) *Receipt {
+	r, _ := ctx.Value(receiptKey{}).(*Receipt)
+	return r
+}
+
+// accepted records the ID of the response that accepted the upload.
+func (r *Receipt) accepted(resp *http.Response) {
+	if r == nil {
+		return
+	}
+	for _, h := range ResponseIDHeaders {
+		if id := resp.Header.Get(h); id != "" {
+			r.ID = id
+			return
+		}
+	}
+}
+
+// Uploader uploads debug files by the build ID of the object files they belong to.
+type Uploader interface {
+	Upload(ctx context.Context, buildID string, r io.ReaderAt, size int64) error
+}
+
+// Healthy returns an error while u knows the uploads to fail, e.g. a Retrying uploader whose
+// circuit breaker is open, so readiness probes report that the server does not accept uploads.
+// Uploaders that do not track it are healthy.
+func Healthy(u Uploader) error {
+	if h, ok := u.(interface{ Healthy() error }); ok {
+		return h.Healthy()
+	}
+	return nil
+}
+
+// HTTP uploads debug files with PUT requests.
+type HTTP struct {
+	url    string
+	token  string
+	client *http.Client
+
+	chunkSize int64
+	stateDir  string
+	limiter   *iohelper.RateLimiter
+}
+
+type Option func(u *HTTP)
+
+// WithToken authenticates the uploads with the bearer token.
+func WithToken(token string) Option {
+	return func(u *HTTP) {
+		u.token = token
+	}
+}
+
+// WithClient sends the uploads with the given client, the default is http.DefaultClient.
+func WithClient(c *http.Client) Option {
+	return func(u *HTTP) {
+		u.client = c
+	}
+}
+
+// WithBandwidth limits the uploads to bytesPerSecond, shared by the concurrent uploads, so they do
+// not saturate the network of the host. A non-positive rate disables limiting.
+func WithBandwidth(bytesPerSecond int64) Option {
+	return func(u *HTTP) {
+		if bytesPerSecond > 0 {
+			u.limiter = iohelper.NewRateLimiter(bytesPerSecond)
+		}
+	}
+}
+
+// NewHTTP returns an uploader that puts the debug files to the URL of the template,
+// {build_id} in it is replaced with the build ID, e.g. https://symbols.example.com/debuginfo/{build_id}.
+// The build ID is sent in the X-Build-ID header as well, and the digest of the debug file in the
+// X-Content-SHA256 header when it is uploaded through Dedup.
+func NewHTTP(template string, opts ...Option) (*HTTP, error) {
+	u, err := url.Parse(strings.ReplaceAll(template, BuildIDPlaceholder, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid upload URL %q: scheme must be http or https", template)
+	}
+	h := &HTTP{url: template, client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+// Upload implements Uploader.
+func (u *HTTP) Upload(ctx context.Context, buildID string, r io.ReaderAt, size int64) error {
+	target := TargetURL(u.url, buildID)
+	if r := receiptFrom(ctx); r != nil {
+		r.URL, r.ID = target, ""
+	}
+	if u.chunkSize > 0 && size > u.chunkSize {
+		return u.uploadChunks(ctx, buildID, target, r, size)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, u.body(r, 0, size))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	u.setHeaders(req, buildID)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("upload of %s failed with %w", buildID, newStatusError(resp))
+	}
+	receiptFrom(ctx).accepted(resp)
+	return nil
+}
+
+// body returns the request body of n bytes of the file at off, limited to the bandwidth.
+func (u *HTTP) body(r io.ReaderAt, off, n int64) io.Reader {
+	var body io.Reader = io.NewSectionReader(r, off, n)
+	if u.limiter != nil {
+		body = iohelper.NewRateLimitedReader(body, u.limiter)
+	}
+	return body
+}
+
+// StatusError is the response of a server that rejected an upload.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Message: strings.TrimSpace(string(msg))}
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return e.Status
+	}
+	return e.Status + ": " + e.Message
+}
+
+func (u *HTTP) setHeaders(req *http.Request, buildID string) {
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Build-ID", buildID)
+	if d := digestFrom(req.Context()); d.sum != "" {
+		req.Header.Set(d.header(), d.sum)
+	}
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+}
+
+// ErrNoBuildID is returned by Sink for inputs without a build ID, debug files are uploaded by it.
+var ErrNoBuildID = errors.New("no build ID to upload the debug file by")
+
+// Sink returns the pipeline sink that uploads the written debug file by the build ID of the job.
+func Sink(u Uploader) pipeline.Sink {
+	return pipeline.SinkFunc("upload", func(ctx context.Context, j *pipeline.Job, r io.ReaderAt, size int64) error {
+		if j.BuildID == "" {
+			return ErrNoBuildID
+		}
+		err := u.Upload(ctx, j.BuildID, r, size)
+		if errors.Is(err, ErrAlreadyUploaded) {
+			if j.Logger != nil {
+				level.Debug(j.Logger).Log("msg", "debug information already uploaded")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if j.Logger != nil {
+			msg := "uploaded debug information"
+			if _, ok := u.(*Queue); ok {
+				msg = "queued debug information for upload"
+			}
+			level.Info(j.Logger).Log("msg", msg, "size", size)
+		}
+		return nil
+	})
+}
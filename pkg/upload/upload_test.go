@@ -0,0 +1,68 @@
+package upload
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP(t *testing.T) {
+	var path, buildID, auth, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		path, buildID, auth = r.URL.Path, r.Header.Get("X-Build-ID"), r.Header.Get("Authorization")
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		body = string(b)
+		if strings.HasSuffix(path, "/fail") {
+			http.Error(w, "quota exceeded", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("X-Request-Id", "req-1")
+	}))
+	defer srv.Close()
+
+	u, err := NewHTTP(srv.URL+"/debuginfo/{build_id}", WithToken("secret"))
+	require.NoError(t, err)
+	data := "debug file"
+	var receipt Receipt
+	ctx := WithReceipt(context.Background(), &receipt)
+	require.NoError(t, u.Upload(ctx, "abcd", strings.NewReader(data), int64(len(data))))
+	require.Equal(t, Receipt{URL: srv.URL + "/debuginfo/abcd", ID: "req-1"}, receipt)
+	require.Equal(t, "/debuginfo/abcd", path)
+	require.Equal(t, "abcd", buildID)
+	require.Equal(t, "Bearer secret", auth)
+	require.Equal(t, data, body)
+
+	err = u.Upload(ctx, "fail", strings.NewReader(data), int64(len(data)))
+	require.EqualError(t, err, "upload of fail failed with 403 Forbidden: quota exceeded")
+	require.Equal(t, Receipt{URL: srv.URL + "/debuginfo/fail"}, receipt)
+
+	_, err = NewHTTP("ftp://example.com/{build_id}")
+	require.Error(t, err)
+}
+
+func TestHTTP_Bandwidth(t *testing.T) {
+	var received int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = len(b)
+	}))
+	defer srv.Close()
+
+	u, err := NewHTTP(srv.URL+"/debuginfo/{build_id}", WithBandwidth(1000))
+	require.NoError(t, err)
+	// The first second worth of bytes goes through as a burst, the rest is paced.
+	data := strings.Repeat("x", 1500)
+	start := time.Now()
+	require.NoError(t, u.Upload(context.Background(), "abcd", strings.NewReader(data), int64(len(data))))
+	require.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+	require.Equal(t, len(data), received)
+}
@@ -0,0 +1,274 @@
+// Package zstdseek writes and reads the zstd seekable format: the data is compressed in
+// independent frames, followed by a seek table in a skippable frame that maps the decompressed
+// offsets to the frames. Random reads of, e.g., a DWARF section of a multi-GB debug file only
+// decompress the frames they touch, while any zstd decoder still decompresses the whole file.
+//
+// See https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md.
+package zstdseek
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultFrameSize is the decompressed size of the frames by default, the unit of random reads.
+const DefaultFrameSize = 1 << 20 // 1MiB
+
+const (
+	skippableMagic = 0x184D2A5E
+	seekableMagic  = 0x8F92EAB1
+	// footerSize is the size of the seek table footer: the number of frames, the descriptor and the magic.
+	footerSize = 9
+	// checksumFlag is the bit of the descriptor set if the entries carry checksums.
+	checksumFlag = 1 << 7
+	// maxFrames bounds the seek tables of malformed files.
+	maxFrames = 1 << 24
+)
+
+var (
+	// ErrNotSeekable is returned by NewReader for data without a seek table.
+	ErrNotSeekable = errors.New("not a seekable zstd file")
+
+	errClosed = errors.New("writer is closed")
+)
+
+// Writer compresses the data written to it in frames of the frame size.
+type Writer struct {
+	w         io.Writer
+	enc       *zstd.Encoder
+	frameSize int
+	buf       []byte
+	// entries are the compressed and decompressed sizes of the written frames.
+	entries [][2]uint32
+	err     error
+}
+
+type Option func(w *Writer)
+
+// WithFrameSize compresses the data in frames of n decompressed bytes.
+func WithFrameSize(n int) Option {
+	return func(w *Writer) {
+		w.frameSize = n
+	}
+}
+
+// NewWriter returns a writer of the seekable format to w, Close writes the seek table.
+func NewWriter(w io.Writer, opts ...Option) (*Writer, error) {
+	zw := &Writer{w: w, frameSize: DefaultFrameSize}
+	for _, opt := range opts {
+		opt(zw)
+	}
+	if zw.frameSize <= 0 || int64(zw.frameSize) > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid frame size %d", zw.frameSize)
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	zw.enc = enc
+	zw.buf = make([]byte, 0, zw.frameSize)
+	return zw, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	var n int
+	for len(p) > 0 {
+		c := copy(w.buf[len(w.buf):w.frameSize], p)
+		w.buf = w.buf[:len(w.buf)+c]
+		p, n = p[c:], n+c
+		if len(w.buf) == w.frameSize {
+			if err := w.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flush compresses the buffered data as a frame.
+func (w *Writer) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	frame := w.enc.EncodeAll(w.buf, nil)
+	if _, err := w.w.Write(frame); err != nil {
+		w.err = err
+		return err
+	}
+	w.entries = append(w.entries, [2]uint32{uint32(len(frame)), uint32(len(w.buf))})
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close compresses the remaining data and writes the seek table, it does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	defer w.enc.Close()
+	if err := w.flush(); err != nil {
+		return err
+	}
+	table := make([]byte, 8+8*len(w.entries)+footerSize)
+	binary.LittleEndian.PutUint32(table[0:], skippableMagic)
+	binary.LittleEndian.PutUint32(table[4:], uint32(len(table)-8))
+	off := 8
+	for _, e := range w.entries {
+		binary.LittleEndian.PutUint32(table[off:], e[0])
+		binary.LittleEndian.PutUint32(table[off+4:], e[1])
+		off += 8
+	}
+	binary.LittleEndian.PutUint32(table[off:], uint32(len(w.entries)))
+	table[off+4] = 0 // No checksums, the frames carry their own.
+	binary.LittleEndian.PutUint32(table[off+5:], seekableMagic)
+	if _, err := w.w.Write(table); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = errClosed
+	return nil
+}
+
+// frame is a frame of the seek table.
+type frame struct {
+	off, size         int64 // compressed
+	dataOff, dataSize int64 // decompressed
+}
+
+// Reader reads the decompressed data of the seekable format at random offsets. It keeps the
+// last decompressed frame, so sequential reads decompress each frame once. It is safe for
+// concurrent use.
+type Reader struct {
+	r      io.ReaderAt
+	dec    *zstd.Decoder
+	frames []frame
+	size   int64
+
+	mu      sync.Mutex
+	last    int
+	lastBuf []byte
+}
+
+// NewReader reads the seek table at the end of the size bytes of r.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	if size < 8+footerSize {
+		return nil, ErrNotSeekable
+	}
+	var footer [footerSize]byte
+	if _, err := r.ReadAt(footer[:], size-footerSize); err != nil {
+		return nil, fmt.Errorf("failed to read seek table: %w", err)
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return nil, ErrNotSeekable
+	}
+	n := int64(binary.LittleEndian.Uint32(footer[0:]))
+	entrySize := int64(8)
+	if footer[4]&checksumFlag != 0 {
+		entrySize = 12
+	}
+	tableSize := 8 + n*entrySize + footerSize
+	if n > maxFrames || tableSize > size {
+		return nil, fmt.Errorf("%w: seek table of %d frames", ErrNotSeekable, n)
+	}
+	table := make([]byte, tableSize-footerSize)
+	if _, err := r.ReadAt(table, size-tableSize); err != nil {
+		return nil, fmt.Errorf("failed to read seek table: %w", err)
+	}
+	if binary.LittleEndian.Uint32(table) != skippableMagic || int64(binary.LittleEndian.Uint32(table[4:])) != tableSize-8 {
+		return nil, fmt.Errorf("%w: malformed seek table", ErrNotSeekable)
+	}
+
+	zr := &Reader{r: r, frames: make([]frame, 0, n), last: -1}
+	var off, dataOff int64
+	for i := int64(0); i < n; i++ {
+		e := table[8+i*entrySize:]
+		f := frame{
+			off:      off,
+			size:     int64(binary.LittleEndian.Uint32(e)),
+			dataOff:  dataOff,
+			dataSize: int64(binary.LittleEndian.Uint32(e[4:])),
+		}
+		off, dataOff = off+f.size, dataOff+f.dataSize
+		zr.frames = append(zr.frames, f)
+	}
+	if off != size-tableSize {
+		return nil, fmt.Errorf("%w: frames of %d bytes before a seek table at %d", ErrNotSeekable, off, size-tableSize)
+	}
+	zr.size = dataOff
+
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	zr.dec = dec
+	return zr, nil
+}
+
+// Size returns the decompressed size.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads len(p) decompressed bytes at offset off, decompressing the frames it spans.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	for n < len(p) && off < r.size {
+		i := sort.Search(len(r.frames), func(i int) bool { return r.frames[i].dataOff+r.frames[i].dataSize > off })
+		data, err := r.frame(i)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], data[off-r.frames[i].dataOff:])
+		n, off = n+c, off+int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// frame returns the decompressed data of the i-th frame.
+func (r *Reader) frame(i int) ([]byte, error) {
+	if i == r.last {
+		return r.lastBuf, nil
+	}
+	f := r.frames[i]
+	compressed := make([]byte, f.size)
+	if _, err := r.r.ReadAt(compressed, f.off); err != nil {
+		return nil, fmt.Errorf("failed to read frame %d: %w", i, err)
+	}
+	data, err := r.dec.DecodeAll(compressed, r.lastBuf[:0])
+	if err != nil {
+		r.last = -1
+		return nil, fmt.Errorf("failed to decompress frame %d: %w", i, err)
+	}
+	if int64(len(data)) != f.dataSize {
+		r.last = -1
+		return nil, fmt.Errorf("frame %d decompressed to %d bytes, the seek table records %d", i, len(data), f.dataSize)
+	}
+	r.last, r.lastBuf = i, data
+	return data, nil
+}
+
+// Close releases the decoder.
+func (r *Reader) Close() error {
+	r.dec.Close()
+	return nil
+}
@@ -0,0 +1,149 @@
+package zstdseek
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeekable(t *testing.T) {
+	data := make([]byte, 10_000)
+	rand.New(rand.NewSource(1)).Read(data[:5000])
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, WithFrameSize(1024))
+	require.NoError(t, err)
+	// Writes that do not line up with the frames.
+	for _, chunk := range [][]byte{data[:100], data[100:3000], data[3000:]} {
+		_, err := w.Write(chunk)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	// Any zstd decoder decompresses the whole file, the seek table is skipped.
+	dec, err := zstd.NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	decoded, err := ioutil.ReadAll(dec)
+	dec.Close()
+	require.NoError(t, err)
+	require.Equal(t, data, decoded)
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	defer r.Close()
+	require.Equal(t, int64(len(data)), r.Size())
+	require.Len(t, r.frames, 10)
+
+	for _, tc := range []struct{ off, n int }{{0, 10}, {1000, 100}, {4000, 3000}, {9990, 10}} {
+		p := make([]byte, tc.n)
+		n, err := r.ReadAt(p, int64(tc.off))
+		require.NoError(t, err)
+		require.Equal(t, data[tc.off:tc.off+tc.n], p[:n])
+	}
+	p := make([]byte, 20)
+	n, err := r.ReadAt(p, 9990)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, data[9990:], p[:n])
+	n, err = r.ReadAt(p, 10_000)
+	require.Equal(t, io.EOF, err)
+	require.Zero(t, n)
+
+	read, err := ioutil.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	require.NoError(t, err)
+	require.Equal(t, data, read)
+}
+
+func TestNewReader_NotSeekable(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	plain := enc.EncodeAll(bytes.Repeat([]byte("debug"), 100), nil)
+	enc.Close()
+
+	for _, data := range [][]byte{nil, []byte("short"), plain} {
+		_, err := NewReader(bytes.NewReader(data), int64(len(data)))
+		require.ErrorIs(t, err, ErrNotSeekable)
+	}
+}
+
+func TestWriter_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Zero(t, r.Size())
+	_, err = r.ReadAt(make([]byte, 1), 0)
+	require.Equal(t, io.EOF, err)
+}
+
+// compressible returns n bytes of data that compresses about as well as DWARF.
+func compressible(n int) []byte {
+	rnd := rand.New(rand.NewSource(int64(n)))
+	data := make([]byte, n)
+	for i := 0; i < n; {
+		run := 1 + rnd.Intn(16)
+		if i+run > n {
+			run = n - i
+		}
+		if rnd.Intn(2) == 0 {
+			b := byte(rnd.Intn(8))
+			for j := 0; j < run; j++ {
+				data[i+j] = b
+			}
+		} else {
+			rnd.Read(data[i : i+run])
+		}
+		i += run
+	}
+	return data
+}
+
+func BenchmarkCompressZstd(b *testing.B) {
+	data := compressible(16 << 20)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w, err := NewWriter(ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReader_ReadAt(b *testing.B) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(b, err)
+	_, err = w.Write(compressible(16 << 20))
+	require.NoError(b, err)
+	require.NoError(b, w.Close())
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(b, err)
+	defer r.Close()
+
+	// Random reads of 4KiB, e.g. of DWARF entries, each decompresses a frame.
+	p := make([]byte, 4<<10)
+	rnd := rand.New(rand.NewSource(1))
+	b.SetBytes(int64(len(p)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.ReadAt(p, rnd.Int63n(r.Size()-int64(len(p)))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
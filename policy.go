@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/policy"
+)
+
+// policyFlags configure the policy the debug files are checked against before they are written or
+// uploaded. They are typically set once for all deployments in the configuration file:
+//
+//	policy-deny-symbol: ['(?i)acme']
+//	policy-deny-source-path: ['/secret/']
+//	policy-denylist: /etc/split-debug/customers.txt
+type policyFlags struct {
+	PolicyDenySymbol     []string `kong:"sep='none',placeholder='REGEXP',help='Fail the files whose debug information has a symbol, function, variable or type name matching this regular expression, e.g. (?i)acme, rather than writing or uploading it. Checked after the names are redacted. Can be repeated.'"`
+	PolicyDenySourcePath []string `kong:"sep='none',placeholder='REGEXP',help='Fail the files whose debug information has a source path matching this regular expression, e.g. /secret/. Can be repeated.'"`
+	PolicyDenylist       string   `kong:"placeholder='PATH',help='Fail the files whose symbol names or source paths contain one of the strings of this file, one per line, e.g. the names of customers. Empty lines and lines starting with # are ignored.',type:'path'"`
+}
+
+// policyRules compiles the configured rules.
+func (f *policyFlags) policyRules() (policy.Rules, error) {
+	var rules policy.Rules
+	var err error
+	if rules.Symbols, err = compileRegexps("--policy-deny-symbol", f.PolicyDenySymbol); err != nil {
+		return rules, usageError(err)
+	}
+	if rules.SourcePaths, err = compileRegexps("--policy-deny-source-path", f.PolicyDenySourcePath); err != nil {
+		return rules, usageError(err)
+	}
+	if f.PolicyDenylist != "" {
+		if rules.Denylist, err = readDenylist(f.PolicyDenylist); err != nil {
+			return rules, fmt.Errorf("failed to read policy denylist: %w", err)
+		}
+	}
+	return rules, nil
+}
+
+func compileRegexps(flag string, exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", flag, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// readDenylist returns the strings of the denylist file at path.
+func readDenylist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list = append(list, line)
+	}
+	return list, s.Err()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+)
+
+type probesCmd struct {
+	Path string `kong:"required,arg,name='path',help='File path to the object or debug file to list the SDT probes of.',type:'path'"`
+	JSON bool   `kong:"name='json',help='Print the probes as JSON.'"`
+}
+
+// Run lists the SystemTap SDT probes, also known as USDT, of the object file: the address,
+// provider, name and argument operands of each, as readelf -n shows them.
+func (c *probesCmd) Run() error {
+	f, err := elfutils.Open(c.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open given file: %w", err)
+	}
+	defer f.Close()
+
+	probes, err := elfutils.Probes(f)
+	if err != nil {
+		return err
+	}
+	if c.JSON {
+		if probes == nil {
+			probes = []elfutils.Probe{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(probes)
+	}
+	for _, p := range probes {
+		fmt.Fprintf(os.Stdout, "0x%016x %s:%s", p.Address, p.Provider, p.Name)
+		if p.Semaphore != 0 {
+			fmt.Fprintf(os.Stdout, " semaphore=%#x", p.Semaphore)
+		}
+		if p.Arguments != "" {
+			fmt.Fprintf(os.Stdout, " %s", p.Arguments)
+		}
+		fmt.Fprintln(os.Stdout)
+	}
+	return nil
+}
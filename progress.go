@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+)
+
+const (
+	progressBarWidth    = 30
+	progressRefreshRate = 100 * time.Millisecond
+)
+
+// progressBar renders the progress of processing a single file.
+// A nil *progressBar is valid and renders nothing.
+type progressBar struct {
+	w     io.Writer
+	label string
+	total uint64
+
+	lastRender time.Time
+}
+
+func newProgressBar(w io.Writer, label string) *progressBar {
+	return &progressBar{w: w, label: label}
+}
+
+// setTotal sets the expected number of bytes, if unknown only the processed bytes are rendered.
+func (p *progressBar) setTotal(total uint64) {
+	if p == nil {
+		return
+	}
+	p.total = total
+}
+
+// update renders the progress for the given number of processed bytes.
+func (p *progressBar) update(n int64) {
+	if p == nil {
+		return
+	}
+	// Only redraw periodically to not flood slow terminals.
+	if now := time.Now(); now.Sub(p.lastRender) >= progressRefreshRate {
+		p.lastRender = now
+		p.render(n)
+	}
+}
+
+func (p *progressBar) render(n int64) {
+	var line string
+	if p.total == 0 {
+		line = fmt.Sprintf("%s %s", p.label, byteSize(n))
+	} else {
+		done := uint64(n)
+		if done > p.total {
+			// The total is an estimate.
+			done = p.total
+		}
+		filled := int(done * progressBarWidth / p.total)
+		line = fmt.Sprintf("%s [%s%s] %3d%% %s/%s",
+			p.label,
+			strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+			done*100/p.total,
+			byteSize(done), byteSize(p.total),
+		)
+	}
+	fmt.Fprintf(p.w, "\r%s\x1b[K", line)
+}
+
+// finish renders the final state and ends the line.
+func (p *progressBar) finish(n int64) {
+	if p == nil {
+		return
+	}
+	if p.total != 0 {
+		p.total = uint64(n)
+	}
+	p.render(n)
+	fmt.Fprintln(p.w)
+}
+
+// progressFile counts the bytes written to a file to report progress.
+// The file is not embedded, so io.Copy cannot bypass the count through its ReadFrom.
+type progressFile struct {
+	f        *os.File
+	w        *iohelper.CountingWriter
+	rendered bool
+}
+
+func newProgressFile(f *os.File, p *progressBar) *progressFile {
+	return &progressFile{f: f, w: iohelper.NewCountingWriter(f, p.update), rendered: p != nil}
+}
+
+func (f *progressFile) Write(b []byte) (int, error) {
+	return f.w.Write(b)
+}
+
+func (f *progressFile) Seek(offset int64, whence int) (int64, error) {
+	return f.f.Seek(offset, whence)
+}
+
+// File returns the file for the fast paths of the ELF writer, e.g. copy_file_range, unless the
+// progress is rendered: they bypass the count.
+func (f *progressFile) File() *os.File {
+	if f.rendered {
+		return nil
+	}
+	return f.f
+}
+
+func (f *progressFile) Close() error {
+	return f.f.Close()
+}
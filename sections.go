@@ -0,0 +1,111 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+)
+
+type sectionsCmd struct {
+	Path string `kong:"required,arg,name='path',help='File path to the object or debug file to list the section headers of.',type:'path'"`
+	JSON bool   `kong:"name='json',help='Print the section headers as JSON.'"`
+}
+
+// sectionHeader is a section header as the sections command prints it.
+type sectionHeader struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Flags   string `json:"flags"`
+	Address uint64 `json:"address"`
+	Offset  uint64 `json:"offset"`
+	// Size is the size in the section header, the one of the compressed contents of compressed sections.
+	Size    uint64 `json:"size"`
+	Align   uint64 `json:"align"`
+	EntSize uint64 `json:"entsize"`
+	Link    uint32 `json:"link"`
+	Info    uint32 `json:"info"`
+}
+
+// sectionFlags are the letters readelf prints for the flags of sections.
+var sectionFlags = []struct {
+	flag   elf.SectionFlag
+	letter byte
+}{
+	{elf.SHF_WRITE, 'W'},
+	{elf.SHF_ALLOC, 'A'},
+	{elf.SHF_EXECINSTR, 'X'},
+	{elf.SHF_MERGE, 'M'},
+	{elf.SHF_STRINGS, 'S'},
+	{elf.SHF_INFO_LINK, 'I'},
+	{elf.SHF_LINK_ORDER, 'L'},
+	{elf.SHF_OS_NONCONFORMING, 'O'},
+	{elf.SHF_GROUP, 'G'},
+	{elf.SHF_TLS, 'T'},
+	{elf.SHF_COMPRESSED, 'C'},
+}
+
+// Run lists the section headers of the object file, as readelf -S does, e.g. to check the output
+// of extract.
+func (c *sectionsCmd) Run() error {
+	f, err := elfutils.Open(c.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open given file: %w", err)
+	}
+	defer f.Close()
+
+	headers := make([]sectionHeader, 0, len(f.Sections))
+	for i, s := range f.Sections {
+		headers = append(headers, sectionHeader{
+			Index:   i,
+			Name:    s.Name,
+			Type:    sectionType(s.Type),
+			Flags:   flagLetters(s.Flags),
+			Address: s.Addr,
+			Offset:  s.Offset,
+			Size:    s.FileSize,
+			Align:   s.Addralign,
+			EntSize: s.Entsize,
+			Link:    s.Link,
+			Info:    s.Info,
+		})
+	}
+	if c.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(headers)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, "[Nr]\tName\tType\tAddress\tOff\tSize\tES\tFlg\tLk\tInf\tAl")
+	for _, h := range headers {
+		fmt.Fprintf(w, "[%2d]\t%s\t%s\t%016x\t%06x\t%06x\t%02x\t%s\t%d\t%d\t%d\n",
+			h.Index, h.Name, h.Type, h.Address, h.Offset, h.Size, h.EntSize, h.Flags, h.Link, h.Info, h.Align)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, "Key to Flags: W (write), A (alloc), X (execute), M (merge), S (strings), I (info), L (link order), O (extra OS processing required), G (group), T (TLS), C (compressed)")
+	return nil
+}
+
+// sectionType returns the type of the section as readelf names it, e.g. PROGBITS.
+func sectionType(t elf.SectionType) string {
+	return strings.TrimPrefix(t.String(), "SHT_")
+}
+
+// flagLetters returns the letters of the flags of a section, in the order readelf prints them.
+func flagLetters(flags elf.SectionFlag) string {
+	var b strings.Builder
+	for _, f := range sectionFlags {
+		if flags&f.flag != 0 {
+			b.WriteByte(f.letter)
+		}
+	}
+	return b.String()
+}
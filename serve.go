@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/polarsignals/split-debug/pkg/auth"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+	"github.com/polarsignals/split-debug/pkg/remote"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serveFlags are the flags shared by the commands that serve the extraction remotely.
+type serveFlags struct {
+	Store string `kong:"help='Directory to store the extracted debug files in by build ID. Defaults to a temporary directory that is removed on shutdown.',type:'path'"`
+	Token string `kong:"env='SPLIT_DEBUG_TOKEN',help='Require clients to authenticate with this bearer token.'"`
+
+	BearerTokenFile string `kong:"help='Require clients to authenticate with the bearer token read from this file. Reloaded when it changes.',type:'existingfile'"`
+	TLSCert         string `kong:"name='tls-cert',help='Serve TLS with the certificate of this PEM file. Reloaded when it changes.',type:'existingfile'"`
+	TLSKey          string `kong:"name='tls-key',help='Key of the server certificate, a PEM file. Reloaded when it changes.',type:'existingfile'"`
+	TLSClientCA     string `kong:"name='tls-client-ca',help='Require clients to present a certificate signed by one of the CAs of this PEM file, for mutual TLS. Reloaded when it changes.',type:'existingfile'"`
+
+	MaxInputSize   byteSize `kong:"help='Maximum size of an input file, e.g. 2GB. Larger files are rejected while they are received.'"`
+	MaxSections    int      `kong:"help='Maximum number of sections of an input file.'"`
+	MaxSectionSize byteSize `kong:"help='Maximum size of a single section after decompression, e.g. 1GB.'"`
+
+	metricsFlags
+}
+
+// newServer returns the server of the remote extraction and a function that removes
+// its temporary store, if no store is given.
+func (f *serveFlags) newServer(logger log.Logger, tracer trace.Tracer, reg prometheus.Registerer) (*remote.Server, string, func(), error) {
+	opts := []remote.Option{
+		remote.WithMaxInputSize(int64(f.MaxInputSize)),
+		remote.WithToken(f.Token),
+	}
+	if f.BearerTokenFile != "" {
+		if f.Token != "" {
+			return nil, "", nil, usageError(errors.New("--token and --bearer-token-file are mutually exclusive"))
+		}
+		token, err := auth.NewTokenFile(f.BearerTokenFile)
+		if err != nil {
+			return nil, "", nil, usageError(err)
+		}
+		opts = append(opts, remote.WithTokenSource(token.Token))
+	}
+
+	store, cleanup := f.Store, func() {}
+	if store == "" {
+		dir, err := ioutil.TempDir("", "split-debug-store-*")
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to create store: %w", err)
+		}
+		store, cleanup = dir, func() { os.RemoveAll(dir) }
+	} else if err := os.MkdirAll(store, 0o755); err != nil {
+		return nil, "", nil, fmt.Errorf("failed to create store: %w", err)
+	}
+
+	p := pipeline.New(
+		pipeline.WithReader(pipeline.Open(elfutils.Limits{
+			MaxInputSize:   int64(f.MaxInputSize),
+			MaxSections:    f.MaxSections,
+			MaxSectionSize: uint64(f.MaxSectionSize),
+		})),
+		pipeline.WithFilters(pipeline.DebugSections()),
+		pipeline.WithTransformers(pipeline.LinkedSections()),
+		pipeline.WithTracer(tracer),
+		pipeline.WithRegisterer(reg),
+	)
+	s := remote.NewServer(logger, p, store, opts...)
+	return s, store, cleanup, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// errShutdown is the error of the work left once the shutdown is requested.
+var errShutdown = errors.New("not processed, shutdown requested")
+
+// shutdown is the shutdown request of the commands that process several files or run until
+// interrupted: once it is requested, they stop taking new work, e.g. the next file of a batch or
+// new connections, and finish the work in flight. Their context is canceled, interrupting that
+// work, once the drain timeout elapses or on a second signal.
+type shutdown struct {
+	done <-chan struct{}
+}
+
+// requested reports whether the shutdown was requested.
+func (s shutdown) requested() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleSignals returns the context of the run and its shutdown request. The first SIGINT or
+// SIGTERM requests the shutdown, the context is canceled drain after it, or on a second signal.
+// The returned function stops handling the signals and cancels the context.
+func handleSignals(logger log.Logger, drain time.Duration) (context.Context, shutdown, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	requested := make(chan struct{})
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			level.Info(logger).Log("msg", "shutting down, finishing the work in flight", "signal", sig, "drain_timeout", drain)
+			close(requested)
+		case <-ctx.Done():
+			return
+		}
+		timer := time.NewTimer(drain)
+		defer timer.Stop()
+		select {
+		case sig := <-sigs:
+			level.Warn(logger).Log("msg", "interrupting the work in flight", "signal", sig)
+		case <-timer.C:
+			level.Warn(logger).Log("msg", "drain timeout elapsed, interrupting the work in flight")
+		case <-ctx.Done():
+			return
+		}
+		cancel()
+	}()
+	return ctx, shutdown{done: requested}, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// bundleSuffix is appended to the path of a signed file for its Sigstore bundle.
+const bundleSuffix = ".sigstore.json"
+
+// signer signs files with cosign and writes the signature, with the certificate of keyless
+// signatures and the transparency log entry, as a Sigstore bundle next to them.
+type signer struct {
+	cosign string
+	key    string
+}
+
+// newSigner returns a signer that signs with the key, a file path or KMS URI, or keyless
+// with an OIDC identity token if the key is empty.
+func newSigner(key string) (*signer, error) {
+	cosign, err := exec.LookPath("cosign")
+	if err != nil {
+		return nil, fmt.Errorf("signing requires cosign: %w", err)
+	}
+	return &signer{cosign: cosign, key: key}, nil
+}
+
+// sign signs the file at path and returns the path of its bundle.
+func (s *signer) sign(ctx context.Context, path string) (string, error) {
+	bundle := path + bundleSuffix
+	args := []string{"sign-blob", "--yes", "--bundle", bundle}
+	if s.key != "" {
+		args = append(args, "--key", s.key)
+	}
+	args = append(args, path)
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.cosign, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("cosign failed: %w: %s", err, strings.TrimSpace(out.String()))
+	}
+	return bundle, nil
+}
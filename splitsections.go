@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/splitelf"
+)
+
+// manifestExt is the extension of the default output names of --split-sections.
+const manifestExt = ".manifest.json"
+
+// splitSections stores the sections of the debug file at path as blobs in dir and replaces the
+// file with their manifest.
+func splitSections(path, dir, buildID string) error {
+	f, err := elfutils.Open(path)
+	if err != nil {
+		return err
+	}
+	m, err := splitelf.Split(f, splitelf.Dir(dir))
+	f.Close()
+	if err != nil {
+		return err
+	}
+	m.BuildID = buildID
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	return rewriteFile(path, func(dst io.Writer, _ io.Reader) error {
+		_, err := dst.Write(append(data, '\n'))
+		return err
+	})
+}
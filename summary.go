@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+)
+
+type fileStatus string
+
+// statusNoDebugInfo marks inputs without debug information, e.g. already stripped binaries,
+// statusSkipped the files of batches that are not ELF files, e.g. scripts or images, or copies of processed
+// or cataloged files.
+const (
+	statusOK          fileStatus = "ok"
+	statusFailed      fileStatus = "failed"
+	statusNoDebugInfo fileStatus = "no_debug_info"
+	statusSkipped     fileStatus = "skipped"
+)
+
+// fileResult is the outcome of processing a single file.
+type fileResult struct {
+	Path    string     `json:"path"`
+	Output  string     `json:"output,omitempty"`
+	BuildID string     `json:"build_id,omitempty"`
+	Status  fileStatus `json:"status"`
+	Error   string     `json:"error,omitempty"`
+	// DuplicateOf is the processed file with the same build ID as a skipped one.
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Cataloged is the file the catalog records as extracted with the build ID of a skipped one.
+	Cataloged string `json:"cataloged,omitempty"`
+	// Dropped are the sections left out of the output to fit --max-debug-size.
+	Dropped []string `json:"dropped_sections,omitempty"`
+}
+
+// fail records the error of the file, inputs without debug information are told apart from failures.
+func (r *fileResult) fail(err error) {
+	r.Status = statusFailed
+	if errors.Is(err, elfutils.ErrNoDebugInfo) || errors.Is(err, elfutils.ErrAlreadyStripped) {
+		r.Status = statusNoDebugInfo
+	}
+	r.Error = err.Error()
+}
+
+// summary is the machine-readable report of a batch run.
+// Inputs without debug information and skipped files are counted apart from the failed ones.
+type summary struct {
+	Total       int          `json:"total"`
+	Succeeded   int          `json:"succeeded"`
+	Failed      int          `json:"failed"`
+	NoDebugInfo int          `json:"no_debug_info"`
+	Skipped     int          `json:"skipped"`
+	Files       []fileResult `json:"files"`
+}
+
+func (s *summary) add(r fileResult) {
+	s.Total++
+	switch r.Status {
+	case statusOK:
+		s.Succeeded++
+	case statusFailed:
+		s.Failed++
+	case statusNoDebugInfo:
+		s.NoDebugInfo++
+	case statusSkipped:
+		s.Skipped++
+	}
+	s.Files = append(s.Files, r)
+}
+
+// writeFile writes the summary as JSON to the given path.
+func (s *summary) writeFile(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/demangle"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+)
+
+type symbolsCmd struct {
+	Path     string `kong:"required,arg,name='path',help='File path to the object or debug file to list the symbols of.',type:'path'"`
+	Type     string `kong:"enum='all,func,object,tls',default='all',help='Only list the symbols of the type, one of: all, func, object, tls.'"`
+	Dynamic  bool   `kong:"short='D',help='List the dynamic symbols (.dynsym) instead of the symbol table (.symtab). Files without a symbol table list their dynamic symbols either way.'"`
+	Defined  bool   `kong:"help='Only list the symbols defined in the file, not the ones it imports.'"`
+	Demangle bool   `kong:"short='C',help='Demangle the names of C++ and Rust symbols.'"`
+	JSON     bool   `kong:"name='json',help='Print the symbols as JSON.'"`
+}
+
+// symbol is a symbol as the symbols command prints it.
+type symbol struct {
+	Name    string `json:"name"`
+	Address uint64 `json:"address"`
+	Size    uint64 `json:"size"`
+	Type    string `json:"type"`
+	Binding string `json:"binding"`
+	// Section is the name of the section the symbol is defined in, empty for undefined symbols.
+	Section string `json:"section,omitempty"`
+	// Version is the version of a dynamic symbol, e.g. GLIBC_2.34.
+	Version string `json:"version,omitempty"`
+}
+
+// Run lists the symbols of the object file with their addresses and sizes, sorted by address,
+// as nm does.
+func (c *symbolsCmd) Run() error {
+	f, err := elfutils.Open(c.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open given file: %w", err)
+	}
+	defer f.Close()
+
+	syms, err := c.load(f)
+	if err != nil {
+		return err
+	}
+	var list []symbol
+	for _, s := range syms {
+		if !c.keep(s) {
+			continue
+		}
+		sym := symbol{
+			Name:    s.Name,
+			Address: s.Value,
+			Size:    s.Size,
+			Type:    strings.ToLower(strings.TrimPrefix(elf.ST_TYPE(s.Info).String(), "STT_")),
+			Binding: strings.ToLower(strings.TrimPrefix(elf.ST_BIND(s.Info).String(), "STB_")),
+			Version: s.Version,
+		}
+		if c.Demangle {
+			sym.Name = demangle.Filter(sym.Name)
+		}
+		if i := int(s.Section); s.Section != elf.SHN_UNDEF && i < len(f.Sections) {
+			sym.Section = f.Sections[i].Name
+		}
+		list = append(list, sym)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+
+	if c.JSON {
+		if list == nil {
+			list = []symbol{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	}
+	for _, s := range list {
+		name := s.Name
+		if s.Version != "" {
+			name += "@" + s.Version
+		}
+		fmt.Fprintf(os.Stdout, "%016x %8d %-6s %-6s %s\n", s.Address, s.Size, s.Type, s.Binding, name)
+	}
+	return nil
+}
+
+// load returns the symbols of the symbol table, or of the dynamic one.
+func (c *symbolsCmd) load(f *elf.File) ([]elf.Symbol, error) {
+	if !c.Dynamic {
+		syms, err := f.Symbols()
+		if err == nil {
+			return syms, nil
+		}
+		if !errors.Is(err, elf.ErrNoSymbols) {
+			return nil, fmt.Errorf("failed to read symbols: %w", err)
+		}
+	}
+	syms, err := f.DynamicSymbols()
+	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		return nil, fmt.Errorf("failed to read dynamic symbols: %w", err)
+	}
+	return syms, nil
+}
+
+// keep reports whether the symbol is listed: sections and source files are not.
+func (c *symbolsCmd) keep(s elf.Symbol) bool {
+	typ := elf.ST_TYPE(s.Info)
+	if typ == elf.STT_SECTION || typ == elf.STT_FILE || s.Name == "" {
+		return false
+	}
+	if c.Defined && s.Section == elf.SHN_UNDEF {
+		return false
+	}
+	switch c.Type {
+	case "func":
+		return typ == elf.STT_FUNC || typ == elf.STT_GNU_IFUNC
+	case "object":
+		return typ == elf.STT_OBJECT || typ == elf.STT_COMMON
+	case "tls":
+		return typ == elf.STT_TLS
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/digest"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+)
+
+// Fields of the output templates.
+const (
+	fieldDir     = "dir"
+	fieldName    = "name"
+	fieldBuildID = "buildid"
+	fieldArch    = "arch"
+	fieldHash    = "hash"
+)
+
+var templateFields = map[string]bool{
+	fieldDir:     true,
+	fieldName:    true,
+	fieldBuildID: true,
+	fieldArch:    true,
+	fieldHash:    true,
+}
+
+// outputTemplate is the template of the output paths of --output-template, e.g.
+// {dir}/{name}-{buildid:.8}.debug. Fields are replaced with their value, {field:.N} with its
+// first N characters. {{ and }} stand for literal braces.
+type outputTemplate struct {
+	parts []templatePart
+}
+
+// templatePart is a literal or, if field is set, a field of the template.
+type templatePart struct {
+	literal string
+	field   string
+	// width is the maximum number of characters of the value of the field, zero for all of them.
+	width int
+}
+
+func parseOutputTemplate(s string) (*outputTemplate, error) {
+	t := &outputTemplate{}
+	var lit strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"), strings.HasPrefix(s[i:], "}}"):
+			lit.WriteByte(s[i])
+			i++
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated field in output template %q", s)
+			}
+			part, err := parseTemplateField(s[i+1 : i+end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid output template %q: %w", s, err)
+			}
+			if lit.Len() > 0 {
+				t.parts = append(t.parts, templatePart{literal: lit.String()})
+				lit.Reset()
+			}
+			t.parts = append(t.parts, part)
+			i += end
+		case s[i] == '}':
+			return nil, fmt.Errorf("unmatched } in output template %q, use }} for a literal brace", s)
+		default:
+			lit.WriteByte(s[i])
+		}
+	}
+	if lit.Len() > 0 {
+		t.parts = append(t.parts, templatePart{literal: lit.String()})
+	}
+	return t, nil
+}
+
+// parseTemplateField parses a field of a template, without its braces.
+func parseTemplateField(s string) (templatePart, error) {
+	name, spec, hasSpec := strings.Cut(s, ":")
+	if !templateFields[name] {
+		fields := make([]string, 0, len(templateFields))
+		for f := range templateFields {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		return templatePart{}, fmt.Errorf("unknown field {%s}, must be one of: %s", name, strings.Join(fields, ", "))
+	}
+	part := templatePart{field: name}
+	if !hasSpec {
+		return part, nil
+	}
+	if !strings.HasPrefix(spec, ".") {
+		return templatePart{}, fmt.Errorf("invalid format %q of field {%s}, must be .N", spec, name)
+	}
+	width, err := strconv.Atoi(spec[1:])
+	if err != nil || width <= 0 {
+		return templatePart{}, fmt.Errorf("invalid format %q of field {%s}, must be .N", spec, name)
+	}
+	part.width = width
+	return part, nil
+}
+
+// uses reports whether the template has the given field.
+func (t *outputTemplate) uses(field string) bool {
+	for _, p := range t.parts {
+		if p.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// expand returns the path of the template with the given values of its fields.
+func (t *outputTemplate) expand(values map[string]string) (string, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		v := values[p.field]
+		if v == "" {
+			return "", fmt.Errorf("no value for field {%s} of output template", p.field)
+		}
+		if p.width > 0 && len(v) > p.width {
+			v = v[:p.width]
+		}
+		b.WriteString(v)
+	}
+	return b.String(), nil
+}
+
+// templateOutput returns the output path of the object file at path, read from input, by the
+// output template. The file is only opened and hashed if the template needs it.
+func (c *extractCmd) templateOutput(path, input string) (string, error) {
+	values := map[string]string{
+		fieldDir:  filepath.Dir(path),
+		fieldName: filepath.Base(path),
+	}
+	if path == stdio {
+		values[fieldDir], values[fieldName] = ".", "stdin"
+	}
+	if c.outputTemplate.uses(fieldBuildID) || c.outputTemplate.uses(fieldArch) {
+		f, err := elfutils.Open(input)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		values[fieldArch] = strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+		id, err := elfutils.BuildID(f)
+		if err != nil {
+			// The slashes of the Go build IDs would make directories.
+			id, err = elfutils.GoBuildID(f)
+			id = strings.ReplaceAll(id, "/", "-")
+		}
+		if err != nil && c.outputTemplate.uses(fieldBuildID) {
+			return "", fmt.Errorf("no build ID for the output template: %w", err)
+		}
+		values[fieldBuildID] = id
+	}
+	if c.outputTemplate.uses(fieldHash) {
+		sum, err := digest.File(c.hash(), input)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash input: %w", err)
+		}
+		values[fieldHash] = sum
+	}
+	return c.outputTemplate.expand(values)
+}
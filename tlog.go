@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/polarsignals/split-debug/pkg/tlog"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// tlogFlags configure the publishing of the digests of the uploaded debug files to a transparency log.
+type tlogFlags struct {
+	TlogURL      string `kong:"placeholder='URL',help='After each upload, publish the build ID and the digest by --hash of the debug file to the Rekor transparency log at this URL, e.g. https://rekor.sigstore.dev, signed with --tlog-key, so third parties can verify the debug files of the symbol server. The entries are hashedrekord entries of the statements documented in pkg/tlog.'"`
+	TlogKey      string `kong:"placeholder='PATH',help='Unencrypted PEM private key, ECDSA or RSA, to sign the entries of the transparency log with, e.g. generated with openssl ecparam -genkey -name prime256v1 -noout.',type:'path'"`
+	TlogQueueDir string `kong:"placeholder='DIR',help='Directory to queue the entries in while the transparency log cannot be reached, they are published before the next scans. Defaults to split-debug/tlog in the user cache directory.',type:'path'"`
+
+	spool *tlog.Spool
+}
+
+// openTlog sets up the configured publishing, uploads are the URL of the uploads.
+func (f *tlogFlags) openTlog(uploads string, queued bool) error {
+	if f.TlogURL == "" {
+		return nil
+	}
+	switch {
+	case uploads == "":
+		return usageError(errors.New("--tlog-url requires --upload-url, the uploaded debug files are published"))
+	case queued:
+		return usageError(errors.New("--tlog-url cannot be used with --upload-queue-size, the debug files are published once uploaded"))
+	case f.TlogKey == "":
+		return usageError(errors.New("--tlog-url requires --tlog-key"))
+	}
+	data, err := ioutil.ReadFile(f.TlogKey)
+	if err != nil {
+		return fmt.Errorf("failed to read --tlog-key: %w", err)
+	}
+	key, err := tlog.ParsePrivateKey(data)
+	if err != nil {
+		return usageError(fmt.Errorf("invalid --tlog-key: %w", err))
+	}
+	p, err := tlog.NewRekor(f.TlogURL, key)
+	if err != nil {
+		return usageError(fmt.Errorf("invalid --tlog-key: %w", err))
+	}
+	dir := f.TlogQueueDir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("failed to find the transparency log queue directory, use --tlog-queue-dir: %w", err)
+		}
+		dir = filepath.Join(cache, "split-debug", "tlog")
+	}
+	if f.spool, err = tlog.NewSpool(p, dir); err != nil {
+		return fmt.Errorf("failed to create transparency log queue: %w", err)
+	}
+	return nil
+}
+
+// flushTlog publishes the entries queued while the transparency log could not be reached.
+// Failures are logged, the entries stay queued.
+func (f *tlogFlags) flushTlog(ctx context.Context, logger log.Logger) {
+	if f.spool == nil {
+		return
+	}
+	n, err := f.spool.Flush(ctx)
+	if n > 0 {
+		level.Info(logger).Log("msg", "published queued digests to the transparency log", "entries", n)
+	}
+	if err != nil {
+		queued, _ := f.spool.Len()
+		level.Warn(logger).Log("msg", "failed to publish queued digests to the transparency log", "queued", queued, "err", err)
+	}
+}
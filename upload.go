@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/digest"
+	"github.com/polarsignals/split-debug/pkg/upload"
+)
+
+// uploadFlags configure the uploader the debug files are pushed to.
+type uploadFlags struct {
+	UploadURL       string `kong:"placeholder='URL',help='Upload the debug files with PUT requests to this URL, {build_id} is replaced with the build ID of the object file, e.g. https://symbols.example.com/debuginfo/{build_id}.'"`
+	UploadToken     string `kong:"env='SPLIT_DEBUG_UPLOAD_TOKEN',help='Authenticate the uploads with this bearer token.'"`
+	clientAuthFlags `kong:"prefix='upload-'"`
+
+	UploadChunkSize    byteSize  `kong:"help='Upload debug files larger than this in chunks of this size, e.g. 64MB. Failed uploads resume from the last chunk the server received.'"`
+	UploadStateDir     string    `kong:"help='Directory to keep the state of chunked uploads and the uploaded build IDs in. Defaults to split-debug/uploads in the user cache directory.',type:'path'"`
+	UploadSkipExisting bool      `kong:"help='Skip the uploads of debug files the server has already: build IDs uploaded with the same contents before are skipped right away, others are checked with a HEAD request of their upload URL first.'"`
+	UploadBandwidth    bandwidth `kong:"placeholder='RATE',help='Limit the uploads to this many bytes per second, shared by the concurrent uploads, e.g. 10MiB/s. Unlimited by default.'"`
+
+	UploadRetries         int           `kong:"default='3',help='Retry failed uploads this many times. Uploads rejected by the server are not retried, unless it is rate limiting or failing with a 5xx status.'"`
+	UploadBackoff         time.Duration `kong:"default='1s',help='Wait before the first retry of an upload, doubled for each further retry.'"`
+	UploadMaxBackoff      time.Duration `kong:"default='1m',help='Maximum wait between the retries of an upload.'"`
+	UploadTimeout         time.Duration `kong:"help='Maximum duration of an upload attempt, e.g. 10m. Unlimited by default.'"`
+	UploadCircuitBreaker  int           `kong:"default='5',help='Fail the uploads without attempting them for --upload-circuit-cooldown after this many consecutive uploads failed, so runs do not hang while the server is down. 0 disables it.'"`
+	UploadCircuitCooldown time.Duration `kong:"default='5m',help='Duration the uploads fail for once the circuit breaker tripped.'"`
+
+	UploadQueueSize   int      `kong:"help='Upload in the background while the extraction goes on, queuing up to this many debug files. The extraction waits while the queue is full. 0 uploads each debug file before extracting the next.'"`
+	UploadWorkers     int      `kong:"default='1',help='Upload this many queued debug files at a time.'"`
+	UploadQueueMemory byteSize `kong:"default='64MB',help='Keep up to this much of the queued debug files in memory, the others spill to temporary files.'"`
+}
+
+// uploader returns the configured uploader, or nil if uploads are not configured. Skipped uploads
+// are identified by the digests of the hash algorithm.
+func (f *uploadFlags) uploader(hash digest.Algorithm) (upload.Uploader, error) {
+	if f.UploadURL == "" {
+		return nil, nil
+	}
+	if f.UploadToken != "" && f.BearerTokenFile != "" {
+		return nil, errors.New("--upload-token and --upload-bearer-token-file are mutually exclusive")
+	}
+	opts := []upload.Option{upload.WithToken(f.UploadToken)}
+	client, err := f.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	if client != nil {
+		opts = append(opts, upload.WithClient(client))
+	}
+	dir := f.UploadStateDir
+	if dir == "" && (f.UploadChunkSize > 0 || f.UploadSkipExisting) {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the upload state directory, use --upload-state-dir: %w", err)
+		}
+		dir = filepath.Join(cache, "split-debug", "uploads")
+	}
+	if f.UploadChunkSize > 0 {
+		opts = append(opts, upload.WithChunks(int64(f.UploadChunkSize), dir))
+	}
+	if f.UploadBandwidth > 0 {
+		opts = append(opts, upload.WithBandwidth(int64(f.UploadBandwidth)))
+	}
+	h, err := upload.NewHTTP(f.UploadURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var u upload.Uploader = upload.NewRetrying(h,
+		upload.WithRetries(f.UploadRetries),
+		upload.WithBackoff(f.UploadBackoff, f.UploadMaxBackoff),
+		upload.WithTimeout(f.UploadTimeout),
+		upload.WithCircuitBreaker(f.UploadCircuitBreaker, f.UploadCircuitCooldown),
+	)
+	if f.UploadSkipExisting {
+		// Outside of the retries, the skipped uploads are not failures.
+		u = upload.NewDedup(u, h, filepath.Join(dir, "uploaded"), upload.WithHash(hash))
+	}
+	return u, nil
+}
+
+// queue returns the queue of the uploads of u, done is called with the outcome of each upload.
+func (f *uploadFlags) queue(ctx context.Context, u upload.Uploader, done func(buildID string, err error)) *upload.Queue {
+	return upload.NewQueue(ctx, u, f.UploadQueueSize,
+		upload.WithWorkers(f.UploadWorkers),
+		upload.WithQueueMemory(int64(f.UploadQueueMemory)),
+		upload.WithDone(done),
+	)
+}
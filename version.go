@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/polarsignals/split-debug/pkg/archive"
+	"github.com/polarsignals/split-debug/pkg/distpkg"
+	"github.com/polarsignals/split-debug/pkg/pipeline"
+)
+
+type versionCmd struct {
+	JSON bool `kong:"name='json',help='Print the version and features as JSON.'"`
+}
+
+// versionInfo describes the build of the tool and what it supports, automation gates on it.
+type versionInfo struct {
+	Version   string `json:"version"`
+	Module    string `json:"module,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+
+	Features features `json:"features"`
+}
+
+// features are the formats and algorithms of the build, the values of the corresponding flags.
+type features struct {
+	SectionCompression []string `json:"section_compression"`
+	Pack               []string `json:"pack"`
+	Encodings          []string `json:"encodings"`
+	Presets            []string `json:"presets"`
+	Archives           []string `json:"archives"`
+	Packages           []string `json:"packages"`
+	Encryption         []string `json:"encryption"`
+	Signing            []string `json:"signing"`
+	RedactModes        []string `json:"redact_modes"`
+	// UnwindTables are the machines the unwind tables of --unwind-table are built for.
+	UnwindTables []string `json:"unwind_tables"`
+	Catalog      []string `json:"catalog"`
+}
+
+func newVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:   version,
+		Revision:  commit,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Features: features{
+			SectionCompression: []string{"zlib"},
+			Pack:               []string{packTarZst, packTarXz},
+			Encodings:          []string{encodingZstdSeekable},
+			Presets:            []string{pipeline.PresetFull, pipeline.PresetGDB, pipeline.PresetMinimal, pipeline.PresetRust},
+			Archives:           []string{string(archive.Tar), string(archive.TarGz), string(archive.TarZst), string(archive.TarXz), string(archive.Zip)},
+			Packages:           []string{string(distpkg.Deb), string(distpkg.RPM)},
+			Encryption:         []string{encryptionScheme},
+			Signing:            []string{"cosign"},
+			RedactModes:        []string{redactHash, redactStrip},
+			UnwindTables:       []string{"x86_64", "aarch64"},
+			Catalog:            []string{"sqlite"},
+		},
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = bi.Main.Path
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Revision == "" {
+				info.Revision = s.Value
+			}
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// Run prints the version of the tool, with --json along with the features it supports.
+func (c *versionCmd) Run() error {
+	info := newVersionInfo()
+	if c.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	details := []string{info.GoVersion, info.Platform}
+	if info.Revision != "" {
+		rev := info.Revision
+		if info.Modified {
+			rev += "-dirty"
+		}
+		details = append([]string{"revision " + rev}, details...)
+	}
+	fmt.Fprintf(os.Stdout, "split-debug %s (%s)\n", info.Version, strings.Join(details, ", "))
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+	"github.com/polarsignals/split-debug/pkg/iohelper"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// walker expands the directories among the inputs into the regular files below them.
+// Files reached through several hard links or symlinks are only returned once.
+type walker struct {
+	logger         log.Logger
+	followSymlinks bool
+
+	files []string
+	seen  map[iohelper.FileID]bool
+	// dirs holds the directories being walked, following a symlink to one of them is a cycle.
+	dirs map[iohelper.FileID]bool
+}
+
+func newWalker(logger log.Logger, followSymlinks bool) *walker {
+	return &walker{
+		logger:         logger,
+		followSymlinks: followSymlinks,
+		seen:           map[iohelper.FileID]bool{},
+		dirs:           map[iohelper.FileID]bool{},
+	}
+}
+
+// expand returns the inputs with their directories replaced by the files below them, in lexical order.
+// Inputs that are not directories are kept, their errors are reported by the extraction.
+func (w *walker) expand(paths []string) []string {
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if path == stdio || err != nil || !fi.IsDir() {
+			w.files = append(w.files, path)
+			continue
+		}
+		w.walkDir(path, fi)
+	}
+	return w.files
+}
+
+func (w *walker) walkDir(dir string, fi os.FileInfo) {
+	if id, ok := iohelper.FileIDOf(fi); ok {
+		if w.dirs[id] {
+			level.Warn(w.logger).Log("msg", "skipping symlink cycle", "dir", dir)
+			return
+		}
+		w.dirs[id] = true
+		defer delete(w.dirs, id)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		level.Warn(w.logger).Log("msg", "failed to read directory", "dir", dir, "err", err)
+		return
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.Mode()&os.ModeSymlink != 0 {
+			if !w.followSymlinks {
+				level.Debug(w.logger).Log("msg", "skipping symlink", "file", path)
+				continue
+			}
+			if e, err = os.Stat(path); err != nil {
+				level.Debug(w.logger).Log("msg", "skipping dangling symlink", "file", path, "err", err)
+				continue
+			}
+		}
+		switch {
+		case e.IsDir():
+			w.walkDir(path, e)
+		case e.Mode().IsRegular():
+			w.addFile(path, e)
+		}
+	}
+}
+
+func (w *walker) addFile(path string, fi os.FileInfo) {
+	if id, ok := iohelper.FileIDOf(fi); ok {
+		if w.seen[id] {
+			level.Debug(w.logger).Log("msg", "skipping link to a file already walked", "file", path)
+			return
+		}
+		w.seen[id] = true
+	}
+	w.files = append(w.files, path)
+}
+
+// readBuildID returns the build ID of the object file at path, or its Go build ID. The build ID
+// of executables and shared libraries is read from their note segments, without reading the
+// section headers.
+func readBuildID(path string) (string, error) {
+	if r, err := os.Open(path); err == nil {
+		id, err := elfutils.BuildIDFromReaderAt(r)
+		r.Close()
+		if err == nil {
+			return id, nil
+		}
+	}
+	f, err := elfutils.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	id, err := elfutils.BuildID(f)
+	if err != nil {
+		return elfutils.GoBuildID(f)
+	}
+	return id, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/polarsignals/split-debug/pkg/debuginfod"
+	"github.com/polarsignals/split-debug/pkg/elfutils"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	// layoutDebuginfod is the layout of the debuginfod client cache, <build-id>/debuginfo, read by
+	// gdb, perf and the other libdebuginfod clients.
+	layoutDebuginfod = "debuginfod"
+	// layoutFlat is the layout of node-scan --output-dir, <build-id>.debug.
+	layoutFlat = "flat"
+)
+
+type warmCmd struct {
+	BuildIDs    string        `kong:"required,name='build-ids',placeholder='FILE',help='File listing the build IDs to fetch, one per line, - for stdin. Empty lines and lines starting with # are ignored.'"`
+	Servers     []string      `kong:"name='server',placeholder='URL',help='URL of a debuginfod server, tried in order. Defaults to the servers of $DEBUGINFOD_URLS.'"`
+	CacheDir    string        `kong:"help='Directory to fetch the debug files into. Defaults to the cache directory of the debuginfod clients, $DEBUGINFOD_CACHE_PATH or debuginfod_client in the user cache directory.',type:'path'"`
+	Timeout     time.Duration `kong:"help='Abort fetches that make no progress for this duration. Defaults to $DEBUGINFOD_TIMEOUT seconds, or 90s.'"`
+	Layout      string        `kong:"default='debuginfod',enum='debuginfod,flat',help='Layout of the cache directory: debuginfod for <build-id>/debuginfo as the debuginfod clients cache them, flat for <build-id>.debug as node-scan writes them.'"`
+	Concurrency int           `kong:"default='4',help='Fetch this many debug files at a time.'"`
+	clientAuthFlags
+}
+
+// warmStatus is the outcome of fetching the debug file of a build ID.
+type warmStatus int
+
+const (
+	warmFetched warmStatus = iota
+	warmCached
+	warmMissing
+	warmFailed
+)
+
+// Run fetches the debug files of the listed build IDs from the debuginfod servers into the
+// cache directory, so they are symbolized without waiting for the servers. Build IDs none of the
+// servers has are reported, but do not fail the run.
+func (c *warmCmd) Run(ctx context.Context, logger log.Logger, sd shutdown) error {
+	if len(c.Servers) == 0 {
+		c.Servers = debuginfod.ServersFromEnv()
+	}
+	if len(c.Servers) == 0 {
+		return usageError(fmt.Errorf("--server or $%s is required", debuginfod.URLsEnvVar))
+	}
+	if c.Timeout == 0 {
+		timeout, err := debuginfod.TimeoutFromEnv()
+		if err != nil {
+			return usageError(err)
+		}
+		c.Timeout = timeout
+	}
+	if c.Concurrency < 1 {
+		return usageError(errors.New("--concurrency must be at least 1"))
+	}
+	ids, err := c.readBuildIDs()
+	if err != nil {
+		return usageError(err)
+	}
+	if c.CacheDir == "" {
+		if c.CacheDir, err = debuginfod.CachePath(); err != nil {
+			return usageError(fmt.Errorf("failed to find the cache directory, use --cache-dir: %w", err))
+		}
+	}
+	if err := os.MkdirAll(c.CacheDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	opts := []debuginfod.Option{debuginfod.WithTimeout(c.Timeout)}
+	httpClient, err := c.httpClient()
+	if err != nil {
+		return usageError(err)
+	}
+	if httpClient != nil {
+		opts = append(opts, debuginfod.WithClient(httpClient))
+	}
+	client := debuginfod.NewClient(c.Servers, opts...)
+	var (
+		mu     sync.Mutex
+		counts [warmFailed + 1]int
+		wg     sync.WaitGroup
+		queue  = make(chan string)
+	)
+	for i := 0; i < c.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				status := c.warm(ctx, log.With(logger, "build_id", id), client, id)
+				mu.Lock()
+				counts[status]++
+				mu.Unlock()
+			}
+		}()
+	}
+	// The fetches in flight finish once the shutdown is requested.
+	queued := 0
+	for _, id := range ids {
+		if sd.requested() {
+			break
+		}
+		queue <- id
+		queued++
+	}
+	close(queue)
+	wg.Wait()
+
+	level.Info(logger).Log("msg", "warmed cache", "dir", c.CacheDir, "build_ids", len(ids),
+		"fetched", counts[warmFetched], "cached", counts[warmCached], "missing", counts[warmMissing], "failed", counts[warmFailed])
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if left := len(ids) - queued; left > 0 {
+		return fmt.Errorf("%d of %d build IDs were not fetched: %w", left, len(ids), errShutdown)
+	}
+	if failed := counts[warmFailed]; failed > 0 {
+		return &exitError{
+			code: exitPartialFailure,
+			err:  fmt.Errorf("failed to fetch the debug files of %d of %d build IDs", failed, len(ids)),
+		}
+	}
+	return nil
+}
+
+// readBuildIDs returns the build IDs listed in the file, in lower case and without duplicates.
+func (c *warmCmd) readBuildIDs() ([]string, error) {
+	var r io.Reader = os.Stdin
+	if c.BuildIDs != "-" {
+		f, err := os.Open(c.BuildIDs)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var ids []string
+	seen := map[string]bool{}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		id := strings.ToLower(strings.TrimSpace(s.Text()))
+		if id == "" || strings.HasPrefix(id, "#") {
+			continue
+		}
+		if !isHex(id) {
+			return nil, fmt.Errorf("%s:%d: invalid build ID %q", c.BuildIDs, line, id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read build IDs: %w", err)
+	}
+	return ids, nil
+}
+
+// path returns the path of the debug file of the build ID in the cache directory.
+func (c *warmCmd) path(buildID string) string {
+	if c.Layout == layoutFlat {
+		return filepath.Join(c.CacheDir, buildID+".debug")
+	}
+	return debuginfod.CacheFile(c.CacheDir, buildID)
+}
+
+// warm fetches the debug file of the build ID, unless it is cached already. Empty files are the
+// failed lookups the debuginfod clients cache, they are fetched again. The downloaded file must
+// have the build ID, so a misbehaving server does not poison the cache.
+func (c *warmCmd) warm(ctx context.Context, logger log.Logger, client *debuginfod.Client, buildID string) warmStatus {
+	dest := c.path(buildID)
+	if fi, err := os.Stat(dest); err == nil && fi.Size() > 0 {
+		level.Debug(logger).Log("msg", "debug file is cached", "path", dest)
+		return warmCached
+	}
+
+	body, server, err := client.Debuginfo(ctx, buildID)
+	if errors.Is(err, debuginfod.ErrNotFound) {
+		level.Warn(logger).Log("msg", "debug file not found on any server")
+		return warmMissing
+	}
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to fetch debug file", "err", err)
+		return warmFailed
+	}
+	defer body.Close()
+
+	if err := c.store(dest, body, buildID); err != nil {
+		if c.Layout == layoutDebuginfod {
+			// The build ID directory is only removed if it is empty.
+			os.Remove(filepath.Dir(dest))
+		}
+		level.Error(logger).Log("msg", "failed to fetch debug file", "server", server, "err", err)
+		return warmFailed
+	}
+	level.Debug(logger).Log("msg", "fetched debug file", "server", server, "path", dest)
+	return warmFetched
+}
+
+// store writes the debug file to a temporary file next to dest and moves it into place once it
+// is complete and has the build ID.
+func (c *warmCmd) store(dest string, r io.Reader, buildID string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".*"+partialSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := checkBuildID(f.Name(), buildID); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dest)
+}
+
+// checkBuildID checks that the fetched file is an ELF file of the build ID. Debug files without
+// build ID notes are accepted, e.g. the ones split-debug writes.
+func checkBuildID(path, buildID string) error {
+	f, err := elfutils.Open(path)
+	if err != nil {
+		return fmt.Errorf("fetched file is not an ELF file: %w", err)
+	}
+	defer f.Close()
+
+	id, err := elfutils.BuildID(f)
+	if errors.Is(err, elfutils.ErrNoBuildID) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read build ID of the fetched file: %w", err)
+	}
+	if id != buildID {
+		return fmt.Errorf("fetched file has build ID %s", id)
+	}
+	return nil
+}
+
+// isHex reports whether s is lower case hex, build IDs end up in paths and URLs.
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return s != ""
+}